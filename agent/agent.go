@@ -9,6 +9,8 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/mitchellh/cli"
@@ -16,9 +18,15 @@ import (
 	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
 	"github.com/protoconf/protoconf/command"
 	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/expiry"
 	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/rollout"
+	"github.com/protoconf/protoconf/targeting"
+	"github.com/protoconf/protoconf/tracing"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 type cliCommand struct{}
@@ -27,9 +35,23 @@ type cliConfig struct {
 	devProtoconfRoot  string
 	grpcAddress       string
 	prometheusAddress string
+	protoRoot         string
+	otlpEndpoint      string
+	rollouts          bool
+	targeting         bool
+	snapshotEvery     int
+	limits            command.LimitsConfig
+	allowedOrigins    string
+	leaderElection    bool
+	leaderLease       time.Duration
+	pruneInterval     time.Duration
+	cacheDir          string
+	readCacheTTL      time.Duration
+	readCacheStale    time.Duration
+	accessLog         string
 }
 
-func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
+func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig, *command.TLSConfig) {
 	flags := flag.NewFlagSet("", flag.ExitOnError)
 	flags.Usage = func() {
 		fmt.Fprintln(flags.Output(), "Usage: [OPTION]...")
@@ -38,49 +60,71 @@ func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
 
 	kVConfig := &command.KVStoreConfig{}
 	command.AddKVStoreFlags(flags, kVConfig)
+	tlsConfig := &command.TLSConfig{}
+	command.AddTLSFlags(flags, tlsConfig)
 
 	config := &cliConfig{}
 	flags.StringVar(&config.devProtoconfRoot, "dev", "", "Development mode - watch a local Protoconf directory for file changes")
 	flags.StringVar(&config.grpcAddress, "grpc-address", consts.AgentDefaultAddress, "Agent gRPC address")
-	flags.StringVar(&config.prometheusAddress, "http-address", ":9143", "Prometheus http address")
+	flags.StringVar(&config.prometheusAddress, "http-address", ":9143", "HTTP address of the Prometheus metrics and of the configs served as JSON")
+	flags.StringVar(&config.protoRoot, "proto-root", "", "Protoconf root the types of the configs served as JSON are read from, the -dev root by default")
+	tracing.AddFlag(flags, &config.otlpEndpoint)
+	flags.BoolVar(&config.rollouts, "rollouts", false, "Serve the new values of the configs rolled out, started with protoconf insert -rollout, to the subscribers their rollouts select")
+	flags.BoolVar(&config.targeting, "targeting", false, "Serve the values of the targeting rules of the configs, set with protoconf target set, to the subscribers matching their labels")
+	flags.IntVar(&config.snapshotEvery, "snapshot-every", DefaultSnapshotEvery, "Send the whole config every that many updates to the subscribers asking for deltas")
+	command.AddLimitsFlags(flags, &config.limits)
+	command.AddAccessLogFlag(flags, &config.accessLog)
+	flags.StringVar(&config.cacheDir, "cache-dir", "", "Cache the configs read from the store to this directory, and serve the cached configs, marked stale, while the store can't be read, starting even when the store is unreachable")
+	flags.DurationVar(&config.readCacheTTL, "read-cache-ttl", 0, "Keep watching the configs read for that long after their last reader, sharing the watches of the configs between their readers, so the configs read often are served from memory instead of from the store, no read cache when 0")
+	flags.DurationVar(&config.readCacheStale, "read-cache-stale", DefaultReadCacheStale, "Keep the values of the configs of the -read-cache-ttl cache for that long once they are no longer watched, serving them at once while they are read from the store again, and marked stale while the store can't be read")
+	flags.BoolVar(&config.leaderElection, "leader-election", false, "Elect a leader among the agents of the store to advance the -rollouts and prune the -history of the configs, while every agent serves the configs")
+	flags.DurationVar(&config.leaderLease, "leader-lease", DefaultLeaseDuration, "How long the other agents wait for a leader which stopped renewing its lease before electing another one")
+	flags.DurationVar(&config.pruneInterval, "prune-interval", DefaultPruneInterval, "How often the leader prunes the versions of the configs beyond -history")
+	flags.StringVar(&config.allowedOrigins, "http-allowed-origins", "", "Comma separated origins of the web pages allowed to read the configs served as JSON, e.g. https://dashboard.example.org, or * for every origin")
 
-	return flags, config, kVConfig
+	return flags, config, kVConfig, tlsConfig
 }
 
 func (c *cliCommand) Run(args []string) int {
-	flags, config, kVConfig := newFlagSet()
+	flags, config, kVConfig, tlsConfig := newFlagSet()
 	flags.Parse(args)
 
 	log.Printf("Starting Protoconf agent at \"%s\", version %s", config.grpcAddress, consts.Version)
+	shutdownTracing, err := tracing.Init(config.otlpEndpoint, "protoconf-agent")
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer shutdownTracing()
 
-	agentServer := &server{}
-	var err error
-	if config.devProtoconfRoot != "" {
+	if config.snapshotEvery < 1 {
+		log.Printf("Error, -snapshot-every must be at least 1")
+		return 1
+	}
+	limiter, err := config.limits.Limiter()
+	if err != nil {
+		log.Printf("Error setting up the limits of the clients, err=%s", err)
+		return 1
+	}
+	agentServer := &server{snapshotEvery: config.snapshotEvery, listInterval: ListInterval, queueSize: limiter.SubscriberQueue(), fleet: newFleet()}
+	if config.devProtoconfRoot != "" && config.rollouts {
+		err = errors.New("-rollouts serves the rollouts of the configs of a key-value store, it can't be used with -dev")
+	} else if config.devProtoconfRoot != "" && config.targeting {
+		err = errors.New("-targeting serves the targeting rules of the configs of a key-value store, it can't be used with -dev")
+	} else if config.devProtoconfRoot != "" && config.leaderElection {
+		err = errors.New("-leader-election elects a leader among the agents of a key-value store, it can't be used with -dev")
+	} else if config.devProtoconfRoot != "" && config.cacheDir != "" {
+		err = errors.New("-cache-dir caches the configs of a key-value store, it can't be used with -dev")
+	} else if config.devProtoconfRoot != "" && config.readCacheTTL > 0 {
+		err = errors.New("-read-cache-ttl caches the reads of a key-value store, it can't be used with -dev")
+	} else if config.readCacheTTL < 0 || config.readCacheStale < 0 {
+		err = errors.New("-read-cache-ttl and -read-cache-stale can't be negative")
+	} else if config.devProtoconfRoot != "" {
 		log.Printf("Using dev mode, watching directory protoconf_root=\"%s\"", config.devProtoconfRoot)
 		agentServer.watcher, err = libprotoconf.NewFileWatcher(config.devProtoconfRoot)
 	} else {
 		log.Printf("Connecting to %s at \"%s\", config path prefix=\"%s\"", kVConfig.Store, kVConfig.Address, kVConfig.Prefix)
-		if kVConfig.Store == command.KVStoreConsul {
-			agentServer.watcher, err = libprotoconf.NewKVWatcher(libprotoconf.Consul, kVConfig.Address, kVConfig.Prefix)
-		} else if kVConfig.Store == command.KVStoreZookeeper {
-			var address string
-			if kVConfig.Address != "" {
-				address = kVConfig.Address
-			} else {
-				address = consts.ZookeeperDefaultAddress
-			}
-			agentServer.watcher, err = libprotoconf.NewKVWatcher(libprotoconf.Zookeeper, address, kVConfig.Prefix)
-		} else if kVConfig.Store == command.KVStoreEtcd {
-			var address string
-			if kVConfig.Address != "" {
-				address = kVConfig.Address
-			} else {
-				address = consts.EtcdDefaultAddress
-			}
-			agentServer.watcher, err = libprotoconf.NewKVWatcher(libprotoconf.Etcd, address, kVConfig.Prefix)
-		} else {
-			log.Fatalf("Unknown key-value store %s", kVConfig.Store)
-		}
+		agentServer.watcher, err = NewKVWatcher(kVConfig, config.rollouts, config.targeting, config.cacheDir, config.readCacheTTL, config.readCacheStale)
 	}
 
 	if err != nil {
@@ -90,23 +134,93 @@ func (c *cliCommand) Run(args []string) int {
 
 	defer agentServer.watcher.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if config.leaderElection {
+		store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+		if _, ok := store.(libprotoconf.VersionedStore); err == nil && !ok {
+			store.Close()
+			err = libprotoconf.ErrElectionNotSupported
+		}
+		if err != nil {
+			log.Printf("Error setting up the leader election, err=%s", err)
+			return 1
+		}
+		l := &leader{store: store, prefix: kVConfig.Prefix, retention: kVConfig.History, pruneInterval: config.pruneInterval}
+		// The configs reverted keep their history as the configs written
+		l.expiries = expiry.NewManager(kVConfig.WithHistory(store), kVConfig.Prefix)
+		if config.rollouts {
+			l.rollouts = rollout.NewManager(store, kVConfig.Prefix)
+		}
+		log.Printf("Running for the leader of the agents, lease=%s", config.leaderLease)
+		go func() {
+			// The store is used by the leader only
+			defer store.Close()
+			if err := l.run(ctx, config.leaderLease); err != nil && err != context.Canceled {
+				log.Printf("Error electing the leader of the agents, err=%s", err)
+			}
+		}()
+	}
+
 	listener, err := net.Listen("tcp", config.grpcAddress)
 	if err != nil {
 		log.Printf("Error listening on address=\"%s\" err=%s", config.grpcAddress, err)
 		return 1
 	}
 
-	rpcServer := grpc.NewServer(
+	serverOptions := tracing.ServerOptions()
+	if config.accessLog != "" {
+		accessLog, err := command.OpenAccessLog(config.accessLog)
+		if err != nil {
+			log.Printf("Error opening access log, err=%s", err)
+			return 1
+		}
+		defer accessLog.Close()
+		// The calls limited are logged too
+		serverOptions = append(serverOptions, accessLog.ServerOptions()...)
+		log.Printf("Writing the access log to \"%s\"", config.accessLog)
+	}
+	serverOptions = append(serverOptions, limiter.ServerOptions("/v1.ProtoconfService/")...)
+	httpServer := &http.Server{Addr: config.prometheusAddress}
+	if tlsConfig.Enabled() {
+		httpServer.TLSConfig, err = tlsConfig.ServerConfig()
+		if err != nil {
+			log.Printf("Error setting up mutual TLS, err=%s", err)
+			return 1
+		}
+		log.Printf("Serving with mutual TLS, allowed SPIFFE IDs=%v", tlsConfig.AllowedIDs)
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(httpServer.TLSConfig)))
+	}
+
+	rpcServer := grpc.NewServer(append(serverOptions,
 		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
 		grpc.UnaryInterceptor(grpc_prometheus.UnaryServerInterceptor),
-	)
+	)...)
 	protoconfservice.RegisterProtoconfServiceServer(rpcServer, agentServer)
 	grpc_prometheus.Register(rpcServer)
 	http.Handle("/metrics", promhttp.Handler())
+	protoRoot := config.protoRoot
+	if protoRoot == "" {
+		protoRoot = config.devProtoconfRoot
+	}
+	var resolver Resolver
+	if protoRoot != "" {
+		resolver = NewRootResolver(protoRoot)
+	}
+	var allowedOrigins []string
+	if config.allowedOrigins != "" {
+		allowedOrigins = strings.Split(config.allowedOrigins, ",")
+	}
+	http.Handle(HTTPConfigsPath, NewCORSHandler(limiter.HTTPHandler(command.NewCompressionHandler(NewHTTPHandler(agentServer.watcher, resolver))), allowedOrigins))
 	log.Println("Protoconf agent running")
 	g, _ := errgroup.WithContext(context.TODO())
 	g.Go(func() error { return rpcServer.Serve(listener) })
-	g.Go(func() error { return http.ListenAndServe(config.prometheusAddress, nil) })
+	g.Go(func() error {
+		if httpServer.TLSConfig != nil {
+			return httpServer.ListenAndServeTLS("", "")
+		}
+		return httpServer.ListenAndServe()
+	})
 	err = g.Wait()
 	if err != nil {
 		log.Printf("Error serving gRPC, err=%s", err)
@@ -120,7 +234,7 @@ func (c *cliCommand) Help() string {
 	var b bytes.Buffer
 	b.WriteString(c.Synopsis())
 	b.WriteString("\n")
-	flags, _, _ := newFlagSet()
+	flags, _, _, _ := newFlagSet()
 	flags.SetOutput(&b)
 	flags.Usage()
 	return b.String()
@@ -135,8 +249,124 @@ func Command() (cli.Command, error) {
 	return &cliCommand{}, nil
 }
 
+// NewKVWatcher watches the configs written to the store set from the command
+// line, any store registered with libprotoconf.RegisterStore, along with the
+// rollouts of their new values when rollouts is set and their targeting rules
+// when targetingRules is set. When cacheDir is set, the configs are cached to
+// cacheDir and served from it while the store can't be read, and the store is
+// connected to once it's reachable. When readCacheTTL is set, the configs
+// are served from memory as NewReadCacheWatcher serves them, keeping their
+// values for readCacheStale.
+func NewKVWatcher(kVConfig *command.KVStoreConfig, rollouts bool, targetingRules bool, cacheDir string, readCacheTTL time.Duration, readCacheStale time.Duration) (libprotoconf.Watcher, error) {
+	open := func() (libprotoconf.Store, error) {
+		return libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	}
+	store, err := open()
+	if err != nil && cacheDir == "" {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Error connecting to the store, serving the configs cached in %s until it connects, err=%s", cacheDir, err)
+		store = &reconnectingStore{open: open}
+	}
+	watcher := libprotoconf.NewStoreWatcher(store, kVConfig.Prefix)
+	if readCacheTTL > 0 {
+		log.Printf("Caching the reads of the configs for %s, and their values for %s more", readCacheTTL, readCacheStale)
+		watcher = NewReadCacheWatcher(watcher, readCacheTTL, readCacheStale, CacheRetryInterval)
+	}
+	if cacheDir != "" {
+		log.Printf("Caching the configs to %s", cacheDir)
+		watcher = NewCacheWatcher(watcher, cacheDir, CacheRetryInterval)
+	}
+	if rollouts {
+		log.Printf("Serving the rollouts of the configs, read every %s", rollout.PollInterval)
+		watcher = rollout.NewWatcher(watcher, rollout.NewManager(store, kVConfig.Prefix), rollout.PollInterval)
+	}
+	if targetingRules {
+		log.Printf("Serving the targeting rules of the configs, read every %s", targeting.PollInterval)
+		watcher = targeting.NewWatcher(watcher, targeting.NewManager(store, kVConfig.Prefix), targeting.PollInterval)
+	}
+	return watcher, nil
+}
+
+// NewServer returns the ProtoconfService serving the configs read by watcher.
+// Configs can be listed when the watcher is a libprotoconf.Lister, and are
+// served to each client its own values when it's a libprotoconf.ClientWatcher.
+// The subscriptions with deltas are sent the whole config every
+// DefaultSnapshotEvery updates, and the subscriptions to the configs matching
+// a pattern list the configs every ListInterval. The subscribers are
+// disconnected when queueSize updates are waiting to be sent to them, and
+// are listed along with the versions they acknowledged by ListSubscribers.
+func NewServer(watcher libprotoconf.Watcher, queueSize int) protoconfservice.ProtoconfServiceServer {
+	return &server{watcher: watcher, snapshotEvery: DefaultSnapshotEvery, listInterval: ListInterval, queueSize: queueSize, fleet: newFleet()}
+}
+
 type server struct {
+	protoconfservice.UnimplementedProtoconfServiceServer
 	watcher libprotoconf.Watcher
+	// snapshotEvery is how often the subscriptions with deltas are sent the
+	// whole config
+	snapshotEvery int
+	// listInterval is how often the subscriptions to the configs matching a
+	// pattern list the configs
+	listInterval time.Duration
+	// queueSize is how many updates are queued to a subscriber before it's
+	// disconnected
+	queueSize int
+	// fleet tracks the subscribers, nil to track none
+	fleet *fleet
+}
+
+// ListConfigs lists the paths of the configs starting with the prefix of the
+// request, in order, limited to the configs of its type and to a page of
+// its page size when set
+func (s server) ListConfigs(ctx context.Context, request *protoconfservice.ListConfigsRequest) (*protoconfservice.ListConfigsResponse, error) {
+	return listConfigs(ctx, s.watcher, request)
+}
+
+// watch watches a config as the client of a call sees it, the client
+// described by labels
+func (s server) watch(ctx context.Context, path string, clientID string, labels map[string]string, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	watcher, ok := s.watcher.(libprotoconf.ClientWatcher)
+	if !ok {
+		return s.watcher.Watch(path, stopCh)
+	}
+	return watcher.WatchClient(path, libprotoconf.Client{ID: clientIdentity(ctx, clientID), Labels: labels}, stopCh)
+}
+
+// clientIdentity identifies the client of a call, by the ID it sets, its
+// SPIFFE ID or its host
+func clientIdentity(ctx context.Context, clientID string) string {
+	if clientID != "" {
+		return clientID
+	}
+	return command.PeerIdentity(ctx)
+}
+
+// GetConfig returns the current value of a config, the first value the
+// watcher reads
+func (s server) GetConfig(ctx context.Context, request *protoconfservice.GetConfigRequest) (*protoconfservice.ConfigUpdate, error) {
+	path := request.GetPath()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watchCh, err := s.watch(ctx, path, request.GetClientId(), request.GetLabels(), stopCh)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case config, ok := <-watchCh:
+		if !ok {
+			return nil, errors.New("watch channel closed")
+		}
+		if config.Error != nil {
+			log.Printf("Error reading config, path=%s err=%s", path, config.Error)
+			return nil, config.Error
+		}
+		return &protoconfservice.ConfigUpdate{Value: config.Value, Stale: config.Stale}, nil
+	}
 }
 
 func (s server) SubscribeForConfig(request *protoconfservice.ConfigSubscriptionRequest, srv protoconfservice.ProtoconfService_SubscribeForConfigServer) error {
@@ -144,7 +374,7 @@ func (s server) SubscribeForConfig(request *protoconfservice.ConfigSubscriptionR
 	log.Printf("Watching path=%s", path)
 
 	stopCh := make(chan struct{})
-	watchCh, err := s.watcher.Watch(path, stopCh)
+	watchCh, err := s.watch(srv.Context(), path, request.GetClientId(), request.GetLabels(), stopCh)
 	if err != nil {
 		return err
 	}
@@ -157,12 +387,24 @@ func (s server) SubscribeForConfig(request *protoconfservice.ConfigSubscriptionR
 		close(stopCh)
 	}()
 
+	queue := newSendQueue(s.queueSize)
+	defer queue.stop()
+
 	ctx := srv.Context()
+	subscriber := s.fleet.subscribe(path, clientIdentity(ctx, request.GetClientId()), request.GetLabels())
+	defer s.fleet.unsubscribe(subscriber)
+	// sent is the config the subscriber has, and sinceSnapshot the number of
+	// deltas sent since it was last sent the whole config
+	var sent *anypb.Any
+	sinceSnapshot := 0
+	sentStale := false
 	for {
 		select {
 		case <-ctx.Done():
 			log.Printf("Client stopped watching path=%s", path)
 			return ctx.Err()
+		case err := <-queue.errors():
+			return err
 		case config, ok := <-watchCh:
 			if !ok {
 				log.Printf("Watch channel closed for path=%s", path)
@@ -174,15 +416,66 @@ func (s server) SubscribeForConfig(request *protoconfservice.ConfigSubscriptionR
 				return config.Error
 			}
 
-			log.Printf("Sending update on path=%s", path)
-			resp := protoconfservice.ConfigUpdate{Value: config.Value}
-			go func() {
-				if err := srv.Send(&resp); err != nil {
-					log.Printf("Error sending config update, path=%s srv=%s err=%s", path, srv, err)
+			resp := &protoconfservice.ConfigUpdate{Value: config.Value}
+			if request.GetDeltas() {
+				update, err := s.update(sent, config.Value, sinceSnapshot)
+				if err != nil {
+					log.Printf("Error computing the delta of the config, sending the whole config, path=%s err=%s", path, err)
+				} else if update == nil && config.Stale == sentStale {
+					continue
+				} else if update != nil {
+					resp = update
+				}
+				sent = config.Value
+				if len(resp.UpdateFields) > 0 {
+					sinceSnapshot++
 				} else {
-					log.Printf("Update sent successfully path=%s", path)
+					sinceSnapshot = 0
+				}
+			}
+
+			resp.Stale, sentStale = config.Stale, config.Stale
+			resp.Version = Version(config.Value)
+			log.Printf("Sending update on path=%s delta=%t stale=%t", path, len(resp.UpdateFields) > 0, resp.Stale)
+			// Every subscriber sends the update in a span of its call,
+			// linked to the span the update was read in. The updates are
+			// sent in order, the deltas apply to the update before.
+			_, span := tracing.StartLinked(ctx, "send update", config.Span, tracing.PathKey.String(path))
+			err := queue.push(func() error {
+				err := srv.Send(resp)
+				tracing.End(span, err)
+				if err != nil {
+					log.Printf("Error sending config update, path=%s err=%s", path, err)
+					return err
 				}
-			}()
+				log.Printf("Update sent successfully path=%s", path)
+				s.fleet.sent(subscriber, resp.Version)
+				return nil
+			})
+			if err != nil {
+				tracing.End(span, err)
+				log.Printf("Disconnecting slow subscriber, path=%s err=%s", path, err)
+				return err
+			}
 		}
 	}
 }
+
+// update returns the update of a subscription with deltas from the config
+// sent before to next: the whole config first, every snapshotEvery updates,
+// when its type changes or when the delta isn't smaller, and the delta
+// otherwise. It returns nil when no field changed.
+func (s server) update(sent *anypb.Any, next *anypb.Any, sinceSnapshot int) (*protoconfservice.ConfigUpdate, error) {
+	full := &protoconfservice.ConfigUpdate{Value: next}
+	if sent == nil || sent.GetTypeUrl() != next.GetTypeUrl() || sinceSnapshot+1 >= s.snapshotEvery {
+		return full, nil
+	}
+	delta, err := Delta(sent, next)
+	if err != nil || delta == nil {
+		return nil, err
+	}
+	if len(delta.GetValue().GetValue()) >= len(next.GetValue()) {
+		return full, nil
+	}
+	return delta, nil
+}
@@ -0,0 +1,389 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// CacheRetryInterval is how often a config served from the cache is read
+// from the store again
+const CacheRetryInterval = 5 * time.Second
+
+// cacheSuffix ends the names of the files of the configs cached, a
+// serialized google.protobuf.Any per config
+const cacheSuffix = ".pb"
+
+var staleGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "protoconf_agent_stale_configs",
+	Help: "How many configs the agent serves from its cache, as it can't read them from its store",
+})
+
+func init() {
+	prometheus.MustRegister(staleGauge)
+}
+
+// NewCacheWatcher watches the configs of watcher and writes every value read
+// to dir, so the values are kept across restarts. When watcher fails, such
+// as when its store is unreachable, the last value of the config is served
+// instead, marked stale, and the config is watched again every
+// retryInterval. The configs which were never cached fail as they do without
+// a cache, and so do the configs which aren't found.
+func NewCacheWatcher(watcher libprotoconf.Watcher, dir string, retryInterval time.Duration) libprotoconf.Watcher {
+	return &cacheWatcher{
+		watcher:       watcher,
+		dir:           dir,
+		retryInterval: retryInterval,
+		stale:         make(map[string]int),
+	}
+}
+
+type cacheWatcher struct {
+	watcher       libprotoconf.Watcher
+	dir           string
+	retryInterval time.Duration
+	lock          sync.Mutex
+	// stale counts the watches of every config serving its cached value
+	stale map[string]int
+}
+
+func (w *cacheWatcher) Watch(path string, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	cached := w.read(path)
+	innerStopCh := make(chan struct{})
+	innerCh, err := w.watcher.Watch(path, innerStopCh)
+	if err != nil {
+		close(innerStopCh)
+		if cached == nil {
+			return nil, err
+		}
+		log.Printf("Error watching config, serving its cached value, path=%s err=%s", path, err)
+		innerCh = nil
+	}
+
+	watchCh := make(chan libprotoconf.Result)
+	go func() {
+		stale := false
+		setStale := func(value bool) {
+			if stale != value {
+				stale = value
+				w.setStale(path, value)
+			}
+		}
+		stopInner := func() {
+			if innerCh != nil {
+				close(innerStopCh)
+				// Drain the values sent until the watcher stops watching
+				go func(ch <-chan libprotoconf.Result) {
+					for range ch {
+					}
+				}(innerCh)
+				innerCh = nil
+			}
+		}
+		defer func() {
+			setStale(false)
+			stopInner()
+			close(watchCh)
+		}()
+
+		var last *anypb.Any
+		var retry <-chan time.Time
+		if innerCh == nil {
+			retry = time.After(w.retryInterval)
+			setStale(true)
+			select {
+			case watchCh <- libprotoconf.Result{Value: cached, Stale: true}:
+			case <-stopCh:
+				return
+			}
+		}
+		for {
+			var result libprotoconf.Result
+			select {
+			case <-stopCh:
+				return
+			case <-retry:
+				innerStopCh = make(chan struct{})
+				ch, err := w.watcher.Watch(path, innerStopCh)
+				if err == nil {
+					innerCh, retry = ch, nil
+					continue
+				}
+				close(innerStopCh)
+				if !errors.Is(err, libprotoconf.ErrConfigNotFound) {
+					retry = time.After(w.retryInterval)
+					continue
+				}
+				result = libprotoconf.Result{Error: err}
+			case r, ok := <-innerCh:
+				if !ok {
+					r = libprotoconf.Result{Error: errors.New("watch channel closed")}
+				}
+				result = r
+			}
+
+			if result.Error == nil {
+				w.write(path, result.Value)
+				last, cached = result.Value, nil
+				setStale(false)
+			} else {
+				stopInner()
+				retry = time.After(w.retryInterval)
+				if last == nil && cached == nil || errors.Is(result.Error, libprotoconf.ErrConfigNotFound) {
+					select {
+					case watchCh <- result:
+					case <-stopCh:
+					}
+					return
+				}
+				if stale {
+					continue
+				}
+				log.Printf("Error watching config, serving its cached value, path=%s err=%s", path, result.Error)
+				if last == nil {
+					last = cached
+				}
+				result = libprotoconf.Result{Value: last, Stale: true}
+				setStale(true)
+			}
+			select {
+			case watchCh <- result:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return watchCh, nil
+}
+
+// setStale counts a watch of the config of path serving its cached value,
+// or no longer serving it
+func (w *cacheWatcher) setStale(path string, stale bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if stale {
+		w.stale[path]++
+	} else if w.stale[path]--; w.stale[path] <= 0 {
+		delete(w.stale, path)
+	}
+	staleGauge.Set(float64(len(w.stale)))
+}
+
+// file is the file the config of path is cached to, false for the paths
+// which can't be cached, such as the paths escaping the directory of the
+// cache
+func (w *cacheWatcher) file(path string) (string, bool) {
+	name := filepath.FromSlash(path)
+	if !filepath.IsLocal(name) {
+		return "", false
+	}
+	return filepath.Join(w.dir, name+cacheSuffix), true
+}
+
+// read reads the cached value of the config of path, nil when it isn't
+// cached
+func (w *cacheWatcher) read(path string) *anypb.Any {
+	file, ok := w.file(path)
+	if !ok {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	value := &anypb.Any{}
+	if err == nil {
+		err = proto.Unmarshal(data, value)
+	}
+	if err != nil {
+		log.Printf("Error reading the cached value of config, path=%s err=%s", path, err)
+		return nil
+	}
+	return value
+}
+
+// write caches a value of the config of path, atomically replacing the file
+// of the config so a crash never leaves it partly written
+func (w *cacheWatcher) write(path string, value *anypb.Any) {
+	file, ok := w.file(path)
+	if !ok {
+		return
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(value)
+	if err == nil {
+		err = writeFile(file, data)
+	}
+	if err != nil {
+		log.Printf("Error caching config, path=%s err=%s", path, err)
+	}
+}
+
+func writeFile(file string, data []byte) error {
+	if current, err := ioutil.ReadFile(file); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// List lists the configs of the watcher, when it's a libprotoconf.Lister,
+// and the configs cached when it fails
+func (w *cacheWatcher) List(prefix string) ([]string, error) {
+	lister, ok := w.watcher.(libprotoconf.Lister)
+	if !ok {
+		return nil, errors.New("listing configs isn't supported")
+	}
+	paths, err := lister.List(prefix)
+	if err == nil {
+		return paths, nil
+	}
+	cached, cacheErr := w.cached(prefix)
+	if cacheErr != nil || len(cached) == 0 {
+		return nil, err
+	}
+	log.Printf("Error listing configs, listing the configs cached, prefix=%s err=%s", prefix, err)
+	return cached, nil
+}
+
+// cached lists the paths of the configs cached starting with prefix, in
+// order
+func (w *cacheWatcher) cached(prefix string) ([]string, error) {
+	paths := []string{}
+	err := filepath.Walk(w.dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(file, cacheSuffix) || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(w.dir, file)
+		if err != nil {
+			return err
+		}
+		path := strings.TrimSuffix(filepath.ToSlash(rel), cacheSuffix)
+		if strings.HasPrefix(path, prefix) && !strings.HasPrefix(path, ".") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, err
+}
+
+func (w *cacheWatcher) Close() {
+	w.watcher.Close()
+}
+
+// reconnectingStore opens its store on the first call it can be opened on,
+// for the agent to serve the configs it cached while its store is
+// unreachable
+type reconnectingStore struct {
+	open  func() (libprotoconf.Store, error)
+	lock  sync.Mutex
+	store libprotoconf.Store
+}
+
+func (s *reconnectingStore) get() (libprotoconf.Store, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.store != nil {
+		return s.store, nil
+	}
+	store, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Connected to the store")
+	s.store = store
+	return store, nil
+}
+
+func (s *reconnectingStore) Get(key string) ([]byte, error) {
+	store, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(key)
+}
+
+func (s *reconnectingStore) Set(key string, value []byte) error {
+	store, err := s.get()
+	if err != nil {
+		return err
+	}
+	return store.Set(key, value)
+}
+
+func (s *reconnectingStore) Delete(key string) error {
+	store, err := s.get()
+	if err != nil {
+		return err
+	}
+	return store.Delete(key)
+}
+
+func (s *reconnectingStore) List(prefix string) ([]string, error) {
+	store, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return store.List(prefix)
+}
+
+func (s *reconnectingStore) Watch(key string, stopCh <-chan struct{}) (<-chan libprotoconf.StoreEvent, error) {
+	store, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return store.Watch(key, stopCh)
+}
+
+func (s *reconnectingStore) History(key string) ([]*libprotoconf.ConfigVersion, error) {
+	store, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return store.History(key)
+}
+
+func (s *reconnectingStore) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.store != nil {
+		s.store.Close()
+	}
+}
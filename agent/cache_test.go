@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var errUnreachable = errors.New("the store is unreachable")
+
+// unreachableStore fails while it's down, as a store which can't be
+// connected to
+type unreachableStore struct {
+	*libprotoconf.MemoryStore
+	down atomic.Bool
+}
+
+func (s *unreachableStore) Watch(key string, stopCh <-chan struct{}) (<-chan libprotoconf.StoreEvent, error) {
+	if s.down.Load() {
+		return nil, errUnreachable
+	}
+	return s.MemoryStore.Watch(key, stopCh)
+}
+
+func (s *unreachableStore) List(prefix string) ([]string, error) {
+	if s.down.Load() {
+		return nil, errUnreachable
+	}
+	return s.MemoryStore.List(prefix)
+}
+
+func receive(t *testing.T, watchCh <-chan libprotoconf.Result) libprotoconf.Result {
+	select {
+	case result, ok := <-watchCh:
+		assert.True(t, ok, "the watch ended")
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the config")
+	}
+	return libprotoconf.Result{}
+}
+
+func TestCacheWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protoconf-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := &unreachableStore{MemoryStore: libprotoconf.NewMemoryStore()}
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("first")))
+	watcher := NewCacheWatcher(libprotoconf.NewStoreWatcher(store, ""), dir, 10*time.Millisecond)
+	stopCh := make(chan struct{})
+	watchCh, err := watcher.Watch("services/api", stopCh)
+	assert.NoError(t, err)
+	result := receive(t, watchCh)
+	assert.NoError(t, result.Error)
+	assert.False(t, result.Stale)
+	_, err = os.Stat(filepath.Join(dir, "services", "api"+cacheSuffix))
+	assert.NoError(t, err, "the config is cached")
+
+	// The last value is served while the store is down
+	store.down.Store(true)
+	store.Fail("services/api", errUnreachable)
+	result = receive(t, watchCh)
+	assert.NoError(t, result.Error)
+	assert.True(t, result.Stale)
+	value := &wrapperspb.StringValue{}
+	assert.NoError(t, result.Value.UnmarshalTo(value))
+	assert.Equal(t, "first", value.Value)
+
+	// and the config is read again once it's back
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("second")))
+	store.down.Store(false)
+	result = receive(t, watchCh)
+	assert.False(t, result.Stale)
+	assert.NoError(t, result.Value.UnmarshalTo(value))
+	assert.Equal(t, "second", value.Value)
+	close(stopCh)
+
+	// An agent starting while the store is down serves the configs cached
+	store.down.Store(true)
+	watcher = NewCacheWatcher(libprotoconf.NewStoreWatcher(store, ""), dir, 10*time.Millisecond)
+	stopCh = make(chan struct{})
+	defer close(stopCh)
+	watchCh, err = watcher.Watch("services/api", stopCh)
+	assert.NoError(t, err)
+	result = receive(t, watchCh)
+	assert.True(t, result.Stale)
+	assert.NoError(t, result.Value.UnmarshalTo(value))
+	assert.Equal(t, "second", value.Value)
+	paths, err := watcher.(libprotoconf.Lister).List("services/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/api"}, paths)
+
+	// The configs which were never cached fail as without a cache
+	_, err = watcher.Watch("services/web", stopCh)
+	assert.Equal(t, errUnreachable, err)
+	_, err = watcher.Watch("../outside", stopCh)
+	assert.Equal(t, errUnreachable, err)
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// DefaultSnapshotEvery is how often the subscriptions with deltas are sent
+// the whole config by default, every that many updates
+const DefaultSnapshotEvery = 10
+
+// fields splits an encoded message into its top-level fields, the records of
+// each field number concatenated in their order, and lists the numbers in
+// the order they first appear
+func fields(b []byte) (map[protowire.Number][]byte, []protowire.Number, error) {
+	records := make(map[protowire.Number][]byte)
+	var numbers []protowire.Number
+	for len(b) > 0 {
+		number, wireType, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, nil, protowire.ParseError(n)
+		}
+		m := protowire.ConsumeFieldValue(number, wireType, b[n:])
+		if m < 0 {
+			return nil, nil, protowire.ParseError(m)
+		}
+		if _, ok := records[number]; !ok {
+			numbers = append(numbers, number)
+		}
+		records[number] = append(records[number], b[:n+m]...)
+		b = b[n+m:]
+	}
+	return records, numbers, nil
+}
+
+// Delta returns the update carrying only the top-level fields of next which
+// differ from previous, nil when none does. The fields are compared as they
+// are encoded, without the types of the configs, so the configs of every
+// store can be sent as deltas. The configs must be of the same type.
+func Delta(previous *anypb.Any, next *anypb.Any) (*protoconfservice.ConfigUpdate, error) {
+	if previous.GetTypeUrl() != next.GetTypeUrl() {
+		return nil, fmt.Errorf("the type of the config changed from %s to %s", previous.GetTypeUrl(), next.GetTypeUrl())
+	}
+	old, _, err := fields(previous.GetValue())
+	if err != nil {
+		return nil, err
+	}
+	new, numbers, err := fields(next.GetValue())
+	if err != nil {
+		return nil, err
+	}
+
+	update := &protoconfservice.ConfigUpdate{Value: &anypb.Any{TypeUrl: next.GetTypeUrl()}}
+	for _, number := range numbers {
+		if !bytes.Equal(old[number], new[number]) {
+			update.UpdateFields = append(update.UpdateFields, int32(number))
+			update.Value.Value = append(update.Value.Value, new[number]...)
+		}
+	}
+	for number := range old {
+		if _, ok := new[number]; !ok {
+			// Cleared
+			update.UpdateFields = append(update.UpdateFields, int32(number))
+		}
+	}
+	if len(update.UpdateFields) == 0 {
+		return nil, nil
+	}
+	sort.Slice(update.UpdateFields, func(i, j int) bool { return update.UpdateFields[i] < update.UpdateFields[j] })
+	return update, nil
+}
+
+// ApplyUpdate returns the config an update of a subscription sets, previous
+// being the config of the update before. The updates carrying the whole
+// config return it as it is, the delta updates return previous with the
+// fields of the update replaced.
+func ApplyUpdate(previous *anypb.Any, update *protoconfservice.ConfigUpdate) (*anypb.Any, error) {
+	if len(update.GetUpdateFields()) == 0 {
+		return update.GetValue(), nil
+	}
+	if previous == nil {
+		return nil, errors.New("a delta update was received before the config")
+	}
+	if previous.GetTypeUrl() != update.GetValue().GetTypeUrl() {
+		return nil, fmt.Errorf("a delta update of type %s was received for a config of type %s", update.GetValue().GetTypeUrl(), previous.GetTypeUrl())
+	}
+	records, numbers, err := fields(previous.GetValue())
+	if err != nil {
+		return nil, err
+	}
+	replaced := make(map[protowire.Number]bool)
+	for _, number := range update.GetUpdateFields() {
+		replaced[protowire.Number(number)] = true
+	}
+	value := &anypb.Any{TypeUrl: previous.GetTypeUrl()}
+	for _, number := range numbers {
+		if !replaced[number] {
+			value.Value = append(value.Value, records[number]...)
+		}
+	}
+	value.Value = append(value.Value, update.GetValue().GetValue()...)
+	return value, nil
+}
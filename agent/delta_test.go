@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func config(secrets ...int32) *protoconfvalue.ProtoconfValue {
+	value := &protoconfvalue.ProtoconfValue{ProtoFile: strings.Repeat("large/", 100) + "config.proto"}
+	for _, pos := range secrets {
+		value.Secrets = append(value.Secrets, &protoconfvalue.SecretMetadata{Pos: pos, Len: 1})
+	}
+	return value
+}
+
+func encodeAny(t *testing.T, message proto.Message) *anypb.Any {
+	any, err := anypb.New(message)
+	assert.NoError(t, err)
+	return any
+}
+
+func TestDelta(t *testing.T) {
+	previous := encodeAny(t, config(1))
+	for _, test := range []struct {
+		next   *protoconfvalue.ProtoconfValue
+		fields []int32
+	}{
+		{config(1, 2), []int32{3}},
+		{config(), []int32{3}},
+		{&protoconfvalue.ProtoconfValue{Secrets: config(1).Secrets}, []int32{1}},
+	} {
+		next := encodeAny(t, test.next)
+		update, err := Delta(previous, next)
+		assert.NoError(t, err)
+		assert.Equal(t, test.fields, update.GetUpdateFields())
+		assert.Less(t, len(update.GetValue().GetValue()), len(next.GetValue()))
+
+		applied, err := ApplyUpdate(previous, update)
+		assert.NoError(t, err)
+		value := &protoconfvalue.ProtoconfValue{}
+		assert.NoError(t, applied.UnmarshalTo(value))
+		assert.True(t, proto.Equal(test.next, value), value.String())
+	}
+
+	update, err := Delta(previous, encodeAny(t, config(1)))
+	assert.NoError(t, err)
+	assert.Nil(t, update)
+	_, err = Delta(previous, encodeAny(t, wrapperspb.String("config")))
+	assert.Error(t, err)
+
+	// The updates without fields carry the whole config
+	full := encodeAny(t, wrapperspb.String("config"))
+	applied, err := ApplyUpdate(nil, &protoconfservice.ConfigUpdate{Value: full})
+	assert.NoError(t, err)
+	assert.Equal(t, full, applied)
+	_, err = ApplyUpdate(nil, &protoconfservice.ConfigUpdate{Value: full, UpdateFields: []int32{1}})
+	assert.Error(t, err)
+}
+
+type subscription struct {
+	grpc.ServerStream
+	ctx     context.Context
+	updates chan *protoconfservice.ConfigUpdate
+}
+
+func (s *subscription) Context() context.Context {
+	return s.ctx
+}
+
+func (s *subscription) Send(update *protoconfservice.ConfigUpdate) error {
+	select {
+	case s.updates <- update:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func TestSubscribeForConfigDeltas(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", config()))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &subscription{ctx: ctx, updates: make(chan *protoconfservice.ConfigUpdate)}
+	s := server{watcher: watcher, snapshotEvery: 3, queueSize: 10}
+	go s.SubscribeForConfig(&protoconfservice.ConfigSubscriptionRequest{Path: "services/api", Deltas: true}, stream)
+
+	var value *anypb.Any
+	receive := func(secrets ...int32) *protoconfservice.ConfigUpdate {
+		select {
+		case update := <-stream.updates:
+			var err error
+			value, err = ApplyUpdate(value, update)
+			assert.NoError(t, err)
+			received := &protoconfvalue.ProtoconfValue{}
+			assert.NoError(t, value.UnmarshalTo(received))
+			assert.True(t, proto.Equal(config(secrets...), received), received.String())
+			return update
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the update")
+		}
+		return nil
+	}
+
+	// The whole config is sent first and every 3 updates
+	assert.Empty(t, receive().GetUpdateFields())
+	assert.NoError(t, store.SetConfig("services/api", config(1)))
+	assert.Equal(t, []int32{3}, receive(1).GetUpdateFields())
+	assert.NoError(t, store.SetConfig("services/api", config(1, 2)))
+	assert.Equal(t, []int32{3}, receive(1, 2).GetUpdateFields())
+	assert.NoError(t, store.SetConfig("services/api", config(2)))
+	assert.Empty(t, receive(2).GetUpdateFields())
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	"github.com/protoconf/protoconf/targeting"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var exposuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "protoconf_experiment_exposures_total",
+	Help: "How many times the variants of the experiments of the flags were served, by config, flag and variant",
+}, []string{"path", "flag", "variant"})
+
+func init() {
+	prometheus.MustRegister(exposuresCounter)
+}
+
+// Evaluate evaluates a flag of a protoconf.Flags config for the context of
+// the request, reading the current value of the config as GetConfig does
+func (s server) Evaluate(ctx context.Context, request *protoconfservice.EvaluateRequest) (*protoconfservice.EvaluateResponse, error) {
+	config, err := s.GetConfig(ctx, &protoconfservice.GetConfigRequest{Path: request.GetPath()})
+	if err != nil {
+		return nil, err
+	}
+	flags := &protoconf.Flags{}
+	if err := config.GetValue().UnmarshalTo(flags); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "the config isn't a protoconf.Flags, path=%s type=%s", request.GetPath(), config.GetValue().GetTypeUrl())
+	}
+	flag, ok := flags.GetFlags()[request.GetFlag()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "flag not found, path=%s flag=%s", request.GetPath(), request.GetFlag())
+	}
+	key := request.GetKey()
+	if key == "" {
+		key = clientIdentity(ctx, "")
+	}
+	response := EvaluateFlag(request.GetFlag(), flag, key, request.GetLabels())
+	if response.GetVariant() != "" {
+		// The exposures are logged for the analysis of the experiments, which
+		// joins them with the outcomes of the contexts by their key
+		exposuresCounter.WithLabelValues(request.GetPath(), request.GetFlag(), response.GetVariant()).Inc()
+		log.Printf("Exposure path=%s flag=%s variant=%s key=%s", request.GetPath(), request.GetFlag(), response.GetVariant(), key)
+	}
+	return response, nil
+}
+
+// EvaluateFlag evaluates the flag named name for a context, identified by
+// key to the percentages of the rules and to the experiment and described by
+// labels. The value is the value of the first rule matching the context, or
+// of its variant of the experiment of the flag when none does, or the
+// default value of the flag.
+func EvaluateFlag(name string, flag *protoconf.Flags_Flag, key string, labels map[string]string) *protoconfservice.EvaluateResponse {
+	for i, rule := range flag.GetRules() {
+		if !targeting.Labels(rule.GetLabels()).Match(labels) {
+			continue
+		}
+		if percentage := rule.GetPercentage(); percentage > 0 && flagBucket(name, key) >= int(percentage)*100 {
+			continue
+		}
+		return &protoconfservice.EvaluateResponse{Value: rule.GetValue(), Rule: int32(i)}
+	}
+	if variant := assignVariant(name, flag.GetExperiment(), key); variant != nil {
+		return &protoconfservice.EvaluateResponse{Value: variant.GetValue(), Rule: -1, Variant: variant.GetName()}
+	}
+	return &protoconfservice.EvaluateResponse{Value: flag.GetDefaultValue(), Rule: -1}
+}
+
+// assignVariant assigns a context its variant of the experiment of a flag,
+// the variants taking shares of the buckets of the salt of the experiment in
+// proportion to their weights. It's nil without an experiment.
+func assignVariant(name string, experiment *protoconf.Flags_Experiment, key string) *protoconf.Flags_Variant {
+	var total int
+	for _, variant := range experiment.GetVariants() {
+		total += int(variant.GetWeight())
+	}
+	if total == 0 {
+		return nil
+	}
+	salt := experiment.GetSalt()
+	if salt == "" {
+		salt = name
+	}
+	b := flagBucket(salt, key)
+	var weights int
+	for _, variant := range experiment.GetVariants() {
+		weights += int(variant.GetWeight())
+		if b*total < weights*10000 {
+			return variant
+		}
+	}
+	return nil
+}
+
+// flagBucket places a context in one of 10000 buckets of a flag, or of the
+// salt of an experiment, as the rollouts place their subscribers, so that the contexts served a value at
+// 10% are served it at 50% too, and every flag picks other contexts first
+func flagBucket(name string, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum32() % 10000)
+}
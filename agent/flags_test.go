@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestEvaluate(t *testing.T) {
+	flags := &protoconf.Flags{Flags: map[string]*protoconf.Flags_Flag{
+		"new_checkout": {
+			DefaultValue: structpb.NewBoolValue(false),
+			Rules: []*protoconf.Flags_Rule{
+				{Labels: map[string]string{"country": "NL", "plan": "beta-*"}, Value: structpb.NewBoolValue(true)},
+				{Percentage: 10, Value: structpb.NewBoolValue(true)},
+			},
+		},
+		"checkout_button": {
+			DefaultValue: structpb.NewStringValue("blue"),
+			Rules: []*protoconf.Flags_Rule{
+				{Labels: map[string]string{"plan": "internal"}, Value: structpb.NewStringValue("red")},
+			},
+			Experiment: &protoconf.Flags_Experiment{Salt: "2024-03", Variants: []*protoconf.Flags_Variant{
+				{Name: "control", Weight: 75, Value: structpb.NewStringValue("blue")},
+				{Name: "green", Weight: 25, Value: structpb.NewStringValue("green")},
+			}},
+		},
+	}}
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("flags", flags))
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("web")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+	s := NewServer(watcher, command.DefaultSubscriberQueue)
+	ctx := context.Background()
+
+	response, err := s.Evaluate(ctx, &protoconfservice.EvaluateRequest{Path: "flags", Flag: "new_checkout", Key: "user-1", Labels: map[string]string{"country": "NL", "plan": "beta-2"}})
+	assert.NoError(t, err)
+	assert.True(t, response.GetValue().GetBoolValue())
+	assert.Equal(t, int32(0), response.GetRule())
+
+	// The percentages pick the same contexts every time
+	served := 0
+	for i := 0; i < 1000; i++ {
+		request := &protoconfservice.EvaluateRequest{Path: "flags", Flag: "new_checkout", Key: fmt.Sprintf("user-%d", i), Labels: map[string]string{"country": "DE"}}
+		response, err := s.Evaluate(ctx, request)
+		assert.NoError(t, err)
+		again, err := s.Evaluate(ctx, request)
+		assert.NoError(t, err)
+		assert.Equal(t, response.GetRule(), again.GetRule())
+		if response.GetRule() == 1 {
+			assert.True(t, response.GetValue().GetBoolValue())
+			served++
+		} else {
+			assert.Equal(t, int32(-1), response.GetRule())
+			assert.False(t, response.GetValue().GetBoolValue())
+		}
+	}
+	assert.InDelta(t, 100, served, 40)
+
+	// The contexts no rule matches are split between the variants
+	variants := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		response, err := s.Evaluate(ctx, &protoconfservice.EvaluateRequest{Path: "flags", Flag: "checkout_button", Key: fmt.Sprintf("user-%d", i)})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(-1), response.GetRule())
+		variants[response.GetVariant()]++
+		if response.GetVariant() == "green" {
+			assert.Equal(t, "green", response.GetValue().GetStringValue())
+		}
+	}
+	assert.Len(t, variants, 2)
+	assert.InDelta(t, 250, variants["green"], 60)
+	response, err = s.Evaluate(ctx, &protoconfservice.EvaluateRequest{Path: "flags", Flag: "checkout_button", Key: "user-1", Labels: map[string]string{"plan": "internal"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "red", response.GetValue().GetStringValue())
+	assert.Empty(t, response.GetVariant())
+
+	// Another salt assigns the contexts again
+	resalted := proto.Clone(flags.Flags["checkout_button"]).(*protoconf.Flags_Flag)
+	resalted.Experiment.Salt = "2024-04"
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		if EvaluateFlag("checkout_button", resalted, key, nil).GetVariant() != EvaluateFlag("checkout_button", flags.Flags["checkout_button"], key, nil).GetVariant() {
+			moved++
+		}
+	}
+	assert.Greater(t, moved, 200)
+
+	_, err = s.Evaluate(ctx, &protoconfservice.EvaluateRequest{Path: "flags", Flag: "old_checkout"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = s.Evaluate(ctx, &protoconfservice.EvaluateRequest{Path: "services/web", Flag: "new_checkout"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/targeting"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Version identifies the value of a config, the same for the same value on
+// every agent: the first 16 hex digits of the SHA-256 of its type and its
+// serialized value
+func Version(value *anypb.Any) string {
+	if value == nil {
+		return ""
+	}
+	h := sha256.New()
+	h.Write([]byte(value.GetTypeUrl()))
+	h.Write([]byte{0})
+	h.Write(value.GetValue())
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// fleet tracks the subscribers of the configs connected to the agent, along
+// with the versions of the configs they were sent and acknowledged. A nil
+// fleet tracks none.
+type fleet struct {
+	lock        sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+func newFleet() *fleet {
+	return &fleet{subscribers: make(map[*subscriber]bool)}
+}
+
+// subscriber is a subscription to a config
+type subscriber struct {
+	path      string
+	clientID  string
+	labels    map[string]string
+	connected time.Time
+
+	version             string
+	sent                time.Time
+	acknowledgedVersion string
+	acknowledged        time.Time
+}
+
+// subscribe tracks a subscription to the config of path until it's
+// unsubscribed
+func (f *fleet) subscribe(path string, clientID string, labels map[string]string) *subscriber {
+	if f == nil {
+		return nil
+	}
+	s := &subscriber{path: path, clientID: clientID, labels: labels, connected: time.Now()}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.subscribers[s] = true
+	return s
+}
+
+// unsubscribe stops tracking a subscription
+func (f *fleet) unsubscribe(s *subscriber) {
+	if f == nil {
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.subscribers, s)
+}
+
+// sent records the version of the update sent to a subscriber
+func (f *fleet) sent(s *subscriber, version string) {
+	if f == nil {
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	s.version, s.sent = version, time.Now()
+}
+
+// acknowledge records the version applied by the subscribers of a client to
+// a config, false when the client has no subscription to the config
+func (f *fleet) acknowledge(path string, clientID string, version string) bool {
+	if f == nil {
+		return false
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	found := false
+	for s := range f.subscribers {
+		if s.path == path && s.clientID == clientID {
+			s.acknowledgedVersion, s.acknowledged, found = version, time.Now(), true
+		}
+	}
+	return found
+}
+
+// list lists the subscribers of the configs starting with prefix matching
+// labels, ordered by path then by client
+func (f *fleet) list(prefix string, labels targeting.Labels) []*protoconfservice.Subscriber {
+	if f == nil {
+		return nil
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var subscribers []*protoconfservice.Subscriber
+	for s := range f.subscribers {
+		if !strings.HasPrefix(s.path, prefix) || !labels.Match(s.labels) {
+			continue
+		}
+		subscriber := &protoconfservice.Subscriber{
+			Path:                s.path,
+			ClientId:            s.clientID,
+			Labels:              s.labels,
+			Connected:           timestamppb.New(s.connected),
+			Version:             s.version,
+			AcknowledgedVersion: s.acknowledgedVersion,
+		}
+		if !s.sent.IsZero() {
+			subscriber.Sent = timestamppb.New(s.sent)
+		}
+		if !s.acknowledged.IsZero() {
+			subscriber.Acknowledged = timestamppb.New(s.acknowledged)
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	sort.Slice(subscribers, func(i, j int) bool {
+		if subscribers[i].GetPath() != subscribers[j].GetPath() {
+			return subscribers[i].GetPath() < subscribers[j].GetPath()
+		}
+		return subscribers[i].GetClientId() < subscribers[j].GetClientId()
+	})
+	return subscribers
+}
+
+// Acknowledge records the version of a config applied by a client subscribed
+// to it on this agent
+func (s server) Acknowledge(ctx context.Context, request *protoconfservice.AcknowledgeRequest) (*protoconfservice.AcknowledgeResponse, error) {
+	if request.GetVersion() == "" {
+		return nil, status.Error(codes.InvalidArgument, "the version acknowledged is missing")
+	}
+	clientID := clientIdentity(ctx, request.GetClientId())
+	if !s.fleet.acknowledge(request.GetPath(), clientID, request.GetVersion()) {
+		return nil, status.Errorf(codes.NotFound, "the client isn't subscribed to the config on this agent, path=%s client=%s", request.GetPath(), clientID)
+	}
+	return &protoconfservice.AcknowledgeResponse{}, nil
+}
+
+// ListSubscribers lists the subscribers connected to the agent, and the
+// versions they were sent and acknowledged
+func (s server) ListSubscribers(ctx context.Context, request *protoconfservice.ListSubscribersRequest) (*protoconfservice.ListSubscribersResponse, error) {
+	return &protoconfservice.ListSubscribersResponse{Subscribers: s.fleet.list(request.GetPrefix(), request.GetLabels())}, nil
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestFleet(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("v1")))
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("api")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+	s := NewServer(watcher, command.DefaultSubscriberQueue)
+	ctx := context.Background()
+
+	subscribe := func(path string, clientID string, labels map[string]string) (*subscription, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(ctx)
+		stream := &subscription{ctx: ctx, updates: make(chan *protoconfservice.ConfigUpdate)}
+		go s.SubscribeForConfig(&protoconfservice.ConfigSubscriptionRequest{Path: path, ClientId: clientID, Labels: labels}, stream)
+		return stream, cancel
+	}
+	receive := func(stream *subscription) *protoconfservice.ConfigUpdate {
+		select {
+		case update := <-stream.updates:
+			return update
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the update")
+		}
+		return nil
+	}
+	list := func(prefix string, labels map[string]string) []*protoconfservice.Subscriber {
+		response, err := s.ListSubscribers(ctx, &protoconfservice.ListSubscribersRequest{Prefix: prefix, Labels: labels})
+		assert.NoError(t, err)
+		return response.GetSubscribers()
+	}
+
+	web1, cancel1 := subscribe("services/web", "web-1", map[string]string{"service": "web"})
+	defer cancel1()
+	web2, cancel2 := subscribe("services/web", "web-2", map[string]string{"service": "web"})
+	defer cancel2()
+	api, cancelAPI := subscribe("services/api", "api-1", map[string]string{"service": "api"})
+	defer cancelAPI()
+	update := receive(web1)
+	assert.Equal(t, Version(update.GetValue()), update.GetVersion())
+	assert.Len(t, update.GetVersion(), 16)
+	assert.Equal(t, update.GetVersion(), receive(web2).GetVersion())
+	assert.NotEqual(t, update.GetVersion(), receive(api).GetVersion())
+	v1 := update.GetVersion()
+
+	// The subscribers are listed with the versions sent to them
+	assert.Eventually(t, func() bool {
+		for _, subscriber := range list("", nil) {
+			if subscriber.GetVersion() == "" {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	subscribers := list("services/", map[string]string{"service": "web"})
+	assert.Len(t, subscribers, 2)
+	assert.Equal(t, "web-1", subscribers[0].GetClientId())
+	assert.Equal(t, "web-2", subscribers[1].GetClientId())
+	assert.Equal(t, v1, subscribers[0].GetVersion())
+	assert.Empty(t, subscribers[0].GetAcknowledgedVersion())
+	assert.Len(t, list("services/api", nil), 1)
+
+	// and the versions they acknowledged
+	_, err := s.Acknowledge(ctx, &protoconfservice.AcknowledgeRequest{Path: "services/web", ClientId: "web-1", Version: v1})
+	assert.NoError(t, err)
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("v2")))
+	v2 := receive(web1).GetVersion()
+	assert.NotEqual(t, v1, v2)
+	assert.Equal(t, v2, receive(web2).GetVersion())
+	_, err = s.Acknowledge(ctx, &protoconfservice.AcknowledgeRequest{Path: "services/web", ClientId: "web-2", Version: v2})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		subscribers := list("services/web", nil)
+		return subscribers[0].GetVersion() == v2 && subscribers[1].GetVersion() == v2
+	}, 5*time.Second, 10*time.Millisecond)
+	subscribers = list("services/web", nil)
+	assert.Equal(t, v1, subscribers[0].GetAcknowledgedVersion())
+	assert.Equal(t, v2, subscribers[1].GetAcknowledgedVersion())
+	assert.NotNil(t, subscribers[1].GetAcknowledged())
+
+	_, err = s.Acknowledge(ctx, &protoconfservice.AcknowledgeRequest{Path: "services/web", ClientId: "web-3", Version: v2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = s.Acknowledge(ctx, &protoconfservice.AcknowledgeRequest{Path: "services/web", ClientId: "web-1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// The subscribers gone are no longer listed
+	cancel2()
+	assert.Eventually(t, func() bool {
+		return len(list("services/web", nil)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
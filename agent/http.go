@@ -0,0 +1,538 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// HTTPConfigsPath is the path the configs are served at over HTTP
+const HTTPConfigsPath = "/v1/configs/"
+
+// StaleHeader is set to true on the responses serving the last value of a
+// config cached by the agent, as it can't read the config from its store
+const StaleHeader = "Protoconf-Stale"
+
+// maxLongPollWait caps how long a request waits for a config to change
+const maxLongPollWait = 5 * time.Minute
+
+// sseKeepAlive is how often the streams of server-sent events send a comment
+// while the configs don't change
+const sseKeepAlive = 30 * time.Second
+
+// rootResolverReloadInterval is how often at most the protos of the root are
+// parsed again for a missing type
+const rootResolverReloadInterval = 10 * time.Second
+
+// Resolver resolves the types of the configs to marshal them to JSON
+type Resolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// NewHTTPHandler serves the configs read by watcher as JSON, read-only:
+//
+//	GET /v1/configs/?prefix=...   lists the paths of the configs, filtered and
+//	                              paged as ListConfigs with page_size,
+//	                              page_token and type
+//	GET /v1/configs/{path}        returns a config, with an ETag
+//
+// Requests for a config with If-None-Match and ?wait=30s wait for the config
+// to change, up to 5 minutes, and return 304 if it doesn't. Requests
+// accepting text/event-stream, or with ?watch=true, get every new value of the
+// config as server-sent events, and requests for the list with ?pattern=...
+// every value of the configs matching the pattern, as SubscribeForConfigs
+// sends them. The types of the configs are resolved with
+// resolver, protoregistry.GlobalTypes when nil.
+func NewHTTPHandler(watcher libprotoconf.Watcher, resolver Resolver) http.Handler {
+	if resolver == nil {
+		resolver = protoregistry.GlobalTypes
+	}
+	return &httpHandler{
+		watcher: watcher,
+		configs: server{watcher: watcher, listInterval: ListInterval},
+		marshal: protojson.MarshalOptions{Resolver: resolver},
+	}
+}
+
+type httpHandler struct {
+	watcher libprotoconf.Watcher
+	// configs subscribes to the configs matching a pattern
+	configs server
+	marshal protojson.MarshalOptions
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, HTTPConfigsPath)
+	streaming := r.URL.Query().Get("watch") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	switch {
+	case path == "" && streaming:
+		h.streamConfigs(w, r)
+	case path == "":
+		h.list(w, r)
+	case streaming:
+		h.stream(w, r, path)
+	default:
+		h.get(w, r, path)
+	}
+}
+
+// list lists the configs as ListConfigs does, taking its filters as query
+// parameters: prefix, page_size, page_token and type
+func (h *httpHandler) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	request := &protoconfservice.ListConfigsRequest{Prefix: query.Get("prefix"), PageToken: query.Get("page_token"), Type: query.Get("type")}
+	if value := query.Get("page_size"); value != "" {
+		pageSize, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, fmt.Sprintf("invalid page_size %q", value))
+			return
+		}
+		request.PageSize = int32(pageSize)
+	}
+	response, err := listConfigs(r.Context(), h.watcher, request)
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.InvalidArgument:
+		httpError(w, http.StatusBadRequest, status.Convert(err).Message())
+		return
+	case codes.Unimplemented:
+		httpError(w, http.StatusNotImplemented, status.Convert(err).Message())
+		return
+	default:
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Paths         []string `json:"paths"`
+		NextPageToken string   `json:"next_page_token,omitempty"`
+	}{response.GetPaths(), response.GetNextPageToken()})
+}
+
+// get returns the current value of a config, or waits for a value other
+// than the one of If-None-Match
+func (h *httpHandler) get(w http.ResponseWriter, r *http.Request, path string) {
+	var wait time.Duration
+	if value := r.URL.Query().Get("wait"); value != "" {
+		var err error
+		if wait, err = time.ParseDuration(value); err != nil || wait < 0 {
+			httpError(w, http.StatusBadRequest, fmt.Sprintf("invalid wait %q", value))
+			return
+		}
+		if wait > maxLongPollWait {
+			wait = maxLongPollWait
+		}
+	}
+	ifNoneMatch := r.Header.Get("If-None-Match")
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watchCh, err := h.watcher.Watch(path, stopCh)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var timeout <-chan time.Time
+	first := true
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout:
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case config, ok := <-watchCh:
+			if !ok {
+				httpError(w, http.StatusServiceUnavailable, "watch channel closed")
+				return
+			}
+			if config.Error != nil {
+				watchError(w, path, config.Error)
+				return
+			}
+			etag := configETag(config.Value)
+			if etag == ifNoneMatch {
+				if !first || wait == 0 {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				first = false
+				timeout = time.After(wait)
+				continue
+			}
+			data, err := h.marshal.Marshal(config.Value)
+			if err != nil {
+				log.Printf("Error marshaling config, path=%s err=%s", path, err)
+				httpError(w, http.StatusInternalServerError, fmt.Sprintf("error marshaling config to JSON, the type of the config may be unknown, err=%s", err))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", etag)
+			if config.Stale {
+				w.Header().Set(StaleHeader, "true")
+			}
+			w.Write(append(data, '\n'))
+			return
+		}
+	}
+}
+
+// stream sends the values of a config as server-sent events, until the
+// client goes away. A client reconnecting with the Last-Event-ID of the value
+// it has isn't sent it again.
+func (h *httpHandler) stream(w http.ResponseWriter, r *http.Request, path string) {
+	events, ok := newEventStream(w)
+	if !ok {
+		httpError(w, http.StatusNotImplemented, "streaming isn't supported")
+		return
+	}
+	defer events.close()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watchCh, err := h.watcher.Watch(path, stopCh)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	sent := ""
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case config, ok := <-watchCh:
+			if !ok {
+				return
+			}
+			if config.Error != nil && !events.started {
+				watchError(w, path, config.Error)
+				return
+			}
+			if config.Error != nil {
+				log.Printf("Error watching config, path=%s err=%s", path, config.Error)
+				events.send("", "error", []byte(config.Error.Error()))
+				return
+			}
+			etag := configETag(config.Value)
+			if etag == sent {
+				// Served again as it's no longer stale
+				continue
+			}
+			if etag == lastEventID {
+				// The client reconnected with this value
+				lastEventID, sent = "", etag
+				events.start()
+				continue
+			}
+			lastEventID = ""
+			data, err := h.marshal.Marshal(config.Value)
+			if err != nil {
+				log.Printf("Error marshaling config, path=%s err=%s", path, err)
+				events.send("", "error", []byte(fmt.Sprintf("error marshaling config to JSON, err=%s", err)))
+				return
+			}
+			if err := events.send(etag, "config", data); err != nil {
+				return
+			}
+			sent = etag
+		}
+	}
+}
+
+// streamConfigs sends the values of the configs matching the pattern of the
+// request as server-sent events, as SubscribeForConfigs sends them: config
+// events with the path and the value of a config, and removed events with
+// the path of a config which no longer matches
+func (h *httpHandler) streamConfigs(w http.ResponseWriter, r *http.Request) {
+	events, ok := newEventStream(w)
+	if !ok {
+		httpError(w, http.StatusNotImplemented, "streaming isn't supported")
+		return
+	}
+	defer events.close()
+	if _, ok := h.watcher.(libprotoconf.Lister); !ok {
+		httpError(w, http.StatusNotImplemented, "subscribing to the configs matching a pattern isn't supported")
+		return
+	}
+	request := &protoconfservice.ConfigsSubscriptionRequest{Pattern: r.URL.Query().Get("pattern")}
+	if _, err := ParsePattern(request.Pattern); err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events.start()
+	send := func(update *protoconfservice.ConfigsUpdate) error {
+		event := struct {
+			Path  string          `json:"path"`
+			Value json.RawMessage `json:"value,omitempty"`
+			Stale bool            `json:"stale,omitempty"`
+		}{Path: update.Path, Stale: update.Stale}
+		if update.Removed {
+			data, _ := json.Marshal(event)
+			return events.send("", "removed", data)
+		}
+		value, err := h.marshal.Marshal(update.Value)
+		if err != nil {
+			log.Printf("Error marshaling config, path=%s err=%s", update.Path, err)
+			events.send("", "error", []byte(fmt.Sprintf("error marshaling config to JSON, path=%s err=%s", update.Path, err)))
+			return err
+		}
+		event.Value = value
+		data, _ := json.Marshal(event)
+		return events.send("", "config", data)
+	}
+	err := h.configs.subscribeForConfigs(r.Context(), request, send, nil)
+	if err != nil && r.Context().Err() == nil {
+		events.send("", "error", []byte(err.Error()))
+	}
+}
+
+// eventStream writes server-sent events, and a comment every sseKeepAlive so
+// the proxies on the way don't close the stream while the configs don't
+// change
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	lock    sync.Mutex
+	// started tells whether the headers of the stream were written
+	started bool
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	return &eventStream{w: w, flusher: flusher, stopCh: make(chan struct{}), doneCh: make(chan struct{})}, true
+}
+
+// start writes the headers of the stream, once
+func (e *eventStream) start() {
+	if e.started {
+		return
+	}
+	e.started = true
+	e.w.Header().Set("Content-Type", "text/event-stream")
+	e.w.Header().Set("Cache-Control", "no-cache")
+	e.w.WriteHeader(http.StatusOK)
+	e.flusher.Flush()
+	go func() {
+		defer close(e.doneCh)
+		ticker := time.NewTicker(sseKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.lock.Lock()
+				fmt.Fprint(e.w, ": keep-alive\n\n")
+				e.flusher.Flush()
+				e.lock.Unlock()
+			case <-e.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// send writes an event, with an id when it isn't empty
+func (e *eventStream) send(id string, event string, data []byte) error {
+	e.start()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if id != "" {
+		fmt.Fprintf(e.w, "id: %s\n", id)
+	}
+	_, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, bytes.ReplaceAll(data, []byte("\n"), []byte(" ")))
+	e.flusher.Flush()
+	return err
+}
+
+// close stops the comments of the stream
+func (e *eventStream) close() {
+	if e.started {
+		close(e.stopCh)
+		<-e.doneCh
+	}
+}
+
+// NewCORSHandler lets the pages of origins read the configs served by
+// handler, and subscribe to them with EventSource. The origin "*" allows
+// every origin.
+func NewCORSHandler(handler http.Handler, origins []string) http.Handler {
+	allowed := make(map[string]bool)
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && (allowed["*"] || allowed[origin]) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After, "+StaleHeader)
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
+				w.Header().Set("Access-Control-Allow-Headers", "If-None-Match, Last-Event-ID")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// configETag identifies a value of a config
+func configETag(value *anypb.Any) string {
+	return fmt.Sprintf("\"%x\"", sha256.Sum256(append([]byte(value.GetTypeUrl()), value.GetValue()...)))
+}
+
+func watchError(w http.ResponseWriter, path string, err error) {
+	if errors.Is(err, libprotoconf.ErrConfigNotFound) {
+		httpError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Printf("Error reading config, path=%s err=%s", path, err)
+	httpError(w, http.StatusInternalServerError, err.Error())
+}
+
+func httpError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+// NewRootResolver resolves the types of the configs from the protos of a
+// protoconf root. The protos are parsed again when a type is missing, as
+// protos are added to the root, at most every 10 seconds. The types missing
+// from the root are looked up in protoregistry.GlobalTypes.
+func NewRootResolver(protoconfRoot string) Resolver {
+	return &rootResolver{protoconfRoot: protoconfRoot}
+}
+
+type rootResolver struct {
+	protoconfRoot string
+	lock          sync.Mutex
+	types         *protoregistry.Types
+	loaded        time.Time
+}
+
+// load parses the protos of the root, every proto under the import paths
+// except the ones of the Go modules
+func (r *rootResolver) load() (*protoregistry.Types, error) {
+	importPaths, err := utils.ProtoImportPaths(r.protoconfRoot)
+	if err != nil {
+		return nil, err
+	}
+	srcPath := importPaths[0]
+	var files []string
+	err = filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".proto") {
+			rel, err := filepath.Rel(srcPath, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	descriptors, err := utils.ParseProtoFiles(importPaths, nil, files...)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewAnyResolver(descriptors...), nil
+}
+
+// find looks a type up, parsing the protos again when it's missing
+func (r *rootResolver) find(lookup func(types Resolver) error) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.types != nil {
+		if err := lookup(r.types); err != protoregistry.NotFound {
+			return err
+		}
+	}
+	if time.Since(r.loaded) > rootResolverReloadInterval {
+		r.loaded = time.Now()
+		types, err := r.load()
+		if err != nil {
+			log.Printf("Error parsing the protos of %s, err=%s", r.protoconfRoot, err)
+		} else {
+			r.types = types
+			if err := lookup(r.types); err != protoregistry.NotFound {
+				return err
+			}
+		}
+	}
+	return lookup(protoregistry.GlobalTypes)
+}
+
+func (r *rootResolver) FindMessageByName(name protoreflect.FullName) (messageType protoreflect.MessageType, err error) {
+	err = r.find(func(types Resolver) (err error) {
+		messageType, err = types.FindMessageByName(name)
+		return err
+	})
+	return messageType, err
+}
+
+func (r *rootResolver) FindMessageByURL(url string) (messageType protoreflect.MessageType, err error) {
+	err = r.find(func(types Resolver) (err error) {
+		messageType, err = types.FindMessageByURL(url)
+		return err
+	})
+	return messageType, err
+}
+
+func (r *rootResolver) FindExtensionByName(field protoreflect.FullName) (extensionType protoreflect.ExtensionType, err error) {
+	err = r.find(func(types Resolver) (err error) {
+		extensionType, err = types.FindExtensionByName(field)
+		return err
+	})
+	return extensionType, err
+}
+
+func (r *rootResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (extensionType protoreflect.ExtensionType, err error) {
+	err = r.find(func(types Resolver) (err error) {
+		extensionType, err = types.FindExtensionByNumber(message, field)
+		return err
+	})
+	return extensionType, err
+}
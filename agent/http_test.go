@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("first")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+
+	server := httptest.NewServer(NewHTTPHandler(watcher, nil))
+	defer server.Close()
+	url := server.URL + HTTPConfigsPath
+
+	response, err := http.Get(url + "services/api")
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"@type": "type.googleapis.com/google.protobuf.StringValue", "value": "first"}`, string(body))
+	etag := response.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	response, err = http.Get(url + "?prefix=services/")
+	assert.NoError(t, err)
+	var list struct{ Paths []string }
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&list))
+	response.Body.Close()
+	assert.Equal(t, []string{"services/api"}, list.Paths)
+
+	// The configs are paged as ListConfigs pages them
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("web")))
+	response, err = http.Get(url + "?prefix=services/&page_size=1")
+	assert.NoError(t, err)
+	var page struct {
+		Paths         []string
+		NextPageToken string `json:"next_page_token"`
+	}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&page))
+	response.Body.Close()
+	assert.Equal(t, []string{"services/api"}, page.Paths)
+	response, err = http.Get(url + "?prefix=services/&page_size=1&page_token=" + page.NextPageToken)
+	assert.NoError(t, err)
+	page.NextPageToken = ""
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&page))
+	response.Body.Close()
+	assert.Equal(t, []string{"services/web"}, page.Paths)
+	assert.Empty(t, page.NextPageToken)
+	response, err = http.Get(url + "?page_size=many")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response, err = http.Get(url + "missing")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// Long polls return 304 when the config doesn't change, the new value
+	// when it does
+	get := func(wait string) *http.Response {
+		request, err := http.NewRequest(http.MethodGet, url+"services/api?wait="+wait, nil)
+		assert.NoError(t, err)
+		request.Header.Set("If-None-Match", etag)
+		response, err := http.DefaultClient.Do(request)
+		assert.NoError(t, err)
+		return response
+	}
+	response = get("10ms")
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+
+	go func() {
+		for store.Watching("services/api") == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		store.SetConfig("services/api", wrapperspb.String("second"))
+	}()
+	response = get("10s")
+	body, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), "second")
+
+	// Server-sent events
+	request, err := http.NewRequest(http.MethodGet, url+"services/api", nil)
+	assert.NoError(t, err)
+	request.Header.Set("Accept", "text/event-stream")
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	events := bufio.NewScanner(response.Body)
+	readData := func() string {
+		for events.Scan() {
+			if strings.HasPrefix(events.Text(), "data: ") {
+				return strings.TrimPrefix(events.Text(), "data: ")
+			}
+		}
+		t.Fatal("the stream ended")
+		return ""
+	}
+	assert.Contains(t, readData(), "second")
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("third")))
+	assert.Contains(t, readData(), "third")
+
+	// A client reconnecting with the ID of the last event isn't sent the
+	// value it has again
+	request, err = http.NewRequest(http.MethodGet, url+"services/api?watch=true", nil)
+	assert.NoError(t, err)
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	events = bufio.NewScanner(response.Body)
+	var lastEventID string
+	for lastEventID == "" && events.Scan() {
+		lastEventID = strings.TrimPrefix(events.Text(), "id: ")
+	}
+	response.Body.Close()
+	request.Header.Set("Last-Event-ID", lastEventID)
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	events = bufio.NewScanner(response.Body)
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("fourth")))
+	assert.Contains(t, readData(), "fourth")
+
+	request, err = http.NewRequest(http.MethodPost, url+"services/api", nil)
+	assert.NoError(t, err)
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}
+
+func TestHTTPHandlerStreamConfigs(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("api")))
+	assert.NoError(t, store.SetConfig("global", wrapperspb.String("global")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+
+	handler := NewHTTPHandler(watcher, nil).(*httpHandler)
+	handler.configs.listInterval = 10 * time.Millisecond
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	url := server.URL + HTTPConfigsPath
+
+	response, err := http.Get(url + "?watch=true&pattern=services/*")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	events := bufio.NewScanner(response.Body)
+	type event struct {
+		name  string
+		Path  string
+		Value struct{ Value string }
+	}
+	readEvent := func() event {
+		var e event
+		for events.Scan() {
+			line := events.Text()
+			if strings.HasPrefix(line, "event: ") {
+				e.name = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+				return e
+			}
+		}
+		t.Fatal("the stream ended")
+		return e
+	}
+	e := readEvent()
+	assert.Equal(t, "config", e.name)
+	assert.Equal(t, "services/api", e.Path)
+	assert.Equal(t, "api", e.Value.Value)
+
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("web")))
+	e = readEvent()
+	assert.Equal(t, "services/web", e.Path)
+	assert.Equal(t, "web", e.Value.Value)
+	assert.NoError(t, store.Delete("services/api"))
+	e = readEvent()
+	assert.Equal(t, "removed", e.name)
+	assert.Equal(t, "services/api", e.Path)
+
+	response, err = http.Get(url + "?watch=true&pattern=[")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestCORSHandler(t *testing.T) {
+	server := httptest.NewServer(NewCORSHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), []string{"https://dashboard.example.org"}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodOptions, server.URL, nil)
+	assert.NoError(t, err)
+	request.Header.Set("Origin", "https://dashboard.example.org")
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	assert.Equal(t, "https://dashboard.example.org", response.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, response.Header.Get("Access-Control-Allow-Headers"), "Last-Event-ID")
+
+	request.Method = http.MethodGet
+	request.Header.Set("Origin", "https://other.example.org")
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Empty(t, response.Header.Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/protoconf/protoconf/expiry"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/rollout"
+)
+
+// The defaults of the election of the leader of the agents
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultPruneInterval = time.Hour
+)
+
+// LeaderElection is the name of the election of the leader of the agents of
+// a store, under the prefix of the configs
+const LeaderElection = "agents"
+
+var leaderGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "protoconf_agent_leader",
+	Help: "Whether the agent is the leader of the agents of its store, 1 when it is",
+})
+
+func init() {
+	prometheus.MustRegister(leaderGauge)
+}
+
+// leader runs the write-side duties of the agents of a store on the agent
+// elected their leader, while every agent serves the configs
+type leader struct {
+	store  libprotoconf.Store
+	prefix string
+	// rollouts are advanced by the leader, nil when the agents don't serve
+	// the rollouts
+	rollouts *rollout.Manager
+	// expiries revert the configs expired
+	expiries *expiry.Manager
+	// retention is how many versions of every config are kept in the
+	// history, pruned every pruneInterval, 0 to leave the history as it is
+	retention     int
+	pruneInterval time.Duration
+}
+
+// candidate is the name of the agent in the elections, unique among the
+// agents running at once
+func candidate() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+// run runs for the leader of the agents until ctx is done
+func (l *leader) run(ctx context.Context, leaseDuration time.Duration) error {
+	return libprotoconf.Elect(ctx, l.store, l.prefix+libprotoconf.LeasePrefix+LeaderElection, candidate(), leaseDuration, l.lead)
+}
+
+// lead runs the duties of the leader until ctx is done
+func (l *leader) lead(ctx context.Context) {
+	leaderGauge.Set(1)
+	defer leaderGauge.Set(0)
+
+	if l.rollouts != nil {
+		go l.rollouts.Run(rollout.PollInterval, ctx.Done())
+	}
+	if l.expiries != nil {
+		go l.expiries.Run(expiry.PollInterval, ctx.Done())
+	}
+	if l.retention <= 0 {
+		<-ctx.Done()
+		return
+	}
+	ticker := time.NewTicker(l.pruneInterval)
+	defer ticker.Stop()
+	for {
+		dropped, err := libprotoconf.PruneHistory(l.store, l.retention)
+		if err != nil {
+			log.Printf("Error pruning the history of the configs, err=%s", err)
+		} else if dropped > 0 {
+			log.Printf("Pruned %d versions from the history of the configs", dropped)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
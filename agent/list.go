@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"sort"
+	"strings"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxPageSize is the largest page of configs listed
+const MaxPageSize = 1000
+
+// listConfigs lists the paths of the configs of watcher matching the filters
+// of a request, in order, a page of them when the request has a page size.
+// The page tokens are the last path of their page.
+func listConfigs(ctx context.Context, watcher libprotoconf.Watcher, request *protoconfservice.ListConfigsRequest) (*protoconfservice.ListConfigsResponse, error) {
+	lister, ok := watcher.(libprotoconf.Lister)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "listing configs isn't supported")
+	}
+	pageSize := int(request.GetPageSize())
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid page size %d", pageSize)
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	after, err := base64.RawURLEncoding.DecodeString(request.GetPageToken())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid page token %q", request.GetPageToken())
+	}
+
+	paths, err := lister.List(request.GetPrefix())
+	if err != nil {
+		log.Printf("Error listing configs, prefix=%s err=%s", request.GetPrefix(), err)
+		return nil, err
+	}
+	sort.Strings(paths)
+	if len(after) > 0 {
+		paths = paths[sort.Search(len(paths), func(i int) bool { return paths[i] > string(after) }):]
+	}
+
+	response := &protoconfservice.ListConfigsResponse{Paths: []string{}}
+	for _, path := range paths {
+		if pageSize > 0 && len(response.Paths) == pageSize {
+			response.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(response.Paths[pageSize-1]))
+			break
+		}
+		if request.GetType() != "" {
+			configType, err := readType(ctx, watcher, path)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Printf("Error reading the type of config, not listing it, path=%s err=%s", path, err)
+				continue
+			}
+			if configType != request.GetType() {
+				continue
+			}
+		}
+		response.Paths = append(response.Paths, path)
+	}
+	return response, nil
+}
+
+// readType reads the full name of the message type of a config
+func readType(ctx context.Context, watcher libprotoconf.Watcher, path string) (string, error) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watchCh, err := watcher.Watch(path, stopCh)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case config, ok := <-watchCh:
+		if !ok {
+			return "", status.Error(codes.Unavailable, "watch channel closed")
+		}
+		if config.Error != nil {
+			return "", config.Error
+		}
+		typeURL := config.Value.GetTypeUrl()
+		return typeURL[strings.LastIndex(typeURL, "/")+1:], nil
+	}
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestListConfigs(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, store.SetConfig(fmt.Sprintf("services/%d", i), wrapperspb.String("service")))
+	}
+	assert.NoError(t, store.SetConfig("services/flags", wrapperspb.Bool(true)))
+	assert.NoError(t, store.SetConfig("global", wrapperspb.String("global")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+	s := NewServer(watcher, command.DefaultSubscriberQueue)
+	ctx := context.Background()
+
+	// Every config is listed without a page size
+	response, err := s.ListConfigs(ctx, &protoconfservice.ListConfigsRequest{Prefix: "services/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/0", "services/1", "services/2", "services/3", "services/4", "services/flags"}, response.Paths)
+	assert.Empty(t, response.NextPageToken)
+
+	var pages [][]string
+	request := &protoconfservice.ListConfigsRequest{Prefix: "services/", PageSize: 4}
+	for {
+		response, err := s.ListConfigs(ctx, request)
+		assert.NoError(t, err)
+		pages = append(pages, response.Paths)
+		if response.NextPageToken == "" {
+			break
+		}
+		request.PageToken = response.NextPageToken
+	}
+	assert.Equal(t, [][]string{{"services/0", "services/1", "services/2", "services/3"}, {"services/4", "services/flags"}}, pages)
+
+	response, err = s.ListConfigs(ctx, &protoconfservice.ListConfigsRequest{Type: "google.protobuf.BoolValue"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/flags"}, response.Paths)
+	response, err = s.ListConfigs(ctx, &protoconfservice.ListConfigsRequest{Type: "google.protobuf.StringValue", PageSize: 2, PageToken: "c2VydmljZXMvMw"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/4"}, response.Paths)
+
+	_, err = s.ListConfigs(ctx, &protoconfservice.ListConfigsRequest{PageToken: "!"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = s.ListConfigs(ctx, &protoconfservice.ListConfigsRequest{PageSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListInterval is how often the subscriptions to the configs matching a
+// pattern list the configs, to watch the configs created since
+const ListInterval = 5 * time.Second
+
+// Pattern is a pattern of the paths of the configs, a prefix of the paths or
+// a glob
+type Pattern struct {
+	// Prefix is the part of the pattern before its first wildcard, which the
+	// paths matching it start with
+	Prefix string
+	glob   string
+}
+
+// ParsePattern parses a pattern of the paths of the configs: a pattern
+// without wildcards is a prefix of the paths, and a pattern with * ? or [
+// is a glob, as path.Match takes it, matching the whole path
+func ParsePattern(pattern string) (*Pattern, error) {
+	i := strings.IndexAny(pattern, `*?[\`)
+	if i < 0 {
+		return &Pattern{Prefix: pattern}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q, err=%s", pattern, err)
+	}
+	return &Pattern{Prefix: pattern[:i], glob: pattern}, nil
+}
+
+// Match tells whether the path of a config matches the pattern
+func (p *Pattern) Match(configPath string) bool {
+	if p.glob == "" {
+		return strings.HasPrefix(configPath, p.Prefix)
+	}
+	matched, _ := path.Match(p.glob, configPath)
+	return matched
+}
+
+// patternUpdate is a result of the watch of a config matching a pattern
+type patternUpdate struct {
+	path   string
+	stopCh chan struct{}
+	libprotoconf.Result
+}
+
+// SubscribeForConfigs streams the values of the configs matching the pattern
+// of the request, and their new values. The configs are listed every
+// listInterval, so the configs created since are subscribed to, and the
+// configs removed since are sent as removed.
+func (s server) SubscribeForConfigs(request *protoconfservice.ConfigsSubscriptionRequest, srv protoconfservice.ProtoconfService_SubscribeForConfigsServer) error {
+	queue := newSendQueue(s.queueSize)
+	defer queue.stop()
+	send := func(update *protoconfservice.ConfigsUpdate) error {
+		err := queue.push(func() error {
+			if err := srv.Send(update); err != nil {
+				log.Printf("Error sending config update, path=%s err=%s", update.Path, err)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Disconnecting slow subscriber, pattern=%s err=%s", request.GetPattern(), err)
+		}
+		return err
+	}
+	return s.subscribeForConfigs(srv.Context(), request, send, queue.errors())
+}
+
+// subscribeForConfigs subscribes to the configs matching the pattern of the
+// request, passing their updates to send, until ctx is done or send or
+// sendErrors fail
+func (s server) subscribeForConfigs(ctx context.Context, request *protoconfservice.ConfigsSubscriptionRequest, send func(*protoconfservice.ConfigsUpdate) error, sendErrors <-chan error) error {
+	lister, ok := s.watcher.(libprotoconf.Lister)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "subscribing to the configs matching a pattern isn't supported")
+	}
+	pattern, err := ParsePattern(request.GetPattern())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Printf("Watching pattern=%s", request.GetPattern())
+
+	updates := make(chan patternUpdate)
+	// watches are the stop channels of the watches of the configs matching
+	// by path, and sent are the configs a value was sent of
+	watches := make(map[string]chan struct{})
+	sent := make(map[string]bool)
+	// subscribers track the subscriptions to the configs watched
+	subscribers := make(map[string]*subscriber)
+	clientID := clientIdentity(ctx, request.GetClientId())
+	defer func() {
+		for configPath, stopCh := range watches {
+			close(stopCh)
+			s.fleet.unsubscribe(subscribers[configPath])
+		}
+	}()
+	stop := func(configPath string) {
+		close(watches[configPath])
+		delete(watches, configPath)
+		s.fleet.unsubscribe(subscribers[configPath])
+		delete(subscribers, configPath)
+	}
+
+	// list watches the configs matching and returns the configs removed
+	list := func() ([]string, error) {
+		paths, err := lister.List(pattern.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		matching := make(map[string]bool)
+		for _, configPath := range paths {
+			if !pattern.Match(configPath) {
+				continue
+			}
+			matching[configPath] = true
+			if watches[configPath] != nil {
+				continue
+			}
+			stopCh := make(chan struct{})
+			watchCh, err := s.watch(ctx, configPath, request.GetClientId(), request.GetLabels(), stopCh)
+			if err != nil {
+				close(stopCh)
+				log.Printf("Error watching config, path=%s err=%s", configPath, err)
+				continue
+			}
+			watches[configPath] = stopCh
+			subscribers[configPath] = s.fleet.subscribe(configPath, clientID, request.GetLabels())
+			go func(configPath string) {
+				for result := range watchCh {
+					select {
+					case updates <- patternUpdate{path: configPath, stopCh: stopCh, Result: result}:
+					case <-stopCh:
+						return
+					}
+				}
+				select {
+				case updates <- patternUpdate{path: configPath, stopCh: stopCh, Result: libprotoconf.Result{Error: errors.New("watch channel closed")}}:
+				case <-stopCh:
+				}
+			}(configPath)
+		}
+		for configPath := range watches {
+			if !matching[configPath] {
+				stop(configPath)
+			}
+		}
+		var removed []string
+		for configPath := range sent {
+			if !matching[configPath] {
+				removed = append(removed, configPath)
+				delete(sent, configPath)
+			}
+		}
+		sort.Strings(removed)
+		return removed, nil
+	}
+
+	if _, err := list(); err != nil {
+		log.Printf("Error listing configs, pattern=%s err=%s", request.GetPattern(), err)
+		return err
+	}
+	ticker := time.NewTicker(s.listInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Client stopped watching pattern=%s", request.GetPattern())
+			return ctx.Err()
+		case err := <-sendErrors:
+			return err
+		case <-ticker.C:
+			removed, err := list()
+			if err != nil {
+				log.Printf("Error listing configs, keeping the configs watched, pattern=%s err=%s", request.GetPattern(), err)
+				continue
+			}
+			for _, configPath := range removed {
+				log.Printf("Sending removal on path=%s", configPath)
+				if err := send(&protoconfservice.ConfigsUpdate{Path: configPath, Removed: true}); err != nil {
+					return err
+				}
+			}
+		case update := <-updates:
+			if watches[update.path] != update.stopCh {
+				// Stopped meanwhile
+				continue
+			}
+			if update.Error != nil {
+				// Watched again when the configs are listed next
+				log.Printf("Error watching config, path=%s err=%s", update.path, update.Error)
+				stop(update.path)
+				continue
+			}
+			log.Printf("Sending update on path=%s", update.path)
+			version := Version(update.Value)
+			if err := send(&protoconfservice.ConfigsUpdate{Path: update.path, Value: update.Value, Stale: update.Stale, Version: version}); err != nil {
+				return err
+			}
+			sent[update.path] = true
+			s.fleet.sent(subscribers[update.path], version)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestParsePattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		prefix  string
+		matches []string
+		misses  []string
+	}{
+		{"services/web/", "services/web/", []string{"services/web/api", "services/web/api/v2"}, []string{"services/webapp", "services/api"}},
+		{"services/web/*", "services/web/", []string{"services/web/api"}, []string{"services/web/api/v2", "services/web"}},
+		{"services/*/api", "services/", []string{"services/web/api"}, []string{"services/web/api/v2"}},
+		{"", "", []string{"services/web/api"}, nil},
+	} {
+		pattern, err := ParsePattern(test.pattern)
+		assert.NoError(t, err)
+		assert.Equal(t, test.prefix, pattern.Prefix)
+		for _, path := range test.matches {
+			assert.True(t, pattern.Match(path), "%s matches %s", test.pattern, path)
+		}
+		for _, path := range test.misses {
+			assert.False(t, pattern.Match(path), "%s doesn't match %s", test.pattern, path)
+		}
+	}
+	_, err := ParsePattern("services/[web")
+	assert.Error(t, err)
+}
+
+type patternSubscription struct {
+	grpc.ServerStream
+	ctx     context.Context
+	updates chan *protoconfservice.ConfigsUpdate
+}
+
+func (s *patternSubscription) Context() context.Context {
+	return s.ctx
+}
+
+func (s *patternSubscription) Send(update *protoconfservice.ConfigsUpdate) error {
+	select {
+	case s.updates <- update:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func TestSubscribeForConfigs(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/web/api", wrapperspb.String("api")))
+	assert.NoError(t, store.SetConfig("services/db/main", wrapperspb.String("db")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &patternSubscription{ctx: ctx, updates: make(chan *protoconfservice.ConfigsUpdate)}
+	s := server{watcher: watcher, listInterval: 10 * time.Millisecond, queueSize: 10}
+	go s.SubscribeForConfigs(&protoconfservice.ConfigsSubscriptionRequest{Pattern: "services/web/*"}, stream)
+
+	receive := func() (string, string, bool) {
+		select {
+		case update := <-stream.updates:
+			value := &wrapperspb.StringValue{}
+			if !update.GetRemoved() {
+				assert.NoError(t, update.GetValue().UnmarshalTo(value))
+			}
+			return update.GetPath(), value.GetValue(), update.GetRemoved()
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the update")
+		}
+		return "", "", false
+	}
+
+	path, value, _ := receive()
+	assert.Equal(t, "services/web/api", path)
+	assert.Equal(t, "api", value)
+
+	// The configs created and changed since are sent
+	assert.NoError(t, store.SetConfig("services/web/ui", wrapperspb.String("ui")))
+	path, value, _ = receive()
+	assert.Equal(t, "services/web/ui", path)
+	assert.Equal(t, "ui", value)
+	assert.NoError(t, store.SetConfig("services/web/api", wrapperspb.String("api v2")))
+	path, value, _ = receive()
+	assert.Equal(t, "services/web/api", path)
+	assert.Equal(t, "api v2", value)
+
+	// The configs deleted are sent as removed
+	assert.NoError(t, store.Delete("services/web/ui"))
+	path, _, removed := receive()
+	assert.Equal(t, "services/web/ui", path)
+	assert.True(t, removed)
+
+	err := s.SubscribeForConfigs(&protoconfservice.ConfigsSubscriptionRequest{Pattern: "services/[web"}, stream)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errSlowSubscriber disconnects the subscribers too slow to receive their
+// updates, so they can't hold the updates of the configs back
+var errSlowSubscriber = status.Error(codes.ResourceExhausted, "the subscriber is too slow to receive the updates, disconnecting it")
+
+// sendQueue sends the updates of a subscription in order, from a queue of a
+// bounded size
+type sendQueue struct {
+	queue  chan func() error
+	errCh  chan error
+	stopCh chan struct{}
+}
+
+// newSendQueue starts sending the updates queued, until it's stopped or a
+// send fails
+func newSendQueue(size int) *sendQueue {
+	q := &sendQueue{
+		queue:  make(chan func() error, size),
+		errCh:  make(chan error, 1),
+		stopCh: make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case send := <-q.queue:
+				if err := send(); err != nil {
+					q.errCh <- err
+					return
+				}
+			case <-q.stopCh:
+				return
+			}
+		}
+	}()
+	return q
+}
+
+// push queues an update, failing with errSlowSubscriber when the queue is
+// full
+func (q *sendQueue) push(send func() error) error {
+	select {
+	case q.queue <- send:
+		return nil
+	default:
+		return errSlowSubscriber
+	}
+}
+
+// errors receives the error of the send which failed
+func (q *sendQueue) errors() <-chan error {
+	return q.errCh
+}
+
+func (q *sendQueue) stop() {
+	close(q.stopCh)
+}
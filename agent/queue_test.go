@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestSlowSubscriberDisconnected(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("0")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The subscriber never receives its updates
+	stream := &subscription{ctx: ctx, updates: make(chan *protoconfservice.ConfigUpdate)}
+	s := server{watcher: watcher, snapshotEvery: DefaultSnapshotEvery, queueSize: 1}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.SubscribeForConfig(&protoconfservice.ConfigSubscriptionRequest{Path: "services/api"}, stream)
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for i := 1; ; i++ {
+		select {
+		case err := <-errCh:
+			assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+			return
+		case <-timeout:
+			t.Fatal("the slow subscriber wasn't disconnected")
+		case <-time.After(time.Millisecond):
+			assert.NoError(t, store.SetConfig("services/api", wrapperspb.String(fmt.Sprint(i))))
+		}
+	}
+}
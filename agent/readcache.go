@@ -0,0 +1,325 @@
+package agent
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// DefaultReadCacheStale is how long the read cache keeps the values of the
+// configs no longer watched by default
+const DefaultReadCacheStale = time.Minute
+
+// NewReadCacheWatcher shares the watches of the configs of watcher between
+// the readers of each config, and keeps watching a config for ttl after its
+// last reader went away, so the reads of the configs read often are served
+// from memory instead of from the store. Once a config is no longer watched
+// its value is kept for staleTTL: a read meanwhile is served the value kept
+// at once, then the value of the store when it differs. When the store
+// can't be read, the readers are served the value kept, marked stale, for
+// staleTTL since it was last read, and the config is watched again every
+// retryInterval.
+func NewReadCacheWatcher(watcher libprotoconf.Watcher, ttl time.Duration, staleTTL time.Duration, retryInterval time.Duration) libprotoconf.Watcher {
+	return &readCacheWatcher{
+		watcher:       watcher,
+		ttl:           ttl,
+		staleTTL:      staleTTL,
+		retryInterval: retryInterval,
+		entries:       make(map[string]*readCacheEntry),
+	}
+}
+
+type readCacheWatcher struct {
+	watcher       libprotoconf.Watcher
+	ttl           time.Duration
+	staleTTL      time.Duration
+	retryInterval time.Duration
+
+	lock    sync.Mutex
+	entries map[string]*readCacheEntry
+}
+
+// readCacheEntry is the value of a config kept, and the watch reading it
+type readCacheEntry struct {
+	path string
+	// value is the last value read, nil until the first one is, and stale
+	// is set when it's served stale as the store can't be read
+	value *anypb.Any
+	stale bool
+	// current is when value was last known to be the value of the store, zero
+	// while the config is watched
+	current time.Time
+	readers map[*cacheReader]bool
+	// stopWatch stops the watch of the config, nil when it isn't watched
+	stopWatch chan struct{}
+	// timer stops the watch once the readers are gone, drops the entry once
+	// its value is too old or watches the config again after an error, when
+	// retrying is set
+	timer    *time.Timer
+	retrying bool
+}
+
+// cacheReader is a reader of a config, sent the latest value of the config
+// it didn't receive yet
+type cacheReader struct {
+	updates chan libprotoconf.Result
+}
+
+func (r *cacheReader) send(result libprotoconf.Result) {
+	select {
+	case <-r.updates:
+	default:
+	}
+	r.updates <- result
+}
+
+func (w *readCacheWatcher) Watch(path string, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	reader := &cacheReader{updates: make(chan libprotoconf.Result, 1)}
+	w.lock.Lock()
+	e, ok := w.entries[path]
+	if !ok {
+		e = &readCacheEntry{path: path, readers: make(map[*cacheReader]bool)}
+		w.entries[path] = e
+	}
+	e.readers[reader] = true
+	if e.value != nil {
+		reader.send(libprotoconf.Result{Value: e.value, Stale: e.stale})
+	}
+	switch {
+	case e.stopWatch != nil:
+		w.setTimer(e, 0, nil)
+	case e.retrying:
+		// The config is watched again once the retry interval is over
+	default:
+		// The value kept is revalidated
+		w.setTimer(e, 0, nil)
+		w.watch(e)
+	}
+	w.lock.Unlock()
+
+	watchCh := make(chan libprotoconf.Result)
+	go func() {
+		defer func() {
+			w.removeReader(e, reader)
+			close(watchCh)
+		}()
+		for {
+			select {
+			case result := <-reader.updates:
+				select {
+				case watchCh <- result:
+				case <-stopCh:
+					return
+				}
+				if result.Error != nil {
+					return
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return watchCh, nil
+}
+
+// setTimer runs f after d, replacing the timer of the entry, or stops the
+// timer when f is nil. Called with the lock held.
+func (w *readCacheWatcher) setTimer(e *readCacheEntry, d time.Duration, f func()) {
+	e.retrying = false
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	if f == nil {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		if e.timer == timer {
+			e.timer, e.retrying = nil, false
+			f()
+		}
+	})
+	e.timer = timer
+}
+
+// watch starts watching the config of an entry. Called with the lock held.
+func (w *readCacheWatcher) watch(e *readCacheEntry) {
+	stopWatch := make(chan struct{})
+	e.stopWatch = stopWatch
+	go func() {
+		ch, err := w.watcher.Watch(e.path, stopWatch)
+		if err != nil {
+			w.fail(e, stopWatch, err)
+			return
+		}
+		defer func() {
+			// Drain the values sent until the watcher stops watching
+			go func() {
+				for range ch {
+				}
+			}()
+		}()
+		for {
+			select {
+			case result, ok := <-ch:
+				if !ok {
+					result.Error = errors.New("watch channel closed")
+				}
+				if result.Error != nil {
+					w.fail(e, stopWatch, result.Error)
+					return
+				}
+				w.update(e, stopWatch, result)
+			case <-stopWatch:
+				return
+			}
+		}
+	}()
+}
+
+// update serves a value read to the readers of an entry
+func (w *readCacheWatcher) update(e *readCacheEntry, stopWatch chan struct{}, result libprotoconf.Result) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if e.stopWatch != stopWatch {
+		return
+	}
+	if e.value != nil && proto.Equal(e.value, result.Value) && e.stale == result.Stale {
+		return
+	}
+	e.value, e.stale, e.current = result.Value, result.Stale, time.Time{}
+	for reader := range e.readers {
+		reader.send(result)
+	}
+}
+
+// fail stops the watch of an entry which failed. Its readers are served its
+// value, marked stale, while it isn't too old and the config is watched again
+// every retry interval, and are sent the error otherwise.
+func (w *readCacheWatcher) fail(e *readCacheEntry, stopWatch chan struct{}, err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if e.stopWatch != stopWatch {
+		return
+	}
+	close(stopWatch)
+	e.stopWatch = nil
+	if e.current.IsZero() {
+		e.current = time.Now()
+	}
+	if e.value == nil || errors.Is(err, libprotoconf.ErrConfigNotFound) || time.Since(e.current) >= w.staleTTL {
+		for reader := range e.readers {
+			reader.send(libprotoconf.Result{Error: err})
+		}
+		e.readers = make(map[*cacheReader]bool)
+		w.drop(e)
+		return
+	}
+	if !e.stale {
+		log.Printf("Error watching config, serving the value kept in memory, path=%s err=%s", e.path, err)
+		e.stale = true
+		for reader := range e.readers {
+			reader.send(libprotoconf.Result{Value: e.value, Stale: true})
+		}
+	}
+	w.retry(e)
+}
+
+// retry watches the config of an entry serving its stale value again after
+// the retry interval, while it has readers and its value isn't too old.
+// Called with the lock held.
+func (w *readCacheWatcher) retry(e *readCacheEntry) {
+	w.setTimer(e, w.retryInterval, func() {
+		if len(e.readers) == 0 {
+			w.keep(e)
+			return
+		}
+		w.watch(e)
+	})
+	e.retrying = true
+}
+
+// removeReader removes a reader gone away, and schedules the end of the
+// watch of the config, or the drop of the entry, once the last reader is gone
+func (w *readCacheWatcher) removeReader(e *readCacheEntry, reader *cacheReader) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !e.readers[reader] {
+		return
+	}
+	delete(e.readers, reader)
+	if len(e.readers) > 0 {
+		return
+	}
+	if e.stopWatch == nil {
+		w.keep(e)
+		return
+	}
+	w.setTimer(e, w.ttl, func() {
+		if e.stopWatch == nil {
+			w.keep(e)
+			return
+		}
+		close(e.stopWatch)
+		e.stopWatch = nil
+		if e.value == nil {
+			w.drop(e)
+			return
+		}
+		if e.current.IsZero() {
+			e.current = time.Now()
+		}
+		w.keep(e)
+	})
+}
+
+// keep keeps the value of an entry no longer watched until it's too old.
+// Called with the lock held.
+func (w *readCacheWatcher) keep(e *readCacheEntry) {
+	w.setTimer(e, w.staleTTL-time.Since(e.current), func() {
+		w.drop(e)
+	})
+}
+
+// drop forgets an entry without readers. Called with the lock held.
+func (w *readCacheWatcher) drop(e *readCacheEntry) {
+	if len(e.readers) > 0 || e.stopWatch != nil {
+		return
+	}
+	w.setTimer(e, 0, nil)
+	if w.entries[e.path] == e {
+		delete(w.entries, e.path)
+	}
+}
+
+// List lists the configs of the watcher, when it's a libprotoconf.Lister
+func (w *readCacheWatcher) List(prefix string) ([]string, error) {
+	lister, ok := w.watcher.(libprotoconf.Lister)
+	if !ok {
+		return nil, errors.New("listing configs isn't supported")
+	}
+	return lister.List(prefix)
+}
+
+// Close stops the watches of the configs and closes the watcher
+func (w *readCacheWatcher) Close() {
+	w.lock.Lock()
+	for _, e := range w.entries {
+		w.setTimer(e, 0, nil)
+		if e.stopWatch != nil {
+			close(e.stopWatch)
+			e.stopWatch = nil
+		}
+	}
+	w.entries = make(map[string]*readCacheEntry)
+	w.lock.Unlock()
+	w.watcher.Close()
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// countingStore counts the watches of the keys of a store
+type countingStore struct {
+	*unreachableStore
+	watches atomic.Int32
+}
+
+func (s *countingStore) Watch(key string, stopCh <-chan struct{}) (<-chan libprotoconf.StoreEvent, error) {
+	s.watches.Add(1)
+	return s.unreachableStore.Watch(key, stopCh)
+}
+
+func TestReadCacheWatcher(t *testing.T) {
+	store := &countingStore{unreachableStore: &unreachableStore{MemoryStore: libprotoconf.NewMemoryStore()}}
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("first")))
+	watcher := NewReadCacheWatcher(libprotoconf.NewStoreWatcher(store, ""), 100*time.Millisecond, time.Minute, 10*time.Millisecond)
+	defer watcher.Close()
+	read := func(watchCh <-chan libprotoconf.Result) (string, bool) {
+		result := receive(t, watchCh)
+		assert.NoError(t, result.Error)
+		value := &wrapperspb.StringValue{}
+		assert.NoError(t, result.Value.UnmarshalTo(value))
+		return value.Value, result.Stale
+	}
+
+	// The readers of a config share its watch
+	stopCh := make(chan struct{})
+	watchCh, err := watcher.Watch("services/api", stopCh)
+	assert.NoError(t, err)
+	value, _ := read(watchCh)
+	assert.Equal(t, "first", value)
+	otherStopCh := make(chan struct{})
+	otherCh, err := watcher.Watch("services/api", otherStopCh)
+	assert.NoError(t, err)
+	value, _ = read(otherCh)
+	assert.Equal(t, "first", value)
+	close(otherStopCh)
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("second")))
+	value, _ = read(watchCh)
+	assert.Equal(t, "second", value)
+	close(stopCh)
+
+	// and it's kept for the TTL after the last reader
+	stopCh = make(chan struct{})
+	watchCh, err = watcher.Watch("services/api", stopCh)
+	assert.NoError(t, err)
+	value, _ = read(watchCh)
+	assert.Equal(t, "second", value)
+	close(stopCh)
+	assert.Equal(t, int32(1), store.watches.Load())
+
+	// Once it's over, the value kept is served while it's read again
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("third")))
+	stopCh = make(chan struct{})
+	watchCh, err = watcher.Watch("services/api", stopCh)
+	assert.NoError(t, err)
+	value, _ = read(watchCh)
+	assert.Equal(t, "second", value)
+	value, _ = read(watchCh)
+	assert.Equal(t, "third", value)
+	assert.Equal(t, int32(2), store.watches.Load())
+
+	// The value kept is served stale while the store is down
+	store.down.Store(true)
+	store.Fail("services/api", errUnreachable)
+	value, stale := read(watchCh)
+	assert.Equal(t, "third", value)
+	assert.True(t, stale)
+	otherStopCh = make(chan struct{})
+	otherCh, err = watcher.Watch("services/api", otherStopCh)
+	assert.NoError(t, err)
+	value, stale = read(otherCh)
+	assert.Equal(t, "third", value)
+	assert.True(t, stale)
+	close(otherStopCh)
+
+	// and the config is watched again once it's back
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("fourth")))
+	store.down.Store(false)
+	value, stale = read(watchCh)
+	assert.Equal(t, "fourth", value)
+	assert.False(t, stale)
+	close(stopCh)
+
+	// The configs never read fail as without a cache
+	store.down.Store(true)
+	stopCh = make(chan struct{})
+	defer close(stopCh)
+	watchCh, err = watcher.Watch("services/web", stopCh)
+	assert.NoError(t, err)
+	assert.Equal(t, errUnreachable, receive(t, watchCh).Error)
+}
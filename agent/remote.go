@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"context"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/grpc"
+)
+
+// NewRemoteWatcher watches the configs served by the ProtoconfService of
+// another server or agent over conn, such as by a read-only replica of a
+// server. The clients watching the configs are subscribed with their ID and
+// labels, so the rollouts and the targeting rules of the configs select them
+// as they select the clients of the server followed. A config fails to be
+// watched, with the status of the server followed, once its subscription
+// fails. The connection is closed along with the watcher.
+func NewRemoteWatcher(conn *grpc.ClientConn) libprotoconf.Watcher {
+	return &remoteWatcher{conn: conn, client: protoconfservice.NewProtoconfServiceClient(conn)}
+}
+
+type remoteWatcher struct {
+	conn   *grpc.ClientConn
+	client protoconfservice.ProtoconfServiceClient
+}
+
+func (w *remoteWatcher) Watch(path string, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	return w.WatchClient(path, libprotoconf.Client{}, stopCh)
+}
+
+func (w *remoteWatcher) WatchClient(path string, client libprotoconf.Client, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := w.client.SubscribeForConfig(ctx, &protoconfservice.ConfigSubscriptionRequest{Path: path, ClientId: client.ID, Labels: client.Labels})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	watchCh := make(chan libprotoconf.Result)
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go func() {
+		defer close(watchCh)
+		for {
+			update, err := stream.Recv()
+			if ctx.Err() != nil {
+				return
+			}
+			result := libprotoconf.Result{Value: update.GetValue(), Stale: update.GetStale()}
+			if err != nil {
+				result = libprotoconf.Result{Error: err}
+			}
+			select {
+			case watchCh <- result:
+			case <-stopCh:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return watchCh, nil
+}
+
+// List lists the configs of the server followed starting with prefix
+func (w *remoteWatcher) List(prefix string) ([]string, error) {
+	paths := []string{}
+	request := &protoconfservice.ListConfigsRequest{Prefix: prefix, PageSize: MaxPageSize}
+	for {
+		response, err := w.client.ListConfigs(context.Background(), request)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, response.GetPaths()...)
+		if response.GetNextPageToken() == "" {
+			return paths, nil
+		}
+		request.PageToken = response.GetNextPageToken()
+	}
+}
+
+// Close closes the connection to the server followed
+func (w *remoteWatcher) Close() {
+	w.conn.Close()
+}
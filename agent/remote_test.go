@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"net"
+	"testing"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// perClientWatcher serves every client identified the config named after its
+// ID
+type perClientWatcher struct {
+	libprotoconf.Watcher
+}
+
+func (w perClientWatcher) WatchClient(path string, client libprotoconf.Client, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	if client.ID != "" && client.Labels["per-client"] == "true" {
+		path = "clients/" + client.ID
+	}
+	return w.Watch(path, stopCh)
+}
+
+func (w perClientWatcher) List(prefix string) ([]string, error) {
+	return w.Watcher.(libprotoconf.Lister).List(prefix)
+}
+
+func TestRemoteWatcher(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("first")))
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("web")))
+	assert.NoError(t, store.SetConfig("clients/api-1", wrapperspb.String("api-1")))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rpcServer := grpc.NewServer()
+	protoconfservice.RegisterProtoconfServiceServer(rpcServer, NewServer(perClientWatcher{libprotoconf.NewStoreWatcher(store, "")}, command.DefaultSubscriberQueue))
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	watcher := NewRemoteWatcher(conn)
+	defer watcher.Close()
+	read := func(watchCh <-chan libprotoconf.Result) string {
+		result := receive(t, watchCh)
+		assert.NoError(t, result.Error)
+		value := &wrapperspb.StringValue{}
+		assert.NoError(t, result.Value.UnmarshalTo(value))
+		return value.Value
+	}
+
+	// The configs of the server followed are watched
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watchCh, err := watcher.Watch("services/api", stopCh)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", read(watchCh))
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("second")))
+	assert.Equal(t, "second", read(watchCh))
+
+	// as the clients see them
+	clientCh, err := watcher.(libprotoconf.ClientWatcher).WatchClient("services/api", libprotoconf.Client{ID: "api-1", Labels: map[string]string{"per-client": "true"}}, stopCh)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-1", read(clientCh))
+
+	// The errors of the server followed fail the watches
+	missingCh, err := watcher.Watch("services/missing", stopCh)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, receive(t, missingCh).Error, "config not found")
+
+	paths, err := watcher.(libprotoconf.Lister).List("services/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/api", "services/web"}, paths)
+}
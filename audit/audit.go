@@ -0,0 +1,259 @@
+// Package audit records the changes of the configs, who changed which config
+// when and how, to an append-only log
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/utils"
+)
+
+// The actions changing configs
+const (
+	ActionInsert = "insert"
+	ActionDelete = "delete"
+	ActionMutate = "mutate"
+	ActionPatch  = "patch"
+	// ActionPromote is the promotion of the new value of a rollout
+	ActionPromote = "promote"
+	// ActionRollback is the rollback of a config to a version of its history
+	ActionRollback = "rollback"
+	// ActionExpire is the revert of a config written for a while to the value
+	// it replaced
+	ActionExpire = "expire"
+)
+
+// Entry is a change of a config
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Identity is who changed the config, the SPIFFE ID or the address of
+	// the client of the server, the user running protoconf insert
+	Identity string `json:"identity"`
+	Action   string `json:"action"`
+	Path     string `json:"path"`
+	// OldVersion and NewVersion are the versions of the config before and
+	// after the change, empty when the config didn't exist or when the store
+	// has no versions
+	OldVersion string `json:"old_version,omitempty"`
+	NewVersion string `json:"new_version,omitempty"`
+	// Changes are the fields changed, as utils.FieldDiff formats them
+	Changes []string `json:"changes,omitempty"`
+}
+
+// Changes formats the fields changed of a config
+func Changes(diffs []utils.FieldDiff) []string {
+	var changes []string
+	for _, diff := range diffs {
+		changes = append(changes, diff.String())
+	}
+	return changes
+}
+
+// Log is an append-only log of the changes of the configs, used concurrently
+type Log interface {
+	// Append records an entry
+	Append(entry *Entry) error
+	// Entries lists the entries of the config of path, of every config when
+	// path is empty, the oldest first
+	Entries(path string) ([]*Entry, error)
+}
+
+// StorePrefix starts the -audit-log of the logs kept in a key-value store
+const StorePrefix = "store:"
+
+// AddFlag adds the -audit-log flag to an existing flagset
+func AddFlag(fs *flag.FlagSet, spec *string) {
+	fs.StringVar(spec, "audit-log", "", "Audit log of the changes of the configs, a file the changes are appended to as JSON lines, or store:prefix to keep them in the key-value store under prefix")
+}
+
+// Open opens the audit log of an -audit-log flag, opening the key-value store
+// with openStore for store:prefix logs
+func Open(spec string, openStore func() (libprotoconf.Store, error)) (Log, error) {
+	if !strings.HasPrefix(spec, StorePrefix) {
+		return NewFileLog(spec), nil
+	}
+	prefix := strings.TrimPrefix(spec, StorePrefix)
+	if prefix == "" {
+		return nil, errors.New("the audit log needs a key prefix of its own, e.g. store:audit/")
+	}
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreLog(store, prefix), nil
+}
+
+// LocalIdentity is the identity of the user running a command, user@host
+func LocalIdentity() string {
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+	return name + "@" + host
+}
+
+type fileLog struct {
+	filename string
+	lock     sync.Mutex
+}
+
+// NewFileLog appends the entries to a file, one JSON object per line
+func NewFileLog(filename string) Log {
+	return &fileLog{filename: filename}
+}
+
+func (l *fileLog) Append(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	file, err := os.OpenFile(l.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening audit log, file=%s err=%s", l.filename, err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing audit log, file=%s err=%s", l.filename, err)
+	}
+	return file.Close()
+}
+
+func (l *fileLog) Entries(path string) ([]*Entry, error) {
+	file, err := os.Open(l.filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log, file=%s err=%s", l.filename, err)
+	}
+	defer file.Close()
+
+	var entries []*Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("error reading audit log, file=%s line=%d err=%s", l.filename, line, err)
+		}
+		if path == "" || entry.Path == path {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log, file=%s err=%s", l.filename, err)
+	}
+	return entries, nil
+}
+
+type storeLog struct {
+	store  libprotoconf.Store
+	prefix string
+}
+
+// NewStoreLog keeps the entries in a key-value store, an entry per key under
+// prefix, prefix + path + "@" + the time of the change. Entries are written
+// only if their keys don't exist yet in the stores with versions.
+func NewStoreLog(store libprotoconf.Store, prefix string) Log {
+	return &storeLog{store: store, prefix: prefix}
+}
+
+func (l *storeLog) Append(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		key := fmt.Sprintf("%s%s@%020d", l.prefix, entry.Path, entry.Time.UnixNano()+int64(attempt))
+		versioned, ok := l.store.(libprotoconf.VersionedStore)
+		if !ok {
+			return l.store.Set(key, data)
+		}
+		_, err := versioned.SetIfVersion(key, data, "")
+		if err == libprotoconf.ErrVersionMismatch && attempt < 10 {
+			// Another change of the config at the same nanosecond
+			continue
+		}
+		return err
+	}
+}
+
+func (l *storeLog) Entries(path string) ([]*Entry, error) {
+	prefix := l.prefix
+	if path != "" {
+		prefix += path + "@"
+	}
+	keys, err := l.store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, key := range keys {
+		data, err := l.store.Get(key)
+		if err == libprotoconf.ErrConfigNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := &Entry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return nil, fmt.Errorf("error reading audit log, key=%s err=%s", key, err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+type teeLog []Log
+
+// Tee appends the entries to every log of logs, such as an audit log along
+// with the webhooks posted the changes, and lists the entries of the first.
+// The nil logs are skipped, and Tee returns nil when every log is nil.
+func Tee(logs ...Log) Log {
+	var tee teeLog
+	for _, log := range logs {
+		if log != nil {
+			tee = append(tee, log)
+		}
+	}
+	switch len(tee) {
+	case 0:
+		return nil
+	case 1:
+		return tee[0]
+	}
+	return tee
+}
+
+func (t teeLog) Append(entry *Entry) error {
+	var errs []error
+	for _, log := range t {
+		if err := log.Append(entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeLog) Entries(path string) ([]*Entry, error) {
+	return t[0].Entries(path)
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+)
+
+func testLog(t *testing.T, log Log) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []*Entry{
+		{Time: start, Identity: "alice@host", Action: ActionInsert, Path: "services/web", NewVersion: "1"},
+		{Time: start.Add(time.Minute), Identity: "spiffe://example.org/ci", Action: ActionPatch, Path: "services/web/canary", OldVersion: "1", NewVersion: "2"},
+		{Time: start.Add(2 * time.Minute), Identity: "alice@host", Action: ActionInsert, Path: "services/web", OldVersion: "1", NewVersion: "3", Changes: []string{"~ timeout: 10 -> 20"}},
+		// Changes at the same time aren't lost
+		{Time: start.Add(2 * time.Minute), Identity: "bob@host", Action: ActionDelete, Path: "services/web", OldVersion: "3"},
+	}
+	for _, entry := range entries {
+		assert.NoError(t, log.Append(entry))
+	}
+
+	all, err := log.Entries("")
+	assert.NoError(t, err)
+	assert.Len(t, all, 4)
+	for i, entry := range all {
+		assert.True(t, entry.Time.Equal(entries[i].Time))
+		assert.Equal(t, entries[i].Path, entry.Path)
+	}
+	web, err := log.Entries("services/web")
+	assert.NoError(t, err)
+	assert.Len(t, web, 3)
+	assert.Equal(t, []string{"~ timeout: 10 -> 20"}, web[1].Changes)
+	assert.Equal(t, "bob@host", web[2].Identity)
+	missing, err := log.Entries("services/api")
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestFileLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.jsonl")
+
+	log := NewFileLog(filename)
+	entries, err := log.Entries("")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	testLog(t, log)
+}
+
+func TestStoreLog(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	testLog(t, NewStoreLog(store, "audit/"))
+	keys, err := store.List("")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 4)
+
+	_, err = Open("store:", func() (libprotoconf.Store, error) { return store, nil })
+	assert.Error(t, err)
+}
+
+func TestTee(t *testing.T) {
+	assert.Nil(t, Tee(nil, nil))
+	first, second := NewStoreLog(libprotoconf.NewMemoryStore(), "audit/"), NewStoreLog(libprotoconf.NewMemoryStore(), "audit/")
+	assert.Equal(t, first, Tee(nil, first))
+
+	log := Tee(first, nil, second)
+	assert.NoError(t, log.Append(&Entry{Time: time.Now(), Action: ActionInsert, Path: "services/web"}))
+	for _, l := range []Log{log, first, second} {
+		entries, err := l.Entries("")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	}
+}
+
+func TestPrintEntry(t *testing.T) {
+	var b bytes.Buffer
+	entry := &Entry{
+		Time:       time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Identity:   "alice@host",
+		Action:     ActionInsert,
+		Path:       "services/web",
+		NewVersion: "3",
+		Changes:    []string{"~ timeout: 10 -> 20", `+ owner: "web"`},
+	}
+	assert.NoError(t, printEntry(&b, entry, false))
+	assert.Equal(t, `2026-01-02T03:04:05Z insert services/web by alice@host, version none -> 3
+  ~ timeout: 10 -> 20
+  + owner: "web"
+`, b.String())
+
+	b.Reset()
+	assert.NoError(t, printEntry(&b, &Entry{Time: entry.Time, Identity: "bob", Action: ActionDelete, Path: "services/web"}, true))
+	assert.Equal(t, `{"time":"2026-01-02T03:04:05Z","identity":"bob","action":"delete","path":"services/web"}`+"\n", b.String())
+}
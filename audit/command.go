@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+type cliCommand struct{}
+
+type cliConfig struct {
+	auditLog string
+	identity string
+	since    time.Duration
+	json     bool
+}
+
+func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... [config_path]")
+		fmt.Fprintln(flags.Output(), "Lists the changes of a config recorded in the audit log, of every config without a path.")
+		flags.PrintDefaults()
+	}
+
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+
+	config := &cliConfig{}
+	AddFlag(flags, &config.auditLog)
+	flags.StringVar(&config.identity, "identity", "", "List only the changes of this identity")
+	flags.DurationVar(&config.since, "since", 0, "List only the changes of this last duration, e.g. 24h")
+	flags.BoolVar(&config.json, "json", false, "Print the entries as JSON lines")
+
+	return flags, config, kVConfig
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config, kVConfig := newFlagSet()
+	flags.Parse(args)
+
+	if config.auditLog == "" || flags.NArg() > 1 {
+		flags.Usage()
+		return 1
+	}
+	path := ""
+	if flags.NArg() == 1 {
+		path = filepath.ToSlash(strings.TrimSpace(flags.Arg(0)))
+	}
+
+	var store libprotoconf.Store
+	auditLog, err := Open(config.auditLog, func() (libprotoconf.Store, error) {
+		var err error
+		store, err = libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+		return store, err
+	})
+	if err != nil {
+		log.Printf("Error opening audit log, err=%s", err)
+		return 1
+	}
+	if store != nil {
+		defer store.Close()
+	}
+
+	entries, err := auditLog.Entries(path)
+	if err != nil {
+		log.Printf("Error reading audit log, err=%s", err)
+		return 1
+	}
+	for _, entry := range entries {
+		if config.identity != "" && entry.Identity != config.identity {
+			continue
+		}
+		if config.since > 0 && time.Since(entry.Time) > config.since {
+			continue
+		}
+		if err := printEntry(os.Stdout, entry, config.json); err != nil {
+			log.Printf("Error printing audit log, err=%s", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// printEntry prints an entry as a line followed by its changes indented, or
+// as a JSON line
+func printEntry(w io.Writer, entry *Entry, asJSON bool) error {
+	if asJSON {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	line := fmt.Sprintf("%s %s %s by %s", entry.Time.UTC().Format(time.RFC3339), entry.Action, entry.Path, entry.Identity)
+	if entry.OldVersion != "" || entry.NewVersion != "" {
+		line += fmt.Sprintf(", version %s -> %s", printedVersion(entry.OldVersion), printedVersion(entry.NewVersion))
+	}
+	if _, err := fmt.Fprintln(w, line); err != nil {
+		return err
+	}
+	for _, change := range entry.Changes {
+		if _, err := fmt.Fprintf(w, "  %s\n", change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printedVersion(version string) string {
+	if version == "" {
+		return "none"
+	}
+	return version
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _, _ := newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return "Lists the changes of the configs recorded in the audit log"
+}
+
+// Command is a cli.CommandFactory
+func Command() (cli.Command, error) {
+	return &cliCommand{}, nil
+}
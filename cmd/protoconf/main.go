@@ -3,14 +3,25 @@ package main
 import (
 	"github.com/mitchellh/cli"
 	"github.com/protoconf/protoconf/agent"
+	"github.com/protoconf/protoconf/audit"
 	"github.com/protoconf/protoconf/command"
 	"github.com/protoconf/protoconf/compiler"
 	"github.com/protoconf/protoconf/exec"
+	"github.com/protoconf/protoconf/expiry"
+	"github.com/protoconf/protoconf/gengo"
 	golangimporter "github.com/protoconf/protoconf/importers/golang_importer"
 	terraformimporter "github.com/protoconf/protoconf/importers/terraform_importer"
 	"github.com/protoconf/protoconf/inserter"
+	"github.com/protoconf/protoconf/kubesync"
 	"github.com/protoconf/protoconf/mutate"
+	"github.com/protoconf/protoconf/operator"
+	"github.com/protoconf/protoconf/rollback"
+	"github.com/protoconf/protoconf/rollout"
 	"github.com/protoconf/protoconf/server"
+	"github.com/protoconf/protoconf/sidecar"
+	"github.com/protoconf/protoconf/snapshot"
+	"github.com/protoconf/protoconf/stubs"
+	"github.com/protoconf/protoconf/targeting"
 )
 
 func main() {
@@ -19,11 +30,30 @@ func main() {
 			"agent":            agent.Command,
 			"compile":          compiler.Command,
 			"exec":             exec.Command,
+			"expiry cancel":    expiry.CancelCommand,
+			"expiry status":    expiry.StatusCommand,
+			"gen-go":           gengo.Command,
+			"history":          audit.Command,
 			"import golang":    golangimporter.Command,
 			"import terraform": terraformimporter.Command,
 			"insert":           inserter.Command,
+			"kube-sync":        kubesync.Command,
 			"mutate":           mutate.Command,
+			"operator":         operator.Command,
+			"restore":          snapshot.RestoreCommand,
+			"rollback":         rollback.Command,
+			"rollout abort":    rollout.AbortCommand,
+			"rollout pause":    rollout.PauseCommand,
+			"rollout promote":  rollout.PromoteCommand,
+			"rollout resume":   rollout.ResumeCommand,
+			"rollout status":   rollout.StatusCommand,
 			"serve":            server.Command,
+			"sidecar":          sidecar.Command,
+			"snapshot":         snapshot.Command,
+			"stubs":            stubs.Command,
+			"target list":      targeting.ListCommand,
+			"target remove":    targeting.RemoveCommand,
+			"test":             compiler.TestCommand,
 		},
 	)
 }
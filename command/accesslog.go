@@ -0,0 +1,192 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// AddAccessLogFlag adds to an existing flagset the command line flag writing
+// the access log of a server
+func AddAccessLogFlag(fs *flag.FlagSet, filename *string) {
+	fs.StringVar(filename, "access-log", "", "Append a JSON line per gRPC call to this file, - for the standard output: the identity of the client, the method, the path of the config, the version served, the status, the latency and the bytes sent and received")
+}
+
+// AccessEntry is a line of the access log, a call of a client
+type AccessEntry struct {
+	Time time.Time `json:"time"`
+	// Identity is the SPIFFE ID of the client with mutual TLS, or its host,
+	// and ClientID the client_id of its request
+	Identity string `json:"identity"`
+	ClientID string `json:"client_id,omitempty"`
+	Method   string `json:"method"`
+	// Path is the path of the config of the request, or the prefix or the
+	// pattern of the configs
+	Path string `json:"path,omitempty"`
+	// Version is the version of the config served last
+	Version string `json:"version,omitempty"`
+	Code    string `json:"code"`
+	Error   string `json:"error,omitempty"`
+	// LatencyMS is how long the call took, the subscriptions last until the
+	// client goes away
+	LatencyMS     float64 `json:"latency_ms"`
+	BytesReceived int     `json:"bytes_received"`
+	BytesSent     int     `json:"bytes_sent"`
+	// Messages is how many messages were sent on a stream
+	Messages int `json:"messages,omitempty"`
+}
+
+// AccessLog writes a JSON line per call of the clients of a server, once the
+// call ends
+type AccessLog struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// OpenAccessLog appends the access log to filename, or writes it to the
+// standard output when it's -
+func OpenAccessLog(filename string) (*AccessLog, error) {
+	if filename == "-" {
+		return NewAccessLog(os.Stdout), nil
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewAccessLog(f), nil
+}
+
+// NewAccessLog writes the access log to w
+func NewAccessLog(w io.Writer) *AccessLog {
+	return &AccessLog{w: w}
+}
+
+// Close closes the file of the access log
+func (l *AccessLog) Close() error {
+	if closer, ok := l.w.(io.Closer); ok && l.w != os.Stdout {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (l *AccessLog) write(entry *AccessEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding access log entry, err=%s", err)
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		log.Printf("Error writing access log, err=%s", err)
+	}
+}
+
+// newEntry starts the entry of a call
+func newEntry(ctx context.Context, method string) *AccessEntry {
+	return &AccessEntry{Time: time.Now(), Identity: PeerIdentity(ctx), Method: method}
+}
+
+// received records a request of a call, the path it reads and the client
+// it identifies
+func (e *AccessEntry) received(req interface{}) {
+	message, ok := req.(proto.Message)
+	if !ok {
+		return
+	}
+	e.BytesReceived += proto.Size(message)
+	if e.Path == "" {
+		switch request := req.(type) {
+		case interface{ GetPath() string }:
+			e.Path = request.GetPath()
+		case interface{ GetPrefix() string }:
+			e.Path = request.GetPrefix()
+		case interface{ GetPattern() string }:
+			e.Path = request.GetPattern()
+		}
+	}
+	if request, ok := req.(interface{ GetClientId() string }); ok && e.ClientID == "" {
+		e.ClientID = request.GetClientId()
+	}
+}
+
+// sent records a response of a call, and the version of the config it serves
+func (e *AccessEntry) sent(resp interface{}) {
+	message, ok := resp.(proto.Message)
+	if !ok {
+		return
+	}
+	e.BytesSent += proto.Size(message)
+	if response, ok := resp.(interface{ GetVersion() string }); ok && response.GetVersion() != "" {
+		e.Version = response.GetVersion()
+	}
+}
+
+// end records the status of a call
+func (e *AccessEntry) end(err error) {
+	e.LatencyMS = float64(time.Since(e.Time).Microseconds()) / 1000
+	s := status.Convert(err)
+	e.Code = s.Code().String()
+	if err != nil {
+		e.Error = s.Message()
+	}
+}
+
+// accessLogStream records the messages of a stream to the entry of its call
+type accessLogStream struct {
+	grpc.ServerStream
+	entry *AccessEntry
+}
+
+func (s *accessLogStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.entry.sent(m)
+		s.entry.Messages++
+	}
+	return err
+}
+
+func (s *accessLogStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.entry.received(m)
+	}
+	return err
+}
+
+// ServerOptions are the gRPC server options writing every call to the access
+// log. They are passed before the options authorizing the calls, for the
+// calls denied to be logged.
+func (l *AccessLog) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			entry := newEntry(ctx, info.FullMethod)
+			// The request is recorded before the handlers qualify its path
+			entry.received(req)
+			resp, err := handler(ctx, req)
+			if err == nil {
+				entry.sent(resp)
+			}
+			entry.end(err)
+			l.write(entry)
+			return resp, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			entry := newEntry(stream.Context(), info.FullMethod)
+			err := handler(srv, &accessLogStream{ServerStream: stream, entry: entry})
+			entry.end(err)
+			l.write(entry)
+			return err
+		}),
+	}
+}
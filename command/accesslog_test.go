@@ -0,0 +1,99 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// syncBuffer is a buffer written by the server while read by the test
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) entries(t *testing.T) []AccessEntry {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var entries []AccessEntry
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := AccessEntry{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := &syncBuffer{}
+	accessLog := NewAccessLog(buf)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rpcServer := grpc.NewServer(accessLog.ServerOptions()...)
+	healthpb.RegisterHealthServer(rpcServer, health.NewServer())
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Error(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+	cancel()
+	assert.Eventually(t, func() bool { return len(buf.entries(t)) == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	entries := buf.entries(t)
+	assert.Equal(t, "/grpc.health.v1.Health/Check", entries[0].Method)
+	assert.Equal(t, "127.0.0.1", entries[0].Identity)
+	assert.Equal(t, "OK", entries[0].Code)
+	assert.Positive(t, entries[0].BytesSent)
+	assert.Equal(t, "NotFound", entries[1].Code)
+	assert.NotEmpty(t, entries[1].Error)
+	assert.Equal(t, "/grpc.health.v1.Health/Watch", entries[2].Method)
+	assert.Equal(t, "Canceled", entries[2].Code)
+	assert.Equal(t, 1, entries[2].Messages)
+}
+
+func TestAccessEntry(t *testing.T) {
+	entry := &AccessEntry{}
+	entry.received(&protoconfservice.ConfigSubscriptionRequest{Path: "services/api", ClientId: "api-1"})
+	entry.sent(&protoconfservice.ConfigUpdate{Version: "v1"})
+	entry.sent(&protoconfservice.ConfigUpdate{Version: "v2"})
+	assert.Equal(t, "services/api", entry.Path)
+	assert.Equal(t, "api-1", entry.ClientID)
+	assert.Equal(t, "v2", entry.Version)
+	assert.Positive(t, entry.BytesReceived)
+	assert.Positive(t, entry.BytesSent)
+
+	entry = &AccessEntry{}
+	entry.received(&protoconfservice.ListConfigsRequest{Prefix: "services/"})
+	assert.Equal(t, "services/", entry.Path)
+}
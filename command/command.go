@@ -4,9 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/mitchellh/cli"
 	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/libprotoconf"
 )
 
 // RunCommand runs a single command
@@ -52,6 +54,12 @@ const (
 	KVStoreConsul    = "consul"
 	KVStoreZookeeper = "zookeeper"
 	KVStoreEtcd      = "etcd"
+	KVStoreRedis     = "redis"
+	KVStoreS3        = "s3"
+	KVStoreGCS       = "gcs"
+	KVStoreSQLite    = "sqlite"
+	KVStorePostgres  = "postgres"
+	KVStoreDynamoDB  = "dynamodb"
 )
 
 // KVStoreConfig holds the key-value store configuration set from the command line
@@ -59,11 +67,24 @@ type KVStoreConfig struct {
 	Address string
 	Store   string
 	Prefix  string
+	// History is how many versions of every config written are kept, 0 to
+	// keep the history the store keeps
+	History int
 }
 
 // AddKVStoreFlags adds to an existing flagset the command lines flags to configure the key-value store connection
 func AddKVStoreFlags(fs *flag.FlagSet, kv *KVStoreConfig) {
-	fs.StringVar(&kv.Address, "store-address", "", "Key-value store address")
-	fs.StringVar(&kv.Store, "store", KVStoreConsul, "Key-value store type (consul/zookeeper/etcd)")
+	fs.StringVar(&kv.Address, "store-address", "", "Key-value store address, the bucket of s3 and gcs, the data source of sqlite and postgres, the table of dynamodb")
+	fs.StringVar(&kv.Store, "store", KVStoreConsul, "Key-value store type ("+strings.Join(libprotoconf.Stores(), "/")+")")
 	fs.StringVar(&kv.Prefix, "prefix", "", "Key-value store key prefix")
+	fs.IntVar(&kv.History, "history", 0, "Keep the last versions of every config written, for protoconf rollback, under .history/ in the stores without a history of their own (default: the history the store keeps, every version in sqlite and postgres, none in the others)")
+}
+
+// WithHistory keeps the -history of the configs written to store, when it's
+// set
+func (kv *KVStoreConfig) WithHistory(store libprotoconf.Store) libprotoconf.Store {
+	if kv.History <= 0 {
+		return store
+	}
+	return libprotoconf.WithHistory(store, kv.History)
 }
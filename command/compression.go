@@ -0,0 +1,200 @@
+package command
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	// Registers the gzip compressor of the gRPC calls
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// The compressions of the gRPC calls and of the HTTP responses, by their
+// names in grpc-encoding and Content-Encoding
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// maxZstdDecoded is the most memory a zstd message of a gRPC call decodes
+// to, so a small message can't exhaust the memory of the server
+const maxZstdDecoded = 64 << 20
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxZstdDecoded))
+)
+
+func init() {
+	encoding.RegisterCompressor(zstdCompressor{})
+}
+
+// zstdCompressor compresses the messages of the gRPC calls with zstd. The
+// messages are compressed and decompressed whole, sharing an encoder and a
+// decoder across the calls.
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string {
+	return CompressionZstd
+}
+
+func (zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &zstdMessageWriter{w: w}, nil
+}
+
+func (zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := zstdDecoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(decoded), nil
+}
+
+// zstdMessageWriter compresses a message to w once it's written whole
+type zstdMessageWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (z *zstdMessageWriter) Write(p []byte) (int, error) {
+	return z.buf.Write(p)
+}
+
+func (z *zstdMessageWriter) Close() error {
+	_, err := z.w.Write(zstdEncoder.EncodeAll(z.buf.Bytes(), nil))
+	return err
+}
+
+// AddCompressionFlag adds to an existing flagset the command line flag
+// compressing the calls of a client
+func AddCompressionFlag(fs *flag.FlagSet, compression *string) {
+	fs.StringVar(compression, "compression", "", "Compress the calls to the agent and the updates it sends back: gzip or zstd, uncompressed when empty")
+}
+
+// CompressionDialOptions compress every call of a connection with
+// compression, which the servers compress their responses with too. There
+// are none when compression is empty.
+func CompressionDialOptions(compression string) ([]grpc.DialOption, error) {
+	switch compression {
+	case "":
+		return nil, nil
+	case CompressionGzip, CompressionZstd:
+		return []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.UseCompressor(compression))}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q, expected gzip or zstd", compression)
+	}
+}
+
+// acceptedCompression is the compression of the response to a request, by
+// its Accept-Encoding: zstd over gzip, none when it accepts neither
+func acceptedCompression(r *http.Request) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case accepted[CompressionZstd]:
+		return CompressionZstd
+	case accepted[CompressionGzip]:
+		return CompressionGzip
+	}
+	return ""
+}
+
+// NewCompressionHandler compresses the responses of handler with zstd or
+// gzip, as the Accept-Encoding of their requests accepts them. The writes
+// flushed by handler, such as the server-sent events, are flushed
+// compressed.
+func NewCompressionHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		compression := acceptedCompression(r)
+		if compression == "" || r.Method == http.MethodHead {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressedResponseWriter{ResponseWriter: w, compression: compression}
+		defer cw.close()
+		handler.ServeHTTP(cw, r)
+	})
+}
+
+// compressedResponseWriter compresses the body of a response, unless its
+// status has no body or the handler encoded it already
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	compression string
+	wroteHeader bool
+	encoder     interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (w *compressedResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := w.Header()
+	if code != http.StatusNoContent && code != http.StatusNotModified && code >= http.StatusOK && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", w.compression)
+		header.Del("Content-Length")
+		if w.compression == CompressionZstd {
+			// The encoder of a response compresses it as it's written, with
+			// no goroutines of its own
+			w.encoder, _ = zstd.NewWriter(w.ResponseWriter, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+		} else {
+			w.encoder = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressedResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.encoder.Write(p)
+}
+
+func (w *compressedResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the writer of the response
+func (w *compressedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close ends the compressed body of the response
+func (w *compressedResponseWriter) close() {
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
@@ -0,0 +1,108 @@
+package command
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestCompressionDialOptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(rpcServer, health.NewServer())
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+
+	for _, compression := range []string{"", CompressionGzip, CompressionZstd} {
+		opts, err := CompressionDialOptions(compression)
+		assert.NoError(t, err)
+		conn, err := grpc.Dial(listener.Addr().String(), append(opts, grpc.WithInsecure())...)
+		assert.NoError(t, err)
+		response, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.NoError(t, err, compression)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, response.GetStatus())
+		conn.Close()
+	}
+	_, err = CompressionDialOptions("brotli")
+	assert.Error(t, err)
+
+	// The zstd messages are decompressed as they were compressed
+	var b bytes.Buffer
+	w, err := zstdCompressor{}.Compress(&b)
+	assert.NoError(t, err)
+	w.Write(bytes.Repeat([]byte("protoconf"), 100))
+	assert.NoError(t, w.Close())
+	assert.Less(t, b.Len(), 100)
+	r, err := zstdCompressor{}.Decompress(&b)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("protoconf"), 100), data)
+}
+
+func TestCompressionHandler(t *testing.T) {
+	body := strings.Repeat(`{"value": "protoconf"}`, 100)
+	server := httptest.NewServer(NewCompressionHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/unchanged" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body[:len(body)/2])
+		w.(http.Flusher).Flush()
+		io.WriteString(w, body[len(body)/2:])
+	})))
+	defer server.Close()
+	get := func(path string, acceptEncoding string) (*http.Response, []byte) {
+		request, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		assert.NoError(t, err)
+		// Set by hand, the transport doesn't decompress the responses
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+		response, err := http.DefaultClient.Do(request)
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		return response, data
+	}
+
+	response, data := get("/", "gzip, deflate")
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", response.Header.Get("Vary"))
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	response, data = get("/", "gzip;q=0.5, zstd")
+	assert.Equal(t, "zstd", response.Header.Get("Content-Encoding"))
+	decoder, err := zstd.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	defer decoder.Close()
+	decoded, err = io.ReadAll(decoder)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	response, data = get("/", "zstd;q=0, identity")
+	assert.Empty(t, response.Header.Get("Content-Encoding"))
+	assert.Equal(t, body, string(data))
+
+	response, data = get("/unchanged", "gzip")
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+	assert.Empty(t, response.Header.Get("Content-Encoding"))
+	assert.Empty(t, data)
+}
@@ -0,0 +1,203 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultSubscriberQueue is how many updates are queued to a subscriber by
+// default before it's disconnected
+const DefaultSubscriberQueue = 100
+
+// idleLimiterTTL is how long the limiter of a client is kept once the client
+// stops calling
+const idleLimiterTTL = 10 * time.Minute
+
+// LimitsConfig holds the limits of the calls of the clients of a server set
+// from the command line
+type LimitsConfig struct {
+	// ClientRate is how many calls per second each client can make, by its
+	// identity, unlimited when 0
+	ClientRate  float64
+	ClientBurst int
+	// GlobalRate is how many calls per second the clients can make
+	// together, unlimited when 0
+	GlobalRate  float64
+	GlobalBurst int
+	// SubscriberQueue is how many updates are queued to a subscriber too
+	// slow to receive them before it's disconnected
+	SubscriberQueue int
+}
+
+// AddLimitsFlags adds to an existing flagset the command line flags limiting
+// the reads and subscriptions of the clients
+func AddLimitsFlags(fs *flag.FlagSet, c *LimitsConfig) {
+	fs.Float64Var(&c.ClientRate, "client-rate", 0, "Reads and subscriptions per second allowed to each client, by its SPIFFE ID with mutual TLS or its host, unlimited when 0")
+	fs.IntVar(&c.ClientBurst, "client-burst", 0, "Reads and subscriptions a client can make at once (default: -client-rate, at least 1)")
+	fs.Float64Var(&c.GlobalRate, "global-rate", 0, "Reads and subscriptions per second allowed to all the clients together, unlimited when 0")
+	fs.IntVar(&c.GlobalBurst, "global-burst", 0, "Reads and subscriptions the clients can make at once together (default: -global-rate, at least 1)")
+	fs.IntVar(&c.SubscriberQueue, "subscriber-queue", DefaultSubscriberQueue, "Updates queued to a subscriber too slow to receive them before it's disconnected")
+}
+
+// burst is the burst of a rate, the rate itself by default
+func burst(limit float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	if limit < 1 {
+		return 1
+	}
+	return int(limit)
+}
+
+// Limiter returns the limiter of the calls of the clients
+func (c *LimitsConfig) Limiter() (*Limiter, error) {
+	if c.ClientRate < 0 || c.GlobalRate < 0 || c.ClientBurst < 0 || c.GlobalBurst < 0 {
+		return nil, errors.New("the rates and bursts of the clients can't be negative")
+	}
+	if c.SubscriberQueue < 1 {
+		return nil, errors.New("-subscriber-queue must be at least 1")
+	}
+	l := &Limiter{config: *c, clients: make(map[string]*clientLimiter)}
+	if c.GlobalRate > 0 {
+		l.global = rate.NewLimiter(rate.Limit(c.GlobalRate), burst(c.GlobalRate, c.GlobalBurst))
+	}
+	return l, nil
+}
+
+// Limiter limits the rate of the calls of the clients of a server, of each
+// client and of all the clients together
+type Limiter struct {
+	config LimitsConfig
+	global *rate.Limiter
+
+	lock    sync.Mutex
+	clients map[string]*clientLimiter
+	swept   time.Time
+}
+
+type clientLimiter struct {
+	*rate.Limiter
+	used time.Time
+}
+
+// Allow tells whether a client can make a call now, counting the call
+func (l *Limiter) Allow(client string) bool {
+	if l.config.ClientRate > 0 && !l.client(client).Allow() {
+		return false
+	}
+	return l.global == nil || l.global.Allow()
+}
+
+// client returns the limiter of a client, dropping the limiters of the
+// clients which stopped calling
+func (l *Limiter) client(client string) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) > idleLimiterTTL {
+		for id, limiter := range l.clients {
+			if now.Sub(limiter.used) > idleLimiterTTL {
+				delete(l.clients, id)
+			}
+		}
+		l.swept = now
+	}
+	limiter, ok := l.clients[client]
+	if !ok {
+		limiter = &clientLimiter{Limiter: rate.NewLimiter(rate.Limit(l.config.ClientRate), burst(l.config.ClientRate, l.config.ClientBurst))}
+		l.clients[client] = limiter
+	}
+	limiter.used = now
+	return limiter.Limiter
+}
+
+// SubscriberQueue is how many updates are queued to a subscriber before it's
+// disconnected
+func (l *Limiter) SubscriberQueue() int {
+	return l.config.SubscriberQueue
+}
+
+// PeerIdentity identifies the client of a call by its SPIFFE ID with mutual
+// TLS, and by its host otherwise
+func PeerIdentity(ctx context.Context) string {
+	if id, err := PeerSPIFFEID(ctx); err == nil {
+		return id
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func (l *Limiter) limited(ctx context.Context, method string, services []string) error {
+	for _, service := range services {
+		if !strings.HasPrefix(method, service) {
+			continue
+		}
+		if client := PeerIdentity(ctx); !l.Allow(client) {
+			log.Printf("Rate limiting client=%s method=%s", client, method)
+			return status.Errorf(codes.ResourceExhausted, "too many calls, slow down, client=%s", client)
+		}
+	}
+	return nil
+}
+
+// ServerOptions are the gRPC server options limiting the calls of the
+// methods of services, given as /package.Service/
+func (l *Limiter) ServerOptions(services ...string) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := l.limited(ctx, info.FullMethod, services); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := l.limited(stream.Context(), info.FullMethod, services); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	}
+}
+
+// HTTPHandler limits the requests of the clients of handler, answering 429
+// Too Many Requests over the limits
+func (l *Limiter) HTTPHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := ""
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			client, _ = SPIFFEID(r.TLS.VerifiedChains[0][0])
+		}
+		if client == "" {
+			client = r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				client = host
+			}
+		}
+		if !l.Allow(client) {
+			log.Printf("Rate limiting client=%s path=%s", client, r.URL.Path)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests, slow down", http.StatusTooManyRequests)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
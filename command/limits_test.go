@@ -0,0 +1,46 @@
+package command
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter, err := (&LimitsConfig{ClientRate: 0.001, ClientBurst: 2, SubscriberQueue: 1}).Limiter()
+	assert.NoError(t, err)
+	assert.True(t, limiter.Allow("a"))
+	assert.True(t, limiter.Allow("a"))
+	assert.False(t, limiter.Allow("a"))
+	// Every client has its own limit
+	assert.True(t, limiter.Allow("b"))
+
+	limiter, err = (&LimitsConfig{ClientRate: 100, GlobalRate: 0.001, GlobalBurst: 1, SubscriberQueue: 1}).Limiter()
+	assert.NoError(t, err)
+	assert.True(t, limiter.Allow("a"))
+	assert.False(t, limiter.Allow("b"))
+
+	_, err = (&LimitsConfig{ClientRate: -1, SubscriberQueue: 1}).Limiter()
+	assert.Error(t, err)
+	_, err = (&LimitsConfig{}).Limiter()
+	assert.Error(t, err)
+}
+
+func TestLimiterHTTPHandler(t *testing.T) {
+	limiter, err := (&LimitsConfig{ClientRate: 0.001, ClientBurst: 1, SubscriberQueue: 1}).Limiter()
+	assert.NoError(t, err)
+	server := httptest.NewServer(limiter.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response, err = http.Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	assert.Equal(t, "1", response.Header.Get("Retry-After"))
+}
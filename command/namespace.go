@@ -0,0 +1,28 @@
+package command
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// NamespaceMetadata is the gRPC metadata the clients of a server with
+// tenants choose their namespace by
+const NamespaceMetadata = "protoconf-namespace"
+
+// NamespaceDialOptions send namespace as the namespace of every call of a
+// connection, none when it's empty
+func NamespaceDialOptions(namespace string) []grpc.DialOption {
+	if namespace == "" {
+		return nil
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(metadata.AppendToOutgoingContext(ctx, NamespaceMetadata, namespace), method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(metadata.AppendToOutgoingContext(ctx, NamespaceMetadata, namespace), desc, cc, method, opts...)
+		}),
+	}
+}
@@ -0,0 +1,278 @@
+package command
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// TLSConfig holds the mutual TLS configuration set from the command line
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	// AllowedIDs are the SPIFFE IDs of the clients a server accepts, IDs
+	// ending with /* allow every ID under them. Every client certificate
+	// signed by the CA is accepted when empty.
+	AllowedIDs idsFlag
+	// ServerID is the SPIFFE ID a client expects of the server, verified
+	// instead of the host name of the server when set
+	ServerID string
+}
+
+type idsFlag []string
+
+func (i *idsFlag) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *idsFlag) Set(value string) error {
+	if _, err := parseSPIFFEID(strings.TrimSuffix(value, "/*")); err != nil {
+		return err
+	}
+	*i = append(*i, value)
+	return nil
+}
+
+// AddTLSFlags adds to an existing flagset the command line flags to serve with mutual TLS
+func AddTLSFlags(fs *flag.FlagSet, c *TLSConfig) {
+	addTLSFileFlags(fs, c, "the clients")
+	fs.Var(&c.AllowedIDs, "tls-allowed-id", "SPIFFE ID of the clients allowed to connect, e.g. spiffe://example.org/ns/prod/sa/web or spiffe://example.org/ns/prod/*, can be repeated (default: every client with a certificate of -tls-ca)")
+}
+
+// AddTLSClientFlags adds to an existing flagset the command line flags to connect with mutual TLS
+func AddTLSClientFlags(fs *flag.FlagSet, c *TLSConfig) {
+	addTLSFileFlags(fs, c, "the server")
+	fs.StringVar(&c.ServerID, "tls-server-id", "", "SPIFFE ID of the server, verified instead of its host name")
+}
+
+func addTLSFileFlags(fs *flag.FlagSet, c *TLSConfig, peers string) {
+	fs.StringVar(&c.CertFile, "tls-cert", "", "Certificate file (PEM), enables mutual TLS, reloaded when it changes")
+	fs.StringVar(&c.KeyFile, "tls-key", "", "Private key file (PEM) of -tls-cert")
+	fs.StringVar(&c.CAFile, "tls-ca", "", "CA bundle file (PEM) verifying the certificates of "+peers+", the SPIFFE trust bundle")
+}
+
+// Enabled tells whether mutual TLS was configured
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != ""
+}
+
+func (c *TLSConfig) load() (*keyPair, *x509.CertPool, error) {
+	if c.CertFile == "" || c.KeyFile == "" || c.CAFile == "" {
+		return nil, nil, errors.New("mutual TLS requires -tls-cert, -tls-key and -tls-ca")
+	}
+	pair := &keyPair{certFile: c.CertFile, keyFile: c.KeyFile}
+	if _, err := pair.get(); err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CA file=%s err=%s", c.CAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, nil, fmt.Errorf("no certificates found in CA file=%s", c.CAFile)
+	}
+	return pair, pool, nil
+}
+
+// ServerConfig is the TLS configuration of servers requiring client
+// certificates signed by the CA, with one of the allowed SPIFFE IDs
+func (c *TLSConfig) ServerConfig() (*tls.Config, error) {
+	pair, pool, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return pair.get() },
+	}
+	if len(c.AllowedIDs) > 0 {
+		config.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+			id, err := SPIFFEID(chains[0][0])
+			if err != nil {
+				return err
+			}
+			if !c.allowed(id) {
+				return fmt.Errorf("the SPIFFE ID %s isn't allowed to connect", id)
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+func (c *TLSConfig) allowed(id string) bool {
+	for _, allowed := range c.AllowedIDs {
+		if MatchSPIFFEID(allowed, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchSPIFFEID tells whether a SPIFFE ID matches a pattern, an ID, an ID
+// ending with /* matching every ID under it, or * matching every ID
+func MatchSPIFFEID(pattern string, id string) bool {
+	return pattern == "*" || id == pattern || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(id, strings.TrimSuffix(pattern, "*")))
+}
+
+// ClientConfig is the TLS configuration of clients presenting their
+// certificate, verifying the server by ServerID when set and by its host
+// name otherwise
+func (c *TLSConfig) ClientConfig() (*tls.Config, error) {
+	pair, pool, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		RootCAs:              pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return pair.get() },
+	}
+	if c.ServerID != "" {
+		// SPIFFE certificates identify workloads rather than hosts, the
+		// chain is verified below without the host name
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				if certs[i], err = x509.ParseCertificate(raw); err != nil {
+					return err
+				}
+			}
+			if len(certs) == 0 {
+				return errors.New("the server sent no certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(x509.VerifyOptions{Roots: pool, Intermediates: intermediates})
+			if err != nil {
+				return err
+			}
+			id, err := SPIFFEID(certs[0])
+			if err != nil {
+				return err
+			}
+			if id != c.ServerID {
+				return fmt.Errorf("the SPIFFE ID of the server is %s, expected %s", id, c.ServerID)
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+// ServerOptions are the gRPC server options serving with mutual TLS when
+// enabled
+func (c *TLSConfig) ServerOptions() ([]grpc.ServerOption, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	config, err := c.ServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}, nil
+}
+
+// DialOption is the gRPC dial option connecting with mutual TLS when
+// enabled, without TLS otherwise
+func (c *TLSConfig) DialOption() (grpc.DialOption, error) {
+	if !c.Enabled() {
+		return grpc.WithInsecure(), nil
+	}
+	config, err := c.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config)), nil
+}
+
+// PeerSPIFFEID is the SPIFFE ID of the client of a gRPC call, from the
+// certificate it connected with over mutual TLS
+func PeerSPIFFEID(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("no peer in the context of the call")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return "", fmt.Errorf("the client %s didn't connect with mutual TLS", p.Addr)
+	}
+	return SPIFFEID(info.State.VerifiedChains[0][0])
+}
+
+// SPIFFEID is the SPIFFE ID of a certificate, its spiffe:// URI SAN
+func SPIFFEID(cert *x509.Certificate) (string, error) {
+	var ids []string
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			ids = append(ids, uri.String())
+		}
+	}
+	if len(ids) != 1 {
+		return "", fmt.Errorf("the certificate of %s must have exactly one SPIFFE ID, found %d", cert.Subject, len(ids))
+	}
+	return parseSPIFFEID(ids[0])
+}
+
+func parseSPIFFEID(id string) (string, error) {
+	trustDomain := strings.TrimPrefix(id, "spiffe://")
+	if trustDomain == id || strings.SplitN(trustDomain, "/", 2)[0] == "" || strings.ContainsAny(id, "?#") {
+		return "", fmt.Errorf("invalid SPIFFE ID %s, expected spiffe://trust-domain/path", id)
+	}
+	return id, nil
+}
+
+// keyPair reloads a certificate and its key when the certificate file
+// changes, as short-lived SPIFFE certificates are rotated
+type keyPair struct {
+	certFile string
+	keyFile  string
+
+	lock     sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+func (p *keyPair) get() (*tls.Certificate, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	info, err := os.Stat(p.certFile)
+	if err != nil {
+		if p.cert != nil {
+			return p.cert, nil
+		}
+		return nil, fmt.Errorf("error reading certificate file=%s err=%s", p.certFile, err)
+	}
+	if p.cert != nil && info.ModTime().Equal(p.modified) {
+		return p.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		if p.cert != nil {
+			// The key may not be written yet, the next handshake tries again
+			return p.cert, nil
+		}
+		return nil, fmt.Errorf("error loading certificate file=%s key=%s err=%s", p.certFile, p.keyFile, err)
+	}
+	p.cert, p.modified = &cert, info.ModTime()
+	return p.cert, nil
+}
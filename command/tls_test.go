@@ -0,0 +1,164 @@
+package command
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	ca := &testCA{t: t, dir: dir, cert: cert, key: key}
+	ca.write("ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(name string, blockType string, der []byte) string {
+	filename := filepath.Join(ca.dir, name)
+	assert.NoError(ca.t, ioutil.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return filename
+}
+
+// issue writes a certificate of the SPIFFE ID id and its key, returning the
+// TLS configuration using them
+func (ca *testCA) issue(name string, id string) *TLSConfig {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(ca.t, err)
+	uri, err := url.Parse(id)
+	assert.NoError(ca.t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{uri},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(ca.t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(ca.t, err)
+	return &TLSConfig{
+		CertFile: ca.write(name+".pem", "CERTIFICATE", der),
+		KeyFile:  ca.write(name+"-key.pem", "EC PRIVATE KEY", keyDER),
+		CAFile:   filepath.Join(ca.dir, "ca.pem"),
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t, dir)
+
+	serverConfig := ca.issue("server", "spiffe://example.org/protoconf/server")
+	serverConfig.AllowedIDs = []string{"spiffe://example.org/ns/prod/*", "spiffe://example.org/ns/dev/sa/web"}
+	options, err := serverConfig.ServerOptions()
+	assert.NoError(t, err)
+	rpcServer := grpc.NewServer(options...)
+	healthpb.RegisterHealthServer(rpcServer, health.NewServer())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+
+	check := func(config *TLSConfig) error {
+		transport, err := config.DialOption()
+		assert.NoError(t, err)
+		conn, err := grpc.Dial(listener.Addr().String(), transport)
+		assert.NoError(t, err)
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	client := ca.issue("prod", "spiffe://example.org/ns/prod/sa/api")
+	client.ServerID = "spiffe://example.org/protoconf/server"
+	assert.NoError(t, check(client))
+	client = ca.issue("web", "spiffe://example.org/ns/dev/sa/web")
+	client.ServerID = "spiffe://example.org/protoconf/server"
+	assert.NoError(t, check(client))
+
+	// The server is verified by its SPIFFE ID
+	client.ServerID = "spiffe://example.org/other"
+	assert.Error(t, check(client))
+	// Without a SPIFFE ID of the server, its host name is verified and
+	// SPIFFE certificates have none
+	client.ServerID = ""
+	assert.Error(t, check(client))
+
+	denied := ca.issue("api", "spiffe://example.org/ns/dev/sa/api")
+	denied.ServerID = "spiffe://example.org/protoconf/server"
+	assert.Error(t, check(denied))
+	assert.Error(t, check(&TLSConfig{}))
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "other"), 0755))
+	other := newTestCA(t, filepath.Join(dir, "other"))
+	unknown := other.issue("unknown", "spiffe://example.org/ns/prod/sa/api")
+	unknown.ServerID = "spiffe://example.org/protoconf/server"
+	assert.Error(t, check(unknown))
+
+	_, err = (&TLSConfig{CertFile: client.CertFile}).ServerConfig()
+	assert.Error(t, err)
+}
+
+func TestSPIFFEID(t *testing.T) {
+	for _, id := range []string{"spiffe://example.org", "spiffe://example.org/ns/prod"} {
+		parsed, err := parseSPIFFEID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, id, parsed)
+	}
+	for _, id := range []string{"https://example.org/ns", "spiffe:///ns", "spiffe://example.org/ns?q"} {
+		_, err := parseSPIFFEID(id)
+		assert.Error(t, err, id)
+	}
+
+	var ids idsFlag
+	assert.NoError(t, ids.Set("spiffe://example.org/ns/prod/*"))
+	assert.Error(t, ids.Set("example.org/ns/prod"))
+	config := &TLSConfig{AllowedIDs: ids}
+	assert.True(t, config.allowed("spiffe://example.org/ns/prod/sa/web"))
+	assert.False(t, config.allowed("spiffe://example.org/ns/production"))
+	assert.False(t, config.allowed("spiffe://example.org/ns/prod"))
+}
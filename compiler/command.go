@@ -11,8 +11,12 @@ import (
 	"strings"
 
 	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/command"
 	compilerlib "github.com/protoconf/protoconf/compiler/lib"
 	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"go.starlark.net/repl"
 	"go.starlark.net/starlark"
 	"golang.org/x/sync/errgroup"
@@ -20,12 +24,41 @@ import (
 
 type cliCommand struct{}
 
+type stringsArray []string
+
+func (i *stringsArray) String() string {
+	return fmt.Sprintf("%v", []string(*i))
+}
+
+func (i *stringsArray) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
+
 type cliConfig struct {
-	repl           bool
-	verboseLogging bool
+	repl               bool
+	verboseLogging     bool
+	noCache            bool
+	compat             bool
+	strict             bool
+	strictDeprecations bool
+	forbidNonFinite    bool
+	openEnums          bool
+	auditDefaults      bool
+	noValidate         bool
+	validateOnly       bool
+	watch              bool
+	publish            bool
+	descriptors        string
+	report             string
+	env                string
+	policyBundle       string
+	otlpEndpoint       string
+	archives           stringsArray
+	protoPaths         stringsArray
 }
 
-func newFlagSet() (*flag.FlagSet, *cliConfig) {
+func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
 	flags := flag.NewFlagSet("", flag.ExitOnError)
 	flags.Usage = func() {
 		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... protoconf_root [config]...")
@@ -35,12 +68,32 @@ func newFlagSet() (*flag.FlagSet, *cliConfig) {
 	config := &cliConfig{}
 	flags.BoolVar(&config.repl, "repl", false, "Interactive REPL mode")
 	flags.BoolVar(&config.verboseLogging, "V", false, "Verbose logging")
+	flags.BoolVar(&config.noCache, "no-cache", false, "Don't cache parsed protos and passing validations in "+consts.CachePath)
+	flags.BoolVar(&config.compat, "compat", false, "Fail on breaking schema changes against the existing materialized configs, and record the schema of every output")
+	flags.BoolVar(&config.strict, "strict", false, "Fail on loaded symbols that are never used, instead of warning about them")
+	flags.BoolVar(&config.strictDeprecations, "strict-deprecations", false, "Fail on setting deprecated fields, instead of warning about them")
+	flags.BoolVar(&config.forbidNonFinite, "forbid-non-finite", false, "Fail on NaN and infinite float values, instead of writing them as \"NaN\", \"Infinity\" and \"-Infinity\"")
+	flags.BoolVar(&config.openEnums, "open-enums", false, "Let the fields of open (proto3) enums hold numbers their enum doesn't define, instead of failing on them")
+	flags.BoolVar(&config.auditDefaults, "audit-defaults", false, "Warn about the fields of every output left at their default value, except the defaults_allowlist of "+consts.WorkspaceConfigFile)
+	flags.BoolVar(&config.noValidate, "no-validate", false, "Write configs without validating them, an escape hatch for emergencies")
+	flags.BoolVar(&config.validateOnly, "validate-only", false, "Evaluate and validate configs without writing them")
+	flags.StringVar(&config.descriptors, "descriptors", "", "Embed the descriptors needed to decode every output, `inline' in the materialized config or in a `file' next to it")
+	flags.StringVar(&config.env, "env", "", "The environment configs are compiled for, passed to validators in their context")
+	flags.StringVar(&config.policyBundle, "policy-bundle", "", "Evaluate every output against the Rego policies of a bundle `dir` or archive with the opa CLI, instead of the policy_bundle of "+consts.WorkspaceConfigFile)
+	flags.StringVar(&config.report, "report", "", "Write every validation error and warning found to a JSON `file`")
+	flags.Var(&config.protoPaths, "proto-path", "An additional directory to import protos from (can repeat)")
+	tracing.AddFlag(flags, &config.otlpEndpoint)
+	flags.Var(&config.archives, "archive", "A zip/tar archive (local path or URL) of a protoconf source tree to use as a read-only overlay of src (can repeat)")
+	flags.BoolVar(&config.watch, "watch", false, "Keep running once the configs are compiled, and compile again the configs affected by every change of the sources: the configs changed, and the configs loading the Starlark modules, the protos and the validators changed")
+	flags.BoolVar(&config.publish, "publish", false, "With -watch, insert the configs compiled again to the key-value store of the store flags, when they compile and validate")
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
 
-	return flags, config
+	return flags, config, kVConfig
 }
 
 func (c *cliCommand) Run(args []string) int {
-	flags, config := newFlagSet()
+	flags, config, kVConfig := newFlagSet()
 	flags.Parse(args)
 
 	if flags.NArg() < 1 {
@@ -49,7 +102,26 @@ func (c *cliCommand) Run(args []string) int {
 	}
 
 	protoconfRoot := strings.TrimSpace(flags.Args()[0])
-	compiler := compilerlib.NewCompiler(protoconfRoot, config.verboseLogging)
+	if config.noValidate && config.validateOnly {
+		log.Println("-no-validate and -validate-only can't be used together")
+		return 1
+	}
+	if config.publish && !config.watch {
+		log.Println("-publish inserts the configs compiled again by -watch, it requires -watch")
+		return 1
+	}
+	if config.publish && (config.noValidate || config.validateOnly) {
+		log.Println("-publish inserts the configs validated and written, it can't be used with -no-validate or -validate-only")
+		return 1
+	}
+	if config.noValidate {
+		log.Println("Warning: validation is disabled by -no-validate, configs are written without running validators, PGV rules, protovalidate constraints and post-compile hooks")
+	}
+	compiler, err := config.newCompiler(protoconfRoot)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
 
 	if config.repl {
 		REPL(compiler)
@@ -65,16 +137,100 @@ func (c *cliCommand) Run(args []string) int {
 			log.Printf("Error getting all configs from %s, err=%s", protoconfRoot, err)
 			return 1
 		}
+		configs = mergeConfigs(configs, compiler.ArchiveConfigs())
 	} else {
 		configs = flags.Args()[1:]
 	}
 
-	g, _ := errgroup.WithContext(context.Background())
+	shutdownTracing, err := tracing.Init(config.otlpEndpoint, "protoconf-compile")
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer shutdownTracing()
+
+	err = config.compile(compiler, configs)
+	if config.watch {
+		var store libprotoconf.Store
+		if config.publish {
+			if store, err = libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address); err != nil {
+				log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+				return 1
+			}
+			defer store.Close()
+			store = kVConfig.WithHistory(store)
+			log.Printf("Publishing the configs compiled again to %s at \"%s\", config path prefix=\"%s\"", kVConfig.Store, kVConfig.Address, kVConfig.Prefix)
+		}
+		return config.watchSources(protoconfRoot, compiler.Dependencies(), store, kVConfig.Prefix)
+	}
+	if err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// newCompiler creates a compiler of the configs of protoconfRoot set up by
+// the flags
+func (config *cliConfig) newCompiler(protoconfRoot string) (*compilerlib.Compiler, error) {
+	compiler := compilerlib.NewCompiler(protoconfRoot, config.verboseLogging)
+	if config.noCache {
+		compiler.CacheDir = ""
+	}
+	if config.compat {
+		compiler.EnableCompat()
+	}
+	if config.strict {
+		compiler.EnableStrict()
+	}
+	if config.strictDeprecations {
+		compiler.EnableStrictDeprecations()
+	}
+	if config.forbidNonFinite {
+		compiler.ForbidNonFiniteFloats()
+	}
+	if config.openEnums {
+		compiler.AllowOpenEnums()
+	}
+	if config.auditDefaults {
+		compiler.AuditDefaults()
+	}
+	if config.noValidate {
+		compiler.DisableValidation()
+	}
+	if config.validateOnly {
+		compiler.DisableWriting()
+	}
+	compiler.SetEnvironment(config.env)
+	if config.policyBundle != "" {
+		compiler.SetPolicyBundle(config.policyBundle)
+	}
+	if err := compiler.SetDescriptorsMode(config.descriptors); err != nil {
+		return nil, err
+	}
+	for _, protoPath := range config.protoPaths {
+		compiler.AddProtoPath(protoPath)
+	}
+	for _, archive := range config.archives {
+		if err := compiler.AddSourceArchive(archive); err != nil {
+			return nil, fmt.Errorf("error loading source archive %s, err=%s", archive, err)
+		}
+	}
+	return compiler, nil
+}
+
+// compile compiles configs, checks their references and runs the
+// post-compile hooks, logging the errors, and writes the report when the
+// flags ask for one
+func (config *cliConfig) compile(compiler *compilerlib.Compiler, configs []string) error {
+	ctx, span := tracing.Start(context.Background(), "compile configs", attribute.Int("protoconf.configs", len(configs)))
 
-	for _, config := range configs {
-		filename := strings.TrimSpace(config)
+	g, _ := errgroup.WithContext(ctx)
+
+	for _, source := range configs {
+		filename := strings.TrimSpace(source)
 		g.Go(func() error {
-			err := compiler.CompileFile(filename)
+			err := compiler.CompileFileContext(ctx, filename)
 			if err != nil {
 				log.Printf("Error compiling config %s, err=%s", filename, err)
 			}
@@ -82,19 +238,50 @@ func (c *cliCommand) Run(args []string) int {
 		})
 	}
 	err := g.Wait()
+	if err == nil {
+		_, referencesSpan := tracing.Start(ctx, "check references")
+		if err = compiler.CheckReferences(); err != nil {
+			log.Printf("Error checking references, err=%s", err)
+		}
+		tracing.End(referencesSpan, err)
+	}
+	if err == nil {
+		_, hooksSpan := tracing.Start(ctx, "run hooks")
+		if err = compiler.RunHooks(); err != nil {
+			log.Printf("Error running post-compile hooks, err=%s", err)
+		}
+		tracing.End(hooksSpan, err)
+	}
+	tracing.End(span, err)
+	if config.report != "" {
+		if reportErr := writeReport(compiler.Report(), config.report); reportErr != nil {
+			log.Printf("Error writing report %s, err=%s", config.report, reportErr)
+			return reportErr
+		}
+	}
 	if err != nil {
 		log.Println(err)
-		return 1
 	}
+	return err
+}
 
-	return 0
+func writeReport(report *compilerlib.Report, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteJSON(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
 }
 
 func (c *cliCommand) Help() string {
 	var b bytes.Buffer
 	b.WriteString(c.Synopsis())
 	b.WriteString("\n")
-	flags, _ := newFlagSet()
+	flags, _, _ := newFlagSet()
 	flags.SetOutput(&b)
 	flags.Usage()
 	return b.String()
@@ -110,16 +297,23 @@ func Command() (cli.Command, error) {
 }
 
 func getAllConfigs(protoconfRoot string) ([]string, error) {
+	return getAllSources(protoconfRoot, consts.ConfigExtension, consts.MultiConfigExtension)
+}
+
+// getAllSources returns the files of the src dir with one of the extensions
+func getAllSources(protoconfRoot string, extensions ...string) ([]string, error) {
 	srcDir, err := filepath.Abs(filepath.Join(protoconfRoot, consts.SrcPath))
 	if err != nil {
 		return nil, err
 	}
 
-	var configs []string
+	var sources []string
 	err = filepath.Walk(srcDir, func(path string, f os.FileInfo, err error) error {
 		ext := filepath.Ext(path)
-		if ext == consts.ConfigExtension || ext == consts.MultiConfigExtension {
-			configs = append(configs, strings.TrimPrefix(path, srcDir))
+		for _, extension := range extensions {
+			if ext == extension {
+				sources = append(sources, strings.TrimPrefix(path, srcDir))
+			}
 		}
 		return nil
 	})
@@ -128,7 +322,22 @@ func getAllConfigs(protoconfRoot string) ([]string, error) {
 		return nil, err
 	}
 
-	return configs, nil
+	return sources, nil
+}
+
+// mergeConfigs adds the archive configs which are not shadowed by a local config
+func mergeConfigs(local []string, archived []string) []string {
+	seen := make(map[string]bool)
+	for _, config := range local {
+		seen[strings.TrimPrefix(filepath.ToSlash(config), "/")] = true
+	}
+	for _, config := range archived {
+		if !seen[config] {
+			seen[config] = true
+			local = append(local, config)
+		}
+	}
+	return local
 }
 
 func REPL(c *compilerlib.Compiler) {
@@ -138,6 +347,7 @@ func REPL(c *compilerlib.Compiler) {
 	thread := &starlark.Thread{
 		Load: loader.Load,
 	}
+	loader.AttachTo(thread)
 
 	repl.REPL(thread, loader.Modules)
 }
@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/protoconf/protoconf/consts"
+)
+
+// sourceArchive is a read-only protoconf source tree loaded from a zip or tar
+// archive. It is used as an overlay under the local src dir.
+type sourceArchive struct {
+	location string
+	// root is a pseudo import path under which the archive protos are resolved
+	root  string
+	files map[string][]byte
+}
+
+func newSourceArchive(location string, index int) (*sourceArchive, error) {
+	data, err := readArchive(location)
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive %s, err=%s", location, err)
+	}
+
+	files, err := unpackArchive(location, data)
+	if err != nil {
+		return nil, fmt.Errorf("error unpacking archive %s, err=%s", location, err)
+	}
+
+	return &sourceArchive{
+		location: location,
+		root:     filepath.Join(string(filepath.Separator)+"protoconf-archive", strconv.Itoa(index)),
+		files:    stripSourcePrefix(files),
+	}, nil
+}
+
+func (a *sourceArchive) open(name string) (io.ReadCloser, bool) {
+	data, ok := a.files[strings.TrimPrefix(filepath.ToSlash(name), "/")]
+	if !ok {
+		return nil, false
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), true
+}
+
+func (a *sourceArchive) configs() []string {
+	var configs []string
+	for name := range a.files {
+		ext := path.Ext(name)
+		if ext == consts.ConfigExtension || ext == consts.MultiConfigExtension {
+			configs = append(configs, name)
+		}
+	}
+	sort.Strings(configs)
+	return configs
+}
+
+func unpackArchive(location string, data []byte) (map[string][]byte, error) {
+	name := strings.SplitN(location, "?", 2)[0]
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return unpackZip(data)
+	case strings.HasSuffix(name, ".tar"):
+		return unpackTar(bytes.NewReader(data))
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		return unpackTar(gzipReader)
+	}
+	return nil, fmt.Errorf("unsupported archive format, expected .zip, .tar, .tar.gz or .tgz")
+}
+
+func unpackZip(data []byte) (map[string][]byte, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(file.Name)] = contents
+	}
+	return files, nil
+}
+
+func unpackTar(r io.Reader) (map[string][]byte, error) {
+	tarReader := tar.NewReader(r)
+	files := make(map[string][]byte)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		contents, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(header.Name)] = contents
+	}
+}
+
+// stripSourcePrefix re-roots the archive files at its src dir. Archives may
+// contain a whole protoconf root (optionally nested under a top level
+// directory), or just the contents of src.
+func stripSourcePrefix(files map[string][]byte) map[string][]byte {
+	prefix := ""
+	found := false
+	for name := range files {
+		idx := strings.Index("/"+name, "/"+consts.SrcPath)
+		if idx < 0 {
+			continue
+		}
+		candidate := name[:idx] + consts.SrcPath
+		if !found || len(candidate) < len(prefix) {
+			prefix = candidate
+			found = true
+		}
+	}
+	if !found {
+		return files
+	}
+
+	stripped := make(map[string][]byte)
+	for name, contents := range files {
+		if strings.HasPrefix(name, prefix) {
+			stripped[strings.TrimPrefix(name, prefix)] = contents
+		}
+	}
+	return stripped
+}
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	pc "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// checkCompat compares the schema of message with the schema recorded in the
+// existing output file, failing on changes which break the consumers of the
+// output: removed, renamed or renumbered fields, field type changes and removed
+// enum values. Outputs written without a recorded schema are checked by decoding
+// their value with the new schema.
+func (c *Compiler) checkCompat(message protoreflect.Message, filename string, anyResolver *protoregistry.Types) error {
+	exists, _, err := stat(filename)
+	if err != nil || !exists {
+		return err
+	}
+	reader, err := openFile(filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	var previous struct {
+		Descriptors json.RawMessage `json:"descriptors"`
+		Value       struct {
+			Type string `json:"@type"`
+		} `json:"value"`
+	}
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return fmt.Errorf("error reading existing output %s, err: %v", filename, err)
+	}
+
+	newDesc := message.Descriptor()
+	oldName := protoreflect.FullName(previous.Value.Type[strings.LastIndex(previous.Value.Type, "/")+1:])
+	if oldName != newDesc.FullName() {
+		return fmt.Errorf("breaking schema change in %s: message type changed from %s to %s", filename, oldName, newDesc.FullName())
+	}
+
+	if previous.Descriptors == nil {
+		if err := (protojson.UnmarshalOptions{Resolver: anyResolver}).Unmarshal(data, &pc.ProtoconfValue{}); err != nil {
+			return fmt.Errorf("breaking schema change in %s: the existing output doesn't match the schema of %s, err: %v", filename, newDesc.FullName(), err)
+		}
+		return nil
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := protojson.Unmarshal(previous.Descriptors, set); err != nil {
+		return fmt.Errorf("error reading the schema recorded in %s, err: %v", filename, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return fmt.Errorf("error reading the schema recorded in %s, err: %v", filename, err)
+	}
+	desc, err := files.FindDescriptorByName(oldName)
+	if err != nil {
+		return fmt.Errorf("error reading the schema recorded in %s, err: %v", filename, err)
+	}
+	oldDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return fmt.Errorf("error reading the schema recorded in %s, %s is not a message", filename, oldName)
+	}
+
+	var problems []string
+	compareMessages(oldDesc, newDesc, make(map[protoreflect.FullName]bool), &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("breaking schema changes in %s:\n  %s", filename, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func compareMessages(oldDesc, newDesc protoreflect.MessageDescriptor, seen map[protoreflect.FullName]bool, problems *[]string) {
+	if seen[oldDesc.FullName()] {
+		return
+	}
+	seen[oldDesc.FullName()] = true
+
+	fields := oldDesc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		oldField := fields.Get(i)
+		newField := newDesc.Fields().ByNumber(oldField.Number())
+		if newField == nil {
+			if renumbered := newDesc.Fields().ByName(oldField.Name()); renumbered != nil {
+				*problems = append(*problems, fmt.Sprintf("field %s renumbered from %d to %d", oldField.FullName(), oldField.Number(), renumbered.Number()))
+			} else {
+				*problems = append(*problems, fmt.Sprintf("field %s (%d) removed", oldField.FullName(), oldField.Number()))
+			}
+			continue
+		}
+		if newField.Name() != oldField.Name() {
+			*problems = append(*problems, fmt.Sprintf("field %d of %s renamed from %s to %s", oldField.Number(), oldDesc.FullName(), oldField.Name(), newField.Name()))
+		}
+		if oldType, newType := describeField(oldField), describeField(newField); oldType != newType {
+			*problems = append(*problems, fmt.Sprintf("field %s changed type from %s to %s", oldField.FullName(), oldType, newType))
+			continue
+		}
+		if oldField.IsMap() {
+			oldField, newField = oldField.MapValue(), newField.MapValue()
+		}
+		if oldField.Message() != nil {
+			compareMessages(oldField.Message(), newField.Message(), seen, problems)
+		} else if oldField.Enum() != nil {
+			compareEnums(oldField.Enum(), newField.Enum(), problems)
+		}
+	}
+}
+
+func compareEnums(oldDesc, newDesc protoreflect.EnumDescriptor, problems *[]string) {
+	values := oldDesc.Values()
+	for i := 0; i < values.Len(); i++ {
+		oldValue := values.Get(i)
+		newValue := newDesc.Values().ByNumber(oldValue.Number())
+		if newValue == nil {
+			*problems = append(*problems, fmt.Sprintf("enum value %s (%d) removed", oldValue.FullName(), oldValue.Number()))
+		} else if newValue.Name() != oldValue.Name() {
+			*problems = append(*problems, fmt.Sprintf("enum value %d of %s renamed from %s to %s", oldValue.Number(), oldDesc.FullName(), oldValue.Name(), newValue.Name()))
+		}
+	}
+}
+
+// describeField returns the type of a field as written in a proto file
+func describeField(field protoreflect.FieldDescriptor) string {
+	if field.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", describeType(field.MapKey()), describeType(field.MapValue()))
+	}
+	if field.IsList() {
+		return "repeated " + describeType(field)
+	}
+	return describeType(field)
+}
+
+func describeType(field protoreflect.FieldDescriptor) string {
+	if field.Message() != nil {
+		return string(field.Message().FullName())
+	}
+	if field.Enum() != nil {
+		return string(field.Enum().FullName())
+	}
+	return field.Kind().String()
+}
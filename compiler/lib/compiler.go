@@ -1,21 +1,29 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/golang/protobuf/jsonpb"
-	"github.com/golang/protobuf/ptypes"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/pkg/errors"
 	"github.com/protoconf/protoconf/compiler/proto"
 	"github.com/protoconf/protoconf/consts"
 	pc "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/tracing"
 	"github.com/protoconf/protoconf/utils"
+	"go.opentelemetry.io/otel/attribute"
 	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
+	"golang.org/x/sync/errgroup"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 func NewCompiler(protoconfRoot string, verboseLogging bool) *Compiler {
@@ -26,21 +34,127 @@ func NewCompiler(protoconfRoot string, verboseLogging bool) *Compiler {
 	resolve.AllowGlobalReassign = true // allow reassignment to top-level names; also, allow if/for/while at top-level
 	resolve.AllowRecursion = true      // allow while statements and recursive functions
 
+	protoImportPaths, err := utils.ProtoImportPaths(protoconfRoot)
+	if err != nil {
+		log.Printf("Error resolving proto import paths, err=%s", err)
+	}
+
+	anyTypeURLPrefix := proto.DefaultAnyTypeURLPrefix
+	var hooks, defaultsAllowlist []string
+	var policyBundle string
+	policyQuery := DefaultPolicyQuery
+	if workspace, err := utils.LoadWorkspace(protoconfRoot); err == nil {
+		if workspace.AnyTypeURLPrefix != "" {
+			anyTypeURLPrefix = strings.TrimSuffix(workspace.AnyTypeURLPrefix, "/") + "/"
+		}
+		hooks = workspace.PostCompileHooks
+		defaultsAllowlist = workspace.DefaultsAllowlist
+		if workspace.PolicyBundle != "" {
+			policyBundle = filepath.Join(protoconfRoot, workspace.PolicyBundle)
+		}
+		if workspace.PolicyQuery != "" {
+			policyQuery = workspace.PolicyQuery
+		}
+	}
+
 	return &Compiler{
-		protoconfRoot:    protoconfRoot,
-		verboseLogging:   verboseLogging,
-		disableWriting:   false,
-		protoFilesLoaded: make(map[string]interface{}),
-		MaterializedDir:  filepath.Join(protoconfRoot, consts.CompiledConfigPath),
+		protoconfRoot:     protoconfRoot,
+		verboseLogging:    verboseLogging,
+		disableWriting:    false,
+		protoImportPaths:  protoImportPaths,
+		anyTypeURLPrefix:  anyTypeURLPrefix,
+		MaterializedDir:   filepath.Join(protoconfRoot, consts.CompiledConfigPath),
+		CacheDir:          filepath.Join(protoconfRoot, consts.CachePath),
+		report:            &Report{},
+		hooks:             hooks,
+		defaultsAllowlist: defaultsAllowlist,
+		policyBundle:      policyBundle,
+		policyQuery:       policyQuery,
+		opaBinary:         "opa",
+		outputs:           make(map[string]protoreflect.Message),
+		compiled:          make(map[string]bool),
+		dependencies:      make(DependencyGraph),
 	}
 }
 
 type Compiler struct {
-	protoconfRoot    string
-	verboseLogging   bool
-	disableWriting   bool
-	protoFilesLoaded map[string]interface{}
-	MaterializedDir  string
+	protoconfRoot      string
+	verboseLogging     bool
+	disableWriting     bool
+	disableValidation  bool
+	compat             bool
+	strict             bool
+	strictDeprecations bool
+	forbidNonFinite    bool
+	auditDefaults      bool
+	// defaultsAllowlist are the fields the audit of default fields leaves out
+	defaultsAllowlist []string
+	descriptorsMode   string
+	environment       string
+	protoImportPaths  []string
+	// anyTypeURLPrefix is the type URL prefix of the messages assigned to
+	// `google.protobuf.Any' fields, from the workspace
+	anyTypeURLPrefix string
+	// openEnums lets the fields of open enums hold numbers their enum doesn't
+	// define
+	openEnums bool
+	archives  []*sourceArchive
+	report    *Report
+	// hooks are the scripts registering the post-compile hooks
+	hooks []string
+	// policyBundle holds the Rego policies outputs are evaluated against with
+	// policyQuery by the opaBinary, when set
+	policyBundle string
+	policyQuery  string
+	opaBinary    string
+	// outputs are the compiled outputs by name, kept for the post-compile hooks
+	outputs map[string]protoreflect.Message
+	// compiled are the names of the outputs compiled, and references are the
+	// outputs the compiled configs refer to. dependencies are the source
+	// files of the configs loaded.
+	compiled        map[string]bool
+	references      []reference
+	dependencies    DependencyGraph
+	outputsLock     sync.Mutex
+	MaterializedDir string
+	// CacheDir is where parsed protos are cached between runs, caching is
+	// disabled when empty
+	CacheDir string
+}
+
+// AddProtoPath adds a directory protos are imported from, searched after the
+// src dir and the workspace proto paths
+func (c *Compiler) AddProtoPath(path string) {
+	c.protoImportPaths = append(c.protoImportPaths, filepath.Clean(path))
+}
+
+// AddSourceArchive adds a zip or tar archive (a local path or any go-getter
+// supported URL) as a read-only overlay of the src dir. Files in the local src
+// dir take precedence over files in archives, and earlier archives take
+// precedence over later ones.
+func (c *Compiler) AddSourceArchive(location string) error {
+	archive, err := newSourceArchive(location, len(c.archives))
+	if err != nil {
+		return err
+	}
+	c.archives = append(c.archives, archive)
+	return nil
+}
+
+// ArchiveConfigs returns the configs found in the source archives
+func (c *Compiler) ArchiveConfigs() []string {
+	var configs []string
+	for _, archive := range c.archives {
+		configs = append(configs, archive.configs()...)
+	}
+	return configs
+}
+
+// DisableValidation writes configs without running their validators, PGV
+// rules, protovalidate constraints and post-compile hooks, logging a warning
+// for each config. It's an escape hatch for emergencies.
+func (c *Compiler) DisableValidation() {
+	c.disableValidation = true
 }
 
 func (c *Compiler) DisableWriting() error {
@@ -48,7 +162,73 @@ func (c *Compiler) DisableWriting() error {
 	return nil
 }
 
+// EnableCompat records the schema of every output in the materialized file,
+// and fails compiling an output whose schema breaks the schema recorded in the
+// existing materialized file
+func (c *Compiler) EnableCompat() {
+	c.compat = true
+}
+
+// EnableStrict fails compiling configs which load symbols they never use,
+// instead of only logging them
+func (c *Compiler) EnableStrict() {
+	c.strict = true
+}
+
+// EnableStrictDeprecations fails compiling configs which set deprecated
+// fields, instead of only logging them
+func (c *Compiler) EnableStrictDeprecations() {
+	c.strictDeprecations = true
+}
+
+// ForbidNonFiniteFloats fails compiling outputs with NaN or infinite float
+// values, which are otherwise written as "NaN", "Infinity" and "-Infinity"
+func (c *Compiler) ForbidNonFiniteFloats() {
+	c.forbidNonFinite = true
+}
+
+// AuditDefaults warns about the fields of every output left at their default
+// value, except the fields of the `defaults_allowlist' of the workspace
+func (c *Compiler) AuditDefaults() {
+	c.auditDefaults = true
+}
+
+// AllowOpenEnums lets the fields of open enums, the enums of proto3 files, be
+// set to numbers their enum doesn't define. Closed enums, the enums of proto2
+// files, only accept the values they define.
+func (c *Compiler) AllowOpenEnums() {
+	c.openEnums = true
+}
+
+// SetEnvironment sets the environment configs are compiled for, e.g. "prod",
+// which validators receive in their context
+func (c *Compiler) SetEnvironment(env string) {
+	c.environment = env
+}
+
+// SetDescriptorsMode sets whether the descriptors of the proto files needed to
+// decode an output are embedded in the materialized config (DescriptorsInline),
+// written next to it (DescriptorsFile) or not at all (DescriptorsNone)
+func (c *Compiler) SetDescriptorsMode(mode string) error {
+	switch mode {
+	case DescriptorsNone, DescriptorsInline, DescriptorsFile:
+		c.descriptorsMode = mode
+		return nil
+	}
+	return fmt.Errorf("unknown descriptors mode %q, expected %q or %q", mode, DescriptorsInline, DescriptorsFile)
+}
+
 func (c *Compiler) CompileFile(filename string) error {
+	return c.CompileFileContext(context.Background(), filename)
+}
+
+// CompileFileContext compiles a config as CompileFile does, tracing the
+// loading, evaluation, validation and writing of the config under the span of
+// ctx
+func (c *Compiler) CompileFileContext(ctx context.Context, filename string) (err error) {
+	ctx, span := tracing.Start(ctx, "compile", tracing.ConfigKey.String(filename))
+	defer func() { tracing.End(span, err) }()
+
 	multiConfig := false
 	if strings.HasSuffix(filename, consts.ConfigExtension) {
 	} else if strings.HasSuffix(filename, consts.MultiConfigExtension) {
@@ -57,12 +237,18 @@ func (c *Compiler) CompileFile(filename string) error {
 		return fmt.Errorf("config file must end with either %s or %s, got: %s", consts.ConfigExtension, consts.MultiConfigExtension, filename)
 	}
 
-	mainOutput, configFile, err := c.runConfig(filename)
+	mainOutput, configFile, err := c.runConfig(ctx, filename)
 	if err != nil {
 		return err
 	}
+	if err := c.reportWarnings(configFile); err != nil {
+		return err
+	}
 
-	configs := make(map[string]*dynamic.Message)
+	configs := make(map[string]protoreflect.Message)
+	// outputKeys are the keys of the outputs of a `.mpconf' by output file
+	outputKeys := make(map[string]string)
+	var outputs *starlark.Dict
 
 	if multiConfig {
 		starDict, ok := mainOutput.(*starlark.Dict)
@@ -80,8 +266,11 @@ func (c *Compiler) CompileFile(filename string) error {
 			if !ok {
 				return fmt.Errorf("`main' returned a dict with non-protobuf value, got: %s", item[1].Type())
 			}
-			configs[filepath.Join(outputDir, string(key))+consts.CompiledConfigExtension] = value
+			outputFile := filepath.Join(outputDir, string(key)) + consts.CompiledConfigExtension
+			configs[outputFile] = value
+			outputKeys[outputFile] = string(key)
 		}
+		outputs = starDict
 	} else {
 		message, ok := proto.ToProtoMessage(mainOutput)
 		if !ok {
@@ -91,57 +280,294 @@ func (c *Compiler) CompileFile(filename string) error {
 		configs[outputFile] = message
 	}
 
-	for outputFile, message := range configs {
-		if err := configFile.validate(message); err != nil {
+	outputFiles := make([]string, 0, len(configs))
+	for outputFile := range configs {
+		outputFiles = append(outputFiles, outputFile)
+	}
+	sort.Strings(outputFiles)
+
+	if c.disableValidation {
+		log.Printf("Warning: validation is disabled, %s is not validated", filename)
+	} else if err := c.validateConfigContext(ctx, configFile, outputs, outputFiles, configs, outputKeys); err != nil {
+		return err
+	}
+
+	_, writeSpan := tracing.Start(ctx, "write", attribute.Int("protoconf.outputs", len(outputFiles)))
+	for _, outputFile := range outputFiles {
+		if err := c.writeConfig(configs[outputFile], outputFile, configFile); err != nil {
+			tracing.End(writeSpan, err)
 			return err
 		}
-		if err := c.writeConfig(message, outputFile); err != nil {
+		c.addOutput(outputFile, configs[outputFile])
+	}
+	writeSpan.End()
+	c.addReferences(configFile, outputFiles)
+
+	return nil
+}
+
+// validateConfigContext validates the outputs of a config as validateConfig
+// does, failing with the failures found
+func (c *Compiler) validateConfigContext(ctx context.Context, configFile *config, outputs *starlark.Dict, outputFiles []string, configs map[string]protoreflect.Message, outputKeys map[string]string) (err error) {
+	_, span := tracing.Start(ctx, "validate", attribute.Int("protoconf.outputs", len(outputFiles)))
+	defer func() { tracing.End(span, err) }()
+	failures, err := c.validateConfig(configFile, outputs, outputFiles, configs, outputKeys)
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// validateConfig validates the outputs of a config, and runs the
+// `validate_outputs' function of a `.mpconf' on the dict of its outputs.
+// Every output is validated before any is written, so that all of the
+// violations of a config are reported at once.
+func (c *Compiler) validateConfig(configFile *config, outputs *starlark.Dict, outputFiles []string, configs map[string]protoreflect.Message, outputKeys map[string]string) ([]string, error) {
+	var failures []string
+	if outputs != nil {
+		found, err := c.validateOutputsWithCache(configFile, outputs, outputFiles, configs, outputKeys)
+		if err != nil {
+			return nil, err
+		}
+		for _, failure := range found {
+			c.addToReport(configFile, "", "output validation errors", SeverityError, failure)
+		}
+		if len(found) > 0 {
+			failures = append(failures, fmt.Sprintf("output validation errors in %s:\n  %s", configFile.filename, strings.Join(found, "\n  ")))
+		}
+	}
+
+	// Outputs are validated concurrently, each on its own threads, and their
+	// failures are gathered in the order of the outputs
+	found := make([][]string, len(outputFiles))
+	var g errgroup.Group
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for i, outputFile := range outputFiles {
+		i, outputFile := i, outputFile
+		g.Go(func() error {
+			var err error
+			found[i], err = c.validateOutput(configFile, outputFile, outputKeys[outputFile], configs[outputFile])
 			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	for _, outputFailures := range found {
+		failures = append(failures, outputFailures...)
+	}
+	return failures, nil
+}
+
+// validateOutput runs the validators, PGV rules, protovalidate constraints,
+// immutable field, enum and float checks and the policies on an output, the key of which is
+// outputKey for a `.mpconf'. The failures of each kind are returned as one message listing
+// them, and added to the report along with the warnings raised by validators.
+func (c *Compiler) validateOutput(configFile *config, outputFile string, outputKey string, message protoreflect.Message) ([]string, error) {
+	validationErrors, violations, err := c.validateWithCache(configFile, outputFile, outputKey, message)
+	if err != nil {
+		return nil, err
+	}
+	if c.auditDefaults {
+		var defaults []string
+		defaultFields(message, "", c.defaultsAllowlist, &defaults)
+		if len(defaults) > 0 {
+			log.Printf("Warning: %s in %s:\n  %s", warningDefaultFields, outputFile, strings.Join(defaults, "\n  "))
+		}
+		for _, path := range defaults {
+			c.addToReport(configFile, outputFile, warningDefaultFields, SeverityWarning, path)
+		}
+	}
+	undefinedEnums, err := configFile.undefinedEnums(message)
+	if err != nil {
+		return nil, err
+	}
+	immutableChanges, err := configFile.immutableChanges(message, outputFile)
+	if err != nil {
+		return nil, err
+	}
+	var nonFinite []string
+	if c.forbidNonFinite {
+		if nonFinite, err = configFile.nonFiniteFloats(message); err != nil {
+			return nil, err
 		}
 	}
+	policyViolations, err := c.policyViolations(configFile, outputKey, message)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	var failures []string
+	for _, found := range []struct {
+		kind     string
+		messages []string
+	}{
+		{"validation errors", validationErrors},
+		{"constraint violations", violations},
+		{"undefined enum values", undefinedEnums},
+		{"immutable field changes", immutableChanges},
+		{"non-finite floats", nonFinite},
+		{"policy violations", policyViolations},
+	} {
+		if len(found.messages) == 0 {
+			continue
+		}
+		for _, message := range found.messages {
+			c.addToReport(configFile, outputFile, found.kind, SeverityError, message)
+		}
+		failures = append(failures, fmt.Sprintf("%s in %s:\n  %s", found.kind, outputFile, strings.Join(found.messages, "\n  ")))
+	}
+	return failures, nil
 }
 
-func (c *Compiler) writeConfig(message *dynamic.Message, filename string) error {
-	if c.disableWriting {
+// validateWithCache runs the validators, `protoconf.validate' and PGV rules and the
+// protovalidate constraints on an output. With a cache dir, outputs which
+// passed them before without warnings, with the same content, schema and
+// validators, aren't validated again.
+func (c *Compiler) validateWithCache(configFile *config, outputFile string, outputKey string, message protoreflect.Message) ([]string, []string, error) {
+	var cacheKey string
+	if c.CacheDir != "" {
+		var err error
+		if cacheKey, err = configFile.validationKey(message, outputKey, c.environment); err != nil {
+			return nil, nil, err
+		}
+		if c.validationCached(cacheKey) {
+			return nil, nil, nil
+		}
+	}
+
+	v, err := configFile.runValidation(message, outputKey, c.environment)
+	if err != nil {
+		return nil, nil, err
+	}
+	validationErrors, warnings := v.failures, v.warnings
+	// The warnings raised by validators are logged even when validation fails
+	for _, warning := range warnings {
+		log.Printf("Warning: %s", warning)
+		c.addToReport(configFile, outputFile, proto.WarningValidators, SeverityWarning, warning)
+	}
+	violations, err := configFile.constraintViolations(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cacheKey != "" && len(validationErrors) == 0 && len(violations) == 0 && len(warnings) == 0 {
+		c.cacheValidation(cacheKey)
+	}
+	return validationErrors, violations, nil
+}
+
+// validateOutputsWithCache runs the output validators of a `.mpconf' on the
+// dict of its outputs. With a cache dir, they aren't run again when they
+// passed before without warnings on the same outputs, with the same config,
+// modules it loads and validators. Changing any output runs them again.
+func (c *Compiler) validateOutputsWithCache(configFile *config, outputs *starlark.Dict, outputFiles []string, configs map[string]protoreflect.Message, outputKeys map[string]string) ([]string, error) {
+	var cacheKey string
+	if c.CacheDir != "" {
+		var err error
+		if cacheKey, err = configFile.outputsValidationKey(outputFiles, configs, outputKeys, c.environment); err != nil {
+			return nil, err
+		}
+		if c.validationCached(cacheKey) {
+			return nil, nil
+		}
+	}
+
+	warnings := len(configFile.warnings.Messages(proto.WarningValidators))
+	failures, err := configFile.validateOutputs(outputs)
+	if err != nil {
+		return nil, err
+	}
+	if cacheKey != "" && len(failures) == 0 && len(configFile.warnings.Messages(proto.WarningValidators)) == warnings {
+		c.cacheValidation(cacheKey)
+	}
+	return failures, nil
+}
+
+// Report returns the violations and warnings found by the compilations so far
+func (c *Compiler) Report() *Report {
+	return c.report
+}
+
+// addToReport adds an entry found compiling configFile. outputFile is empty
+// for entries found evaluating the config.
+func (c *Compiler) addToReport(configFile *config, outputFile string, kind string, severity string, message string) {
+	if outputFile != "" {
+		if rel, err := filepath.Rel(c.MaterializedDir, outputFile); err == nil {
+			outputFile = filepath.ToSlash(rel)
+		}
+	}
+	c.report.add(ReportEntry{
+		Config:   configFile.filename,
+		Output:   outputFile,
+		Kind:     kind,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+func (c *Compiler) writeConfig(message protoreflect.Message, filename string, configFile *config) error {
+	if c.disableWriting && !c.compat {
 		return nil
 	}
-	any, err := ptypes.MarshalAny(message)
+	any, err := anypb.New(message.Interface())
 	if err != nil {
-		return fmt.Errorf("error marshaling proto to Any, message=%s", message)
+		return fmt.Errorf("error marshaling proto to Any, message=%s", message.Descriptor().FullName())
 	}
 
 	protoconfValue := &pc.ProtoconfValue{
-		ProtoFile: filepath.ToSlash(message.GetMessageDescriptor().GetFile().GetName()),
+		ProtoFile: filepath.ToSlash(message.Descriptor().ParentFile().Path()),
 		Value:     any,
 	}
 
-	var protoFilesToLoad []string
-	for k := range c.protoFilesLoaded {
-		if len(k) > 0 {
-			protoFilesToLoad = append(protoFilesToLoad, strings.TrimPrefix(k, "/"))
+	anyResolver := configFile.anyResolver
+	var descriptorSet *descriptorpb.FileDescriptorSet
+	if c.compat || c.descriptorsMode != DescriptorsNone {
+		files, err := configFile.outputFiles(message)
+		if err != nil {
+			return err
 		}
+		descriptorSet = utils.FileDescriptorSet(files...)
 	}
-	anyResolver, err := utils.LoadAnyResolver(filepath.Join(c.protoconfRoot, "src"), protoFilesToLoad...)
-	if err != nil {
-		return err
+	if c.compat {
+		if err := c.checkCompat(message, filename, anyResolver); err != nil {
+			return err
+		}
+	}
+	if c.compat || c.descriptorsMode == DescriptorsInline {
+		protoconfValue.Descriptors = descriptorSet
+	}
+	if c.disableWriting {
+		return nil
 	}
-	m := &jsonpb.Marshaler{AnyResolver: anyResolver, Indent: "  "}
-	jsonData, err := m.MarshalToString(protoconfValue)
+
+	jsonData, err := utils.MarshalJSON(protoconfValue, anyResolver)
 	if err != nil {
 		return errors.Wrapf(err, "error marshaling ProtoconfValue to JSON, value=%v", protoconfValue)
 	}
-	jsonData += "\n"
+	jsonData = append(jsonData, '\n')
 
 	if err := mkdirAll(filepath.Dir(filename), 0755); err != nil {
 		return fmt.Errorf("error creating output directory %s, err: %s", filepath.Dir(filename), err)
 	}
 
-	if err := writeFile(filename, []byte(jsonData)); err != nil {
+	if err := writeFile(filename, jsonData); err != nil {
 		return fmt.Errorf("error writing to file %s, err: %s", filename, err)
 	}
 
+	if c.descriptorsMode == DescriptorsFile {
+		descriptorSetFile := strings.TrimSuffix(filename, consts.CompiledConfigExtension) + consts.DescriptorSetExtension
+		data, err := protov2.Marshal(descriptorSet)
+		if err != nil {
+			return fmt.Errorf("error marshaling descriptors of %s, err: %s", filename, err)
+		}
+		if err := writeFile(descriptorSetFile, data); err != nil {
+			return fmt.Errorf("error writing to file %s, err: %s", descriptorSetFile, err)
+		}
+	}
+
 	if c.verboseLogging {
 		log.Printf("Writing to %s:\n%s", filename, jsonData)
 	}
@@ -149,14 +575,48 @@ func (c *Compiler) writeConfig(message *dynamic.Message, filename string) error
 	return nil
 }
 
-func (c *Compiler) runConfig(filename string) (starlark.Value, *config, error) {
-	configFile, err := c.load(filename)
+// reportWarnings logs the warnings raised by evaluating a config, or fails on
+// them when their strict mode is enabled
+func (c *Compiler) reportWarnings(configFile *config) error {
+	for _, warnings := range []struct {
+		kind     string
+		messages []string
+		strict   bool
+	}{
+		{"unused loads", configFile.unusedLoads, c.strict},
+		{proto.WarningDeprecated, configFile.warnings.Messages(proto.WarningDeprecated), c.strictDeprecations},
+		// Unknown fields are only collected when asked for, they never fail
+		{proto.WarningUnknownFields, configFile.warnings.Messages(proto.WarningUnknownFields), false},
+	} {
+		if len(warnings.messages) == 0 {
+			continue
+		}
+		if warnings.strict {
+			for _, message := range warnings.messages {
+				c.addToReport(configFile, "", warnings.kind, SeverityError, message)
+			}
+			return fmt.Errorf("%s in %s:\n  %s", warnings.kind, configFile.filename, strings.Join(warnings.messages, "\n  "))
+		}
+		for _, message := range warnings.messages {
+			log.Printf("Warning: %s", message)
+			c.addToReport(configFile, "", warnings.kind, SeverityWarning, message)
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) runConfig(ctx context.Context, filename string) (starlark.Value, *config, error) {
+	loadCtx, span := tracing.Start(ctx, "load")
+	configFile, err := c.load(loadCtx, filename)
+	tracing.End(span, err)
 
 	if err != nil {
 		return nil, nil, fmt.Errorf("error loading %s: %v", filename, err)
 	}
 
+	_, span = tracing.Start(ctx, "eval")
 	mainOutput, err := configFile.main()
+	tracing.End(span, err)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error evaluating %s: %v", configFile.filename, err)
 	}
@@ -164,28 +624,61 @@ func (c *Compiler) runConfig(filename string) (starlark.Value, *config, error) {
 	return mainOutput, configFile, nil
 }
 
-func (c *Compiler) load(filename string) (*config, error) {
+func (c *Compiler) load(ctx context.Context, filename string) (*config, error) {
 
 	loader := c.GetLoader()
+	loader.ctx = ctx
+	if strings.HasSuffix(filename, consts.TestExtension) {
+		for name, value := range testModules() {
+			loader.Modules[name] = value
+		}
+	}
+	var outputValidators []*starlark.Function
+	if strings.HasSuffix(filename, consts.MultiConfigExtension) {
+		loader.Modules["add_output_validator"] = starlark.NewBuiltin("add_output_validator", starAddOutputValidator(&outputValidators))
+	}
 	locals, validators, err := loader.loadConfig(filepath.ToSlash(filename))
-	for _, f := range *loader.protoFilesLoaded {
-		c.protoFilesLoaded[f] = true
+	if !strings.HasSuffix(filename, consts.TestExtension) {
+		c.addDependencies(filename, loader)
 	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &config{
-		filename:   filename,
-		locals:     locals,
-		validators: validators,
+		filename:         filename,
+		locals:           locals,
+		validators:       validators,
+		outputValidators: outputValidators,
+		anyResolver:      utils.NewAnyResolver(loader.protoFiles...),
+		protoFiles:       loader.protoFiles,
+		unusedLoads:      loader.unusedLoads,
+		prototypes:       loader.prototypes,
+		warnings:         loader.warnings,
+		options:          loader.options,
+		references:       loader.references,
+		validatorsHash:   loader.validatorsHash,
+		configHash:       loader.configHash,
 	}, nil
 }
 
 func (c *Compiler) GetLoader() *starlarkLoader {
+	protos := proto.NewNamespace()
+	modules := getModules()
+	modules["protos"] = protos
 	return &starlarkLoader{
+		ctx:              context.Background(),
 		cache:            make(map[string]*cacheEntry),
-		Modules:          getModules(),
+		importPaths:      c.protoImportPaths,
+		archives:         c.archives,
+		cacheDir:         c.CacheDir,
+		Modules:          modules,
+		protos:           protos,
+		prototypes:       proto.NewPrototypes(),
+		warnings:         proto.NewWarnings(),
+		options:          &proto.Options{AnyTypeURLPrefix: c.anyTypeURLPrefix, OpenEnums: c.openEnums},
+		references:       &references{},
+		loaded:           make(map[string]*module),
 		mutableDir:       filepath.Join(c.protoconfRoot, consts.MutableConfigPath),
 		protoFilesLoaded: &[]string{},
 		srcDir:           filepath.Join(c.protoconfRoot, consts.SrcPath),
@@ -1,13 +1,35 @@
 package lib
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/protoconf/protoconf/compiler/proto"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/tracing"
+	"github.com/protoconf/protoconf/utils"
 	assert "github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.starlark.net/starlark"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 func Test(t *testing.T) {
+	goModCache, err := filepath.Abs("testdata/gomodcache")
+	assert.NoError(t, err)
+	t.Setenv("GOMODCACHE", goModCache)
+
 	c := NewCompiler("testdata", true)
 	dir, err := ioutil.TempDir("", "compiler_output")
 	if err != nil {
@@ -15,6 +37,7 @@ func Test(t *testing.T) {
 	}
 	t.Log("Test results written to", dir)
 	c.MaterializedDir = dir
+	c.CacheDir = filepath.Join(dir, ".cache")
 	assert.NoError(t, c.CompileFile("test.pconf"))
 	assert.Error(t, c.CompileFile("validator_test.pconf"))
 	assert.Error(t, c.CompileFile("validator_repeated_test.pconf"))
@@ -26,6 +49,2137 @@ func Test(t *testing.T) {
 	assert.NoError(t, c.CompileFile("include_pinc_test.pconf"))
 	assert.NoError(t, c.CompileFile("load_mutable_test.pconf"))
 	assert.NoError(t, c.CompileFile("field_type_any_test.pconf"))
+	assert.Error(t, c.CompileFile("any_validator_test.pconf"))
+	assert.NoError(t, c.CompileFile("any_validator_passing_test.pconf"))
+	assert.NoError(t, c.CompileFile("any_loaded_type_test.pconf"))
+	output, err := ioutil.ReadFile(filepath.Join(dir, "any_loaded_type_test.materialized_JSON"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `"@type": "type.googleapis.com/extensions.Holder"`)
 	assert.NoError(t, c.CompileFile("uninitialized_msg_test.pconf"))
 	assert.NoError(t, c.CompileFile("test_hashable.pconf"))
+	assert.NoError(t, c.CompileFile("go_module_proto_test.pconf"))
+	assert.NoError(t, c.CompileFile("optional_test.pconf"))
+	assert.Error(t, c.CompileFile("optional_no_presence_test.pconf"))
+	assert.NoError(t, c.CompileFile("extensions_test.pconf"))
+	assert.Error(t, c.CompileFile("extensions_wrong_extendee_test.pconf"))
+	assert.NoError(t, c.CompileFile("editions_test.pconf"))
+	assert.Error(t, c.CompileFile("editions_implicit_presence_test.pconf"))
+	err = c.CompileFile("unknown_field_test.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown_field_test.pconf:4:23: field "string_value" not found in message TestMessage (did you mean "stringValue"?)`)
+	assert.NoError(t, c.CompileFile("protos_namespace_test.pconf"))
+	err = c.CompileFile("protos_ambiguous_test.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ambiguous name Shared, it is defined as collide.a.Shared, collide.b.Shared")
+	err = c.CompileFile("load_collision_test.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "load_collision_test.pconf:2:26: Shared is loaded from both collide/a.proto and collide/b.proto")
+
+	assert.Error(t, c.CompileFile("proto_paths_test.pconf"))
+	c.AddProtoPath("testdata/generated/protos")
+	assert.NoError(t, c.CompileFile("proto_paths_test.pconf"))
+
+	assert.Error(t, c.CompileFile("archived/archived_test.pconf"))
+	assert.NoError(t, c.AddSourceArchive("testdata/overlay.zip"))
+	assert.Equal(t, []string{"archived/archived_test.pconf"}, c.ArchiveConfigs())
+	assert.NoError(t, c.CompileFile("archived/archived_test.pconf"))
+
+	cached, err := ioutil.ReadDir(c.CacheDir)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cached)
+	assert.NoError(t, c.CompileFile("test.pconf"))
+	assert.NoError(t, c.CompileFile("extensions_test.pconf"))
+	assert.NoError(t, c.CompileFile("editions_test.pconf"))
+	assert.Error(t, c.CompileFile("editions_implicit_presence_test.pconf"))
+}
+
+// newTestRoot returns a protoconf root removed once the test ends, with files
+// written to it, their names relative to the root
+func newTestRoot(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, consts.SrcPath), 0755))
+	for name, content := range files {
+		writeTestFile(t, root, name, content)
+	}
+	return root
+}
+
+// writeTestFile writes a file of the protoconf root of a test, creating its
+// directory
+func writeTestFile(t *testing.T, root string, name string, content string) {
+	filename := filepath.Join(root, filepath.FromSlash(name))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+}
+
+// newTestCompiler returns a compiler of root which doesn't cache the parsed
+// protos, for the protos the tests rewrite to be parsed again
+func newTestCompiler(root string) *Compiler {
+	c := NewCompiler(root, false)
+	c.CacheDir = ""
+	return c
+}
+
+func TestCompat(t *testing.T) {
+	root := newTestRoot(t, map[string]string{
+		"src/compat.pconf": "load(\"compat.proto\", \"Service\")\ndef main():\n    return Service(name=\"api\")\n",
+	})
+	writeProto := func(fields string) {
+		proto := "syntax = \"proto3\";\npackage compat;\nenum Level { LOW = 0; HIGH = 1; }\nmessage Service {\n" + fields + "}\n"
+		writeTestFile(t, root, "src/compat.proto", proto)
+	}
+
+	compile := func() error {
+		c := newTestCompiler(root)
+		c.EnableCompat()
+		return c.CompileFile("compat.pconf")
+	}
+
+	writeProto("string name = 1;\nint32 port = 2;\nLevel level = 3;\n")
+	assert.NoError(t, compile())
+	output, err := ioutil.ReadFile(filepath.Join(root, "materialized_config", "compat.materialized_JSON"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `"descriptors"`)
+
+	writeProto("string name = 1;\nint32 port = 2;\nLevel level = 3;\nbool enabled = 4;\n")
+	assert.NoError(t, compile())
+
+	writeProto("string name = 1;\nint64 port = 5;\nLevel level = 3;\nbool enabled = 4;\n")
+	err = compile()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "field compat.Service.port renumbered from 2 to 5")
+
+	writeProto("string name = 1;\nint64 port = 2;\nbool enabled = 4;\n")
+	err = compile()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "field compat.Service.port changed type from int32 to int64")
+	assert.Contains(t, err.Error(), "field compat.Service.level (3) removed")
+}
+
+func TestProtoAccessorImportPaths(t *testing.T) {
+	root := newTestRoot(t, map[string]string{
+		"src/x.proto":  "syntax = \"proto3\";\n",
+		"src2/x.proto": "syntax = \"proto3\";\n",
+	})
+	loader := &starlarkLoader{
+		importPaths:      []string{filepath.Join(root, "src")},
+		protoFilesLoaded: &[]string{},
+	}
+
+	reader, err := loader.protoAccessor(filepath.Join(root, "src", "x.proto"))
+	assert.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, []string{string(filepath.Separator) + "x.proto"}, *loader.protoFilesLoaded)
+
+	_, err = loader.protoAccessor(filepath.Join(root, "src2", "x.proto"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "proto path must be under one of")
+}
+
+func TestAnyTypeURLPrefix(t *testing.T) {
+	files := map[string]string{
+		"protoconf.yaml": "any_type_url_prefix: types.example.com\n",
+		"src/payload.proto": `syntax = "proto3";
+import "google/protobuf/any.proto";
+message Payload { string name = 1; }
+message Envelope { google.protobuf.Any payload = 1; }
+`,
+		"src/envelope.pconf": `load("payload.proto", "Envelope", "Payload")
+def main():
+    envelope = Envelope()
+    envelope.payload = Payload(name="packed")
+    return envelope
+`,
+	}
+	root := newTestRoot(t, files)
+	delete(files, "protoconf.yaml")
+	defaultRoot := newTestRoot(t, files)
+
+	// The compilers of other roots keep their own prefix
+	c := newTestCompiler(root)
+	other := newTestCompiler(defaultRoot)
+	assert.NoError(t, c.CompileFile("envelope.pconf"))
+	assert.NoError(t, other.CompileFile("envelope.pconf"))
+	output, err := ioutil.ReadFile(filepath.Join(root, "materialized_config", "envelope.materialized_JSON"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `"@type": "types.example.com/Payload"`)
+	assert.Contains(t, string(output), `"name": "packed"`)
+	output, err = ioutil.ReadFile(filepath.Join(defaultRoot, "materialized_config", "envelope.materialized_JSON"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `"@type": "type.googleapis.com/Payload"`)
+}
+
+func TestDescriptorsFile(t *testing.T) {
+	files := map[string]string{
+		"src/payload.proto": `syntax = "proto3";
+message Payload { string name = 1; }
+`,
+		"src/envelope.proto": `syntax = "proto3";
+import "google/protobuf/any.proto";
+message Envelope { google.protobuf.Any payload = 1; }
+`,
+		"src/envelope.pconf": `load("envelope.proto", "Envelope")
+load("payload.proto", "Payload")
+def main():
+    return Envelope(payload=Payload(name="packed"))
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.Error(t, c.SetDescriptorsMode("binary"))
+	assert.NoError(t, c.SetDescriptorsMode(DescriptorsFile))
+	assert.NoError(t, c.CompileFile("envelope.pconf"))
+
+	data, err := ioutil.ReadFile(filepath.Join(root, "materialized_config", "envelope.protoset"))
+	assert.NoError(t, err)
+	set := &descriptorpb.FileDescriptorSet{}
+	assert.NoError(t, protov2.Unmarshal(data, set))
+	registry, err := protodesc.NewFiles(set)
+	assert.NoError(t, err)
+	_, err = registry.FindDescriptorByName("Payload")
+	assert.NoError(t, err, "descriptors of packed messages are embedded")
+	_, err = registry.FindDescriptorByName("Envelope")
+	assert.NoError(t, err)
+}
+
+func TestUnusedLoads(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Service { string name = 1; }
+message Unused { string name = 1; }
+`,
+		"src/helpers.star": `load("service.proto", "Service")
+def service(name):
+    return Service(name=name)
+`,
+		"src/unused.star": `def unused():
+    return None
+`,
+		"src/service.pconf": `load("helpers.star", "service")
+load("service.proto", "Service", "Unused")
+load("unused.star", "unused")
+def main():
+    return service(Service(name="api").name)
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("service.pconf"))
+
+	c.EnableStrict()
+	err := c.CompileFile("service.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unused loads in service.pconf:\n  service.pconf:2:35: Unused loaded from service.proto is unused\n  service.pconf:3:1: nothing loaded from unused.star is used")
+}
+
+func TestBundledProtos(t *testing.T) {
+	files := map[string]string{
+		"src/order.proto": `syntax = "proto3";
+import "google/api/annotations.proto";
+import "google/type/date.proto";
+import "google/type/money.proto";
+message Order {
+  google.type.Money price = 1;
+  google.type.Date due = 2;
+}
+service Orders {
+  rpc Get(Order) returns (Order) { option (google.api.http) = { get: "/v1/orders" }; }
+}
+`,
+		"src/order.pconf": `load("order.proto", "Order")
+load("google/type/money.proto", "Money")
+def main():
+    return Order(price=Money(currency_code="USD", units=3), due=protos.google.type.Date(year=2021))
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("order.pconf"))
+	output, err := ioutil.ReadFile(filepath.Join(root, "materialized_config", "order.materialized_JSON"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `"currencyCode": "USD"`)
+	assert.Contains(t, string(output), `"year": 2021`)
+}
+
+func TestMessageDefaults(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message RetryPolicy { int32 attempts = 1; string backoff = 2; }
+message Service { RetryPolicy retry = 1; RetryPolicy fallback_retry = 2; RetryPolicy no_retry = 3; }
+`,
+		"src/defaults.star": `load("service.proto", "RetryPolicy")
+proto.set_defaults(RetryPolicy(attempts=3, backoff="1s"))
+DEFAULTS = True
+`,
+		"src/service.pconf": `load("defaults.star", "DEFAULTS")
+load("service.proto", "RetryPolicy", "Service")
+def main():
+    return Service(
+        retry=RetryPolicy(),
+        fallback_retry=RetryPolicy(attempts=5),
+        no_retry=RetryPolicy(__defaults__=False, backoff="0s"),
+    )
+`,
+		"src/twice.pconf": `load("defaults.star", "DEFAULTS")
+load("service.proto", "RetryPolicy")
+proto.set_defaults(RetryPolicy(attempts=1))
+def main():
+    return RetryPolicy()
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("service.pconf"))
+	output, err := ioutil.ReadFile(filepath.Join(root, "materialized_config", "service.materialized_JSON"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `"retry": {
+      "attempts": 3,
+      "backoff": "1s"
+    }`)
+	assert.Contains(t, string(output), `"fallbackRetry": {
+      "attempts": 5,
+      "backoff": "1s"
+    }`)
+	assert.Contains(t, string(output), `"noRetry": {
+      "backoff": "0s"
+    }`)
+
+	err = c.CompileFile("twice.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "proto.set_defaults: the defaults of RetryPolicy are already set")
+}
+
+func TestDeprecatedFields(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Limits { int32 rps = 1; int32 qps = 2 [deprecated = true]; }
+message Service {
+  reserved 3;
+  reserved "port";
+  string name = 1;
+  string host = 2 [deprecated = true];
+  Limits limits = 4;
+}
+`,
+		"src/service.pconf": `load("service.proto", "Limits", "Service")
+def main():
+    service = Service(name="api", host="localhost")
+    service.limits = Limits(rps=10)
+    service.limits.qps = 10
+    return service
+`,
+		"src/reserved.pconf": `load("service.proto", "Service")
+def main():
+    return Service(port=80)
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("service.pconf"))
+
+	c.EnableStrictDeprecations()
+	err := c.CompileFile("service.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "deprecated fields in service.pconf:\n  service.pconf:3:22: field Service.host is deprecated\n  service.pconf:5:19: field Limits.qps is deprecated")
+
+	err = c.CompileFile("reserved.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `field "port" is reserved in message Service`)
+}
+
+func TestInt64Boundaries(t *testing.T) {
+	files := map[string]string{
+		"src/integers.proto": `syntax = "proto3";
+message Integers {
+  int64 max = 1;
+  int64 min = 2;
+  uint64 umax = 3;
+  sfixed64 above_float = 4;
+  int32 int32_max = 5;
+}
+`,
+		"src/integers.pconf": `load("integers.proto", "Integers")
+def main():
+    integers = Integers(max=(1 << 63) - 1, min=-(1 << 63), umax=(1 << 64) - 1, above_float=(1 << 53) + 1)
+    # Arithmetic on 64-bit fields is exact
+    integers.max = integers.max - 1 + 1
+    integers.umax = integers.umax // 3 * 3
+    integers.int32_max = (1 << 31) - 1
+    return integers
+`,
+		"src/int64_overflow.pconf": `load("integers.proto", "Integers")
+def main():
+    return Integers(max=1 << 63)
+`,
+		"src/uint64_negative.pconf": `load("integers.proto", "Integers")
+def main():
+    return Integers(umax=-1)
+`,
+		"src/int32_overflow.pconf": `load("integers.proto", "Integers")
+def main():
+    return Integers(int32_max=1 << 31)
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("integers.pconf"))
+	output, err := ioutil.ReadFile(filepath.Join(root, "materialized_config", "integers.materialized_JSON"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `"max": "9223372036854775807"`)
+	assert.Contains(t, string(output), `"min": "-9223372036854775808"`)
+	assert.Contains(t, string(output), `"umax": "18446744073709551615"`)
+	assert.Contains(t, string(output), `"aboveFloat": "9007199254740993"`)
+	assert.Contains(t, string(output), `"int32Max": 2147483647`)
+
+	err = c.CompileFile("int64_overflow.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "value 9223372036854775808 overflows type `int64'")
+	err = c.CompileFile("uint64_negative.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "value -1 overflows type `uint64'")
+	err = c.CompileFile("int32_overflow.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "value 2147483648 overflows type `int32'")
+}
+
+func TestNonFiniteFloats(t *testing.T) {
+	files := map[string]string{
+		"src/floats.proto": `syntax = "proto3";
+message Point { double x = 1; float y = 2; }
+message Floats {
+  double ratio = 1;
+  repeated Point points = 2;
+  map<string, double> weights = 3;
+}
+`,
+		"src/floats.pconf": `load("floats.proto", "Floats", "Point")
+def main():
+    return Floats(
+        ratio=float("nan"),
+        points=[Point(x=1.0), Point(y=float("-inf"))],
+        weights={"a": 0.5, "b": float("inf")},
+    )
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("floats.pconf"))
+	output, err := ioutil.ReadFile(filepath.Join(root, "materialized_config", "floats.materialized_JSON"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `"ratio": "NaN"`)
+	assert.Contains(t, string(output), `"y": "-Infinity"`)
+	assert.Contains(t, string(output), `"b": "Infinity"`)
+
+	c.ForbidNonFiniteFloats()
+	err = c.CompileFile("floats.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `non-finite floats in `)
+	assert.Contains(t, err.Error(), "floats.materialized_JSON:\n  points[1].y is -Infinity\n  ratio is NaN\n  weights[\"b\"] is Infinity")
+}
+
+func TestUnknownFields(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Backend { string host = 1; }
+message Service {
+  string name = 1;
+  repeated Backend backends = 2;
+  map<string, Backend> by_zone = 3;
+}
+`,
+		"src/service.pconf": `load("service.proto", "Service")
+JSON = '{"name": "api", "owner": "infra", "backends": [{"host": "a", "port": 80}], "byZone": {"eu": {"host": "b", "weight": 1.5}}}'
+TEXT = '''
+name: "api"
+owner: "infra"  # dropped
+backends { host: "a" port: 80 }
+backends { host: "b" extra { nested: [1, 2] } }
+by_zone { key: "eu" value { host: "c" weight: - 1.5 } }
+'''
+def main():
+    return {
+        "json": proto.from_json(Service, JSON, unknown_fields="collect"),
+        "text": proto.from_text(Service, TEXT, unknown_fields="collect"),
+        "ignored": proto.from_json(Service, JSON, unknown_fields="ignore"),
+    }
+`,
+		"src/strict.pconf": `load("service.proto", "Service")
+def main():
+    return proto.from_json(Service, '{"name": "api", "owner": "infra"}')
+`,
+		"src/policy.pconf": `load("service.proto", "Service")
+def main():
+    return proto.from_text(Service, 'name: "api"', unknown_fields="drop")
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	output, configFile, err := c.runConfig(context.Background(), "service.pconf")
+	assert.NoError(t, err)
+	dict := output.(*starlark.Dict)
+	for _, key := range []string{"json", "text", "ignored"} {
+		value, _, err := dict.Get(starlark.String(key))
+		assert.NoError(t, err)
+		assert.Contains(t, value.String(), `name:"api"`, key)
+		assert.NotContains(t, value.String(), "infra", key)
+	}
+	assert.Equal(t, []string{
+		`service.pconf:12:32: unknown field backends[0].port dropped when decoding Service from JSON`,
+		`service.pconf:12:32: unknown field byZone["eu"].weight dropped when decoding Service from JSON`,
+		`service.pconf:12:32: unknown field owner dropped when decoding Service from JSON`,
+		`service.pconf:13:32: unknown field backends[0].port dropped when decoding Service from text`,
+		`service.pconf:13:32: unknown field backends[1].extra dropped when decoding Service from text`,
+		`service.pconf:13:32: unknown field by_zone.value.weight dropped when decoding Service from text`,
+		`service.pconf:13:32: unknown field owner dropped when decoding Service from text`,
+	}, configFile.warnings.Messages(proto.WarningUnknownFields))
+
+	err = c.CompileFile("strict.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `proto.from_json: error decoding Service from JSON`)
+	assert.Contains(t, err.Error(), `unknown field "owner"`)
+
+	err = c.CompileFile("policy.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `proto.from_text: unknown_fields must be one of "error", "ignore" or "collect", got "drop"`)
+}
+
+func TestDeepValidation(t *testing.T) {
+	files := map[string]string{
+		"src/deployment.proto": `syntax = "proto2";
+message Port { optional int32 number = 1; }
+message Pool { repeated Port ports = 1; }
+message Deployment {
+  map<string, Pool> pools = 1;
+  oneof target {
+    Port port = 2;
+    string host = 3;
+  }
+  extensions 100 to 199;
+}
+extend Deployment { optional Port admin_port = 100; }
+`,
+		"src/deployment.proto-validator": `load("//deployment.proto", "Port")
+def validate_port(port):
+    if port.number <= 0:
+        fail("invalid port %d" % port.number)
+add_validator(Port, validate_port)
+`,
+		"src/valid.pconf": `load("deployment.proto", "Deployment", "Pool", "Port", "admin_port")
+def main():
+    deployment = Deployment(pools={"eu": Pool(ports=[Port(number=80)])}, port=Port(number=443))
+    proto.set_extension(deployment, admin_port, Port(number=8080))
+    return deployment
+`,
+		"src/map.pconf": `load("deployment.proto", "Deployment", "Pool", "Port")
+def main():
+    return Deployment(pools={"eu": Pool(ports=[Port(number=80), Port(number=-1)])})
+`,
+		"src/oneof.pconf": `load("deployment.proto", "Deployment", "Port")
+def main():
+    return Deployment(port=Port(number=-2))
+`,
+		"src/extension.pconf": `load("deployment.proto", "Deployment", "Port", "admin_port")
+def main():
+    deployment = Deployment(host="localhost")
+    proto.set_extension(deployment, admin_port, Port(number=-3))
+    return deployment
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("valid.pconf"))
+	for file, message := range map[string]string{
+		"map.pconf":       "invalid port -1",
+		"oneof.pconf":     "invalid port -2",
+		"extension.pconf": "invalid port -3",
+	} {
+		err := c.CompileFile(file)
+		assert.Error(t, err, file)
+		assert.Contains(t, err.Error(), message, file)
+	}
+}
+
+func TestMultipleValidators(t *testing.T) {
+	files := map[string]string{
+		"src/port.proto": `syntax = "proto3";
+message Port { int32 number = 1; }
+`,
+		"src/port.proto-validator": `load("//port.proto", "Port")
+def validate_positive(port):
+    if port.number <= 0:
+        fail("port must be positive")
+def validate_range(port):
+    if port.number > 65535:
+        fail("port out of range")
+add_validator(Port, validate_positive)
+add_validator(Port, validate_range)
+add_validator(Port, validate_range)
+`,
+		"src/team.proto": `syntax = "proto3";
+import "port.proto";
+message Service { Port port = 1; }
+`,
+		"src/team.proto-validator": `load("//port.proto", "Port")
+def validate_unprivileged(port):
+    if port.number < 1024:
+        fail("port %d is privileged" % port.number)
+add_validator(Port, validate_unprivileged)
+`,
+	}
+	for name, port := range map[string]string{"valid": "8080", "privileged": "80", "negative": "-1", "large": "70000"} {
+		files["src/"+name+".pconf"] = fmt.Sprintf(`load("team.proto", "Service")
+load("port.proto", "Port")
+def main():
+    return Service(port=Port(number=%s))
+`, port)
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("valid.pconf"))
+
+	err := c.CompileFile("privileged.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Port: validator validate_unprivileged (team.proto-validator:2:1) failed")
+	assert.Contains(t, err.Error(), "port 80 is privileged")
+
+	err = c.CompileFile("negative.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Port: validator validate_positive (port.proto-validator:2:1) failed")
+	assert.Contains(t, err.Error(), "Port: validator validate_unprivileged (team.proto-validator:2:1) failed")
+
+	// validate_range is added twice but runs once
+	err = c.CompileFile("large.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Port: validator validate_range (port.proto-validator:5:1) failed")
+	assert.Equal(t, 1, strings.Count(err.Error(), "port out of range"))
+}
+
+func TestValidatorWarnings(t *testing.T) {
+	files := map[string]string{
+		"src/port.proto": `syntax = "proto3";
+message Port { int32 number = 1; }
+`,
+		"src/port.proto-validator": `load("//port.proto", "Port")
+def validate_port(port):
+    if port.number < 1024:
+        warn("port %d is privileged" % port.number)
+    if port.number <= 0:
+        fail("port must be positive")
+add_validator(Port, validate_port)
+`,
+		"src/privileged.pconf": `load("port.proto", "Port")
+def main():
+    return Port(number=80)
+`,
+		"src/negative.pconf": `load("port.proto", "Port")
+def main():
+    return Port(number=-1)
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("privileged.pconf"))
+	assert.Error(t, c.CompileFile("negative.pconf"))
+
+	output, configFile, err := c.runConfig(context.Background(), "privileged.pconf")
+	assert.NoError(t, err)
+	message, ok := proto.ToProtoMessage(output)
+	assert.True(t, ok)
+	v, err := configFile.runValidation(message, "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, v.failures)
+	assert.Equal(t, []string{"port.proto-validator:4:13: port 80 is privileged"}, v.warnings)
+}
+
+func TestValidationReport(t *testing.T) {
+	files := map[string]string{
+		"src/port.proto": `syntax = "proto3";
+message Port { int32 number = 1; }
+message Ports { repeated Port ports = 1; }
+`,
+		"src/port.proto-validator": `load("//port.proto", "Port")
+def validate_positive(port):
+    if port.number <= 0:
+        fail("port %d must be positive" % port.number)
+def validate_unprivileged(port):
+    if port.number < 1024:
+        warn("port %d is privileged" % port.number)
+add_validator(Port, validate_positive)
+add_validator(Port, validate_unprivileged)
+`,
+		"src/ports.mpconf": `load("port.proto", "Port", "Ports")
+def main():
+    return {
+        "a": Ports(ports=[Port(number=-1), Port(number=8080), Port(number=-2)]),
+        "b": Port(number=0),
+        "c": Port(number=8080),
+    }
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	err := c.CompileFile("ports.mpconf")
+	assert.Error(t, err)
+	for _, message := range []string{
+		"ports/a.materialized_JSON:\n  ports[0]: Port: validator validate_positive (port.proto-validator:2:1) failed: [port.proto-validator:4:13] port -1 must be positive",
+		"ports[2]: Port: validator validate_positive (port.proto-validator:2:1) failed: [port.proto-validator:4:13] port -2 must be positive",
+		"ports/b.materialized_JSON:\n  Port: validator validate_positive (port.proto-validator:2:1) failed: [port.proto-validator:4:13] port 0 must be positive",
+	} {
+		assert.Contains(t, err.Error(), message)
+	}
+	// Nothing is written when an output is invalid
+	_, err = os.Stat(filepath.Join(c.MaterializedDir, "ports", "c"+consts.CompiledConfigExtension))
+	assert.True(t, os.IsNotExist(err))
+
+	var severities []string
+	for _, entry := range c.Report().Entries() {
+		assert.Equal(t, "ports.mpconf", entry.Config)
+		severities = append(severities, fmt.Sprintf("%s %s %s", entry.Output, entry.Severity, entry.Kind))
+	}
+	assert.Equal(t, []string{
+		"ports/a.materialized_JSON warning validator warnings",
+		"ports/a.materialized_JSON warning validator warnings",
+		"ports/a.materialized_JSON error validation errors",
+		"ports/a.materialized_JSON error validation errors",
+		"ports/b.materialized_JSON warning validator warnings",
+		"ports/b.materialized_JSON error validation errors",
+	}, severities)
+
+	var report strings.Builder
+	assert.NoError(t, c.Report().WriteJSON(&report))
+	assert.Contains(t, report.String(), `"errors": 3,
+  "warnings": 3,`)
+	assert.Contains(t, report.String(), `"message": "port.proto-validator:7:13: port 0 is privileged"`)
+}
+
+func TestValidationContext(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Replicas { int32 count = 1; }
+message Service { map<string, Replicas> regions = 1; repeated Replicas canaries = 2; }
+`,
+		"src/service.proto-validator": `load("//service.proto", "Replicas")
+def validate_replicas(replicas, ctx):
+    if ctx.env == "prod" and replicas.count < 3:
+        fail("%s %s %s: %d replicas in prod" % (ctx.config, ctx.output, ctx.path, replicas.count))
+add_validator(Replicas, validate_replicas)
+`,
+		"src/services.mpconf": `load("service.proto", "Replicas", "Service")
+def main():
+    return {
+        "api": Service(regions={"eu": Replicas(count=1)}, canaries=[Replicas(count=3), Replicas(count=2)]),
+        "db": Replicas(count=1),
+    }
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("services.mpconf"))
+
+	c.SetEnvironment("prod")
+	err := c.CompileFile("services.mpconf")
+	assert.Error(t, err)
+	for _, message := range []string{
+		`services.mpconf api regions["eu"]: 1 replicas in prod`,
+		`services.mpconf api canaries[1]: 2 replicas in prod`,
+		`services.mpconf db : 1 replicas in prod`,
+	} {
+		assert.Contains(t, err.Error(), message)
+	}
+	assert.NotContains(t, err.Error(), "canaries[0]")
+}
+
+func TestValidateOutputs(t *testing.T) {
+	services := `load("service.proto", "Service")
+def main():
+    return {
+        "api": Service(port=8080),
+        "web": Service(port=%d),
+    }
+def validate_outputs(outputs):
+    claimed = {}
+    for name, service in outputs.items():
+        if service.port in claimed:
+            fail("%%s and %%s both claim port %%d" %% (claimed[service.port], name, service.port))
+        claimed[service.port] = name
+`
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Service { int32 port = 1; }
+`,
+		"src/valid.mpconf":     fmt.Sprintf(services, 8081),
+		"src/duplicate.mpconf": fmt.Sprintf(services, 8080),
+		"src/mutating.mpconf": `load("service.proto", "Service")
+def main():
+    return {"api": Service(port=8080)}
+def validate_outputs(outputs):
+    outputs["web"] = Service(port=8081)
+`,
+		"src/not_a_function.mpconf": `load("service.proto", "Service")
+def main():
+    return {"api": Service(port=8080)}
+validate_outputs = True
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("valid.mpconf"))
+
+	err := c.CompileFile("duplicate.mpconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "output validation errors in duplicate.mpconf:\n  validate_outputs (duplicate.mpconf:7:1) failed: [duplicate.mpconf:11:17] api and web both claim port 8080")
+	_, err = os.Stat(filepath.Join(c.MaterializedDir, "duplicate", "api"+consts.CompiledConfigExtension))
+	assert.True(t, os.IsNotExist(err))
+
+	err = c.CompileFile("mutating.mpconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot insert into frozen hash table")
+
+	err = c.CompileFile("not_a_function.mpconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "`validate_outputs' must be a function that gets 1 param, got: True")
+}
+
+func TestPostCompileHooks(t *testing.T) {
+	files := map[string]string{
+		"protoconf.yaml": "post_compile_hooks: [hooks/owners.star]\n",
+		"src/service.proto": `syntax = "proto3";
+package acme;
+message Service { string owner = 1; }
+`,
+		"src/hooks/owners.star": `def check_owners(outputs):
+    missing = [name for name, output in outputs.items() if type(output) == "acme.Service" and not output.owner]
+    if missing:
+        fail("services without an owner: %s" % ", ".join(missing))
+def check_count(outputs):
+    if len(outputs) > 10:
+        fail("too many outputs")
+add_hook(check_owners)
+add_hook(check_count)
+`,
+		"src/api.pconf": `load("service.proto", "Service")
+def main():
+    return Service(owner="api-team")
+`,
+		"src/teams.mpconf": `load("service.proto", "Service")
+def main():
+    return {"web": Service(owner="web-team"), "db": Service()}
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("api.pconf"))
+	assert.NoError(t, c.RunHooks())
+	assert.NoError(t, c.CompileFile("teams.mpconf"))
+	err := c.RunHooks()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "post-compile hook errors:\n  hook check_owners (hooks/owners.star:1:1) failed: [hooks/owners.star:4:13] services without an owner: teams/db\n")
+	assert.NotContains(t, err.Error(), "check_count")
+	entries := c.Report().Entries()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "hooks/owners.star", entries[0].Config)
+
+	// Without hooks nothing is kept
+	assert.NoError(t, os.Remove(filepath.Join(root, "protoconf.yaml")))
+	c = newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("teams.mpconf"))
+	assert.NoError(t, c.RunHooks())
+	assert.Empty(t, c.outputs)
+}
+
+func TestValidateHelpers(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Backend { string name = 1; string host = 2; int32 port = 3; }
+message Service {
+  string name = 1;
+  string url = 2;
+  string tier = 3;
+  map<string, Backend> regions = 4;
+  repeated Backend backends = 5;
+}
+`,
+		"src/service.proto-validator": `load("//service.proto", "Backend", "Service")
+def validate_service(service):
+    validate.non_empty(service, "name")
+    validate.matches(service, "name", "^[a-z]+$")
+    validate.valid_url(service, "url")
+    validate.one_of(service, "tier", ["gold", "silver"])
+    validate.non_empty(service, "backends")
+    validate.unique_by(service, "backends", "name")
+    validate.unique_by(service, "backends", lambda b: (b.host, b.port))
+def validate_backend(backend):
+    validate.valid_hostname(backend, "host")
+    validate.in_range(backend, "port", 1, 65535)
+add_validator(Service, validate_service)
+add_validator(Backend, validate_backend)
+`,
+	}
+	valid := map[string]string{
+		"name":     `"api"`,
+		"url":      `"https://api.example.com/v1"`,
+		"tier":     `"gold"`,
+		"backends": `[Backend(name="a", host="a.example.com", port=80), Backend(name="b", host="a.example.com", port=81)]`,
+		"regions":  `{"eu": Backend(name="eu", host="eu.example.com", port=443)}`,
+	}
+	cases := map[string]struct {
+		field, value, message string
+	}{
+		"valid":          {"name", `"api"`, ""},
+		"empty":          {"name", `""`, "name: must not be empty"},
+		"pattern":        {"name", `"API"`, `name: "API" does not match "^[a-z]+$"`},
+		"url":            {"url", `"api.example.com"`, `url: "api.example.com" is not a valid URL`},
+		"one_of":         {"tier", `"bronze"`, `tier: "bronze" is not one of ["gold", "silver"]`},
+		"no_backends":    {"backends", `[]`, "backends: must not be empty"},
+		"duplicate_name": {"backends", `[Backend(name="a", host="a.example.com", port=80), Backend(name="a", host="b.example.com", port=80)]`, `backends[1]: duplicate key "a", first seen at backends[0]`},
+		"duplicate_key":  {"backends", `[Backend(name="a", host="a.example.com", port=80), Backend(name="b", host="a.example.com", port=80)]`, `backends[1]: duplicate key ("a.example.com", 80), first seen at backends[0]`},
+		"port":           {"backends", `[Backend(name="a", host="a.example.com", port=0)]`, "backends[0].port: 0 is not in range [1, 65535]"},
+		"hostname":       {"regions", `{"eu": Backend(name="eu", host="-eu", port=443)}`, `regions["eu"].host: "-eu" is not a valid hostname`},
+	}
+	for name, test := range cases {
+		var args []string
+		for _, field := range []string{"name", "url", "tier", "backends", "regions"} {
+			value := valid[field]
+			if field == test.field {
+				value = test.value
+			}
+			args = append(args, field+"="+value)
+		}
+		files["src/"+name+".pconf"] = fmt.Sprintf(`load("service.proto", "Backend", "Service")
+def main():
+    return Service(%s)
+`, strings.Join(args, ", "))
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	for name, test := range cases {
+		err := c.CompileFile(name + ".pconf")
+		if test.message == "" {
+			assert.NoError(t, err, name)
+			continue
+		}
+		assert.Error(t, err, name)
+		assert.Contains(t, err.Error(), test.message, name)
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	files := map[string]string{
+		"src/port.proto": `syntax = "proto3";
+message Port { int32 number = 1; }
+`,
+		"src/port.proto-validator": `load("//port.proto", "Port")
+def validate_port(port, ctx):
+    validate.in_range(port, "number", 1, 65535)
+    if ctx.env == "prod" and port.number < 1024:
+        fail("privileged port %d in prod" % port.number)
+add_validator(Port, validate_port)
+`,
+		"src/port.ptest": `load("port.proto", "Port")
+def test_valid():
+    assert_valid(Port(number=80))
+def test_invalid():
+    assert_invalid(Port(number=0), contains="number: 0 is not in range [1, 65535]")
+def test_env():
+    assert_invalid(Port(number=80), env="prod", contains="privileged port 80 in prod")
+def test_wrong_expectation():
+    assert_valid(Port(number=70000))
+def test_wrong_message():
+    assert_invalid(Port(number=0), contains="too large")
+def test_passing_invalid():
+    assert_invalid(Port(number=8080))
+def helper():
+    assert_valid(Port())
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	results, err := c.RunTests("port.ptest")
+	assert.NoError(t, err)
+	var names []string
+	for _, result := range results {
+		names = append(names, result.Name)
+	}
+	assert.Equal(t, []string{"test_env", "test_invalid", "test_passing_invalid", "test_valid", "test_wrong_expectation", "test_wrong_message"}, names)
+	for _, result := range results {
+		switch result.Name {
+		case "test_env", "test_invalid", "test_valid":
+			assert.NoError(t, result.Err, result.Name)
+		case "test_wrong_expectation":
+			assert.EqualError(t, result.Err, "port.ptest:9:17: expected Port to be valid, got:\n  Port: validator validate_port (port.proto-validator:2:1) failed: port.proto-validator:3:22: number: 70000 is not in range [1, 65535]")
+		case "test_wrong_message":
+			assert.Contains(t, result.Err.Error(), `expected Port to be invalid with "too large", got:`)
+		case "test_passing_invalid":
+			assert.EqualError(t, result.Err, "port.ptest:13:19: expected Port to be invalid, but it passed validation")
+		}
+	}
+
+	_, err = c.RunTests("port.pconf")
+	assert.Error(t, err)
+}
+
+func TestValidationModes(t *testing.T) {
+	files := map[string]string{
+		"protoconf.yaml": "post_compile_hooks: [hook.star]\n",
+		"src/hook.star": `def fail_always(outputs):
+    fail("hook ran")
+add_hook(fail_always)
+`,
+		"src/port.proto": `syntax = "proto3";
+message Port { int32 number = 1; }
+`,
+		"src/port.proto-validator": `load("//port.proto", "Port")
+def validate_port(port):
+    validate.in_range(port, "number", 1, 65535)
+add_validator(Port, validate_port)
+`,
+		"src/valid.pconf": `load("port.proto", "Port")
+def main():
+    return Port(number=80)
+`,
+		"src/invalid.pconf": `load("port.proto", "Port")
+def main():
+    return Port(number=0)
+`,
+	}
+	root := newTestRoot(t, files)
+	materialized := func(c *Compiler, name string) bool {
+		_, err := os.Stat(filepath.Join(c.MaterializedDir, name+consts.CompiledConfigExtension))
+		return err == nil
+	}
+
+	// Validate only
+	c := newTestCompiler(root)
+	assert.NoError(t, c.DisableWriting())
+	assert.NoError(t, c.CompileFile("valid.pconf"))
+	assert.Error(t, c.CompileFile("invalid.pconf"))
+	assert.False(t, materialized(c, "valid"))
+	assert.Error(t, c.RunHooks())
+
+	// No validation
+	c = newTestCompiler(root)
+	c.DisableValidation()
+	assert.NoError(t, c.CompileFile("invalid.pconf"))
+	assert.True(t, materialized(c, "invalid"))
+	assert.NoError(t, c.RunHooks())
+}
+
+func TestStrictEnums(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+package acme;
+message Service {
+  enum Level { LOW = 0; MEDIUM = 5; HIGH = 10; }
+  Level level = 1;
+  repeated Level levels = 2;
+}
+`,
+		"src/legacy.proto": `syntax = "proto2";
+package acme;
+message Legacy {
+  enum Mode { OFF = 0; ON = 1; }
+  optional Mode mode = 1;
+}
+`,
+		"src/defined.pconf": `load("service.proto", "Service")
+def main():
+    return Service(level=5, levels=[0, Service.Level.HIGH])
+`,
+		"src/assigned.pconf": `load("service.proto", "Service")
+def main():
+    return Service(level=7)
+`,
+		"src/repeated.pconf": `load("service.proto", "Service")
+def main():
+    return Service(levels=[0, 8])
+`,
+		"src/decoded.pconf": `load("service.proto", "Service")
+def main():
+    service = proto.from_json(Service, '{"level": 2}')
+    if service.level != 2:
+        fail("expected the number, got %s" % service.level)
+    return service
+`,
+		"src/closed.pconf": `load("legacy.proto", "Legacy")
+def main():
+    return Legacy(mode=3)
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("defined.pconf"))
+	for file, message := range map[string]string{
+		"assigned.pconf": "ValueError: field acme.Service.level: 7 is not a value of enum acme.Service.Level, the nearest value is MEDIUM=5",
+		"repeated.pconf": "ValueError: field acme.Service.levels: 8 is not a value of enum acme.Service.Level, the nearest value is HIGH=10",
+		"decoded.pconf":  "decoded.materialized_JSON:\n  level: 2 is not a value of enum acme.Service.Level, the nearest value is LOW=0",
+		"closed.pconf":   "ValueError: field acme.Legacy.mode: 3 is not a value of enum acme.Legacy.Mode, the nearest value is ON=1",
+	} {
+		err := c.CompileFile(file)
+		assert.Error(t, err, file)
+		assert.Contains(t, err.Error(), message, file)
+	}
+
+	c = newTestCompiler(root)
+	c.AllowOpenEnums()
+	// The other compilers keep rejecting the numbers enums don't define
+	strict := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("assigned.pconf"))
+	assert.Error(t, strict.CompileFile("assigned.pconf"))
+	assert.NoError(t, c.CompileFile("repeated.pconf"))
+	assert.NoError(t, c.CompileFile("decoded.pconf"))
+	assert.Error(t, c.CompileFile("closed.pconf"))
+}
+
+func TestReferences(t *testing.T) {
+	files := map[string]string{
+		"src/routing.proto": `syntax = "proto3";
+message Cluster { string region = 1; }
+message Route { string prefix = 1; string cluster = 2; }
+message Routes { repeated Route routes = 1; }
+`,
+		"src/clusters.mpconf": `load("routing.proto", "Cluster")
+def main():
+    return {"eu-1": Cluster(region="eu"), "us-1": Cluster(region="us")}
+`,
+		"src/routes.pconf": `load("routing.proto", "Route", "Routes")
+def main():
+    return Routes(routes=[
+        Route(prefix="/api", cluster=ref("clusters", key="eu-1")),
+        Route(prefix="/web", cluster=ref("clusters", key="ap-1")),
+    ])
+`,
+		"src/default_route.pconf": `load("routing.proto", "Route")
+def main():
+    return Route(prefix="/", cluster=ref("/clusters/us-1").split("/")[-1])
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("routes.pconf"))
+	assert.NoError(t, c.CompileFile("default_route.pconf"))
+	err := c.CheckReferences()
+	assert.Error(t, err)
+	assert.Equal(t, "dangling references:\n  default_route.pconf:3:41: clusters/us-1 is not an output of any config\n  routes.pconf:4:41: clusters/eu-1 is not an output of any config\n  routes.pconf:5:41: clusters/ap-1 is not an output of any config", err.Error())
+
+	// Compiled outputs satisfy references, and so do materialized ones
+	assert.NoError(t, c.CompileFile("clusters.mpconf"))
+	err = c.CheckReferences()
+	assert.Error(t, err)
+	assert.Equal(t, "dangling references:\n  routes.pconf:5:41: clusters/ap-1 is not an output of any config", err.Error())
+	entries := c.Report().Entries()
+	assert.Len(t, entries, 4)
+	assert.Equal(t, "routes.pconf", entries[len(entries)-1].Config)
+	assert.Equal(t, "dangling references", entries[len(entries)-1].Kind)
+
+	c = newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("default_route.pconf"))
+	assert.NoError(t, c.CheckReferences())
+	raw, err := ioutil.ReadFile(filepath.Join(root, consts.CompiledConfigPath, "default_route"+consts.CompiledConfigExtension))
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"cluster": "us-1"`)
+
+	// References aren't checked without validation
+	c = newTestCompiler(root)
+	c.DisableValidation()
+	assert.NoError(t, c.CompileFile("routes.pconf"))
+	assert.NoError(t, c.CheckReferences())
+}
+
+func TestFieldRules(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+import "protoconf/validate.proto";
+message Backend {
+  string host = 1 [(protoconf.validate) = {required: true, pattern: "^[a-z.]+$"}];
+  int32 port = 2 [(protoconf.validate) = {min: 1, max: 65535}];
+}
+message Service {
+  string name = 1 [(protoconf.validate) = {required: true, max: 8}];
+  string id = 2 [(protoconf.validate) = {immutable: true}];
+  repeated Backend backends = 3 [(protoconf.validate) = {min: 1}];
+  map<string, Backend> regions = 4;
+  repeated string tags = 5 [(protoconf.validate) = {pattern: "^[a-z]+$"}];
+  optional double ratio = 6 [(protoconf.validate) = {min: 0, max: 1}];
+}
+`,
+		"src/service.pconf": `load("service.proto", "Backend", "Service")
+def main():
+    return Service(
+        name="api",
+        id="a1",
+        backends=[Backend(host="api.local", port=80)],
+        regions={"eu": Backend(host="eu.local", port=443)},
+    )
+`,
+		"src/invalid.pconf": `load("service.proto", "Backend", "Service")
+def main():
+    return Service(
+        name="a-very-long-name",
+        backends=[Backend(host="API", port=0)],
+        regions={"eu": Backend(port=70000)},
+        tags=["ok", "Not-OK"],
+        ratio=1.5,
+    )
+`,
+	}
+	root := newTestRoot(t, files)
+	srcDir := filepath.Join(root, consts.SrcPath)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("service.pconf"))
+	err := c.CompileFile("invalid.pconf")
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf(`validation errors in %s:
+  name: length 16 is greater than the maximum 8
+  tags[1]: "Not-OK" does not match "^[a-z]+$"
+  ratio: 1.5 is greater than the maximum 1
+  backends[0].host: "API" does not match "^[a-z.]+$"
+  backends[0].port: 0 is less than the minimum 1
+  regions["eu"].host: value is required
+  regions["eu"].port: 70000 is greater than the maximum 65535`, filepath.Join(root, consts.CompiledConfigPath, "invalid.materialized_JSON")), err.Error())
+
+	// Immutable fields can't change once materialized, but can be set once
+	immutable := func(id string) error {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, "service.pconf"), []byte(strings.Replace(files["src/service.pconf"], `id="a1"`, id, 1)), 0644))
+		return c.CompileFile("service.pconf")
+	}
+	err = immutable(`id="b2"`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "immutable field changes in ")
+	assert.Contains(t, err.Error(), `id: immutable field changed from "a1" to "b2"`)
+	assert.NoError(t, immutable(`id="a1"`))
+	assert.NoError(t, os.Remove(filepath.Join(root, consts.CompiledConfigPath, "service.materialized_JSON")))
+	assert.NoError(t, immutable(`id=""`))
+	assert.NoError(t, immutable(`id="c3"`))
+}
+
+func TestAuditDefaults(t *testing.T) {
+	files := map[string]string{
+		"protoconf.yaml": "defaults_allowlist: [acme.Service.retries, acme.Backend.*]\n",
+		"src/service.proto": `syntax = "proto3";
+package acme;
+import "google/protobuf/duration.proto";
+message Backend { string host = 1; int32 weight = 2; }
+message Service {
+  string name = 1;
+  int32 timeout = 2;
+  int32 retries = 3;
+  string owner = 4 [deprecated = true];
+  google.protobuf.Duration ttl = 5;
+  repeated Backend backends = 6;
+  oneof auth { string token = 7; string cert = 8; }
+  oneof mode { bool active = 9; bool passive = 10; }
+  optional bool debug = 11;
+  message Limits { int32 rps = 1; int32 burst = 2; }
+  map<string, Limits> limits = 12;
+}
+`,
+		"src/service.pconf": `load("service.proto", "Backend", "Service")
+load("google/protobuf/duration.proto", "Duration")
+def main():
+    return Service(
+        name="api",
+        ttl=Duration(seconds=5),
+        backends=[Backend()],
+        token="secret",
+        limits={"eu": Service.Limits(rps=10)},
+    )
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("service.pconf"))
+	assert.Empty(t, c.Report().Entries())
+
+	c = newTestCompiler(root)
+	c.AuditDefaults()
+	assert.NoError(t, c.CompileFile("service.pconf"))
+	var paths []string
+	for _, entry := range c.Report().Entries() {
+		assert.Equal(t, "fields left at their default value", entry.Kind)
+		assert.Equal(t, SeverityWarning, entry.Severity)
+		assert.Equal(t, "service.materialized_JSON", entry.Output)
+		paths = append(paths, entry.Message)
+	}
+	assert.Equal(t, []string{"timeout", "debug", `limits["eu"].burst`, "mode"}, paths)
+}
+
+func TestValidationCache(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Service { string name = 1; int32 port = 2; }
+`,
+		"src/limits.pinc": `MAX_PORT = 65535
+`,
+		"src/service.proto-validator": `load("//service.proto", "Service")
+load("//limits.pinc", "MAX_PORT")
+def validate_service(service):
+    print("validating " + service.name)
+    if service.port > MAX_PORT:
+        fail("port out of range")
+add_validator(Service, validate_service)
+`,
+		"src/services.mpconf": `load("service.proto", "Service")
+def main():
+    return {"api": Service(name="api", port=80), "web": Service(name="web", port=443)}
+`,
+	}
+	root := newTestRoot(t, files)
+	write := func(name string, content string) {
+		writeTestFile(t, root, name, content)
+	}
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	compile := func(env string) []string {
+		logs.Reset()
+		c := NewCompiler(root, false)
+		c.SetEnvironment(env)
+		assert.NoError(t, c.CompileFile("services.mpconf"))
+		var validated []string
+		for _, line := range strings.Split(logs.String(), "\n") {
+			if i := strings.Index(line, "validating "); i >= 0 {
+				validated = append(validated, line[i+len("validating "):])
+			}
+		}
+		return validated
+	}
+	assert.Equal(t, []string{"api", "web"}, compile(""))
+	assert.Empty(t, compile(""))
+
+	// Changed outputs are validated again
+	write("src/services.mpconf", strings.Replace(files["src/services.mpconf"], "port=80", "port=8080", 1))
+	assert.Equal(t, []string{"api"}, compile(""))
+	// And so are the outputs compiled for another environment
+	assert.Equal(t, []string{"api", "web"}, compile("prod"))
+
+	// Changing a module loaded by the validators invalidates the cache
+	write("src/limits.pinc", "MAX_PORT = 1024\n")
+	logs.Reset()
+	c := NewCompiler(root, false)
+	err := c.CompileFile("services.mpconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "port out of range")
+	assert.Contains(t, logs.String(), "validating api")
+	assert.Contains(t, logs.String(), "validating web")
+}
+
+func TestDependencies(t *testing.T) {
+	files := map[string]string{
+		"src/common/port.proto": `syntax = "proto3";
+message Port { int32 number = 1; }
+`,
+		"src/service.proto": `syntax = "proto3";
+import "common/port.proto";
+message Service { string name = 1; Port port = 2; }
+`,
+		"src/limits.pinc": `MAX_PORT = 65535
+`,
+		"src/service.proto-validator": `load("//service.proto", "Service")
+load("//limits.pinc", "MAX_PORT")
+def validate_service(service):
+    if service.port.number > MAX_PORT:
+        fail("port out of range")
+add_validator(Service, validate_service)
+`,
+		"src/ports.pinc": `load("//common/port.proto", "Port")
+HTTP = Port(number = 80)
+`,
+		"src/lib/services.pinc": `load("//ports.pinc", "HTTP")
+PORT = HTTP
+`,
+		"src/api.pconf": `load("service.proto", "Service")
+load("lib/services.pinc", "PORT")
+def main():
+    return Service(name="api", port=PORT)
+`,
+		"src/web.pconf": `load("common/port.proto", "Port")
+def main():
+    return Port(number=443)
+`,
+		"src/broken.pconf": `load("lib/missing.pinc", "PORT")
+def main():
+    return PORT
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := NewCompiler(root, false)
+	assert.NoError(t, c.CompileFile("api.pconf"))
+	assert.NoError(t, c.CompileFile("/web.pconf"))
+	assert.Error(t, c.CompileFile("broken.pconf"))
+	graph := c.Dependencies()
+	assert.Equal(t, []string{"api.pconf", "common/port.proto", "lib/services.pinc", "limits.pinc", "ports.pinc", "service.proto", "service.proto-validator"}, graph["api.pconf"])
+	assert.Equal(t, []string{"common/port.proto", "web.pconf"}, graph["web.pconf"])
+	// The configs which failed to load depend on the modules they loaded
+	assert.Equal(t, []string{"broken.pconf", "lib/missing.pinc"}, graph["broken.pconf"])
+
+	assert.Equal(t, []string{"api.pconf"}, graph.Affected([]string{"limits.pinc"}))
+	assert.Equal(t, []string{"api.pconf", "web.pconf"}, graph.Affected([]string{"common/port.proto"}))
+	assert.Equal(t, []string{"api.pconf", "broken.pconf"}, graph.Affected([]string{"ports.pinc", "lib/missing.pinc"}))
+	// The validators of the protos loaded affect the configs, even before
+	// they exist
+	assert.Equal(t, []string{"api.pconf", "web.pconf"}, graph.Affected([]string{"common/port.proto-validator"}))
+	assert.Empty(t, graph.Affected([]string{"other.pinc"}))
+
+	graph.Merge(DependencyGraph{"web.pconf": {"web.pconf"}})
+	assert.Equal(t, []string{"api.pconf"}, graph.Affected([]string{"common/port.proto"}))
+}
+
+func TestParallelValidation(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Service { string name = 1; int32 port = 2; }
+`,
+		"src/service.proto-validator": `load("//service.proto", "Service")
+def validate_service(service):
+    if service.port % 7 == 0:
+        fail("port %d is a multiple of 7" % service.port)
+    if service.port % 5 == 0:
+        warn("port %d is a multiple of 5" % service.port)
+add_validator(Service, validate_service)
+`,
+		"src/services.mpconf": `load("service.proto", "Service")
+def main():
+    return {"service" + ("0" if i < 10 else "") + str(i): Service(name="s%d" % i, port=i) for i in range(1, 50)}
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	err := c.CompileFile("services.mpconf")
+	assert.Error(t, err)
+	var expected []string
+	for i := 7; i < 50; i += 7 {
+		expected = append(expected, fmt.Sprintf("validation errors in %s:\n  Service: validator validate_service (service.proto-validator:2:1) failed: [service.proto-validator:4:13] port %d is a multiple of 7\nTraceback (most recent call last):\n  service.proto-validator:4:13: in validate_service\n",
+			filepath.Join(root, consts.CompiledConfigPath, "services", fmt.Sprintf("service%02d", i)+consts.CompiledConfigExtension), i))
+	}
+	assert.Equal(t, strings.Join(expected, "\n"), err.Error())
+
+	var warnings []string
+	for _, entry := range c.Report().Entries() {
+		if entry.Severity == SeverityWarning {
+			warnings = append(warnings, entry.Output+": "+entry.Message)
+		}
+	}
+	// 35 fails before warning
+	assert.Len(t, warnings, 8)
+	assert.Equal(t, "services/service05.materialized_JSON: service.proto-validator:6:13: port 5 is a multiple of 5", warnings[0])
+	assert.Equal(t, "services/service45.materialized_JSON: service.proto-validator:6:13: port 45 is a multiple of 5", warnings[7])
+}
+
+func TestOutputValidators(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Service { int32 port = 1; }
+`,
+		"src/naming.pinc": `REGIONS = ["eu", "us"]
+def check_region_suffix(outputs):
+    for key in outputs:
+        if key.split("-")[-1] not in REGIONS:
+            fail("%s doesn't end with a region" % key)
+def check_count(outputs):
+    if len(outputs) > 2:
+        fail("%d outputs, at most 2 are allowed" % len(outputs))
+add_output_validator(check_region_suffix)
+add_output_validator(check_count)
+`,
+		"src/valid.mpconf": `load("service.proto", "Service")
+load("naming.pinc", "check_count")
+add_output_validator(check_count)
+def main():
+    return {"api-eu": Service(port=80), "api-us": Service(port=80)}
+`,
+		"src/invalid.mpconf": `load("service.proto", "Service")
+load("naming.pinc", "REGIONS")
+def main():
+    return {"api-eu": Service(port=80), "api-ap": Service(port=80), "web-us": Service(port=80)}
+def validate_outputs(outputs):
+    pass
+`,
+		"src/single.pconf": `load("service.proto", "Service")
+load("naming.pinc", "REGIONS")
+def main():
+    return Service(port=80)
+`,
+		"src/not_a_validator.mpconf": `add_output_validator(lambda: None)
+def main():
+    return {}
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("valid.mpconf"))
+
+	err := c.CompileFile("invalid.mpconf")
+	assert.Error(t, err)
+	assert.Equal(t, `output validation errors in invalid.mpconf:
+  output validator check_region_suffix (naming.pinc:2:1) failed: [naming.pinc:5:17] api-ap doesn't end with a region
+Traceback (most recent call last):
+  naming.pinc:5:17: in check_region_suffix
+
+  output validator check_count (naming.pinc:6:1) failed: [naming.pinc:8:13] 3 outputs, at most 2 are allowed
+Traceback (most recent call last):
+  naming.pinc:8:13: in check_count
+`, err.Error())
+	_, err = os.Stat(filepath.Join(c.MaterializedDir, "invalid", "api-eu"+consts.CompiledConfigExtension))
+	assert.True(t, os.IsNotExist(err))
+
+	err = c.CompileFile("single.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "naming.pinc:9:1: undefined: add_output_validator")
+
+	err = c.CompileFile("not_a_validator.mpconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected a function that get 1 param, got=0")
+}
+
+func TestValidationFieldPaths(t *testing.T) {
+	files := map[string]string{
+		"src/lb.proto": `syntax = "proto3";
+message Timeout { int32 seconds = 1; }
+message Upstream { Timeout timeout = 1; }
+message Cluster { Upstream upstream = 1; repeated Upstream fallbacks = 2; }
+message LoadBalancer { map<string, Cluster> clusters = 1; Timeout timeout = 2; }
+`,
+		"src/lb.proto-validator": `load("//lb.proto", "Timeout")
+def validate_timeout(timeout):
+    if timeout.seconds <= 0:
+        fail("timeout must be positive")
+add_validator(Timeout, validate_timeout)
+`,
+		"src/lb.pconf": `load("lb.proto", "Cluster", "LoadBalancer", "Timeout", "Upstream")
+def main():
+    return LoadBalancer(
+        clusters={
+            "web": Cluster(
+                upstream=Upstream(timeout=Timeout(seconds=0)),
+                fallbacks=[Upstream(timeout=Timeout(seconds=5)), Upstream(timeout=Timeout(seconds=-1))],
+            ),
+        },
+        timeout=Timeout(seconds=0),
+    )
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	err := c.CompileFile("lb.pconf")
+	assert.Error(t, err)
+	var failures []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if strings.Contains(line, "validator validate_timeout") {
+			failures = append(failures, strings.TrimSpace(strings.SplitN(line, " (", 2)[0]))
+		}
+	}
+	assert.Equal(t, []string{
+		`clusters["web"].upstream.timeout: Timeout: validator validate_timeout`,
+		`clusters["web"].fallbacks[1].timeout: Timeout: validator validate_timeout`,
+		`timeout: Timeout: validator validate_timeout`,
+	}, failures)
+}
+
+func TestValidateValue(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+import "protoconf/validate.proto";
+message Service {
+  string id = 1 [(protoconf.validate) = {immutable: true}];
+  int32 port = 2;
+}
+`,
+		"src/service.proto-validator": `load("//service.proto", "Service")
+def validate_port(service):
+    if service.port <= 0:
+        fail("port %d must be positive" % service.port)
+add_validator(Service, validate_port)
+`,
+		"mutable_config/service.materialized_JSON": `{"protoFile": "service.proto", "value": {"@type": "type.googleapis.com/Service", "id": "a1", "port": 80}}`,
+	}
+	for name, port := range map[string]string{"valid": "8080", "invalid": "-1"} {
+		files["materialized_config/"+name+consts.CompiledConfigExtension] = fmt.Sprintf(`{"protoFile": "service.proto", "value": {"@type": "type.googleapis.com/Service", "id": "b2", "port": %s}}`, port)
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	valid, err := utils.ReadConfig(root, "valid")
+	assert.NoError(t, err)
+	assert.NoError(t, c.ValidateValue(valid, filepath.Join(root, consts.MutableConfigPath, "new"+consts.CompiledConfigExtension)))
+
+	invalid, err := utils.ReadConfig(root, "invalid")
+	assert.NoError(t, err)
+	err = c.ValidateValue(invalid, filepath.Join(root, consts.MutableConfigPath, "new"+consts.CompiledConfigExtension))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Service: validator validate_port (service.proto-validator:2:1) failed: [service.proto-validator:4:13] port -1 must be positive")
+
+	// The immutable fields are compared with the value being replaced
+	err = c.ValidateValue(valid, filepath.Join(root, consts.MutableConfigPath, "service"+consts.CompiledConfigExtension))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `id: immutable field changed from "a1" to "b2"`)
+
+	c.DisableValidation()
+	assert.NoError(t, c.ValidateValue(invalid, ""))
+}
+
+func TestOutputValidationCache(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Service { string name = 1; int32 port = 2; }
+`,
+		"src/service.proto-validator": `load("//service.proto", "Service")
+def validate_service(service):
+    print("validating " + service.name)
+add_validator(Service, validate_service)
+`,
+		"src/ports.pinc": `def check_ports(outputs):
+    print("validating outputs")
+    ports = [service.port for service in outputs.values()]
+    if len(ports) != len(set(ports)):
+        fail("ports must be unique")
+`,
+		"src/services.mpconf": `load("service.proto", "Service")
+load("ports.pinc", "check_ports")
+add_output_validator(check_ports)
+def main():
+    return {"api": Service(name="api", port=80), "web": Service(name="web", port=443)}
+`,
+	}
+	root := newTestRoot(t, files)
+	write := func(name string, content string) {
+		writeTestFile(t, root, name, content)
+	}
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	compile := func() ([]string, error) {
+		logs.Reset()
+		err := NewCompiler(root, false).CompileFile("services.mpconf")
+		var validated []string
+		for _, line := range strings.Split(logs.String(), "\n") {
+			if i := strings.Index(line, "validating "); i >= 0 {
+				validated = append(validated, line[i+len("validating "):])
+			}
+		}
+		return validated, err
+	}
+	validated, err := compile()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outputs", "api", "web"}, validated)
+	validated, err = compile()
+	assert.NoError(t, err)
+	assert.Empty(t, validated)
+
+	// Changing an output runs the output validators again, along with the
+	// validators of the output which changed only
+	write("src/services.mpconf", strings.Replace(files["src/services.mpconf"], "port=80", "port=8080", 1))
+	validated, err = compile()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outputs", "api"}, validated)
+
+	// And so does changing a module the config loads
+	write("src/ports.pinc", files["src/ports.pinc"]+"\n")
+	validated, err = compile()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outputs"}, validated)
+
+	// Failing output validators run until they pass
+	write("src/services.mpconf", strings.Replace(files["src/services.mpconf"], "port=443", "port=80", 1))
+	for i := 0; i < 2; i++ {
+		validated, err = compile()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "ports must be unique")
+		assert.Contains(t, validated, "outputs")
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	files := map[string]string{
+		consts.WorkspaceConfigFile: "policy_bundle: policies\n",
+		"src/service.proto": `syntax = "proto3";
+message Service { string name = 1; int32 port = 2; }
+`,
+		"src/services.mpconf": `load("service.proto", "Service")
+def main():
+    return {"api": Service(name="api", port=80), "ssh": Service(name="ssh", port=22)}
+`,
+		"src/api.pconf": `load("service.proto", "Service")
+def main():
+    return Service(name="api", port=80)
+`,
+		// opa stands for the opa CLI, denying the outputs with port 22
+		"opa": `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+input=$(cat)
+case "$input" in
+*'"port":22'*)
+    echo "$input" > "$(dirname "$0")/input"
+    echo '{"result": [{"expressions": [{"value": ["port 22 is not allowed", {"msg": "ssh must not be exposed"}], "text": "data.protoconf.deny"}]}]}' ;;
+*)
+    echo '{"result": [{"expressions": [{"value": [], "text": "data.protoconf.deny"}]}]}' ;;
+esac
+`,
+	}
+	root := newTestRoot(t, files)
+	// opa is a script standing for the binary
+	assert.NoError(t, os.Chmod(filepath.Join(root, "opa"), 0755))
+
+	c := newTestCompiler(root)
+	c.opaBinary = filepath.Join(root, "opa")
+	c.SetEnvironment("prod")
+	assert.NoError(t, c.CompileFile("api.pconf"))
+	args, err := ioutil.ReadFile(filepath.Join(root, "args"))
+	assert.NoError(t, err)
+	assert.Equal(t, "eval --format json --bundle "+filepath.Join(root, "policies")+" --stdin-input data.protoconf.deny\n", string(args))
+
+	err = c.CompileFile("services.mpconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "policy violations in "+filepath.Join(c.MaterializedDir, "services", "ssh"+consts.CompiledConfigExtension)+":\n  port 22 is not allowed\n  ssh must not be exposed")
+	assert.NotContains(t, err.Error(), "api"+consts.CompiledConfigExtension)
+	input, err := ioutil.ReadFile(filepath.Join(root, "input"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"config":"services.mpconf","output":"ssh","env":"prod","type":"Service","value":{"name":"ssh","port":22}}`+"\n", string(input))
+
+	// Failing to evaluate the policies fails the compile
+	c.SetPolicyBundle(filepath.Join(root, "other"))
+	c.opaBinary = filepath.Join(root, "missing")
+	err = c.CompileFile("api.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error evaluating policies of "+filepath.Join(root, "other"))
+}
+
+// pgvProto is a subset of validate/validate.proto of protoc-gen-validate
+const pgvProto = `syntax = "proto2";
+package validate;
+import "google/protobuf/descriptor.proto";
+import "google/protobuf/duration.proto";
+extend google.protobuf.MessageOptions { optional bool disabled = 1071; }
+extend google.protobuf.OneofOptions { optional bool required = 1071; }
+extend google.protobuf.FieldOptions { optional FieldRules rules = 1071; }
+message FieldRules {
+  optional MessageRules message = 17;
+  oneof type {
+    Int32Rules int32 = 3;
+    UInt64Rules uint64 = 6;
+    StringRules string = 14;
+    EnumRules enum = 16;
+    RepeatedRules repeated = 18;
+    MapRules map = 19;
+    DurationRules duration = 21;
+  }
+}
+message Int32Rules {
+  optional int32 const = 1;
+  optional int32 lt = 2;
+  optional int32 lte = 3;
+  optional int32 gt = 4;
+  optional int32 gte = 5;
+  repeated int32 in = 6;
+  repeated int32 not_in = 7;
+  optional bool ignore_empty = 8;
+}
+message UInt64Rules { optional uint64 lt = 2; optional uint64 gt = 4; }
+message StringRules {
+  optional uint64 min_len = 2;
+  optional string pattern = 6;
+  optional string prefix = 7;
+  oneof well_known { bool email = 12; bool hostname = 13; bool uuid = 22; }
+}
+message EnumRules { optional bool defined_only = 2; repeated int32 not_in = 4; }
+message MessageRules { optional bool skip = 1; optional bool required = 2; }
+message RepeatedRules {
+  optional uint64 min_items = 1;
+  optional bool unique = 3;
+  optional FieldRules items = 4;
+}
+message MapRules { optional uint64 max_pairs = 2; optional FieldRules keys = 4; optional FieldRules values = 5; }
+message DurationRules { optional bool required = 1; optional google.protobuf.Duration lte = 4; }
+`
+
+func TestPGVRules(t *testing.T) {
+	files := map[string]string{
+		"src/validate/validate.proto": pgvProto,
+		"src/service.proto": `syntax = "proto3";
+import "google/protobuf/duration.proto";
+import "validate/validate.proto";
+message Backend { string host = 1 [(validate.rules).string.hostname = true]; }
+message Legacy {
+  option (validate.disabled) = true;
+  int32 port = 1 [(validate.rules).int32.gt = 0];
+}
+message Service {
+  enum Tier { TIER_UNSPECIFIED = 0; GOLD = 1; }
+  string name = 1 [(validate.rules).string = {min_len: 1, pattern: "^[a-z-]+$"}];
+  int32 port = 2 [(validate.rules).int32 = {gt: 0, lte: 65535}];
+  int32 weight = 3 [(validate.rules).int32 = {gte: 1, lt: 100, ignore_empty: true}];
+  string owner = 4 [(validate.rules).string.email = true];
+  repeated string tags = 5 [(validate.rules).repeated = {min_items: 1, unique: true, items: {string: {prefix: "t-"}}}];
+  map<string, Backend> backends = 6 [(validate.rules).map = {max_pairs: 2, keys: {string: {min_len: 2}}}];
+  Backend primary = 7 [(validate.rules).message.required = true];
+  Backend unchecked = 8 [(validate.rules).message.skip = true];
+  google.protobuf.Duration timeout = 9 [(validate.rules).duration = {required: true, lte: {seconds: 30}}];
+  Tier tier = 10 [(validate.rules).enum = {defined_only: true, not_in: [0]}];
+  Legacy legacy = 11;
+  oneof target {
+    option (validate.required) = true;
+    string url = 12;
+    string path = 13;
+  }
+}
+`,
+		"src/service.star": `load("//service.proto", "Backend", "Service")
+def service(**kwargs):
+    fields = dict(
+        name="api",
+        port=443,
+        owner="infra@example.com",
+        tags=["t-a", "t-b"],
+        backends={"eu": Backend(host="eu.example.com")},
+        primary=Backend(host="example.com"),
+        unchecked=Backend(host="not a host"),
+        timeout=proto.from_json(protos.google.protobuf.Duration, '"5s"'),
+        tier=Service.Tier.GOLD,
+        path="/",
+    )
+    fields.update(kwargs)
+    for key in [k for k in fields if fields[k] == None]:
+        fields.pop(key)
+    return Service(**fields)
+`,
+	}
+	cases := map[string]string{
+		"valid":                   "",
+		"name=\"\"":               `invalid Service.name: value length must be at least 1 runes`,
+		"name=\"A\"":              `invalid Service.name: value does not match regex pattern "^[a-z-]+$"`,
+		"port=0":                  `invalid Service.port: value must be inside range (0, 65535]`,
+		"port=70000":              `invalid Service.port: value must be inside range (0, 65535]`,
+		"weight=100":              `invalid Service.weight: value must be inside range [1, 100)`,
+		"owner=\"x@\"":            `invalid Service.owner: value must be a valid email address`,
+		"tags=[]":                 `invalid Service.tags: value must contain at least 1 item(s)`,
+		"tags=[\"t-a\", \"t-a\"]": `invalid Service.tags[1]: repeated value must contain unique items`,
+		"tags=[\"a\"]":            `invalid Service.tags[0]: value does not have prefix "t-"`,
+		"backends={\"e\": Backend(host=\"a.b\")}": `invalid Service.backends["e"]: value length must be at least 2 runes`,
+		"backends={\"eu\": Backend(host=\"-a\")}": `backends["eu"]: invalid Backend.host: value must be a valid hostname`,
+		"primary=None": `invalid Service.primary: value is required`,
+		"timeout=None": `invalid Service.timeout: value is required`,
+		"timeout=proto.from_json(protos.google.protobuf.Duration, '\"31s\"')": `invalid Service.timeout: value must be less than or equal to 30s`,
+		"tier=Service.Tier.TIER_UNSPECIFIED":                                  `invalid Service.tier: value must not be in list [0]`,
+		"path=None":                                                           `invalid Service.target: value is required`,
+		"legacy=Legacy(port=-1)":                                              "",
+	}
+	i := 0
+	names := map[string]string{}
+	for fields, expected := range cases {
+		i++
+		name := fmt.Sprintf("case%d.pconf", i)
+		names[name] = expected
+		if fields == "valid" {
+			fields = ""
+		}
+		files["src/"+name] = fmt.Sprintf(`load("service.star", "service")
+load("service.proto", "Backend", "Legacy", "Service")
+def main():
+    return service(%s)
+`, fields)
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	for name, expected := range names {
+		err := c.CompileFile(name)
+		if expected == "" {
+			assert.NoError(t, err, name)
+			continue
+		}
+		assert.Error(t, err, name)
+		assert.Contains(t, err.Error(), expected, name)
+	}
+}
+
+// protovalidateProto is a subset of buf/validate/validate.proto of
+// protovalidate
+const protovalidateProto = `syntax = "proto2";
+package buf.validate;
+import "google/protobuf/descriptor.proto";
+import "google/protobuf/duration.proto";
+extend google.protobuf.MessageOptions { optional MessageRules message = 1159; }
+extend google.protobuf.OneofOptions { optional OneofRules oneof = 1159; }
+extend google.protobuf.FieldOptions {
+  optional FieldRules field = 1159;
+  optional PredefinedRules predefined = 1160;
+}
+message Rule { optional string id = 1; optional string message = 2; optional string expression = 3; }
+message MessageRules { repeated Rule cel = 3; repeated MessageOneofRule oneof = 4; }
+message MessageOneofRule { repeated string fields = 1; optional bool required = 2; }
+message OneofRules { optional bool required = 1; }
+message PredefinedRules { repeated Rule cel = 1; }
+enum Ignore { IGNORE_UNSPECIFIED = 0; IGNORE_IF_ZERO_VALUE = 1; IGNORE_ALWAYS = 3; }
+message FieldRules {
+  repeated Rule cel = 23;
+  optional bool required = 25;
+  optional Ignore ignore = 27;
+  oneof type {
+    Int32Rules int32 = 3;
+    StringRules string = 14;
+    RepeatedRules repeated = 18;
+    MapRules map = 19;
+    DurationRules duration = 21;
+  }
+}
+message Int32Rules {
+  optional int32 lt = 2 [(predefined).cel = {
+    id: "int32.lt"
+    expression: "!has(rules.gt) && this >= rules.lt ? 'value must be less than %s'.format([rules.lt]) : ''"
+  }];
+  optional int32 gt = 4 [
+    (predefined).cel = {
+      id: "int32.gt"
+      expression: "!has(rules.lt) && this <= rules.gt ? 'value must be greater than %s'.format([rules.gt]) : ''"
+    },
+    (predefined).cel = {
+      id: "int32.gt_lt"
+      expression: "has(rules.lt) && (this >= rules.lt || this <= rules.gt) ? 'value must be greater than %s and less than %s'.format([rules.gt, rules.lt]) : ''"
+    }
+  ];
+  extensions 1000 to 2000;
+}
+message StringRules {
+  optional uint64 min_len = 2 [(predefined).cel = {
+    id: "string.min_len"
+    expression: "uint(this.size()) < rules.min_len ? 'value length must be at least %s characters'.format([rules.min_len]) : ''"
+  }];
+  optional bool email = 12 [(predefined).cel = {
+    id: "string.email"
+    expression: "!rules.email || this.isEmail() ? '' : 'value must be a valid email address'"
+  }];
+}
+message RepeatedRules {
+  optional uint64 min_items = 1 [(predefined).cel = {
+    id: "repeated.min_items"
+    expression: "uint(size(this)) < rules.min_items ? 'value must contain at least %d item(s)'.format([rules.min_items]) : ''"
+  }];
+  optional bool unique = 3 [(predefined).cel = {
+    id: "repeated.unique"
+    message: "repeated value must contain unique items"
+    expression: "!rules.unique || this.unique()"
+  }];
+  optional FieldRules items = 4;
+}
+message MapRules {
+  optional uint64 max_pairs = 2 [(predefined).cel = {
+    id: "map.max_pairs"
+    expression: "uint(size(this)) > rules.max_pairs ? 'map must be at most %d entries'.format([rules.max_pairs]) : ''"
+  }];
+  optional FieldRules keys = 4;
+  optional FieldRules values = 5;
+}
+message DurationRules {
+  optional google.protobuf.Duration lte = 4 [(predefined).cel = {
+    id: "duration.lte"
+    expression: "this > rules.lte ? 'value must be less than or equal to %s'.format([rules.lte]) : ''"
+  }];
+}
+`
+
+func TestProtovalidateConstraints(t *testing.T) {
+	files := map[string]string{
+		"src/buf/validate/validate.proto": protovalidateProto,
+		"src/rules.proto": `syntax = "proto2";
+package acme;
+import "buf/validate/validate.proto";
+extend buf.validate.Int32Rules {
+  optional bool even = 1161 [(buf.validate.predefined).cel = {
+    id: "int32.even"
+    message: "value must be even"
+    expression: "!rule || this % 2 == 0"
+  }];
+}
+`,
+		"src/service.proto": `syntax = "proto3";
+package acme;
+import "buf/validate/validate.proto";
+import "google/protobuf/duration.proto";
+import "rules.proto";
+message Backend { string host = 1 [(buf.validate.field).string.min_len = 3]; }
+message Service {
+  option (buf.validate.message).cel = {
+    id: "service.ports"
+    message: "admin_port must differ from port"
+    expression: "this.admin_port != this.port"
+  };
+  option (buf.validate.message).oneof = {fields: ["url", "path"], required: true};
+  string name = 1 [(buf.validate.field).string.min_len = 1];
+  int32 port = 2 [(buf.validate.field).int32 = {gt: 0, lt: 65536}];
+  int32 admin_port = 3 [(buf.validate.field).int32.(acme.even) = true];
+  string owner = 4 [(buf.validate.field).string.email = true, (buf.validate.field).ignore = IGNORE_IF_ZERO_VALUE];
+  repeated string tags = 5 [(buf.validate.field).repeated = {min_items: 1, unique: true, items: {string: {min_len: 2}}}];
+  map<string, Backend> backends = 6 [(buf.validate.field).map = {max_pairs: 2, keys: {string: {min_len: 2}}}];
+  Backend primary = 7 [(buf.validate.field).required = true];
+  google.protobuf.Duration timeout = 8 [(buf.validate.field).duration.lte = {seconds: 30}];
+  string url = 9;
+  string path = 10;
+  string notes = 11 [(buf.validate.field).cel = {
+    id: "notes.lowercase"
+    message: "notes must be lowercase"
+    expression: "this == this.lowerAscii()"
+  }];
+  oneof region {
+    option (buf.validate.oneof).required = true;
+    string zone = 12;
+    string area = 13;
+  }
+}
+`,
+		"src/valid.pconf": `load("service.proto", "Backend", "Service")
+def main():
+    return Service(
+        name="api",
+        port=443,
+        admin_port=8080,
+        tags=["ab", "cd"],
+        backends={"eu": Backend(host="eu.example.com")},
+        primary=Backend(host="primary.example.com"),
+        timeout=proto.from_json(protos.google.protobuf.Duration, '"5s"'),
+        path="/",
+        zone="eu-west-1a",
+    )
+`,
+		"src/invalid.pconf": `load("service.proto", "Backend", "Service")
+def main():
+    return Service(
+        port=70000,
+        admin_port=7,
+        owner="x@",
+        tags=["ab", "ab", "c"],
+        backends={"e": Backend(host="ab")},
+        timeout=proto.from_json(protos.google.protobuf.Duration, '"31s"'),
+        url="https://example.com",
+        path="/",
+        notes="Hi",
+    )
+`,
+		"src/ports.pconf": `load("service.proto", "Backend", "Service")
+def main():
+    return Service(
+        name="api",
+        port=8080,
+        admin_port=8080,
+        tags=["ab"],
+        primary=Backend(host="primary.example.com"),
+        path="/",
+        area="eu",
+    )
+`,
+	}
+	root := newTestRoot(t, files)
+
+	c := newTestCompiler(root)
+	assert.NoError(t, c.CompileFile("valid.pconf"))
+
+	err := c.CompileFile("invalid.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid.materialized_JSON:
+  only one of url, path can be set [message.oneof]
+  admin_port: value must be even [int32.even]
+  backends["e"]: value length must be at least 2 characters [string.min_len]
+  backends["e"].host: value length must be at least 3 characters [string.min_len]
+  name: value length must be at least 1 characters [string.min_len]
+  notes: notes must be lowercase [notes.lowercase]
+  owner: value must be a valid email address [string.email]
+  port: value must be greater than 0 and less than 65536 [int32.gt_lt]
+  primary: value is required [required]
+  region: exactly one field is required in oneof [required]
+  tags: repeated value must contain unique items [repeated.unique]
+  tags[2]: value length must be at least 2 characters [string.min_len]
+  timeout: value must be less than or equal to 30s [duration.lte]`)
+
+	err = c.CompileFile("ports.pconf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ports.materialized_JSON:\n  admin_port must differ from port [service.ports]")
+}
+
+func TestCompileSpans(t *testing.T) {
+	files := map[string]string{
+		"src/service.proto": `syntax = "proto3";
+message Service { string name = 1; }
+`,
+		"src/service.proto-validator": `load("service.proto", "Service")
+def check_name(s):
+    if not s.name:
+        fail("name is required")
+add_validator(Service, check_name)
+`,
+		"src/service.pconf": `load("service.proto", "Service")
+def main():
+    return Service(name="api")
+`,
+		"src/invalid.pconf": `load("service.proto", "Service")
+def main():
+    return Service()
+`,
+	}
+	root := newTestRoot(t, files)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	c := newTestCompiler(root)
+	ctx, rootSpan := provider.Tracer("test").Start(context.Background(), "test")
+	assert.NoError(t, c.CompileFileContext(ctx, "service.pconf"))
+	rootSpan.End()
+
+	parents := make(map[string]string)
+	for _, span := range recorder.Ended() {
+		parent := ""
+		for _, other := range recorder.Ended() {
+			if other.SpanContext().SpanID() == span.Parent().SpanID() {
+				parent = other.Name()
+			}
+		}
+		parents[span.Name()] = parent
+		if span.Name() == "compile" {
+			assert.Contains(t, span.Attributes(), tracing.ConfigKey.String("service.pconf"))
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"test":         "",
+		"compile":      "test",
+		"load":         "compile",
+		"parse protos": "load",
+		"eval":         "compile",
+		"validate":     "compile",
+		"write":        "compile",
+	}, parents)
+
+	assert.Error(t, c.CompileFile("invalid.pconf"))
+	spans := recorder.Ended()
+	failed := spans[len(spans)-1]
+	assert.Equal(t, "compile", failed.Name())
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	assert.Contains(t, failed.Status().Description, "name is required")
 }
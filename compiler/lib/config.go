@@ -2,18 +2,66 @@ package lib
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
-	pbproto "github.com/golang/protobuf/proto"
-	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/protoconf/protoconf/compiler/proto"
 	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 type config struct {
-	filename   string
-	locals     starlark.StringDict
-	validators map[string]*starlark.Function
+	filename string
+	locals   starlark.StringDict
+	// validators are the validators of each message type, in the order they
+	// were added
+	validators map[string][]*starlark.Function
+	// outputValidators are the validators of the dict returned by a `.mpconf',
+	// in the order they were added
+	outputValidators []*starlark.Function
+	// anyResolver resolves the types of the protos loaded by the config
+	anyResolver *protoregistry.Types
+	// protoFiles are the descriptors of the protos loaded by the config
+	protoFiles []protoreflect.FileDescriptor
+	// constraints checks the protovalidate constraints of the config, it's
+	// created on first use
+	constraints     *constraintChecker
+	constraintsLock sync.Mutex
+	// customOptions caches the custom options of descriptors
+	customOptions     map[optionKey]protoreflect.Value
+	customOptionsLock sync.Mutex
+	// unusedLoads describes the symbols the config and its modules load but never use
+	unusedLoads []string
+	// prototypes are the message defaults registered by the config and its modules
+	prototypes *proto.Prototypes
+	// warnings are raised while evaluating the config, e.g. by setting deprecated fields
+	warnings *proto.Warnings
+	// options are the options of the compilation the messages of the config
+	// follow
+	options *proto.Options
+	// references are the outputs of other configs the config refers to
+	references *references
+	// validatorsHash is the hash of the validator files and the modules they
+	// load, part of the keys of cached validation results
+	validatorsHash string
+	// configHash is the hash of the config and the modules it loads, which
+	// define its output validators
+	configHash string
+}
+
+func (c *config) newThread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Print: starPrint,
+	}
+	c.prototypes.AttachTo(thread)
+	c.warnings.AttachTo(thread)
+	c.options.AttachTo(thread)
+	c.references.AttachTo(thread)
+	return thread
 }
 
 func (c *config) main() (starlark.Value, error) {
@@ -26,74 +74,275 @@ func (c *config) main() (starlark.Value, error) {
 		return nil, fmt.Errorf("`main' must be a function (got a %s)", mainVal.Type())
 	}
 
-	thread := &starlark.Thread{
-		Print: starPrint,
-	}
+	thread := c.newThread()
 
 	mainVal, err := starlark.Call(thread, main, nil, nil)
 	if err != nil {
-		return nil, err
+		return nil, withPosition(err)
 	}
 	return mainVal, nil
 }
 
-func (c *config) validate(value interface{}) error {
-	message, ok := value.(*dynamic.Message)
+// withPosition prefixes a Starlark evaluation error with the source position
+// of the innermost Starlark frame it was raised from
+func withPosition(err error) error {
+	evalErr, ok := err.(*starlark.EvalError)
 	if !ok {
-		if _, ok := value.(pbproto.Message); ok {
-			return nil
+		return err
+	}
+	for i := 0; i < len(evalErr.CallStack); i++ {
+		pos := evalErr.CallStack.At(i).Pos
+		if pos.IsValid() && pos.Filename() != "<builtin>" {
+			// fail() already starts its message with the position
+			if strings.HasPrefix(evalErr.Msg, fmt.Sprintf("[%s]", pos)) {
+				return err
+			}
+			return fmt.Errorf("%s: %s", pos, evalErr.Msg)
 		}
-		return fmt.Errorf("expecting a proto message to validate, got=%v", value)
 	}
+	return err
+}
 
-	if message == nil {
-		return nil
+// validateOutputs runs the `validate_outputs' function of a `.mpconf', if it
+// defines one, and the output validators registered with
+// `add_output_validator' on the dict returned by `main', to check invariants
+// across its outputs and their keys. The dict is frozen first, and every
+// validator runs even when another fails.
+func (c *config) validateOutputs(outputs *starlark.Dict) ([]string, error) {
+	var failures []string
+	outputs.Freeze()
+	if value, ok := c.locals["validate_outputs"]; ok {
+		validator, ok := value.(*starlark.Function)
+		if !ok || validator.NumParams() != 1 {
+			return nil, fmt.Errorf("`validate_outputs' must be a function that gets 1 param, got: %s", value)
+		}
+		if _, err := starlark.Call(c.newThread(), validator, starlark.Tuple{outputs}, nil); err != nil {
+			failures = append(failures, fmt.Sprintf("validate_outputs (%s) failed: %v", validator.Position(), withPosition(err)))
+		}
+	}
+	for _, validator := range c.outputValidators {
+		if _, err := starlark.Call(c.newThread(), validator, starlark.Tuple{outputs}, nil); err != nil {
+			failures = append(failures, fmt.Sprintf("output validator %s (%s) failed: %v", validator.Name(), validator.Position(), withPosition(err)))
+		}
+	}
+	return failures, nil
+}
+
+// validation holds the state of validating an output
+type validation struct {
+	// output is the key of the output in the dict returned by a `.mpconf',
+	// empty for a `.pconf'
+	output string
+	// env is the environment the config is compiled for
+	env      string
+	failures []string
+	// warnings are raised by the validators calling warn()
+	warnings []string
+}
+
+// validationLocal is the thread local holding the validation a validator runs
+// in, which collects the warnings it raises
+const validationLocal = "protoconf.validation"
+
+// validate runs the validators of message and of the messages nested in it,
+// and checks their `protoconf.validate' and PGV rules, returning every failure
+func (c *config) validate(message protoreflect.Message, output string, env string) ([]string, error) {
+	v, err := c.runValidation(message, output, env)
+	if err != nil {
+		return nil, err
 	}
+	return v.failures, nil
+}
+
+// runValidation validates message as validate does, returning the failures
+// along with the warnings raised by validators. The outputs of a config may
+// be validated concurrently.
+func (c *config) runValidation(message protoreflect.Message, output string, env string) (*validation, error) {
+	v := &validation{output: output, env: env}
+	if err := c.validateMessage(message, "", true, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
 
-	if validator, ok := c.validators[message.GetMessageDescriptor().GetFullyQualifiedName()]; ok {
-		thread := &starlark.Thread{
-			Print: starPrint,
+// validateMessage validates message, reached at path from the output, checking
+// its `protoconf.validate' rules, and PGV rules when checkRules is set
+func (c *config) validateMessage(message protoreflect.Message, path string, checkRules bool, v *validation) error {
+	c.runValidators(message, path, v)
+	if err := c.checkFieldRules(message, path, &v.failures); err != nil {
+		return err
+	}
+	if checkRules {
+		if err := c.checkRules(message, path, &v.failures); err != nil {
+			return err
 		}
-		args := starlark.Tuple([]starlark.Value{
-			proto.NewStarProtoMessage(message),
-		})
-		if _, err := starlark.Call(thread, validator, args, nil); err != nil {
+	}
+
+	// Range visits the populated fields only, extensions and oneof members
+	// included, in no particular order. They are validated in the order of
+	// their numbers so that failures are reported in the same order.
+	var fields []protoreflect.FieldDescriptor
+	message.Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, field)
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Number() < fields[j].Number()
+	})
+	for _, field := range fields {
+		if err := c.validateField(field, message.Get(field), joinPath(path, fieldPathName(field)), checkRules, v); err != nil {
 			return err
 		}
 	}
 
-	for _, field := range message.GetMessageDescriptor().GetFields() {
-		if field.GetType() != dpb.FieldDescriptorProto_TYPE_MESSAGE {
-			continue
+	if message.Descriptor().FullName() == anyFullName {
+		unpacked, err := c.unpackAny(message)
+		if err != nil || unpacked == nil {
+			return err
 		}
-		if field.IsMap() {
-			mp := message.GetField(field).(map[interface{}]interface{})
-			if field.GetMapKeyType().GetType() == dpb.FieldDescriptorProto_TYPE_MESSAGE {
-				for key := range mp {
-					if err := c.validate(key); err != nil {
-						return err
-					}
-				}
-			}
-			if field.GetMapValueType().GetType() == dpb.FieldDescriptorProto_TYPE_MESSAGE {
-				for _, value := range mp {
-					if err := c.validate(value); err != nil {
-						return err
-					}
-				}
-			}
-		} else if field.IsRepeated() {
-			length := len(message.GetField(field).([]interface{}))
-			for i := 0; i < length; i++ {
-				if err := c.validate(message.GetRepeatedField(field, i)); err != nil {
-					return err
-				}
-			}
-		} else {
-			if err := c.validate(message.GetField(field)); err != nil {
+		return c.validateMessage(unpacked, path, checkRules, v)
+	}
+	return nil
+}
+
+// runValidators runs every validator added for the type of message, naming
+// the ones which failed. Failures of messages nested in the output start with
+// their path from it. Validators taking a second parameter are passed the
+// context of the validation.
+func (c *config) runValidators(message protoreflect.Message, path string, v *validation) {
+	validators := c.validators[string(message.Descriptor().FullName())]
+	if len(validators) == 0 {
+		return
+	}
+	ctx := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"config": starlark.String(c.filename),
+		"output": starlark.String(v.output),
+		"env":    starlark.String(v.env),
+		"path":   starlark.String(path),
+	})
+	for _, validator := range validators {
+		thread := c.newThread()
+		thread.SetLocal(validationPathLocal, path)
+		thread.SetLocal(validationLocal, v)
+		// Validators only read the output, which other validators may be
+		// reading concurrently
+		value := proto.NewStarProtoMessage(message, c.options)
+		value.Freeze()
+		args := starlark.Tuple([]starlark.Value{value})
+		if validator.NumParams() == 2 {
+			args = append(args, ctx)
+		}
+		if _, err := starlark.Call(thread, validator, args, nil); err != nil {
+			failure := fmt.Sprintf("%s: validator %s (%s) failed: %v", message.Descriptor().FullName(), validator.Name(), validator.Position(), withPosition(err))
+			v.failures = append(v.failures, atPath(path, failure))
+		}
+	}
+}
+
+// validateField validates the messages held by a field at path: its value, the
+// elements of a repeated field or the values of a map
+func (c *config) validateField(field protoreflect.FieldDescriptor, value protoreflect.Value, path string, checkRules bool, v *validation) error {
+	if checkRules {
+		skip, err := c.pgvSkipsMessage(field)
+		if err != nil {
+			return err
+		}
+		checkRules = !skip
+	}
+	switch {
+	case field.IsMap():
+		if field.MapValue().Message() == nil {
+			return nil
+		}
+		var err error
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			err = c.validateMessage(value.Message(), fmt.Sprintf("%s[%s]", path, formatMapKey(key)), checkRules, v)
+			return err == nil
+		})
+		return err
+	case field.Message() == nil:
+		return nil
+	case field.IsList():
+		list := value.List()
+		for i := 0; i < list.Len(); i++ {
+			if err := c.validateMessage(list.Get(i).Message(), fmt.Sprintf("%s[%d]", path, i), checkRules, v); err != nil {
 				return err
 			}
 		}
+		return nil
 	}
-	return nil
+	return c.validateMessage(value.Message(), path, checkRules, v)
+}
+
+// atPath prefixes the failure of a message with its path from the output,
+// failures of the output itself have no path
+func atPath(path string, failure string) string {
+	if path == "" {
+		return failure
+	}
+	return path + ": " + failure
+}
+
+const anyFullName protoreflect.FullName = "google.protobuf.Any"
+
+// unpackAny returns the message packed in an `Any', or nil if it's empty
+func (c *config) unpackAny(any protoreflect.Message) (protoreflect.Message, error) {
+	fields := any.Descriptor().Fields()
+	typeURL := any.Get(fields.ByName("type_url")).String()
+	if typeURL == "" {
+		return nil, nil
+	}
+	messageType, err := c.anyResolver.FindMessageByURL(typeURL)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving google.protobuf.Any type %s, load its proto file: %v", typeURL, err)
+	}
+	message := messageType.New()
+	options := protov2.UnmarshalOptions{Resolver: c.anyResolver}
+	if err := options.Unmarshal(any.Get(fields.ByName("value")).Bytes(), message.Interface()); err != nil {
+		return nil, fmt.Errorf("error unpacking google.protobuf.Any of type %s: %v", typeURL, err)
+	}
+	return message, nil
+}
+
+type optionKey struct {
+	desc protoreflect.Descriptor
+	name protoreflect.FullName
+}
+
+// customOption returns the value of the custom option name set on desc, such
+// as the rules of a validation library. Options of protos parsed by protoconf
+// hold custom options as extensions or as unknown fields, so they are decoded
+// again with the types loaded by the config.
+func (c *config) customOption(desc protoreflect.Descriptor, name protoreflect.FullName) (protoreflect.Value, bool, error) {
+	key := optionKey{desc, name}
+	c.customOptionsLock.Lock()
+	defer c.customOptionsLock.Unlock()
+	if value, ok := c.customOptions[key]; ok {
+		return value, value.IsValid(), nil
+	}
+	if c.customOptions == nil {
+		c.customOptions = make(map[optionKey]protoreflect.Value)
+	}
+
+	var value protoreflect.Value
+	options := desc.Options()
+	if options != nil && options.ProtoReflect().IsValid() {
+		data, err := protov2.Marshal(options)
+		if err != nil {
+			return value, false, err
+		}
+		decoded := options.ProtoReflect().New()
+		if err := (protov2.UnmarshalOptions{Resolver: c.anyResolver}).Unmarshal(data, decoded.Interface()); err != nil {
+			return value, false, fmt.Errorf("error decoding the options of %s: %v", desc.FullName(), err)
+		}
+		decoded.Range(func(field protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			if field.IsExtension() && field.FullName() == name {
+				value = v
+				return false
+			}
+			return true
+		})
+	}
+	c.customOptions[key] = value
+	return value, value.IsValid(), nil
 }
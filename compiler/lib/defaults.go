@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// warningDefaultFields is the kind of the warnings of the audit of the fields
+// left at their default value
+const warningDefaultFields = "fields left at their default value"
+
+// defaultFields appends to found the paths of the fields of message, and of the
+// messages nested in it, left at their default value. Fields matching an
+// entry of allowlist, a field or message full name or a pattern of them (e.g.
+// `acme.Service.*'), are left out, and so are deprecated fields. The messages
+// of well-known types, such as google.protobuf.Duration, are values of their
+// own and aren't looked into.
+func defaultFields(message protoreflect.Message, path string, allowlist []string, found *[]string) {
+	desc := message.Descriptor()
+	if strings.HasPrefix(desc.ParentFile().Path(), "google/protobuf/") || allowed(desc.FullName(), allowlist) {
+		return
+	}
+
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			continue
+		}
+		if isDeprecated(field) || allowed(field.FullName(), allowlist) {
+			continue
+		}
+		fieldPath := joinPath(path, fieldPathName(field))
+		if !message.Has(field) {
+			*found = append(*found, fieldPath)
+			continue
+		}
+		defaultsOf(field, message.Get(field), fieldPath, allowlist, found)
+	}
+
+	// A oneof is left at its default when none of its fields are set
+	oneofs := desc.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		if oneof.IsSynthetic() || allowed(oneof.FullName(), allowlist) {
+			continue
+		}
+		if field := message.WhichOneof(oneof); field == nil {
+			*found = append(*found, joinPath(path, string(oneof.Name())))
+		} else {
+			defaultsOf(field, message.Get(field), joinPath(path, fieldPathName(field)), allowlist, found)
+		}
+	}
+}
+
+// defaultsOf looks into the messages held by a field set at path
+func defaultsOf(field protoreflect.FieldDescriptor, value protoreflect.Value, path string, allowlist []string, found *[]string) {
+	switch {
+	case field.IsMap():
+		if field.MapValue().Message() == nil {
+			return
+		}
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			defaultFields(value.Message(), fmt.Sprintf("%s[%s]", path, formatMapKey(key)), allowlist, found)
+			return true
+		})
+	case field.Message() == nil:
+	case field.IsList():
+		list := value.List()
+		for i := 0; i < list.Len(); i++ {
+			defaultFields(list.Get(i).Message(), fmt.Sprintf("%s[%d]", path, i), allowlist, found)
+		}
+	default:
+		defaultFields(value.Message(), path, allowlist, found)
+	}
+}
+
+func isDeprecated(field protoreflect.FieldDescriptor) bool {
+	options, ok := field.Options().(interface{ GetDeprecated() bool })
+	return ok && options.GetDeprecated()
+}
+
+// allowed reports whether name matches an entry of allowlist
+func allowed(name protoreflect.FullName, allowlist []string) bool {
+	for _, entry := range allowlist {
+		if matched, _ := path.Match(entry, string(name)); matched {
+			return true
+		}
+	}
+	return false
+}
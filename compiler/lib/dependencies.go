@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/protoconf/protoconf/consts"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DependencyGraph is the source files every config compiled depends on, by
+// the config relative to the src dir: the config itself, the Starlark
+// modules it loads, the proto files it loads along with the protos they
+// import, and the validators of the protos and the modules they load. The
+// paths are slash separated and relative to the src dir, or to the proto
+// path the protos are imported from.
+type DependencyGraph map[string][]string
+
+// Merge adds the dependencies of the configs of other to the graph, replacing
+// the dependencies the graph has for them
+func (g DependencyGraph) Merge(other DependencyGraph) {
+	for config, dependencies := range other {
+		g[config] = dependencies
+	}
+}
+
+// Affected lists the configs of the graph depending on the source files
+// changed, in order. A validator changed affects the configs loading the
+// proto it validates, along with the configs it was already loaded by.
+func (g DependencyGraph) Affected(changed []string) []string {
+	files := make(map[string]bool)
+	for _, file := range changed {
+		file = strings.TrimPrefix(filepath.ToSlash(file), "/")
+		files[file] = true
+		if strings.HasSuffix(file, consts.ValidatorExtensionSuffix) {
+			files[strings.TrimSuffix(file, consts.ValidatorExtensionSuffix)] = true
+		}
+	}
+	var affected []string
+	for config, dependencies := range g {
+		for _, dependency := range dependencies {
+			if files[dependency] {
+				affected = append(affected, config)
+				break
+			}
+		}
+	}
+	sort.Strings(affected)
+	return affected
+}
+
+// Dependencies returns the dependency graph of the configs compiled, the
+// configs which failed too as long as they were loaded
+func (c *Compiler) Dependencies() DependencyGraph {
+	c.outputsLock.Lock()
+	defer c.outputsLock.Unlock()
+	graph := make(DependencyGraph, len(c.dependencies))
+	graph.Merge(c.dependencies)
+	return graph
+}
+
+// addDependencies records the source files loaded by the loader of a config
+func (c *Compiler) addDependencies(filename string, loader *starlarkLoader) {
+	seen := make(map[string]bool)
+	for modulePath, entry := range loader.loaded {
+		seen[filepath.ToSlash(modulePath)] = true
+		// The modules which failed to load are loaded by the modules which
+		// did
+		for _, loadPath := range entry.loads {
+			seen[filepath.ToSlash(loadPath)] = true
+		}
+	}
+	var visit func(file protoreflect.FileDescriptor)
+	visit = func(file protoreflect.FileDescriptor) {
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if !seen[imports.Get(i).Path()] {
+				seen[imports.Get(i).Path()] = true
+				visit(imports.Get(i).FileDescriptor)
+			}
+		}
+	}
+	for _, file := range loader.protoFiles {
+		visit(file)
+	}
+
+	dependencies := make([]string, 0, len(seen))
+	for dependency := range seen {
+		dependencies = append(dependencies, dependency)
+	}
+	sort.Strings(dependencies)
+	c.outputsLock.Lock()
+	defer c.outputsLock.Unlock()
+	c.dependencies[strings.TrimPrefix(filepath.ToSlash(filename), "/")] = dependencies
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Modes of embedding the descriptors of an output, see Compiler.SetDescriptorsMode
+const (
+	// DescriptorsNone doesn't embed descriptors
+	DescriptorsNone = ""
+	// DescriptorsInline embeds the descriptors in the materialized config
+	DescriptorsInline = "inline"
+	// DescriptorsFile writes the descriptors to a binary FileDescriptorSet
+	// file next to the materialized config
+	DescriptorsFile = "file"
+)
+
+// outputFiles returns the proto files needed to decode message: the file of
+// its type, of the extensions set on it and of the messages packed in its
+// `Any' fields, recursively
+func (c *config) outputFiles(message protoreflect.Message) ([]protoreflect.FileDescriptor, error) {
+	var files []protoreflect.FileDescriptor
+	seen := make(map[string]bool)
+	add := func(file protoreflect.FileDescriptor) {
+		if !seen[file.Path()] {
+			seen[file.Path()] = true
+			files = append(files, file)
+		}
+	}
+
+	var walk func(message protoreflect.Message) error
+	walk = func(message protoreflect.Message) error {
+		add(message.Descriptor().ParentFile())
+		if message.Descriptor().FullName() == anyFullName {
+			unpacked, err := c.unpackAny(message)
+			if err != nil || unpacked == nil {
+				return err
+			}
+			return walk(unpacked)
+		}
+
+		var err error
+		message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+			if field.IsExtension() {
+				add(field.ParentFile())
+			}
+			switch {
+			case field.IsMap():
+				if field.MapValue().Message() != nil {
+					value.Map().Range(func(_ protoreflect.MapKey, value protoreflect.Value) bool {
+						err = walk(value.Message())
+						return err == nil
+					})
+				}
+			case field.Message() == nil:
+			case field.IsList():
+				list := value.List()
+				for i := 0; i < list.Len() && err == nil; i++ {
+					err = walk(list.Get(i).Message())
+				}
+			default:
+				err = walk(value.Message())
+			}
+			return err == nil
+		})
+		return err
+	}
+
+	if err := walk(message); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
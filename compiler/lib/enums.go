@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/protoconf/protoconf/compiler/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// undefinedEnums returns the enum fields of message holding numbers their enum
+// doesn't define, e.g. decoded from JSON, which open enums may hold when the
+// options of the config allow them
+func (c *config) undefinedEnums(message protoreflect.Message) ([]string, error) {
+	var found []string
+	err := c.rangeScalars(message, func(field protoreflect.FieldDescriptor, value protoreflect.Value, path string) {
+		if field.Kind() != protoreflect.EnumKind {
+			return
+		}
+		if err := proto.CheckEnumNumber(field.Enum(), value.Enum(), c.options); err != nil {
+			found = append(found, fmt.Sprintf("%s: %v", path, err))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Fields are ranged in no particular order
+	sort.Strings(found)
+	return found, nil
+}
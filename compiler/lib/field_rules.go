@@ -0,0 +1,247 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"unicode/utf8"
+
+	pc "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// protoconfValidate is the option of protoconf/validate.proto, bundled with
+// protoconf, holding the FieldRules of a field
+const protoconfValidate protoreflect.FullName = "protoconf.validate"
+
+// checkFieldRules checks the fields of message, reached at path from the
+// output, against their `protoconf.validate' rules, appending a failure for
+// each field breaking them. Immutable fields are checked by immutableChanges.
+func (c *config) checkFieldRules(message protoreflect.Message, path string, failures *[]string) error {
+	fields := message.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		rules, ok, err := c.customOption(field, protoconfValidate)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		fieldPath := joinPath(path, fieldPathName(field))
+		if err := checkFieldRule(message, field, fieldPath, rules.Message()); err != nil {
+			*failures = append(*failures, err.Error())
+		}
+	}
+	return nil
+}
+
+// checkFieldRule checks a field against its rules, errors start with the path
+// of the field
+func checkFieldRule(message protoreflect.Message, field protoreflect.FieldDescriptor, path string, rules protoreflect.Message) error {
+	if !message.Has(field) {
+		if required, ok := rule(rules, "required"); ok && required.Bool() {
+			return fmt.Errorf("%s: value is required", path)
+		}
+		// Unset fields with presence aren't checked, the others are zero
+		if field.HasPresence() {
+			return nil
+		}
+	}
+
+	value := message.Get(field)
+	switch {
+	case field.IsList():
+		list := value.List()
+		if err := checkBounds(rules, path, float64(list.Len()), "number of elements"); err != nil {
+			return err
+		}
+		if field.Kind() == protoreflect.StringKind {
+			for i := 0; i < list.Len(); i++ {
+				if err := checkPattern(rules, fmt.Sprintf("%s[%d]", path, i), list.Get(i).String()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case field.IsMap():
+		return checkBounds(rules, path, float64(value.Map().Len()), "number of elements")
+	}
+
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		if err := checkBounds(rules, path, float64(utf8.RuneCountInString(value.String())), "length"); err != nil {
+			return err
+		}
+		return checkPattern(rules, path, value.String())
+	case protoreflect.BytesKind:
+		return checkBounds(rules, path, float64(len(value.Bytes())), "length")
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return checkBounds(rules, path, float64(value.Int()), "")
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return checkBounds(rules, path, float64(value.Uint()), "")
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return checkBounds(rules, path, value.Float(), "")
+	}
+	return nil
+}
+
+// checkBounds checks n against the min and max rules, n being the value of a
+// number or, when what is set, the length of a value
+func checkBounds(rules protoreflect.Message, path string, n float64, what string) error {
+	subject := fmt.Sprint(n)
+	if what != "" {
+		subject = fmt.Sprintf("%s %v", what, n)
+	}
+	if min, ok := rule(rules, "min"); ok && n < min.Float() {
+		return fmt.Errorf("%s: %s is less than the minimum %v", path, subject, min.Float())
+	}
+	if max, ok := rule(rules, "max"); ok && n > max.Float() {
+		return fmt.Errorf("%s: %s is greater than the maximum %v", path, subject, max.Float())
+	}
+	return nil
+}
+
+func checkPattern(rules protoreflect.Message, path string, s string) error {
+	pattern, ok := rule(rules, "pattern")
+	if !ok {
+		return nil
+	}
+	regex, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return fmt.Errorf("%s: invalid pattern %q: %v", path, pattern.String(), err)
+	}
+	if !regex.MatchString(s) {
+		return fmt.Errorf("%s: %q does not match %q", path, s, pattern.String())
+	}
+	return nil
+}
+
+// immutableChanges compares the fields of message set immutable by their
+// `protoconf.validate' rules with the existing materialized config, returning
+// a failure for each field which changed. A field may change once from unset
+// to set. Outputs which weren't materialized yet, or were materialized with
+// another message type, have nothing to compare with.
+func (c *config) immutableChanges(message protoreflect.Message, outputFile string) ([]string, error) {
+	exists, isDir, err := stat(outputFile)
+	if err != nil || !exists || isDir {
+		return nil, err
+	}
+	reader, err := openFile(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := &pc.ProtoconfValue{}
+	if err := (protojson.UnmarshalOptions{Resolver: c.anyResolver, DiscardUnknown: true}).Unmarshal(data, previous); err != nil {
+		return nil, nil
+	}
+	messageType, err := c.anyResolver.FindMessageByURL(previous.GetValue().GetTypeUrl())
+	if err != nil || messageType.Descriptor() != message.Descriptor() {
+		return nil, nil
+	}
+	old := messageType.New()
+	if err := (protov2.UnmarshalOptions{Resolver: c.anyResolver}).Unmarshal(previous.GetValue().GetValue(), old.Interface()); err != nil {
+		return nil, fmt.Errorf("error decoding existing output %s, err: %v", outputFile, err)
+	}
+
+	var failures []string
+	return failures, c.compareImmutable(old, message, "", &failures)
+}
+
+func (c *config) compareImmutable(old protoreflect.Message, message protoreflect.Message, path string, failures *[]string) error {
+	fields := message.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if !old.Has(field) {
+			continue
+		}
+		fieldPath := joinPath(path, fieldPathName(field))
+		rules, ok, err := c.customOption(field, protoconfValidate)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if immutable, ok := rule(rules.Message(), "immutable"); ok && immutable.Bool() {
+				if !fieldEqual(old, message, field) {
+					*failures = append(*failures, immutableFailure(old, message, field, fieldPath))
+				}
+				continue
+			}
+		}
+		if !message.Has(field) {
+			continue
+		}
+
+		// Immutable fields of nested messages are compared in the messages of
+		// both outputs, and in the values of map keys found in both
+		switch {
+		case field.IsMap():
+			if field.MapValue().Message() == nil {
+				continue
+			}
+			oldMap, newMap := old.Get(field).Map(), message.Get(field).Map()
+			var err error
+			newMap.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+				if oldMap.Has(key) {
+					err = c.compareImmutable(oldMap.Get(key).Message(), value.Message(), fmt.Sprintf("%s[%s]", fieldPath, formatMapKey(key)), failures)
+				}
+				return err == nil
+			})
+			if err != nil {
+				return err
+			}
+		case field.IsList() || field.Message() == nil:
+		default:
+			if err := c.compareImmutable(old.Get(field).Message(), message.Get(field).Message(), fieldPath, failures); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fieldEqual reports whether a field has the same value in two messages of
+// the same type
+func fieldEqual(a protoreflect.Message, b protoreflect.Message, field protoreflect.FieldDescriptor) bool {
+	x, y := a.New(), a.New()
+	if a.Has(field) {
+		x.Set(field, a.Get(field))
+	}
+	if b.Has(field) {
+		y.Set(field, b.Get(field))
+	}
+	return protov2.Equal(x.Interface(), y.Interface())
+}
+
+func immutableFailure(old protoreflect.Message, message protoreflect.Message, field protoreflect.FieldDescriptor, path string) string {
+	if field.IsList() || field.IsMap() || field.Message() != nil {
+		return fmt.Sprintf("%s: immutable field changed", path)
+	}
+	format := func(m protoreflect.Message) string {
+		if !m.Has(field) && field.HasPresence() {
+			return "unset"
+		}
+		value := m.Get(field)
+		switch field.Kind() {
+		case protoreflect.StringKind:
+			return fmt.Sprintf("%q", value.String())
+		case protoreflect.BytesKind:
+			return fmt.Sprintf("%q", value.Bytes())
+		case protoreflect.EnumKind:
+			if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+				return string(enumValue.Name())
+			}
+		}
+		return fmt.Sprint(value.Interface())
+	}
+	return fmt.Sprintf("%s: immutable field changed from %s to %s", path, format(old), format(message))
+}
@@ -3,9 +3,13 @@
 package lib
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+
+	getter "github.com/hashicorp/go-getter"
 )
 
 func mkdirAll(path string, perm os.FileMode) error {
@@ -30,3 +34,34 @@ func openFile(path string) (io.ReadCloser, error) {
 func writeFile(filename string, bytes []byte) error {
 	return ioutil.WriteFile(filename, bytes, 0644)
 }
+
+func readArchive(location string) ([]byte, error) {
+	if _, err := os.Stat(location); err == nil {
+		return ioutil.ReadFile(location)
+	}
+
+	dir, err := ioutil.TempDir("", "protoconf_archive")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	dst := filepath.Join(dir, "archive")
+	client := &getter.Client{
+		Ctx:  context.Background(),
+		Src:  location,
+		Dst:  dst,
+		Pwd:  pwd,
+		Mode: getter.ClientModeFile,
+		// Unpacking is done in memory by the loader
+		Decompressors: map[string]getter.Decompressor{},
+	}
+	if err := client.Get(); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(dst)
+}
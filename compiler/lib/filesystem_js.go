@@ -35,3 +35,7 @@ func writeFile(filename string, contents []byte) error {
 	}
 	return nil
 }
+
+func readArchive(location string) ([]byte, error) {
+	return nil, fmt.Errorf("source archives are not supported, archive=%s", location)
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// nonFiniteFloats returns the paths of the float and double fields of message
+// holding NaN or an infinity, which have no JSON number representation and are
+// written as the strings "NaN", "Infinity" and "-Infinity" instead
+func (c *config) nonFiniteFloats(message protoreflect.Message) ([]string, error) {
+	var found []string
+	err := c.rangeScalars(message, func(field protoreflect.FieldDescriptor, value protoreflect.Value, path string) {
+		if kind := field.Kind(); kind == protoreflect.FloatKind || kind == protoreflect.DoubleKind {
+			if f := value.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+				found = append(found, fmt.Sprintf("%s is %s", path, formatFloat(f)))
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Fields are ranged in no particular order
+	sort.Strings(found)
+	return found, nil
+}
+
+// rangeScalars calls visit with the path of every scalar value of message and
+// of the messages nested in it, including the messages packed in `Any' fields.
+// The field of map values is the descriptor of the values.
+func (c *config) rangeScalars(message protoreflect.Message, visit func(field protoreflect.FieldDescriptor, value protoreflect.Value, path string)) error {
+	var walk func(message protoreflect.Message, path string) error
+	walk = func(message protoreflect.Message, path string) error {
+		if message.Descriptor().FullName() == anyFullName {
+			unpacked, err := c.unpackAny(message)
+			if err != nil || unpacked == nil {
+				return err
+			}
+			return walk(unpacked, path)
+		}
+
+		var err error
+		message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+			name := joinPath(path, fieldPathName(field))
+			check := func(field protoreflect.FieldDescriptor, value protoreflect.Value, path string) {
+				if field.Message() != nil {
+					err = walk(value.Message(), path)
+				} else {
+					visit(field, value, path)
+				}
+			}
+			switch {
+			case field.IsMap():
+				value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+					check(field.MapValue(), value, fmt.Sprintf("%s[%s]", name, formatMapKey(key)))
+					return err == nil
+				})
+			case field.IsList():
+				list := value.List()
+				for i := 0; i < list.Len() && err == nil; i++ {
+					check(field, list.Get(i), fmt.Sprintf("%s[%d]", name, i))
+				}
+			default:
+				check(field, value, name)
+			}
+			return err == nil
+		})
+		return err
+	}
+	return walk(message, "")
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	}
+	return "-Infinity"
+}
+
+func formatMapKey(key protoreflect.MapKey) string {
+	if s, ok := key.Interface().(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return key.String()
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/protoconf/protoconf/compiler/proto"
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// hook is a function registered by a post-compile hook script
+type hook struct {
+	script string
+	fn     *starlark.Function
+}
+
+// addOutput keeps a compiled output for the post-compile hooks, named after its
+// materialized file relative to the materialized dir, without the extension
+func (c *Compiler) addOutput(outputFile string, message protoreflect.Message) {
+	if len(c.hooks) == 0 || c.disableValidation {
+		return
+	}
+	c.outputsLock.Lock()
+	defer c.outputsLock.Unlock()
+	c.outputs[c.outputName(outputFile)] = message
+}
+
+// RunHooks runs the post-compile hooks registered by the scripts of the
+// workspace on the outputs of every config compiled so far. Each hook gets a
+// frozen dict of the outputs by name, and all of them run even when some fail.
+// Hooks don't run when validation is disabled.
+func (c *Compiler) RunHooks() error {
+	if len(c.hooks) == 0 || c.disableValidation {
+		return nil
+	}
+
+	var hooks []hook
+	loader := c.GetLoader()
+	var script string
+	loader.Modules["add_hook"] = starlark.NewBuiltin("add_hook", func(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var hookFn *starlark.Function
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &hookFn); err != nil {
+			return nil, err
+		}
+		if numParams := hookFn.NumParams(); numParams != 1 {
+			return nil, fmt.Errorf("expected a function that get 1 param, got=%d", numParams)
+		}
+		hooks = append(hooks, hook{script: script, fn: hookFn})
+		return starlark.None, nil
+	})
+	for _, script = range c.hooks {
+		script = filepath.ToSlash(script)
+		if _, err := loader.Load(loader.newThread(), script); err != nil {
+			return fmt.Errorf("error loading post-compile hooks from %s: %v", script, err)
+		}
+	}
+
+	c.outputsLock.Lock()
+	names := make([]string, 0, len(c.outputs))
+	for name := range c.outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	outputs := starlark.NewDict(len(names))
+	for _, name := range names {
+		if err := outputs.SetKey(starlark.String(name), proto.NewStarProtoMessage(c.outputs[name], loader.options)); err != nil {
+			c.outputsLock.Unlock()
+			return err
+		}
+	}
+	c.outputsLock.Unlock()
+	outputs.Freeze()
+
+	var failures []string
+	for _, hook := range hooks {
+		if _, err := starlark.Call(loader.newThread(), hook.fn, starlark.Tuple{outputs}, nil); err != nil {
+			failure := fmt.Sprintf("hook %s (%s) failed: %v", hook.fn.Name(), hook.fn.Position(), withPosition(err))
+			c.report.add(ReportEntry{Config: hook.script, Kind: "hook errors", Severity: SeverityError, Message: failure})
+			failures = append(failures, failure)
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("post-compile hook errors:\n  %s", strings.Join(failures, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,691 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Options of protoc-gen-validate (PGV), declared in validate/validate.proto of
+// github.com/envoyproxy/protoc-gen-validate
+const (
+	pgvRules    protoreflect.FullName = "validate.rules"
+	pgvDisabled protoreflect.FullName = "validate.disabled"
+	pgvIgnored  protoreflect.FullName = "validate.ignored"
+	pgvRequired protoreflect.FullName = "validate.required"
+)
+
+var (
+	pgvUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	// The regexes of the `validate.KnownRegex' values, strict and not
+	pgvHeaderName        = regexp.MustCompile(`^:?[0-9a-zA-Z!#$%&'*+-.^_|~` + "`" + `]+$`)
+	pgvHeaderValue       = regexp.MustCompile(`^[^\x00-\x08\x0A-\x1F\x7F]*$`)
+	pgvHeaderValueLoose  = regexp.MustCompile(`^[^\x00\x0A\x0D]*$`)
+	pgvKnownRegexHeaders = map[string][2]*regexp.Regexp{
+		"HTTP_HEADER_NAME":  {pgvHeaderName, pgvHeaderValueLoose},
+		"HTTP_HEADER_VALUE": {pgvHeaderValue, pgvHeaderValueLoose},
+	}
+)
+
+// checkRules checks the fields of message against their PGV rules, appending
+// the first violation of each field to failures. Nested messages are checked
+// as they are validated, their failures start with their path.
+func (c *config) checkRules(message protoreflect.Message, path string, failures *[]string) error {
+	desc := message.Descriptor()
+	for _, name := range []protoreflect.FullName{pgvDisabled, pgvIgnored} {
+		value, ok, err := c.customOption(desc, name)
+		if err != nil || (ok && value.Bool()) {
+			return err
+		}
+	}
+
+	oneofs := desc.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		required, ok, err := c.customOption(oneof, pgvRequired)
+		if err != nil {
+			return err
+		}
+		if ok && required.Bool() && message.WhichOneof(oneof) == nil {
+			*failures = append(*failures, atPath(path, fmt.Sprintf("invalid %s: value is required", oneof.FullName())))
+		}
+	}
+
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		rules, ok, err := c.customOption(field, pgvRules)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := c.checkField(message, field, rules.Message()); err != nil {
+			*failures = append(*failures, atPath(path, fmt.Sprintf("invalid %s", err)))
+		}
+	}
+	return nil
+}
+
+// pgvSkipsMessage reports whether the rules of a field skip validating the
+// messages it holds
+func (c *config) pgvSkipsMessage(field protoreflect.FieldDescriptor) (bool, error) {
+	rules, ok, err := c.customOption(field, pgvRules)
+	if err != nil || !ok {
+		return false, err
+	}
+	if field.IsList() {
+		if repeated, ok := ruleMessage(rules.Message(), "repeated"); ok {
+			if items, ok := ruleMessage(repeated, "items"); ok {
+				rules = protoreflect.ValueOfMessage(items)
+			}
+		}
+	} else if field.IsMap() {
+		if mapRules, ok := ruleMessage(rules.Message(), "map"); ok {
+			if values, ok := ruleMessage(mapRules, "values"); ok {
+				rules = protoreflect.ValueOfMessage(values)
+			}
+		}
+	}
+	if messageRules, ok := ruleMessage(rules.Message(), "message"); ok {
+		if skip, ok := rule(messageRules, "skip"); ok {
+			return skip.Bool(), nil
+		}
+	}
+	return false, nil
+}
+
+// rule returns the value of a rule set in rules
+func rule(rules protoreflect.Message, name protoreflect.Name) (protoreflect.Value, bool) {
+	field := rules.Descriptor().Fields().ByName(name)
+	if field == nil || !rules.Has(field) {
+		return protoreflect.Value{}, false
+	}
+	return rules.Get(field), true
+}
+
+func ruleMessage(rules protoreflect.Message, name protoreflect.Name) (protoreflect.Message, bool) {
+	value, ok := rule(rules, name)
+	if !ok {
+		return nil, false
+	}
+	return value.Message(), true
+}
+
+// typeRules returns the name and rules of the `type' oneof of FieldRules
+func typeRules(rules protoreflect.Message) (protoreflect.Name, protoreflect.Message) {
+	oneof := rules.Descriptor().Oneofs().ByName("type")
+	if oneof == nil {
+		return "", nil
+	}
+	field := rules.WhichOneof(oneof)
+	if field == nil {
+		return "", nil
+	}
+	return field.Name(), rules.Get(field).Message()
+}
+
+// checkField checks a field of message, errors start with the field name
+func (c *config) checkField(message protoreflect.Message, field protoreflect.FieldDescriptor, rules protoreflect.Message) error {
+	path := string(field.FullName())
+	name, typed := typeRules(rules)
+	switch {
+	case field.IsList():
+		if name != "repeated" {
+			return nil
+		}
+		return checkRepeated(field, message.Get(field).List(), path, typed)
+	case field.IsMap():
+		if name != "map" {
+			return nil
+		}
+		return checkMap(field, message.Get(field).Map(), path, typed)
+	}
+
+	if field.HasPresence() && !message.Has(field) {
+		if required(rules, name, typed) {
+			return fmt.Errorf("%s: value is required", path)
+		}
+		return nil
+	}
+	return checkValue(field, message.Get(field), path, rules)
+}
+
+// required reports whether the rules of a field require a value
+func required(rules protoreflect.Message, name protoreflect.Name, typed protoreflect.Message) bool {
+	if messageRules, ok := ruleMessage(rules, "message"); ok {
+		if value, ok := rule(messageRules, "required"); ok && value.Bool() {
+			return true
+		}
+	}
+	switch name {
+	case "any", "duration", "timestamp":
+		value, ok := rule(typed, "required")
+		return ok && value.Bool()
+	}
+	return false
+}
+
+func checkRepeated(field protoreflect.FieldDescriptor, list protoreflect.List, path string, rules protoreflect.Message) error {
+	if ignore, ok := rule(rules, "ignore_empty"); ok && ignore.Bool() && list.Len() == 0 {
+		return nil
+	}
+	if min, ok := rule(rules, "min_items"); ok && uint64(list.Len()) < min.Uint() {
+		return fmt.Errorf("%s: value must contain at least %d item(s)", path, min.Uint())
+	}
+	if max, ok := rule(rules, "max_items"); ok && uint64(list.Len()) > max.Uint() {
+		return fmt.Errorf("%s: value must contain no more than %d item(s)", path, max.Uint())
+	}
+	if unique, ok := rule(rules, "unique"); ok && unique.Bool() && field.Message() == nil {
+		seen := make(map[interface{}]bool)
+		for i := 0; i < list.Len(); i++ {
+			key := list.Get(i).Interface()
+			if bytes, ok := key.([]byte); ok {
+				key = string(bytes)
+			}
+			if seen[key] {
+				return fmt.Errorf("%s[%d]: repeated value must contain unique items", path, i)
+			}
+			seen[key] = true
+		}
+	}
+	if items, ok := ruleMessage(rules, "items"); ok {
+		for i := 0; i < list.Len(); i++ {
+			if err := checkValue(field, list.Get(i), fmt.Sprintf("%s[%d]", path, i), items); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkMap(field protoreflect.FieldDescriptor, mp protoreflect.Map, path string, rules protoreflect.Message) error {
+	if ignore, ok := rule(rules, "ignore_empty"); ok && ignore.Bool() && mp.Len() == 0 {
+		return nil
+	}
+	if min, ok := rule(rules, "min_pairs"); ok && uint64(mp.Len()) < min.Uint() {
+		return fmt.Errorf("%s: value must contain at least %d pair(s)", path, min.Uint())
+	}
+	if max, ok := rule(rules, "max_pairs"); ok && uint64(mp.Len()) > max.Uint() {
+		return fmt.Errorf("%s: value must contain no more than %d pair(s)", path, max.Uint())
+	}
+	keys, hasKeys := ruleMessage(rules, "keys")
+	values, hasValues := ruleMessage(rules, "values")
+	var err error
+	mp.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+		elemPath := fmt.Sprintf("%s[%s]", path, formatMapKey(key))
+		if hasKeys {
+			if err = checkValue(field.MapKey(), key.Value(), elemPath, keys); err != nil {
+				return false
+			}
+		}
+		if hasValues {
+			err = checkValue(field.MapValue(), value, elemPath, values)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// checkValue checks a singular value of field, or an element of it if it's a
+// repeated field or a map
+func checkValue(field protoreflect.FieldDescriptor, value protoreflect.Value, path string, rules protoreflect.Message) error {
+	name, typed := typeRules(rules)
+	if typed == nil {
+		return nil
+	}
+	kind := field.Kind()
+	if field.Message() != nil {
+		message := value.Message()
+		switch name {
+		case "any":
+			return checkAny(message, path, typed)
+		case "duration":
+			return checkDuration(message, path, typed)
+		case "timestamp":
+			return checkTimestamp(message, path, typed)
+		}
+		// Scalar rules of wrapper types apply to the wrapped value
+		wrapped := message.Descriptor().Fields().ByName("value")
+		if message.Descriptor().ParentFile().Package() != "google.protobuf" || wrapped == nil || !message.IsValid() {
+			return nil
+		}
+		value, kind = message.Get(wrapped), wrapped.Kind()
+		field = wrapped
+	}
+	if string(name) != kind.String() {
+		return fmt.Errorf("%s: %s rules can't be applied to a %s field", path, name, kind)
+	}
+
+	switch kind {
+	case protoreflect.BoolKind:
+		if expected, ok := rule(typed, "const"); ok && value.Bool() != expected.Bool() {
+			return fmt.Errorf("%s: value must equal %v", path, expected.Bool())
+		}
+		return nil
+	case protoreflect.StringKind:
+		return checkString(value.String(), path, typed)
+	case protoreflect.BytesKind:
+		return checkBytes(value.Bytes(), path, typed)
+	case protoreflect.EnumKind:
+		return checkEnum(field.Enum(), value.Enum(), path, typed)
+	}
+	return checkNumber(value, path, typed, compareNumbers, formatNumber)
+}
+
+func compareNumbers(a, b protoreflect.Value) int {
+	var less, greater bool
+	switch a.Interface().(type) {
+	case int32, int64:
+		less, greater = a.Int() < b.Int(), a.Int() > b.Int()
+	case uint32, uint64:
+		less, greater = a.Uint() < b.Uint(), a.Uint() > b.Uint()
+	default:
+		less, greater = a.Float() < b.Float(), a.Float() > b.Float()
+	}
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func formatNumber(value protoreflect.Value) string {
+	return fmt.Sprint(value.Interface())
+}
+
+// checkNumber checks a number, a duration or a timestamp against the rules
+// common to them: const, lt, lte, gt, gte, in and not_in
+func checkNumber(value protoreflect.Value, path string, rules protoreflect.Message, compare func(a, b protoreflect.Value) int, format func(protoreflect.Value) string) error {
+	if ignore, ok := rule(rules, "ignore_empty"); ok && ignore.Bool() {
+		if field := rules.Descriptor().Fields().ByName("const"); field != nil && compare(value, field.Default()) == 0 {
+			return nil
+		}
+	}
+	if expected, ok := rule(rules, "const"); ok && compare(value, expected) != 0 {
+		return fmt.Errorf("%s: value must equal %s", path, format(expected))
+	}
+	if err := checkIn(value, path, rules, func(a, b protoreflect.Value) bool { return compare(a, b) == 0 }, format); err != nil {
+		return err
+	}
+
+	// The lower bound (gt or gte) and the upper bound (lt or lte) form a
+	// range, which is exclusive when the upper bound is below the lower one
+	lowerName, upperName := protoreflect.Name("gt"), protoreflect.Name("lt")
+	lower, hasLower := rule(rules, "gt")
+	if !hasLower {
+		lowerName = "gte"
+		lower, hasLower = rule(rules, "gte")
+	}
+	upper, hasUpper := rule(rules, "lt")
+	if !hasUpper {
+		upperName = "lte"
+		upper, hasUpper = rule(rules, "lte")
+	}
+	aboveLower := func() bool {
+		if lowerName == "gt" {
+			return compare(value, lower) > 0
+		}
+		return compare(value, lower) >= 0
+	}
+	belowUpper := func() bool {
+		if upperName == "lt" {
+			return compare(value, upper) < 0
+		}
+		return compare(value, upper) <= 0
+	}
+	bracket := func(name protoreflect.Name, open bool) string {
+		if (name == "gt" || name == "lt") == open {
+			return "("
+		}
+		return "["
+	}
+	closing := map[string]string{"(": ")", "[": "]"}
+
+	switch {
+	case hasLower && hasUpper:
+		if compare(upper, lower) > 0 {
+			if !aboveLower() || !belowUpper() {
+				return fmt.Errorf("%s: value must be inside range %s%s, %s%s", path,
+					bracket(lowerName, true), format(lower), format(upper), closing[bracket(upperName, true)])
+			}
+		} else if !aboveLower() && !belowUpper() {
+			return fmt.Errorf("%s: value must be outside range %s%s, %s%s", path,
+				bracket(upperName, false), format(upper), format(lower), closing[bracket(lowerName, false)])
+		}
+	case hasLower && !aboveLower():
+		if lowerName == "gt" {
+			return fmt.Errorf("%s: value must be greater than %s", path, format(lower))
+		}
+		return fmt.Errorf("%s: value must be greater than or equal to %s", path, format(lower))
+	case hasUpper && !belowUpper():
+		if upperName == "lt" {
+			return fmt.Errorf("%s: value must be less than %s", path, format(upper))
+		}
+		return fmt.Errorf("%s: value must be less than or equal to %s", path, format(upper))
+	}
+	return nil
+}
+
+// checkIn checks the in and not_in rules
+func checkIn(value protoreflect.Value, path string, rules protoreflect.Message, equal func(a, b protoreflect.Value) bool, format func(protoreflect.Value) string) error {
+	contains := func(list protoreflect.List) bool {
+		for i := 0; i < list.Len(); i++ {
+			if equal(value, list.Get(i)) {
+				return true
+			}
+		}
+		return false
+	}
+	formatList := func(list protoreflect.List) string {
+		items := make([]string, list.Len())
+		for i := range items {
+			items[i] = format(list.Get(i))
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+	if in, ok := rule(rules, "in"); ok && !contains(in.List()) {
+		return fmt.Errorf("%s: value must be in list %s", path, formatList(in.List()))
+	}
+	if notIn, ok := rule(rules, "not_in"); ok && contains(notIn.List()) {
+		return fmt.Errorf("%s: value must not be in list %s", path, formatList(notIn.List()))
+	}
+	return nil
+}
+
+func checkString(value string, path string, rules protoreflect.Message) error {
+	if ignore, ok := rule(rules, "ignore_empty"); ok && ignore.Bool() && value == "" {
+		return nil
+	}
+	if expected, ok := rule(rules, "const"); ok && value != expected.String() {
+		return fmt.Errorf("%s: value must equal %q", path, expected.String())
+	}
+	if err := checkIn(protoreflect.ValueOfString(value), path, rules, func(a, b protoreflect.Value) bool {
+		return a.String() == b.String()
+	}, func(value protoreflect.Value) string {
+		return fmt.Sprintf("%q", value.String())
+	}); err != nil {
+		return err
+	}
+
+	runes := uint64(utf8.RuneCountInString(value))
+	if length, ok := rule(rules, "len"); ok && runes != length.Uint() {
+		return fmt.Errorf("%s: value length must be %d runes", path, length.Uint())
+	}
+	if min, ok := rule(rules, "min_len"); ok && runes < min.Uint() {
+		return fmt.Errorf("%s: value length must be at least %d runes", path, min.Uint())
+	}
+	if max, ok := rule(rules, "max_len"); ok && runes > max.Uint() {
+		return fmt.Errorf("%s: value length must be at most %d runes", path, max.Uint())
+	}
+	if err := checkLength(uint64(len(value)), path, rules, "len_bytes", "min_bytes", "max_bytes"); err != nil {
+		return err
+	}
+	if err := checkSubstrings(value, path, rules); err != nil {
+		return err
+	}
+	if notContains, ok := rule(rules, "not_contains"); ok && strings.Contains(value, notContains.String()) {
+		return fmt.Errorf("%s: value contains substring %q", path, notContains.String())
+	}
+
+	oneof := rules.Descriptor().Oneofs().ByName("well_known")
+	if oneof == nil {
+		return nil
+	}
+	field := rules.WhichOneof(oneof)
+	if field == nil {
+		return nil
+	}
+	switch field.Name() {
+	case "email":
+		if !isEmail(value) {
+			return fmt.Errorf("%s: value must be a valid email address", path)
+		}
+	case "hostname":
+		if !isHostname(value) {
+			return fmt.Errorf("%s: value must be a valid hostname", path)
+		}
+	case "ip", "ipv4", "ipv6":
+		if !isIP(net.ParseIP(value), field.Name()) {
+			return fmt.Errorf("%s: value must be a valid %s address", path, ipName(field.Name()))
+		}
+	case "address":
+		if !isHostname(value) && net.ParseIP(value) == nil {
+			return fmt.Errorf("%s: value must be a valid hostname, or ip address", path)
+		}
+	case "uri":
+		u, err := url.Parse(value)
+		if err != nil {
+			return fmt.Errorf("%s: value must be a valid URI", path)
+		}
+		if !u.IsAbs() {
+			return fmt.Errorf("%s: value must be absolute", path)
+		}
+	case "uri_ref":
+		if _, err := url.Parse(value); err != nil {
+			return fmt.Errorf("%s: value must be a valid URI", path)
+		}
+	case "uuid":
+		if !pgvUUID.MatchString(value) {
+			return fmt.Errorf("%s: value must be a valid UUID", path)
+		}
+	case "well_known_regex":
+		known := field.Enum().Values().ByNumber(rules.Get(field).Enum())
+		if known == nil {
+			return nil
+		}
+		regexes, ok := pgvKnownRegexHeaders[string(known.Name())]
+		if !ok {
+			return nil
+		}
+		regex := regexes[0]
+		if strict, ok := rule(rules, "strict"); ok && !strict.Bool() {
+			regex = regexes[1]
+		}
+		if !regex.MatchString(value) {
+			return fmt.Errorf("%s: value does not match regex pattern %q", path, regex.String())
+		}
+	}
+	return nil
+}
+
+func checkBytes(value []byte, path string, rules protoreflect.Message) error {
+	if ignore, ok := rule(rules, "ignore_empty"); ok && ignore.Bool() && len(value) == 0 {
+		return nil
+	}
+	if expected, ok := rule(rules, "const"); ok && string(value) != string(expected.Bytes()) {
+		return fmt.Errorf("%s: value must equal %q", path, expected.Bytes())
+	}
+	if err := checkIn(protoreflect.ValueOfBytes(value), path, rules, func(a, b protoreflect.Value) bool {
+		return string(a.Bytes()) == string(b.Bytes())
+	}, func(value protoreflect.Value) string {
+		return fmt.Sprintf("%q", value.Bytes())
+	}); err != nil {
+		return err
+	}
+	if err := checkLength(uint64(len(value)), path, rules, "len", "min_len", "max_len"); err != nil {
+		return err
+	}
+	if err := checkSubstrings(string(value), path, rules); err != nil {
+		return err
+	}
+	for _, version := range []protoreflect.Name{"ip", "ipv4", "ipv6"} {
+		if check, ok := rule(rules, version); ok && check.Bool() && !isIP(net.IP(value), version) {
+			return fmt.Errorf("%s: value must be a valid %s address", path, ipName(version))
+		}
+	}
+	return nil
+}
+
+// checkLength checks a length in bytes against the rules named length, min and max
+func checkLength(length uint64, path string, rules protoreflect.Message, exact, min, max protoreflect.Name) error {
+	if expected, ok := rule(rules, exact); ok && length != expected.Uint() {
+		return fmt.Errorf("%s: value length must be %d bytes", path, expected.Uint())
+	}
+	if expected, ok := rule(rules, min); ok && length < expected.Uint() {
+		return fmt.Errorf("%s: value length must be at least %d bytes", path, expected.Uint())
+	}
+	if expected, ok := rule(rules, max); ok && length > expected.Uint() {
+		return fmt.Errorf("%s: value length must be at most %d bytes", path, expected.Uint())
+	}
+	return nil
+}
+
+// checkSubstrings checks the pattern, prefix, suffix and contains rules
+func checkSubstrings(value string, path string, rules protoreflect.Message) error {
+	if pattern, ok := rule(rules, "pattern"); ok {
+		regex, err := regexp.Compile(pattern.String())
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern %q: %v", path, pattern.String(), err)
+		}
+		if !regex.MatchString(value) {
+			return fmt.Errorf("%s: value does not match regex pattern %q", path, pattern.String())
+		}
+	}
+	if prefix, ok := rule(rules, "prefix"); ok && !strings.HasPrefix(value, ruleString(prefix)) {
+		return fmt.Errorf("%s: value does not have prefix %q", path, ruleString(prefix))
+	}
+	if suffix, ok := rule(rules, "suffix"); ok && !strings.HasSuffix(value, ruleString(suffix)) {
+		return fmt.Errorf("%s: value does not have suffix %q", path, ruleString(suffix))
+	}
+	if contains, ok := rule(rules, "contains"); ok && !strings.Contains(value, ruleString(contains)) {
+		return fmt.Errorf("%s: value does not contain substring %q", path, ruleString(contains))
+	}
+	return nil
+}
+
+// ruleString returns a string or bytes rule as a string
+func ruleString(value protoreflect.Value) string {
+	if bytes, ok := value.Interface().([]byte); ok {
+		return string(bytes)
+	}
+	return value.String()
+}
+
+func checkEnum(enum protoreflect.EnumDescriptor, value protoreflect.EnumNumber, path string, rules protoreflect.Message) error {
+	if expected, ok := rule(rules, "const"); ok && value != protoreflect.EnumNumber(expected.Int()) {
+		return fmt.Errorf("%s: value must equal %d", path, expected.Int())
+	}
+	if definedOnly, ok := rule(rules, "defined_only"); ok && definedOnly.Bool() && enum.Values().ByNumber(value) == nil {
+		return fmt.Errorf("%s: value must be one of the defined enum values", path)
+	}
+	return checkIn(protoreflect.ValueOfEnum(value), path, rules, func(a, b protoreflect.Value) bool {
+		return a.Enum() == protoreflect.EnumNumber(b.Int())
+	}, formatNumber)
+}
+
+func checkAny(any protoreflect.Message, path string, rules protoreflect.Message) error {
+	typeURL := any.Get(any.Descriptor().Fields().ByName("type_url"))
+	return checkIn(typeURL, path, rules, func(a, b protoreflect.Value) bool {
+		return a.String() == b.String()
+	}, func(value protoreflect.Value) string {
+		return fmt.Sprintf("%q", value.String())
+	})
+}
+
+// seconds and nanos of a google.protobuf.Duration or Timestamp
+func secondsAndNanos(message protoreflect.Message) (int64, int32) {
+	fields := message.Descriptor().Fields()
+	return message.Get(fields.ByName("seconds")).Int(), int32(message.Get(fields.ByName("nanos")).Int())
+}
+
+func compareTimes(a, b protoreflect.Value) int {
+	aSeconds, aNanos := secondsAndNanos(a.Message())
+	bSeconds, bNanos := secondsAndNanos(b.Message())
+	if aSeconds != bSeconds {
+		return compareNumbers(protoreflect.ValueOfInt64(aSeconds), protoreflect.ValueOfInt64(bSeconds))
+	}
+	return compareNumbers(protoreflect.ValueOfInt32(aNanos), protoreflect.ValueOfInt32(bNanos))
+}
+
+func formatDuration(value protoreflect.Value) string {
+	seconds, nanos := secondsAndNanos(value.Message())
+	if seconds > math.MaxInt64/int64(time.Second) || seconds < math.MinInt64/int64(time.Second) {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	return (time.Duration(seconds)*time.Second + time.Duration(nanos)).String()
+}
+
+func formatTimestamp(value protoreflect.Value) string {
+	seconds, nanos := secondsAndNanos(value.Message())
+	return time.Unix(seconds, int64(nanos)).UTC().Format(time.RFC3339Nano)
+}
+
+func checkDuration(duration protoreflect.Message, path string, rules protoreflect.Message) error {
+	return checkNumber(protoreflect.ValueOfMessage(duration), path, rules, compareTimes, formatDuration)
+}
+
+func checkTimestamp(timestamp protoreflect.Message, path string, rules protoreflect.Message) error {
+	if err := checkNumber(protoreflect.ValueOfMessage(timestamp), path, rules, compareTimes, formatTimestamp); err != nil {
+		return err
+	}
+	seconds, nanos := secondsAndNanos(timestamp)
+	value := time.Unix(seconds, int64(nanos))
+	now := time.Now()
+	if ltNow, ok := rule(rules, "lt_now"); ok && ltNow.Bool() && !value.Before(now) {
+		return fmt.Errorf("%s: value must be less than now", path)
+	}
+	if gtNow, ok := rule(rules, "gt_now"); ok && gtNow.Bool() && !value.After(now) {
+		return fmt.Errorf("%s: value must be greater than now", path)
+	}
+	if within, ok := ruleMessage(rules, "within"); ok {
+		seconds, nanos := secondsAndNanos(within)
+		window := time.Duration(seconds)*time.Second + time.Duration(nanos)
+		if value.Before(now.Add(-window)) || value.After(now.Add(window)) {
+			return fmt.Errorf("%s: value must be within %s of now", path, window)
+		}
+	}
+	return nil
+}
+
+func isIP(ip net.IP, version protoreflect.Name) bool {
+	switch version {
+	case "ipv4":
+		return ip.To4() != nil
+	case "ipv6":
+		return ip != nil && ip.To4() == nil
+	}
+	return ip != nil
+}
+
+func ipName(version protoreflect.Name) string {
+	return map[protoreflect.Name]string{"ip": "IP", "ipv4": "IPv4", "ipv6": "IPv6"}[version]
+}
+
+func isHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Name != "" || address.Address != value || len(value) > 254 {
+		return false
+	}
+	at := strings.LastIndex(value, "@")
+	return at <= 64 && isHostname(value[at+1:])
+}
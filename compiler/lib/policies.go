@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DefaultPolicyQuery is the Rego query outputs are evaluated with when the
+// workspace doesn't set one, the `deny' rules of the `protoconf' package
+const DefaultPolicyQuery = "data.protoconf.deny"
+
+// policyInput is the input document of the policies, one per output
+type policyInput struct {
+	// Config is the path of the config, relative to the src dir
+	Config string `json:"config"`
+	// Output is the key of the output in the dict returned by a `.mpconf',
+	// empty for a `.pconf'
+	Output string `json:"output"`
+	Env    string `json:"env"`
+	// Type is the full name of the message of the output
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// opaResult is the output of `opa eval --format json'
+type opaResult struct {
+	Result []struct {
+		Expressions []struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"expressions"`
+	} `json:"result"`
+}
+
+// SetPolicyBundle sets the bundle of Rego policies, a directory or a bundle
+// archive, every output is evaluated against by the `opa' CLI. Outputs
+// denied by the policies fail to compile.
+func (c *Compiler) SetPolicyBundle(bundle string) {
+	c.policyBundle = bundle
+}
+
+// policyViolations evaluates an output as JSON against the policy bundle,
+// returning the messages of the rules which denied it. No bundle, no
+// violations.
+func (c *Compiler) policyViolations(configFile *config, outputKey string, message protoreflect.Message) ([]string, error) {
+	if c.policyBundle == "" {
+		return nil, nil
+	}
+	value, err := protojson.MarshalOptions{Resolver: configFile.anyResolver}.Marshal(message.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling the output to JSON, err: %v", err)
+	}
+	input, err := json.Marshal(policyInput{
+		Config: configFile.filename,
+		Output: outputKey,
+		Env:    c.environment,
+		Type:   string(message.Descriptor().FullName()),
+		Value:  value,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(c.opaBinary, "eval", "--format", "json", "--bundle", c.policyBundle, "--stdin-input", c.policyQuery)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating policies of %s, err: %v %s", c.policyBundle, err, strings.TrimSpace(stderr.String()))
+	}
+	var result opaResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("error decoding the result of policies of %s, err: %v", c.policyBundle, err)
+	}
+
+	var violations []string
+	for _, result := range result.Result {
+		for _, expression := range result.Expressions {
+			found, err := policyMessages(expression.Value)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding the result of %s, err: %v", c.policyQuery, err)
+			}
+			violations = append(violations, found...)
+		}
+	}
+	return violations, nil
+}
+
+// policyMessages reads the messages of the rules which denied an output: a
+// set of strings, or of objects with a `msg', as conftest policies return
+func policyMessages(value json.RawMessage) ([]string, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(value, &items); err != nil {
+		return nil, fmt.Errorf("expected a set of messages, got: %s", value)
+	}
+	var messages []string
+	for _, item := range items {
+		var message string
+		if err := json.Unmarshal(item, &message); err == nil {
+			messages = append(messages, message)
+			continue
+		}
+		var object struct {
+			Msg string `json:"msg"`
+		}
+		if err := json.Unmarshal(item, &object); err != nil || object.Msg == "" {
+			return nil, fmt.Errorf("expected a message or an object with a msg, got: %s", item)
+		}
+		messages = append(messages, object.Msg)
+	}
+	return messages, nil
+}
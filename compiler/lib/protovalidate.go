@@ -0,0 +1,640 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Options of protovalidate, declared in buf/validate/validate.proto of
+// github.com/bufbuild/protovalidate. Standard rules carry their CEL expressions
+// in the predefined option of each rule, named priv.field before v0.8.
+const (
+	bufValidateField      protoreflect.FullName = "buf.validate.field"
+	bufValidateMessage    protoreflect.FullName = "buf.validate.message"
+	bufValidateOneof      protoreflect.FullName = "buf.validate.oneof"
+	bufValidatePredefined protoreflect.FullName = "buf.validate.predefined"
+	bufValidatePrivField  protoreflect.FullName = "buf.validate.priv.field"
+)
+
+// violation is a constraint a config doesn't satisfy
+type violation struct {
+	path    string
+	id      string
+	message string
+}
+
+func (v violation) String() string {
+	text := v.message
+	if v.id != "" {
+		text = fmt.Sprintf("%s [%s]", text, v.id)
+	}
+	if v.path == "" {
+		return text
+	}
+	return v.path + ": " + text
+}
+
+// constraintChecker evaluates the protovalidate constraints of the messages of
+// a config, compiling each CEL expression once
+type constraintChecker struct {
+	config   *config
+	env      *cel.Env
+	programs map[string]cel.Program
+	// programsLock guards programs, the outputs of a config are checked
+	// concurrently
+	programsLock sync.Mutex
+	now          time.Time
+}
+
+func (c *config) newConstraintChecker() (*constraintChecker, error) {
+	options := []cel.EnvOption{
+		ext.Strings(),
+		cel.Variable("this", cel.DynType),
+		cel.Variable("rules", cel.DynType),
+		cel.Variable("rule", cel.DynType),
+		cel.Variable("now", cel.TimestampType),
+	}
+	options = append(options, constraintFunctions()...)
+	// CEL registers the types of each file without its imports
+	seen := make(map[string]bool)
+	var register func(file protoreflect.FileDescriptor)
+	register = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		options = append(options, cel.TypeDescs(file))
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			register(imports.Get(i).FileDescriptor)
+		}
+	}
+	for _, file := range c.protoFiles {
+		register(file)
+	}
+	env, err := cel.NewEnv(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &constraintChecker{config: c, env: env, programs: make(map[string]cel.Program), now: time.Now()}, nil
+}
+
+// constraintViolations returns the protovalidate constraints message and the
+// messages nested in it don't satisfy, sorted by path
+func (c *config) constraintViolations(message protoreflect.Message) ([]string, error) {
+	if _, err := c.anyResolver.FindExtensionByName(bufValidateField); err != nil {
+		// The config doesn't load protovalidate, there are no constraints
+		return nil, nil
+	}
+	c.constraintsLock.Lock()
+	if c.constraints == nil {
+		checker, err := c.newConstraintChecker()
+		if err != nil {
+			c.constraintsLock.Unlock()
+			return nil, err
+		}
+		c.constraints = checker
+	}
+	c.constraintsLock.Unlock()
+	var violations []violation
+	if err := c.constraints.checkMessage(message, "", &violations); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].path < violations[j].path
+	})
+	found := make([]string, len(violations))
+	for i, v := range violations {
+		found[i] = v.String()
+	}
+	return found, nil
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func fieldPathName(field protoreflect.FieldDescriptor) string {
+	if field.IsExtension() {
+		return "[" + string(field.FullName()) + "]"
+	}
+	return string(field.Name())
+}
+
+func (k *constraintChecker) checkMessage(message protoreflect.Message, path string, violations *[]violation) error {
+	desc := message.Descriptor()
+	rules, hasRules, err := k.config.customOption(desc, bufValidateMessage)
+	if err != nil {
+		return err
+	}
+	disabled := false
+	if hasRules {
+		if value, ok := rule(rules.Message(), "disabled"); ok {
+			disabled = value.Bool()
+		}
+	}
+
+	if hasRules && !disabled {
+		this := k.env.CELTypeAdapter().NativeToValue(message)
+		if err := k.checkCEL(rules.Message(), this, path, violations); err != nil {
+			return err
+		}
+		if oneofs, ok := rule(rules.Message(), "oneof"); ok {
+			k.checkMessageOneofs(message, oneofs.List(), path, violations)
+		}
+	}
+
+	if !disabled {
+		oneofs := desc.Oneofs()
+		for i := 0; i < oneofs.Len(); i++ {
+			oneof := oneofs.Get(i)
+			rules, ok, err := k.config.customOption(oneof, bufValidateOneof)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if required, ok := rule(rules.Message(), "required"); ok && required.Bool() && message.WhichOneof(oneof) == nil {
+				*violations = append(*violations, violation{joinPath(path, string(oneof.Name())), "required", "exactly one field is required in oneof"})
+			}
+		}
+	}
+
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		var rules protoreflect.Message
+		if !disabled {
+			value, ok, err := k.config.customOption(field, bufValidateField)
+			if err != nil {
+				return err
+			}
+			if ok {
+				rules = value.Message()
+			}
+		}
+		if err := k.checkField(message, field, rules, joinPath(path, fieldPathName(field)), violations); err != nil {
+			return err
+		}
+	}
+
+	// Extensions have no rules of their own, but the messages they hold may
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.IsExtension() {
+			err = k.checkNested(field, value, joinPath(path, fieldPathName(field)), nil, violations)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// checkMessageOneofs checks the `oneof' rules of a message: at most one of
+// their fields is set, and exactly one when required
+func (k *constraintChecker) checkMessageOneofs(message protoreflect.Message, oneofs protoreflect.List, path string, violations *[]violation) {
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i).Message()
+		names, _ := rule(oneof, "fields")
+		var set, all []string
+		for j := 0; names.IsValid() && j < names.List().Len(); j++ {
+			name := names.List().Get(j).String()
+			all = append(all, name)
+			if field := message.Descriptor().Fields().ByName(protoreflect.Name(name)); field != nil && message.Has(field) {
+				set = append(set, name)
+			}
+		}
+		if len(set) > 1 {
+			*violations = append(*violations, violation{path, "message.oneof", fmt.Sprintf("only one of %s can be set", strings.Join(all, ", "))})
+		}
+		if required, ok := rule(oneof, "required"); ok && required.Bool() && len(set) == 0 {
+			*violations = append(*violations, violation{path, "message.oneof", fmt.Sprintf("one of %s must be set", strings.Join(all, ", "))})
+		}
+	}
+}
+
+// ignored returns how the `ignore' rule of rules skips a field: always, or
+// when it isn't populated
+func ignored(rules protoreflect.Message) (always bool, unpopulated bool) {
+	if value, ok := rule(rules, "ignore"); ok {
+		field := rules.Descriptor().Fields().ByName("ignore")
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			name := string(enumValue.Name())
+			switch {
+			case strings.HasSuffix(name, "_ALWAYS"):
+				return true, true
+			case strings.Contains(name, "UNPOPULATED"), strings.Contains(name, "ZERO_VALUE"),
+				strings.Contains(name, "DEFAULT_VALUE"), strings.Contains(name, "EMPTY"):
+				return false, true
+			}
+		}
+	}
+	if value, ok := rule(rules, "skipped"); ok && value.Bool() {
+		return true, true
+	}
+	if value, ok := rule(rules, "ignore_empty"); ok && value.Bool() {
+		return false, true
+	}
+	return false, false
+}
+
+// checkField checks a field of message against its rules, which may be nil,
+// and the messages it holds against their own rules
+func (k *constraintChecker) checkField(message protoreflect.Message, field protoreflect.FieldDescriptor, rules protoreflect.Message, path string, violations *[]violation) error {
+	if rules != nil {
+		always, unpopulated := ignored(rules)
+		if always {
+			return nil
+		}
+		if !message.Has(field) {
+			if required, ok := rule(rules, "required"); ok && required.Bool() {
+				*violations = append(*violations, violation{path, "required", "value is required"})
+				return nil
+			}
+			if unpopulated || field.HasPresence() {
+				return nil
+			}
+		}
+		var this ref.Val
+		if field.IsMap() {
+			// Maps are only adapted along with the field describing them
+			parent := k.env.CELTypeAdapter().NativeToValue(message).(traits.Indexer)
+			this = parent.Get(types.String(field.Name()))
+		} else {
+			this = k.celValue(field, message.Get(field))
+		}
+		if err := k.checkCEL(rules, this, path, violations); err != nil {
+			return err
+		}
+		name, typed := typeRules(rules)
+		if typed != nil {
+			if err := k.checkPredefined(typed, this, path, violations); err != nil {
+				return err
+			}
+		}
+		if field.IsList() || field.IsMap() {
+			return k.checkElements(field, message.Get(field), path, name, typed, violations)
+		}
+	}
+	if !message.Has(field) {
+		return nil
+	}
+	return k.checkNested(field, message.Get(field), path, nil, violations)
+}
+
+// checkElements checks the elements of a repeated field or the keys and
+// values of a map against the items, keys and values rules
+func (k *constraintChecker) checkElements(field protoreflect.FieldDescriptor, value protoreflect.Value, path string, name protoreflect.Name, typed protoreflect.Message, violations *[]violation) error {
+	if field.IsList() {
+		var items protoreflect.Message
+		if name == "repeated" {
+			items, _ = ruleMessage(typed, "items")
+		}
+		return k.checkNested(field, value, path, items, violations)
+	}
+	var keys, values protoreflect.Message
+	if name == "map" {
+		keys, _ = ruleMessage(typed, "keys")
+		values, _ = ruleMessage(typed, "values")
+	}
+	var err error
+	value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+		elemPath := fmt.Sprintf("%s[%s]", path, formatMapKey(key))
+		if keys != nil {
+			if err = k.checkElement(field.MapKey(), key.Value(), elemPath, keys, violations); err != nil {
+				return false
+			}
+		}
+		if values != nil {
+			err = k.checkElement(field.MapValue(), value, elemPath, values, violations)
+		} else if field.MapValue().Message() != nil {
+			err = k.checkMessage(value.Message(), elemPath, violations)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// checkNested checks the messages held by a field against their own rules,
+// checking the elements of repeated fields against items when it's set
+func (k *constraintChecker) checkNested(field protoreflect.FieldDescriptor, value protoreflect.Value, path string, items protoreflect.Message, violations *[]violation) error {
+	switch {
+	case field.IsMap():
+		return k.checkElements(field, value, path, "", nil, violations)
+	case field.IsList():
+		list := value.List()
+		for i := 0; i < list.Len(); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			var err error
+			if items != nil {
+				err = k.checkElement(field, list.Get(i), elemPath, items, violations)
+			} else if field.Message() != nil {
+				err = k.checkMessage(list.Get(i).Message(), elemPath, violations)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case field.Message() != nil:
+		return k.checkMessage(value.Message(), path, violations)
+	}
+	return nil
+}
+
+// checkElement checks an element of a repeated field, or a key or a value of
+// a map, against its rules
+func (k *constraintChecker) checkElement(field protoreflect.FieldDescriptor, value protoreflect.Value, path string, rules protoreflect.Message, violations *[]violation) error {
+	if always, _ := ignored(rules); always {
+		return nil
+	}
+	this := k.celValue(field, value)
+	if err := k.checkCEL(rules, this, path, violations); err != nil {
+		return err
+	}
+	if _, typed := typeRules(rules); typed != nil {
+		if err := k.checkPredefined(typed, this, path, violations); err != nil {
+			return err
+		}
+	}
+	if field.Message() != nil {
+		return k.checkMessage(value.Message(), path, violations)
+	}
+	return nil
+}
+
+// celValue converts a single value of field, or a list of its values, to CEL
+func (k *constraintChecker) celValue(field protoreflect.FieldDescriptor, value protoreflect.Value) ref.Val {
+	switch native := value.Interface().(type) {
+	case protoreflect.EnumNumber:
+		return types.Int(native)
+	case protoreflect.List:
+		return types.NewProtoList(k.env.CELTypeAdapter(), native)
+	}
+	return k.env.CELTypeAdapter().NativeToValue(value.Interface())
+}
+
+// checkCEL evaluates the `cel' constraints of rules against this
+func (k *constraintChecker) checkCEL(rules protoreflect.Message, this ref.Val, path string, violations *[]violation) error {
+	constraints, ok := rule(rules, "cel")
+	if !ok {
+		return nil
+	}
+	return k.evaluate(constraints.List(), map[string]interface{}{"this": this, "now": k.now}, path, violations)
+}
+
+// checkPredefined evaluates the CEL expressions of the standard rules set in
+// typed, the rules of one type such as `Int32Rules', against this
+func (k *constraintChecker) checkPredefined(typed protoreflect.Message, this ref.Val, path string, violations *[]violation) error {
+	var err error
+	typed.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		for _, name := range []protoreflect.FullName{bufValidatePredefined, bufValidatePrivField} {
+			predefined, ok, optionErr := k.config.customOption(field, name)
+			if err = optionErr; err != nil {
+				return false
+			}
+			if !ok {
+				continue
+			}
+			constraints, ok := rule(predefined.Message(), "cel")
+			if !ok {
+				continue
+			}
+			activation := map[string]interface{}{
+				"this":  this,
+				"rules": k.env.CELTypeAdapter().NativeToValue(typed),
+				"rule":  k.celValue(field, value),
+				"now":   k.now,
+			}
+			if err = k.evaluate(constraints.List(), activation, path, violations); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// evaluate runs a list of `Constraint' (or `Rule') messages. An expression
+// is violated when it returns false, or a message other than "".
+func (k *constraintChecker) evaluate(constraints protoreflect.List, activation map[string]interface{}, path string, violations *[]violation) error {
+	for i := 0; i < constraints.Len(); i++ {
+		constraint := constraints.Get(i).Message()
+		get := func(name protoreflect.Name) string {
+			value, _ := rule(constraint, name)
+			if !value.IsValid() {
+				return ""
+			}
+			return value.String()
+		}
+		id, expression := get("id"), get("expression")
+		program, err := k.program(expression)
+		if err != nil {
+			return fmt.Errorf("error compiling constraint %s of %s: %v", id, path, err)
+		}
+		result, _, err := program.Eval(activation)
+		if err != nil {
+			return fmt.Errorf("error evaluating constraint %s of %s: %v", id, path, err)
+		}
+		switch result := result.(type) {
+		case types.String:
+			if result != "" {
+				*violations = append(*violations, violation{path, id, string(result)})
+			}
+		case types.Bool:
+			if !result {
+				message := get("message")
+				if message == "" {
+					message = fmt.Sprintf("%q returned false", expression)
+				}
+				*violations = append(*violations, violation{path, id, message})
+			}
+		default:
+			return fmt.Errorf("constraint %s of %s returned a %s, expected a bool or a string", id, path, result.Type().TypeName())
+		}
+	}
+	return nil
+}
+
+func (k *constraintChecker) program(expression string) (cel.Program, error) {
+	k.programsLock.Lock()
+	defer k.programsLock.Unlock()
+	if program, ok := k.programs[expression]; ok {
+		return program, nil
+	}
+	ast, issues := k.env.Compile(expression)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	program, err := k.env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	k.programs[expression] = program
+	return program, nil
+}
+
+// constraintFunctions declares the CEL functions protovalidate adds to the
+// standard ones
+func constraintFunctions() []cel.EnvOption {
+	stringCheck := func(check func(string) bool) cel.OverloadOpt {
+		return cel.UnaryBinding(func(value ref.Val) ref.Val {
+			return types.Bool(check(string(value.(types.String))))
+		})
+	}
+	ipVersion := func(ip net.IP, version int64) bool {
+		switch version {
+		case 0:
+			return ip != nil
+		case 4:
+			return ip.To4() != nil
+		case 6:
+			return ip != nil && ip.To4() == nil
+		}
+		return false
+	}
+	ipPrefix := func(value string, version int64, strict bool) bool {
+		ip, network, err := net.ParseCIDR(value)
+		if err != nil || !ipVersion(ip, version) {
+			return false
+		}
+		return !strict || ip.Equal(network.IP)
+	}
+	bytesCheck := func(check func(string, string) bool) cel.OverloadOpt {
+		return cel.BinaryBinding(func(value, other ref.Val) ref.Val {
+			return types.Bool(check(string(value.(types.Bytes)), string(other.(types.Bytes))))
+		})
+	}
+
+	return []cel.EnvOption{
+		cel.Function("isNan",
+			cel.MemberOverload("double_is_nan_bool", []*cel.Type{cel.DoubleType}, cel.BoolType,
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					return types.Bool(math.IsNaN(float64(value.(types.Double))))
+				}))),
+		cel.Function("isInf",
+			cel.MemberOverload("double_is_inf_bool", []*cel.Type{cel.DoubleType}, cel.BoolType,
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					return types.Bool(math.IsInf(float64(value.(types.Double)), 0))
+				})),
+			cel.MemberOverload("double_int_is_inf_bool", []*cel.Type{cel.DoubleType, cel.IntType}, cel.BoolType,
+				cel.BinaryBinding(func(value, sign ref.Val) ref.Val {
+					return types.Bool(math.IsInf(float64(value.(types.Double)), int(sign.(types.Int))))
+				}))),
+		cel.Function("isEmail",
+			cel.MemberOverload("string_is_email_bool", []*cel.Type{cel.StringType}, cel.BoolType, stringCheck(isEmail))),
+		cel.Function("isHostname",
+			cel.MemberOverload("string_is_hostname_bool", []*cel.Type{cel.StringType}, cel.BoolType, stringCheck(isHostname))),
+		cel.Function("isUri",
+			cel.MemberOverload("string_is_uri_bool", []*cel.Type{cel.StringType}, cel.BoolType, stringCheck(func(value string) bool {
+				u, err := url.Parse(value)
+				return err == nil && u.IsAbs()
+			}))),
+		cel.Function("isUriRef",
+			cel.MemberOverload("string_is_uri_ref_bool", []*cel.Type{cel.StringType}, cel.BoolType, stringCheck(func(value string) bool {
+				_, err := url.Parse(value)
+				return err == nil
+			}))),
+		cel.Function("isIp",
+			cel.MemberOverload("string_is_ip_bool", []*cel.Type{cel.StringType}, cel.BoolType, stringCheck(func(value string) bool {
+				return net.ParseIP(value) != nil
+			})),
+			cel.MemberOverload("string_int_is_ip_bool", []*cel.Type{cel.StringType, cel.IntType}, cel.BoolType,
+				cel.BinaryBinding(func(value, version ref.Val) ref.Val {
+					return types.Bool(ipVersion(net.ParseIP(string(value.(types.String))), int64(version.(types.Int))))
+				}))),
+		cel.Function("isIpPrefix",
+			cel.MemberOverload("string_is_ip_prefix_bool", []*cel.Type{cel.StringType}, cel.BoolType, stringCheck(func(value string) bool {
+				return ipPrefix(value, 0, false)
+			})),
+			cel.MemberOverload("string_int_is_ip_prefix_bool", []*cel.Type{cel.StringType, cel.IntType}, cel.BoolType,
+				cel.BinaryBinding(func(value, version ref.Val) ref.Val {
+					return types.Bool(ipPrefix(string(value.(types.String)), int64(version.(types.Int)), false))
+				})),
+			cel.MemberOverload("string_bool_is_ip_prefix_bool", []*cel.Type{cel.StringType, cel.BoolType}, cel.BoolType,
+				cel.BinaryBinding(func(value, strict ref.Val) ref.Val {
+					return types.Bool(ipPrefix(string(value.(types.String)), 0, bool(strict.(types.Bool))))
+				})),
+			cel.MemberOverload("string_int_bool_is_ip_prefix_bool", []*cel.Type{cel.StringType, cel.IntType, cel.BoolType}, cel.BoolType,
+				cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+					return types.Bool(ipPrefix(string(args[0].(types.String)), int64(args[1].(types.Int)), bool(args[2].(types.Bool))))
+				}))),
+		cel.Function("isHostAndPort",
+			cel.MemberOverload("string_bool_is_host_and_port_bool", []*cel.Type{cel.StringType, cel.BoolType}, cel.BoolType,
+				cel.BinaryBinding(func(value, portRequired ref.Val) ref.Val {
+					return types.Bool(isHostAndPort(string(value.(types.String)), bool(portRequired.(types.Bool))))
+				}))),
+		cel.Function("unique",
+			cel.MemberOverload("list_unique_bool", []*cel.Type{cel.ListType(cel.DynType)}, cel.BoolType,
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					list := value.(traits.Lister)
+					size := int64(list.Size().(types.Int))
+					for i := int64(0); i < size; i++ {
+						for j := i + 1; j < size; j++ {
+							if list.Get(types.Int(i)).Equal(list.Get(types.Int(j))) == types.True {
+								return types.False
+							}
+						}
+					}
+					return types.True
+				}))),
+		cel.Function("startsWith",
+			cel.MemberOverload("bytes_starts_with_bytes", []*cel.Type{cel.BytesType, cel.BytesType}, cel.BoolType, bytesCheck(strings.HasPrefix))),
+		cel.Function("endsWith",
+			cel.MemberOverload("bytes_ends_with_bytes", []*cel.Type{cel.BytesType, cel.BytesType}, cel.BoolType, bytesCheck(strings.HasSuffix))),
+		cel.Function("contains",
+			cel.MemberOverload("bytes_contains_bytes", []*cel.Type{cel.BytesType, cel.BytesType}, cel.BoolType, bytesCheck(strings.Contains))),
+	}
+}
+
+// isHostAndPort reports whether value is a hostname or an IP address (in
+// brackets for IPv6) followed by a port, which may be optional
+func isHostAndPort(value string, portRequired bool) bool {
+	host, port := value, ""
+	if strings.HasPrefix(value, "[") {
+		end := strings.Index(value, "]")
+		if end < 0 {
+			return false
+		}
+		host, port = value[1:end], strings.TrimPrefix(value[end+1:], ":")
+		if port == "" && (portRequired || end+1 != len(value)) {
+			return false
+		}
+		if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+			return false
+		}
+	} else {
+		if i := strings.LastIndex(value, ":"); i >= 0 {
+			host, port = value[:i], value[i+1:]
+			if port == "" {
+				return false
+			}
+		} else if portRequired {
+			return false
+		}
+		if !isHostname(host) && net.ParseIP(host).To4() == nil {
+			return false
+		}
+	}
+	if port == "" {
+		return true
+	}
+	number, err := strconv.ParseUint(port, 10, 16)
+	return err == nil && (len(port) == 1 || port[0] != '0') && number <= math.MaxUint16
+}
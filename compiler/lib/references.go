@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/protoconf/protoconf/consts"
+	"go.starlark.net/starlark"
+)
+
+// referencesLocal is the thread local holding the references declared by the
+// config being evaluated
+const referencesLocal = "protoconf.references"
+
+// reference is an output a config refers to, by its name relative to the
+// materialized dir without the extension
+type reference struct {
+	config string
+	output string
+	pos    string
+}
+
+// references collects the outputs referred to by the Starlark code of a
+// compilation with ref()
+type references struct {
+	lock    sync.Mutex
+	outputs []reference
+}
+
+// AttachTo records the references declared by thread to r
+func (r *references) AttachTo(thread *starlark.Thread) {
+	thread.SetLocal(referencesLocal, r)
+}
+
+// starRef declares a reference to the output of another config, which must be
+// compiled along with the config or already be materialized. `ref(output)'
+// refers to the output of a `.pconf' and returns its name, `ref(config, key)'
+// refers to an output of a `.mpconf' and returns the key.
+func starRef(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, key string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "output", &name, "key?", &key); err != nil {
+		return nil, err
+	}
+	output := path.Clean(strings.TrimPrefix(name, "/"))
+	if key != "" {
+		output = path.Join(output, key)
+	}
+	if name == "" || output == "." || strings.HasPrefix(output, "../") {
+		return nil, fmt.Errorf("%s: invalid output %q", fn.Name(), output)
+	}
+
+	if r, ok := t.Local(referencesLocal).(*references); ok {
+		pos := t.CallFrame(1).Pos
+		r.lock.Lock()
+		r.outputs = append(r.outputs, reference{output: output, pos: pos.String()})
+		r.lock.Unlock()
+	}
+	if key != "" {
+		return starlark.String(key), nil
+	}
+	return starlark.String(name), nil
+}
+
+// outputName is the name outputs are referred to by, the materialized file
+// relative to the materialized dir without the extension
+func (c *Compiler) outputName(outputFile string) string {
+	name := outputFile
+	if rel, err := filepath.Rel(c.MaterializedDir, outputFile); err == nil {
+		name = filepath.ToSlash(rel)
+	}
+	return strings.TrimSuffix(name, consts.CompiledConfigExtension)
+}
+
+// addReferences keeps the outputs and the references of a compiled config to
+// check them once every config is compiled
+func (c *Compiler) addReferences(configFile *config, outputFiles []string) {
+	c.outputsLock.Lock()
+	defer c.outputsLock.Unlock()
+	for _, outputFile := range outputFiles {
+		c.compiled[c.outputName(outputFile)] = true
+	}
+	for _, ref := range configFile.references.outputs {
+		ref.config = configFile.filename
+		c.references = append(c.references, ref)
+	}
+}
+
+// Compiled lists the names of the outputs compiled so far, the materialized
+// files relative to the materialized dir without the extension, in order
+func (c *Compiler) Compiled() []string {
+	c.outputsLock.Lock()
+	defer c.outputsLock.Unlock()
+	names := make([]string, 0, len(c.compiled))
+	for name := range c.compiled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckReferences fails on the references declared with ref() by the configs
+// compiled so far to outputs that are neither compiled nor materialized.
+// References aren't checked when validation is disabled.
+func (c *Compiler) CheckReferences() error {
+	if c.disableValidation {
+		return nil
+	}
+	c.outputsLock.Lock()
+	refs := append([]reference(nil), c.references...)
+	compiled := make(map[string]bool, len(c.compiled))
+	for name := range c.compiled {
+		compiled[name] = true
+	}
+	c.outputsLock.Unlock()
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].config < refs[j].config
+	})
+
+	var failures []string
+	for _, ref := range refs {
+		if compiled[ref.output] {
+			continue
+		}
+		filename := filepath.Join(c.MaterializedDir, filepath.FromSlash(ref.output)+consts.CompiledConfigExtension)
+		exists, isDir, err := stat(filename)
+		if err != nil {
+			return err
+		}
+		if exists && !isDir {
+			continue
+		}
+		failure := fmt.Sprintf("%s: %s is not an output of any config", ref.pos, ref.output)
+		c.report.add(ReportEntry{Config: ref.config, Kind: "dangling references", Severity: SeverityError, Message: failure})
+		failures = append(failures, failure)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("dangling references:\n  %s", strings.Join(failures, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Severities of the entries of a report
+const (
+	// SeverityError fails compiling the config
+	SeverityError = "error"
+	// SeverityWarning is only logged
+	SeverityWarning = "warning"
+)
+
+// ReportEntry is a violation or a warning found compiling a config
+type ReportEntry struct {
+	// Config is the config file compiled
+	Config string `json:"config"`
+	// Output is the materialized config the entry was found in, relative to the
+	// materialized dir. It's empty for entries found evaluating the config.
+	Output   string `json:"output,omitempty"`
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Report collects the violations and warnings of every config compiled, which
+// may be compiled concurrently
+type Report struct {
+	lock    sync.Mutex
+	entries []ReportEntry
+}
+
+func (r *Report) add(entry ReportEntry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// Entries returns the entries sorted by config and output, keeping the order
+// they were found in within an output
+func (r *Report) Entries() []ReportEntry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entries := append([]ReportEntry(nil), r.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Config != entries[j].Config {
+			return entries[i].Config < entries[j].Config
+		}
+		return entries[i].Output < entries[j].Output
+	})
+	return entries
+}
+
+// WriteJSON writes the entries of the report with their count per severity
+func (r *Report) WriteJSON(w io.Writer) error {
+	entries := r.Entries()
+	report := struct {
+		Errors   int           `json:"errors"`
+		Warnings int           `json:"warnings"`
+		Entries  []ReportEntry `json:"entries"`
+	}{Entries: entries}
+	if report.Entries == nil {
+		report.Entries = []ReportEntry{}
+	}
+	for _, entry := range entries {
+		switch entry.Severity {
+		case SeverityError:
+			report.Errors++
+		case SeverityWarning:
+			report.Warnings++
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
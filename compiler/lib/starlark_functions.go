@@ -11,8 +11,11 @@ import (
 
 func getModules() starlark.StringDict {
 	return starlark.StringDict{
-		"fail":   starlark.NewBuiltin("fail", starFail),
-		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+		"fail":     starlark.NewBuiltin("fail", starFail),
+		"proto":    proto.Module(),
+		"ref":      starlark.NewBuiltin("ref", starRef),
+		"struct":   starlark.NewBuiltin("struct", starlarkstruct.Make),
+		"validate": validateModule(),
 	}
 }
 
@@ -30,7 +33,52 @@ func starFail(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwa
 	return nil, fmt.Errorf("[%s] %s\n%s", callStack.At(0).Pos, msg, callStack.String())
 }
 
-func starAddValidator(mp *map[string]*starlark.Function) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+// starWarn reports a problem found by a validator without failing the
+// compilation, so new constraints can be rolled out gradually
+func starWarn(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &msg); err != nil {
+		return nil, err
+	}
+	v, ok := t.Local(validationLocal).(*validation)
+	if !ok {
+		proto.Warn(t, proto.WarningValidators, msg)
+		return starlark.None, nil
+	}
+	if pos, ok := proto.Position(t); ok {
+		msg = fmt.Sprintf("%s: %s", pos, msg)
+	}
+	for _, warning := range v.warnings {
+		if warning == msg {
+			return starlark.None, nil
+		}
+	}
+	v.warnings = append(v.warnings, msg)
+	return starlark.None, nil
+}
+
+// starAddOutputValidator registers a validator of the dict returned by a
+// `.mpconf', which is only predeclared in multi-configs and their modules
+func starAddOutputValidator(validators *[]*starlark.Function) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var validator *starlark.Function
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &validator); err != nil {
+			return nil, err
+		}
+		if numParams := validator.NumParams(); numParams != 1 {
+			return nil, fmt.Errorf("expected a function that get 1 param, got=%d", numParams)
+		}
+		for _, added := range *validators {
+			if added == validator {
+				return starlark.None, nil
+			}
+		}
+		*validators = append(*validators, validator)
+		return starlark.None, nil
+	}
+}
+
+func starAddValidator(mp *map[string][]*starlark.Function) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
 	addValidator := func(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		var arg1 starlark.Value
 		var arg2 starlark.Value
@@ -45,14 +93,22 @@ func starAddValidator(mp *map[string]*starlark.Function) func(*starlark.Thread,
 
 		validator, ok := arg2.(*starlark.Function)
 		if ok {
-			if numParams := validator.NumParams(); numParams != 1 {
-				return nil, fmt.Errorf("expected a function that get 1 param, got=%d", numParams)
+			// The second param is the context of the validation
+			if numParams := validator.NumParams(); numParams != 1 && numParams != 2 {
+				return nil, fmt.Errorf("expected a function that get 1 or 2 params, got=%d", numParams)
 			}
 		} else {
 			return nil, fmt.Errorf("expected a function, got=%v", validator)
 		}
 
-		(*mp)[messageName] = validator
+		// Validators accumulate, a module registering the same function
+		// twice doesn't run it twice
+		for _, registered := range (*mp)[messageName] {
+			if registered == validator {
+				return starlark.None, nil
+			}
+		}
+		(*mp)[messageName] = append((*mp)[messageName], validator)
 
 		return starlark.None, nil
 	}
@@ -1,24 +1,29 @@
 package lib
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
 
-	"github.com/golang/protobuf/jsonpb"
-	"github.com/golang/protobuf/ptypes"
-	"github.com/jhump/protoreflect/desc/protoparse"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/protoconf/protoconf/compiler/proto"
 	"github.com/protoconf/protoconf/consts"
 	pc "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/tracing"
+	"github.com/protoconf/protoconf/utils"
 	"github.com/qri-io/starlib"
+	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/encoding/protojson"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 type cacheEntry struct {
@@ -26,32 +31,149 @@ type cacheEntry struct {
 	err     error
 }
 
+// protoNamespace is the `protos' global, holding the types of the loaded protos
+type protoNamespace interface {
+	starlark.Value
+	AddFile(file protoreflect.FileDescriptor)
+}
+
 type starlarkLoader struct {
+	// ctx holds the span of loading the config, the protos parsed are traced
+	// under it
+	ctx              context.Context
 	cache            map[string]*cacheEntry
+	importPaths      []string
+	archives         []*sourceArchive
+	cacheDir         string
 	Modules          starlark.StringDict
+	protos           protoNamespace
+	prototypes       *proto.Prototypes
+	warnings         *proto.Warnings
+	options          *proto.Options
+	references       *references
 	mutableDir       string
 	protoFilesLoaded *[]string
-	srcDir           string
+	// protoFiles are the descriptors of the loaded protos and mutable configs
+	protoFiles []protoreflect.FileDescriptor
+	// unusedLoads describes the loaded symbols never used by the loading module
+	unusedLoads []string
+	// loaded are the modules loaded, validatorsHash is the hash of the
+	// validator files loaded and of the modules they load, and configHash the
+	// hash of the config and of the modules it loads
+	loaded         map[string]*module
+	validatorsHash string
+	configHash     string
+	srcDir         string
 }
 
 func (l *starlarkLoader) protoAccessor(name string) (io.ReadCloser, error) {
-	if !strings.HasPrefix(name, l.srcDir) {
-		return nil, fmt.Errorf("proto path must be under %s, got=%s", l.srcDir, name)
+	for _, importPath := range l.importPaths {
+		if underPath(name, importPath) {
+			reader, err := openFile(name)
+			if err == nil {
+				*l.protoFilesLoaded = append(*l.protoFilesLoaded, strings.TrimPrefix(name, importPath))
+			}
+			return reader, err
+		}
+	}
+	for _, archive := range l.archives {
+		if underPath(name, archive.root) {
+			relPath := strings.TrimPrefix(name, archive.root)
+			reader, ok := archive.open(relPath)
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			*l.protoFilesLoaded = append(*l.protoFilesLoaded, relPath)
+			return reader, nil
+		}
+	}
+	return nil, fmt.Errorf("proto path must be under one of %v, got=%s", l.importPaths, name)
+}
+
+// underPath reports whether name is dir or a path inside it. A plain prefix
+// match isn't enough, /root/src2/x.proto isn't under /root/src.
+func underPath(name, dir string) bool {
+	dir = strings.TrimSuffix(dir, string(filepath.Separator))
+	return name == dir || strings.HasPrefix(name, dir+string(filepath.Separator))
+}
+
+// parseProtos compiles proto files from the import paths and the source archives
+func (l *starlarkLoader) parseProtos(files ...string) (descriptors []protoreflect.FileDescriptor, err error) {
+	_, span := tracing.Start(l.ctx, "parse protos", tracing.ProtoFilesKey.StringSlice(files))
+	defer func() { tracing.End(span, err) }()
+
+	importPaths := l.importPaths
+	for _, archive := range l.archives {
+		importPaths = append(importPaths[:len(importPaths):len(importPaths)], archive.root)
+	}
+	parser := &utils.ProtoParser{
+		ImportPaths: importPaths,
+		Accessor:    l.protoAccessor,
+		CacheDir:    l.cacheDir,
+	}
+	return parser.Parse(files...)
+}
+
+// openSource opens a file relative to the src dir, falling back to the source archives
+func (l *starlarkLoader) openSource(name string) (io.ReadCloser, error) {
+	reader, err := openFile(filepath.Join(l.srcDir, name))
+	if err == nil {
+		return reader, nil
+	}
+	for _, archive := range l.archives {
+		if reader, ok := archive.open(name); ok {
+			return reader, nil
+		}
+	}
+	return nil, err
+}
+
+func (l *starlarkLoader) statSource(name string) (bool, bool, error) {
+	exists, isDir, err := stat(filepath.Join(l.srcDir, name))
+	if err != nil || exists {
+		return exists, isDir, err
 	}
-	*l.protoFilesLoaded = append(*l.protoFilesLoaded, strings.TrimPrefix(name, l.srcDir))
-	return openFile(name)
+	for _, archive := range l.archives {
+		if reader, ok := archive.open(name); ok {
+			reader.Close()
+			return true, false, nil
+		}
+	}
+	return false, false, nil
 }
 
-func (l *starlarkLoader) loadConfig(moduleName string) (starlark.StringDict, map[string]*starlark.Function, error) {
+func (l *starlarkLoader) newThread() *starlark.Thread {
 	thread := &starlark.Thread{
 		Print: starPrint,
 		Load:  l.Load,
 	}
+	l.prototypes.AttachTo(thread)
+	l.warnings.AttachTo(thread)
+	l.options.AttachTo(thread)
+	l.references.AttachTo(thread)
+	return thread
+}
+
+// AttachTo makes the message defaults, the warnings, the options and the
+// references of the loader available
+// to a thread created outside of it
+func (l *starlarkLoader) AttachTo(thread *starlark.Thread) {
+	l.prototypes.AttachTo(thread)
+	l.warnings.AttachTo(thread)
+	l.options.AttachTo(thread)
+	l.references.AttachTo(thread)
+}
+
+func (l *starlarkLoader) loadConfig(moduleName string) (starlark.StringDict, map[string][]*starlark.Function, error) {
+	thread := l.newThread()
 
 	locals, err := l.Load(thread, moduleName)
 	if err != nil {
 		return nil, nil, err
 	}
+	if modulePath, err := toCanonicalPath(moduleName, ""); err == nil {
+		l.configHash = l.hashModules([]string{modulePath})
+	}
 
 	validators, err := l.loadValidators()
 	if err != nil {
@@ -93,29 +215,31 @@ func (l *starlarkLoader) Load(thread *starlark.Thread, moduleName string) (starl
 	return globals, err
 }
 
-func (l *starlarkLoader) loadValidators() (map[string]*starlark.Function, error) {
-	validators := make(map[string]*starlark.Function)
+func (l *starlarkLoader) loadValidators() (map[string][]*starlark.Function, error) {
+	validators := make(map[string][]*starlark.Function)
+	var validatorModules []string
 
 	l.Modules["add_validator"] = starlark.NewBuiltin("add_validator", starAddValidator(&validators))
+	l.Modules["warn"] = starlark.NewBuiltin("warn", starWarn)
 	for _, protoFile := range *l.protoFilesLoaded {
 		validatorFile := protoFile + consts.ValidatorExtensionSuffix
-		validatorAbsPath := filepath.Join(l.srcDir, validatorFile)
-		if exists, isDir, err := stat(validatorAbsPath); err != nil {
+		if exists, isDir, err := l.statSource(validatorFile); err != nil {
 			return nil, err
 		} else if isDir {
-			return nil, fmt.Errorf("expected validator file and not a directory, file=%s", validatorAbsPath)
+			return nil, fmt.Errorf("expected validator file and not a directory, file=%s", filepath.Join(l.srcDir, validatorFile))
 		} else if !exists {
 			continue
 		}
-		thread := &starlark.Thread{
-			Print: starPrint,
-			Load:  l.Load,
-		}
+		thread := l.newThread()
 
 		if _, err := l.Load(thread, filepath.ToSlash(validatorFile)); err != nil {
 			return nil, err
 		}
+		if modulePath, err := toCanonicalPath(filepath.ToSlash(validatorFile), ""); err == nil {
+			validatorModules = append(validatorModules, modulePath)
+		}
 	}
+	l.validatorsHash = l.hashModules(validatorModules)
 
 	return validators, nil
 }
@@ -148,6 +272,7 @@ func (l *starlarkLoader) loadMutable(modulePath string) (starlark.StringDict, er
 	if err != nil {
 		return nil, fmt.Errorf("error reading from mutable config file, file=%s, err=%s", filename, err)
 	}
+	l.addModule(modulePath, jsonData, nil)
 
 	type configJSONType struct {
 		ProtoFile string
@@ -157,60 +282,52 @@ func (l *starlarkLoader) loadMutable(modulePath string) (starlark.StringDict, er
 		return nil, err
 	}
 
-	parser := &protoparse.Parser{ImportPaths: []string{l.srcDir}, Accessor: l.protoAccessor}
-	descriptors, err := parser.ParseFiles(configJSON.ProtoFile)
+	descriptors, err := l.parseProtos(configJSON.ProtoFile)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing proto file, file=%s err=%s", configJSON.ProtoFile, err)
 	}
-	fileDescriptor := descriptors[0]
-	anyResolver := dynamic.AnyResolver(nil, fileDescriptor)
+	l.protoFiles = append(l.protoFiles, descriptors...)
+	anyResolver := utils.NewAnyResolver(descriptors...)
 
 	protoconfValue := &pc.ProtoconfValue{}
-	um := jsonpb.Unmarshaler{AnyResolver: anyResolver}
-	if err = um.Unmarshal(ioutil.NopCloser(bytes.NewReader(jsonData)), protoconfValue); err != nil {
+	um := protojson.UnmarshalOptions{Resolver: anyResolver}
+	if err = um.Unmarshal(jsonData, protoconfValue); err != nil {
 		return nil, fmt.Errorf("error unmarshaling, err=%s", err)
 	}
 
-	name, err := ptypes.AnyMessageName(protoconfValue.Value)
-	if err != nil {
-		return nil, err
-	}
-
-	value, err := anyResolver.Resolve(name)
-	if err != nil {
-		return nil, err
-	}
-
-	if err = ptypes.UnmarshalAny(protoconfValue.Value, value); err != nil {
-		return nil, err
-	}
-
-	message, err := dynamic.AsDynamicMessage(value)
+	value, err := anypb.UnmarshalNew(protoconfValue.Value, protov2.UnmarshalOptions{Resolver: anyResolver})
 	if err != nil {
 		return nil, err
 	}
 
 	globals := starlark.StringDict{}
-	globals["value"] = proto.NewStarProtoMessage(message)
+	globals["value"] = proto.NewStarProtoMessage(value.ProtoReflect(), l.options)
 	return globals, nil
 }
 
 func (l *starlarkLoader) loadProto(modulePath string) (starlark.StringDict, error) {
-	parser := &protoparse.Parser{ImportPaths: []string{l.srcDir}, Accessor: l.protoAccessor}
-	descriptors, err := parser.ParseFiles(modulePath)
+	descriptors, err := l.parseProtos(modulePath)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing proto file, file=%s err=%v", modulePath, err)
 	}
 	fileDescriptor := descriptors[0]
+	l.addProtoModule(modulePath, fileDescriptor)
+	l.protos.AddFile(fileDescriptor)
+	l.protoFiles = append(l.protoFiles, fileDescriptor)
 	globals := starlark.StringDict{}
-	for _, message := range fileDescriptor.GetMessageTypes() {
-		globals[message.GetName()] = proto.NewMessageType(message)
+	messages := fileDescriptor.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		globals[string(messages.Get(i).Name())] = proto.NewMessageType(messages.Get(i))
+	}
+	extensions := fileDescriptor.Extensions()
+	for i := 0; i < extensions.Len(); i++ {
+		globals[string(extensions.Get(i).Name())] = proto.NewExtension(extensions.Get(i))
 	}
 	return globals, nil
 }
 
 func (l *starlarkLoader) loadStarlark(thread *starlark.Thread, modulePath string) (starlark.StringDict, error) {
-	reader, err := openFile(filepath.Join(l.srcDir, modulePath))
+	reader, err := l.openSource(modulePath)
 	if err != nil {
 		return nil, err
 	}
@@ -220,7 +337,96 @@ func (l *starlarkLoader) loadStarlark(thread *starlark.Thread, modulePath string
 		return nil, err
 	}
 
-	return starlark.ExecFile(thread, modulePath, moduleSource, l.Modules)
+	file, err := syntax.Parse(modulePath, moduleSource, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProtoLoads(file); err != nil {
+		return nil, err
+	}
+	l.addModule(modulePath, moduleSource, file)
+	program, err := starlark.FileProgram(file, l.Modules.Has)
+	if err != nil {
+		return nil, err
+	}
+	l.unusedLoads = append(l.unusedLoads, unusedLoads(file)...)
+
+	globals, err := program.Init(thread, l.Modules)
+	globals.Freeze()
+	return globals, err
+}
+
+// checkProtoLoads fails when a name is loaded from two different proto files,
+// since the later load would silently shadow the first
+func checkProtoLoads(file *syntax.File) error {
+	loadedFrom := make(map[string]string)
+	for _, stmt := range file.Stmts {
+		load, ok := stmt.(*syntax.LoadStmt)
+		if !ok {
+			continue
+		}
+		module := load.ModuleName()
+		if !strings.HasSuffix(module, consts.ProtoExtension) {
+			continue
+		}
+		for i, to := range load.To {
+			if other, ok := loadedFrom[to.Name]; ok && other != module {
+				return fmt.Errorf("%s: %s is loaded from both %s and %s, load it under another name (e.g. load(%q, Other%s=%q)) or use protos[\"<full name>\"]",
+					to.NamePos, to.Name, other, module, module, to.Name, load.From[i].Name)
+			}
+			loadedFrom[to.Name] = module
+		}
+	}
+	return nil
+}
+
+// unusedLoads describes the loads of a resolved file whose symbols are never
+// used, a whole load statement is reported when none of its symbols is used
+func unusedLoads(file *syntax.File) []string {
+	loaded := make(map[*syntax.Ident]bool)
+	for _, stmt := range file.Stmts {
+		if load, ok := stmt.(*syntax.LoadStmt); ok {
+			for _, to := range load.To {
+				loaded[to] = true
+			}
+		}
+	}
+
+	used := make(map[*syntax.Ident]bool)
+	syntax.Walk(file, func(node syntax.Node) bool {
+		id, ok := node.(*syntax.Ident)
+		if !ok || loaded[id] {
+			return true
+		}
+		if binding, ok := id.Binding.(*resolve.Binding); ok && binding.First != nil {
+			used[binding.First] = true
+		}
+		return true
+	})
+
+	var unused []string
+	for _, stmt := range file.Stmts {
+		load, ok := stmt.(*syntax.LoadStmt)
+		if !ok {
+			continue
+		}
+		var names []*syntax.Ident
+		for _, to := range load.To {
+			// Names loaded twice share the binding of their first load
+			binding, ok := to.Binding.(*resolve.Binding)
+			if ok && !used[binding.First] {
+				names = append(names, to)
+			}
+		}
+		if len(names) > 0 && len(names) == len(load.To) {
+			unused = append(unused, fmt.Sprintf("%s: nothing loaded from %s is used", load.Load, load.ModuleName()))
+			continue
+		}
+		for _, name := range names {
+			unused = append(unused, fmt.Sprintf("%s: %s loaded from %s is unused", name.NamePos, name.Name, load.ModuleName()))
+		}
+	}
+	return unused
 }
 
 func toCanonicalPath(name string, fromPath string) (string, error) {
@@ -0,0 +1,5 @@
+module example.com/protoconf_testdata
+
+go 1.16
+
+require example.com/units v1.0.0
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/protoconf/protoconf/compiler/proto"
+	"github.com/protoconf/protoconf/consts"
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// testConfigLocal is the thread local holding the test file being run, the
+// validators of which the assertions check messages with
+const testConfigLocal = "protoconf.test_config"
+
+// TestResult is the outcome of a test function of a test file, Err is nil
+// when it passed
+type TestResult struct {
+	Name string
+	Err  error
+}
+
+// testModules are the builtins predeclared in test files
+func testModules() starlark.StringDict {
+	return starlark.StringDict{
+		"assert_valid":   starlark.NewBuiltin("assert_valid", starAssertValid),
+		"assert_invalid": starlark.NewBuiltin("assert_invalid", starAssertInvalid),
+	}
+}
+
+// RunTests runs the `test_' functions of a test file, in the order of their
+// names. Messages are validated as in the compilation of a config loading the
+// same protos: by their validators, PGV rules and protovalidate constraints.
+func (c *Compiler) RunTests(filename string) ([]TestResult, error) {
+	if !strings.HasSuffix(filename, consts.TestExtension) {
+		return nil, fmt.Errorf("test file must end with %s, got: %s", consts.TestExtension, filename)
+	}
+	testFile, err := c.load(context.Background(), filename)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", filename, err)
+	}
+
+	var names []string
+	for name, value := range testFile.locals {
+		if _, ok := value.(*starlark.Function); ok && strings.HasPrefix(name, "test_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var results []TestResult
+	for _, name := range names {
+		test := testFile.locals[name].(*starlark.Function)
+		if test.NumParams() != 0 {
+			results = append(results, TestResult{Name: name, Err: fmt.Errorf("test functions take no params, got=%d", test.NumParams())})
+			continue
+		}
+		thread := testFile.newThread()
+		thread.SetLocal(testConfigLocal, testFile)
+		_, err := starlark.Call(thread, test, nil, nil)
+		if err != nil {
+			err = withPosition(err)
+		}
+		results = append(results, TestResult{Name: name, Err: err})
+	}
+	return results, nil
+}
+
+// testFailures validates a message passed to an assertion of a test file
+func testFailures(t *starlark.Thread, fn *starlark.Builtin, msg starlark.Value, env string) (protoreflect.Message, []string, error) {
+	testFile, ok := t.Local(testConfigLocal).(*config)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: can only be called from the test functions of a test file", fn.Name())
+	}
+	message, ok := proto.ToProtoMessage(msg)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: expected a proto message, got %s", fn.Name(), msg.Type())
+	}
+	failures, err := testFile.validate(message, "", env)
+	if err != nil {
+		return nil, nil, err
+	}
+	violations, err := testFile.constraintViolations(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	return message, append(failures, violations...), nil
+}
+
+func starAssertValid(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg starlark.Value
+	var env string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "env?", &env); err != nil {
+		return nil, err
+	}
+	message, failures, err := testFailures(t, fn, msg, env)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("expected %s to be valid, got:\n  %s", message.Descriptor().FullName(), strings.Join(failures, "\n  "))
+	}
+	return starlark.None, nil
+}
+
+func starAssertInvalid(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg starlark.Value
+	var contains, env string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "contains?", &contains, "env?", &env); err != nil {
+		return nil, err
+	}
+	message, failures, err := testFailures(t, fn, msg, env)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) == 0 {
+		return nil, fmt.Errorf("expected %s to be invalid, but it passed validation", message.Descriptor().FullName())
+	}
+	if contains != "" && !strings.Contains(strings.Join(failures, "\n"), contains) {
+		return nil, fmt.Errorf("expected %s to be invalid with %q, got:\n  %s", message.Descriptor().FullName(), contains, strings.Join(failures, "\n  "))
+	}
+	return starlark.None, nil
+}
@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// validationPathLocal is the thread local holding the path of the message
+// being validated, which the `validate' helpers prefix the fields with
+const validationPathLocal = "protoconf.validation_path"
+
+// validateModule is the `validate' module of helpers for validators. Each
+// helper checks a field of a message, failing with the path of the field.
+func validateModule() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "validate",
+		Members: starlark.StringDict{
+			"in_range":       starlark.NewBuiltin("validate.in_range", starInRange),
+			"matches":        starlark.NewBuiltin("validate.matches", starMatches),
+			"one_of":         starlark.NewBuiltin("validate.one_of", starOneOf),
+			"non_empty":      starlark.NewBuiltin("validate.non_empty", starNonEmpty),
+			"valid_hostname": starlark.NewBuiltin("validate.valid_hostname", starValidHostname),
+			"valid_url":      starlark.NewBuiltin("validate.valid_url", starValidURL),
+			"unique_by":      starlark.NewBuiltin("validate.unique_by", starUniqueBy),
+		},
+	}
+}
+
+// fieldOf returns the value of a field of msg, along with its path from the
+// output when called from a validator
+func fieldOf(t *starlark.Thread, fn *starlark.Builtin, msg starlark.Value, field string) (starlark.Value, string, error) {
+	attrs, ok := msg.(starlark.HasAttrs)
+	if !ok {
+		return nil, "", fmt.Errorf("%s: expected a proto message, got %s", fn.Name(), msg.Type())
+	}
+	value, err := attrs.Attr(field)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	if value == nil {
+		return nil, "", fmt.Errorf("%s: %s has no field %q", fn.Name(), msg.Type(), field)
+	}
+	path, _ := t.Local(validationPathLocal).(string)
+	return value, joinPath(path, field), nil
+}
+
+func starInRange(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg, min, max starlark.Value
+	var field string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "field", &field, "min", &min, "max", &max); err != nil {
+		return nil, err
+	}
+	value, path, err := fieldOf(t, fn, msg, field)
+	if err != nil {
+		return nil, err
+	}
+	below, err := starlark.Compare(syntax.LT, value, min)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	above, err := starlark.Compare(syntax.GT, value, max)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	if below || above {
+		return nil, fmt.Errorf("%s: %s is not in range [%s, %s]", path, value, min, max)
+	}
+	return starlark.None, nil
+}
+
+func starMatches(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg starlark.Value
+	var field, pattern string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "field", &field, "pattern", &pattern); err != nil {
+		return nil, err
+	}
+	value, path, err := fieldOf(t, fn, msg, field)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := starlark.AsString(value)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is a %s, not a string", fn.Name(), path, value.Type())
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern %q: %v", fn.Name(), pattern, err)
+	}
+	if !regex.MatchString(s) {
+		return nil, fmt.Errorf("%s: %s does not match %q", path, value, pattern)
+	}
+	return starlark.None, nil
+}
+
+func starOneOf(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg starlark.Value
+	var field string
+	var values starlark.Iterable
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "field", &field, "values", &values); err != nil {
+		return nil, err
+	}
+	value, path, err := fieldOf(t, fn, msg, field)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []starlark.Value
+	iter := values.Iterate()
+	defer iter.Done()
+	var x starlark.Value
+	for iter.Next(&x) {
+		if equal, err := starlark.Equal(value, x); err == nil && equal {
+			return starlark.None, nil
+		}
+		allowed = append(allowed, x)
+	}
+	return nil, fmt.Errorf("%s: %s is not one of %s", path, value, starlark.NewList(allowed))
+}
+
+func starNonEmpty(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg starlark.Value
+	var field string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "field", &field); err != nil {
+		return nil, err
+	}
+	value, path, err := fieldOf(t, fn, msg, field)
+	if err != nil {
+		return nil, err
+	}
+	empty := !value.Truth()
+	// Repeated and map fields are always truthy, their length tells
+	if sequence, ok := value.(starlark.Sequence); ok {
+		empty = sequence.Len() == 0
+	} else if mapping, ok := value.(starlark.IterableMapping); ok {
+		empty = len(mapping.Items()) == 0
+	}
+	if empty {
+		return nil, fmt.Errorf("%s: must not be empty", path)
+	}
+	return starlark.None, nil
+}
+
+func starValidHostname(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return checkStringField(t, fn, args, kwargs, "a valid hostname", isHostname)
+}
+
+func starValidURL(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return checkStringField(t, fn, args, kwargs, "a valid URL", func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	})
+}
+
+// checkStringField fails when the string field of a message doesn't pass valid
+func checkStringField(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, what string, valid func(string) bool) (starlark.Value, error) {
+	var msg starlark.Value
+	var field string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "field", &field); err != nil {
+		return nil, err
+	}
+	value, path, err := fieldOf(t, fn, msg, field)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := starlark.AsString(value)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is a %s, not a string", fn.Name(), path, value.Type())
+	}
+	if !valid(s) {
+		return nil, fmt.Errorf("%s: %s is not %s", path, value, what)
+	}
+	return starlark.None, nil
+}
+
+func starUniqueBy(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg, key starlark.Value
+	var field string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "field", &field, "key", &key); err != nil {
+		return nil, err
+	}
+	value, path, err := fieldOf(t, fn, msg, field)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := value.(starlark.Indexable)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is a %s, not a repeated field", fn.Name(), path, value.Type())
+	}
+	if _, ok := key.(starlark.Callable); !ok {
+		if _, ok := starlark.AsString(key); !ok {
+			return nil, fmt.Errorf("%s: key must be a field name or a function, got %s", fn.Name(), key.Type())
+		}
+	}
+
+	// The key is the name of a field of the elements or a function of them
+	keyOf := func(item starlark.Value) (starlark.Value, error) {
+		if name, ok := starlark.AsString(key); ok {
+			if attrs, ok := item.(starlark.HasAttrs); ok {
+				if v, err := attrs.Attr(name); err != nil || v != nil {
+					return v, err
+				}
+			}
+			return nil, fmt.Errorf("%s: %s has no field %q", fn.Name(), item.Type(), name)
+		}
+		return starlark.Call(t, key, starlark.Tuple{item}, nil)
+	}
+	seen := starlark.NewDict(items.Len())
+	for i := 0; i < items.Len(); i++ {
+		k, err := keyOf(items.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		if first, found, err := seen.Get(k); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		} else if found {
+			return nil, fmt.Errorf("%s[%d]: duplicate key %s, first seen at %s[%s]", path, i, k, path, first)
+		}
+		if err := seen.SetKey(k, starlark.MakeInt(i)); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+	}
+	return starlark.None, nil
+}
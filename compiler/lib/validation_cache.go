@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+
+	"go.starlark.net/syntax"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// validationCacheVersion is part of the keys of cached validation results,
+// bump it when validating the same output with the same validators may give
+// another result
+const validationCacheVersion = "v1"
+
+// validationCacheDir is where passing validations are cached, under the cache dir
+const validationCacheDir = "validation"
+
+// module is a module loaded by a loader, with the hash of its content and the
+// modules it loads
+type module struct {
+	hash  string
+	loads []string
+}
+
+func hashOf(parts ...[]byte) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// addModule records the content of a loaded module, and the modules loaded by
+// its load statements when it's a Starlark file
+func (l *starlarkLoader) addModule(modulePath string, content []byte, file *syntax.File) {
+	entry := &module{hash: hashOf(content)}
+	if file != nil {
+		for _, stmt := range file.Stmts {
+			if load, ok := stmt.(*syntax.LoadStmt); ok {
+				if loadPath, err := toCanonicalPath(load.ModuleName(), modulePath); err == nil {
+					entry.loads = append(entry.loads, loadPath)
+				}
+			}
+		}
+	}
+	l.loaded[modulePath] = entry
+}
+
+// addProtoModule records the schema of a loaded proto file
+func (l *starlarkLoader) addProtoModule(modulePath string, file protoreflect.FileDescriptor) {
+	data, err := protov2.MarshalOptions{Deterministic: true}.Marshal(protodesc.ToFileDescriptorProto(file))
+	if err != nil {
+		return
+	}
+	l.addModule(modulePath, data, nil)
+}
+
+// hashModules hashes the content of modules and of every module they load,
+// transitively
+func (l *starlarkLoader) hashModules(modules []string) string {
+	seen := make(map[string]bool)
+	var visit func(modulePath string)
+	visit = func(modulePath string) {
+		if seen[modulePath] {
+			return
+		}
+		seen[modulePath] = true
+		if entry, ok := l.loaded[modulePath]; ok {
+			for _, loadPath := range entry.loads {
+				visit(loadPath)
+			}
+		}
+	}
+	for _, modulePath := range modules {
+		visit(modulePath)
+	}
+
+	paths := make([]string, 0, len(seen))
+	for modulePath := range seen {
+		paths = append(paths, modulePath)
+	}
+	sort.Strings(paths)
+	parts := [][]byte{}
+	for _, modulePath := range paths {
+		hash := ""
+		if entry, ok := l.loaded[modulePath]; ok {
+			hash = entry.hash
+		}
+		parts = append(parts, []byte(modulePath), []byte(hash))
+	}
+	return hashOf(parts...)
+}
+
+// validationKey is the key of the result of validating message, output of the
+// config for env, made of the hash of the validators, the content of message
+// and the schema of every message it holds
+func (c *config) validationKey(message protoreflect.Message, output string, env string) (string, error) {
+	data, err := protov2.MarshalOptions{Deterministic: true}.Marshal(message.Interface())
+	if err != nil {
+		return "", err
+	}
+	files, err := c.outputFiles(message)
+	if err != nil {
+		return "", err
+	}
+	parts := [][]byte{
+		[]byte(validationCacheVersion),
+		[]byte(c.validatorsHash),
+		[]byte(c.filename),
+		[]byte(output),
+		[]byte(env),
+		[]byte(message.Descriptor().FullName()),
+		data,
+	}
+	for _, file := range files {
+		schema, err := protov2.MarshalOptions{Deterministic: true}.Marshal(protodesc.ToFileDescriptorProto(file))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, schema)
+	}
+	return hashOf(parts...), nil
+}
+
+// outputsValidationKey is the key of the result of running the output
+// validators of a config on its outputs, made of the hash of the config and
+// the modules it loads, and of the validation key of every output
+func (c *config) outputsValidationKey(outputFiles []string, configs map[string]protoreflect.Message, outputKeys map[string]string, env string) (string, error) {
+	parts := [][]byte{
+		[]byte(validationCacheVersion),
+		[]byte("outputs"),
+		[]byte(c.configHash),
+	}
+	for _, outputFile := range outputFiles {
+		key, err := c.validationKey(configs[outputFile], outputKeys[outputFile], env)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, []byte(outputKeys[outputFile]), []byte(key))
+	}
+	return hashOf(parts...), nil
+}
+
+// validationCached reports whether an output with the validation key passed
+// validation before
+func (c *Compiler) validationCached(key string) bool {
+	exists, _, err := stat(filepath.Join(c.CacheDir, validationCacheDir, key))
+	return err == nil && exists
+}
+
+// cacheValidation records that an output with the validation key passed
+// validation. The cache is best effort, failing to write it isn't an error.
+func (c *Compiler) cacheValidation(key string) {
+	dir := filepath.Join(c.CacheDir, validationCacheDir)
+	if err := mkdirAll(dir, 0755); err != nil {
+		return
+	}
+	writeFile(filepath.Join(dir, key), nil)
+}
@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	pc "github.com/protoconf/protoconf/datatypes/proto/v1"
+	protov2 "google.golang.org/protobuf/proto"
+)
+
+// ValidateValue validates a config value written outside of a compilation,
+// such as a mutation or a materialized config inserted to a key-value store,
+// as the compilation of a config loading its proto file would: by the
+// validators, `protoconf.validate' and PGV rules and protovalidate
+// constraints of its messages. The immutable fields of the value are
+// compared with the existing outputFile, which may not exist yet.
+func (c *Compiler) ValidateValue(value *pc.ProtoconfValue, outputFile string) error {
+	if c.disableValidation {
+		return nil
+	}
+	protoFile := filepath.ToSlash(value.GetProtoFile())
+	configFile, err := c.load(context.Background(), protoFile)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %v", protoFile, err)
+	}
+
+	messageType, err := configFile.anyResolver.FindMessageByURL(value.GetValue().GetTypeUrl())
+	if err != nil {
+		return fmt.Errorf("error resolving the type of the value, type_url=%s err=%v", value.GetValue().GetTypeUrl(), err)
+	}
+	message := messageType.New()
+	if err := (protov2.UnmarshalOptions{Resolver: configFile.anyResolver}).Unmarshal(value.GetValue().GetValue(), message.Interface()); err != nil {
+		return fmt.Errorf("error decoding the value, type_url=%s err=%v", value.GetValue().GetTypeUrl(), err)
+	}
+
+	failures, err := c.validateOutput(configFile, outputFile, "", message)
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "\n"))
+	}
+	return nil
+}
@@ -3,35 +3,63 @@ package proto
 import (
 	"fmt"
 
-	"github.com/jhump/protoreflect/desc"
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
+// CheckEnumNumber fails when number isn't a value of enum, naming the nearest
+// value it defines, unless the enum is open and the options allow open enums
+func CheckEnumNumber(enum protoreflect.EnumDescriptor, number protoreflect.EnumNumber, options *Options) error {
+	values := enum.Values()
+	if values.ByNumber(number) != nil || (options.openEnums() && !enum.IsClosed()) {
+		return nil
+	}
+	var nearest protoreflect.EnumValueDescriptor
+	distance := func(value protoreflect.EnumValueDescriptor) int64 {
+		d := int64(value.Number()) - int64(number)
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	for i := 0; i < values.Len(); i++ {
+		value := values.Get(i)
+		if nearest == nil || distance(value) < distance(nearest) || (distance(value) == distance(nearest) && value.Number() < nearest.Number()) {
+			nearest = value
+		}
+	}
+	return fmt.Errorf("%d is not a value of enum %s, the nearest value is %s=%d", number, enum.FullName(), nearest.Name(), nearest.Number())
+}
+
 type starProtoEnumValue struct {
-	desc *desc.EnumValueDescriptor
+	desc protoreflect.EnumValueDescriptor
+}
+
+func (v *starProtoEnumValue) enum() protoreflect.EnumDescriptor {
+	return v.desc.Parent().(protoreflect.EnumDescriptor)
 }
 
 func (v *starProtoEnumValue) String() string {
-	return fmt.Sprintf("proto.Enum <%s %s=%d>", v.desc.GetEnum().GetName(), v.desc.GetName(), v.desc.GetNumber())
+	return fmt.Sprintf("proto.Enum <%s %s=%d>", v.enum().Name(), v.desc.Name(), v.desc.Number())
 }
-func (v *starProtoEnumValue) Type() string         { return v.desc.GetEnum().GetName() }
+func (v *starProtoEnumValue) Type() string         { return string(v.enum().Name()) }
 func (v *starProtoEnumValue) Freeze()              {}
 func (v *starProtoEnumValue) Truth() starlark.Bool { return starlark.True }
 func (v *starProtoEnumValue) Hash() (uint32, error) {
-	return starlark.MakeInt64(int64(v.desc.GetNumber())).Hash()
+	return starlark.MakeInt64(int64(v.desc.Number())).Hash()
 }
 func (v *starProtoEnumValue) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
 	// false means no diff
 	n := y.(*starProtoEnumValue)
-	if v.desc.GetEnum() != n.desc.GetEnum() {
-		return true, fmt.Errorf("enums %v and %v are not from the same type", v.desc.GetEnum().GetName(), n.desc.GetEnum().GetName())
+	if v.enum().FullName() != n.enum().FullName() {
+		return true, fmt.Errorf("enums %v and %v are not from the same type", v.enum().Name(), n.enum().Name())
 	}
 	switch op {
 	case syntax.EQL:
-		return (v.desc.GetNumber() == n.desc.GetNumber()), nil
+		return (v.desc.Number() == n.desc.Number()), nil
 	case syntax.NEQ:
-		return (v.desc.GetNumber() != n.desc.GetNumber()), nil
+		return (v.desc.Number() != n.desc.Number()), nil
 	}
 	return false, nil
 }
@@ -4,16 +4,16 @@ import (
 	"fmt"
 	"sort"
 
-	"github.com/jhump/protoreflect/desc"
 	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type starProtoEnumType struct {
-	desc *desc.EnumDescriptor
+	desc protoreflect.EnumDescriptor
 }
 
 func (t *starProtoEnumType) String() string {
-	return fmt.Sprintf("<proto.EnumType %s>", t.desc.GetName())
+	return fmt.Sprintf("<proto.EnumType %s>", t.desc.Name())
 }
 func (t *starProtoEnumType) Type() string         { return "proto.EnumType" }
 func (t *starProtoEnumType) Freeze()              {}
@@ -23,16 +23,17 @@ func (t *starProtoEnumType) Hash() (uint32, error) {
 }
 
 func (t *starProtoEnumType) Attr(attrName string) (starlark.Value, error) {
-	if value := t.desc.FindValueByName(attrName); value != nil {
+	if value := t.desc.Values().ByName(protoreflect.Name(attrName)); value != nil {
 		return &starProtoEnumValue{desc: value}, nil
 	}
 	return nil, nil
 }
 
 func (t *starProtoEnumType) AttrNames() []string {
-	names := make([]string, 0, len(t.desc.GetValues()))
-	for _, value := range t.desc.GetValues() {
-		names = append(names, value.GetName())
+	values := t.desc.Values()
+	names := make([]string, 0, values.Len())
+	for i := 0; i < values.Len(); i++ {
+		names = append(names, string(values.Get(i).Name()))
 	}
 	sort.Strings(names)
 	return names
@@ -0,0 +1,106 @@
+package proto
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// NewExtension wraps a proto2 extension field so it can be passed to the
+// `proto' module extension helpers
+func NewExtension(desc protoreflect.ExtensionDescriptor) starlark.Value {
+	if xt, ok := desc.(protoreflect.ExtensionTypeDescriptor); ok {
+		return &starProtoExtension{desc: xt}
+	}
+	return &starProtoExtension{desc: dynamicpb.NewExtensionType(desc).TypeDescriptor()}
+}
+
+// A Starlark built-in type representing a Protobuf extension field.
+type starProtoExtension struct {
+	desc protoreflect.ExtensionTypeDescriptor
+}
+
+func (ext *starProtoExtension) String() string {
+	return fmt.Sprintf("<proto.Extension %s>", ext.desc.FullName())
+}
+func (ext *starProtoExtension) Type() string         { return "proto.Extension" }
+func (ext *starProtoExtension) Freeze()              {}
+func (ext *starProtoExtension) Truth() starlark.Bool { return starlark.True }
+func (ext *starProtoExtension) Hash() (uint32, error) {
+	return starlark.String(ext.desc.FullName()).Hash()
+}
+
+func (msg *starProtoMessage) checkExtension(ext *starProtoExtension) error {
+	extendee := ext.desc.ContainingMessage().FullName()
+	if extendee != msg.desc.FullName() {
+		return fmt.Errorf("extension %s extends %s, not %s", ext.desc.FullName(), extendee, msg.desc.FullName())
+	}
+	return nil
+}
+
+// extensionKey is the attrCache key of an extension, it can't collide with a
+// regular field name
+func extensionKey(ext *starProtoExtension) string {
+	return "[" + string(ext.desc.FullName()) + "]"
+}
+
+// GetExtension returns the value of an extension field of the message
+func (msg *starProtoMessage) GetExtension(ext *starProtoExtension) (starlark.Value, error) {
+	if err := msg.checkExtension(ext); err != nil {
+		return nil, err
+	}
+	key := extensionKey(ext)
+	if attr, ok := msg.attrCache[key]; ok {
+		return attr, nil
+	}
+	out := valueToStarlark(&fieldValue{desc: ext.desc, msg: msg.msg, warnings: msg.warnings, options: msg.options})
+	if msg.frozen {
+		out.Freeze()
+	}
+	msg.attrCache[key] = out
+	return out, nil
+}
+
+// SetExtension sets the value of an extension field of the message
+func (msg *starProtoMessage) SetExtension(ext *starProtoExtension, star starlark.Value) error {
+	if err := msg.checkExtension(ext); err != nil {
+		return err
+	}
+	val, err := valueFromStarlark(msg.msg, ext.desc, star, msg.options)
+	if err != nil {
+		return err
+	}
+	if err := msg.checkMutable("set extension of"); err != nil {
+		return err
+	}
+	msg.warnings.checkDeprecated(ext.desc)
+	delete(msg.attrCache, extensionKey(ext))
+	msg.msg.Set(ext.desc, val)
+	return nil
+}
+
+// HasExtension reports whether an extension field of the message is set
+func (msg *starProtoMessage) HasExtension(ext *starProtoExtension) (bool, error) {
+	if err := msg.checkExtension(ext); err != nil {
+		return false, err
+	}
+	if ext.desc.IsList() {
+		return false, fmt.Errorf("extension %s is repeated and does not track presence, use len() instead", ext.desc.FullName())
+	}
+	return msg.msg.Has(ext.desc), nil
+}
+
+// ClearExtension unsets an extension field of the message
+func (msg *starProtoMessage) ClearExtension(ext *starProtoExtension) error {
+	if err := msg.checkExtension(ext); err != nil {
+		return err
+	}
+	if err := msg.checkMutable("clear extension of"); err != nil {
+		return err
+	}
+	delete(msg.attrCache, extensionKey(ext))
+	msg.msg.Clear(ext.desc)
+	return nil
+}
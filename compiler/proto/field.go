@@ -3,202 +3,240 @@ package proto
 import (
 	"fmt"
 	"math"
-	"reflect"
 
-	pbproto "github.com/golang/protobuf/proto"
-	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
-	"github.com/jhump/protoreflect/desc"
-	"github.com/jhump/protoreflect/dynamic"
 	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
+const anyFullName protoreflect.FullName = "google.protobuf.Any"
+
+// DefaultAnyTypeURLPrefix is the type URL prefix used by the protobuf runtimes
+const DefaultAnyTypeURLPrefix = "type.googleapis.com/"
+
 type fieldValue struct {
-	desc *desc.FieldDescriptor
-	msg  *dynamic.Message
+	desc     protoreflect.FieldDescriptor
+	msg      protoreflect.Message
+	warnings *Warnings
+	options  *Options
 }
 
 func valueToStarlark(val *fieldValue) starlark.Value {
 	if val.desc.IsMap() {
 		dict := &starlark.Dict{}
-		keyType := val.desc.GetMapKeyType()
-		valueType := val.desc.GetMapValueType()
-		mp := val.msg.GetField(val.desc).(map[interface{}]interface{})
-		for key, value := range mp {
-			key := scalarToStarlark(keyType, key)
-			elem := scalarToStarlark(valueType, value)
+		keyType := val.desc.MapKey()
+		valueType := val.desc.MapValue()
+		val.msg.Get(val.desc).Map().Range(func(mapKey protoreflect.MapKey, mapValue protoreflect.Value) bool {
+			key := scalarToStarlark(keyType, mapKey.Value(), nil, nil)
+			elem := scalarToStarlark(valueType, mapValue, val.warnings, val.options)
 			if err := dict.SetKey(key, elem); err != nil {
 				panic(fmt.Sprintf("dict.SetKey(%s, %s): %v", key, elem, err))
 			}
-		}
+			return true
+		})
 		return &protoMap{
 			field: val,
 			dict:  dict,
 		}
 	}
 
-	if val.desc.IsRepeated() {
+	if val.desc.IsList() {
 		var items []starlark.Value
-		length := len(val.msg.GetField(val.desc).([]interface{}))
-		for i := 0; i < length; i++ {
-			items = append(items, scalarToStarlark(val.desc, val.msg.GetRepeatedField(val.desc, i)))
+		list := val.msg.Get(val.desc).List()
+		for i := 0; i < list.Len(); i++ {
+			items = append(items, scalarToStarlark(val.desc, list.Get(i), val.warnings, val.options))
 		}
 		return &protoRepeated{
 			field: val,
 			list:  starlark.NewList(items),
 		}
 	}
-	return scalarToStarlark(val.desc, val.msg.GetField(val.desc))
-}
 
-func isNil(i interface{}) bool {
-	if i == nil {
-		return true
-	}
-	switch reflect.TypeOf(i).Kind() {
-	case reflect.Ptr, reflect.Map, reflect.Array, reflect.Chan, reflect.Slice:
-		return reflect.ValueOf(i).IsNil()
+	if val.desc.Message() != nil && !val.msg.Has(val.desc) {
+		return starlark.None
 	}
-	return false
+	return scalarToStarlark(val.desc, val.msg.Get(val.desc), val.warnings, val.options)
 }
 
-func scalarToStarlark(t *desc.FieldDescriptor, val interface{}) starlark.Value {
-	if isNil(val) {
-		return starlark.None
-	}
-	switch t.GetType() {
-	case dpb.FieldDescriptorProto_TYPE_INT32, dpb.FieldDescriptorProto_TYPE_SINT32, dpb.FieldDescriptorProto_TYPE_SFIXED32:
-		return starlark.MakeInt64(int64(val.(int32)))
-	case dpb.FieldDescriptorProto_TYPE_INT64, dpb.FieldDescriptorProto_TYPE_SINT64, dpb.FieldDescriptorProto_TYPE_SFIXED64:
-		return starlark.MakeInt64(val.(int64))
-	case dpb.FieldDescriptorProto_TYPE_UINT32, dpb.FieldDescriptorProto_TYPE_FIXED32:
-		return starlark.MakeUint64(uint64(val.(uint32)))
-	case dpb.FieldDescriptorProto_TYPE_UINT64, dpb.FieldDescriptorProto_TYPE_FIXED64:
-		return starlark.MakeUint64(val.(uint64))
-	case dpb.FieldDescriptorProto_TYPE_FLOAT:
-		return starlark.Float(val.(float32))
-	case dpb.FieldDescriptorProto_TYPE_DOUBLE:
-		return starlark.Float(val.(float64))
-	case dpb.FieldDescriptorProto_TYPE_STRING:
-		return starlark.String(val.(string))
-	case dpb.FieldDescriptorProto_TYPE_BYTES:
-		return starlark.String(string(val.([]byte)))
-	case dpb.FieldDescriptorProto_TYPE_BOOL:
-		return starlark.Bool(val.(bool))
-	case dpb.FieldDescriptorProto_TYPE_ENUM:
-		return &starProtoEnumValue{desc: t.GetEnumType().FindValueByNumber(val.(int32))}
-	case dpb.FieldDescriptorProto_TYPE_MESSAGE:
-		message, err := dynamic.AsDynamicMessage(val.(pbproto.Message))
-		if err != nil {
-			panic(fmt.Errorf("scalarToStarlark: error converting proto.Message to dynamic.Message %v", err))
-		}
-		return NewStarProtoMessage(message)
+// scalarToStarlark converts a single value of field t, messages report their
+// warnings to warnings and follow options
+func scalarToStarlark(t protoreflect.FieldDescriptor, val protoreflect.Value, warnings *Warnings, options *Options) starlark.Value {
+	switch t.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return starlark.MakeInt64(val.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return starlark.MakeUint64(val.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return starlark.Float(val.Float())
+	case protoreflect.StringKind:
+		return starlark.String(val.String())
+	case protoreflect.BytesKind:
+		return starlark.String(string(val.Bytes()))
+	case protoreflect.BoolKind:
+		return starlark.Bool(val.Bool())
+	case protoreflect.EnumKind:
+		value := t.Enum().Values().ByNumber(val.Enum())
+		if value == nil {
+			// Numbers open enums don't define, e.g. decoded from JSON
+			return starlark.MakeInt64(int64(val.Enum()))
+		}
+		return &starProtoEnumValue{desc: value}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		wrapper := NewStarProtoMessage(val.Message(), options)
+		wrapper.warnings = warnings
+		return wrapper
 	}
 
-	// This should be impossible, because the set of types present
-	// in a generated Protobuf struct is small and limited.
+	// This should be impossible, because the set of kinds a protobuf
+	// field can have is small and limited.
 	panic(fmt.Errorf("scalarToStarlark: unknown type %v", t))
 }
 
-func valueFromStarlark(t *desc.FieldDescriptor, star starlark.Value) (interface{}, error) {
+// valueFromStarlark converts a Starlark value to the value of field t of msg,
+// lists and maps are allocated from msg
+func valueFromStarlark(msg protoreflect.Message, t protoreflect.FieldDescriptor, star starlark.Value, options *Options) (protoreflect.Value, error) {
+	switch {
+	case t.IsMap():
+		var dict *starlark.Dict
+		switch star := star.(type) {
+		case *protoMap:
+			dict = star.dict
+		case *starlark.Dict:
+			dict = star
+		default:
+			return protoreflect.Value{}, typeError(t, star)
+		}
+		mp := msg.NewField(t).Map()
+		for _, item := range dict.Items() {
+			key, err := elemFromStarlark(t.MapKey(), item[0], options)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			value, err := elemFromStarlark(t.MapValue(), item[1], options)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			mp.Set(key.MapKey(), value)
+		}
+		return protoreflect.ValueOfMap(mp), nil
+	case t.IsList():
+		var items *starlark.List
+		switch star := star.(type) {
+		case *protoRepeated:
+			items = star.list
+		case *starlark.List:
+			items = star
+		default:
+			return protoreflect.Value{}, typeError(t, star)
+		}
+		list := msg.NewField(t).List()
+		for i := 0; i < items.Len(); i++ {
+			elem, err := elemFromStarlark(t, items.Index(i), options)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			list.Append(elem)
+		}
+		return protoreflect.ValueOfList(list), nil
+	}
+	return elemFromStarlark(t, star, options)
+}
+
+// elemFromStarlark converts a Starlark value to a singular value of field t, or
+// to an element of t if it's a list, following options
+func elemFromStarlark(t protoreflect.FieldDescriptor, star starlark.Value, options *Options) (protoreflect.Value, error) {
 	switch star := star.(type) {
 	case starlark.Int:
-		switch t.GetType() {
-		case dpb.FieldDescriptorProto_TYPE_INT64, dpb.FieldDescriptorProto_TYPE_SINT64:
+		switch t.Kind() {
+		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
 			if val, ok := star.Int64(); ok {
-				return val, nil
+				return protoreflect.ValueOfInt64(val), nil
 			}
-			return nil, fmt.Errorf("ValueError: value %v overflows type `int64'", star)
-		case dpb.FieldDescriptorProto_TYPE_UINT64, dpb.FieldDescriptorProto_TYPE_SFIXED64:
+			return protoreflect.Value{}, fmt.Errorf("ValueError: value %v overflows type `int64'", star)
+		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
 			if val, ok := star.Uint64(); ok {
-				return val, nil
+				return protoreflect.ValueOfUint64(val), nil
 			}
-			return nil, fmt.Errorf("ValueError: value %v overflows type `uint64'", star)
-		case dpb.FieldDescriptorProto_TYPE_INT32, dpb.FieldDescriptorProto_TYPE_SINT32:
+			return protoreflect.Value{}, fmt.Errorf("ValueError: value %v overflows type `uint64'", star)
+		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
 			if val, ok := star.Int64(); ok && val >= math.MinInt32 && val <= math.MaxInt32 {
-				return int32(val), nil
+				return protoreflect.ValueOfInt32(int32(val)), nil
 			}
-			return nil, fmt.Errorf("ValueError: value %v overflows type `int32'", star)
-		case dpb.FieldDescriptorProto_TYPE_UINT32, dpb.FieldDescriptorProto_TYPE_SFIXED32:
+			return protoreflect.Value{}, fmt.Errorf("ValueError: value %v overflows type `int32'", star)
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
 			if val, ok := star.Uint64(); ok && val <= math.MaxUint32 {
-				return uint32(val), nil
+				return protoreflect.ValueOfUint32(uint32(val)), nil
 			}
-			return nil, fmt.Errorf("ValueError: value %v overflows type `int32'", star)
-		}
-	case starlark.Float:
-		switch t.GetType() {
-		case dpb.FieldDescriptorProto_TYPE_DOUBLE:
-			if val, ok := starlark.AsFloat(star); ok {
-				return val, nil
+			return protoreflect.Value{}, fmt.Errorf("ValueError: value %v overflows type `uint32'", star)
+		case protoreflect.EnumKind:
+			val, ok := star.Int64()
+			if !ok || val < math.MinInt32 || val > math.MaxInt32 {
+				return protoreflect.Value{}, fmt.Errorf("ValueError: value %v overflows type `int32'", star)
 			}
-		case dpb.FieldDescriptorProto_TYPE_FLOAT:
-			if val, ok := starlark.AsFloat(star); ok {
-				return float32(val), nil
+			if err := CheckEnumNumber(t.Enum(), protoreflect.EnumNumber(val), options); err != nil {
+				return protoreflect.Value{}, fmt.Errorf("ValueError: field %s: %v", t.FullName(), err)
 			}
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(val)), nil
+		}
+	case starlark.Float:
+		switch t.Kind() {
+		case protoreflect.DoubleKind:
+			return protoreflect.ValueOfFloat64(float64(star)), nil
+		case protoreflect.FloatKind:
+			return protoreflect.ValueOfFloat32(float32(star)), nil
 		}
 	case starlark.String:
-		switch t.GetType() {
-		case dpb.FieldDescriptorProto_TYPE_STRING:
-			return string(star), nil
-		case dpb.FieldDescriptorProto_TYPE_BYTES:
-			return []byte(string(star)), nil
+		switch t.Kind() {
+		case protoreflect.StringKind:
+			return protoreflect.ValueOfString(string(star)), nil
+		case protoreflect.BytesKind:
+			return protoreflect.ValueOfBytes([]byte(string(star))), nil
 		}
 	case starlark.Bool:
-		if t.GetType() == dpb.FieldDescriptorProto_TYPE_BOOL {
-			return bool(star), nil
+		if t.Kind() == protoreflect.BoolKind {
+			return protoreflect.ValueOfBool(bool(star)), nil
 		}
-	case starlark.NoneType:
 	case *starProtoEnumValue:
-		if t.GetEnumType().GetFullyQualifiedName() == star.desc.GetEnum().GetFullyQualifiedName() {
-			return star.desc.GetNumber(), nil
+		if t.Enum() != nil && t.Enum().FullName() == star.desc.Parent().FullName() {
+			return protoreflect.ValueOfEnum(star.desc.Number()), nil
 		}
 	case *starProtoMessage:
-		if t.GetType() == dpb.FieldDescriptorProto_TYPE_MESSAGE {
-			return star.msg, nil
-		}
-	case *protoRepeated:
-		return valueFromStarlark(t, star.list)
-	case *starlark.List:
-		if t.IsRepeated() {
-			sl := make([]interface{}, star.Len())
-			for i := 0; i < star.Len(); i++ {
-				elem, err := valueFromStarlark(t, star.Index(i))
-				if err != nil {
-					return nil, err
-				}
-				sl[i] = elem
+		if t.Message() == nil {
+			break
+		}
+		if t.Message().FullName() == star.desc.FullName() {
+			return protoreflect.ValueOfMessage(star.msg), nil
+		}
+		if t.Message().FullName() == anyFullName {
+			value, err := proto.Marshal(star.msg.Interface())
+			if err != nil {
+				return protoreflect.Value{}, fmt.Errorf("error marshaling %s to google.protobuf.Any: %v", star.desc.FullName(), err)
 			}
-			return sl, nil
-		}
-	case *protoMap:
-		return valueFromStarlark(t, star.dict)
-	case *starlark.Dict:
-		if t.IsMap() {
-			keyType := t.GetMapKeyType()
-			valueType := t.GetMapValueType()
-			mp := map[interface{}]interface{}{}
-			for _, item := range star.Items() {
-				key, err := valueFromStarlark(keyType, item[0])
-				if err != nil {
-					return nil, err
-				}
-				value, err := valueFromStarlark(valueType, item[1])
-				if err != nil {
-					return nil, err
-				}
-				mp[key] = value
+			any := &anypb.Any{
+				TypeUrl: options.anyTypeURLPrefix() + string(star.desc.FullName()),
+				Value:   value,
 			}
-			return mp, nil
+			return protoreflect.ValueOfMessage(any.ProtoReflect()), nil
 		}
 	}
 
-	return nil, typeError(t, star)
+	return protoreflect.Value{}, typeError(t, star)
 }
 
-func typeName(t *desc.FieldDescriptor) string {
-	return t.String()
+func typeName(t protoreflect.FieldDescriptor) string {
+	if t.Message() != nil {
+		return string(t.Message().FullName())
+	}
+	if t.Enum() != nil {
+		return string(t.Enum().FullName())
+	}
+	return t.Kind().String()
 }
 
-func typeError(t *desc.FieldDescriptor, star starlark.Value) error {
+func typeError(t protoreflect.FieldDescriptor, star starlark.Value) error {
 	return fmt.Errorf("type error: value %s (type `%s') can't be assigned to field %s (proto type `%s')",
-		star.String(), star.Type(), t.GetFullyQualifiedName(), t.GetType())
+		star.String(), star.Type(), t.FullName(), typeName(t))
 }
@@ -0,0 +1,172 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/protoconf/protoconf/utils"
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Policies for the fields of ingested data which are unknown to its message type
+const (
+	// UnknownFieldsError fails decoding the data
+	UnknownFieldsError = "error"
+	// UnknownFieldsIgnore drops the unknown fields silently
+	UnknownFieldsIgnore = "ignore"
+	// UnknownFieldsCollect drops the unknown fields, reporting each of them as
+	// a warning
+	UnknownFieldsCollect = "collect"
+)
+
+// ingestFormat decodes data of one format into a message
+type ingestFormat struct {
+	name      string
+	unmarshal func(data []byte, message protoreflect.Message, discardUnknown bool) error
+	// dropUnknown removes the fields unknown to desc from data, returning the
+	// remaining data and the paths of the removed fields
+	dropUnknown func(data []byte, desc protoreflect.MessageDescriptor) ([]byte, []string, error)
+}
+
+var jsonFormat = &ingestFormat{
+	name: "JSON",
+	unmarshal: func(data []byte, message protoreflect.Message, discardUnknown bool) error {
+		return protojson.UnmarshalOptions{
+			DiscardUnknown: discardUnknown,
+			Resolver:       utils.NewAnyResolver(message.Descriptor().ParentFile()),
+		}.Unmarshal(data, message.Interface())
+	},
+	dropUnknown: dropUnknownJSON,
+}
+
+var textFormat = &ingestFormat{
+	name: "text",
+	unmarshal: func(data []byte, message protoreflect.Message, discardUnknown bool) error {
+		return prototext.UnmarshalOptions{
+			DiscardUnknown: discardUnknown,
+			Resolver:       utils.NewAnyResolver(message.Descriptor().ParentFile()),
+		}.Unmarshal(data, message.Interface())
+	},
+	dropUnknown: dropUnknownText,
+}
+
+func starFromJSON(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return ingest(t, fn, args, kwargs, jsonFormat)
+}
+
+func starFromText(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return ingest(t, fn, args, kwargs, textFormat)
+}
+
+func ingest(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, format *ingestFormat) (starlark.Value, error) {
+	var mt *starProtoMessageType
+	var data string
+	unknownFields := UnknownFieldsError
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "type", &mt, "data", &data, "unknown_fields?", &unknownFields); err != nil {
+		return nil, err
+	}
+
+	message := dynamicpb.NewMessage(mt.desc)
+	warnings := warningsOf(t)
+	var err error
+	switch unknownFields {
+	case UnknownFieldsError:
+		err = format.unmarshal([]byte(data), message, false)
+	case UnknownFieldsIgnore:
+		err = format.unmarshal([]byte(data), message, true)
+	case UnknownFieldsCollect:
+		var known []byte
+		var dropped []string
+		if known, dropped, err = format.dropUnknown([]byte(data), mt.desc); err == nil {
+			for _, path := range dropped {
+				warnings.warnf(WarningUnknownFields, "unknown field %s dropped when decoding %s from %s", path, mt.desc.FullName(), format.name)
+			}
+			err = format.unmarshal(known, message, false)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown_fields must be one of %q, %q or %q, got %q", fn.Name(), UnknownFieldsError, UnknownFieldsIgnore, UnknownFieldsCollect, unknownFields)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: error decoding %s from %s: %v", fn.Name(), mt.desc.FullName(), format.name, err)
+	}
+
+	wrapper := NewStarProtoMessage(message, optionsOf(t))
+	wrapper.warnings = warnings
+	return wrapper, nil
+}
+
+// hasCustomJSON reports whether a message type has its own JSON mapping, in
+// which case its JSON keys are not field names
+func hasCustomJSON(desc protoreflect.MessageDescriptor) bool {
+	return desc.ParentFile().Package() == "google.protobuf"
+}
+
+func dropUnknownJSON(data []byte, desc protoreflect.MessageDescriptor) ([]byte, []string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers as written, 64-bit integers may not fit a float
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, nil, err
+	}
+	var dropped []string
+	dropUnknownJSONFields(value, desc, "", &dropped)
+	known, err := json.Marshal(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(dropped)
+	return known, dropped, nil
+}
+
+func dropUnknownJSONFields(value interface{}, desc protoreflect.MessageDescriptor, path string, dropped *[]string) {
+	object, ok := value.(map[string]interface{})
+	if !ok || hasCustomJSON(desc) {
+		// Type mismatches are left for protojson to report
+		return
+	}
+	fields := desc.Fields()
+	for key, value := range object {
+		if strings.HasPrefix(key, "[") {
+			// Extensions are resolved by protojson
+			continue
+		}
+		field := fields.ByJSONName(key)
+		if field == nil {
+			field = fields.ByTextName(key)
+		}
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		if field == nil {
+			*dropped = append(*dropped, fieldPath)
+			delete(object, key)
+			continue
+		}
+		switch {
+		case field.IsMap():
+			if entries, ok := value.(map[string]interface{}); ok && field.MapValue().Message() != nil {
+				for mapKey, entry := range entries {
+					dropUnknownJSONFields(entry, field.MapValue().Message(), fmt.Sprintf("%s[%q]", fieldPath, mapKey), dropped)
+				}
+			}
+		case field.Message() == nil:
+		case field.IsList():
+			if items, ok := value.([]interface{}); ok {
+				for i, item := range items {
+					dropUnknownJSONFields(item, field.Message(), fmt.Sprintf("%s[%d]", fieldPath, i), dropped)
+				}
+			}
+		default:
+			dropUnknownJSONFields(value, field.Message(), fieldPath, dropped)
+		}
+	}
+}
@@ -45,7 +45,7 @@ func (m *protoMap) String() string                                     { return
 func (m *protoMap) Truth() starlark.Bool                               { return m.dict.Truth() }
 
 func (m *protoMap) Type() string {
-	return fmt.Sprintf("map<%s, %s>", typeName(m.field.desc.GetMapKeyType()), typeName(m.field.desc.GetMapValueType()))
+	return fmt.Sprintf("map<%s, %s>", typeName(m.field.desc.MapKey()), typeName(m.field.desc.MapValue()))
 
 }
 
@@ -66,7 +66,7 @@ func (m *protoMap) wrapClear() starlark.Value {
 		if err := m.dict.Clear(); err != nil {
 			return nil, err
 		}
-		m.field.msg.ClearField(m.field.desc)
+		m.field.msg.Clear(m.field.desc)
 		return starlark.None, nil
 	}
 	return starlark.NewBuiltin("clear", impl).BindReceiver(m)
@@ -89,8 +89,8 @@ func (m *protoMap) wrapSetDefault() starlark.Value {
 }
 
 func (m *protoMap) wrapUpdate() starlark.Value {
-	keyType := m.field.desc.GetMapKeyType()
-	valueType := m.field.desc.GetMapValueType()
+	keyType := m.field.desc.MapKey()
+	valueType := m.field.desc.MapValue()
 	impl := func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		// Use the underlying starlark `dict.update()` to get a Dict containing
 		// all the new values, so we don't have to recreate the API here. After
@@ -127,26 +127,26 @@ func (m *protoMap) wrapUpdate() starlark.Value {
 }
 
 func (m *protoMap) SetKey(k, v starlark.Value) error {
-	keyType := m.field.desc.GetMapKeyType()
+	keyType := m.field.desc.MapKey()
 	if k == starlark.None {
 		return typeError(keyType, k)
 	}
-	valueType := m.field.desc.GetMapValueType()
+	valueType := m.field.desc.MapValue()
 	if v == starlark.None {
 		return typeError(valueType, v)
 	}
-	goKey, err := valueFromStarlark(keyType, k)
+	goKey, err := elemFromStarlark(keyType, k, m.field.options)
 	if err != nil {
 		return err
 	}
-	goVal, err := valueFromStarlark(valueType, v)
+	goVal, err := elemFromStarlark(valueType, v, m.field.options)
 	if err != nil {
 		return err
 	}
 	if err := m.dict.SetKey(k, v); err != nil {
 		return err
 	}
-	m.field.msg.PutMapField(m.field.desc, goKey, goVal)
+	m.field.msg.Mutable(m.field.desc).Map().Set(goKey.MapKey(), goVal)
 	return nil
 }
 
@@ -5,26 +5,28 @@ import (
 	"hash/fnv"
 	"sort"
 
-	"github.com/golang/protobuf/proto"
-	"github.com/golang/protobuf/ptypes"
-	"github.com/jhump/protoreflect/desc"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/pkg/errors"
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func NewStarProtoMessage(msg *dynamic.Message) *starProtoMessage {
+// NewStarProtoMessage wraps msg in a Starlark message following the options
+// of a compilation
+func NewStarProtoMessage(msg protoreflect.Message, options *Options) *starProtoMessage {
 	wrapper := &starProtoMessage{
 		msg:       msg,
-		desc:      msg.GetMessageDescriptor(),
+		desc:      msg.Descriptor(),
 		attrCache: make(map[string]starlark.Value),
+		options:   options,
 	}
 
 	return wrapper
 }
 
-func ToProtoMessage(val starlark.Value) (*dynamic.Message, bool) {
+func ToProtoMessage(val starlark.Value) (protoreflect.Message, bool) {
 	if msg, ok := val.(*starProtoMessage); ok {
 		return msg.msg, true
 	}
@@ -34,18 +36,24 @@ func ToProtoMessage(val starlark.Value) (*dynamic.Message, bool) {
 // A Starlark built-in type representing a Protobuf message. Provides attributes
 // for accessing message fields using their original protobuf names.
 type starProtoMessage struct {
-	msg    *dynamic.Message
-	desc   *desc.MessageDescriptor
+	msg    protoreflect.Message
+	desc   protoreflect.MessageDescriptor
 	frozen bool
 
 	// lets the message wrapper keep track of per-field wrappers, for freezing.
 	attrCache map[string]starlark.Value
+
+	// warnings receives the warnings raised when setting fields, it's nil for
+	// messages which weren't created by Starlark code
+	warnings *Warnings
+	// options are the options of the compilation the message belongs to
+	options *Options
 }
 
 func (msg *starProtoMessage) String() string {
-	return fmt.Sprintf("<%s %s>", msg.Type(), msg.msg)
+	return fmt.Sprintf("<%s %s>", msg.Type(), prototext.MarshalOptions{}.Format(msg.msg.Interface()))
 }
-func (msg *starProtoMessage) Type() string         { return msg.msg.XXX_MessageName() }
+func (msg *starProtoMessage) Type() string         { return string(msg.desc.FullName()) }
 func (msg *starProtoMessage) Truth() starlark.Bool { return starlark.True }
 
 func (msg *starProtoMessage) Freeze() {
@@ -65,10 +73,10 @@ func (msg *starProtoMessage) CompareSameType(op syntax.Token, y starlark.Value,
 
 	switch op {
 	case syntax.EQL:
-		eql := dynamic.Equal(msg.msg, other.msg)
+		eql := proto.Equal(msg.msg.Interface(), other.msg.Interface())
 		return eql, nil
 	case syntax.NEQ:
-		eql := dynamic.Equal(msg.msg, other.msg)
+		eql := proto.Equal(msg.msg.Interface(), other.msg.Interface())
 		return !eql, nil
 	default:
 		return false, fmt.Errorf("only == and != operations are supported on protobufs, found %s", op.String())
@@ -77,7 +85,7 @@ func (msg *starProtoMessage) CompareSameType(op syntax.Token, y starlark.Value,
 
 func (msg *starProtoMessage) Hash() (uint32, error) {
 	h := fnv.New32()
-	b, err := msg.msg.Marshal()
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg.msg.Interface())
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to hash")
 	}
@@ -100,14 +108,16 @@ func (msg *starProtoMessage) Attr(name string) (starlark.Value, error) {
 	if attr, ok := msg.attrCache[name]; ok {
 		return attr, nil
 	}
-	field := msg.desc.FindFieldByName(name)
+	field := msg.desc.Fields().ByName(protoreflect.Name(name))
 	if field == nil {
-		return nil, fmt.Errorf("InternalError: field %s not found in message %s", name, msg.desc)
+		return nil, unknownFieldError(msg.desc, name)
 	}
 
 	val := &fieldValue{
-		desc: field,
-		msg:  msg.msg,
+		desc:     field,
+		msg:      msg.msg,
+		warnings: msg.warnings,
+		options:  msg.options,
 	}
 	out := valueToStarlark(val)
 	if msg.frozen {
@@ -119,20 +129,53 @@ func (msg *starProtoMessage) Attr(name string) (starlark.Value, error) {
 
 func (msg *starProtoMessage) AttrNames() []string {
 	var names []string
-	for _, field := range msg.desc.GetFields() {
-		names = append(names, field.GetName())
+	fields := msg.desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		names = append(names, string(fields.Get(i).Name()))
 	}
 	sort.Strings(names)
 	return names
 }
 
+// HasField reports whether a field with presence tracking is set. Message
+// fields, oneof members, proto2 fields, proto3 `optional' fields and editions
+// fields with explicit presence track presence, other fields can't be told
+// apart from their default value.
+func (msg *starProtoMessage) HasField(name string) (bool, error) {
+	field := msg.desc.Fields().ByName(protoreflect.Name(name))
+	if field == nil {
+		return false, unknownFieldError(msg.desc, name)
+	}
+	if field.Cardinality() == protoreflect.Repeated {
+		return false, fmt.Errorf("field %s is repeated and does not track presence, use len() instead", field.FullName())
+	}
+	if !field.HasPresence() {
+		return false, fmt.Errorf("field %s does not track presence, declare it as `optional' (or with explicit field presence) to use it", field.FullName())
+	}
+	return msg.msg.Has(field), nil
+}
+
+// ClearField resets a field to its default value, unsetting it
+func (msg *starProtoMessage) ClearField(name string) error {
+	field := msg.desc.Fields().ByName(protoreflect.Name(name))
+	if field == nil {
+		return unknownFieldError(msg.desc, name)
+	}
+	if err := msg.checkMutable("clear field of"); err != nil {
+		return err
+	}
+	delete(msg.attrCache, name)
+	msg.msg.Clear(field)
+	return nil
+}
+
 func (msg *starProtoMessage) SetField(name string, star starlark.Value) error {
-	field := msg.desc.FindFieldByName(name)
+	field := msg.desc.Fields().ByName(protoreflect.Name(name))
 	if field == nil {
-		return fmt.Errorf("InternalError: field %s not found in message %s", name, msg.desc)
+		return unknownFieldError(msg.desc, name)
 	}
 
-	val, err := valueFromStarlark(field, star)
+	val, err := valueFromStarlark(msg.msg, field, star, msg.options)
 	if err != nil {
 		return err
 	}
@@ -141,41 +184,17 @@ func (msg *starProtoMessage) SetField(name string, star starlark.Value) error {
 		return err
 	}
 
-	if oneof := field.GetOneOf(); oneof != nil {
-		for _, choice := range oneof.GetChoices() {
-			delete(msg.attrCache, choice.GetName())
+	msg.warnings.checkDeprecated(field)
+	if oneof := field.ContainingOneof(); oneof != nil {
+		for i := 0; i < oneof.Fields().Len(); i++ {
+			delete(msg.attrCache, string(oneof.Fields().Get(i).Name()))
 		}
 	} else {
 		delete(msg.attrCache, name)
 	}
 
-	e := msg.msg.TrySetField(field, val)
-	if e != nil {
-		switch v := val.(type) {
-		case []interface{}:
-			for _, x := range v {
-				if rv, ok := x.(proto.Message); ok {
-					m, err := ptypes.MarshalAny(rv)
-					if err != nil {
-						return err
-
-					}
-					err = msg.msg.TryAddRepeatedField(field, m)
-					if err != nil {
-						return errors.Wrapf(err, "failed to add repetated google.protobuf.Any %v (%T)", m, m)
-					}
-				}
-			}
-			return nil
-		case *dynamic.Message:
-			m, err := ptypes.MarshalAny(v)
-			if err != nil {
-				return err
-			}
-			return msg.msg.TrySetField(field, m)
-		}
-	}
-	return e
+	msg.msg.Set(field, val)
+	return nil
 }
 
 var (
@@ -3,20 +3,19 @@ package proto
 import (
 	"fmt"
 
-	"github.com/jhump/protoreflect/desc"
-	"github.com/jhump/protoreflect/dynamic"
-
 	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 func MessageTypeName(val starlark.Value) (string, bool) {
 	if msg, ok := val.(*starProtoMessageType); ok {
-		return msg.desc.GetFullyQualifiedName(), true
+		return string(msg.desc.FullName()), true
 	}
 	return "", false
 }
 
-func NewMessageType(desc *desc.MessageDescriptor) starlark.Value {
+func NewMessageType(desc protoreflect.MessageDescriptor) starlark.Value {
 	mt := &starProtoMessageType{
 		desc: desc,
 	}
@@ -26,13 +25,13 @@ func NewMessageType(desc *desc.MessageDescriptor) starlark.Value {
 // A Starlark built-in type representing a Protobuf message type. This is the
 // message type itself rather than any particular message value.
 type starProtoMessageType struct {
-	desc *desc.MessageDescriptor
+	desc protoreflect.MessageDescriptor
 }
 
 func (mt *starProtoMessageType) String() string {
 	return fmt.Sprintf("<proto.MessageType %s>", mt.Name())
 }
-func (mt *starProtoMessageType) Type() string         { return mt.desc.GetFullyQualifiedName() }
+func (mt *starProtoMessageType) Type() string         { return string(mt.desc.FullName()) }
 func (mt *starProtoMessageType) Freeze()              {}
 func (mt *starProtoMessageType) Truth() starlark.Bool { return starlark.True }
 func (mt *starProtoMessageType) Hash() (uint32, error) {
@@ -40,23 +39,23 @@ func (mt *starProtoMessageType) Hash() (uint32, error) {
 }
 
 func (mt *starProtoMessageType) Name() string {
-	return mt.desc.GetName()
+	return string(mt.desc.Name())
 }
 
 func (mt *starProtoMessageType) Attr(attrName string) (starlark.Value, error) {
-	for _, enum := range mt.desc.GetNestedEnumTypes() {
-		if attrName == enum.GetName() {
-			return &starProtoEnumType{desc: enum}, nil
-		}
+	name := protoreflect.Name(attrName)
+	if enum := mt.desc.Enums().ByName(name); enum != nil {
+		return &starProtoEnumType{desc: enum}, nil
 	}
 
-	for _, message := range mt.desc.GetNestedMessageTypes() {
-		if attrName == message.GetName() {
-			return NewMessageType(message), nil
-		}
+	if message := mt.desc.Messages().ByName(name); message != nil {
+		return NewMessageType(message), nil
+	}
+
+	if extension := mt.desc.Extensions().ByName(name); extension != nil {
+		return NewExtension(extension), nil
 	}
 
-	// FIXME: iterate nested extensions as well?
 	return nil, nil
 }
 
@@ -73,7 +72,29 @@ func (mt *starProtoMessageType) CallInternal(thread *starlark.Thread, args starl
 		return nil, err
 	}
 
-	wrapper := NewStarProtoMessage(dynamic.NewMessage(mt.desc))
+	useDefaults := true
+	var fieldKwargs []starlark.Tuple
+	for _, kwarg := range kwargs {
+		if name, ok := kwarg[0].(starlark.String); ok && name == defaultsKwarg {
+			value, ok := kwarg[1].(starlark.Bool)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be a bool, got %s", mt.Name(), defaultsKwarg, kwarg[1].Type())
+			}
+			useDefaults = bool(value)
+			continue
+		}
+		fieldKwargs = append(fieldKwargs, kwarg)
+	}
+	kwargs = fieldKwargs
+
+	msg := dynamicpb.NewMessage(mt.desc)
+	if useDefaults {
+		if err := prototypesOf(thread).apply(msg); err != nil {
+			return nil, fmt.Errorf("%s: error applying the defaults: %v", mt.Name(), err)
+		}
+	}
+	wrapper := NewStarProtoMessage(msg, optionsOf(thread))
+	wrapper.warnings = warningsOf(thread)
 
 	// Parse the kwarg set into a map[string]starlark.Value, containing one
 	// entry for each provided kwarg. Keys are the original protobuf field names.
@@ -82,10 +103,18 @@ func (mt *starProtoMessageType) CallInternal(thread *starlark.Thread, args starl
 	var parserPairs []interface{}
 	parsedKwargs := make(map[string]*starlark.Value, len(kwargs))
 
-	for _, field := range mt.desc.GetFields() {
+	fields := mt.desc.Fields()
+	for _, kwarg := range kwargs {
+		name, ok := kwarg[0].(starlark.String)
+		if ok && fields.ByName(protoreflect.Name(name)) == nil {
+			return nil, unknownFieldError(mt.desc, string(name))
+		}
+	}
+	for i := 0; i < fields.Len(); i++ {
+		name := string(fields.Get(i).Name())
 		v := new(starlark.Value)
-		parsedKwargs[field.GetName()] = v
-		parserPairs = append(parserPairs, field.GetName()+"?", v)
+		parsedKwargs[name] = v
+		parserPairs = append(parserPairs, name+"?", v)
 	}
 
 	if err := starlark.UnpackArgs(mt.Name(), nil, kwargs, parserPairs...); err != nil {
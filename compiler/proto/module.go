@@ -0,0 +1,106 @@
+package proto
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Module returns the `proto' builtin module, holding helpers to inspect and
+// manipulate proto messages
+func Module() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "proto",
+		Members: starlark.StringDict{
+			"has":   starlark.NewBuiltin("proto.has", starHas),
+			"clear": starlark.NewBuiltin("proto.clear", starClear),
+
+			"set_defaults": starlark.NewBuiltin("proto.set_defaults", starSetDefaults),
+
+			"from_json": starlark.NewBuiltin("proto.from_json", starFromJSON),
+			"from_text": starlark.NewBuiltin("proto.from_text", starFromText),
+
+			"get_extension":   starlark.NewBuiltin("proto.get_extension", starGetExtension),
+			"set_extension":   starlark.NewBuiltin("proto.set_extension", starSetExtension),
+			"has_extension":   starlark.NewBuiltin("proto.has_extension", starHasExtension),
+			"clear_extension": starlark.NewBuiltin("proto.clear_extension", starClearExtension),
+		},
+	}
+}
+
+func starHas(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *starProtoMessage
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msg, &name); err != nil {
+		return nil, err
+	}
+	has, err := msg.HasField(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bool(has), nil
+}
+
+func starClear(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *starProtoMessage
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msg, &name); err != nil {
+		return nil, err
+	}
+	if err := msg.ClearField(name); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.None, nil
+}
+
+func starGetExtension(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *starProtoMessage
+	var ext *starProtoExtension
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msg, &ext); err != nil {
+		return nil, err
+	}
+	val, err := msg.GetExtension(ext)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return val, nil
+}
+
+func starSetExtension(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *starProtoMessage
+	var ext *starProtoExtension
+	var val starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 3, &msg, &ext, &val); err != nil {
+		return nil, err
+	}
+	if err := msg.SetExtension(ext, val); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.None, nil
+}
+
+func starHasExtension(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *starProtoMessage
+	var ext *starProtoExtension
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msg, &ext); err != nil {
+		return nil, err
+	}
+	has, err := msg.HasExtension(ext)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bool(has), nil
+}
+
+func starClearExtension(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *starProtoMessage
+	var ext *starProtoExtension
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msg, &ext); err != nil {
+		return nil, err
+	}
+	if err := msg.ClearExtension(ext); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.None, nil
+}
@@ -0,0 +1,191 @@
+package proto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// NewNamespace returns the `protos' namespace, giving access to the types of
+// the proto files added to it by their fully-qualified names, either as
+// `protos["pkg.Message"]' or as `protos.pkg.Message'. Top level types can also
+// be accessed by their bare name as `protos.Message', as long as no two files
+// define a top level type with that name.
+func NewNamespace() *starProtoNamespace {
+	return &starProtoNamespace{
+		types: &namespaceTypes{
+			byFullName: make(map[string]starlark.Value),
+			byName:     make(map[string][]string),
+			packages:   make(map[string]bool),
+			files:      make(map[string]bool),
+		},
+	}
+}
+
+type namespaceTypes struct {
+	byFullName map[string]starlark.Value
+	// full names of the top level types, by their bare name
+	byName   map[string][]string
+	packages map[string]bool
+	files    map[string]bool
+}
+
+// A Starlark built-in type representing a proto package, or the root of all
+// packages.
+type starProtoNamespace struct {
+	prefix string
+	types  *namespaceTypes
+}
+
+// AddFile adds the types of a proto file and of its imports to the namespace
+func (ns *starProtoNamespace) AddFile(file protoreflect.FileDescriptor) {
+	types := ns.types
+	if types.files[file.Path()] {
+		return
+	}
+	types.files[file.Path()] = true
+
+	imports := file.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		ns.AddFile(imports.Get(i).FileDescriptor)
+	}
+
+	pkg := string(file.Package())
+	for pkg != "" {
+		types.packages[pkg] = true
+		if i := strings.LastIndex(pkg, "."); i >= 0 {
+			pkg = pkg[:i]
+		} else {
+			pkg = ""
+		}
+	}
+
+	types.addTypes(file.Messages(), file.Enums(), file.Extensions(), true)
+}
+
+func (types *namespaceTypes) addTypes(messages protoreflect.MessageDescriptors, enums protoreflect.EnumDescriptors, extensions protoreflect.ExtensionDescriptors, topLevel bool) {
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		types.add(message, NewMessageType(message), topLevel)
+		types.addTypes(message.Messages(), message.Enums(), message.Extensions(), false)
+	}
+	for i := 0; i < enums.Len(); i++ {
+		types.add(enums.Get(i), &starProtoEnumType{desc: enums.Get(i)}, topLevel)
+	}
+	for i := 0; i < extensions.Len(); i++ {
+		types.add(extensions.Get(i), NewExtension(extensions.Get(i)), topLevel)
+	}
+}
+
+func (types *namespaceTypes) add(desc protoreflect.Descriptor, value starlark.Value, topLevel bool) {
+	fullName := string(desc.FullName())
+	if _, ok := types.byFullName[fullName]; ok {
+		return
+	}
+	types.byFullName[fullName] = value
+	if topLevel {
+		name := string(desc.Name())
+		types.byName[name] = append(types.byName[name], fullName)
+	}
+}
+
+func (ns *starProtoNamespace) String() string {
+	if ns.prefix == "" {
+		return "<protos>"
+	}
+	return fmt.Sprintf("<protos %s>", ns.prefix)
+}
+func (ns *starProtoNamespace) Type() string         { return "protos" }
+func (ns *starProtoNamespace) Freeze()              {}
+func (ns *starProtoNamespace) Truth() starlark.Bool { return starlark.True }
+func (ns *starProtoNamespace) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: %s", ns.Type())
+}
+
+func (ns *starProtoNamespace) fullName(name string) string {
+	if ns.prefix == "" {
+		return name
+	}
+	return ns.prefix + "." + name
+}
+
+func (ns *starProtoNamespace) Attr(name string) (starlark.Value, error) {
+	fullName := ns.fullName(name)
+	if value, ok := ns.types.byFullName[fullName]; ok {
+		return value, nil
+	}
+	if ns.types.packages[fullName] {
+		return &starProtoNamespace{prefix: fullName, types: ns.types}, nil
+	}
+	if ns.prefix != "" {
+		return nil, nil
+	}
+
+	fullNames := ns.types.byName[name]
+	switch len(fullNames) {
+	case 0:
+		return nil, nil
+	case 1:
+		return ns.types.byFullName[fullNames[0]], nil
+	}
+	sorted := append([]string(nil), fullNames...)
+	sort.Strings(sorted)
+	return nil, fmt.Errorf("ambiguous name %s, it is defined as %s; use its full name, e.g. protos[%q]",
+		name, strings.Join(sorted, ", "), sorted[0])
+}
+
+func (ns *starProtoNamespace) AttrNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(fullName string) {
+		if ns.prefix != "" {
+			if !strings.HasPrefix(fullName, ns.prefix+".") {
+				return
+			}
+			fullName = strings.TrimPrefix(fullName, ns.prefix+".")
+		}
+		name := strings.SplitN(fullName, ".", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for pkg := range ns.types.packages {
+		add(pkg)
+	}
+	for fullName := range ns.types.byFullName {
+		add(fullName)
+	}
+	if ns.prefix == "" {
+		for name, fullNames := range ns.types.byName {
+			if len(fullNames) == 1 && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get looks up a type by its fully-qualified name, relative to the package of
+// the namespace
+func (ns *starProtoNamespace) Get(key starlark.Value) (starlark.Value, bool, error) {
+	name, ok := key.(starlark.String)
+	if !ok {
+		return nil, false, fmt.Errorf("protos: want a string key, got %s", key.Type())
+	}
+	value, found := ns.types.byFullName[ns.fullName(strings.TrimPrefix(string(name), "."))]
+	if !found {
+		return nil, false, fmt.Errorf("protos: type %s not found, load the proto file defining it first", name)
+	}
+	return value, true, nil
+}
+
+var (
+	_ starlark.HasAttrs = (*starProtoNamespace)(nil)
+	_ starlark.Mapping  = (*starProtoNamespace)(nil)
+)
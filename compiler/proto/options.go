@@ -0,0 +1,48 @@
+package proto
+
+import (
+	"go.starlark.net/starlark"
+)
+
+const optionsLocal = "protoconf.options"
+
+// Options are the options of a compilation, which the messages created by
+// its threads follow. Every compilation has its own, the compilations running
+// concurrently don't share them.
+type Options struct {
+	// AnyTypeURLPrefix is prepended to the full name of messages assigned to
+	// `google.protobuf.Any' fields to form their type URL
+	AnyTypeURLPrefix string
+	// OpenEnums lets the fields of open enums, the enums of proto3 files,
+	// hold numbers their enum doesn't define. Closed enums only hold the
+	// values they define.
+	OpenEnums bool
+}
+
+// AttachTo makes the options apply to the messages created by thread
+func (o *Options) AttachTo(thread *starlark.Thread) {
+	thread.SetLocal(optionsLocal, o)
+}
+
+func optionsOf(thread *starlark.Thread) *Options {
+	if thread == nil {
+		return nil
+	}
+	o, _ := thread.Local(optionsLocal).(*Options)
+	return o
+}
+
+// anyTypeURLPrefix is the type URL prefix of the options, the default prefix
+// for the messages which weren't created by a compilation
+func (o *Options) anyTypeURLPrefix() string {
+	if o == nil || o.AnyTypeURLPrefix == "" {
+		return DefaultAnyTypeURLPrefix
+	}
+	return o.AnyTypeURLPrefix
+}
+
+// openEnums tells whether the options allow open enums, which the messages
+// which weren't created by a compilation don't
+func (o *Options) openEnums() bool {
+	return o != nil && o.OpenEnums
+}
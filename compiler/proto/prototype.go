@@ -0,0 +1,81 @@
+package proto
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// defaultsKwarg is the keyword argument of message constructors which, set to
+// False, starts the new message empty instead of from its type's prototype
+const defaultsKwarg = "__defaults__"
+
+const prototypesLocal = "protoconf.prototypes"
+
+// Prototypes holds the messages that new messages of a type start from, as
+// registered by proto.set_defaults. They are shared by the threads of a
+// compilation they are attached to.
+type Prototypes struct {
+	messages map[protoreflect.FullName][]byte
+}
+
+func NewPrototypes() *Prototypes {
+	return &Prototypes{messages: make(map[protoreflect.FullName][]byte)}
+}
+
+// AttachTo makes the prototypes available to message constructors and to
+// proto.set_defaults when called from thread
+func (p *Prototypes) AttachTo(thread *starlark.Thread) {
+	thread.SetLocal(prototypesLocal, p)
+}
+
+func prototypesOf(thread *starlark.Thread) *Prototypes {
+	if thread == nil {
+		return nil
+	}
+	p, _ := thread.Local(prototypesLocal).(*Prototypes)
+	return p
+}
+
+func (p *Prototypes) set(message protoreflect.Message) error {
+	name := message.Descriptor().FullName()
+	if _, ok := p.messages[name]; ok {
+		return fmt.Errorf("the defaults of %s are already set", name)
+	}
+	// Kept marshaled so later changes to message don't leak to new messages
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(message.Interface())
+	if err != nil {
+		return fmt.Errorf("error marshaling the defaults of %s: %v", name, err)
+	}
+	p.messages[name] = data
+	return nil
+}
+
+// apply copies the prototype of the message type, if any, into message
+func (p *Prototypes) apply(message protoreflect.Message) error {
+	if p == nil {
+		return nil
+	}
+	data, ok := p.messages[message.Descriptor().FullName()]
+	if !ok {
+		return nil
+	}
+	return proto.UnmarshalOptions{Merge: true}.Unmarshal(data, message.Interface())
+}
+
+func starSetDefaults(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *starProtoMessage
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &msg); err != nil {
+		return nil, err
+	}
+	prototypes := prototypesOf(t)
+	if prototypes == nil {
+		return nil, fmt.Errorf("%s: message defaults can't be set here", fn.Name())
+	}
+	if err := prototypes.set(msg.msg); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.None, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type protoRepeated struct {
@@ -100,7 +101,7 @@ func (r *protoRepeated) Clear() error {
 	if err := r.list.Clear(); err != nil {
 		return err
 	}
-	r.field.msg.ClearField(r.field.desc)
+	r.field.msg.Clear(r.field.desc)
 	return nil
 }
 
@@ -108,20 +109,20 @@ func (r *protoRepeated) Append(v starlark.Value) error {
 	if v == starlark.None {
 		return typeError(r.field.desc, v)
 	}
-	goVal, err := valueFromStarlark(r.field.desc, v)
+	goVal, err := elemFromStarlark(r.field.desc, v, r.field.options)
 	if err != nil {
 		return err
 	}
 	if err := r.list.Append(v); err != nil {
 		return err
 	}
-	r.field.msg.AddRepeatedField(r.field.desc, goVal)
+	r.field.msg.Mutable(r.field.desc).List().Append(goVal)
 	return nil
 }
 
 func (r *protoRepeated) implExtend(t *starlark.Thread, iterable starlark.Iterable) error {
 	var starValues []starlark.Value
-	var goValues []interface{}
+	var goValues []protoreflect.Value
 	iter := iterable.Iterate()
 	defer iter.Done()
 	var starVal starlark.Value
@@ -129,7 +130,7 @@ func (r *protoRepeated) implExtend(t *starlark.Thread, iterable starlark.Iterabl
 		if starVal == starlark.None {
 			return typeError(r.field.desc, starVal)
 		}
-		goVal, err := valueFromStarlark(r.field.desc, starVal)
+		goVal, err := elemFromStarlark(r.field.desc, starVal, r.field.options)
 		if err != nil {
 			return err
 		}
@@ -144,8 +145,9 @@ func (r *protoRepeated) implExtend(t *starlark.Thread, iterable starlark.Iterabl
 	if _, err := starlark.Call(t, listExtend, args, nil); err != nil {
 		return err
 	}
+	list := r.field.msg.Mutable(r.field.desc).List()
 	for _, goVal := range goValues {
-		r.field.msg.AddRepeatedField(r.field.desc, goVal)
+		list.Append(goVal)
 	}
 	return nil
 }
@@ -154,14 +156,14 @@ func (r *protoRepeated) SetIndex(i int, v starlark.Value) error {
 	if v == starlark.None {
 		return typeError(r.field.desc, v)
 	}
-	goVal, err := valueFromStarlark(r.field.desc, v)
+	goVal, err := elemFromStarlark(r.field.desc, v, r.field.options)
 	if err != nil {
 		return err
 	}
 	if err := r.list.SetIndex(i, v); err != nil {
 		return err
 	}
-	r.field.msg.SetRepeatedField(r.field.desc, i, goVal)
+	r.field.msg.Mutable(r.field.desc).List().Set(i, goVal)
 	return nil
 }
 
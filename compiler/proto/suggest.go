@@ -0,0 +1,95 @@
+package proto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxSuggestions is the maximal number of names listed in a did-you-mean hint
+const maxSuggestions = 3
+
+// unknownFieldError reports a field missing from a message, suggesting the
+// closest field names, or a name reserved by the message
+func unknownFieldError(desc protoreflect.MessageDescriptor, name string) error {
+	if desc.ReservedNames().Has(protoreflect.Name(name)) {
+		return fmt.Errorf("field %q is reserved in message %s", name, desc.FullName())
+	}
+	var names []string
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		names = append(names, string(fields.Get(i).Name()))
+	}
+	return fmt.Errorf("field %q not found in message %s%s", name, desc.FullName(), didYouMean(closestNames(name, names)))
+}
+
+func didYouMean(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf(" (did you mean %q?)", names[0])
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf(" (did you mean one of %s?)", strings.Join(quoted, ", "))
+}
+
+// closestNames returns the candidates close enough to name to be a typo of
+// it, closest first. Names are compared ignoring case and underscores, so
+// `string_value' matches `stringValue'.
+func closestNames(name string, candidates []string) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+	target := normalizeName(name)
+	maxDistance := (len(target) + 2) / 3
+	var matches []match
+	for _, candidate := range candidates {
+		if d := levenshtein(target, normalizeName(candidate)); d <= maxDistance {
+			matches = append(matches, match{name: candidate, distance: d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+	var names []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		names = append(names, matches[i].name)
+	}
+	return names
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(t)]
+}
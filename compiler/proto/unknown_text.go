@@ -0,0 +1,217 @@
+package proto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// dropUnknownText removes the fields unknown to desc from a message in the
+// text format. Only field names are looked at, the syntax of values is left
+// for prototext to check.
+func dropUnknownText(data []byte, desc protoreflect.MessageDescriptor) ([]byte, []string, error) {
+	s := &textScanner{src: string(data)}
+	var dropped []string
+	var ranges [][2]int
+	if err := s.message(desc, "", "", &dropped, &ranges); err != nil {
+		return nil, nil, err
+	}
+	if tok, pos := s.next(); tok != "" {
+		return nil, nil, s.errorf(pos, "unexpected %q", tok)
+	}
+
+	var known strings.Builder
+	last := 0
+	for _, r := range ranges {
+		known.WriteString(s.src[last:r[0]])
+		last = r[1]
+	}
+	known.WriteString(s.src[last:])
+	sort.Strings(dropped)
+	return []byte(known.String()), dropped, nil
+}
+
+// textScanner splits the text format into tokens: punctuation, quoted strings
+// and runs of other characters (names, numbers, enum values)
+type textScanner struct {
+	src string
+	pos int
+}
+
+func (s *textScanner) errorf(pos int, format string, args ...interface{}) error {
+	line := strings.Count(s.src[:pos], "\n") + 1
+	column := pos - strings.LastIndex(s.src[:pos], "\n")
+	return fmt.Errorf("(line %d:%d): %s", line, column, fmt.Sprintf(format, args...))
+}
+
+func (s *textScanner) skipSpace() {
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case c == '#':
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token and its offset, or an empty token at the end
+func (s *textScanner) next() (string, int) {
+	s.skipSpace()
+	start := s.pos
+	if s.pos >= len(s.src) {
+		return "", start
+	}
+	switch c := s.src[s.pos]; c {
+	case '{', '}', '<', '>', '[', ']', ':', ',', ';', '/':
+		s.pos++
+	case '"', '\'':
+		s.pos++
+		for s.pos < len(s.src) && s.src[s.pos] != c && s.src[s.pos] != '\n' {
+			if s.src[s.pos] == '\\' {
+				s.pos++
+			}
+			s.pos++
+		}
+		s.pos++
+		if s.pos > len(s.src) {
+			s.pos = len(s.src)
+		}
+	default:
+		for s.pos < len(s.src) && !strings.ContainsRune("{}<>[]:,;/\"'# \t\n\r\f\v", rune(s.src[s.pos])) {
+			s.pos++
+		}
+	}
+	return s.src[start:s.pos], start
+}
+
+func (s *textScanner) peek() string {
+	pos := s.pos
+	tok, _ := s.next()
+	s.pos = pos
+	return tok
+}
+
+func isString(tok string) bool {
+	return strings.HasPrefix(tok, `"`) || strings.HasPrefix(tok, "'")
+}
+
+// message scans the fields of a message up to its closing token, recording
+// the fields unknown to desc. A nil desc accepts any field.
+func (s *textScanner) message(desc protoreflect.MessageDescriptor, path string, closing string, dropped *[]string, ranges *[][2]int) error {
+	// Elements of repeated fields may be split over several entries
+	counts := make(map[protoreflect.FieldDescriptor]*int)
+	for {
+		tok, start := s.next()
+		switch tok {
+		case closing:
+			return nil
+		case "":
+			if closing == "" {
+				return nil
+			}
+			return s.errorf(start, "expected %q", closing)
+		}
+
+		var field protoreflect.FieldDescriptor
+		known := true
+		name := tok
+		if tok == "[" {
+			// Extensions and expanded `Any' messages are resolved by prototext
+			for tok != "]" {
+				if tok, _ = s.next(); tok == "" {
+					return s.errorf(start, "unterminated %q", "[")
+				}
+			}
+			name = s.src[start:s.pos]
+		} else if desc != nil {
+			if field = desc.Fields().ByTextName(tok); field == nil {
+				known = false
+			}
+		}
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+
+		var fieldDesc protoreflect.MessageDescriptor
+		var index *int
+		if field != nil {
+			fieldDesc = field.Message()
+			if field.IsList() {
+				if counts[field] == nil {
+					counts[field] = new(int)
+				}
+				index = counts[field]
+			}
+		}
+		if s.peek() == ":" {
+			s.next()
+		}
+		if err := s.value(fieldDesc, fieldPath, index, known, dropped, ranges); err != nil {
+			return err
+		}
+		if sep := s.peek(); sep == "," || sep == ";" {
+			s.next()
+		}
+		if !known {
+			*dropped = append(*dropped, fieldPath)
+			*ranges = append(*ranges, [2]int{start, s.pos})
+		}
+	}
+}
+
+// value scans the value of a field, a message, a list or a scalar. Messages
+// of unknown fields are scanned without a descriptor, dropping nothing. The
+// values of repeated fields are numbered from index.
+func (s *textScanner) value(desc protoreflect.MessageDescriptor, path string, index *int, known bool, dropped *[]string, ranges *[][2]int) error {
+	if !known {
+		desc = nil
+		dropped, ranges = &[]string{}, &[][2]int{}
+	}
+	elemPath := func() string {
+		if index == nil {
+			return path
+		}
+		*index++
+		return fmt.Sprintf("%s[%d]", path, *index-1)
+	}
+	tok, start := s.next()
+	switch tok {
+	case "{":
+		return s.message(desc, elemPath(), "}", dropped, ranges)
+	case "<":
+		return s.message(desc, elemPath(), ">", dropped, ranges)
+	case "[":
+		for {
+			if s.peek() == "]" {
+				s.next()
+				return nil
+			}
+			if err := s.value(desc, elemPath(), nil, true, dropped, ranges); err != nil {
+				return err
+			}
+			if tok, pos := s.next(); tok == "]" {
+				return nil
+			} else if tok != "," {
+				return s.errorf(pos, "expected %q or %q", ",", "]")
+			}
+		}
+	case "", "}", ">", "]", ":", ",", ";":
+		return s.errorf(start, "expected a value")
+	case "-":
+		// A sign separated from its number
+		s.next()
+	}
+	// Adjacent strings are concatenated
+	for isString(tok) && isString(s.peek()) {
+		tok, _ = s.next()
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package proto
+
+import (
+	"fmt"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const warningsLocal = "protoconf.warnings"
+
+// Kinds of warnings, each reported separately
+const (
+	// WarningDeprecated is raised by setting deprecated fields
+	WarningDeprecated = "deprecated fields"
+	// WarningUnknownFields is raised by dropping unknown fields of ingested data
+	WarningUnknownFields = "unknown fields"
+	// WarningValidators is raised by validators calling warn()
+	WarningValidators = "validator warnings"
+)
+
+// Warnings collects the warnings raised while evaluating the Starlark code of
+// a compilation, such as setting deprecated fields, with their positions. The
+// validators of a compilation may raise them concurrently.
+type Warnings struct {
+	lock sync.Mutex
+	// thread is the thread attached last. The threads of a compilation run one
+	// after the other, so it is the one running when fields are set.
+	thread   *starlark.Thread
+	seen     map[string]bool
+	messages map[string][]string
+}
+
+func NewWarnings() *Warnings {
+	return &Warnings{seen: make(map[string]bool), messages: make(map[string][]string)}
+}
+
+// AttachTo reports the warnings of messages created by thread to w
+func (w *Warnings) AttachTo(thread *starlark.Thread) {
+	thread.SetLocal(warningsLocal, w)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.thread = thread
+}
+
+// Messages returns the warnings of a kind in the order they were raised, each
+// starting with its position
+func (w *Warnings) Messages(kind string) []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return append([]string(nil), w.messages[kind]...)
+}
+
+func warningsOf(thread *starlark.Thread) *Warnings {
+	if thread == nil {
+		return nil
+	}
+	w, _ := thread.Local(warningsLocal).(*Warnings)
+	return w
+}
+
+// Warn raises a warning of a kind at the position of the Starlark code
+// running on thread
+func Warn(thread *starlark.Thread, kind string, msg string) {
+	warningsOf(thread).warn(thread, kind, msg)
+}
+
+// warnf raises a warning at the position of the Starlark code running on the
+// thread attached last
+func (w *Warnings) warnf(kind string, format string, args ...interface{}) {
+	if w == nil {
+		return
+	}
+	w.lock.Lock()
+	thread := w.thread
+	w.lock.Unlock()
+	w.warn(thread, kind, fmt.Sprintf(format, args...))
+}
+
+func (w *Warnings) warn(thread *starlark.Thread, kind string, msg string) {
+	if w == nil {
+		return
+	}
+	if pos, ok := Position(thread); ok {
+		msg = fmt.Sprintf("%s: %s", pos, msg)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.seen[msg] {
+		w.seen[msg] = true
+		w.messages[kind] = append(w.messages[kind], msg)
+	}
+}
+
+// Position returns the position of the innermost Starlark frame of thread,
+// leaving out builtins
+func Position(thread *starlark.Thread) (syntax.Position, bool) {
+	if thread == nil {
+		return syntax.Position{}, false
+	}
+	for i := 0; i < thread.CallStackDepth(); i++ {
+		if pos := thread.CallFrame(i).Pos; pos.Filename() != "<builtin>" {
+			return pos, true
+		}
+	}
+	return syntax.Position{}, false
+}
+
+// checkDeprecated warns when a field marked `deprecated = true' is set
+func (w *Warnings) checkDeprecated(field protoreflect.FieldDescriptor) {
+	if options, ok := field.Options().(interface{ GetDeprecated() bool }); ok && options.GetDeprecated() {
+		w.warnf(WarningDeprecated, "field %s is deprecated", field.FullName())
+	}
+}
@@ -0,0 +1,119 @@
+package compiler
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	compilerlib "github.com/protoconf/protoconf/compiler/lib"
+	"github.com/protoconf/protoconf/consts"
+)
+
+type testCommand struct{}
+
+type testConfig struct {
+	verboseLogging bool
+	noCache        bool
+	protoPaths     stringsArray
+}
+
+func newTestFlagSet() (*flag.FlagSet, *testConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... protoconf_root [test]...")
+		flags.PrintDefaults()
+	}
+
+	config := &testConfig{}
+	flags.BoolVar(&config.verboseLogging, "V", false, "Verbose logging")
+	flags.BoolVar(&config.noCache, "no-cache", false, "Don't cache parsed protos in "+consts.CachePath)
+	flags.Var(&config.protoPaths, "proto-path", "An additional directory to import protos from (can repeat)")
+
+	return flags, config
+}
+
+func (c *testCommand) Run(args []string) int {
+	flags, config := newTestFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 1
+	}
+
+	protoconfRoot := strings.TrimSpace(flags.Args()[0])
+	compiler := compilerlib.NewCompiler(protoconfRoot, config.verboseLogging)
+	if config.noCache {
+		compiler.CacheDir = ""
+	}
+	for _, protoPath := range config.protoPaths {
+		compiler.AddProtoPath(protoPath)
+	}
+
+	var tests []string
+	if flags.NArg() == 1 {
+		var err error
+		tests, err = getAllSources(protoconfRoot, consts.TestExtension)
+		if err != nil {
+			log.Printf("Error getting all tests from %s, err=%s", protoconfRoot, err)
+			return 1
+		}
+	} else {
+		tests = flags.Args()[1:]
+	}
+
+	if !runTests(compiler, tests, os.Stdout) {
+		return 1
+	}
+	return 0
+}
+
+// runTests runs the test files, printing the result of every test function and
+// a summary to out, and reports whether all of them passed
+func runTests(compiler *compilerlib.Compiler, tests []string, out io.Writer) bool {
+	passed, failed := 0, 0
+	for _, test := range tests {
+		filename := strings.TrimPrefix(strings.TrimSpace(test), "/")
+		results, err := compiler.RunTests(filename)
+		if err != nil {
+			fmt.Fprintf(out, "FAIL %s: %v\n", filename, err)
+			failed++
+			continue
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Fprintf(out, "FAIL %s %s: %v\n", filename, result.Name, result.Err)
+				failed++
+			} else {
+				fmt.Fprintf(out, "PASS %s %s\n", filename, result.Name)
+				passed++
+			}
+		}
+	}
+	fmt.Fprintf(out, "%d passed, %d failed\n", passed, failed)
+	return failed == 0
+}
+
+func (c *testCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _ := newTestFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *testCommand) Synopsis() string {
+	return "Run the tests of validators"
+}
+
+// TestCommand is a cli.CommandFactory
+func TestCommand() (cli.Command, error) {
+	return &testCommand{}, nil
+}
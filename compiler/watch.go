@@ -0,0 +1,245 @@
+package compiler
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	compilerlib "github.com/protoconf/protoconf/compiler/lib"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/inserter"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// watchDebounce is how long the changes of the sources are collected once
+// one is seen, so that a change touching several files, such as a git
+// checkout, compiles the configs it affects once
+const watchDebounce = 200 * time.Millisecond
+
+// watchSources compiles again the configs affected by every change of the
+// sources of protoconfRoot and of the proto paths, as graph says they
+// depend on them, until the sources can't be watched anymore. The configs
+// compiled again are inserted to store under prefix when store isn't nil.
+func (config *cliConfig) watchSources(protoconfRoot string, graph compilerlib.DependencyGraph, store libprotoconf.Store, prefix string) int {
+	roots := []string{filepath.Join(protoconfRoot, consts.SrcPath)}
+	roots = append(roots, config.protoPaths...)
+	watcher, err := newSourceWatcher(roots)
+	if err != nil {
+		log.Printf("Error watching the sources, err=%s", err)
+		return 1
+	}
+	defer watcher.close()
+	log.Printf("Watching the sources of %d configs for changes", len(graph))
+
+	for changed := range watcher.changes(watchDebounce) {
+		configs := graph.Affected(changed)
+		for _, file := range changed {
+			if strings.HasSuffix(file, consts.ConfigExtension) || strings.HasSuffix(file, consts.MultiConfigExtension) {
+				configs = append(configs, file)
+			}
+		}
+		configs = existingConfigs(protoconfRoot, configs, graph)
+		if len(configs) == 0 {
+			continue
+		}
+		log.Printf("Compiling %d configs affected by the changes of %s", len(configs), strings.Join(changed, ", "))
+		compiler, err := config.newCompiler(protoconfRoot)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		err = config.compile(compiler, configs)
+		graph.Merge(compiler.Dependencies())
+		if err != nil {
+			log.Printf("Error compiling the configs affected, the configs which failed are compiled again once their sources change, err=%s", err)
+			continue
+		}
+		log.Printf("Compiled %s", strings.Join(configs, ", "))
+		if store != nil {
+			if err := publish(compiler.Compiled(), protoconfRoot, store, prefix); err != nil {
+				log.Printf("Error publishing the configs compiled, err=%s", err)
+			}
+		}
+	}
+	log.Println("Error watching the sources, the watch ended")
+	return 1
+}
+
+// existingConfigs drops the configs removed from the sources, and from the
+// graph, and the configs listed twice
+func existingConfigs(protoconfRoot string, configs []string, graph compilerlib.DependencyGraph) []string {
+	sort.Strings(configs)
+	var existing []string
+	for i, source := range configs {
+		if i > 0 && configs[i-1] == source {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(protoconfRoot, consts.SrcPath, filepath.FromSlash(source))); os.IsNotExist(err) {
+			if _, ok := graph[source]; ok {
+				log.Printf("Config %s was removed, its outputs are left materialized", source)
+				delete(graph, source)
+			}
+			continue
+		}
+		existing = append(existing, source)
+	}
+	return existing
+}
+
+// publish inserts the outputs compiled which changed to store under prefix,
+// in one transaction when the store is a libprotoconf.BatchStore
+func publish(outputs []string, protoconfRoot string, store libprotoconf.Store, prefix string) error {
+	var configFiles []string
+	for _, output := range outputs {
+		configFiles = append(configFiles, output+consts.CompiledConfigExtension)
+	}
+	keys, values, err := inserter.EncodeCompiled(configFiles, protoconfRoot, prefix)
+	if err != nil {
+		return err
+	}
+	changed := make(map[string][]byte)
+	for _, key := range keys {
+		current, err := store.Get(key)
+		if err != nil && err != libprotoconf.ErrConfigNotFound {
+			return err
+		}
+		if string(current) != string(values[key]) {
+			changed[key] = values[key]
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	if batch, ok := store.(libprotoconf.BatchStore); ok {
+		if err := batch.SetAll(changed); err != nil {
+			return err
+		}
+	} else {
+		for key, value := range changed {
+			if err := store.Set(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	for key := range changed {
+		log.Printf("Published config, path=%s", strings.TrimPrefix(key, prefix))
+	}
+	return nil
+}
+
+// sourceWatcher watches the files under the src dir and the proto paths,
+// the directories created along with them
+type sourceWatcher struct {
+	fsnotifyWatcher *fsnotify.Watcher
+	roots           []string
+}
+
+func newSourceWatcher(roots []string) (*sourceWatcher, error) {
+	fsnotifyWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &sourceWatcher{fsnotifyWatcher: fsnotifyWatcher}
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			fsnotifyWatcher.Close()
+			return nil, err
+		}
+		w.roots = append(w.roots, absRoot)
+		if err := w.addDirs(absRoot, nil); err != nil {
+			fsnotifyWatcher.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// addDirs watches dir and the directories under it, adding the files found
+// to changed when it isn't nil
+func (w *sourceWatcher) addDirs(dir string, changed map[string]bool) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if file, ok := w.relative(path); ok && changed != nil {
+				changed[file] = true
+			}
+			return nil
+		}
+		return w.fsnotifyWatcher.Add(path)
+	})
+}
+
+// relative is the path of a file relative to the root it's under
+func (w *sourceWatcher) relative(name string) (string, bool) {
+	for _, root := range w.roots {
+		rel, err := filepath.Rel(root, name)
+		if err == nil && rel != ".." && !strings.HasPrefix(filepath.ToSlash(rel), "../") {
+			return filepath.ToSlash(rel), true
+		}
+	}
+	return "", false
+}
+
+// changes sends the files changed, relative to their root and in order, once
+// no file changed for debounce. It's closed when the files can't be watched
+// anymore.
+func (w *sourceWatcher) changes(debounce time.Duration) <-chan []string {
+	changesCh := make(chan []string)
+	go func() {
+		defer close(changesCh)
+		changed := make(map[string]bool)
+		var timer <-chan time.Time
+		for {
+			select {
+			case event, ok := <-w.fsnotifyWatcher.Events:
+				if !ok {
+					return
+				}
+				// The files of the directories created, such as by a
+				// checkout, are changed along with them
+				if event.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if err := w.addDirs(event.Name, changed); err != nil {
+							log.Printf("Error watching directory %s, err=%s", event.Name, err)
+						}
+						timer = time.After(debounce)
+						continue
+					}
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				if file, ok := w.relative(event.Name); ok {
+					changed[file] = true
+					timer = time.After(debounce)
+				}
+			case err, ok := <-w.fsnotifyWatcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Error watching the sources, err=%s", err)
+			case <-timer:
+				files := make([]string, 0, len(changed))
+				for file := range changed {
+					files = append(files, file)
+				}
+				sort.Strings(files)
+				changesCh <- files
+				changed = make(map[string]bool)
+				timer = nil
+			}
+		}
+	}()
+	return changesCh
+}
+
+func (w *sourceWatcher) close() {
+	w.fsnotifyWatcher.Close()
+}
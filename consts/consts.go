@@ -4,16 +4,23 @@ var Version = "0.0.1"
 
 const (
 	AgentDefaultAddress      = ":4300"
+	CachePath                = ".protoconf/cache/"
 	CompiledConfigExtension  = ".materialized_JSON"
 	CompiledConfigPath       = "materialized_config/"
+	DescriptorSetExtension   = ".protoset"
 	ConfigExtension          = ".pconf"
 	EtcdDefaultAddress       = "127.0.0.1:2379"
+	GoModFile                = "go.mod"
 	MultiConfigExtension     = ".mpconf"
 	MutableConfigPath        = "mutable_config/"
 	MutableConfigPrefix      = "mutable:"
 	ProtoExtension           = ".proto"
+	RedisDefaultAddress      = "127.0.0.1:6379"
 	ServerDefaultAddress     = ":4301"
 	SrcPath                  = "src/"
+	StubsPath                = ".protoconf/stubs/"
+	TestExtension            = ".ptest"
 	ValidatorExtensionSuffix = "-validator"
+	WorkspaceConfigFile      = "protoconf.yaml"
 	ZookeeperDefaultAddress  = "127.0.0.1:2181"
 )
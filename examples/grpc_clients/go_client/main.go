@@ -1,16 +1,16 @@
 package main
 
 import (
-	"io"
+	"context"
 	"log"
 	"os"
 
-	"github.com/golang/protobuf/ptypes"
-	pc "github.com/protoconf/protoconf/agent/api/proto/v1"
 	"github.com/protoconf/protoconf/consts"
 	pb "github.com/protoconf/protoconf/examples/protoconf/src/crawler"
-	"golang.org/x/net/context"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/protoconfload"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -36,33 +36,14 @@ func listenToChanges(path string) {
 	}
 	defer conn.Close()
 
-	c := pc.NewProtoconfServiceClient(conn)
-	stream, err := c.SubscribeForConfig(context.Background(), &pc.ConfigSubscriptionRequest{Path: path})
-	if err != nil {
-		log.Fatalf("Error subscribing for config path=%s err=%v", path, err)
-	}
-
-	firstRead := true
-	config := &pb.CrawlerService{}
-	for {
-		update, err := stream.Recv()
-
-		if err == io.EOF {
-			log.Fatalf("Connection closed while streaming config path=%s", path)
-		}
-		if err != nil {
-			log.Fatalf("Error while streaming config path=%s err=%s", path, err)
-		}
-
-		if err = ptypes.UnmarshalAny(update.GetValue(), config); err != nil {
-			log.Fatalf("Error unmarshaling config path=%s value=%s err=%s", path, update.Value, err)
-		}
-
-		if firstRead {
-			firstRead = false
-			log.Printf("Config %s initial value: %s", path, config)
-		} else {
-			log.Printf("Config %s changed, new value: %s", path, config)
-		}
+	ctx := context.Background()
+	client := protoconfload.NewClient(conn, libprotoconf.Client{}, protoconfload.DefaultRetryInterval)
+	config := client.Subscribe(ctx, path, &pb.CrawlerService{}, func(message proto.Message) {
+		log.Printf("Config %s changed, new value: %s", path, message)
+	})
+	if err := config.Wait(ctx); err != nil {
+		log.Fatalf("Error reading config path=%s err=%s", path, err)
 	}
+	log.Printf("Config %s initial value: %s", path, config.Get().(*pb.CrawlerService))
+	select {}
 }
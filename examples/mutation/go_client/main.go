@@ -7,14 +7,14 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/golang/protobuf/descriptor"
-	"github.com/golang/protobuf/ptypes"
 	"github.com/protoconf/protoconf/consts"
 	pv "github.com/protoconf/protoconf/datatypes/proto/v1"
 	pb "github.com/protoconf/protoconf/examples/protoconf/src/crawler"
 	pc "github.com/protoconf/protoconf/server/api/proto/v1"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 const (
@@ -50,13 +50,13 @@ func main() {
 	log.Printf("Mutated %s successfully", path)
 }
 
-func mutate(path string, value descriptor.Message, scriptMetadata string) error {
-	fileDesc, _ := descriptor.ForMessage(value)
-	any, err := ptypes.MarshalAny(value)
+func mutate(path string, value proto.Message, scriptMetadata string) error {
+	any, err := anypb.New(value)
 	if err != nil {
 		return fmt.Errorf("error marshalling message to any message=%s err=%s", value, err)
 	}
-	config := &pv.ProtoconfValue{ProtoFile: fileDesc.GetName(), Value: any}
+	protoFile := value.ProtoReflect().Descriptor().ParentFile().Path()
+	config := &pv.ProtoconfValue{ProtoFile: protoFile, Value: any}
 	request := &pc.ConfigMutationRequest{Path: path, Value: config, ScriptMetadata: scriptMetadata}
 
 	address := consts.ServerDefaultAddress
@@ -10,6 +10,7 @@ import (
 	"os/signal"
 
 	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/command"
 )
 
 type cliCommand struct {
@@ -26,6 +27,7 @@ type cliConfig struct {
 	protoconfPath      string
 	protosDir          string
 	protoconfAgentAddr string
+	tls                command.TLSConfig
 }
 
 func newFlagSet() (*flag.FlagSet, *cliConfig) {
@@ -39,6 +41,7 @@ func newFlagSet() (*flag.FlagSet, *cliConfig) {
 	flags.StringVar(&config.protoconfPath, "config", "", "The path of the protoconf config.")
 	flags.StringVar(&config.protosDir, "proto_dir", "", "The path on disk where the .proto files could be found.")
 	flags.StringVar(&config.protoconfAgentAddr, "protoconf_agent_addr", "localhost:4300", "The address to call on the protoconf agent.")
+	command.AddTLSClientFlags(flags, &config.tls)
 
 	return flags, config
 }
@@ -46,7 +49,12 @@ func newFlagSet() (*flag.FlagSet, *cliConfig) {
 func (c *cliCommand) Run(args []string) int {
 	flags, config := newFlagSet()
 	flags.Parse(args)
-	e, err := NewExecutor(config.protoconfPath, config.protosDir, config.protoconfAgentAddr)
+	transport, err := config.tls.DialOption()
+	if err != nil {
+		log.Printf("Error setting up mutual TLS, err=%s", err)
+		return 1
+	}
+	e, err := NewExecutor(config.protoconfPath, config.protosDir, config.protoconfAgentAddr, transport)
 	if err != nil {
 		return 1
 	}
@@ -17,7 +17,6 @@ import (
 	"io"
 	"log"
 
-	"github.com/golang/protobuf/ptypes"
 	"github.com/pkg/errors"
 	pc "github.com/protoconf/protoconf/agent/api/proto/v1"
 	exec_config "github.com/protoconf/protoconf/exec/config"
@@ -38,14 +37,15 @@ type Executor struct {
 	watchers  map[string]*watcher
 }
 
-// NewExecutor returns an Executor instance
-func NewExecutor(path, protosDir, protoconfAgentAddr string) (*Executor, error) {
+// NewExecutor returns an Executor instance, connecting to the agent without
+// TLS unless opts set other transport credentials
+func NewExecutor(path, protosDir, protoconfAgentAddr string, opts ...grpc.DialOption) (*Executor, error) {
 	logger, err := zap.NewDevelopment()
 	if err != nil {
 		return nil, err
 	}
 	logger = logger.With(zap.String("path", path))
-	client, conn := getProtoconfClient(protoconfAgentAddr)
+	client, conn := getProtoconfClient(protoconfAgentAddr, opts...)
 	executor := &Executor{
 		path:      path,
 		client:    client,
@@ -109,7 +109,7 @@ func (e *Executor) Start(ctx context.Context) error {
 				break
 			}
 
-			err := ptypes.UnmarshalAny(update.GetValue(), econf)
+			err := update.GetValue().UnmarshalTo(econf)
 			if err != nil {
 				return err
 			}
@@ -149,8 +149,8 @@ func (e *Executor) Close() {
 	e.conn.Close()
 }
 
-func getProtoconfClient(address string) (pc.ProtoconfServiceClient, *grpc.ClientConn) {
-	conn, err := grpc.Dial(address, grpc.WithInsecure())
+func getProtoconfClient(address string, opts ...grpc.DialOption) (pc.ProtoconfServiceClient, *grpc.ClientConn) {
+	conn, err := grpc.Dial(address, append([]grpc.DialOption{grpc.WithInsecure()}, opts...)...)
 	if err != nil {
 		log.Fatalf("Error connecting to server address=%s err=%v", address, err)
 	}
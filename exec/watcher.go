@@ -9,13 +9,14 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/ghodss/yaml"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/pkg/errors"
 	pc "github.com/protoconf/protoconf/agent/api/proto/v1"
 	exec_config "github.com/protoconf/protoconf/exec/config"
 	"github.com/protoconf/protoconf/utils"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 type watcher struct {
@@ -84,23 +85,17 @@ func (w *watcher) Start(ctx context.Context) error {
 				return errors.Wrap(err, "failed to get AnyResolver")
 			}
 
-			name, err := anyResolver.Resolve(value.GetTypeUrl())
-			if err != nil {
+			if _, err := anyResolver.FindMessageByURL(value.GetTypeUrl()); err != nil {
 				return errors.Wrapf(err, "could not find typeUrl for %s", value.GetTypeUrl())
 			}
 
-			msg, err := dynamic.AsDynamicMessage(name)
-			if err != nil {
-				return err
-			}
-
-			err = msg.Unmarshal(value.GetValue())
+			msg, err := anypb.UnmarshalNew(value, proto.UnmarshalOptions{Resolver: anyResolver})
 			if err != nil {
 				return err
 			}
 
 			for _, action := range w.config.Actions {
-				w.runAction(ctx, action, msg)
+				w.runAction(ctx, action, msg, anyResolver)
 			}
 			w.logger.Info("finished running actions")
 		}
@@ -108,18 +103,18 @@ func (w *watcher) Start(ctx context.Context) error {
 
 }
 
-func (w *watcher) runAction(ctx context.Context, action *exec_config.Action, msg *dynamic.Message) {
+func (w *watcher) runAction(ctx context.Context, action *exec_config.Action, msg proto.Message, anyResolver *protoregistry.Types) {
 	var log *zap.Logger
 	var actionErr error = nil
 	switch x := action.Action.(type) {
 	case *exec_config.Action_Http:
 		log = w.logger.With(zap.String("action", "http"), zap.String("uri", x.Http.Uri), zap.String("method", x.Http.Method))
-		actionErr = w.runHTTPAction(ctx, x.Http, msg)
+		actionErr = w.runHTTPAction(ctx, x.Http, msg, anyResolver)
 	case *exec_config.Action_Restart:
 		log = w.logger.With(zap.String("action", "restart"))
 	case *exec_config.Action_File:
 		log = w.logger.With(zap.String("action", "file"), zap.String("filepath", x.File.Path))
-		actionErr = w.runWriteAction(ctx, x.File, msg)
+		actionErr = w.runWriteAction(ctx, x.File, msg, anyResolver)
 	case *exec_config.Action_Signal:
 		log = w.logger.With(zap.String("action", "signal"), zap.String("pid_file", x.Signal.PidFile), zap.String("signal", x.Signal.Signal.String()))
 	}
@@ -127,19 +122,19 @@ func (w *watcher) runAction(ctx context.Context, action *exec_config.Action, msg
 	if actionErr != nil {
 		log.Error("error running http", zap.Error(actionErr))
 		for _, a := range action.OnError {
-			w.runAction(ctx, a, msg)
+			w.runAction(ctx, a, msg, anyResolver)
 		}
 	} else {
 		for _, a := range action.Then {
-			w.runAction(ctx, a, msg)
+			w.runAction(ctx, a, msg, anyResolver)
 		}
 	}
 }
 
-func (w *watcher) runHTTPAction(ctx context.Context, httpAction *exec_config.ActionTypeHttp, msg *dynamic.Message) error {
+func (w *watcher) runHTTPAction(ctx context.Context, httpAction *exec_config.ActionTypeHttp, msg proto.Message, anyResolver *protoregistry.Types) error {
 	logger := w.logger.With(zap.String("func", "runHTTPAction"))
 
-	jsonBytes, err := msg.MarshalJSON()
+	jsonBytes, err := utils.MarshalJSON(msg, anyResolver)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal value")
 	}
@@ -162,7 +157,7 @@ func (w *watcher) runHTTPAction(ctx context.Context, httpAction *exec_config.Act
 	return nil
 }
 
-func (w *watcher) runWriteAction(ctx context.Context, action *exec_config.ActionTypeWriteToFile, msg *dynamic.Message) error {
+func (w *watcher) runWriteAction(ctx context.Context, action *exec_config.ActionTypeWriteToFile, msg proto.Message, anyResolver *protoregistry.Types) error {
 	logger := w.logger.With(zap.String("func", "runWriteAction"))
 	var marshaledBytes []byte
 	var marshalErr error = nil
@@ -171,19 +166,15 @@ func (w *watcher) runWriteAction(ctx context.Context, action *exec_config.Action
 	case exec_config.Config_JSON:
 		logger.Debug("json marshaler")
 		marshalerName = "json"
-		marshaledBytes, marshalErr = msg.MarshalJSONIndent()
+		marshaledBytes, marshalErr = utils.MarshalJSON(msg, anyResolver)
 	case exec_config.Config_YAML:
 		logger.Debug("yaml marshaler")
 		marshalerName = "yaml"
-		b, err := msg.MarshalJSONIndent()
-		if err != nil {
-			return err
-		}
-		marshaledBytes, marshalErr = yaml.JSONToYAML(b)
+		marshaledBytes, marshalErr = utils.MarshalYAML(msg, anyResolver)
 	case exec_config.Config_PB:
 		logger.Debug("protobuf text marshaler")
 		marshalerName = "protobuf_text"
-		marshaledBytes, marshalErr = msg.MarshalTextIndent()
+		marshaledBytes, marshalErr = utils.MarshalText(msg, anyResolver)
 	default:
 		return errors.Errorf("could not find marshaler for %s", action.GetSerializer())
 	}
@@ -0,0 +1,135 @@
+package expiry
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// The actions of the expiry commands
+const (
+	actionStatus = "status"
+	actionCancel = "cancel"
+)
+
+var synopses = map[string]string{
+	actionStatus: "Prints the expiries of the configs written for a while",
+	actionCancel: "Cancels the expiry of a config, keeping its value",
+}
+
+type cliCommand struct {
+	action string
+}
+
+func (c *cliCommand) newFlagSet() (*flag.FlagSet, *command.KVStoreConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		if c.action == actionStatus {
+			fmt.Fprintln(flags.Output(), "Usage: [OPTION]... [config_path]")
+		} else {
+			fmt.Fprintln(flags.Output(), "Usage: [OPTION]... config_path")
+		}
+		flags.PrintDefaults()
+	}
+
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+
+	return flags, kVConfig
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, kVConfig := c.newFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() > 1 || (c.action != actionStatus && flags.NArg() != 1) {
+		flags.Usage()
+		return 1
+	}
+	path := ""
+	if flags.NArg() == 1 {
+		path = filepath.ToSlash(strings.TrimSpace(flags.Arg(0)))
+	}
+
+	store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	if err != nil {
+		log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	defer store.Close()
+	manager := NewManager(store, kVConfig.Prefix)
+
+	switch c.action {
+	case actionStatus:
+		var expiries []*Expiry
+		if path == "" {
+			expiries, err = manager.List()
+		} else {
+			var e *Expiry
+			e, err = manager.Get(path)
+			expiries = []*Expiry{e}
+		}
+		if err != nil {
+			log.Printf("Error reading expiries, err=%s", err)
+			return 1
+		}
+		for _, e := range expiries {
+			printExpiry(os.Stdout, e, time.Now())
+		}
+		return 0
+	case actionCancel:
+		err = manager.Cancel(path)
+	}
+	if err != nil {
+		log.Printf("Error running expiry %s, path=%s err=%s", c.action, path, err)
+		return 1
+	}
+	return 0
+}
+
+// printExpiry prints an expiry as a line
+func printExpiry(w io.Writer, e *Expiry, now time.Time) {
+	line := fmt.Sprintf("%s written by %s at %s expires at %s", e.Path, e.Identity, e.Created.UTC().Format(time.RFC3339), e.Expires.UTC().Format(time.RFC3339))
+	if now.Before(e.Expires) {
+		line += fmt.Sprintf(", reverted in %s", e.Expires.Sub(now).Round(time.Second))
+	} else {
+		line += ", waiting for protoconf serve -from-store or the agents to revert it"
+	}
+	fmt.Fprintln(w, line)
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _ := c.newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return synopses[c.action]
+}
+
+func factory(action string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &cliCommand{action: action}, nil
+	}
+}
+
+// The cli.CommandFactory of the expiry commands
+var (
+	StatusCommand = factory(actionStatus)
+	CancelCommand = factory(actionCancel)
+)
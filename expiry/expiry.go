@@ -0,0 +1,271 @@
+// Package expiry reverts the configs written for a while, such as the
+// temporary overrides during an incident, to the values they replaced once
+// they expire, so that the overrides don't become permanent when they are
+// forgotten. The subscribers of the configs get their previous values as they
+// get any other change.
+package expiry
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// Prefix starts the keys of the expiries in the key-value store, following
+// the prefix of the configs: prefix + Prefix + the path of the config
+const Prefix = ".expiries/"
+
+// PollInterval is how often the servers and the agents revert the configs
+// expired
+const PollInterval = 5 * time.Second
+
+// ErrNoExpiry is returned for the configs which don't expire
+var ErrNoExpiry = errors.New("the config doesn't expire")
+
+// Expiry is the expiry of a value of a config written for a while
+type Expiry struct {
+	Path string `json:"path"`
+	// Previous is the value the config is reverted to, encoded as the
+	// configs are in the store
+	Previous []byte `json:"previous"`
+	// PreviousVersion is the version of Previous, empty when the store has
+	// no versions
+	PreviousVersion string `json:"previous_version,omitempty"`
+	// Version is the version of the value expiring. The config is reverted
+	// only while it's still at this version in the stores with versions, a
+	// config changed since keeps its value.
+	Version string    `json:"version,omitempty"`
+	Expires time.Time `json:"expires"`
+	// Identity is who wrote the value expiring
+	Identity string    `json:"identity"`
+	Created  time.Time `json:"created"`
+
+	// version is the version of the expiry in the store
+	version string
+}
+
+// Config is the expiry of the configs written by a command, set with -ttl
+// or -expires
+type Config struct {
+	TTL     time.Duration
+	Expires string
+}
+
+// AddFlags adds the -ttl and -expires flags to an existing flagset
+func AddFlags(fs *flag.FlagSet, c *Config) {
+	fs.DurationVar(&c.TTL, "ttl", 0, "Revert the configs written to the values they replace after this long, e.g. 2h for a temporary override during an incident")
+	fs.StringVar(&c.Expires, "expires", "", "Revert the configs written to the values they replace at this time, RFC 3339 e.g. 2006-01-02T15:04:05Z")
+}
+
+// Time is when the configs written expire, the zero time when they don't
+func (c *Config) Time(now time.Time) (time.Time, error) {
+	switch {
+	case c.TTL != 0 && c.Expires != "":
+		return time.Time{}, errors.New("-ttl and -expires can't be used together")
+	case c.TTL < 0:
+		return time.Time{}, fmt.Errorf("invalid -ttl %s", c.TTL)
+	case c.TTL > 0:
+		return now.Add(c.TTL), nil
+	case c.Expires == "":
+		return time.Time{}, nil
+	}
+	expires, err := time.Parse(time.RFC3339, c.Expires)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -expires %q, err=%s", c.Expires, err)
+	}
+	if !expires.After(now) {
+		return time.Time{}, fmt.Errorf("-expires %s is in the past", c.Expires)
+	}
+	return expires, nil
+}
+
+// Manager manages the expiries of the configs of a key-value store
+type Manager struct {
+	store  libprotoconf.Store
+	prefix string
+	// Audit records the configs reverted, nil to record nothing
+	Audit audit.Log
+}
+
+// NewManager manages the expiries of the configs written to store under
+// prefix
+func NewManager(store libprotoconf.Store, prefix string) *Manager {
+	return &Manager{store: store, prefix: prefix}
+}
+
+func (m *Manager) key(path string) string {
+	return m.prefix + Prefix + path
+}
+
+// Get reads the expiry of a config, ErrNoExpiry when it doesn't expire
+func (m *Manager) Get(path string) (*Expiry, error) {
+	var data []byte
+	var version string
+	var err error
+	if versioned, ok := m.store.(libprotoconf.VersionedStore); ok {
+		data, version, err = versioned.GetVersion(m.key(path))
+	} else {
+		data, err = m.store.Get(m.key(path))
+	}
+	if err == libprotoconf.ErrConfigNotFound {
+		return nil, ErrNoExpiry
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := &Expiry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("error reading expiry, path=%s err=%s", path, err)
+	}
+	e.version = version
+	return e, nil
+}
+
+// List reads the expiries of the configs, in the order of their paths
+func (m *Manager) List() ([]*Expiry, error) {
+	keys, err := m.store.List(m.prefix + Prefix)
+	if err != nil {
+		return nil, err
+	}
+	var expiries []*Expiry
+	for _, key := range keys {
+		e, err := m.Get(strings.TrimPrefix(key, m.prefix+Prefix))
+		if err == ErrNoExpiry {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		expiries = append(expiries, e)
+	}
+	return expiries, nil
+}
+
+// Set sets the expiry of the value of a config just written. When the value
+// it replaces expires too, the config is reverted to the value before,
+// the value which doesn't expire.
+func (m *Manager) Set(e *Expiry) error {
+	if _, err := libprotoconf.DecodeConfig(e.Previous); err != nil {
+		return fmt.Errorf("error decoding the previous value of config, path=%s err=%s", e.Path, err)
+	}
+	current, err := m.Get(e.Path)
+	switch {
+	case err == ErrNoExpiry:
+	case err != nil:
+		return err
+	case current.Version == e.PreviousVersion:
+		e.Previous, e.PreviousVersion = current.Previous, current.PreviousVersion
+		e.version = current.version
+	default:
+		e.version = current.version
+	}
+	return m.write(e)
+}
+
+// write writes an expiry, on the condition that it wasn't changed since it
+// was read in the stores with versions
+func (m *Manager) write(e *Expiry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	versioned, ok := m.store.(libprotoconf.VersionedStore)
+	if !ok {
+		return m.store.Set(m.key(e.Path), data)
+	}
+	if _, err := versioned.SetIfVersion(m.key(e.Path), data, e.version); err != nil {
+		if err == libprotoconf.ErrVersionMismatch {
+			return fmt.Errorf("the expiry of %s was changed meanwhile, try again", e.Path)
+		}
+		return err
+	}
+	return nil
+}
+
+// Cancel cancels the expiry of a config, keeping its value
+func (m *Manager) Cancel(path string) error {
+	if _, err := m.Get(path); err != nil {
+		return err
+	}
+	return m.store.Delete(m.key(path))
+}
+
+// revert reverts a config to the value its expiry replaced and ends the
+// expiry, telling whether it was reverted. A config changed since its value
+// was written keeps its value, in the stores with versions, and its expiry
+// ends.
+func (m *Manager) revert(e *Expiry) (bool, error) {
+	var err error
+	entry := &audit.Entry{Identity: e.Identity, Action: audit.ActionExpire, Path: e.Path, OldVersion: e.Version}
+	if versioned, ok := m.store.(libprotoconf.VersionedStore); ok {
+		entry.NewVersion, err = versioned.SetIfVersion(m.prefix+e.Path, e.Previous, e.Version)
+		if err == libprotoconf.ErrVersionMismatch {
+			return false, m.store.Delete(m.key(e.Path))
+		}
+	} else {
+		err = m.store.Set(m.prefix+e.Path, e.Previous)
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := m.store.Delete(m.key(e.Path)); err != nil {
+		return false, err
+	}
+	if m.Audit != nil {
+		entry.Time = time.Now()
+		if err := m.Audit.Append(entry); err != nil {
+			return true, fmt.Errorf("config %s was reverted but not recorded to the audit log, err=%s", e.Path, err)
+		}
+	}
+	return true, nil
+}
+
+// Expire reverts the configs whose expiry is over. The configs are reverted
+// on the condition that they weren't changed meanwhile in the stores with
+// versions, so that several servers and agents can revert them.
+func (m *Manager) Expire(now time.Time) error {
+	expiries, err := m.List()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, e := range expiries {
+		if now.Before(e.Expires) {
+			continue
+		}
+		reverted, err := m.revert(e)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if reverted {
+			log.Printf("Config %s expired, reverted to its previous value", e.Path)
+		} else {
+			log.Printf("Config %s expired but was changed since it was written, keeping its value", e.Path)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run reverts the configs expired every interval until stopCh is closed
+func (m *Manager) Run(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := m.Expire(now); err != nil {
+				log.Printf("Error reverting expired configs, err=%s", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package expiry
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/libprotoconf/storetest"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestConfigTime(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	expires, err := (&Config{}).Time(now)
+	assert.NoError(t, err)
+	assert.True(t, expires.IsZero())
+	expires, err = (&Config{TTL: time.Hour}).Time(now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), expires)
+	expires, err = (&Config{Expires: "2026-01-02T05:00:00Z"}).Time(now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 2, 5, 0, 0, 0, time.UTC), expires)
+
+	for _, invalid := range []*Config{{TTL: -time.Hour}, {Expires: "tomorrow"}, {Expires: "2026-01-01T00:00:00Z"}, {TTL: time.Hour, Expires: "2026-01-02T05:00:00Z"}} {
+		_, err := invalid.Time(now)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestManager(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	manager := NewManager(store, "prod/")
+	manager.Audit = audit.NewStoreLog(store, "audit/")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	write := func(path string, value string, expires time.Time) {
+		previous, previousVersion, err := store.GetVersion("prod/" + path)
+		assert.NoError(t, err)
+		version, err := store.SetIfVersion("prod/"+path, storetest.EncodeString(t, value), previousVersion)
+		assert.NoError(t, err)
+		assert.NoError(t, manager.Set(&Expiry{Path: path, Previous: previous, PreviousVersion: previousVersion, Version: version, Expires: expires, Identity: "alice@host", Created: now}))
+	}
+	value := func(path string) []byte {
+		data, err := store.Get("prod/" + path)
+		assert.NoError(t, err)
+		return data
+	}
+
+	assert.NoError(t, store.Set("prod/services/web", storetest.EncodeString(t, "stable")))
+	assert.NoError(t, store.Set("prod/services/api", storetest.EncodeString(t, "stable")))
+	assert.Error(t, manager.Set(&Expiry{Path: "services/web", Previous: []byte("invalid")}))
+
+	// A temporary override, overridden again, reverts to the value before
+	// both
+	write("services/web", "override", now.Add(time.Hour))
+	write("services/web", "override again", now.Add(2*time.Hour))
+	write("services/api", "override", now.Add(time.Hour))
+	expiries, err := manager.List()
+	assert.NoError(t, err)
+	assert.Len(t, expiries, 2)
+	assert.Equal(t, "services/api", expiries[0].Path)
+	assert.Equal(t, now.Add(2*time.Hour), expiries[1].Expires)
+
+	assert.NoError(t, manager.Expire(now.Add(90*time.Minute)))
+	assert.True(t, bytes.Equal(storetest.EncodeString(t, "override again"), value("services/web")))
+	assert.True(t, bytes.Equal(storetest.EncodeString(t, "stable"), value("services/api")))
+	_, err = manager.Get("services/api")
+	assert.Equal(t, ErrNoExpiry, err)
+	entries, err := manager.Audit.Entries("services/api")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, audit.ActionExpire, entries[0].Action)
+	assert.Equal(t, "alice@host", entries[0].Identity)
+
+	// A config changed since its override keeps its value
+	assert.NoError(t, store.Set("prod/services/web", storetest.EncodeString(t, "fixed")))
+	assert.NoError(t, manager.Expire(now.Add(3*time.Hour)))
+	assert.True(t, bytes.Equal(storetest.EncodeString(t, "fixed"), value("services/web")))
+	expiries, err = manager.List()
+	assert.NoError(t, err)
+	assert.Empty(t, expiries)
+
+	// A canceled expiry keeps the override
+	write("services/api", "override", now.Add(time.Hour))
+	assert.NoError(t, manager.Cancel("services/api"))
+	assert.Equal(t, ErrNoExpiry, manager.Cancel("services/api"))
+	assert.NoError(t, manager.Expire(now.Add(2*time.Hour)))
+	assert.True(t, bytes.Equal(storetest.EncodeString(t, "override"), value("services/api")))
+}
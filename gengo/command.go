@@ -0,0 +1,186 @@
+package gengo
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/utils"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// GeneratedFile is the name of the file generated in the package of a config
+const GeneratedFile = "config.protoconf.go"
+
+type cliCommand struct{}
+
+type stringsArray []string
+
+func (i *stringsArray) String() string {
+	return fmt.Sprintf("%v", []string(*i))
+}
+
+func (i *stringsArray) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
+
+type cliConfig struct {
+	outputDir  string
+	protoPaths stringsArray
+	goPackages stringsArray
+}
+
+func newFlagSet() (*flag.FlagSet, *cliConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... protoconf_root [config]...")
+		flags.PrintDefaults()
+	}
+
+	config := &cliConfig{}
+	flags.StringVar(&config.outputDir, "out", ".", "Directory to write the packages to, a package per config under the path of the config")
+	flags.Var(&config.protoPaths, "proto-path", "An additional directory to import protos from (can repeat)")
+	flags.Var(&config.goPackages, "M", "Map a proto file to the Go import path of its package as `file.proto=import/path', over its go_package option (can repeat)")
+
+	return flags, config
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config := newFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 1
+	}
+
+	goPackages := make(map[string]string)
+	for _, mapping := range config.goPackages {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Printf("Invalid -M %q, expected file.proto=import/path", mapping)
+			return 1
+		}
+		goPackages[parts[0]] = parts[1]
+	}
+
+	protoconfRoot := strings.TrimSpace(flags.Args()[0])
+	importPaths, err := utils.ProtoImportPaths(protoconfRoot)
+	if err != nil {
+		log.Printf("Error resolving proto import paths, err=%s", err)
+	}
+	importPaths = append(importPaths, config.protoPaths...)
+
+	configPaths := flags.Args()[1:]
+	if len(configPaths) == 0 {
+		configPaths, err = getAllConfigs(filepath.Join(protoconfRoot, consts.CompiledConfigPath))
+		if err != nil {
+			log.Printf("Error getting all configs from %s, err=%s", protoconfRoot, err)
+			return 1
+		}
+	}
+
+	for _, configPath := range configPaths {
+		message, err := readMessage(protoconfRoot, importPaths, configPath)
+		if err != nil {
+			log.Printf("Error reading config %s, err=%s", configPath, err)
+			return 1
+		}
+		generated, err := NewConfig(configPath, message, goPackages)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		data, err := generated.Go()
+		if err != nil {
+			log.Printf("Error generating package for %s, err=%s", configPath, err)
+			return 1
+		}
+
+		outputFile := filepath.Join(config.outputDir, filepath.FromSlash(configPath), GeneratedFile)
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			log.Printf("Error creating output directory %s, err=%s", filepath.Dir(outputFile), err)
+			return 1
+		}
+		if err := ioutil.WriteFile(outputFile, data, 0644); err != nil {
+			log.Printf("Error writing to file %s, err=%s", outputFile, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _ := newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return "Generate Go packages reading the configs by the types of their messages"
+}
+
+// Command is a cli.CommandFactory
+func Command() (cli.Command, error) {
+	return &cliCommand{}, nil
+}
+
+// readMessage describes the message of the config materialized at
+// configPath, from the proto the config was compiled with
+func readMessage(protoconfRoot string, importPaths []string, configPath string) (protoreflect.MessageDescriptor, error) {
+	filename := filepath.Join(protoconfRoot, consts.CompiledConfigPath, filepath.FromSlash(configPath)+consts.CompiledConfigExtension)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var materialized struct {
+		ProtoFile string
+		Value     struct {
+			Type string `json:"@type"`
+		}
+	}
+	if err := json.Unmarshal(data, &materialized); err != nil {
+		return nil, fmt.Errorf("error decoding %s, err=%s", filename, err)
+	}
+	types, err := utils.LoadAnyResolverFromImportPaths(importPaths, materialized.ProtoFile)
+	if err != nil {
+		return nil, err
+	}
+	messageType, err := types.FindMessageByURL(materialized.Value.Type)
+	if err != nil {
+		return nil, fmt.Errorf("error finding message %s, err=%s", materialized.Value.Type, err)
+	}
+	return messageType.Descriptor(), nil
+}
+
+func getAllConfigs(materializedDir string) ([]string, error) {
+	var configs []string
+	err := filepath.Walk(materializedDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, consts.CompiledConfigExtension) {
+			relPath, err := filepath.Rel(materializedDir, path)
+			if err != nil {
+				return err
+			}
+			configs = append(configs, strings.TrimSuffix(filepath.ToSlash(relPath), consts.CompiledConfigExtension))
+		}
+		return nil
+	})
+	return configs, err
+}
@@ -0,0 +1,159 @@
+// Package gengo generates a Go package per config, reading and watching the
+// config by the type of its message with protoconfload
+package gengo
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Config describes the package generated for a config
+type Config struct {
+	// Path is the path of the config, e.g. crawler/text_crawler
+	Path string
+	// Package is the name of the package generated, from the last element
+	// of the path, e.g. textcrawler
+	Package string
+	// Message is the Go name of the message of the config, e.g.
+	// CrawlerService
+	Message string
+	// ImportPath is the Go import path of the package of the message, the
+	// go_package of its proto file
+	ImportPath string
+}
+
+// NewConfig describes the package generated for the config at path, whose
+// values are messages of type message. goPackages maps the proto files to
+// the Go import paths of their packages, as the M options of protoc-gen-go,
+// over the go_package options of the files.
+func NewConfig(configPath string, message protoreflect.MessageDescriptor, goPackages map[string]string) (*Config, error) {
+	file := message.ParentFile()
+	goPackage, ok := goPackages[file.Path()]
+	if options, isFileOptions := file.Options().(*descriptorpb.FileOptions); !ok && isFileOptions {
+		goPackage = options.GetGoPackage()
+	}
+	// The go_package may name the package after the import path, e.g.
+	// github.com/org/configs;configspb
+	importPath := strings.SplitN(goPackage, ";", 2)[0]
+	if importPath == "" {
+		return nil, fmt.Errorf("the proto of config %s has no go_package option, set it or map the file to its Go import path with -M, file=%s", configPath, file.Path())
+	}
+
+	// The messages nested in others are named after them, as protoc-gen-go
+	// names them
+	names := []string{}
+	for d := protoreflect.Descriptor(message); d != nil && d != protoreflect.Descriptor(file); d = d.Parent() {
+		names = append([]string{goName(string(d.Name()))}, names...)
+	}
+	return &Config{
+		Path:       configPath,
+		Package:    packageName(path.Base(configPath)),
+		Message:    strings.Join(names, "_"),
+		ImportPath: importPath,
+	}, nil
+}
+
+// goName capitalizes a name for it to be exported
+func goName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// packageName makes a package name of an element of a path, keeping its
+// lower case letters and its digits, e.g. textcrawler for text_crawler
+func packageName(element string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(element) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "config" + name
+	}
+	return name
+}
+
+var packageTemplate = template.Must(template.New("package").Parse(`// Code generated by protoconf gen-go. DO NOT EDIT.
+
+// Package {{.Package}} reads the config {{.Path}}, a {{.Message}}
+package {{.Package}}
+
+import (
+	"context"
+	"sync"
+
+	pb "{{.ImportPath}}"
+	"github.com/protoconf/protoconf/protoconfload"
+)
+
+// Path is the path of the config
+const Path = {{printf "%q" .Path}}
+
+// Config is the config watched
+type Config = protoconfload.TypedConfig[pb.{{.Message}}, *pb.{{.Message}}]
+
+var (
+	sharedOnce sync.Once
+	shared     *Config
+)
+
+// Get returns the last value of the config, subscribed to with the default
+// client of protoconfload once it's first read, nil until its first value is
+// received. The value returned is shared, it must not be modified.
+func Get() *pb.{{.Message}} {
+	return subscribed().Get()
+}
+
+// Wait waits for the first value Get returns, or for ctx to be done
+func Wait(ctx context.Context) error {
+	return subscribed().Wait(ctx)
+}
+
+func subscribed() *Config {
+	sharedOnce.Do(func() {
+		shared = protoconfload.Watch[pb.{{.Message}}](context.Background(), Path)
+	})
+	return shared
+}
+
+// Watch subscribes to the config with the default client of protoconfload
+// until ctx is done
+func Watch(ctx context.Context) *Config {
+	return protoconfload.Watch[pb.{{.Message}}](ctx, Path)
+}
+
+// WatchWith subscribes to the config with client until ctx is done
+func WatchWith(ctx context.Context, client *protoconfload.Client) *Config {
+	return protoconfload.WatchWith[pb.{{.Message}}](ctx, client, Path)
+}
+
+// Load reads the config materialized to protoconfRoot
+func Load(protoconfRoot string) (*pb.{{.Message}}, error) {
+	config := &pb.{{.Message}}{}
+	if err := protoconfload.Load(protoconfRoot, Path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+`))
+
+// Go returns the source of the package generated for the config
+func (c *Config) Go() ([]byte, error) {
+	var b bytes.Buffer
+	if err := packageTemplate.Execute(&b, c); err != nil {
+		return nil, err
+	}
+	return format.Source(b.Bytes())
+}
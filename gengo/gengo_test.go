@@ -0,0 +1,63 @@
+package gengo
+
+import (
+	"testing"
+
+	"github.com/protoconf/protoconf/testutil"
+	"github.com/protoconf/protoconf/utils"
+	assert "github.com/stretchr/testify/require"
+)
+
+var protos = map[string]string{
+	"fleet/service.proto": `syntax = "proto3";
+
+package fleet;
+
+option go_package = "github.com/example/fleet/fleetpb;fleetpb";
+
+message Service {
+    message Endpoint {
+        string host = 1;
+    }
+    string name = 1;
+}
+`,
+	"fleet/limits.proto": `syntax = "proto3";
+
+package fleet;
+
+message limits {
+    int32 rps = 1;
+}
+`,
+}
+
+func TestConfig(t *testing.T) {
+	descriptors, err := utils.ParseProtoFiles(nil, testutil.ProtoAccessor(protos), "fleet/service.proto", "fleet/limits.proto")
+	assert.NoError(t, err)
+	service := descriptors[0].Messages().ByName("Service")
+
+	config, err := NewConfig("services/web-2", service, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{Path: "services/web-2", Package: "web2", Message: "Service", ImportPath: "github.com/example/fleet/fleetpb"}, config)
+	data, err := config.Go()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "// Code generated by protoconf gen-go. DO NOT EDIT.\n\n// Package web2 reads the config services/web-2, a Service\npackage web2\n")
+	assert.Contains(t, string(data), `pb "github.com/example/fleet/fleetpb"`)
+	assert.Contains(t, string(data), `const Path = "services/web-2"`)
+	assert.Contains(t, string(data), "type Config = protoconfload.TypedConfig[pb.Service, *pb.Service]")
+	assert.Contains(t, string(data), "func Get() *pb.Service {")
+
+	// The nested messages are named after the messages they are nested in
+	config, err = NewConfig("services/endpoint", service.Messages().ByName("Endpoint"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Service_Endpoint", config.Message)
+
+	// The import path is mapped for the files without a go_package
+	limits := descriptors[1].Messages().ByName("limits")
+	_, err = NewConfig("services/1limits", limits, nil)
+	assert.Error(t, err)
+	config, err = NewConfig("services/1limits", limits, map[string]string{"fleet/limits.proto": "github.com/example/fleet/limits"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{Path: "services/1limits", Package: "config1limits", Message: "Limits", ImportPath: "github.com/example/fleet/limits"}, config)
+}
@@ -0,0 +1,106 @@
+package inserter
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// storedConfig is a config as it's stored before it's changed
+type storedConfig struct {
+	value   []byte
+	version string
+}
+
+// auditor records the configs inserted and deleted to the audit log. A nil
+// auditor records nothing.
+type auditor struct {
+	log      audit.Log
+	identity string
+	prefix   string
+	// previous are the configs read before they are changed by key, the
+	// configs which don't exist are missing
+	previous map[string]*storedConfig
+}
+
+func newAuditor(auditLog audit.Log, identity string, prefix string) *auditor {
+	return &auditor{log: auditLog, identity: identity, prefix: prefix, previous: make(map[string]*storedConfig)}
+}
+
+// read reads the configs of keys before they are changed, along with their
+// versions when the store has versions
+func (a *auditor) read(keys []string, kvStore libprotoconf.Store) error {
+	if a == nil {
+		return nil
+	}
+	previous, err := readStored(keys, kvStore)
+	if err != nil {
+		return err
+	}
+	for key, config := range previous {
+		a.previous[key] = config
+	}
+	return nil
+}
+
+// readStored reads the configs of keys before they are changed, along with
+// their versions when the store has versions, by key. The configs which don't
+// exist are missing.
+func readStored(keys []string, kvStore libprotoconf.Store) (map[string]*storedConfig, error) {
+	stored := make(map[string]*storedConfig)
+	versioned, isVersioned := kvStore.(libprotoconf.VersionedStore)
+	for _, key := range keys {
+		var config storedConfig
+		var err error
+		if isVersioned {
+			config.value, config.version, err = versioned.GetVersion(key)
+		} else {
+			config.value, err = kvStore.Get(key)
+		}
+		if err == libprotoconf.ErrConfigNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stored[key] = &config
+	}
+	return stored, nil
+}
+
+// record appends the changes of the configs of keys to the audit log, values
+// are the configs inserted, nil when they were deleted, and versions their
+// new versions when they are known
+func (a *auditor) record(action string, keys []string, values map[string][]byte, versions map[string]string, protoconfRoot string) error {
+	if a == nil {
+		return nil
+	}
+	now := time.Now()
+	for _, key := range keys {
+		entry := &audit.Entry{
+			Time:       now,
+			Identity:   a.identity,
+			Action:     action,
+			Path:       strings.TrimPrefix(key, a.prefix),
+			NewVersion: versions[key],
+		}
+		if previous, ok := a.previous[key]; ok {
+			entry.OldVersion = previous.version
+			if values != nil && !bytes.Equal(previous.value, values[key]) {
+				diffs, err := diffConfigs(previous.value, values[key], protoconfRoot)
+				if err != nil {
+					log.Printf("Error comparing config %s to record its changes, err=%s", entry.Path, err)
+				}
+				entry.Changes = audit.Changes(diffs)
+			}
+		}
+		if err := a.log.Append(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,37 +8,85 @@ import (
 	"log"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/abronan/valkeyrie"
-	"github.com/abronan/valkeyrie/store"
-	"github.com/abronan/valkeyrie/store/consul"
-	"github.com/abronan/valkeyrie/store/etcd/v2"
-	"github.com/abronan/valkeyrie/store/zookeeper"
-	"github.com/golang/protobuf/proto"
 	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/audit"
 	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/compiler/lib"
 	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/expiry"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/rollout"
+	"github.com/protoconf/protoconf/targeting"
 	"github.com/protoconf/protoconf/utils"
+	"github.com/protoconf/protoconf/webhook"
+	"google.golang.org/protobuf/proto"
 )
 
 type cliCommand struct{}
 
 type cliConfig struct {
-	delete bool
+	delete       bool
+	noValidate   bool
+	dryRun       bool
+	atomic       bool
+	ifVersion    versionsFlag
+	auditLog     string
+	webhooksPath string
+	identity     string
+	rollout      string
+	canary       string
+	canaryLabels string
+	target       string
+	expiry       expiry.Config
+}
+
+// noVersion is the -if-version of the configs which must not exist
+const noVersion = "none"
+
+// versionsFlag are the versions the configs must be at to be inserted, by
+// config path
+type versionsFlag map[string]string
+
+func (f versionsFlag) String() string {
+	return fmt.Sprintf("%v", map[string]string(f))
+}
+
+func (f versionsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected path=version, got %s", value)
+	}
+	f[filepath.ToSlash(parts[0])] = parts[1]
+	return nil
 }
 
 func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
 	flags := flag.NewFlagSet("", flag.ExitOnError)
 	flags.Usage = func() {
 		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... [protoconf_root] config...")
+		fmt.Fprintln(flags.Output(), "Configs are materialized configs, or .pconf and .mpconf sources compiled before inserting their outputs.")
 		flags.PrintDefaults()
 	}
 
 	kVConfig := &command.KVStoreConfig{}
 	command.AddKVStoreFlags(flags, kVConfig)
 
-	config := &cliConfig{}
+	config := &cliConfig{ifVersion: make(versionsFlag)}
 	flags.BoolVar(&config.delete, "d", false, "Delete a config from the key-value store")
+	flags.BoolVar(&config.noValidate, "no-validate", false, "Insert configs without validating them, an escape hatch for emergencies")
+	flags.BoolVar(&config.atomic, "atomic", false, "Insert or delete the configs in one transaction, failing when the store doesn't support it")
+	flags.BoolVar(&config.dryRun, "dry-run", false, "Print the configs which would be inserted, updated or deleted without writing them")
+	flags.Var(config.ifVersion, "if-version", "Insert a config only if it's still at a version, as path=version with the version printed by -dry-run, or path=none if it must not exist. Can be repeated")
+	audit.AddFlag(flags, &config.auditLog)
+	webhook.AddFlag(flags, &config.webhooksPath)
+	flags.StringVar(&config.identity, "identity", audit.LocalIdentity(), "Who the changes are recorded as in the audit log")
+	flags.StringVar(&config.target, "target", "", "Serve the configs to the subscribers matching labels instead of inserting them, the labels as name=value separated by commas, e.g. cluster=eu-west,version=2.*, values are globs. The other subscribers keep the values of the configs")
+	expiry.AddFlags(flags, &config.expiry)
+	flags.StringVar(&config.rollout, "rollout", "", "Roll out the configs to an increasing percentage of their subscribers instead of inserting them, by the steps of a policy as percentage:wait, e.g. 1:10m,10:30m,50:1h,100:1h. The configs are promoted after the wait of the last step, or by protoconf rollout promote when it has none")
+	flags.StringVar(&config.canary, "canary-clients", "", "Serve the configs to the subscribers of these client IDs only instead of inserting them, separated by commas, until protoconf rollout promote makes them the values of the configs or protoconf rollout abort ends the canary")
+	flags.StringVar(&config.canaryLabels, "canary-labels", "", "Serve the configs to the subscribers matching labels only instead of inserting them, as name=value separated by commas, values are globs, along with the -canary-clients, until protoconf rollout promote or abort")
 
 	return flags, config, kVConfig
 }
@@ -52,57 +100,248 @@ func (c *cliCommand) Run(args []string) int {
 		return 1
 	}
 
-	var kvStore store.Store
-	var err error
-	if kVConfig.Store == command.KVStoreConsul {
-		consul.Register()
-		kvStore, err = valkeyrie.NewStore(store.CONSUL, []string{kVConfig.Address}, nil)
-	} else if kVConfig.Store == command.KVStoreEtcd {
-		etcd.Register()
-		var address string
-		if kVConfig.Address != "" {
-			address = kVConfig.Address
-		} else {
-			address = consts.EtcdDefaultAddress
-		}
-		kvStore, err = valkeyrie.NewStore(store.ETCD, []string{address}, nil)
-	} else if kVConfig.Store == command.KVStoreZookeeper {
-		zookeeper.Register()
-		var address string
-		if kVConfig.Address != "" {
-			address = kVConfig.Address
-		} else {
-			address = consts.ZookeeperDefaultAddress
+	store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	if err != nil {
+		log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	defer store.Close()
+	kvStore := kVConfig.WithHistory(store)
+
+	batch, isBatch := kvStore.(libprotoconf.BatchStore)
+	if config.atomic && !isBatch {
+		log.Printf("Error, %s doesn't support writing configs in one transaction", kVConfig.Store)
+		return 1
+	}
+	versions := make(map[string]string)
+	if len(config.ifVersion) > 0 {
+		if _, ok := kvStore.(libprotoconf.VersionedStore); !ok {
+			log.Printf("Error, %s doesn't support writing configs on the condition of their versions", kVConfig.Store)
+			return 1
+		}
+		if config.delete || config.atomic {
+			log.Println("Error, -if-version can't be used with -d or -atomic")
+			return 1
+		}
+		for configName, version := range config.ifVersion {
+			if version == noVersion {
+				version = ""
+			}
+			versions[kVConfig.Prefix+configName] = version
+		}
+	}
+
+	var policy rollout.Policy
+	if config.rollout != "" {
+		if config.delete || config.atomic || len(config.ifVersion) > 0 {
+			log.Println("Error, -rollout can't be used with -d, -atomic or -if-version")
+			return 1
+		}
+		if policy, err = rollout.ParsePolicy(config.rollout); err != nil {
+			log.Printf("Error, %s", err)
+			return 1
 		}
-		kvStore, err = valkeyrie.NewStore(store.ZK, []string{address}, nil)
-	} else {
-		log.Fatalf("Unknown key-value store %s", kVConfig.Store)
 	}
 
+	var canary *rollout.Canary
+	if config.canary != "" || config.canaryLabels != "" {
+		if config.delete || config.atomic || len(config.ifVersion) > 0 || policy != nil {
+			log.Println("Error, -canary-clients and -canary-labels can't be used with -d, -atomic, -if-version or -rollout")
+			return 1
+		}
+		canary = &rollout.Canary{}
+		for _, client := range strings.Split(config.canary, ",") {
+			if client = strings.TrimSpace(client); client != "" {
+				canary.Clients = append(canary.Clients, client)
+			}
+		}
+		if config.canaryLabels != "" {
+			if canary.Labels, err = targeting.ParseLabels(config.canaryLabels); err != nil {
+				log.Printf("Error, -canary-labels %s", err)
+				return 1
+			}
+		}
+	}
+
+	var labels targeting.Labels
+	if config.target != "" {
+		if config.delete || config.atomic || len(config.ifVersion) > 0 || policy != nil || canary != nil {
+			log.Println("Error, -target can't be used with -d, -atomic, -if-version, -rollout or a canary")
+			return 1
+		}
+		if labels, err = targeting.ParseLabels(config.target); err != nil {
+			log.Printf("Error, -target %s", err)
+			return 1
+		}
+	}
+
+	expires, err := config.expiry.Time(time.Now())
 	if err != nil {
-		log.Printf("Error connecting to key-value store, err=%s", err)
+		log.Printf("Error, %s", err)
 		return 1
 	}
+	if !expires.IsZero() && (config.delete || config.atomic || policy != nil || canary != nil || labels != nil) {
+		log.Println("Error, -ttl and -expires can't be used with -d, -atomic, -rollout, a canary or -target")
+		return 1
+	}
+
+	var auditor *auditor
+	if !config.dryRun {
+		var auditLog, webhooks audit.Log
+		if config.auditLog != "" {
+			auditLog, err = audit.Open(config.auditLog, func() (libprotoconf.Store, error) { return store, nil })
+			if err != nil {
+				log.Printf("Error opening audit log, err=%s", err)
+				return 1
+			}
+		}
+		if config.webhooksPath != "" {
+			notifier, err := webhook.Read(store, kVConfig.Prefix, config.webhooksPath)
+			if err != nil {
+				log.Printf("Error loading webhooks, err=%s", err)
+				return 1
+			}
+			defer notifier.Wait()
+			webhooks = notifier
+		}
+		if changes := audit.Tee(auditLog, webhooks); changes != nil {
+			auditor = newAuditor(changes, config.identity, kVConfig.Prefix)
+		}
+	}
+
+	if config.delete && isBatch && !config.dryRun {
+		var keys []string
+		values := make(map[string][]byte)
+		for _, arg := range flags.Args() {
+			key := kVConfig.Prefix + filepath.ToSlash(strings.TrimSpace(arg))
+			keys = append(keys, key)
+			values[key] = nil
+		}
+		if err := auditor.read(keys, kvStore); err != nil {
+			log.Printf("Error reading configs to audit, err=%s", err)
+			return 1
+		}
+		if err := batch.SetAll(values); err != nil {
+			log.Printf("Error deleting configs, err=%s", err)
+			return 1
+		}
+		if err := auditor.record(audit.ActionDelete, keys, nil, nil, ""); err != nil {
+			log.Printf("Error, the configs were deleted but not recorded to the audit log, err=%s", err)
+			return 1
+		}
+		return 0
+	}
 
 	if config.delete {
 		for i := 0; i < flags.NArg(); i++ {
 			configName := filepath.ToSlash(strings.TrimSpace(flags.Args()[i]))
-			if err := kvStore.Delete(kVConfig.Prefix + configName); err != nil {
+			key := kVConfig.Prefix + configName
+			if config.dryRun {
+				if _, err := kvStore.Get(key); err == nil {
+					fmt.Printf("Path %s would be deleted\n", key)
+				} else if err == libprotoconf.ErrConfigNotFound {
+					fmt.Printf("Path %s doesn't exist\n", key)
+				} else {
+					log.Printf("Error reading config %s, err=%s", configName, err)
+					return 1
+				}
+				continue
+			}
+			if err := auditor.read([]string{key}, kvStore); err != nil {
+				log.Printf("Error reading config %s to audit, err=%s", configName, err)
+				return 1
+			}
+			if err := kvStore.Delete(key); err != nil {
 				log.Printf("Error deleting config %s, err=%s", configName, err)
 				return 1
 			}
+			if err := auditor.record(audit.ActionDelete, []string{key}, nil, nil, ""); err != nil {
+				log.Printf("Error, config %s was deleted but not recorded to the audit log, err=%s", configName, err)
+				return 1
+			}
 		}
-	} else {
-		protoconfRoot := strings.TrimSpace(flags.Args()[0])
-		for i := 1; i < flags.NArg(); i++ {
-			configName := filepath.ToSlash(strings.TrimSpace(flags.Args()[i]))
-			if err := insertConfig(configName, protoconfRoot, kvStore, kVConfig.Prefix); err != nil {
-				log.Printf("Error inserting config %s, err=%s", configName, err)
+		return 0
+	}
+
+	protoconfRoot := strings.TrimSpace(flags.Args()[0])
+	keys, values, err := encodeConfigs(flags.Args()[1:], protoconfRoot, kVConfig.Prefix, !config.noValidate)
+	if err != nil {
+		log.Printf("Error inserting configs, err=%s", err)
+		return 1
+	}
+	for key := range versions {
+		if _, ok := values[key]; !ok {
+			log.Printf("Error, -if-version is set for %s which isn't inserted", strings.TrimPrefix(key, kVConfig.Prefix))
+			return 1
+		}
+	}
+	if policy != nil && !config.dryRun {
+		return startRollouts(keys, values, kvStore, kVConfig.Prefix, policy, config.identity)
+	}
+	if canary != nil && !config.dryRun {
+		return startCanaries(keys, values, kvStore, kVConfig.Prefix, canary, config.identity)
+	}
+	if labels != nil && !config.dryRun {
+		return setTargets(keys, values, kvStore, kVConfig.Prefix, labels, config.identity)
+	}
+	if err := auditor.read(keys, kvStore); err != nil {
+		log.Printf("Error reading configs to audit, err=%s", err)
+		return 1
+	}
+	// The configs expiring are reverted to the values they replace
+	var previous map[string]*storedConfig
+	if auditor != nil {
+		previous = auditor.previous
+	}
+	if !expires.IsZero() {
+		if previous == nil {
+			if previous, err = readStored(keys, kvStore); err != nil {
+				log.Printf("Error reading configs to expire, err=%s", err)
+				return 1
+			}
+		}
+		for _, key := range keys {
+			if _, ok := previous[key]; !ok {
+				log.Printf("Error, config %s doesn't exist, only the configs which exist can expire", strings.TrimPrefix(key, kVConfig.Prefix))
 				return 1
 			}
 		}
 	}
+	// The configs are written at the versions they were read at, so that the
+	// audit log records the versions they replace and the expiries revert them
+	// only while they are at the versions written
+	if _, ok := kvStore.(libprotoconf.VersionedStore); ok && previous != nil && !config.atomic {
+		for _, key := range keys {
+			if _, ok := versions[key]; ok {
+				continue
+			}
+			// The configs which don't exist are written only if they still don't
+			versions[key] = ""
+			if stored, ok := previous[key]; ok {
+				versions[key] = stored.version
+			}
+		}
+	}
 
+	var newVersions map[string]string
+	if config.dryRun {
+		err = dryRun(keys, values, kvStore, protoconfRoot)
+	} else if len(versions) > 0 {
+		newVersions, err = insertConfigsIfVersions(keys, values, versions, kvStore.(libprotoconf.VersionedStore))
+	} else {
+		err = insertConfigs(keys, values, kvStore)
+	}
+	if err != nil {
+		log.Printf("Error writing to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	if err := auditor.record(audit.ActionInsert, keys, values, newVersions, protoconfRoot); err != nil {
+		log.Printf("Error, the configs were inserted but not recorded to the audit log, err=%s", err)
+		return 1
+	}
+	if !expires.IsZero() {
+		return setExpiries(keys, previous, newVersions, kvStore, kVConfig.Prefix, expires, config.identity, config.dryRun)
+	}
 	return 0
 }
 
@@ -125,28 +364,315 @@ func Command() (cli.Command, error) {
 	return &cliCommand{}, nil
 }
 
-func insertConfig(configFile string, protoconfRoot string, kvStore store.Store, prefix string) error {
+// startRollouts starts rolling out the configs of keys instead of inserting
+// them, the configs are changed only once their rollouts are promoted
+func startRollouts(keys []string, values map[string][]byte, kvStore libprotoconf.Store, prefix string, policy rollout.Policy, identity string) int {
+	manager := rollout.NewManager(kvStore, prefix)
+	for _, key := range keys {
+		path := strings.TrimPrefix(key, prefix)
+		r, err := manager.Start(path, values[key], policy, identity, time.Now())
+		if err != nil {
+			log.Printf("Error starting rollout of %s, err=%s", path, err)
+			return 1
+		}
+		fmt.Printf("Rolling out %s to %d%% of its subscribers, policy %s\n", path, r.Percentage(), policy)
+	}
+	return 0
+}
+
+// startCanaries serves the configs of keys to the subscribers canary selects
+// instead of inserting them, the configs are changed only once their canaries
+// are promoted
+func startCanaries(keys []string, values map[string][]byte, kvStore libprotoconf.Store, prefix string, canary *rollout.Canary, identity string) int {
+	manager := rollout.NewManager(kvStore, prefix)
+	for _, key := range keys {
+		path := strings.TrimPrefix(key, prefix)
+		if _, err := manager.StartCanary(path, values[key], canary, identity, time.Now()); err != nil {
+			log.Printf("Error starting canary of %s, err=%s", path, err)
+			return 1
+		}
+		fmt.Printf("Serving %s to %s, promote it with protoconf rollout promote\n", path, canary)
+	}
+	return 0
+}
+
+// setTargets serves the configs of keys to the subscribers matching labels
+// instead of inserting them
+func setTargets(keys []string, values map[string][]byte, kvStore libprotoconf.Store, prefix string, labels targeting.Labels, identity string) int {
+	manager := targeting.NewManager(kvStore, prefix)
+	for _, key := range keys {
+		path := strings.TrimPrefix(key, prefix)
+		if _, err := manager.Set(path, labels, values[key], identity, time.Now()); err != nil {
+			log.Printf("Error setting the targeting rule of %s, err=%s", path, err)
+			return 1
+		}
+		fmt.Printf("Path %s targeted to the subscribers matching %s\n", key, labels)
+	}
+	return 0
+}
+
+// setExpiries sets the expiries of the configs of keys just inserted, which
+// revert them to their previous values
+func setExpiries(keys []string, previous map[string]*storedConfig, versions map[string]string, kvStore libprotoconf.Store, prefix string, expires time.Time, identity string, dryRun bool) int {
+	manager := expiry.NewManager(kvStore, prefix)
+	now := time.Now()
+	for _, key := range keys {
+		path := strings.TrimPrefix(key, prefix)
+		if dryRun {
+			fmt.Printf("Path %s would expire at %s\n", key, expires.UTC().Format(time.RFC3339))
+			continue
+		}
+		err := manager.Set(&expiry.Expiry{
+			Path:            path,
+			Previous:        previous[key].value,
+			PreviousVersion: previous[key].version,
+			Version:         versions[key],
+			Expires:         expires,
+			Identity:        identity,
+			Created:         now,
+		})
+		if err != nil {
+			log.Printf("Error, config %s was inserted but its expiry wasn't set, err=%s", path, err)
+			return 1
+		}
+		fmt.Printf("Path %s expires at %s\n", key, expires.UTC().Format(time.RFC3339))
+	}
+	return 0
+}
+
+// EncodeConfigs compiles and validates configs as protoconf insert does, the
+// sources compiled and the materialized configs read, and encodes them as
+// they are written to the store, by their keys under prefix
+func EncodeConfigs(configs []string, protoconfRoot string, prefix string) ([]string, map[string][]byte, error) {
+	return encodeConfigs(configs, protoconfRoot, prefix, true)
+}
+
+// EncodeCompiled encodes the materialized configs written by the compiler,
+// which validated them already, as EncodeConfigs does
+func EncodeCompiled(configFiles []string, protoconfRoot string, prefix string) ([]string, map[string][]byte, error) {
+	return encodeConfigs(configFiles, protoconfRoot, prefix, false)
+}
+
+// encodeConfigs encodes the materialized configs, and the outputs of the
+// sources compiled, by their keys under prefix. Every config is encoded
+// before any is written.
+func encodeConfigs(args []string, protoconfRoot string, prefix string, validate bool) ([]string, map[string][]byte, error) {
+	var configFiles, sources []string
+	for _, arg := range args {
+		arg = filepath.ToSlash(strings.TrimSpace(arg))
+		if strings.HasSuffix(arg, consts.ConfigExtension) || strings.HasSuffix(arg, consts.MultiConfigExtension) {
+			sources = append(sources, arg)
+		} else {
+			configFiles = append(configFiles, arg)
+		}
+	}
+	compiled, err := compileSources(sources, protoconfRoot, validate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	values := make(map[string][]byte)
+	encode := func(configFile string, validate bool) error {
+		configName, write, err := encodeConfig(configFile, protoconfRoot, validate)
+		if err != nil {
+			return fmt.Errorf("error inserting config %s, err=%s", configFile, err)
+		}
+		if _, ok := values[prefix+configName]; !ok {
+			keys = append(keys, prefix+configName)
+		}
+		values[prefix+configName] = write
+		return nil
+	}
+	for _, configFile := range configFiles {
+		if err := encode(configFile, validate); err != nil {
+			return nil, nil, err
+		}
+	}
+	// The outputs compiled are validated by the compiler already
+	for _, configFile := range compiled {
+		if err := encode(configFile, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	return keys, values, nil
+}
+
+// compileSources compiles configs to the materialized configs of the root, as
+// protoconf compile does, and returns the materialized configs of the outputs
+func compileSources(sources []string, protoconfRoot string, validate bool) ([]string, error) {
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	compiler := lib.NewCompiler(protoconfRoot, false)
+	if !validate {
+		compiler.DisableValidation()
+	}
+	for _, source := range sources {
+		if err := compiler.CompileFile(source); err != nil {
+			return nil, fmt.Errorf("error compiling config %s, err=%s", source, err)
+		}
+	}
+	if err := compiler.CheckReferences(); err != nil {
+		return nil, err
+	}
+	if err := compiler.RunHooks(); err != nil {
+		return nil, err
+	}
+
+	var configFiles []string
+	for _, name := range compiler.Compiled() {
+		configFiles = append(configFiles, name+consts.CompiledConfigExtension)
+	}
+	return configFiles, nil
+}
+
+// insertConfigs writes the configs of keys, in one transaction when the store
+// is a libprotoconf.BatchStore
+func insertConfigs(keys []string, values map[string][]byte, kvStore libprotoconf.Store) error {
+	if batch, ok := kvStore.(libprotoconf.BatchStore); ok {
+		if err := batch.SetAll(values); err != nil {
+			return err
+		}
+	} else {
+		for _, key := range keys {
+			if err := kvStore.Set(key, values[key]); err != nil {
+				return fmt.Errorf("error writing config, path=%s err=%s", key, err)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		fmt.Printf("Path %s inserted successfully\n", key)
+	}
+	return nil
+}
+
+// insertConfigsIfVersions writes the configs of keys, the configs of versions
+// only when they are at their versions, and returns their new versions. The
+// versions are checked before any config is written, a config changed in
+// between fails the insert midway.
+func insertConfigsIfVersions(keys []string, values map[string][]byte, versions map[string]string, kvStore libprotoconf.VersionedStore) (map[string]string, error) {
+	for key, version := range versions {
+		_, current, err := kvStore.GetVersion(key)
+		if err != nil && err != libprotoconf.ErrConfigNotFound {
+			return nil, fmt.Errorf("error reading config, path=%s err=%s", key, err)
+		}
+		if current != version {
+			return nil, fmt.Errorf("config was changed since version %s, path=%s version=%s", printedVersion(version), key, printedVersion(current))
+		}
+	}
+
+	newVersions := make(map[string]string)
+	for _, key := range keys {
+		version, ok := versions[key]
+		if !ok {
+			if err := kvStore.Set(key, values[key]); err != nil {
+				return newVersions, fmt.Errorf("error writing config, path=%s err=%s", key, err)
+			}
+			fmt.Printf("Path %s inserted successfully\n", key)
+			continue
+		}
+		newVersion, err := kvStore.SetIfVersion(key, values[key], version)
+		if err == libprotoconf.ErrVersionMismatch {
+			return newVersions, fmt.Errorf("config was changed since version %s, path=%s", printedVersion(version), key)
+		}
+		if err != nil {
+			return newVersions, fmt.Errorf("error writing config, path=%s err=%s", key, err)
+		}
+		newVersions[key] = newVersion
+		fmt.Printf("Path %s inserted successfully, version=%s\n", key, newVersion)
+	}
+	return newVersions, nil
+}
+
+// printedVersion is the version as it's passed to -if-version
+func printedVersion(version string) string {
+	if version == "" {
+		return noVersion
+	}
+	return version
+}
+
+// dryRun prints whether the configs of keys would be inserted or updated,
+// along with their current versions when the store has versions and the
+// fields of the configs updated which would change, without writing them
+func dryRun(keys []string, values map[string][]byte, kvStore libprotoconf.Store, protoconfRoot string) error {
+	versioned, isVersioned := kvStore.(libprotoconf.VersionedStore)
+	for _, key := range keys {
+		var current []byte
+		var version string
+		var err error
+		if isVersioned {
+			current, version, err = versioned.GetVersion(key)
+		} else {
+			current, err = kvStore.Get(key)
+		}
+		suffix := ""
+		if isVersioned {
+			suffix = ", version=" + printedVersion(version)
+		}
+		switch {
+		case err == libprotoconf.ErrConfigNotFound:
+			fmt.Printf("Path %s would be inserted%s\n", key, suffix)
+		case err != nil:
+			return fmt.Errorf("error reading config, path=%s err=%s", key, err)
+		case bytes.Equal(current, values[key]):
+			fmt.Printf("Path %s is unchanged%s\n", key, suffix)
+		default:
+			fmt.Printf("Path %s would be updated%s\n", key, suffix)
+			diffs, err := diffConfigs(current, values[key], protoconfRoot)
+			if err != nil {
+				fmt.Printf("  error comparing the configs, err=%s\n", err)
+				continue
+			}
+			for _, diff := range diffs {
+				fmt.Printf("  %s\n", diff)
+			}
+		}
+	}
+	return nil
+}
+
+// diffConfigs lists the fields changed from the config stored to the config
+// inserted
+func diffConfigs(current []byte, inserted []byte, protoconfRoot string) ([]utils.FieldDiff, error) {
+	currentValue, err := libprotoconf.DecodeConfig(current)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the config stored, err=%s", err)
+	}
+	insertedValue, err := libprotoconf.DecodeConfig(inserted)
+	if err != nil {
+		return nil, err
+	}
+	return utils.DiffConfigs(currentValue, insertedValue, protoconfRoot)
+}
+
+// encodeConfig reads a materialized config and encodes it as it's written
+// to the store, a base64 encoded ProtoconfValue
+func encodeConfig(configFile string, protoconfRoot string, validate bool) (string, []byte, error) {
 	if !strings.HasSuffix(configFile, consts.CompiledConfigExtension) {
-		return fmt.Errorf("config must be a %s file, file=%s", consts.CompiledConfigExtension, configFile)
+		return "", nil, fmt.Errorf("config must be a %s file, file=%s", consts.CompiledConfigExtension, configFile)
 	}
 	configName := strings.TrimSuffix(configFile, consts.CompiledConfigExtension)
 
 	protoconfValue, err := utils.ReadConfig(protoconfRoot, configName)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
-	data, err := proto.Marshal(protoconfValue)
-	if err != nil {
-		return fmt.Errorf("error marshaling ProtoconfValue to bytes, value=%v", protoconfValue)
+	// Materialized configs may have been written or edited by hand, they are
+	// validated again as the compiler would before reaching the store
+	if validate {
+		filename := filepath.Join(protoconfRoot, consts.CompiledConfigPath, configFile)
+		if err := lib.NewCompiler(protoconfRoot, false).ValidateValue(protoconfValue, filename); err != nil {
+			return "", nil, fmt.Errorf("invalid config, file=%s err=%v", configFile, err)
+		}
 	}
 
-	kvPath := prefix + configName
-	write := base64.StdEncoding.EncodeToString(data)
-	if err := kvStore.Put(kvPath, []byte(write), nil); err != nil {
-		return fmt.Errorf("error writing to key-value store, path=%s", kvPath)
+	data, err := proto.Marshal(protoconfValue)
+	if err != nil {
+		return "", nil, fmt.Errorf("error marshaling ProtoconfValue to bytes, value=%v", protoconfValue)
 	}
-
-	fmt.Printf("Path %s inserted successfully\n", kvPath)
-	return nil
+	return configName, []byte(base64.StdEncoding.EncodeToString(data)), nil
 }
@@ -0,0 +1,178 @@
+// Package kube is a client of the Kubernetes API, reading and writing its
+// objects as JSON
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where the pods find the token and the CA of their
+// service account
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var (
+	// ErrNotFound is returned for the objects which don't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when creating an object which exists, or
+	// writing an object changed since it was read
+	ErrConflict = errors.New("conflict")
+)
+
+// ObjectMeta is the metadata of an object
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	DeletionTimestamp string            `json:"deletionTimestamp,omitempty"`
+	Finalizers        []string          `json:"finalizers,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+}
+
+// Config holds the address and the credentials of the API server set from
+// the command line
+type Config struct {
+	API       string
+	TokenFile string
+	CA        string
+}
+
+// AddFlags adds to an existing flagset the command line flags of the API
+// server
+func AddFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.API, "kube-api", "", "Address of the Kubernetes API server, e.g. http://localhost:8001 of kubectl proxy (default: the API server of the cluster, as the service account of the pod)")
+	fs.StringVar(&c.TokenFile, "kube-token-file", "", "File of the bearer token authenticating to -kube-api")
+	fs.StringVar(&c.CA, "kube-ca", "", "CA certificate of -kube-api")
+}
+
+// Client returns the client of the API server of the flags, of the cluster
+// the pod runs in without -kube-api
+func (c *Config) Client() (*Client, error) {
+	if c.API != "" {
+		return NewClient(c.API, c.TokenFile, c.CA)
+	}
+	return NewInClusterClient()
+}
+
+// Client is a client of the Kubernetes API
+type Client struct {
+	url       string
+	tokenFile string
+	http      *http.Client
+}
+
+// NewInClusterClient connects to the API server of the cluster the pod runs
+// in, as the service account of the pod
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT aren't set, run in a pod or set the address of the API server")
+	}
+	return NewClient("https://"+net.JoinHostPort(host, port), filepath.Join(serviceAccountDir, "token"), filepath.Join(serviceAccountDir, "ca.crt"))
+}
+
+// NewClient connects to the API server at url, e.g. http://localhost:8001 of
+// kubectl proxy, with the bearer token of tokenFile and trusting the CA of
+// caFile when set. The token is read again for every request, as the tokens
+// of the service accounts are rotated.
+func NewClient(url string, tokenFile string, caFile string) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &Client{url: strings.TrimSuffix(url, "/"), tokenFile: tokenFile, http: &http.Client{Transport: transport, Timeout: 30 * time.Second}}, nil
+}
+
+// Get reads the object at path, e.g. /api/v1/namespaces/default/configmaps/app,
+// into result
+func (c *Client) Get(ctx context.Context, path string, result interface{}) error {
+	return c.do(ctx, http.MethodGet, path, nil, result)
+}
+
+// Create creates an object in the collection at path, failing with
+// ErrConflict when it exists. The object is updated to the object created.
+func (c *Client) Create(ctx context.Context, path string, object interface{}) error {
+	return c.do(ctx, http.MethodPost, path, object, object)
+}
+
+// Update writes the object at path, failing with ErrConflict when the object
+// changed since its resource version was read. The object is updated to the
+// object written, at its new resource version.
+func (c *Client) Update(ctx context.Context, path string, object interface{}) error {
+	return c.do(ctx, http.MethodPut, path, object, object)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/json")
+	if c.tokenFile != "" {
+		token, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 300 {
+		// The errors are a Status with a message
+		var status struct{ Message string }
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(data))
+		}
+		switch response.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w, %s", ErrNotFound, status.Message)
+		case http.StatusConflict:
+			return fmt.Errorf("%w, %s", ErrConflict, status.Message)
+		}
+		return fmt.Errorf("%s %s: %s, %s", method, path, response.Status, status.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
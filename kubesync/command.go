@@ -0,0 +1,124 @@
+package kubesync
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/kube"
+	"google.golang.org/grpc"
+)
+
+type cliCommand struct{}
+
+type cliConfig struct {
+	agentAddress  string
+	protoRoot     string
+	kube          kube.Config
+	retryInterval time.Duration
+	tls           command.TLSConfig
+	compression   string
+}
+
+func newFlagSet() (*flag.FlagSet, *cliConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... config_path=namespace/configmap|secret/name[:key]...")
+		fmt.Fprintln(flags.Output(), "Syncs configs to ConfigMaps and Secrets as JSON, under the key of each target, the base name of the config with .json by default.")
+		flags.PrintDefaults()
+	}
+
+	config := &cliConfig{}
+	flags.StringVar(&config.agentAddress, "agent-address", consts.AgentDefaultAddress, "Address of the agent serving the configs")
+	flags.StringVar(&config.protoRoot, "proto-root", "", "Protoconf root the types of the configs are read from")
+	kube.AddFlags(flags, &config.kube)
+	flags.DurationVar(&config.retryInterval, "retry-interval", DefaultRetryInterval, "How long to wait before syncing a config again after failing to")
+	command.AddTLSClientFlags(flags, &config.tls)
+	command.AddCompressionFlag(flags, &config.compression)
+
+	return flags, config
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config := newFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 1
+	}
+	var targets []*Target
+	for _, arg := range flags.Args() {
+		target, err := ParseTarget(arg)
+		if err != nil {
+			log.Printf("Error, %s", err)
+			return 1
+		}
+		targets = append(targets, target)
+	}
+	client, err := config.kube.Client()
+	if err != nil {
+		log.Printf("Error setting up the Kubernetes client, err=%s", err)
+		return 1
+	}
+
+	transport, err := config.tls.DialOption()
+	if err != nil {
+		log.Printf("Error setting up mutual TLS, err=%s", err)
+		return 1
+	}
+	compression, err := command.CompressionDialOptions(config.compression)
+	if err != nil {
+		log.Printf("Error, -compression %s", err)
+		return 1
+	}
+	conn, err := grpc.Dial(config.agentAddress, append(compression, transport)...)
+	if err != nil {
+		log.Printf("Error connecting to the agent at \"%s\", err=%s", config.agentAddress, err)
+		return 1
+	}
+	defer conn.Close()
+
+	var resolver agent.Resolver
+	if config.protoRoot != "" {
+		resolver = agent.NewRootResolver(config.protoRoot)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	syncer := NewSyncer(client, protoconfservice.NewProtoconfServiceClient(conn), resolver, config.retryInterval)
+	if err := syncer.Run(ctx, targets); err != nil && err != context.Canceled {
+		log.Printf("Error syncing configs, err=%s", err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _ := newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return "Syncs configs to Kubernetes ConfigMaps and Secrets"
+}
+
+// Command is a cli.CommandFactory
+func Command() (cli.Command, error) {
+	return &cliCommand{}, nil
+}
@@ -0,0 +1,293 @@
+// Package kubesync syncs configs to Kubernetes ConfigMaps and Secrets, so the
+// workloads mounting config files get the values of the configs without
+// being changed
+package kubesync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/kube"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// The kinds of the objects the configs are synced to
+const (
+	KindConfigMap = "ConfigMap"
+	KindSecret    = "Secret"
+)
+
+// object is a ConfigMap or a Secret, the data of a Secret encoded in base64
+type object struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   kube.ObjectMeta   `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+// resources are the resources of the API by kind
+var resources = map[string]string{
+	KindConfigMap: "configmaps",
+	KindSecret:    "secrets",
+}
+
+// The label and the annotations of the objects the configs are synced to
+const (
+	// ManagedByLabel marks the objects protoconf manages, the only objects
+	// it writes to
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "protoconf"
+	// PathAnnotation is the path of the config synced
+	PathAnnotation = "protoconf.io/path"
+	// TypeAnnotation is the message type of the config
+	TypeAnnotation = "protoconf.io/type"
+	// VersionAnnotation is the SHA-256 of the value of the config
+	VersionAnnotation = "protoconf.io/version"
+	// SyncedAtAnnotation is when the value of the config was written
+	SyncedAtAnnotation = "protoconf.io/synced-at"
+)
+
+// DefaultRetryInterval is how long the syncer waits by default to subscribe
+// to a config again after failing to sync it
+const DefaultRetryInterval = 10 * time.Second
+
+// maxConflicts is how many times an object changed meanwhile is read again
+// before giving up
+const maxConflicts = 3
+
+var (
+	kinds = map[string]string{"configmap": KindConfigMap, "secret": KindSecret}
+	// nameRegexp matches the names of the objects, DNS subdomains
+	nameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+	keyRegexp  = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+)
+
+// Target is a ConfigMap or a Secret a config is synced to, as a key of its
+// data
+type Target struct {
+	Path      string
+	Namespace string
+	Kind      string
+	Name      string
+	Key       string
+}
+
+// ParseTarget parses a target given as
+// config_path=namespace/configmap|secret/name[:key]. The key is the base
+// name of the config with .json by default.
+func ParseTarget(value string) (*Target, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid target %q, expected config_path=namespace/configmap|secret/name[:key]", value)
+	}
+	target := &Target{Path: parts[0], Key: path.Base(parts[0]) + ".json"}
+	object := parts[1]
+	if i := strings.LastIndex(object, ":"); i >= 0 {
+		target.Key = object[i+1:]
+		object = object[:i]
+	}
+	fields := strings.Split(object, "/")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid target %q, expected config_path=namespace/configmap|secret/name[:key]", value)
+	}
+	target.Namespace, target.Name = fields[0], fields[2]
+	kind, ok := kinds[strings.ToLower(fields[1])]
+	if !ok {
+		return nil, fmt.Errorf("invalid target %q, the kind %q isn't configmap or secret", value, fields[1])
+	}
+	target.Kind = kind
+	if !nameRegexp.MatchString(target.Namespace) || !nameRegexp.MatchString(target.Name) {
+		return nil, fmt.Errorf("invalid target %q, invalid namespace or name", value)
+	}
+	if !keyRegexp.MatchString(target.Key) {
+		return nil, fmt.Errorf("invalid target %q, invalid key %q", value, target.Key)
+	}
+	return target, nil
+}
+
+// collection is the path of the collection of the object of the target in
+// the API
+func (t *Target) collection() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/%s", t.Namespace, resources[t.Kind])
+}
+
+func (t *Target) String() string {
+	return fmt.Sprintf("%s/%s/%s:%s", t.Namespace, strings.ToLower(t.Kind), t.Name, t.Key)
+}
+
+// Syncer syncs the configs an agent serves to ConfigMaps and Secrets
+type Syncer struct {
+	client        *kube.Client
+	agent         protoconfservice.ProtoconfServiceClient
+	marshal       protojson.MarshalOptions
+	retryInterval time.Duration
+}
+
+// NewSyncer returns a syncer subscribing to the configs of agent and writing
+// them with client as JSON, the types of the configs resolved with resolver,
+// protoregistry.GlobalTypes when nil. The configs failing to sync are
+// subscribed to again after retryInterval.
+func NewSyncer(client *kube.Client, agentClient protoconfservice.ProtoconfServiceClient, resolver agent.Resolver, retryInterval time.Duration) *Syncer {
+	if resolver == nil {
+		resolver = protoregistry.GlobalTypes
+	}
+	return &Syncer{
+		client:        client,
+		agent:         agentClient,
+		marshal:       protojson.MarshalOptions{Resolver: resolver, Multiline: true},
+		retryInterval: retryInterval,
+	}
+}
+
+// Run syncs every value of the configs of targets until ctx is done
+func (s *Syncer) Run(ctx context.Context, targets []*Target) error {
+	objects := make(map[string]bool)
+	for _, target := range targets {
+		object := fmt.Sprintf("%s/%s/%s", target.Namespace, target.Kind, target.Name)
+		if objects[object] {
+			return fmt.Errorf("more than one config is synced to %s/%s/%s", target.Namespace, strings.ToLower(target.Kind), target.Name)
+		}
+		objects[object] = true
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *Target) {
+			defer wg.Done()
+			s.sync(ctx, target)
+		}(target)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// sync subscribes to the config of target and writes every value of it,
+// subscribing again after retryInterval when it fails
+func (s *Syncer) sync(ctx context.Context, target *Target) {
+	for {
+		err := s.subscribe(ctx, target)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Error syncing config, retrying in %s, path=%s target=%s err=%s", s.retryInterval, target.Path, target, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.retryInterval):
+		}
+	}
+}
+
+func (s *Syncer) subscribe(ctx context.Context, target *Target) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := s.agent.SubscribeForConfig(ctx, &protoconfservice.ConfigSubscriptionRequest{Path: target.Path})
+	if err != nil {
+		return err
+	}
+	log.Printf("Syncing path=%s target=%s", target.Path, target)
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if err := s.Apply(ctx, target, update.GetValue()); err != nil {
+			return err
+		}
+		s.acknowledge(ctx, target, update.GetVersion())
+	}
+}
+
+// acknowledge reports the version of the config of target synced to the
+// agent, which lists it among the versions of its subscribers
+func (s *Syncer) acknowledge(ctx context.Context, target *Target, version string) {
+	if version == "" {
+		// Sent by an agent which doesn't track its subscribers
+		return
+	}
+	if _, err := s.agent.Acknowledge(ctx, &protoconfservice.AcknowledgeRequest{Path: target.Path, Version: version}); err != nil && ctx.Err() == nil {
+		log.Printf("Error acknowledging config, path=%s version=%s err=%s", target.Path, version, err)
+	}
+}
+
+// Apply writes a value of the config of target to its object as JSON,
+// creating the object when it doesn't exist. The objects existing which
+// protoconf doesn't manage aren't written to, and the other keys of the
+// objects are kept.
+func (s *Syncer) Apply(ctx context.Context, target *Target, value *anypb.Any) error {
+	data, err := s.marshal.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error marshaling config to JSON, the type of the config may be unknown, err=%s", err)
+	}
+	encoded := string(data) + "\n"
+	if target.Kind == KindSecret {
+		encoded = base64.StdEncoding.EncodeToString([]byte(encoded))
+	}
+	version := fmt.Sprintf("%x", sha256.Sum256(append([]byte(value.GetTypeUrl()), value.GetValue()...)))
+
+	for conflicts := 0; ; conflicts++ {
+		o := &object{}
+		err := s.client.Get(ctx, target.collection()+"/"+target.Name, o)
+		if errors.Is(err, kube.ErrNotFound) {
+			o = &object{APIVersion: "v1", Kind: target.Kind, Metadata: kube.ObjectMeta{Name: target.Name, Namespace: target.Namespace}}
+			if target.Kind == KindSecret {
+				o.Type = "Opaque"
+			}
+		} else if err != nil {
+			return err
+		} else if o.Metadata.Labels[ManagedByLabel] != managedBy {
+			return fmt.Errorf("%s %s/%s exists and isn't managed by protoconf, label it %s=%s to sync the config to it", target.Kind, target.Namespace, target.Name, ManagedByLabel, managedBy)
+		}
+		if o.Data[target.Key] == encoded && o.Metadata.Annotations[VersionAnnotation] == version {
+			return nil
+		}
+
+		o.APIVersion, o.Kind = "v1", target.Kind
+		if o.Metadata.Labels == nil {
+			o.Metadata.Labels = make(map[string]string)
+		}
+		o.Metadata.Labels[ManagedByLabel] = managedBy
+		if o.Metadata.Annotations == nil {
+			o.Metadata.Annotations = make(map[string]string)
+		}
+		typeURL := value.GetTypeUrl()
+		o.Metadata.Annotations[PathAnnotation] = target.Path
+		o.Metadata.Annotations[TypeAnnotation] = typeURL[strings.LastIndex(typeURL, "/")+1:]
+		o.Metadata.Annotations[VersionAnnotation] = version
+		o.Metadata.Annotations[SyncedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		if o.Data == nil {
+			o.Data = make(map[string]string)
+		}
+		o.Data[target.Key] = encoded
+
+		if o.Metadata.ResourceVersion == "" {
+			err = s.client.Create(ctx, target.collection(), o)
+		} else {
+			err = s.client.Update(ctx, target.collection()+"/"+target.Name, o)
+		}
+		if errors.Is(err, kube.ErrConflict) && conflicts < maxConflicts {
+			// Created or changed meanwhile
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Synced config, path=%s target=%s version=%s", target.Path, target, version)
+		return nil
+	}
+}
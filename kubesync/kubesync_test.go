@@ -0,0 +1,175 @@
+package kubesync
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/kube"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeAPI serves the ConfigMaps and the Secrets of an API server
+type fakeAPI struct {
+	lock    sync.Mutex
+	objects map[string]*object
+	version int
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	// /api/v1/namespaces/{namespace}/{resource}[/{name}]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
+	key := strings.Join(parts, "/")
+	fail := func(code int, message string) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"kind": "Status", "message": message})
+	}
+	o := &object{}
+	if r.Method != http.MethodGet && json.NewDecoder(r.Body).Decode(o) != nil {
+		fail(http.StatusBadRequest, "invalid object")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		current, ok := f.objects[key]
+		if !ok {
+			fail(http.StatusNotFound, key+" not found")
+			return
+		}
+		json.NewEncoder(w).Encode(current)
+		return
+	case http.MethodPost:
+		key += "/" + o.Metadata.Name
+		if _, ok := f.objects[key]; ok {
+			fail(http.StatusConflict, key+" already exists")
+			return
+		}
+	case http.MethodPut:
+		if f.objects[key].Metadata.ResourceVersion != o.Metadata.ResourceVersion {
+			fail(http.StatusConflict, "the object has been modified")
+			return
+		}
+	}
+	f.version++
+	o.Metadata.ResourceVersion = fmt.Sprint(f.version)
+	f.objects[key] = o
+	json.NewEncoder(w).Encode(o)
+}
+
+func (f *fakeAPI) get(key string) *object {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.objects[key]
+}
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget("crawler/text_crawler=prod/configmap/crawler")
+	assert.NoError(t, err)
+	assert.Equal(t, &Target{Path: "crawler/text_crawler", Namespace: "prod", Kind: KindConfigMap, Name: "crawler", Key: "text_crawler.json"}, target)
+	target, err = ParseTarget("crawler/text_crawler=prod/Secret/crawler:config.json")
+	assert.NoError(t, err)
+	assert.Equal(t, &Target{Path: "crawler/text_crawler", Namespace: "prod", Kind: KindSecret, Name: "crawler", Key: "config.json"}, target)
+
+	for _, value := range []string{"crawler", "crawler=prod/crawler", "crawler=prod/deployment/crawler", "crawler=prod/configmap/Crawler", "crawler=prod/configmap/crawler:a/b"} {
+		_, err := ParseTarget(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestSyncer(t *testing.T) {
+	api := &fakeAPI{objects: map[string]*object{
+		"prod/configmaps/unmanaged": {Kind: KindConfigMap, Metadata: kube.ObjectMeta{Name: "unmanaged", Namespace: "prod"}},
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	client, err := kube.NewClient(server.URL, "", "")
+	assert.NoError(t, err)
+
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("first")))
+	assert.NoError(t, store.SetConfig("services/token", wrapperspb.String("secret")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rpcServer := grpc.NewServer()
+	protoconfservice.RegisterProtoconfServiceServer(rpcServer, agent.NewServer(watcher, 10))
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	syncer := NewSyncer(client, protoconfservice.NewProtoconfServiceClient(conn), nil, 10*time.Millisecond)
+	var targets []*Target
+	for _, value := range []string{"services/api=prod/configmap/api", "services/token=prod/secret/token:token.json"} {
+		target, err := ParseTarget(value)
+		assert.NoError(t, err)
+		targets = append(targets, target)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- syncer.Run(ctx, targets) }()
+	defer func() {
+		cancel()
+		assert.Equal(t, context.Canceled, <-done)
+	}()
+
+	waitFor := func(key string, dataKey string, value string) *object {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+			if o := api.get(key); o != nil && strings.Contains(o.Data[dataKey], value) {
+				return o
+			}
+		}
+		t.Fatalf("%s wasn't synced, data=%v", key, api.get(key))
+		return nil
+	}
+	o := waitFor("prod/configmaps/api", "api.json", "first")
+	assert.Equal(t, "protoconf", o.Metadata.Labels[ManagedByLabel])
+	assert.Equal(t, "services/api", o.Metadata.Annotations[PathAnnotation])
+	assert.Equal(t, "google.protobuf.StringValue", o.Metadata.Annotations[TypeAnnotation])
+	version := o.Metadata.Annotations[VersionAnnotation]
+	assert.NotEmpty(t, version)
+
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("second")))
+	o = waitFor("prod/configmaps/api", "api.json", "second")
+	assert.NotEqual(t, version, o.Metadata.Annotations[VersionAnnotation])
+
+	// The Secrets are encoded in base64
+	secret := api.get("prod/secrets/token")
+	for start := time.Now(); secret == nil && time.Since(start) < 5*time.Second; secret = api.get("prod/secrets/token") {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.NotNil(t, secret)
+	data, err := base64.StdEncoding.DecodeString(secret.Data["token.json"])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "secret")
+	assert.Equal(t, "Opaque", secret.Type)
+
+	// The objects protoconf doesn't manage aren't overwritten
+	target, err := ParseTarget("services/api=prod/configmap/unmanaged")
+	assert.NoError(t, err)
+	value, err := anypb.New(wrapperspb.String("first"))
+	assert.NoError(t, err)
+	assert.Error(t, syncer.Apply(context.Background(), target, value))
+	assert.Empty(t, api.get("prod/configmaps/unmanaged").Data)
+
+	// A single config is synced to an object
+	assert.Error(t, syncer.Run(context.Background(), []*Target{targets[0], targets[0]}))
+}
@@ -0,0 +1,512 @@
+package libprotoconf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+)
+
+// The attributes of the items of the configs in DynamoDB, the key is the
+// partition key of the table. The version is a random token written along
+// with every value.
+const (
+	dynamoDBKey     = "key"
+	dynamoDBValue   = "value"
+	dynamoDBVersion = "version"
+)
+
+// dynamoDBUnversioned is the version of the items written before the items
+// had versions
+const dynamoDBUnversioned = "0"
+
+const (
+	// dynamoDBPollInterval is how often the watched configs are read when
+	// the stream of the table isn't enabled
+	dynamoDBPollInterval = 10 * time.Second
+	// dynamoDBRecordsInterval is how often the shards of the stream are read
+	dynamoDBRecordsInterval = time.Second
+	// dynamoDBShardsInterval is how often new shards of the stream are looked for
+	dynamoDBShardsInterval = 30 * time.Second
+)
+
+func init() {
+	RegisterStore("dynamodb", func(table string) (Store, error) {
+		if table == "" {
+			return nil, errors.New("the table of dynamodb must be set")
+		}
+		return NewDynamoDBStore(table)
+	})
+}
+
+// DynamoDBStore stores the configs in a DynamoDB table, one item per config
+// with the config as it's inserted in its value. The watched configs are
+// read again when the stream of the table records a change of their key, or
+// polled when the stream isn't enabled.
+type DynamoDBStore struct {
+	client  *dynamodb.DynamoDB
+	streams *dynamodbstreams.DynamoDBStreams
+	table   string
+
+	watches   map[string][]chan struct{}
+	lock      sync.Mutex
+	startOnce sync.Once
+	startErr  error
+	ticker    *time.Ticker
+	closeCh   chan struct{}
+}
+
+// NewDynamoDBStore stores the configs in table. The credentials and the region
+// are read from the environment and the shared AWS config.
+func NewDynamoDBStore(table string) (*DynamoDBStore, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, err
+	}
+	return &DynamoDBStore{
+		client:  dynamodb.New(sess),
+		streams: dynamodbstreams.New(sess),
+		table:   table,
+		watches: make(map[string][]chan struct{}),
+		closeCh: make(chan struct{}),
+	}, nil
+}
+
+// Set writes the value of a key
+func (s *DynamoDBStore) Set(key string, value []byte) error {
+	item, _, err := s.item(key, value)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	})
+	return err
+}
+
+// item is the item of the value of a key, with a new version
+func (s *DynamoDBStore) item(key string, value []byte) (map[string]*dynamodb.AttributeValue, string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, "", err
+	}
+	version := hex.EncodeToString(token)
+	return map[string]*dynamodb.AttributeValue{
+		dynamoDBKey:     {S: aws.String(key)},
+		dynamoDBValue:   {S: aws.String(string(value))},
+		dynamoDBVersion: {S: aws.String(version)},
+	}, version, nil
+}
+
+// SetIfVersion writes the value of a key with a conditional write, failing
+// when the version of the item isn't version
+func (s *DynamoDBStore) SetIfVersion(key string, value []byte, version string) (string, error) {
+	item, newVersion, err := s.item(key, value)
+	if err != nil {
+		return "", err
+	}
+	// DynamoDB rejects the attribute names unused by the condition
+	input := &dynamodb.PutItemInput{TableName: aws.String(s.table), Item: item}
+	switch version {
+	case "":
+		input.ConditionExpression = aws.String("attribute_not_exists(#key)")
+		input.ExpressionAttributeNames = map[string]*string{"#key": aws.String(dynamoDBKey)}
+	case dynamoDBUnversioned:
+		input.ConditionExpression = aws.String("attribute_exists(#key) AND attribute_not_exists(#version)")
+		input.ExpressionAttributeNames = map[string]*string{
+			"#key":     aws.String(dynamoDBKey),
+			"#version": aws.String(dynamoDBVersion),
+		}
+	default:
+		input.ConditionExpression = aws.String("#version = :version")
+		input.ExpressionAttributeNames = map[string]*string{"#version": aws.String(dynamoDBVersion)}
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":version": {S: aws.String(version)},
+		}
+	}
+	_, err = s.client.PutItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return "", ErrVersionMismatch
+	}
+	if err != nil {
+		return "", err
+	}
+	return newVersion, nil
+}
+
+// SetAll writes the values of keys in one DynamoDB transaction, a nil value
+// deletes its key. DynamoDB limits the number of items of a transaction.
+func (s *DynamoDBStore) SetAll(values map[string][]byte) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := make([]*dynamodb.TransactWriteItem, 0, len(keys))
+	for _, key := range keys {
+		if values[key] == nil {
+			items = append(items, &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+				TableName: aws.String(s.table),
+				Key: map[string]*dynamodb.AttributeValue{
+					dynamoDBKey: {S: aws.String(key)},
+				},
+			}})
+			continue
+		}
+		item, _, err := s.item(key, values[key])
+		if err != nil {
+			return err
+		}
+		items = append(items, &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName: aws.String(s.table),
+			Item:      item,
+		}})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	_, err := s.client.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	return err
+}
+
+// Delete deletes a key, deleting a missing key isn't an error
+func (s *DynamoDBStore) Delete(key string) error {
+	_, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			dynamoDBKey: {S: aws.String(key)},
+		},
+	})
+	return err
+}
+
+// Get reads the value of a key with a strongly consistent read,
+// ErrConfigNotFound when there's no such key
+func (s *DynamoDBStore) Get(key string) ([]byte, error) {
+	value, _, err := s.GetVersion(key)
+	return value, err
+}
+
+// GetVersion reads the value of a key and its version with a strongly
+// consistent read
+func (s *DynamoDBStore) GetVersion(key string) ([]byte, string, error) {
+	output, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			dynamoDBKey: {S: aws.String(key)},
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	value, ok := output.Item[dynamoDBValue]
+	if !ok || value.S == nil {
+		return nil, "", ErrConfigNotFound
+	}
+	version := dynamoDBUnversioned
+	if attribute, ok := output.Item[dynamoDBVersion]; ok && attribute.S != nil {
+		version = aws.StringValue(attribute.S)
+	}
+	return []byte(aws.StringValue(value.S)), version, nil
+}
+
+// List lists the keys starting with prefix, in order
+func (s *DynamoDBStore) List(prefix string) ([]string, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(s.table),
+		ProjectionExpression: aws.String("#key"),
+		ExpressionAttributeNames: map[string]*string{
+			"#key": aws.String(dynamoDBKey),
+		},
+	}
+	if prefix != "" {
+		input.FilterExpression = aws.String("begins_with(#key, :prefix)")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":prefix": {S: aws.String(prefix)},
+		}
+	}
+	keys := []string{}
+	err := s.client.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if key, ok := item[dynamoDBKey]; ok {
+				keys = append(keys, aws.StringValue(key.S))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// streamArn is the ARN of the latest stream of the table, empty when the
+// stream of the table isn't enabled
+func (s *DynamoDBStore) streamArn() (string, error) {
+	output, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(s.table)})
+	if err != nil {
+		return "", err
+	}
+	if spec := output.Table.StreamSpecification; spec == nil || !aws.BoolValue(spec.StreamEnabled) {
+		return "", nil
+	}
+	return aws.StringValue(output.Table.LatestStreamArn), nil
+}
+
+// Watch reads the value of a key again whenever the key changes. The stream
+// of the table is read from the first watch on.
+func (s *DynamoDBStore) Watch(key string, stopCh <-chan struct{}) (<-chan StoreEvent, error) {
+	s.startOnce.Do(func() { s.startErr = s.start() })
+	if s.startErr != nil {
+		return nil, s.startErr
+	}
+
+	// Changes coming while the config is read are coalesced, it's read
+	// again once afterwards
+	changeCh := make(chan struct{}, 1)
+	s.lock.Lock()
+	s.watches[key] = append(s.watches[key], changeCh)
+	s.lock.Unlock()
+
+	eventCh := make(chan StoreEvent)
+	go func() {
+		defer func() {
+			close(eventCh)
+			s.lock.Lock()
+			s.watches[key] = removeChannel(changeCh, s.watches[key])
+			if len(s.watches[key]) == 0 {
+				delete(s.watches, key)
+			}
+			s.lock.Unlock()
+		}()
+		send := func(event StoreEvent) bool {
+			select {
+			case eventCh <- event:
+				return true
+			case <-stopCh:
+				return false
+			}
+		}
+
+		var last []byte
+		found := false
+		for {
+			value, err := s.Get(key)
+			switch {
+			case err != nil && !found:
+				send(StoreEvent{Error: err})
+				return
+			case err == ErrConfigNotFound:
+				if last != nil {
+					last = nil
+					if !send(StoreEvent{}) {
+						return
+					}
+				}
+			case err != nil:
+				log.Printf("Error reading config, key=%s err=%s", key, err)
+			case last == nil || !bytes.Equal(last, value):
+				found = true
+				last = value
+				if !send(StoreEvent{Value: value}) {
+					return
+				}
+			}
+
+			select {
+			case <-changeCh:
+			case <-s.closeCh:
+				return
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return eventCh, nil
+}
+
+// start reads the stream of the table, or polls the watched configs when the
+// stream isn't enabled
+func (s *DynamoDBStore) start() error {
+	streamArn, err := s.streamArn()
+	if err != nil {
+		return err
+	}
+	if streamArn != "" {
+		go s.readStream(streamArn)
+		return nil
+	}
+	log.Printf("The stream of table %s isn't enabled, polling the configs every %s", s.table, dynamoDBPollInterval)
+	s.ticker = time.NewTicker(dynamoDBPollInterval)
+	go s.poll()
+	return nil
+}
+
+// notify notifies the watches of key of a change
+func (s *DynamoDBStore) notify(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, ch := range s.watches[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyAll notifies every watch
+func (s *DynamoDBStore) notifyAll() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, chs := range s.watches {
+		for _, ch := range chs {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// poll notifies every watch periodically, when the stream isn't enabled
+func (s *DynamoDBStore) poll() {
+	for {
+		select {
+		case <-s.ticker.C:
+			s.notifyAll()
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+// readStream reads the shards of the stream of the table, the shards open
+// when the store starts watching from their latest record and the shards
+// opened later from their first one
+func (s *DynamoDBStore) readStream(streamArn string) {
+	reading := make(map[string]bool)
+	started := false
+	for {
+		shards, err := s.shards(streamArn)
+		if err != nil {
+			log.Printf("Error describing stream %s, err=%s", streamArn, err)
+		}
+		for _, shard := range shards {
+			shardID := aws.StringValue(shard.ShardId)
+			if reading[shardID] {
+				continue
+			}
+			reading[shardID] = true
+			closed := shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil
+			if !started && closed {
+				continue
+			}
+			iteratorType := dynamodbstreams.ShardIteratorTypeTrimHorizon
+			if !started {
+				iteratorType = dynamodbstreams.ShardIteratorTypeLatest
+			}
+			go s.readShard(streamArn, shardID, iteratorType)
+		}
+		started = started || err == nil
+
+		select {
+		case <-time.After(dynamoDBShardsInterval):
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+// shards lists the shards of a stream
+func (s *DynamoDBStore) shards(streamArn string) ([]*dynamodbstreams.Shard, error) {
+	var shards []*dynamodbstreams.Shard
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(streamArn)}
+	for {
+		output, err := s.streams.DescribeStream(input)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, output.StreamDescription.Shards...)
+		if output.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = output.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// readShard notifies the watches of the keys changed in a shard, until the
+// shard is closed. On errors the shard is read again from its latest record,
+// and every watch reads its config again for the changes it may have missed.
+func (s *DynamoDBStore) readShard(streamArn string, shardID string, iteratorType string) {
+	for {
+		err := s.readRecords(streamArn, shardID, iteratorType)
+		if err == nil {
+			return
+		}
+		log.Printf("Error reading shard %s, err=%s", shardID, err)
+		select {
+		case <-time.After(dynamoDBShardsInterval):
+		case <-s.closeCh:
+			return
+		}
+		s.notifyAll()
+		iteratorType = dynamodbstreams.ShardIteratorTypeLatest
+	}
+}
+
+func (s *DynamoDBStore) readRecords(streamArn string, shardID string, iteratorType string) error {
+	output, err := s.streams.GetShardIterator(&dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(streamArn),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(iteratorType),
+	})
+	if err != nil {
+		return err
+	}
+
+	iterator := output.ShardIterator
+	for iterator != nil {
+		records, err := s.streams.GetRecords(&dynamodbstreams.GetRecordsInput{ShardIterator: iterator})
+		if err != nil {
+			return err
+		}
+		for _, record := range records.Records {
+			if key, ok := record.Dynamodb.Keys[dynamoDBKey]; ok {
+				s.notify(aws.StringValue(key.S))
+			}
+		}
+		iterator = records.NextShardIterator
+
+		select {
+		case <-time.After(dynamoDBRecordsInterval):
+		case <-s.closeCh:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *DynamoDBStore) History(key string) ([]*ConfigVersion, error) {
+	return nil, ErrHistoryNotSupported
+}
+
+func (s *DynamoDBStore) Close() {
+	if s.ticker != nil {
+		s.ticker.Stop()
+	}
+	close(s.closeCh)
+}
@@ -0,0 +1,154 @@
+package libprotoconf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// LeasePrefix starts the keys of the leases of the elections in the stores,
+// following the prefix of the configs: prefix + LeasePrefix + the name of the
+// election
+const LeasePrefix = ".leases/"
+
+// ErrElectionNotSupported is returned electing a leader among the clients of
+// a store which doesn't write keys on the condition of their versions
+var ErrElectionNotSupported = errors.New("the store doesn't write keys on the condition of their versions, electing a leader requires it")
+
+// lease is the lease of an election as it's kept in the store. The lease
+// expires when it isn't renewed for the duration of the election, as its
+// candidates observe it on their own clock.
+type lease struct {
+	Holder    string    `json:"holder"`
+	RenewedAt time.Time `json:"renewed_at"`
+}
+
+// Elect runs for the leader of the election of the lease kept at key among
+// the clients of store, as candidate, until ctx is done. While candidate
+// holds the lease, lead runs with a context canceled when the lease is lost.
+// The leader renews the lease every third of leaseDuration, and the other
+// candidates take it over once it wasn't renewed for leaseDuration. The
+// lease is released when ctx is done, so another candidate takes over at
+// once.
+func Elect(ctx context.Context, store Store, key string, candidate string, leaseDuration time.Duration, lead func(ctx context.Context)) error {
+	versioned, ok := store.(VersionedStore)
+	if !ok {
+		return ErrElectionNotSupported
+	}
+	e := &election{store: versioned, key: key, candidate: candidate, duration: leaseDuration}
+	ticker := time.NewTicker(leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		held, err := e.acquire()
+		if err != nil {
+			log.Printf("Error running for leader, key=%s err=%s", key, err)
+		}
+		if held {
+			log.Printf("Elected leader, key=%s candidate=%s", key, candidate)
+			e.lead(ctx, ticker.C, lead)
+			if ctx.Err() != nil {
+				e.release()
+				return ctx.Err()
+			}
+			log.Printf("Lost the lease, no longer the leader, key=%s candidate=%s", key, candidate)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+type election struct {
+	store     VersionedStore
+	key       string
+	candidate string
+	duration  time.Duration
+	// observed is the version of the lease last read or written, and
+	// observedAt when it was first seen
+	observed   string
+	observedAt time.Time
+}
+
+// acquire takes the lease when it's free or expired, or renews it when
+// the candidate holds it, and tells whether the candidate holds it
+func (e *election) acquire() (bool, error) {
+	current := &lease{}
+	data, version, err := e.store.GetVersion(e.key)
+	if err == ErrConfigNotFound {
+		version = ""
+	} else if err != nil {
+		return false, err
+	} else if err := json.Unmarshal(data, current); err != nil {
+		// A lease which can't be read is taken over as it expires
+		current.Holder = "?"
+	}
+	now := time.Now()
+	if version != e.observed || e.observedAt.IsZero() {
+		e.observed, e.observedAt = version, now
+	}
+	if current.Holder != "" && current.Holder != e.candidate && now.Sub(e.observedAt) < e.duration {
+		return false, nil
+	}
+	data, err = json.Marshal(&lease{Holder: e.candidate, RenewedAt: now.UTC()})
+	if err != nil {
+		return false, err
+	}
+	version, err = e.store.SetIfVersion(e.key, data, version)
+	if err == ErrVersionMismatch {
+		// Another candidate took or renewed it meanwhile
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	e.observed, e.observedAt = version, now
+	return true, nil
+}
+
+// lead runs lead while the candidate renews the lease, until ctx is done or
+// the lease is lost. A leader failing to renew the lease steps down before
+// the lease expires for the other candidates.
+func (e *election) lead(ctx context.Context, ticks <-chan time.Time, lead func(ctx context.Context)) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+		held, err := e.acquire()
+		if held {
+			renewedAt = time.Now()
+			continue
+		}
+		if err == nil || time.Since(renewedAt) >= e.duration/2 {
+			return
+		}
+		log.Printf("Error renewing the lease, key=%s err=%s", e.key, err)
+	}
+}
+
+// release frees the lease when the candidate still holds it
+func (e *election) release() {
+	data, err := json.Marshal(&lease{RenewedAt: time.Now().UTC()})
+	if err != nil {
+		return
+	}
+	if _, err := e.store.SetIfVersion(e.key, data, e.observed); err != nil && err != ErrVersionMismatch {
+		log.Printf("Error releasing the lease, key=%s err=%s", e.key, err)
+	}
+}
@@ -0,0 +1,81 @@
+package libprotoconf_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+)
+
+// candidate runs for the leader of an election, recording whether it leads
+type candidate struct {
+	lock    sync.Mutex
+	leading bool
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+func run(store libprotoconf.Store, name string, leaseDuration time.Duration) *candidate {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &candidate{cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		c.done <- libprotoconf.Elect(ctx, store, libprotoconf.LeasePrefix+"agents", name, leaseDuration, func(ctx context.Context) {
+			c.setLeading(true)
+			<-ctx.Done()
+			c.setLeading(false)
+		})
+	}()
+	return c
+}
+
+func (c *candidate) setLeading(leading bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.leading = leading
+}
+
+func (c *candidate) isLeading() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.leading
+}
+
+func (c *candidate) stop() error {
+	c.cancel()
+	return <-c.done
+}
+
+func TestElect(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	first := run(store, "first", 60*time.Millisecond)
+	assert.Eventually(t, first.isLeading, 5*time.Second, 5*time.Millisecond)
+	second := run(store, "second", 60*time.Millisecond)
+	defer second.stop()
+
+	// A single candidate leads while the leader renews the lease
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, first.isLeading())
+	assert.False(t, second.isLeading())
+
+	// The lease is released when the leader stops
+	assert.Equal(t, context.Canceled, first.stop())
+	assert.False(t, first.isLeading())
+	assert.Eventually(t, second.isLeading, 5*time.Second, 5*time.Millisecond)
+
+	// The leader steps down when another candidate takes the lease
+	data, version, err := store.GetVersion(libprotoconf.LeasePrefix + "agents")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "second")
+	_, err = store.SetIfVersion(libprotoconf.LeasePrefix+"agents", []byte(`{"holder": "third"}`), version)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return !second.isLeading() }, 5*time.Second, 5*time.Millisecond)
+	// and takes it over once it expires
+	assert.Eventually(t, second.isLeading, 5*time.Second, 5*time.Millisecond)
+
+	// The stores without versions can't elect a leader
+	unversioned := struct{ libprotoconf.Store }{store}
+	assert.Equal(t, libprotoconf.ErrElectionNotSupported, libprotoconf.Elect(context.Background(), unversioned, libprotoconf.LeasePrefix+"agents", "first", time.Second, nil))
+}
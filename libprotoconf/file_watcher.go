@@ -1,13 +1,20 @@
 package libprotoconf
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/tracing"
 	"github.com/protoconf/protoconf/utils"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 // NewFileWatcher creates a new file-backed protoconf watcher
@@ -26,6 +33,7 @@ func NewFileWatcher(protoconfRoot string) (Watcher, error) {
 		fsnotifyWatcher: fsnotifyWatcher,
 		protoconfRoot:   absRoot,
 		watches:         make(map[string]([]chan struct{})),
+		dirs:            make(map[string]int),
 	}
 
 	go watcher.readEvents()
@@ -33,11 +41,16 @@ func NewFileWatcher(protoconfRoot string) (Watcher, error) {
 	return watcher, nil
 }
 
+// fileWatcher watches the directories of the configs watched rather than the
+// files, so that configs replaced by renaming a new file over them, as
+// editors and git do, keep being watched
 type fileWatcher struct {
 	fsnotifyWatcher *fsnotify.Watcher
 	protoconfRoot   string
 	watches         map[string]([]chan struct{})
-	lock            sync.Mutex
+	// dirs counts the configs watched in each directory
+	dirs map[string]int
+	lock sync.Mutex
 }
 
 // Watch a value given its path
@@ -47,7 +60,9 @@ func (w *fileWatcher) Watch(path string, stopCh <-chan struct{}) (<-chan Result,
 	}
 
 	absPath := filepath.Join(w.protoconfRoot, consts.CompiledConfigPath, path+consts.CompiledConfigExtension)
-	fsCh := make(chan struct{})
+	// Events coming while the config is read are coalesced, it's read again
+	// once afterwards
+	fsCh := make(chan struct{}, 1)
 	if err := w.addWatch(absPath, fsCh); err != nil {
 		return nil, err
 	}
@@ -59,15 +74,27 @@ func (w *fileWatcher) Watch(path string, stopCh <-chan struct{}) (<-chan Result,
 			_ = w.removeWatch(absPath, fsCh)
 		}()
 
+		var last *anypb.Any
 		for {
+			_, span := tracing.Start(context.Background(), "file read", tracing.PathKey.String(path))
 			protoconfValue, err := utils.ReadConfig(w.protoconfRoot, path)
-			if err != nil {
-				watchCh <- Result{nil, err}
+			tracing.End(span, err)
+			switch {
+			case err != nil && last == nil:
+				if _, statErr := os.Stat(absPath); os.IsNotExist(statErr) {
+					err = fmt.Errorf("%w, path=%s", ErrConfigNotFound, path)
+				}
+				watchCh <- Result{Error: err, Span: span.SpanContext()}
 				return
+			case err != nil:
+				// The config may be read while it's being written, or
+				// between its removal and the creation of the new one, the
+				// next event reads it again
+			case !proto.Equal(protoconfValue.Value, last):
+				last = protoconfValue.Value
+				watchCh <- Result{Value: protoconfValue.Value, Span: span.SpanContext()}
 			}
 
-			watchCh <- Result{protoconfValue.Value, nil}
-
 			select {
 			case _, ok := <-fsCh:
 				if !ok {
@@ -86,11 +113,14 @@ func (w *fileWatcher) addWatch(path string, ch chan struct{}) error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	w.watches[path] = append(w.watches[path], ch)
-	if err := w.fsnotifyWatcher.Add(path); err != nil {
-		w.watches[path] = removeChannel(ch, w.watches[path])
-		return fmt.Errorf("error fs watching path %s, err=%s", path, err)
+	dir := filepath.Dir(path)
+	if w.dirs[dir] == 0 {
+		if err := w.fsnotifyWatcher.Add(dir); err != nil {
+			return fmt.Errorf("error fs watching path %s, err=%s", path, err)
+		}
 	}
+	w.dirs[dir]++
+	w.watches[path] = append(w.watches[path], ch)
 
 	return nil
 }
@@ -101,7 +131,12 @@ func (w *fileWatcher) removeWatch(path string, ch chan struct{}) error {
 
 	w.watches[path] = removeChannel(ch, w.watches[path])
 	if len(w.watches[path]) == 0 {
-		return w.fsnotifyWatcher.Remove(path)
+		delete(w.watches, path)
+	}
+	dir := filepath.Dir(path)
+	if w.dirs[dir]--; w.dirs[dir] <= 0 {
+		delete(w.dirs, dir)
+		return w.fsnotifyWatcher.Remove(dir)
 	}
 
 	return nil
@@ -126,10 +161,15 @@ func (w *fileWatcher) readEvents() {
 				w.closeWatchers()
 				return
 			}
-			if event.Op&fsnotify.Write == fsnotify.Write {
+			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				w.lock.Lock()
 				for _, channel := range w.watches[event.Name] {
-					channel <- struct{}{}
+					select {
+					case channel <- struct{}{}:
+					default:
+					}
 				}
+				w.lock.Unlock()
 			}
 		case <-w.fsnotifyWatcher.Errors:
 			w.closeWatchers()
@@ -138,15 +178,50 @@ func (w *fileWatcher) readEvents() {
 }
 
 func (w *fileWatcher) closeWatchers() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 	for _, pathWatches := range w.watches {
 		for _, watch := range pathWatches {
 			close(watch)
 		}
 	}
-	w.watches = nil
+	w.watches = make(map[string]([]chan struct{}))
+	w.dirs = make(map[string]int)
 }
 
 func (w *fileWatcher) Close() {
 	w.closeWatchers()
 	w.fsnotifyWatcher.Close()
 }
+
+// List lists the paths of the materialized configs starting with prefix, in
+// order
+func (w *fileWatcher) List(prefix string) ([]string, error) {
+	materializedDir := filepath.Join(w.protoconfRoot, consts.CompiledConfigPath)
+	paths := []string{}
+	err := filepath.Walk(materializedDir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filename == materializedDir {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(filename, consts.CompiledConfigExtension) {
+			return nil
+		}
+		rel, err := filepath.Rel(materializedDir, filename)
+		if err != nil {
+			return err
+		}
+		path := strings.TrimSuffix(filepath.ToSlash(rel), consts.CompiledConfigExtension)
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,84 @@
+package libprotoconf
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+func init() {
+	RegisterStore("gcs", NewGCSStore)
+}
+
+// NewGCSStore reads the materialized configs uploaded to a Google Cloud
+// Storage bucket, polling their generations. The credentials are the
+// application default credentials.
+func NewGCSStore(bucket string) (Store, error) {
+	if bucket == "" {
+		return nil, errors.New("the bucket of gcs must be set")
+	}
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return newObjectStore(&gcsBucket{client: client, bucket: client.Bucket(bucket)}), nil
+}
+
+type gcsBucket struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+}
+
+func (b *gcsBucket) Get(ctx context.Context, key string, version string) ([]byte, string, error) {
+	object := b.bucket.Object(key)
+	attrs, err := object.Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, "", ErrConfigNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	generation := strconv.FormatInt(attrs.Generation, 10)
+	if generation == version {
+		return nil, version, errObjectNotModified
+	}
+
+	// Read the generation checked, not a newer one written since
+	reader, err := object.Generation(attrs.Generation).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, "", ErrConfigNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, generation, nil
+}
+
+func (b *gcsBucket) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	objects := b.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, attrs.Name)
+	}
+}
+
+func (b *gcsBucket) Close() {
+	b.client.Close()
+}
@@ -0,0 +1,267 @@
+package libprotoconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryPrefix starts the keys the versions of the configs are kept under in
+// the stores without a history of their own: HistoryPrefix + key + "@" + the
+// number of the version
+const HistoryPrefix = ".history/"
+
+// RetentionStore is implemented by the stores keeping a history of their own
+// which can be bounded
+type RetentionStore interface {
+	// SetRetention keeps the last versions of every key written from now on,
+	// every version when versions is 0
+	SetRetention(versions int)
+}
+
+// WithHistory keeps the last retention versions of every key written to
+// store, for the stores without a history of their own. Their versions are
+// kept in the store under HistoryPrefix and numbered from 1 by key. The keys
+// kept by protoconf along with the configs, the keys with a part starting
+// with a dot, have no history. The stores keeping a history of their own are
+// returned as they are, their history bounded when they are RetentionStores.
+func WithHistory(store Store, retention int) Store {
+	if _, err := store.History(HistoryPrefix); err != ErrHistoryNotSupported {
+		if retaining, ok := store.(RetentionStore); ok {
+			retaining.SetRetention(retention)
+		}
+		return store
+	}
+	h := &historyStore{Store: store, retention: retention}
+	batch, isBatch := store.(BatchStore)
+	versioned, isVersioned := store.(VersionedStore)
+	switch {
+	case isBatch && isVersioned:
+		return struct {
+			*historyStore
+			*historyBatchStore
+			*historyVersionedStore
+		}{h, &historyBatchStore{h, batch}, &historyVersionedStore{h, versioned}}
+	case isBatch:
+		return struct {
+			*historyStore
+			*historyBatchStore
+		}{h, &historyBatchStore{h, batch}}
+	case isVersioned:
+		return struct {
+			*historyStore
+			*historyVersionedStore
+		}{h, &historyVersionedStore{h, versioned}}
+	default:
+		return h
+	}
+}
+
+// historyVersion is a version of a key as it's kept in the history
+type historyVersion struct {
+	Value     []byte    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type historyStore struct {
+	Store
+	retention int
+}
+
+func (s *historyStore) historyPrefix(key string) string {
+	return HistoryPrefix + key + "@"
+}
+
+// versions lists the keys of the versions of a key, the oldest first, and
+// the number of the last version
+func (s *historyStore) versions(key string) ([]string, int64, error) {
+	keys, err := s.Store.List(s.historyPrefix(key))
+	if err != nil || len(keys) == 0 {
+		return nil, 0, err
+	}
+	last, err := strconv.ParseInt(strings.TrimPrefix(keys[len(keys)-1], s.historyPrefix(key)), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid history key %s", keys[len(keys)-1])
+	}
+	return keys, last, nil
+}
+
+// hidden tells whether a key is kept by protoconf along with the configs,
+// such as the rollouts and the history itself
+func hidden(key string) bool {
+	for _, part := range strings.Split(key, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds a version of a key to its history, nil when the key was
+// deleted, and drops the versions beyond the retention
+func (s *historyStore) record(key string, value []byte) error {
+	if hidden(key) {
+		return nil
+	}
+	keys, last, err := s.versions(key)
+	if err != nil {
+		return fmt.Errorf("error reading history, key=%s err=%s", key, err)
+	}
+	data, err := json.Marshal(&historyVersion{Value: value, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	for attempt := int64(1); ; attempt++ {
+		versionKey := fmt.Sprintf("%s%020d", s.historyPrefix(key), last+attempt)
+		versioned, ok := s.Store.(VersionedStore)
+		if !ok {
+			err = s.Store.Set(versionKey, data)
+		} else if _, err = versioned.SetIfVersion(versionKey, data, ""); err == ErrVersionMismatch && attempt < 10 {
+			// Another writer of the key took the number
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("the value of %s was written but not kept in its history, err=%s", key, err)
+		}
+		keys = append(keys, versionKey)
+		break
+	}
+	for len(keys) > s.retention {
+		if err := s.Store.Delete(keys[0]); err != nil {
+			return fmt.Errorf("error dropping version from history, key=%s err=%s", keys[0], err)
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+func (s *historyStore) Set(key string, value []byte) error {
+	if err := s.Store.Set(key, value); err != nil {
+		return err
+	}
+	return s.record(key, value)
+}
+
+func (s *historyStore) Delete(key string) error {
+	if _, err := s.Store.Get(key); err == ErrConfigNotFound {
+		return nil
+	}
+	if err := s.Store.Delete(key); err != nil {
+		return err
+	}
+	return s.record(key, nil)
+}
+
+// History lists the versions of a key kept, the oldest first
+func (s *historyStore) History(key string) ([]*ConfigVersion, error) {
+	keys, _, err := s.versions(key)
+	if err != nil {
+		return nil, err
+	}
+	versions := []*ConfigVersion{}
+	for _, versionKey := range keys {
+		data, err := s.Store.Get(versionKey)
+		if err == ErrConfigNotFound {
+			// Dropped meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		number, err := strconv.ParseInt(strings.TrimPrefix(versionKey, s.historyPrefix(key)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history key %s", versionKey)
+		}
+		version := &historyVersion{}
+		if err := json.Unmarshal(data, version); err != nil {
+			return nil, fmt.Errorf("error reading history, key=%s err=%s", versionKey, err)
+		}
+		versions = append(versions, &ConfigVersion{Key: key, Version: number, Value: version.Value, CreatedAt: version.CreatedAt})
+	}
+	return versions, nil
+}
+
+type historyBatchStore struct {
+	history *historyStore
+	batch   BatchStore
+}
+
+func (s *historyBatchStore) SetAll(values map[string][]byte) error {
+	existing := make(map[string]bool)
+	for key, value := range values {
+		if value == nil {
+			_, err := s.batch.Get(key)
+			existing[key] = err == nil
+		}
+	}
+	if err := s.batch.SetAll(values); err != nil {
+		return err
+	}
+	for key, value := range values {
+		if value == nil && !existing[key] {
+			continue
+		}
+		if err := s.history.record(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type historyVersionedStore struct {
+	history   *historyStore
+	versioned VersionedStore
+}
+
+func (s *historyVersionedStore) GetVersion(key string) ([]byte, string, error) {
+	return s.versioned.GetVersion(key)
+}
+
+func (s *historyVersionedStore) SetIfVersion(key string, value []byte, version string) (string, error) {
+	newVersion, err := s.versioned.SetIfVersion(key, value, version)
+	if err != nil {
+		return "", err
+	}
+	return newVersion, s.history.record(key, value)
+}
+
+// PruneHistory drops the versions of every key beyond the last retention
+// versions from the history kept under HistoryPrefix by WithHistory, such as
+// the versions written before the retention was lowered, and returns how
+// many versions were dropped. The stores keeping a history of their own are
+// left as they are.
+func PruneHistory(store Store, retention int) (int, error) {
+	if _, err := store.History(HistoryPrefix); err != ErrHistoryNotSupported {
+		return 0, nil
+	}
+	keys, err := store.List(HistoryPrefix)
+	if err != nil {
+		return 0, err
+	}
+	// The keys of the versions of a key follow each other, the oldest first
+	versions := make(map[string][]string)
+	var order []string
+	for _, versionKey := range keys {
+		i := strings.LastIndex(versionKey, "@")
+		if i < 0 {
+			continue
+		}
+		key := versionKey[:i]
+		if versions[key] == nil {
+			order = append(order, key)
+		}
+		versions[key] = append(versions[key], versionKey)
+	}
+	dropped := 0
+	for _, key := range order {
+		for _, versionKey := range versions[key][:max(len(versions[key])-retention, 0)] {
+			if err := store.Delete(versionKey); err != nil {
+				return dropped, fmt.Errorf("error dropping version from history, key=%s err=%s", versionKey, err)
+			}
+			dropped++
+		}
+	}
+	return dropped, nil
+}
@@ -0,0 +1,222 @@
+package libprotoconf
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abronan/valkeyrie"
+	"github.com/abronan/valkeyrie/store"
+	"github.com/abronan/valkeyrie/store/consul"
+	etcd "github.com/abronan/valkeyrie/store/etcd/v2"
+	"github.com/abronan/valkeyrie/store/redis"
+	"github.com/protoconf/protoconf/consts"
+)
+
+type KVStore int
+
+const (
+	Consul KVStore = iota
+	Zookeeper
+	Etcd
+	Redis
+)
+
+// kvStoreNames are the names the key-value stores are registered by
+var kvStoreNames = map[KVStore]string{
+	Consul:    "consul",
+	Zookeeper: "zookeeper",
+	Etcd:      "etcd",
+	Redis:     "redis",
+}
+
+func init() {
+	consul.Register()
+	etcd.Register()
+	redis.Register()
+	RegisterStore(kvStoreNames[Consul], func(address string) (Store, error) {
+		return newValkeyrieStore(store.CONSUL, address, "")
+	})
+	RegisterStore(kvStoreNames[Etcd], func(address string) (Store, error) {
+		return newValkeyrieStore(store.ETCD, address, consts.EtcdDefaultAddress)
+	})
+	RegisterStore(kvStoreNames[Redis], func(address string) (Store, error) {
+		return newValkeyrieStore(store.REDIS, address, consts.RedisDefaultAddress)
+	})
+}
+
+// NewKVWatcher creates a new kv-backed Protoconf watcher
+func NewKVWatcher(kvType KVStore, address string, prefix string) (Watcher, error) {
+	name, ok := kvStoreNames[kvType]
+	if !ok {
+		return nil, fmt.Errorf("unknown kvType=%d", kvType)
+	}
+	store, err := OpenStore(name, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreWatcher(store, prefix), nil
+}
+
+// valkeyrieStore stores the configs in a key-value store supported by
+// valkeyrie
+type valkeyrieStore struct {
+	store store.Store
+}
+
+func newValkeyrieStore(backend store.Backend, address string, defaultAddress string) (Store, error) {
+	if address == "" {
+		address = defaultAddress
+	}
+	kvStore, err := valkeyrie.NewStore(backend, []string{address}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &valkeyrieStore{store: kvStore}, nil
+}
+
+func (s *valkeyrieStore) Get(key string) ([]byte, error) {
+	pair, err := s.store.Get(key, nil)
+	if err == store.ErrKeyNotFound {
+		return nil, ErrConfigNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(pair.Value) == 0 {
+		return nil, ErrConfigNotFound
+	}
+	return pair.Value, nil
+}
+
+func (s *valkeyrieStore) Set(key string, value []byte) error {
+	return s.store.Put(key, value, nil)
+}
+
+// GetVersion reads the value of a key and its version, the index of its last
+// modification in the store
+func (s *valkeyrieStore) GetVersion(key string) ([]byte, string, error) {
+	pair, err := s.store.Get(key, nil)
+	if err == store.ErrKeyNotFound {
+		return nil, "", ErrConfigNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(pair.Value) == 0 {
+		return nil, "", ErrConfigNotFound
+	}
+	return pair.Value, strconv.FormatUint(pair.LastIndex, 10), nil
+}
+
+// SetIfVersion writes the value of a key with an atomic put of the store,
+// failing when the key was modified since it was at version
+func (s *valkeyrieStore) SetIfVersion(key string, value []byte, version string) (string, error) {
+	var previous *store.KVPair
+	if version != "" {
+		pair, err := s.store.Get(key, nil)
+		if err == store.ErrKeyNotFound {
+			return "", ErrVersionMismatch
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(pair.Value) == 0 || strconv.FormatUint(pair.LastIndex, 10) != version {
+			return "", ErrVersionMismatch
+		}
+		previous = pair
+	}
+	_, pair, err := s.store.AtomicPut(key, value, previous, nil)
+	switch err {
+	case nil:
+		return strconv.FormatUint(pair.LastIndex, 10), nil
+	case store.ErrKeyModified, store.ErrKeyExists, store.ErrKeyNotFound:
+		return "", ErrVersionMismatch
+	default:
+		return "", err
+	}
+}
+
+func (s *valkeyrieStore) Delete(key string) error {
+	if err := s.store.Delete(key); err != nil && err != store.ErrKeyNotFound {
+		return err
+	}
+	return nil
+}
+
+func (s *valkeyrieStore) List(prefix string) ([]string, error) {
+	// Stores list directories, the keys of the directory of prefix are
+	// listed and filtered
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	pairs, err := s.store.List(dir, nil)
+	if err == store.ErrKeyNotFound {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, pair := range pairs {
+		// Some stores return keys with a leading slash
+		key := strings.TrimPrefix(pair.Key, "/")
+		if len(pair.Value) > 0 && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *valkeyrieStore) Watch(key string, stopCh <-chan struct{}) (<-chan StoreEvent, error) {
+	eventCh := make(chan StoreEvent)
+	go func() {
+		defer close(eventCh)
+		send := func(event StoreEvent) bool {
+			select {
+			case eventCh <- event:
+				return true
+			case <-stopCh:
+				return false
+			}
+		}
+
+		// Stores don't agree on watching missing keys, they are checked first
+		if _, err := s.Get(key); err != nil {
+			send(StoreEvent{Error: err})
+			return
+		}
+		kVWatchCh, err := s.store.Watch(key, stopCh, nil)
+		if err != nil {
+			send(StoreEvent{Error: err})
+			return
+		}
+		for {
+			select {
+			case kVPair, ok := <-kVWatchCh:
+				if !ok {
+					return
+				}
+				event := StoreEvent{}
+				if kVPair != nil && len(kVPair.Value) > 0 {
+					event.Value = kVPair.Value
+				}
+				if !send(event) {
+					return
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return eventCh, nil
+}
+
+func (s *valkeyrieStore) History(key string) ([]*ConfigVersion, error) {
+	return nil, ErrHistoryNotSupported
+}
+
+func (s *valkeyrieStore) Close() {
+	s.store.Close()
+}
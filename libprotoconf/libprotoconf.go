@@ -1,7 +1,10 @@
 package libprotoconf
 
 import (
-	"github.com/golang/protobuf/ptypes/any"
+	"path"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 // Watcher enables getting updates on protoconf paths
@@ -10,8 +13,54 @@ type Watcher interface {
 	Close()
 }
 
+// Lister is implemented by the watchers which can list the configs they
+// watch, by the paths starting with a prefix
+type Lister interface {
+	List(prefix string) ([]string, error)
+}
+
+// ClientWatcher is implemented by the watchers which may send each client its
+// own values of a config, such as the new values rolled out to some of the
+// clients or the values targeted to their labels
+type ClientWatcher interface {
+	Watcher
+	WatchClient(path string, client Client, stopCh <-chan struct{}) (<-chan Result, error)
+}
+
+// Client is a client watching configs
+type Client struct {
+	// ID is an opaque ID of the client
+	ID string
+	// Labels describe the client, e.g. its host, cluster or version
+	Labels map[string]string
+}
+
+// Matches tells whether the labels of the client match selector, every label
+// of selector is set on the client to a value it matches. The values of
+// selector are patterns as path.Match matches them, e.g. 2.* for every
+// version 2.
+func (c Client) Matches(selector map[string]string) bool {
+	for name, pattern := range selector {
+		value, ok := c.Labels[name]
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
 // Result of the Watch operation or error
 type Result struct {
-	Value *any.Any
+	Value *anypb.Any
 	Error error
+	// Span is the span of reading the value, which the spans of sending it
+	// to the subscribers of the config link to
+	Span trace.SpanContext
+	// Stale is set when the value is the last value of the config known,
+	// served as the config can't be read, such as while its store is
+	// unreachable
+	Stale bool
 }
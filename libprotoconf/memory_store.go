@@ -0,0 +1,331 @@
+package libprotoconf
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// MemoryStore keeps the configs in memory, for the tests of the applications
+// consuming them. The tests control when the watches see the changes, holding
+// them back and releasing them, and can fail the watches.
+type MemoryStore struct {
+	lock    sync.Mutex
+	values  map[string][]byte
+	history map[string][]*ConfigVersion
+	watches map[string][]*memoryWatch
+	held    bool
+	closed  bool
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		values:  make(map[string][]byte),
+		history: make(map[string][]*ConfigVersion),
+		watches: make(map[string][]*memoryWatch),
+	}
+}
+
+// memoryWatch queues the events of a watch, changes never wait for the
+// watches to read them
+type memoryWatch struct {
+	events []StoreEvent
+	// held are the events queued while the store holds them back
+	held    []StoreEvent
+	queued  chan struct{}
+	closeCh chan struct{}
+	closed  bool
+}
+
+func (w *memoryWatch) push(event StoreEvent) {
+	w.events = append(w.events, event)
+	select {
+	case w.queued <- struct{}{}:
+	default:
+	}
+}
+
+// close ends the watch once its queued events are sent
+func (w *memoryWatch) close() {
+	if !w.closed {
+		w.closed = true
+		close(w.closeCh)
+	}
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, ErrConfigNotFound
+	}
+	return value, nil
+}
+
+func (s *MemoryStore) Set(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[key] = value
+	s.record(key, value)
+	return nil
+}
+
+// GetVersion reads the value of a key and its version, the number of
+// versions of the key
+func (s *MemoryStore) GetVersion(key string) ([]byte, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, "", ErrConfigNotFound
+	}
+	return value, strconv.Itoa(len(s.history[key])), nil
+}
+
+// SetIfVersion writes the value of a key when the key is at version, an
+// empty version when there's no such key
+func (s *MemoryStore) SetIfVersion(key string, value []byte, version string) (string, error) {
+	if value == nil {
+		value = []byte{}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current := ""
+	if _, ok := s.values[key]; ok {
+		current = strconv.Itoa(len(s.history[key]))
+	}
+	if current != version {
+		return "", ErrVersionMismatch
+	}
+	s.values[key] = value
+	s.record(key, value)
+	return strconv.Itoa(len(s.history[key])), nil
+}
+
+// SetAll writes the values of keys at once, a nil value deletes its key
+func (s *MemoryStore) SetAll(values map[string][]byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, value := range values {
+		if value != nil {
+			s.values[key] = value
+			s.record(key, value)
+		} else if _, ok := s.values[key]; ok {
+			delete(s.values, key)
+			s.record(key, nil)
+		}
+	}
+	return nil
+}
+
+// SetConfig writes message as the config of key, encoded as protoconf insert
+// encodes it
+func (s *MemoryStore) SetConfig(key string, message proto.Message) error {
+	any, err := anypb.New(message)
+	if err != nil {
+		return err
+	}
+	value, err := EncodeConfig(&protoconfvalue.ProtoconfValue{
+		ProtoFile: message.ProtoReflect().Descriptor().ParentFile().Path(),
+		Value:     any,
+	})
+	if err != nil {
+		return err
+	}
+	return s.Set(key, value)
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.values[key]; !ok {
+		return nil
+	}
+	delete(s.values, key)
+	s.record(key, nil)
+	return nil
+}
+
+// record adds a version of key and sends it to the watches of key
+func (s *MemoryStore) record(key string, value []byte) {
+	versions := s.history[key]
+	s.history[key] = append(versions, &ConfigVersion{
+		Key:       key,
+		Version:   int64(len(versions) + 1),
+		Value:     value,
+		CreatedAt: time.Now().UTC(),
+	})
+	for _, watch := range s.watches[key] {
+		if s.held {
+			watch.held = append(watch.held, StoreEvent{Value: value})
+		} else {
+			watch.push(StoreEvent{Value: value})
+		}
+	}
+}
+
+func (s *MemoryStore) List(prefix string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	keys := []string{}
+	for key := range s.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *MemoryStore) Watch(key string, stopCh <-chan struct{}) (<-chan StoreEvent, error) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil, errors.New("the store is closed")
+	}
+	watch := &memoryWatch{
+		queued:  make(chan struct{}, 1),
+		closeCh: make(chan struct{}),
+	}
+	if value, ok := s.values[key]; ok {
+		watch.push(StoreEvent{Value: value})
+		s.watches[key] = append(s.watches[key], watch)
+	} else {
+		watch.push(StoreEvent{Error: ErrConfigNotFound})
+		watch.close()
+	}
+	s.lock.Unlock()
+
+	eventCh := make(chan StoreEvent)
+	go func() {
+		defer func() {
+			close(eventCh)
+			s.lock.Lock()
+			watches := s.watches[key]
+			for i, w := range watches {
+				if w == watch {
+					s.watches[key] = append(watches[:i], watches[i+1:]...)
+					break
+				}
+			}
+			if len(s.watches[key]) == 0 {
+				delete(s.watches, key)
+			}
+			s.lock.Unlock()
+		}()
+
+		for {
+			s.lock.Lock()
+			var event StoreEvent
+			pending := len(watch.events) > 0
+			if pending {
+				event = watch.events[0]
+				watch.events = watch.events[1:]
+			}
+			s.lock.Unlock()
+
+			if pending {
+				select {
+				case eventCh <- event:
+				case <-stopCh:
+					return
+				}
+				if event.Error != nil {
+					return
+				}
+				continue
+			}
+
+			select {
+			case <-watch.queued:
+			case <-watch.closeCh:
+				s.lock.Lock()
+				empty := len(watch.events) == 0
+				s.lock.Unlock()
+				if empty {
+					return
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return eventCh, nil
+}
+
+// History lists the versions of a key since the store was created
+func (s *MemoryStore) History(key string) ([]*ConfigVersion, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	versions := make([]*ConfigVersion, len(s.history[key]))
+	copy(versions, s.history[key])
+	return versions, nil
+}
+
+// Hold holds the changes back from the watches until Release, the configs
+// are changed in the store still
+func (s *MemoryStore) Hold() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.held = true
+}
+
+// Release sends the changes held back to the watches, in order
+func (s *MemoryStore) Release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.held = false
+	for _, watches := range s.watches {
+		for _, watch := range watches {
+			for _, event := range watch.held {
+				watch.push(event)
+			}
+			watch.held = nil
+		}
+	}
+}
+
+// Fail sends err to the watches of key, as a store failing would, which
+// ends them
+func (s *MemoryStore) Fail(key string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, watch := range s.watches[key] {
+		watch.push(StoreEvent{Error: err})
+		watch.close()
+	}
+	delete(s.watches, key)
+}
+
+// Watching is the number of watches of key, for the tests to wait for a
+// config to be subscribed to
+func (s *MemoryStore) Watching(key string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.watches[key])
+}
+
+// Close ends every watch
+func (s *MemoryStore) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	for _, watches := range s.watches {
+		for _, watch := range watches {
+			watch.close()
+		}
+	}
+	s.watches = make(map[string][]*memoryWatch)
+}
@@ -0,0 +1,209 @@
+package libprotoconf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/consts"
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/utils"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// objectStorePollInterval is how often the watched configs are checked for a
+// new version
+const objectStorePollInterval = 10 * time.Second
+
+// objectStoreTimeout is the timeout of every request to the object store
+const objectStoreTimeout = 30 * time.Second
+
+var errObjectNotModified = errors.New("object not modified")
+
+// objectBucket is a bucket of an object store holding materialized configs
+type objectBucket interface {
+	// Get reads an object and its version, an ETag or a generation, or
+	// returns ErrConfigNotFound. Objects still at version aren't read again,
+	// errObjectNotModified is returned.
+	Get(ctx context.Context, key string, version string) ([]byte, string, error)
+	// List lists the keys of the objects starting with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+	Close()
+}
+
+// objectStore reads the materialized configs uploaded to a bucket, as they
+// are in the materialized_config dir, by the keys of the configs without
+// the extension. Configs are watched by polling their version, the store is
+// read-only.
+type objectStore struct {
+	bucket   objectBucket
+	interval time.Duration
+}
+
+func newObjectStore(bucket objectBucket) *objectStore {
+	return &objectStore{
+		bucket:   bucket,
+		interval: objectStorePollInterval,
+	}
+}
+
+func (s *objectStore) Get(key string) ([]byte, error) {
+	value, _, err := s.read(key, "")
+	return value, err
+}
+
+func (s *objectStore) Set(key string, value []byte) error {
+	return ErrReadOnly
+}
+
+func (s *objectStore) Delete(key string) error {
+	return ErrReadOnly
+}
+
+// read reads the config of key unless it's still at version, decoding it with
+// the descriptors recorded in it or in the descriptor set uploaded next to it,
+// and encodes it as it's written to the stores
+func (s *objectStore) read(key string, version string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), objectStoreTimeout)
+	defer cancel()
+
+	objectKey := key + consts.CompiledConfigExtension
+	data, newVersion, err := s.bucket.Get(ctx, objectKey, version)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var recorded struct {
+		Descriptors json.RawMessage `json:"descriptors"`
+	}
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, "", fmt.Errorf("error decoding config key=%s err=%s", objectKey, err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if recorded.Descriptors != nil {
+		if err := protojson.Unmarshal(recorded.Descriptors, set); err != nil {
+			return nil, "", fmt.Errorf("error decoding the descriptors of config key=%s err=%s", objectKey, err)
+		}
+	} else {
+		descriptorSetKey := key + consts.DescriptorSetExtension
+		descriptorSet, _, err := s.bucket.Get(ctx, descriptorSetKey, "")
+		if err == ErrConfigNotFound {
+			return nil, "", fmt.Errorf("no descriptors for config key=%s, compile it with -descriptors inline or file", objectKey)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if err := proto.Unmarshal(descriptorSet, set); err != nil {
+			return nil, "", fmt.Errorf("error decoding descriptors key=%s err=%s", descriptorSetKey, err)
+		}
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading the descriptors of config key=%s err=%s", objectKey, err)
+	}
+	var fileDescriptors []protoreflect.FileDescriptor
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		fileDescriptors = append(fileDescriptors, file)
+		return true
+	})
+
+	protoconfValue := &protoconfvalue.ProtoconfValue{}
+	um := protojson.UnmarshalOptions{Resolver: utils.NewAnyResolver(fileDescriptors...)}
+	if err := um.Unmarshal(data, protoconfValue); err != nil {
+		return nil, "", fmt.Errorf("error unmarshaling config key=%s err=%s", objectKey, err)
+	}
+	value, err := EncodeConfig(protoconfValue)
+	if err != nil {
+		return nil, "", err
+	}
+	return value, newVersion, nil
+}
+
+func (s *objectStore) List(prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), objectStoreTimeout)
+	defer cancel()
+
+	objectKeys, err := s.bucket.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, objectKey := range objectKeys {
+		if strings.HasSuffix(objectKey, consts.CompiledConfigExtension) {
+			keys = append(keys, strings.TrimSuffix(objectKey, consts.CompiledConfigExtension))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *objectStore) Watch(key string, stopCh <-chan struct{}) (<-chan StoreEvent, error) {
+	eventCh := make(chan StoreEvent)
+	go func() {
+		defer close(eventCh)
+		send := func(event StoreEvent) bool {
+			select {
+			case eventCh <- event:
+				return true
+			case <-stopCh:
+				return false
+			}
+		}
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		version := ""
+		found := false
+		for {
+			value, newVersion, err := s.read(key, version)
+			switch {
+			case err == errObjectNotModified:
+			case err != nil && !found:
+				send(StoreEvent{Error: err})
+				return
+			case err == ErrConfigNotFound:
+				if version != "" {
+					version = ""
+					if !send(StoreEvent{}) {
+						return
+					}
+				}
+			case err != nil:
+				// The last value is kept until the config can be read again
+				log.Printf("Error reading config, key=%s err=%s", key, err)
+			default:
+				found = true
+				version = newVersion
+				if !send(StoreEvent{Value: value}) {
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return eventCh, nil
+}
+
+func (s *objectStore) History(key string) ([]*ConfigVersion, error) {
+	return nil, ErrHistoryNotSupported
+}
+
+func (s *objectStore) Close() {
+	s.bucket.Close()
+}
@@ -0,0 +1,82 @@
+package libprotoconf
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func init() {
+	RegisterStore("s3", NewS3Store)
+}
+
+// NewS3Store reads the materialized configs uploaded to an S3 bucket,
+// polling their ETags. The credentials and the region are read from the
+// environment and the shared AWS config.
+func NewS3Store(bucket string) (Store, error) {
+	if bucket == "" {
+		return nil, errors.New("the bucket of s3 must be set")
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, err
+	}
+	return newObjectStore(&s3Bucket{client: s3.New(sess), bucket: bucket}), nil
+}
+
+type s3Bucket struct {
+	client *s3.S3
+	bucket string
+}
+
+func (b *s3Bucket) Get(ctx context.Context, key string, version string) ([]byte, string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}
+	if version != "" {
+		input.IfNoneMatch = aws.String(version)
+	}
+	output, err := b.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		if failure, ok := err.(awserr.RequestFailure); ok {
+			switch failure.StatusCode() {
+			case http.StatusNotModified:
+				return nil, version, errObjectNotModified
+			case http.StatusNotFound:
+				return nil, "", ErrConfigNotFound
+			}
+		}
+		return nil, "", err
+	}
+	defer output.Body.Close()
+
+	data, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, aws.StringValue(output.ETag), nil
+}
+
+func (b *s3Bucket) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(prefix),
+	}
+	err := b.client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	return keys, err
+}
+
+func (b *s3Bucket) Close() {}
@@ -0,0 +1,422 @@
+package libprotoconf
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	// Registers the postgres driver
+	"github.com/lib/pq"
+	// Registers the sqlite driver
+	_ "modernc.org/sqlite"
+)
+
+// The SQL drivers configs can be stored with
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+// pqUniqueViolation is the code of the Postgres errors of duplicate keys
+const pqUniqueViolation = "23505"
+
+// sqlWriteAttempts is how many times the values of SetAll are written when
+// other writes of their keys run concurrently
+const sqlWriteAttempts = 5
+
+// sqlPollInterval is how often the watched configs are checked for a new
+// version
+const sqlPollInterval = 5 * time.Second
+
+func init() {
+	for _, driver := range []string{SQLite, Postgres} {
+		driver := driver
+		RegisterStore(driver, func(dataSource string) (Store, error) {
+			if dataSource == "" {
+				return nil, fmt.Errorf("the data source of %s must be set", driver)
+			}
+			return OpenSQLStore(driver, dataSource)
+		})
+	}
+}
+
+// sqlSchema creates the table of the versions of the configs. Every write
+// adds a version of a key, deletions add a version with a NULL value.
+const sqlSchema = `CREATE TABLE IF NOT EXISTS protoconf_versions (
+	key VARCHAR(1024) NOT NULL,
+	version BIGINT NOT NULL,
+	value TEXT,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (key, version)
+)`
+
+// SQLStore stores the configs in a SQLite or Postgres database, keeping
+// every version of every key unless its retention is set
+type SQLStore struct {
+	db           *sql.DB
+	driver       string
+	pollInterval time.Duration
+	retention    int
+}
+
+// OpenSQLStore opens the database of dataSource with driver, SQLite or
+// Postgres, creating the table of the versions of the configs when needed
+func OpenSQLStore(driver string, dataSource string) (*SQLStore, error) {
+	if driver != SQLite && driver != Postgres {
+		return nil, fmt.Errorf("unknown SQL driver %s", driver)
+	}
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	if driver == SQLite {
+		// Writes to SQLite are serialized anyway, a single connection
+		// avoids failing on a locked database
+		db.SetMaxOpenConns(1)
+	}
+	if _, err := db.Exec(sqlSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating the versions table, err=%s", err)
+	}
+	return &SQLStore{db: db, driver: driver, pollInterval: sqlPollInterval}, nil
+}
+
+// query rewrites the `?' placeholders of query for the driver
+func (s *SQLStore) query(query string) string {
+	if s.driver != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// SetPollInterval sets how often the watched configs are checked for a new
+// version
+func (s *SQLStore) SetPollInterval(interval time.Duration) {
+	s.pollInterval = interval
+}
+
+// SetRetention keeps the last versions of every key written from now on,
+// every version when versions is 0
+func (s *SQLStore) SetRetention(versions int) {
+	s.retention = versions
+}
+
+// SetAll writes new versions of keys in one transaction, either every value
+// is written or none is. A nil value deletes its key.
+func (s *SQLStore) SetAll(values map[string][]byte) error {
+	var err error
+	for attempt := 0; attempt < sqlWriteAttempts; attempt++ {
+		// A concurrent transaction wrote the same version of a key first, the
+		// values are written again over it
+		if err = s.setAll(values); !isUniqueViolation(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("error writing keys written concurrently, attempts=%d err=%s", sqlWriteAttempts, err)
+}
+
+// setAll writes new versions of keys in one transaction, failing with the
+// error of the driver when a version is written concurrently
+func (s *SQLStore) setAll(values map[string][]byte) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for key, value := range values {
+		version, exists, err := s.lastVersion(tx, key)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if value == nil && !exists {
+			// Deleting a missing key
+			continue
+		}
+		if err := s.insertVersion(tx, key, version+1, value, now); err != nil {
+			tx.Rollback()
+			if isUniqueViolation(err) {
+				return err
+			}
+			return fmt.Errorf("error writing key=%s err=%s", key, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// SetIfVersion writes a new version of a key when version is the last
+// version of the key, or when the key was never written or is deleted for an
+// empty version, and returns the new version
+func (s *SQLStore) SetIfVersion(key string, value []byte, version string) (string, error) {
+	if value == nil {
+		value = []byte{}
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	last, exists, err := s.lastVersion(tx, key)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	current := ""
+	if exists {
+		current = strconv.FormatInt(last, 10)
+	}
+	if current != version {
+		tx.Rollback()
+		return "", ErrVersionMismatch
+	}
+	if err := s.insertVersion(tx, key, last+1, value, time.Now().UTC()); err != nil {
+		tx.Rollback()
+		// A concurrent transaction wrote the same version first
+		if isUniqueViolation(err) {
+			return "", ErrVersionMismatch
+		}
+		return "", fmt.Errorf("error writing key=%s err=%s", key, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(last+1, 10), nil
+}
+
+// isUniqueViolation tells whether err is the error of Postgres writing a
+// version of a key which exists
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == pqUniqueViolation
+}
+
+// lastVersion reads the last version of a key in tx, 0 when the key was never
+// written, and whether the key exists, which it doesn't once deleted
+func (s *SQLStore) lastVersion(tx *sql.Tx, key string) (int64, bool, error) {
+	var version int64
+	var value sql.NullString
+	err := tx.QueryRow(s.query("SELECT version, value FROM protoconf_versions WHERE key = ? ORDER BY version DESC LIMIT 1"), key).Scan(&version, &value)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return version, value.Valid, nil
+}
+
+// insertVersion adds a version of a key in tx, a nil value deletes the key,
+// and drops the versions of the key beyond the retention
+func (s *SQLStore) insertVersion(tx *sql.Tx, key string, version int64, value []byte, createdAt time.Time) error {
+	var text sql.NullString
+	if value != nil {
+		text = sql.NullString{String: string(value), Valid: true}
+	}
+	if _, err := tx.Exec(s.query("INSERT INTO protoconf_versions (key, version, value, created_at) VALUES (?, ?, ?, ?)"), key, version, text, createdAt); err != nil {
+		return err
+	}
+	if s.retention <= 0 {
+		return nil
+	}
+	_, err := tx.Exec(s.query("DELETE FROM protoconf_versions WHERE key = ? AND version <= ?"), key, version-int64(s.retention))
+	return err
+}
+
+// Set writes a new version of a key
+func (s *SQLStore) Set(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	return s.SetAll(map[string][]byte{key: value})
+}
+
+// Delete deletes a key, keeping its history
+func (s *SQLStore) Delete(key string) error {
+	if _, err := s.last(key); err == ErrConfigNotFound {
+		return nil
+	}
+	return s.SetAll(map[string][]byte{key: nil})
+}
+
+// GetVersion reads the last value of a key and its version number
+func (s *SQLStore) GetVersion(key string) ([]byte, string, error) {
+	version, err := s.last(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return version.Value, strconv.FormatInt(version.Version, 10), nil
+}
+
+// Get reads the last value of a key, ErrConfigNotFound when the key was
+// never written or is deleted
+func (s *SQLStore) Get(key string) ([]byte, error) {
+	version, err := s.last(key)
+	if err != nil {
+		return nil, err
+	}
+	return version.Value, nil
+}
+
+// last reads the last version of a key, ErrConfigNotFound when the key was
+// never written or is deleted
+func (s *SQLStore) last(key string) (*ConfigVersion, error) {
+	row := s.db.QueryRow(s.query("SELECT key, version, value, created_at FROM protoconf_versions WHERE key = ? ORDER BY version DESC LIMIT 1"), key)
+	version, err := scanVersion(row)
+	if err == sql.ErrNoRows || (err == nil && version.Value == nil) {
+		return nil, ErrConfigNotFound
+	}
+	return version, err
+}
+
+// History lists the versions of a key, the oldest first
+func (s *SQLStore) History(key string) ([]*ConfigVersion, error) {
+	rows, err := s.db.Query(s.query("SELECT key, version, value, created_at FROM protoconf_versions WHERE key = ? ORDER BY version"), key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []*ConfigVersion{}
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// List lists the keys starting with prefix which aren't deleted, in order
+func (s *SQLStore) List(prefix string) ([]string, error) {
+	// The keys starting with prefix are the keys from prefix to the end of
+	// the prefix range, compared byte by byte. SQLite compares the strings
+	// byte by byte, Postgres by the collation of the database unless told
+	// otherwise.
+	key := "v.key"
+	if s.driver == Postgres {
+		key = `v.key COLLATE "C"`
+	}
+	where, args := key+" >= ?", []interface{}{prefix}
+	if end := prefixEnd(prefix); end != "" {
+		where, args = where+" AND "+key+" < ?", append(args, end)
+	}
+	rows, err := s.db.Query(s.query(`SELECT v.key FROM protoconf_versions v
+		WHERE `+where+` AND v.value IS NOT NULL
+		AND v.version = (SELECT MAX(version) FROM protoconf_versions WHERE key = v.key)
+		ORDER BY v.key`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// prefixEnd returns the first string after the strings starting with prefix,
+// prefix with its last character incremented, or "" when every string after
+// prefix starts with it. UTF-8 strings compared byte by byte are in the order
+// of their characters.
+func prefixEnd(prefix string) string {
+	runes := []rune(prefix)
+	for i := len(runes) - 1; i >= 0; i-- {
+		next := runes[i] + 1
+		if next >= 0xD800 && next <= 0xDFFF {
+			// The surrogates aren't valid characters
+			next = 0xE000
+		}
+		if next <= utf8.MaxRune {
+			return string(append(runes[:i], next))
+		}
+	}
+	return ""
+}
+
+// Watch polls the last version of a key
+func (s *SQLStore) Watch(key string, stopCh <-chan struct{}) (<-chan StoreEvent, error) {
+	eventCh := make(chan StoreEvent)
+	go func() {
+		defer close(eventCh)
+		send := func(event StoreEvent) bool {
+			select {
+			case eventCh <- event:
+				return true
+			case <-stopCh:
+				return false
+			}
+		}
+
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+
+		var version int64
+		found := false
+		for {
+			last, err := s.last(key)
+			switch {
+			case err != nil && !found:
+				send(StoreEvent{Error: err})
+				return
+			case err == ErrConfigNotFound:
+				if version != 0 {
+					version = 0
+					if !send(StoreEvent{}) {
+						return
+					}
+				}
+			case err != nil:
+				log.Printf("Error reading config, key=%s err=%s", key, err)
+			case last.Version != version:
+				found = true
+				version = last.Version
+				if !send(StoreEvent{Value: last.Value}) {
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return eventCh, nil
+}
+
+func (s *SQLStore) Close() {
+	s.db.Close()
+}
+
+func scanVersion(row interface{ Scan(...interface{}) error }) (*ConfigVersion, error) {
+	version := &ConfigVersion{}
+	var value sql.NullString
+	if err := row.Scan(&version.Key, &version.Version, &value, &version.CreatedAt); err != nil {
+		return nil, err
+	}
+	if value.Valid {
+		version.Value = []byte(value.String)
+	}
+	return version, nil
+}
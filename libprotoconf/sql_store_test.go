@@ -0,0 +1,137 @@
+package libprotoconf
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestSQLStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql_store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenSQLStore(SQLite, filepath.Join(dir, "configs.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, store.SetAll(map[string][]byte{"services/api": []byte("v1"), "services/web": []byte("v1")}))
+	assert.NoError(t, store.SetAll(map[string][]byte{"services/api": []byte("v2"), "global": []byte("v1")}))
+
+	value, err := store.Get("services/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(value))
+
+	keys, err := store.List("services/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/api", "services/web"}, keys)
+
+	// The prefixes are matched byte by byte
+	assert.NoError(t, store.SetAll(map[string][]byte{"café/api": []byte("v1"), "cafe/api": []byte("v1"), "caféx": []byte("v1")}))
+	keys, err = store.List("café/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"café/api"}, keys)
+	keys, err = store.List("caf")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cafe/api", "café/api", "caféx"}, keys)
+	for _, key := range []string{"café/api", "cafe/api", "caféx"} {
+		assert.NoError(t, store.Delete(key))
+	}
+
+	assert.NoError(t, store.Delete("services/web"))
+	_, err = store.Get("services/web")
+	assert.Equal(t, ErrConfigNotFound, err)
+	keys, err = store.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"global", "services/api"}, keys)
+
+	history, err := store.History("services/web")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "v1", string(history[0].Value))
+	assert.Nil(t, history[1].Value)
+	assert.Equal(t, int64(2), history[1].Version)
+
+	store.SetRetention(2)
+	assert.NoError(t, store.Set("services/api", []byte("v3")))
+	history, err = store.History("services/api")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "v2", string(history[0].Value))
+	assert.Equal(t, "v3", string(history[1].Value))
+
+	_, err = store.Get("missing")
+	assert.Equal(t, ErrConfigNotFound, err)
+	_, err = OpenSQLStore("mysql", "")
+	assert.Error(t, err)
+}
+
+func TestPrefixEnd(t *testing.T) {
+	assert.Equal(t, "services0", prefixEnd("services/"))
+	assert.Equal(t, "caf\u00ea", prefixEnd("caf\u00e9"))
+	assert.Equal(t, "a\ue000", prefixEnd("a\ud7ff"))
+	assert.Equal(t, "b", prefixEnd("a\U0010ffff"))
+	assert.Equal(t, "", prefixEnd("\U0010ffff"))
+	assert.Equal(t, "", prefixEnd(""))
+}
+
+func TestSQLStoreWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql_watcher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dataSource := filepath.Join(dir, "configs.db")
+	store, err := OpenSQLStore(SQLite, dataSource)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	put := func(key string, value string) {
+		any, err := anypb.New(wrapperspb.String(value))
+		assert.NoError(t, err)
+		data, err := proto.Marshal(&protoconfvalue.ProtoconfValue{ProtoFile: "google/protobuf/wrappers.proto", Value: any})
+		assert.NoError(t, err)
+		assert.NoError(t, store.Set(key, []byte(base64.StdEncoding.EncodeToString(data))))
+	}
+	put("protoconf/services/api", "first")
+
+	store.SetPollInterval(10 * time.Millisecond)
+	watcher := NewStoreWatcher(store, "protoconf/")
+
+	paths, err := watcher.(Lister).List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/api"}, paths)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watchCh, err := watcher.Watch("services/api", stopCh)
+	assert.NoError(t, err)
+	read := func() string {
+		select {
+		case result := <-watchCh:
+			assert.NoError(t, result.Error)
+			value := &wrapperspb.StringValue{}
+			assert.NoError(t, result.Value.UnmarshalTo(value))
+			return value.GetValue()
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the config")
+		}
+		return ""
+	}
+	assert.Equal(t, "first", read())
+	put("protoconf/services/api", "second")
+	assert.Equal(t, "second", read())
+
+	missingCh, err := watcher.Watch("missing", stopCh)
+	assert.NoError(t, err)
+	result := <-missingCh
+	assert.Error(t, result.Error)
+}
@@ -0,0 +1,131 @@
+package libprotoconf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrConfigNotFound is returned when reading a config which was never
+	// written or was deleted
+	ErrConfigNotFound = errors.New("config not found")
+	// ErrHistoryNotSupported is returned by the stores which don't keep the
+	// previous versions of the configs
+	ErrHistoryNotSupported = errors.New("history isn't supported by the store")
+	// ErrReadOnly is returned when writing to a store the configs can only be
+	// read from
+	ErrReadOnly = errors.New("the store is read-only")
+	// ErrVersionMismatch is returned when writing a config on the condition
+	// of a version which isn't its current version, as it was changed since
+	// it was read
+	ErrVersionMismatch = errors.New("the config was changed since it was read")
+)
+
+// Store stores the configs by key, as they are inserted: base64 encoded
+// ProtoconfValues. Stores are used concurrently.
+type Store interface {
+	// Get reads the value of a key, ErrConfigNotFound when there's no such key
+	Get(key string) ([]byte, error)
+	// Set writes the value of a key
+	Set(key string, value []byte) error
+	// Delete deletes a key, deleting a missing key isn't an error
+	Delete(key string) error
+	// List lists the keys starting with prefix, in order
+	List(prefix string) ([]string, error)
+	// Watch sends the value of a key, then its new values as the key
+	// changes until stopCh is closed, and closes the channel. Deletions are
+	// sent as events without a value. The error of the first event is
+	// ErrConfigNotFound when there's no such key.
+	Watch(key string, stopCh <-chan struct{}) (<-chan StoreEvent, error)
+	// History lists the versions of a key, the oldest first, or returns
+	// ErrHistoryNotSupported
+	History(key string) ([]*ConfigVersion, error)
+	Close()
+}
+
+// BatchStore is implemented by the stores writing several keys in one
+// transaction, either every key is written or none is
+type BatchStore interface {
+	Store
+	// SetAll writes the values of keys in one transaction, a nil value
+	// deletes its key
+	SetAll(values map[string][]byte) error
+}
+
+// VersionedStore is implemented by the stores writing a key on the condition
+// that it's still at the version it was read at, so that concurrent writers
+// don't overwrite each other's changes. Versions are opaque tokens, a key
+// written again never gets a version it had before.
+type VersionedStore interface {
+	Store
+	// GetVersion reads the value of a key and its version,
+	// ErrConfigNotFound when there's no such key
+	GetVersion(key string) ([]byte, string, error)
+	// SetIfVersion writes the value of a key when the key is at version, or
+	// when there's no such key for an empty version, and returns the new
+	// version of the key. It returns ErrVersionMismatch when the key is at
+	// another version.
+	SetIfVersion(key string, value []byte, version string) (string, error)
+}
+
+// StoreEvent is a value of a watched key or an error
+type StoreEvent struct {
+	Value []byte
+	Error error
+}
+
+// ConfigVersion is a version of the value of a key
+type ConfigVersion struct {
+	Key     string
+	Version int64
+	// Value is the config as it's inserted, nil when the config was deleted
+	Value     []byte
+	CreatedAt time.Time
+}
+
+// StoreFactory opens a store, address is the address of the store as it's
+// passed with -store-address and may be empty
+type StoreFactory func(address string) (Store, error)
+
+var (
+	storesLock sync.Mutex
+	stores     = make(map[string]StoreFactory)
+)
+
+// RegisterStore registers a store by the name it's chosen with -store,
+// typically from the init function of the package implementing it. Stores
+// registered twice panic.
+func RegisterStore(name string, factory StoreFactory) {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+	if _, ok := stores[name]; ok {
+		panic(fmt.Sprintf("store %s is registered twice", name))
+	}
+	stores[name] = factory
+}
+
+// OpenStore opens a registered store
+func OpenStore(name string, address string) (Store, error) {
+	storesLock.Lock()
+	factory, ok := stores[name]
+	storesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store %s, expected one of %v", name, Stores())
+	}
+	return factory(address)
+}
+
+// Stores lists the names of the registered stores, in order
+func Stores() []string {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
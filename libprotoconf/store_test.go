@@ -0,0 +1,182 @@
+package libprotoconf_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/libprotoconf/storetest"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestSQLiteStoreContract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := libprotoconf.OpenStore(libprotoconf.SQLite, filepath.Join(dir, "configs.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+	store.(*libprotoconf.SQLStore).SetPollInterval(10 * time.Millisecond)
+
+	storetest.Run(t, store)
+}
+
+func TestMemoryStoreContract(t *testing.T) {
+	storetest.Run(t, libprotoconf.NewMemoryStore())
+}
+
+// noHistory hides the history of a store, as the stores without a history of
+// their own do
+type noHistory struct {
+	*libprotoconf.MemoryStore
+}
+
+func (s noHistory) History(string) ([]*libprotoconf.ConfigVersion, error) {
+	return nil, libprotoconf.ErrHistoryNotSupported
+}
+
+func TestHistoryStoreContract(t *testing.T) {
+	storetest.Run(t, libprotoconf.WithHistory(noHistory{libprotoconf.NewMemoryStore()}, 10))
+}
+
+func TestHistoryStore(t *testing.T) {
+	store := libprotoconf.WithHistory(noHistory{libprotoconf.NewMemoryStore()}, 2)
+	_, isVersioned := store.(libprotoconf.VersionedStore)
+	assert.True(t, isVersioned)
+	_, isBatch := store.(libprotoconf.BatchStore)
+	assert.True(t, isBatch)
+
+	for _, value := range []string{"v1", "v2", "v3"} {
+		assert.NoError(t, store.Set("services/api", []byte(value)))
+	}
+	history, err := store.History("services/api")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, int64(2), history[0].Version)
+	assert.Equal(t, "v2", string(history[0].Value))
+	assert.Equal(t, int64(3), history[1].Version)
+	assert.Equal(t, "v3", string(history[1].Value))
+
+	// The history and the keys kept along with the configs are hidden
+	assert.NoError(t, store.Set(".rollouts/services/api", []byte("rollout")))
+	history, err = store.History(".rollouts/services/api")
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+	keys, err := libprotoconf.NewStoreWatcher(store, "").(libprotoconf.Lister).List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/api"}, keys)
+
+	// Deleting a missing key isn't a version
+	assert.NoError(t, store.Delete("services/web"))
+	history, err = store.History("services/web")
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestPruneHistory(t *testing.T) {
+	raw := noHistory{libprotoconf.NewMemoryStore()}
+	store := libprotoconf.WithHistory(raw, 5)
+	for _, value := range []string{"v1", "v2", "v3"} {
+		assert.NoError(t, store.Set("services/api", []byte(value)))
+		assert.NoError(t, store.Set("services/web", []byte(value)))
+	}
+
+	dropped, err := libprotoconf.PruneHistory(raw, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, dropped)
+	history, err := store.History("services/api")
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, "v3", string(history[0].Value))
+	dropped, err = libprotoconf.PruneHistory(raw, 1)
+	assert.NoError(t, err)
+	assert.Zero(t, dropped)
+
+	// The stores keeping a history of their own are left as they are
+	dropped, err = libprotoconf.PruneHistory(libprotoconf.NewMemoryStore(), 1)
+	assert.NoError(t, err)
+	assert.Zero(t, dropped)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("protoconf/services/api", wrapperspb.String("first")))
+
+	watcher := libprotoconf.NewStoreWatcher(store, "protoconf/")
+	defer watcher.Close()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watchCh, err := watcher.Watch("services/api", stopCh)
+	assert.NoError(t, err)
+	read := func() libprotoconf.Result {
+		select {
+		case result := <-watchCh:
+			return result
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the config")
+		}
+		return libprotoconf.Result{}
+	}
+	value := &wrapperspb.StringValue{}
+	result := read()
+	assert.NoError(t, result.Error)
+	assert.NoError(t, result.Value.UnmarshalTo(value))
+	assert.Equal(t, "first", value.GetValue())
+	assert.Equal(t, 1, store.Watching("protoconf/services/api"))
+
+	// Held changes reach the watches once released
+	store.Hold()
+	assert.NoError(t, store.SetConfig("protoconf/services/api", wrapperspb.String("second")))
+	select {
+	case <-watchCh:
+		t.Fatal("a held change reached the watch")
+	case <-time.After(50 * time.Millisecond):
+	}
+	store.Release()
+	result = read()
+	assert.NoError(t, result.Error)
+	assert.NoError(t, result.Value.UnmarshalTo(value))
+	assert.Equal(t, "second", value.GetValue())
+
+	store.Fail("protoconf/services/api", errors.New("connection lost"))
+	result = read()
+	assert.EqualError(t, result.Error, "connection lost")
+
+	history, err := store.History("protoconf/services/api")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+// TestStoreContract runs the test suite against the stores whose addresses
+// are set in the environment, e.g. PROTOCONF_TEST_ETCD_ADDRESS
+func TestStoreContract(t *testing.T) {
+	for _, name := range []string{"consul", "etcd", "redis", "zookeeper", "postgres", "dynamodb"} {
+		t.Run(name, func(t *testing.T) {
+			address := os.Getenv("PROTOCONF_TEST_" + strings.ToUpper(name) + "_ADDRESS")
+			if address == "" {
+				t.Skipf("PROTOCONF_TEST_%s_ADDRESS isn't set", strings.ToUpper(name))
+			}
+			store, err := libprotoconf.OpenStore(name, address)
+			assert.NoError(t, err)
+			defer store.Close()
+
+			storetest.Run(t, store)
+		})
+	}
+}
+
+func TestRegisterStore(t *testing.T) {
+	_, err := libprotoconf.OpenStore("unregistered", "")
+	assert.Error(t, err)
+	assert.Contains(t, libprotoconf.Stores(), "sqlite")
+	assert.Panics(t, func() {
+		libprotoconf.RegisterStore("sqlite", func(string) (libprotoconf.Store, error) { return nil, nil })
+	})
+}
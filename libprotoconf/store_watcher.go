@@ -0,0 +1,156 @@
+package libprotoconf
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/tracing"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// NewStoreWatcher creates a Protoconf watcher of the configs written to store
+// under prefix. A deleted config keeps its last value until it's written
+// again.
+func NewStoreWatcher(store Store, prefix string) Watcher {
+	return &storeWatcher{
+		store:  store,
+		prefix: prefix,
+	}
+}
+
+type storeWatcher struct {
+	store  Store
+	prefix string
+}
+
+// Watch a value given its path
+func (w *storeWatcher) Watch(path string, stopCh <-chan struct{}) (<-chan Result, error) {
+	key := w.prefix + path
+	storeStopCh := make(chan struct{})
+	eventCh, err := w.store.Watch(key, storeStopCh)
+	if err != nil {
+		close(storeStopCh)
+		return nil, err
+	}
+
+	watchCh := make(chan Result)
+	go func() {
+		defer func() {
+			close(storeStopCh)
+			close(watchCh)
+			// Drain the events sent until the store stops watching
+			for range eventCh {
+			}
+		}()
+
+		var last *anypb.Any
+		for {
+			select {
+			case event, ok := <-eventCh:
+				if !ok {
+					return
+				}
+				if event.Error == ErrConfigNotFound {
+					event.Error = fmt.Errorf("%w, path=%s", ErrConfigNotFound, key)
+				}
+				if event.Error != nil {
+					select {
+					case watchCh <- Result{Error: event.Error}:
+					case <-stopCh:
+					}
+					return
+				}
+				if event.Value == nil {
+					// Deleted, the last value is kept
+					continue
+				}
+				_, span := tracing.Start(context.Background(), "store read", tracing.PathKey.String(path))
+				value, err := decodeValue(key, event.Value)
+				tracing.End(span, err)
+				if err != nil && last == nil {
+					select {
+					case watchCh <- Result{Error: err, Span: span.SpanContext()}:
+					case <-stopCh:
+					}
+					return
+				}
+				if err != nil {
+					log.Printf("Error reading config, path=%s err=%s", key, err)
+					continue
+				}
+				if proto.Equal(last, value.Value) {
+					continue
+				}
+				last = value.Value
+				select {
+				case watchCh <- Result{Value: value.Value, Span: span.SpanContext()}:
+				case <-stopCh:
+					return
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return watchCh, nil
+}
+
+// List lists the paths of the configs written under the prefix of the
+// watcher starting with prefix, in order. The paths starting with a dot are
+// kept by protoconf along with the configs, such as the versions of the
+// configs and their rollouts, and aren't listed.
+func (w *storeWatcher) List(prefix string) ([]string, error) {
+	keys, err := w.store.List(w.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, key := range keys {
+		if path := strings.TrimPrefix(key, w.prefix); !strings.HasPrefix(path, ".") {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func (w *storeWatcher) Close() {
+	w.store.Close()
+}
+
+// decodeValue decodes a config read from key
+func decodeValue(key string, data []byte) (*protoconfvalue.ProtoconfValue, error) {
+	value, err := DecodeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding config path=%s value=%s err=%s", key, data, err)
+	}
+	return value, nil
+}
+
+// DecodeConfig decodes a config as it's written to the stores, a base64
+// encoded ProtoconfValue
+func DecodeConfig(data []byte) (*protoconfvalue.ProtoconfValue, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, err
+	}
+	value := &protoconfvalue.ProtoconfValue{}
+	if err := proto.Unmarshal(decoded, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// EncodeConfig encodes a config as it's written to the stores
+func EncodeConfig(value *protoconfvalue.ProtoconfValue) ([]byte, error) {
+	data, err := proto.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(data)), nil
+}
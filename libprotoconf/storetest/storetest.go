@@ -0,0 +1,256 @@
+// Package storetest is the test suite every libprotoconf.Store is expected to
+// pass, for the built-in stores and the stores implemented out of tree
+package storetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Timeout is how long a watch waits for an event before failing. Stores
+// polling their configs should poll more often.
+var Timeout = 10 * time.Second
+
+// Run runs the test suite against store. The keys written are under a prefix
+// unique to the run, and are deleted once the tests are done.
+func Run(t *testing.T, store libprotoconf.Store) {
+	prefix := fmt.Sprintf("storetest/%d/", time.Now().UnixNano())
+	defer func() {
+		keys, err := store.List(prefix)
+		if err != nil {
+			return
+		}
+		for _, key := range keys {
+			store.Delete(key)
+		}
+	}()
+
+	t.Run("GetSet", func(t *testing.T) { testGetSet(t, store, prefix+"get_set/") })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, store, prefix+"delete/") })
+	t.Run("List", func(t *testing.T) { testList(t, store, prefix+"list/") })
+	t.Run("Watch", func(t *testing.T) { testWatch(t, store, prefix+"watch/") })
+	t.Run("History", func(t *testing.T) { testHistory(t, store, prefix+"history/") })
+	t.Run("SetAll", func(t *testing.T) { testSetAll(t, store, prefix+"set_all/") })
+	t.Run("SetIfVersion", func(t *testing.T) { testSetIfVersion(t, store, prefix+"set_if_version/") })
+}
+
+func testGetSet(t *testing.T, store libprotoconf.Store, prefix string) {
+	_, err := store.Get(prefix + "missing")
+	assert.Equal(t, libprotoconf.ErrConfigNotFound, err)
+
+	assert.NoError(t, store.Set(prefix+"config", []byte("v1")))
+	value, err := store.Get(prefix + "config")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(value))
+
+	assert.NoError(t, store.Set(prefix+"config", []byte("v2")))
+	value, err = store.Get(prefix + "config")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(value))
+}
+
+func testDelete(t *testing.T, store libprotoconf.Store, prefix string) {
+	assert.NoError(t, store.Set(prefix+"config", []byte("v1")))
+	assert.NoError(t, store.Delete(prefix+"config"))
+	_, err := store.Get(prefix + "config")
+	assert.Equal(t, libprotoconf.ErrConfigNotFound, err)
+
+	assert.NoError(t, store.Delete(prefix+"missing"))
+}
+
+func testList(t *testing.T, store libprotoconf.Store, prefix string) {
+	assert.NoError(t, store.Set(prefix+"services/web", []byte("v1")))
+	assert.NoError(t, store.Set(prefix+"services/api", []byte("v1")))
+	assert.NoError(t, store.Set(prefix+"global", []byte("v1")))
+
+	keys, err := store.List(prefix + "services/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "services/api", prefix + "services/web"}, keys)
+
+	keys, err = store.List(prefix)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "global", prefix + "services/api", prefix + "services/web"}, keys)
+
+	assert.NoError(t, store.Delete(prefix+"services/web"))
+	keys, err = store.List(prefix + "services/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "services/api"}, keys)
+
+	keys, err = store.List(prefix + "missing/")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func testWatch(t *testing.T, store libprotoconf.Store, prefix string) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	eventCh, err := store.Watch(prefix+"missing", stopCh)
+	assert.NoError(t, err)
+	event := receive(t, eventCh)
+	assert.Equal(t, libprotoconf.ErrConfigNotFound, event.Error)
+
+	assert.NoError(t, store.Set(prefix+"config", []byte("v1")))
+	eventCh, err = store.Watch(prefix+"config", stopCh)
+	assert.NoError(t, err)
+	event = receive(t, eventCh)
+	assert.NoError(t, event.Error)
+	assert.Equal(t, "v1", string(event.Value))
+
+	assert.NoError(t, store.Set(prefix+"config", []byte("v2")))
+	event = receive(t, eventCh)
+	assert.NoError(t, event.Error)
+	assert.Equal(t, "v2", string(event.Value))
+
+	assert.NoError(t, store.Delete(prefix+"config"))
+	event = receive(t, eventCh)
+	assert.NoError(t, event.Error)
+	assert.Nil(t, event.Value)
+
+	assert.NoError(t, store.Set(prefix+"config", []byte("v3")))
+	event = receive(t, eventCh)
+	assert.NoError(t, event.Error)
+	assert.Equal(t, "v3", string(event.Value))
+
+	// The channel is closed once the watch is stopped
+	watchStopCh := make(chan struct{})
+	eventCh, err = store.Watch(prefix+"config", watchStopCh)
+	assert.NoError(t, err)
+	receive(t, eventCh)
+	close(watchStopCh)
+	select {
+	case _, ok := <-eventCh:
+		for ok {
+			_, ok = <-eventCh
+		}
+	case <-time.After(Timeout):
+		t.Fatal("timed out waiting for the watch to stop")
+	}
+}
+
+func testHistory(t *testing.T, store libprotoconf.Store, prefix string) {
+	_, err := store.History(prefix + "config")
+	if err == libprotoconf.ErrHistoryNotSupported {
+		t.Skip("history isn't supported by the store")
+	}
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Set(prefix+"config", []byte("v1")))
+	assert.NoError(t, store.Set(prefix+"config", []byte("v2")))
+	assert.NoError(t, store.Delete(prefix+"config"))
+
+	history, err := store.History(prefix + "config")
+	assert.NoError(t, err)
+	assert.Len(t, history, 3)
+	assert.Equal(t, "v1", string(history[0].Value))
+	assert.Equal(t, "v2", string(history[1].Value))
+	assert.Nil(t, history[2].Value)
+	assert.True(t, history[0].Version < history[1].Version)
+	assert.True(t, history[1].Version < history[2].Version)
+}
+
+func testSetAll(t *testing.T, store libprotoconf.Store, prefix string) {
+	batch, ok := store.(libprotoconf.BatchStore)
+	if !ok {
+		t.Skip("the store doesn't write in batches")
+	}
+
+	assert.NoError(t, store.Set(prefix+"deleted", []byte("v1")))
+	assert.NoError(t, batch.SetAll(map[string][]byte{
+		prefix + "routes":   []byte("v1"),
+		prefix + "clusters": []byte("v1"),
+		prefix + "deleted":  nil,
+		prefix + "missing":  nil,
+	}))
+	keys, err := store.List(prefix)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "clusters", prefix + "routes"}, keys)
+
+	assert.NoError(t, batch.SetAll(map[string][]byte{
+		prefix + "routes":   []byte("v2"),
+		prefix + "clusters": []byte("v2"),
+	}))
+	for _, key := range keys {
+		value, err := store.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", string(value))
+	}
+}
+
+func testSetIfVersion(t *testing.T, store libprotoconf.Store, prefix string) {
+	versioned, ok := store.(libprotoconf.VersionedStore)
+	if !ok {
+		t.Skip("the store doesn't write on the condition of versions")
+	}
+	key := prefix + "config"
+
+	_, _, err := versioned.GetVersion(key)
+	assert.Equal(t, libprotoconf.ErrConfigNotFound, err)
+
+	// An empty version creates the key
+	first, err := versioned.SetIfVersion(key, []byte("v1"), "")
+	assert.NoError(t, err)
+	_, err = versioned.SetIfVersion(key, []byte("v1"), "")
+	assert.Equal(t, libprotoconf.ErrVersionMismatch, err)
+	value, version, err := versioned.GetVersion(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(value))
+	assert.Equal(t, first, version)
+
+	second, err := versioned.SetIfVersion(key, []byte("v2"), first)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	_, err = versioned.SetIfVersion(key, []byte("v3"), first)
+	assert.Equal(t, libprotoconf.ErrVersionMismatch, err)
+	value, version, err = versioned.GetVersion(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(value))
+	assert.Equal(t, second, version)
+
+	// Writes without a version change the version too
+	assert.NoError(t, store.Set(key, []byte("v3")))
+	_, err = versioned.SetIfVersion(key, []byte("v4"), second)
+	assert.Equal(t, libprotoconf.ErrVersionMismatch, err)
+
+	// Deleted keys are missing keys
+	_, version, err = versioned.GetVersion(key)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Delete(key))
+	_, err = versioned.SetIfVersion(key, []byte("v4"), version)
+	assert.Equal(t, libprotoconf.ErrVersionMismatch, err)
+	_, err = versioned.SetIfVersion(key, []byte("v4"), "")
+	assert.NoError(t, err)
+	value, err = store.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "v4", string(value))
+}
+
+func receive(t *testing.T, eventCh <-chan libprotoconf.StoreEvent) libprotoconf.StoreEvent {
+	select {
+	case event, ok := <-eventCh:
+		assert.True(t, ok, "the watch channel is closed")
+		return event
+	case <-time.After(Timeout):
+		t.Fatal("timed out waiting for an event")
+	}
+	return libprotoconf.StoreEvent{}
+}
+
+// EncodeString encodes a config of a google.protobuf.StringValue as the
+// stores hold it, for the tests of the packages reading the configs of a
+// store
+func EncodeString(t testing.TB, value string) []byte {
+	t.Helper()
+	any, err := anypb.New(wrapperspb.String(value))
+	assert.NoError(t, err)
+	data, err := libprotoconf.EncodeConfig(&protoconfvalue.ProtoconfValue{ProtoFile: "google/protobuf/wrappers.proto", Value: any})
+	assert.NoError(t, err)
+	return data
+}
@@ -0,0 +1,314 @@
+package libprotoconf
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/consts"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// zookeeperSessionTimeout is the timeout of the ZooKeeper session of the store
+const zookeeperSessionTimeout = 10 * time.Second
+
+func init() {
+	RegisterStore(kvStoreNames[Zookeeper], NewZookeeperStore)
+}
+
+// NewZookeeperStore stores the configs in the znodes of their keys, the
+// parents of a config being znodes without data. Configs are watched with
+// znode watches. address is a comma separated list of the servers of the
+// ensemble.
+func NewZookeeperStore(address string) (Store, error) {
+	if address == "" {
+		address = consts.ZookeeperDefaultAddress
+	}
+	conn, _, err := zk.Connect(strings.Split(address, ","), zookeeperSessionTimeout, zk.WithLogInfo(false))
+	if err != nil {
+		return nil, err
+	}
+	return &zookeeperStore{conn: conn}, nil
+}
+
+type zookeeperStore struct {
+	conn *zk.Conn
+}
+
+// znode is the path of the znode of a key
+func znode(key string) string {
+	return "/" + strings.Trim(key, "/")
+}
+
+func (s *zookeeperStore) Get(key string) ([]byte, error) {
+	data, _, err := s.conn.Get(znode(key))
+	if err == zk.ErrNoNode || (err == nil && len(data) == 0) {
+		return nil, ErrConfigNotFound
+	}
+	return data, err
+}
+
+func (s *zookeeperStore) Set(key string, value []byte) error {
+	path := znode(key)
+	if _, err := s.conn.Set(path, value, -1); err != zk.ErrNoNode {
+		return err
+	}
+
+	if err := s.createParents(path); err != nil {
+		return err
+	}
+	_, err := s.conn.Create(path, value, 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		_, err = s.conn.Set(path, value, -1)
+	}
+	return err
+}
+
+// GetVersion reads the value of a key and its version, the ZooKeeper
+// transaction id of the last modification of its znode
+func (s *zookeeperStore) GetVersion(key string) ([]byte, string, error) {
+	data, stat, err := s.conn.Get(znode(key))
+	if err == zk.ErrNoNode || (err == nil && len(data) == 0) {
+		return nil, "", ErrConfigNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, strconv.FormatInt(stat.Mzxid, 10), nil
+}
+
+// SetIfVersion writes the value of a key when its znode was last modified at
+// version, the znode is written on the condition of the version of its data
+// so that a concurrent write fails either
+func (s *zookeeperStore) SetIfVersion(key string, value []byte, version string) (string, error) {
+	path := znode(key)
+	data, stat, err := s.conn.Get(path)
+	if err != nil && err != zk.ErrNoNode {
+		return "", err
+	}
+	switch {
+	case err == zk.ErrNoNode && version == "":
+		if err := s.createParents(path); err != nil {
+			return "", err
+		}
+		if _, err := s.conn.Create(path, value, 0, zk.WorldACL(zk.PermAll)); err != nil {
+			if err == zk.ErrNodeExists {
+				return "", ErrVersionMismatch
+			}
+			return "", err
+		}
+		// The znode was last modified when it was created, unless it was
+		// written again since
+		_, stat, err = s.conn.Get(path)
+		if err == zk.ErrNoNode {
+			return "", ErrVersionMismatch
+		}
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(stat.Czxid, 10), nil
+	case err == zk.ErrNoNode:
+		return "", ErrVersionMismatch
+	case len(data) == 0 && version != "":
+		return "", ErrVersionMismatch
+	case len(data) > 0 && strconv.FormatInt(stat.Mzxid, 10) != version:
+		return "", ErrVersionMismatch
+	}
+	// The znode holds the config at version, or is a parent without data
+	stat, err = s.conn.Set(path, value, stat.Version)
+	if err == zk.ErrBadVersion || err == zk.ErrNoNode {
+		return "", ErrVersionMismatch
+	}
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(stat.Mzxid, 10), nil
+}
+
+// createParents creates the parents of a znode missing, as znodes without
+// data
+func (s *zookeeperStore) createParents(path string) error {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		parent := "/" + strings.Join(parts[:i], "/")
+		if _, err := s.conn.Create(parent, nil, 0, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetAll writes the values of keys in one ZooKeeper transaction, a nil value
+// deletes its key. The transaction fails when a key is created or deleted
+// concurrently.
+func (s *zookeeperStore) SetAll(values map[string][]byte) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var ops []interface{}
+	for _, key := range keys {
+		path := znode(key)
+		value := values[key]
+		_, stat, err := s.conn.Get(path)
+		exists := err == nil
+		if err != nil && err != zk.ErrNoNode {
+			return err
+		}
+		switch {
+		case value == nil && !exists:
+		case value == nil && stat.NumChildren > 0:
+			// The znode is the parent of other configs too, it's kept without data
+			ops = append(ops, &zk.SetDataRequest{Path: path, Data: nil, Version: -1})
+		case value == nil:
+			ops = append(ops, &zk.DeleteRequest{Path: path, Version: -1})
+		case exists:
+			ops = append(ops, &zk.SetDataRequest{Path: path, Data: value, Version: -1})
+		default:
+			// The parents are created beforehand, they don't hold configs
+			if err := s.createParents(path); err != nil {
+				return err
+			}
+			ops = append(ops, &zk.CreateRequest{Path: path, Data: value, Acl: zk.WorldACL(zk.PermAll)})
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	_, err := s.conn.Multi(ops...)
+	return err
+}
+
+func (s *zookeeperStore) Delete(key string) error {
+	path := znode(key)
+	err := s.conn.Delete(path, -1)
+	if err == zk.ErrNotEmpty {
+		// The znode is the parent of other configs too, it's kept without data
+		_, err = s.conn.Set(path, nil, -1)
+	}
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// List lists the keys starting with prefix, the znodes without data aren't
+// listed
+func (s *zookeeperStore) List(prefix string) ([]string, error) {
+	keys := []string{}
+	var visit func(path string) error
+	visit = func(path string) error {
+		children, _, err := s.conn.Children(path)
+		if err == zk.ErrNoNode {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			childPath := strings.TrimSuffix(path, "/") + "/" + child
+			key := strings.TrimPrefix(childPath, "/")
+			if !strings.HasPrefix(key, prefix) && !strings.HasPrefix(prefix, key+"/") {
+				continue
+			}
+			data, _, err := s.conn.Get(childPath)
+			if err == zk.ErrNoNode {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if len(data) > 0 && strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+			if err := visit(childPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(znode(prefix[:strings.LastIndex(prefix, "/")+1])); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Watch watches the znode of key, and the creation of the znode again once
+// it's deleted
+func (s *zookeeperStore) Watch(key string, stopCh <-chan struct{}) (<-chan StoreEvent, error) {
+	path := znode(key)
+
+	eventCh := make(chan StoreEvent)
+	go func() {
+		defer close(eventCh)
+		send := func(event StoreEvent) bool {
+			select {
+			case eventCh <- event:
+				return true
+			case <-stopCh:
+				return false
+			}
+		}
+
+		var version int32 = -1
+		found := false
+		for {
+			data, stat, znodeCh, err := s.conn.GetW(path)
+			deleted := err == zk.ErrNoNode || (err == nil && len(data) == 0)
+			switch {
+			case deleted && !found:
+				send(StoreEvent{Error: ErrConfigNotFound})
+				return
+			case deleted:
+				if version >= 0 {
+					version = -1
+					if !send(StoreEvent{}) {
+						return
+					}
+				}
+				if err == zk.ErrNoNode {
+					// Wait for the config to be written again
+					var exists bool
+					exists, _, znodeCh, err = s.conn.ExistsW(path)
+					if err == nil && exists {
+						continue
+					}
+				}
+			case err != nil:
+			case stat.Version != version:
+				found = true
+				version = stat.Version
+				if !send(StoreEvent{Value: data}) {
+					return
+				}
+			}
+			if err != nil {
+				send(StoreEvent{Error: err})
+				return
+			}
+
+			select {
+			case event := <-znodeCh:
+				if event.Type == zk.EventNotWatching {
+					send(StoreEvent{Error: event.Err})
+					return
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return eventCh, nil
+}
+
+func (s *zookeeperStore) History(key string) ([]*ConfigVersion, error) {
+	return nil, ErrHistoryNotSupported
+}
+
+func (s *zookeeperStore) Close() {
+	s.conn.Close()
+}
@@ -11,16 +11,22 @@ import (
 	"strings"
 	"time"
 
-	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
-	"github.com/golang/protobuf/ptypes"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
+	"github.com/protoconf/protoconf/command"
 	pv "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/expiry"
 	pc "github.com/protoconf/protoconf/server/api/proto/v1"
 	"github.com/protoconf/protoconf/utils"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var conn *grpc.ClientConn
@@ -58,6 +64,12 @@ type cliConfig struct {
 	configPath    string
 	metadataStr   string
 	fieldsArray   fieldsArray
+	ifVersion     string
+	printVersion  bool
+	patch         bool
+	namespace     string
+	expiry        expiry.Config
+	tls           command.TLSConfig
 }
 
 func newFlagSet() (*flag.FlagSet, *cliConfig) {
@@ -79,6 +91,12 @@ A CLI util to communicate with the mutation server easily.
 	flags.StringVar(&config.configPath, "path", "", "Path to put the config in")
 	flags.StringVar(&config.metadataStr, "metadata", "", "Metadata string to pass to the pre/post install script")
 	flags.Var(&config.fieldsArray, "field", "fields to set inside -msg")
+	flags.StringVar(&config.ifVersion, "if-version", "", "Mutate only if the mutable config is still at this version, as printed by -print-version or by the previous mutation, \"none\" if it must not exist")
+	flags.BoolVar(&config.printVersion, "print-version", false, "Print the version of the mutable config of -path and exit")
+	command.AddTLSClientFlags(flags, &config.tls)
+	flags.StringVar(&config.namespace, "namespace", "", "Namespace of -path on a server with tenants, the only namespace of the client by default")
+	flags.BoolVar(&config.patch, "patch", false, "Patch only the -field fields of the config of -path in the key-value store of the server, keeping its other fields")
+	expiry.AddFlags(flags, &config.expiry)
 
 	return flags, config
 }
@@ -87,11 +105,21 @@ func (c *cliCommand) Run(args []string) int {
 	flags, config := newFlagSet()
 	flags.Parse(args)
 
+	if config.printVersion && config.configPath != "" {
+		return printVersion(config)
+	}
 	if config.protoFile == "" || config.configPath == "" || config.protoMsg == "" || len(config.fieldsArray) < 1 {
 		c.ui.Output(c.Help())
 		return 0
 	}
 	path := config.configPath
+	expires, err := config.expiry.Time(time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !expires.IsZero() && !config.patch {
+		log.Fatal("-ttl and -expires are supported with -patch only")
+	}
 
 	root, err := filepath.Abs(config.protoconfRoot)
 	if err != nil {
@@ -102,75 +130,61 @@ func (c *cliCommand) Run(args []string) int {
 		log.Fatal("failed to get AnyResolver:", err)
 	}
 
-	name, err := anyResolver.Resolve(config.protoMsg)
+	messageType, err := anyResolver.FindMessageByName(protoreflect.FullName(config.protoMsg))
 	if err != nil {
 		log.Fatal(errors.Wrapf(err, "could not find typeUrl for %s", config.protoMsg))
 	}
 
-	msg, err := dynamic.AsDynamicMessage(name)
-	if err != nil {
-		log.Fatal(err)
-	}
-
+	msg := messageType.New()
 	for _, fName := range config.fieldsArray {
 		ret := strings.SplitN(fName, "=", 2)
-		field := msg.GetMessageDescriptor().FindFieldByName(ret[0])
+		field := msg.Descriptor().Fields().ByName(protoreflect.Name(ret[0]))
 		if field == nil {
-			log.Fatalf("%s is not a field in %s", ret[0], msg.XXX_MessageName())
+			log.Fatalf("%s is not a field in %s", ret[0], msg.Descriptor().FullName())
 		}
-		switch field.GetType() {
-		case dpb.FieldDescriptorProto_TYPE_DOUBLE:
-			setFloat(msg, ret[0], ret[1], func(s interface{}) interface{} { return s })
-		case dpb.FieldDescriptorProto_TYPE_FLOAT:
-			setFloat(msg, ret[0], ret[1], func(s interface{}) interface{} { return s })
-		case dpb.FieldDescriptorProto_TYPE_INT64:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return s })
-		case dpb.FieldDescriptorProto_TYPE_UINT64:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return s })
-		case dpb.FieldDescriptorProto_TYPE_INT32:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return int32(s.(int64)) })
-		case dpb.FieldDescriptorProto_TYPE_FIXED64:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return s })
-		case dpb.FieldDescriptorProto_TYPE_FIXED32:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return int32(s.(int64)) })
-		case dpb.FieldDescriptorProto_TYPE_BOOL:
+		switch field.Kind() {
+		case protoreflect.DoubleKind:
+			setFloat(msg, field, ret[1], func(s interface{}) interface{} { return s })
+		case protoreflect.FloatKind:
+			setFloat(msg, field, ret[1], func(s interface{}) interface{} { return float32(s.(float64)) })
+		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+			setNumeric(msg, field, ret[1], 64, func(s interface{}) interface{} { return s })
+		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+			setNumeric(msg, field, ret[1], 32, func(s interface{}) interface{} { return int32(s.(int64)) })
+		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			setUnsigned(msg, field, ret[1], 64, func(s interface{}) interface{} { return s })
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+			setUnsigned(msg, field, ret[1], 32, func(s interface{}) interface{} { return uint32(s.(uint64)) })
+		case protoreflect.BoolKind:
 			b, e := strconv.ParseBool(ret[1])
 			if e != nil {
 				log.Fatal(e)
 			}
-			setField(msg, ret[0], b, func(s interface{}) interface{} {
+			setField(msg, field, b, func(s interface{}) interface{} {
 				return s
 			})
-		case dpb.FieldDescriptorProto_TYPE_STRING:
-			setField(msg, ret[0], ret[1], func(s interface{}) interface{} { return s })
-		case dpb.FieldDescriptorProto_TYPE_UINT32:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return uint32(s.(int64)) })
-		case dpb.FieldDescriptorProto_TYPE_SFIXED32:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return int32(s.(int64)) })
-		case dpb.FieldDescriptorProto_TYPE_SFIXED64:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return s })
-		case dpb.FieldDescriptorProto_TYPE_SINT32:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return uint32(s.(int64)) })
-		case dpb.FieldDescriptorProto_TYPE_SINT64:
-			setNumeric(msg, ret[0], ret[1], func(s interface{}) interface{} { return s })
+		case protoreflect.StringKind:
+			setField(msg, field, ret[1], func(s interface{}) interface{} { return s })
 		}
 	}
 
-	log.Println(msg.String())
+	log.Println(prototext.Format(msg.Interface()))
 	address := config.serverAddress
-	conn, err = grpc.Dial(address, grpc.WithInsecure())
+	conn, err = dial(config)
 	if err != nil {
 		log.Fatal(fmt.Errorf("error connecting to server address=%s err=%s", address, err))
 	}
 	defer conn.Close()
-	any, err := ptypes.MarshalAny(msg)
+	any, err := anypb.New(msg.Interface())
 	if err != nil {
-		log.Fatal(fmt.Errorf("error marshalling message to any message=%s err=%s", msg, err))
+		log.Fatal(fmt.Errorf("error marshalling message to any message=%s err=%s", msg.Descriptor().FullName(), err))
 	}
-	log.Println(msg)
 	log.Println(any)
+	if config.patch {
+		return patchConfig(config, any, expires)
+	}
 	configValue := &pv.ProtoconfValue{ProtoFile: config.protoFile, Value: any}
-	request := &pc.ConfigMutationRequest{Path: config.configPath, Value: configValue, ScriptMetadata: config.metadataStr}
+	request := &pc.ConfigMutationRequest{Path: config.configPath, Value: configValue, ScriptMetadata: config.metadataStr, Version: config.version()}
 
 	client := pc.NewProtoconfMutationServiceClient(conn)
 	// Wait until the server finishes long git operations
@@ -178,36 +192,127 @@ func (c *cliCommand) Run(args []string) int {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	if _, err := client.MutateConfig(ctx, request); err != nil {
+	response, err := client.MutateConfig(ctx, request)
+	if status.Code(err) == codes.FailedPrecondition {
+		log.Printf("Error mutating path=%s, the mutable config was changed since version %s, read it again and retry: %s", path, config.ifVersion, status.Convert(err).Message())
+		return 1
+	}
+	if err != nil {
 		log.Fatal(fmt.Errorf("error mutating path=%s err=%s", path, err))
 	}
-	log.Printf("Mutated %s successfully", path)
+	log.Printf("Mutated %s successfully, version=%s", path, response.GetVersion())
+	return 0
+}
+
+// dial connects to the server, with mutual TLS when configured
+func dial(config *cliConfig) (*grpc.ClientConn, error) {
+	transport, err := config.tls.DialOption()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Dial(config.serverAddress, append(command.NamespaceDialOptions(config.namespace), transport)...)
+}
+
+// noVersion is the -if-version of the mutable configs which must not exist
+const noVersion = "none"
+
+// version is the version of the requests, nil without -if-version
+func (c *cliConfig) version() *string {
+	switch c.ifVersion {
+	case "":
+		return nil
+	case noVersion:
+		return new(string)
+	default:
+		return &c.ifVersion
+	}
+}
+
+// patchConfig sends the -field fields of msg as a patch of the config of
+// -path in the key-value store of the server, reverted at expires unless it's
+// zero
+func patchConfig(config *cliConfig, msg *anypb.Any, expires time.Time) int {
+	var paths []string
+	for _, field := range config.fieldsArray {
+		paths = append(paths, strings.SplitN(field, "=", 2)[0])
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	request := &pc.ConfigPatchRequest{Path: config.configPath, Value: msg, UpdateMask: &fieldmaskpb.FieldMask{Paths: paths}, Version: config.version()}
+	if !expires.IsZero() {
+		request.Expires = timestamppb.New(expires)
+	}
+	response, err := pc.NewProtoconfMutationServiceClient(conn).PatchConfig(ctx, request)
+	if status.Code(err) == codes.FailedPrecondition && request.Version != nil {
+		log.Printf("Error patching path=%s, the config was changed since version %s, read it again and retry: %s", config.configPath, config.ifVersion, status.Convert(err).Message())
+		return 1
+	}
+	if err != nil {
+		log.Fatal(fmt.Errorf("error patching path=%s err=%s", config.configPath, err))
+	}
+	log.Printf("Patched %s successfully, version=%s", config.configPath, response.GetVersion())
+	if !expires.IsZero() {
+		log.Printf("The patch of %s is reverted at %s", config.configPath, expires.UTC().Format(time.RFC3339))
+	}
+	return 0
+}
+
+// printVersion prints the version of a mutable config, noVersion when it
+// doesn't exist
+func printVersion(config *cliConfig) int {
+	conn, err := dial(config)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error connecting to server address=%s err=%s", config.serverAddress, err))
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	mutableConfig, err := pc.NewProtoconfMutationServiceClient(conn).GetMutableConfig(ctx, &pc.GetMutableConfigRequest{Path: config.configPath})
+	if status.Code(err) == codes.NotFound {
+		fmt.Println(noVersion)
+		return 0
+	}
+	if err != nil {
+		log.Fatal(fmt.Errorf("error reading path=%s err=%s", config.configPath, err))
+	}
+	fmt.Println(mutableConfig.GetVersion())
 	return 0
 }
 
 type typerFunc func(interface{}) interface{}
 
-func setNumeric(msg *dynamic.Message, key, val string, typer typerFunc) {
-	i, err := strconv.ParseInt(val, 0, 64)
+// setNumeric parses a signed integer, failing when it overflows the field
+// instead of truncating it
+func setNumeric(msg protoreflect.Message, field protoreflect.FieldDescriptor, val string, bitSize int, typer typerFunc) {
+	i, err := strconv.ParseInt(val, 0, bitSize)
 	if err != nil {
 		log.Fatal(err)
 	}
-	setField(msg, key, i, typer)
+	setField(msg, field, i, typer)
 }
 
-func setFloat(msg *dynamic.Message, key, val string, typer typerFunc) {
-	i, err := strconv.ParseFloat(val, 64)
+// setUnsigned parses an unsigned integer, failing when it's negative or when
+// it overflows the field
+func setUnsigned(msg protoreflect.Message, field protoreflect.FieldDescriptor, val string, bitSize int, typer typerFunc) {
+	i, err := strconv.ParseUint(val, 0, bitSize)
 	if err != nil {
 		log.Fatal(err)
 	}
-	setField(msg, key, i, typer)
+	setField(msg, field, i, typer)
 }
 
-func setField(msg *dynamic.Message, key string, val interface{}, typer typerFunc) {
-	err := msg.TrySetFieldByName(key, typer(val))
+func setFloat(msg protoreflect.Message, field protoreflect.FieldDescriptor, val string, typer typerFunc) {
+	i, err := strconv.ParseFloat(val, 64)
 	if err != nil {
 		log.Fatal(err)
 	}
+	setField(msg, field, i, typer)
+}
+
+func setField(msg protoreflect.Message, field protoreflect.FieldDescriptor, val interface{}, typer typerFunc) {
+	msg.Set(field, protoreflect.ValueOf(typer(val)))
 }
 
 func (c *cliCommand) Help() string {
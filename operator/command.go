@@ -0,0 +1,98 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/kube"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+type cliCommand struct{}
+
+type cliConfig struct {
+	namespace      string
+	resyncInterval time.Duration
+	kube           kube.Config
+}
+
+func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... protoconfRoot")
+		fmt.Fprintln(flags.Output(), "Publishes the configs of the ProtoconfConfig resources of Kubernetes to the key-value store, install their definition from operator/crd.yaml.")
+		flags.PrintDefaults()
+	}
+
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+
+	config := &cliConfig{}
+	flags.StringVar(&config.namespace, "namespace", "", "Namespace of the ProtoconfConfig resources (default: every namespace)")
+	flags.DurationVar(&config.resyncInterval, "resync-interval", DefaultResyncInterval, "How often the resources are reconciled, compiling their sources again")
+	kube.AddFlags(flags, &config.kube)
+
+	return flags, config, kVConfig
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config, kVConfig := newFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+	protoconfRoot := strings.TrimSpace(flags.Arg(0))
+
+	client, err := config.kube.Client()
+	if err != nil {
+		log.Printf("Error setting up the Kubernetes client, err=%s", err)
+		return 1
+	}
+	store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	if err != nil {
+		log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	defer store.Close()
+
+	log.Printf("Publishing the configs of the ProtoconfConfigs to %s at \"%s\", protoconf_root=\"%s\"", kVConfig.Store, kVConfig.Address, protoconfRoot)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	operator := New(client, kVConfig.WithHistory(store), kVConfig.Prefix, protoconfRoot, config.namespace)
+	if err := operator.Run(ctx, config.resyncInterval); err != nil && err != context.Canceled {
+		log.Printf("Error running the operator, err=%s", err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _, _ := newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return "Publishes the configs of the ProtoconfConfig resources of Kubernetes"
+}
+
+// Command is a cli.CommandFactory
+func Command() (cli.Command, error) {
+	return &cliCommand{}, nil
+}
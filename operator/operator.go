@@ -0,0 +1,288 @@
+// Package operator publishes the configs declared as ProtoconfConfig
+// resources of Kubernetes to the key-value store, compiling and validating
+// them first, and reports how it went in the conditions of the resources
+package operator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/inserter"
+	"github.com/protoconf/protoconf/kube"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// The API group and version of the ProtoconfConfig resources
+const (
+	Group   = "protoconf.io"
+	Version = "v1alpha1"
+	// Finalizer keeps a resource deleted until its configs are deleted from
+	// the store
+	Finalizer = "protoconf.io/delete-configs"
+)
+
+// The conditions of the ProtoconfConfig resources
+const (
+	// ConditionCompiled tells whether the source of a resource compiled and
+	// its configs are valid
+	ConditionCompiled = "Compiled"
+	// ConditionPublished tells whether the configs of a resource are written
+	// to the store
+	ConditionPublished = "Published"
+)
+
+// DefaultResyncInterval is how often the resources are reconciled by
+// default, compiling their sources again as they change
+const DefaultResyncInterval = 30 * time.Second
+
+// ProtoconfConfig declares a config of the protoconf root, published to the
+// store
+type ProtoconfConfig struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Metadata   kube.ObjectMeta       `json:"metadata"`
+	Spec       ProtoconfConfigSpec   `json:"spec"`
+	Status     ProtoconfConfigStatus `json:"status,omitempty"`
+}
+
+// ProtoconfConfigSpec is the config a resource declares
+type ProtoconfConfigSpec struct {
+	// Source is the config as protoconf insert takes it: a .pconf or .mpconf
+	// config under src/ of the protoconf root, compiled, or a materialized
+	// config
+	Source string `json:"source"`
+}
+
+// ProtoconfConfigStatus is the status of the configs of a resource
+type ProtoconfConfigStatus struct {
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Paths are the paths of the configs published
+	Paths      []string    `json:"paths,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// Condition is a condition of a resource
+type Condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+type protoconfConfigList struct {
+	Items []*ProtoconfConfig `json:"items"`
+}
+
+// Operator publishes the configs of the ProtoconfConfig resources
+type Operator struct {
+	client        *kube.Client
+	store         libprotoconf.Store
+	prefix        string
+	protoconfRoot string
+	namespace     string
+}
+
+// New returns an operator publishing the configs of the resources of
+// namespace, of every namespace when empty, compiled from protoconfRoot to
+// store under prefix
+func New(client *kube.Client, store libprotoconf.Store, prefix string, protoconfRoot string, namespace string) *Operator {
+	return &Operator{client: client, store: store, prefix: prefix, protoconfRoot: protoconfRoot, namespace: namespace}
+}
+
+// Run reconciles the resources every resyncInterval until ctx is done
+func (o *Operator) Run(ctx context.Context, resyncInterval time.Duration) error {
+	ticker := time.NewTicker(resyncInterval)
+	defer ticker.Stop()
+	for {
+		if err := o.Reconcile(ctx); err != nil {
+			log.Printf("Error reconciling ProtoconfConfigs, err=%s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Operator) collection(namespace string) string {
+	if namespace == "" {
+		return fmt.Sprintf("/apis/%s/%s/protoconfconfigs", Group, Version)
+	}
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/protoconfconfigs", Group, Version, namespace)
+}
+
+func (o *Operator) path(resource *ProtoconfConfig) string {
+	return o.collection(resource.Metadata.Namespace) + "/" + resource.Metadata.Name
+}
+
+// Reconcile publishes the configs of every resource, and deletes the configs
+// of the resources deleted
+func (o *Operator) Reconcile(ctx context.Context) error {
+	list := &protoconfConfigList{}
+	if err := o.client.Get(ctx, o.collection(o.namespace), list); err != nil {
+		return err
+	}
+	// published counts the resources publishing each config, the configs
+	// published by another resource aren't deleted
+	published := make(map[string]int)
+	for _, resource := range list.Items {
+		for _, path := range resource.Status.Paths {
+			published[path]++
+		}
+	}
+	for _, resource := range list.Items {
+		if err := o.reconcile(ctx, resource, published); err != nil {
+			log.Printf("Error reconciling ProtoconfConfig %s/%s, err=%s", resource.Metadata.Namespace, resource.Metadata.Name, err)
+		}
+	}
+	return nil
+}
+
+func (o *Operator) reconcile(ctx context.Context, resource *ProtoconfConfig, published map[string]int) error {
+	finalizer := -1
+	for i, f := range resource.Metadata.Finalizers {
+		if f == Finalizer {
+			finalizer = i
+		}
+	}
+	if resource.Metadata.DeletionTimestamp != "" {
+		if finalizer < 0 {
+			return nil
+		}
+		if err := o.deleteConfigs(resource.Status.Paths, published); err != nil {
+			return err
+		}
+		resource.Metadata.Finalizers = append(resource.Metadata.Finalizers[:finalizer], resource.Metadata.Finalizers[finalizer+1:]...)
+		return o.client.Update(ctx, o.path(resource), resource)
+	}
+	if finalizer < 0 {
+		resource.Metadata.Finalizers = append(resource.Metadata.Finalizers, Finalizer)
+		if err := o.client.Update(ctx, o.path(resource), resource); err != nil {
+			return err
+		}
+	}
+
+	status := ProtoconfConfigStatus{
+		ObservedGeneration: resource.Metadata.Generation,
+		Paths:              resource.Status.Paths,
+		Conditions:         append([]Condition{}, resource.Status.Conditions...),
+	}
+	generation := resource.Metadata.Generation
+	keys, values, err := inserter.EncodeConfigs([]string{resource.Spec.Source}, o.protoconfRoot, o.prefix)
+	if err != nil {
+		// The configs published before are kept
+		setCondition(&status, Condition{Type: ConditionCompiled, Status: "False", Reason: "CompileFailed", Message: err.Error(), ObservedGeneration: generation})
+	} else {
+		setCondition(&status, Condition{Type: ConditionCompiled, Status: "True", Reason: "Compiled", ObservedGeneration: generation})
+		paths, err := o.publish(keys, values)
+		if err == nil {
+			err = o.deleteConfigs(removed(status.Paths, paths), published)
+		}
+		if err != nil {
+			setCondition(&status, Condition{Type: ConditionPublished, Status: "False", Reason: "PublishFailed", Message: err.Error(), ObservedGeneration: generation})
+		} else {
+			status.Paths = paths
+			setCondition(&status, Condition{Type: ConditionPublished, Status: "True", Reason: "Published", Message: fmt.Sprintf("Published %s", strings.Join(paths, ", ")), ObservedGeneration: generation})
+		}
+	}
+
+	if reflect.DeepEqual(status, resource.Status) {
+		return nil
+	}
+	resource.Status = status
+	return o.client.Update(ctx, o.path(resource)+"/status", resource)
+}
+
+// publish writes the configs which changed to the store, in one transaction
+// when the store is a libprotoconf.BatchStore, and returns the paths of the
+// configs
+func (o *Operator) publish(keys []string, values map[string][]byte) ([]string, error) {
+	changed := make(map[string][]byte)
+	var paths []string
+	for _, key := range keys {
+		paths = append(paths, strings.TrimPrefix(key, o.prefix))
+		current, err := o.store.Get(key)
+		if err != nil && err != libprotoconf.ErrConfigNotFound {
+			return nil, err
+		}
+		if string(current) != string(values[key]) {
+			changed[key] = values[key]
+		}
+	}
+	sort.Strings(paths)
+	if len(changed) == 0 {
+		return paths, nil
+	}
+	if batch, ok := o.store.(libprotoconf.BatchStore); ok {
+		if err := batch.SetAll(changed); err != nil {
+			return nil, err
+		}
+	} else {
+		for key, value := range changed {
+			if err := o.store.Set(key, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for key := range changed {
+		log.Printf("Published config, path=%s", strings.TrimPrefix(key, o.prefix))
+	}
+	return paths, nil
+}
+
+// deleteConfigs deletes the configs of paths from the store, but for the
+// configs another resource publishes
+func (o *Operator) deleteConfigs(paths []string, published map[string]int) error {
+	for _, path := range paths {
+		if published[path] > 1 {
+			continue
+		}
+		if err := o.store.Delete(o.prefix + path); err != nil {
+			return err
+		}
+		published[path] = 0
+		log.Printf("Deleted config, path=%s", path)
+	}
+	return nil
+}
+
+// removed returns the paths of before missing from after
+func removed(before []string, after []string) []string {
+	kept := make(map[string]bool)
+	for _, path := range after {
+		kept[path] = true
+	}
+	var paths []string
+	for _, path := range before {
+		if !kept[path] {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// setCondition sets a condition of a status, its transition time changing
+// only when its status does
+func setCondition(status *ProtoconfConfigStatus, condition Condition) {
+	for i, c := range status.Conditions {
+		if c.Type != condition.Type {
+			continue
+		}
+		condition.LastTransitionTime = c.LastTransitionTime
+		if c.Status != condition.Status {
+			condition.LastTransitionTime = time.Now().UTC().Format(time.RFC3339)
+		}
+		status.Conditions[i] = condition
+		return
+	}
+	condition.LastTransitionTime = time.Now().UTC().Format(time.RFC3339)
+	status.Conditions = append(status.Conditions, condition)
+}
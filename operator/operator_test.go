@@ -0,0 +1,150 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/kube"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+)
+
+// fakeAPI serves the ProtoconfConfigs of the namespace prod
+type fakeAPI struct {
+	lock      sync.Mutex
+	resources map[string]*ProtoconfConfig
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/apis/protoconf.io/v1alpha1/namespaces/prod/protoconfconfigs")
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		list := &protoconfConfigList{}
+		for _, resource := range f.resources {
+			list.Items = append(list.Items, resource)
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPut:
+		resource := &ProtoconfConfig{}
+		if err := json.NewDecoder(r.Body).Decode(resource); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		current := f.resources[strings.TrimSuffix(strings.TrimPrefix(name, "/"), "/status")]
+		if current == nil || current.Metadata.ResourceVersion != resource.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		// The status is written only to the status subresource
+		if strings.HasSuffix(name, "/status") {
+			current.Status = resource.Status
+		} else {
+			current.Metadata = resource.Metadata
+		}
+		current.Metadata.ResourceVersion += "1"
+		json.NewEncoder(w).Encode(current)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeAPI) get(name string) *ProtoconfConfig {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	data, _ := json.Marshal(f.resources[name])
+	resource := &ProtoconfConfig{}
+	json.Unmarshal(data, resource)
+	return resource
+}
+
+func condition(resource *ProtoconfConfig, conditionType string) Condition {
+	for _, c := range resource.Status.Conditions {
+		if c.Type == conditionType {
+			return c
+		}
+	}
+	return Condition{}
+}
+
+const flagsProto = `syntax = "proto3";
+message Flags {
+  bool enabled = 1;
+}
+`
+
+func TestOperator(t *testing.T) {
+	root, err := ioutil.TempDir("", "operator")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	srcDir := filepath.Join(root, consts.SrcPath)
+	assert.NoError(t, os.MkdirAll(srcDir, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, "flags.proto"), []byte(flagsProto), 0644))
+	writeSource := func(source string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, "flags.pconf"), []byte(source), 0644))
+	}
+	writeSource("load(\"flags.proto\", \"Flags\")\n\ndef main():\n    return Flags(enabled=True)\n")
+
+	api := &fakeAPI{resources: map[string]*ProtoconfConfig{
+		"flags": {Metadata: kube.ObjectMeta{Name: "flags", Namespace: "prod", ResourceVersion: "1", Generation: 1}, Spec: ProtoconfConfigSpec{Source: "flags.pconf"}},
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	client, err := kube.NewClient(server.URL, "", "")
+	assert.NoError(t, err)
+	store := libprotoconf.NewMemoryStore()
+	operator := New(client, store, "", root, "prod")
+	ctx := context.Background()
+
+	assert.NoError(t, operator.Reconcile(ctx))
+	resource := api.get("flags")
+	assert.Equal(t, []string{Finalizer}, resource.Metadata.Finalizers)
+	assert.Equal(t, "True", condition(resource, ConditionCompiled).Status)
+	assert.Equal(t, "True", condition(resource, ConditionPublished).Status)
+	assert.Equal(t, []string{"flags"}, resource.Status.Paths)
+	assert.Equal(t, int64(1), resource.Status.ObservedGeneration)
+	published, err := store.Get("flags")
+	assert.NoError(t, err)
+
+	// Reconciling again changes nothing
+	version := resource.Metadata.ResourceVersion
+	assert.NoError(t, operator.Reconcile(ctx))
+	assert.Equal(t, version, api.get("flags").Metadata.ResourceVersion)
+
+	// A source failing to compile keeps the config published
+	writeSource("load(\"flags.proto\", \"Flags\")\n\ndef main():\n    return Flags(enabled=\"yes\")\n")
+	assert.NoError(t, operator.Reconcile(ctx))
+	resource = api.get("flags")
+	assert.Equal(t, "False", condition(resource, ConditionCompiled).Status)
+	assert.Equal(t, "CompileFailed", condition(resource, ConditionCompiled).Reason)
+	assert.Equal(t, "True", condition(resource, ConditionPublished).Status)
+	current, err := store.Get("flags")
+	assert.NoError(t, err)
+	assert.Equal(t, published, current)
+
+	writeSource("load(\"flags.proto\", \"Flags\")\n\ndef main():\n    return Flags(enabled=False)\n")
+	assert.NoError(t, operator.Reconcile(ctx))
+	assert.Equal(t, "True", condition(api.get("flags"), ConditionCompiled).Status)
+	current, err = store.Get("flags")
+	assert.NoError(t, err)
+	assert.NotEqual(t, published, current)
+
+	// Deleting the resource deletes its config
+	api.lock.Lock()
+	api.resources["flags"].Metadata.DeletionTimestamp = "2024-01-01T00:00:00Z"
+	api.lock.Unlock()
+	assert.NoError(t, operator.Reconcile(ctx))
+	assert.Empty(t, api.get("flags").Metadata.Finalizers)
+	_, err = store.Get("flags")
+	assert.Equal(t, libprotoconf.ErrConfigNotFound, err)
+}
@@ -0,0 +1,99 @@
+package protoconfload
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+)
+
+// The reasons of the failures to update the configs
+const (
+	failedSubscribe = "subscribe"
+	failedType      = "type"
+	failedApply     = "apply"
+	failedInvalid   = "invalid"
+)
+
+var (
+	versionGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "protoconf_client_config_version",
+		Help: "The version of the last value of every config applied, 1 for the version applied",
+	}, []string{"path", "version"})
+	lastUpdateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "protoconf_client_config_last_update_timestamp_seconds",
+		Help: "When the last value of every config was received, as a Unix time",
+	}, []string{"path"})
+	updateFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "protoconf_client_config_update_failures_total",
+		Help: "How many times the configs failed to be updated, by config and reason: subscribe when their subscription failed, type when a value was of another type, apply when a value failed to be decoded, invalid when a value failed to be validated",
+	}, []string{"path", "reason"})
+	staleGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "protoconf_client_config_stale",
+		Help: "1 for the configs whose last value is stale, served while their store can't be read or kept while their subscription is down",
+	}, []string{"path"})
+)
+
+func init() {
+	prometheus.MustRegister(versionGauge, lastUpdateGauge, updateFailuresCounter, staleGauge)
+}
+
+// Hooks are called by a client as the configs it subscribed to are updated,
+// from the goroutines receiving their values. The hooks not set aren't
+// called.
+type Hooks struct {
+	// OnUpdate is called with every value of a config applied, whether it
+	// changed or not
+	OnUpdate func(path string, message proto.Message, version string)
+	// OnError is called when the subscription of a config fails, with
+	// reason subscribe, and when a value is rejected: with reason type when
+	// it's of another type than the message of the config, apply when it
+	// fails to be decoded and invalid when it fails to be validated
+	OnError func(path string, reason string, err error)
+	// OnStale is called when the last value of a config becomes stale, as
+	// Config.Stale tells, and once it's fresh again
+	OnStale func(path string, stale bool)
+	// OnState is called when the state of the client changes, as
+	// Client.State tells
+	OnState func(state State)
+}
+
+// SetHooks sets the hooks of the client, before it subscribes to the configs
+func (c *Client) SetHooks(hooks Hooks) {
+	c.hooks = hooks
+}
+
+// updated reports the value of a config applied
+func (c *Client) updated(config *Config) {
+	value := config.value.Load()
+	if value.version != config.reportedVersion {
+		if config.reportedVersion != "" {
+			versionGauge.DeleteLabelValues(config.path, config.reportedVersion)
+		}
+		versionGauge.WithLabelValues(config.path, value.version).Set(1)
+		config.reportedVersion = value.version
+	}
+	lastUpdateGauge.WithLabelValues(config.path).SetToCurrentTime()
+	if c.hooks.OnUpdate != nil {
+		c.hooks.OnUpdate(config.path, value.message, value.version)
+	}
+}
+
+// failed reports a failure to update a config
+func (c *Client) failed(config *Config, reason string, err error) {
+	updateFailuresCounter.WithLabelValues(config.path, reason).Inc()
+	if c.hooks.OnError != nil {
+		c.hooks.OnError(config.path, reason, err)
+	}
+}
+
+// setStale reports whether the last value of a config is stale, calling
+// the hook when it changes
+func (c *Client) setStale(config *Config, stale bool) {
+	if stale {
+		staleGauge.WithLabelValues(config.path).Set(1)
+	} else {
+		staleGauge.WithLabelValues(config.path).Set(0)
+	}
+	if config.stale.Swap(stale) != stale && c.hooks.OnStale != nil {
+		c.hooks.OnStale(config.path, stale)
+	}
+}
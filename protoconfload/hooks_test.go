@@ -0,0 +1,125 @@
+package protoconfload
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/protoconf/protoconf/agent"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// resultsWatcher sends the results of its channel to every watch, each
+// watch ending with the first error
+type resultsWatcher struct {
+	results chan libprotoconf.Result
+}
+
+func (w *resultsWatcher) Watch(path string, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	watchCh := make(chan libprotoconf.Result)
+	go func() {
+		defer close(watchCh)
+		for {
+			select {
+			case result := <-w.results:
+				watchCh <- result
+				if result.Error != nil {
+					return
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return watchCh, nil
+}
+
+func (w *resultsWatcher) Close() {}
+
+func TestHooks(t *testing.T) {
+	watcher := &resultsWatcher{results: make(chan libprotoconf.Result)}
+	client := NewWatcherClient(watcher, 10*time.Millisecond)
+	events := make(chan string, 10)
+	client.SetHooks(Hooks{
+		OnUpdate: func(path string, message proto.Message, version string) {
+			events <- "update " + path + " " + message.(*wrapperspb.StringValue).GetValue()
+		},
+		OnError: func(path string, reason string, err error) {
+			events <- "error " + path + " " + reason
+		},
+		OnStale: func(path string, stale bool) {
+			if stale {
+				events <- "stale " + path
+			} else {
+				events <- "fresh " + path
+			}
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	send := func(result libprotoconf.Result) {
+		select {
+		case watcher.results <- result:
+		case <-ctx.Done():
+			t.Fatal("timed out sending the result")
+		}
+	}
+	receive := func() string {
+		select {
+		case event := <-events:
+			return event
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the hook")
+		}
+		return ""
+	}
+	value := func(message proto.Message) *anypb.Any {
+		value, err := anypb.New(message)
+		assert.NoError(t, err)
+		return value
+	}
+
+	config := client.Subscribe(ctx, "hooks/api", &wrapperspb.StringValue{}, nil)
+	first := value(wrapperspb.String("first"))
+	send(libprotoconf.Result{Value: first})
+	assert.Equal(t, "update hooks/api first", receive())
+	assert.Equal(t, 1.0, testutil.ToFloat64(versionGauge.WithLabelValues("hooks/api", agent.Version(first))))
+	assert.NotZero(t, testutil.ToFloat64(lastUpdateGauge.WithLabelValues("hooks/api")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(staleGauge.WithLabelValues("hooks/api")))
+
+	// The values failing to be applied are reported
+	typeFailures := testutil.ToFloat64(updateFailuresCounter.WithLabelValues("hooks/api", failedType))
+	subscribeFailures := testutil.ToFloat64(updateFailuresCounter.WithLabelValues("hooks/api", failedSubscribe))
+	send(libprotoconf.Result{Value: value(wrapperspb.Int32(1))})
+	assert.Equal(t, "error hooks/api type", receive())
+	assert.Equal(t, typeFailures+1, testutil.ToFloat64(updateFailuresCounter.WithLabelValues("hooks/api", failedType)))
+
+	// and the values served stale
+	second := value(wrapperspb.String("second"))
+	send(libprotoconf.Result{Value: second, Stale: true})
+	assert.Equal(t, "update hooks/api second", receive())
+	assert.Equal(t, "stale hooks/api", receive())
+	assert.True(t, config.Stale())
+	assert.Equal(t, 1.0, testutil.ToFloat64(staleGauge.WithLabelValues("hooks/api")))
+	// The version replaced is no longer reported
+	assert.False(t, versionGauge.DeleteLabelValues("hooks/api", agent.Version(first)))
+	send(libprotoconf.Result{Value: second})
+	assert.Equal(t, "update hooks/api second", receive())
+	assert.Equal(t, "fresh hooks/api", receive())
+	assert.False(t, config.Stale())
+
+	// The value kept while the subscription fails is stale
+	send(libprotoconf.Result{Error: errors.New("unreachable")})
+	assert.Equal(t, "error hooks/api subscribe", receive())
+	assert.Equal(t, "stale hooks/api", receive())
+	assert.Equal(t, subscribeFailures+1, testutil.ToFloat64(updateFailuresCounter.WithLabelValues("hooks/api", failedSubscribe)))
+	send(libprotoconf.Result{Value: second})
+	assert.Equal(t, "update hooks/api second", receive())
+	assert.Equal(t, "fresh hooks/api", receive())
+}
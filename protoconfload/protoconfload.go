@@ -0,0 +1,304 @@
+// Package protoconfload loads configs into the Go services using them and
+// reloads them when they change, either from an agent or a server or from
+// the configs materialized to a protoconf root
+package protoconfload
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// DefaultRetryInterval is how long the client waits by default to subscribe
+// to a config again after its subscription fails, the wait doubling with
+// every failure in a row up to DefaultMaxRetryInterval
+const DefaultRetryInterval = time.Second
+
+// DefaultMaxRetryInterval is how long the client waits by default at most to
+// subscribe to a config again
+const DefaultMaxRetryInterval = time.Minute
+
+// Load reads the config materialized to protoconfRoot at path into config,
+// failing when the config is of another type
+func Load(protoconfRoot string, path string, config proto.Message) error {
+	value, err := utils.ReadConfig(protoconfRoot, path)
+	if err != nil {
+		return err
+	}
+	return unmarshal(value.GetValue(), config)
+}
+
+// Client subscribes to the configs served by the ProtoconfService of an
+// agent or a server, or watches them with a watcher
+type Client struct {
+	service          protoconfservice.ProtoconfServiceClient
+	client           libprotoconf.Client
+	watcher          libprotoconf.Watcher
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+	hooks            Hooks
+	validator        Validator
+
+	// stateLock guards the state of the client and of its subscriptions
+	stateLock     sync.Mutex
+	state         State
+	subscriptions map[*Config]State
+	// reportLock guards the state reported last
+	reportLock    sync.Mutex
+	reportedState State
+}
+
+// NewClient returns a client subscribing to the configs served over conn,
+// identified by the ID and the labels of client, which the rollouts and the
+// targeting rules of the configs select the values for. The subscriptions
+// failing are subscribed again after retryInterval, backing off up to
+// DefaultMaxRetryInterval as they keep failing. A retryInterval which isn't
+// positive is DefaultRetryInterval.
+func NewClient(conn grpc.ClientConnInterface, client libprotoconf.Client, retryInterval time.Duration) *Client {
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+	return &Client{
+		service:          protoconfservice.NewProtoconfServiceClient(conn),
+		client:           client,
+		retryInterval:    retryInterval,
+		maxRetryInterval: DefaultMaxRetryInterval,
+		subscriptions:    make(map[*Config]State),
+	}
+}
+
+// NewFileClient returns a client watching the configs materialized to
+// protoconfRoot, without an agent, reading them again when their files
+// change. The configs which fail to be read, such as before they are
+// compiled, are read again after retryInterval, backing off as NewClient
+// does.
+func NewFileClient(protoconfRoot string, retryInterval time.Duration) (*Client, error) {
+	watcher, err := libprotoconf.NewFileWatcher(protoconfRoot)
+	if err != nil {
+		return nil, err
+	}
+	return NewWatcherClient(watcher, retryInterval), nil
+}
+
+// NewWatcherClient returns a client watching the configs with watcher, such
+// as a libprotoconf.NewStoreWatcher of a memory store in the tests. The
+// watches failing are watched again after retryInterval, backing off as
+// NewClient does.
+func NewWatcherClient(watcher libprotoconf.Watcher, retryInterval time.Duration) *Client {
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+	return &Client{
+		watcher:          watcher,
+		retryInterval:    retryInterval,
+		maxRetryInterval: DefaultMaxRetryInterval,
+		subscriptions:    make(map[*Config]State),
+	}
+}
+
+// Close closes the watcher of the client. The connection of a client of the
+// ProtoconfService is closed by its owner.
+func (c *Client) Close() {
+	if c.watcher != nil {
+		c.watcher.Close()
+	}
+}
+
+// Config is a config subscribed to, holding its last value. Its value is
+// swapped atomically, so it's read by any goroutine without locking.
+type Config struct {
+	path      string
+	prototype proto.Message
+	onChange  func(proto.Message)
+	value     atomic.Pointer[configValue]
+	ready     chan struct{}
+	readyOnce sync.Once
+	stale     atomic.Bool
+	// reportedVersion is the version the metrics report as current
+	reportedVersion string
+	// failures counts the subscriptions which failed in a row
+	failures int
+}
+
+type configValue struct {
+	message proto.Message
+	version string
+}
+
+// Subscribe subscribes to the config at path until ctx is done. The values
+// of the config are unmarshaled into new messages of the type of config and
+// validated by the validator of the client, the values of other types and
+// the invalid values are reported and skipped, keeping the last value.
+// onChange, when not nil, is called with every value changed, the first
+// value included, from the goroutine receiving the values, so the values
+// following wait for it to return.
+func (c *Client) Subscribe(ctx context.Context, path string, config proto.Message, onChange func(proto.Message)) *Config {
+	subscribed := &Config{
+		path:      path,
+		prototype: config,
+		onChange:  onChange,
+		ready:     make(chan struct{}),
+	}
+	go c.run(ctx, subscribed)
+	return subscribed
+}
+
+// Get returns the last value of the config, nil until the first value is
+// received. The value returned is shared, it must not be modified.
+func (c *Config) Get() proto.Message {
+	if value := c.value.Load(); value != nil {
+		return value.message
+	}
+	return nil
+}
+
+// Version returns the version of the last value of the config
+func (c *Config) Version() string {
+	if value := c.value.Load(); value != nil {
+		return value.version
+	}
+	return ""
+}
+
+// Stale tells whether the last value of the config is stale: its agent
+// serves it while its store can't be read, or its subscription failed and
+// is being made again
+func (c *Config) Stale() bool {
+	return c.stale.Load()
+}
+
+// Wait waits for the first value of the config, or for ctx to be done
+func (c *Config) Wait(ctx context.Context) error {
+	select {
+	case <-c.ready:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error waiting for config, path=%s err=%w", c.path, ctx.Err())
+	}
+}
+
+// apply swaps in a value of the config, and tells whether it changed
+func (c *Config) apply(message proto.Message, version string) bool {
+	current := c.value.Load()
+	c.value.Store(&configValue{message: message, version: version})
+	c.readyOnce.Do(func() { close(c.ready) })
+	if current != nil && proto.Equal(current.message, message) {
+		return false
+	}
+	if c.onChange != nil {
+		c.onChange(message)
+	}
+	return true
+}
+
+// update applies a value received, reporting it, and tells whether it was
+// applied
+func (c *Client) update(config *Config, value *anypb.Any, version string, stale bool) bool {
+	message, reason, err := c.decode(config, value)
+	if err != nil {
+		log.Printf("Error applying config, keeping the last value, path=%s version=%s reason=%s err=%s", config.path, version, reason, err)
+		c.failed(config, reason, err)
+		return false
+	}
+	if config.apply(message, version) {
+		log.Printf("Config changed, path=%s version=%s stale=%t", config.path, version, stale)
+	}
+	c.updated(config)
+	c.setStale(config, stale)
+	return true
+}
+
+func unmarshal(value *anypb.Any, config proto.Message) error {
+	if err := value.UnmarshalTo(config); err != nil {
+		return fmt.Errorf("error decoding config, expected type=%s received type=%s err=%s", config.ProtoReflect().Descriptor().FullName(), value.GetTypeUrl(), err)
+	}
+	return nil
+}
+
+// run subscribes to a config until ctx is done, subscribing again when the
+// subscription fails, after a delay backing off as it keeps failing
+func (c *Client) run(ctx context.Context, config *Config) {
+	c.setSubscriptionState(config, Connecting)
+	defer c.removeSubscription(config)
+	for {
+		err := c.subscribe(ctx, config)
+		if ctx.Err() != nil {
+			return
+		}
+		delay := c.retryDelay(config.failures)
+		config.failures++
+		log.Printf("Error subscribing to config, retrying in %s, path=%s failures=%d err=%s", delay, config.path, config.failures, err)
+		c.setSubscriptionState(config, Reconnecting)
+		c.failed(config, failedSubscribe, err)
+		if config.Get() != nil {
+			c.setStale(config, true)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) subscribe(ctx context.Context, config *Config) error {
+	if c.watcher != nil {
+		return c.watch(ctx, config)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.service.SubscribeForConfig(ctx, &protoconfservice.ConfigSubscriptionRequest{Path: config.path, ClientId: c.client.ID, Labels: c.client.Labels})
+	if err != nil {
+		return err
+	}
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		c.received(config)
+		if c.update(config, update.GetValue(), update.GetVersion(), update.GetStale()) {
+			c.acknowledge(ctx, config.path, update.GetVersion())
+		}
+	}
+}
+
+// watch watches a config with the watcher of the client, its versions
+// computed as the agents compute them
+func (c *Client) watch(ctx context.Context, config *Config) error {
+	watchCh, err := c.watcher.Watch(config.path, ctx.Done())
+	if err != nil {
+		return err
+	}
+	for result := range watchCh {
+		if result.Error != nil {
+			return result.Error
+		}
+		c.received(config)
+		c.update(config, result.Value, agent.Version(result.Value), result.Stale)
+	}
+	return fmt.Errorf("the watch of the config ended, path=%s", config.path)
+}
+
+// acknowledge reports the version of the config applied to the agent, which
+// lists it among the versions of its subscribers
+func (c *Client) acknowledge(ctx context.Context, path string, version string) {
+	if version == "" {
+		// Sent by an agent which doesn't track its subscribers
+		return
+	}
+	if _, err := c.service.Acknowledge(ctx, &protoconfservice.AcknowledgeRequest{Path: path, ClientId: c.client.ID, Version: version}); err != nil && ctx.Err() == nil {
+		log.Printf("Error acknowledging config, path=%s version=%s err=%s", path, version, err)
+	}
+}
@@ -0,0 +1,149 @@
+package protoconfload
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/testutil"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestClient(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("first")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+	agentServer := agent.NewServer(watcher, command.DefaultSubscriberQueue)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rpcServer := grpc.NewServer()
+	protoconfservice.RegisterProtoconfServiceServer(rpcServer, agentServer)
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewClient(conn, libprotoconf.Client{ID: "api-1"}, 10*time.Millisecond)
+	changes := make(chan string, 10)
+	config := client.Subscribe(ctx, "services/api", &wrapperspb.StringValue{}, func(message proto.Message) {
+		changes <- message.(*wrapperspb.StringValue).GetValue()
+	})
+	receive := func() string {
+		select {
+		case value := <-changes:
+			return value
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the change")
+		}
+		return ""
+	}
+
+	// The first value is applied and acknowledged
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	assert.NoError(t, config.Wait(waitCtx))
+	assert.Equal(t, "first", config.Get().(*wrapperspb.StringValue).GetValue())
+	assert.Equal(t, "first", receive())
+	assert.Equal(t, agent.Version(testutil.MustAny(t, wrapperspb.String("first"))), config.Version())
+	assert.Eventually(t, func() bool {
+		response, err := agentServer.ListSubscribers(ctx, &protoconfservice.ListSubscribersRequest{})
+		assert.NoError(t, err)
+		return len(response.GetSubscribers()) == 1 && response.GetSubscribers()[0].GetAcknowledgedVersion() == config.Version()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The values of another type are skipped
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.Int32(1)))
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("second")))
+	assert.Equal(t, "second", receive())
+	assert.Equal(t, "second", config.Get().(*wrapperspb.StringValue).GetValue())
+
+	// A config which doesn't exist yet is waited for
+	missing := client.Subscribe(ctx, "services/web", &wrapperspb.StringValue{}, nil)
+	assert.Nil(t, missing.Get())
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shortCancel()
+	assert.Error(t, missing.Wait(shortCtx))
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("web")))
+	assert.NoError(t, missing.Wait(waitCtx))
+	assert.Equal(t, "web", missing.Get().(*wrapperspb.StringValue).GetValue())
+}
+
+// materialize writes a string config materialized to root, as the compiler
+// writes it
+func materialize(t *testing.T, root string, path string, value string) {
+	filename := filepath.Join(root, consts.CompiledConfigPath, filepath.FromSlash(path)+consts.CompiledConfigExtension)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+	materialized := fmt.Sprintf(`{"protoFile": "google/protobuf/wrappers.proto", "value": {"@type": "type.googleapis.com/google.protobuf.StringValue", "value": %q}}`, value)
+	// The file is renamed over the previous one, for the watchers never to
+	// read it partly written
+	assert.NoError(t, ioutil.WriteFile(filename+".tmp", []byte(materialized), 0644))
+	assert.NoError(t, os.Rename(filename+".tmp", filename))
+}
+
+func TestFileClient(t *testing.T) {
+	root, err := ioutil.TempDir("", "protoconfload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, consts.SrcPath), 0755))
+	materialize(t, root, "services/api", "first")
+
+	client, err := NewFileClient(root, 10*time.Millisecond)
+	assert.NoError(t, err)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changes := make(chan string, 10)
+	config := client.Subscribe(ctx, "services/api", &wrapperspb.StringValue{}, func(message proto.Message) {
+		changes <- message.(*wrapperspb.StringValue).GetValue()
+	})
+	assert.NoError(t, config.Wait(ctx))
+	assert.Equal(t, "first", <-changes)
+	assert.Equal(t, agent.Version(testutil.MustAny(t, wrapperspb.String("first"))), config.Version())
+
+	// The config is read again once its file changes
+	materialize(t, root, "services/api", "second")
+	select {
+	case value := <-changes:
+		assert.Equal(t, "second", value)
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for the change")
+	}
+	assert.Equal(t, "second", config.Get().(*wrapperspb.StringValue).GetValue())
+
+	// A config compiled after it's watched is read once it's materialized
+	web := client.Subscribe(ctx, "services/web", &wrapperspb.StringValue{}, nil)
+	materialize(t, root, "services/web", "web")
+	assert.NoError(t, web.Wait(ctx))
+	assert.Equal(t, "web", web.Get().(*wrapperspb.StringValue).GetValue())
+}
+
+func TestLoad(t *testing.T) {
+	root, err := ioutil.TempDir("", "protoconfload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, consts.SrcPath), 0755))
+	materialize(t, root, "services/api", "api")
+
+	config := &wrapperspb.StringValue{}
+	assert.NoError(t, Load(root, "services/api", config))
+	assert.Equal(t, "api", config.GetValue())
+	assert.Error(t, Load(root, "services/api", &wrapperspb.Int32Value{}))
+	assert.Error(t, Load(root, "services/web", config))
+}
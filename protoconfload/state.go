@@ -0,0 +1,125 @@
+package protoconfload
+
+import (
+	"log"
+	"math/rand"
+	"time"
+)
+
+// State is the state of the subscriptions of a client
+type State int
+
+const (
+	// Connecting is the state of the subscriptions until they receive
+	// their first value
+	Connecting State = iota
+	// Connected is the state of the subscriptions receiving their values
+	Connected
+	// Reconnecting is the state of the subscriptions which failed, being
+	// made again after a delay
+	Reconnecting
+)
+
+func (s State) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	}
+	return "unknown"
+}
+
+// SetMaxRetryInterval sets how long the client waits at most to subscribe
+// to a config again, before it subscribes to the configs. A max retry
+// interval shorter than the retry interval of the client is its retry
+// interval.
+func (c *Client) SetMaxRetryInterval(maxRetryInterval time.Duration) {
+	c.maxRetryInterval = maxRetryInterval
+}
+
+// State returns the state of the client: Reconnecting while a subscription
+// failed, or else Connecting while a subscription didn't receive a value
+// yet, or else Connected
+func (c *Client) State() State {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.state
+}
+
+// retryDelay is how long to wait to subscribe again after failures in a row:
+// the retry interval doubled for every failure before, up to the max retry
+// interval, and jittered between half of it and all of it for the clients
+// disconnected together to subscribe again apart
+func (c *Client) retryDelay(failures int) time.Duration {
+	delay, maxDelay := c.retryInterval, c.maxRetryInterval
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+	for i := 0; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay < 2 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// received records the subscription of a config receiving a value, which
+// resets its backoff
+func (c *Client) received(config *Config) {
+	config.failures = 0
+	c.setSubscriptionState(config, Connected)
+}
+
+func (c *Client) setSubscriptionState(config *Config, state State) {
+	c.stateLock.Lock()
+	c.subscriptions[config] = state
+	c.updateState()
+}
+
+func (c *Client) removeSubscription(config *Config) {
+	c.stateLock.Lock()
+	delete(c.subscriptions, config)
+	c.updateState()
+}
+
+// updateState computes the state of the client from the states of its
+// subscriptions, and unlocks the state to report it
+func (c *Client) updateState() {
+	state := Connected
+	for _, subscriptionState := range c.subscriptions {
+		if subscriptionState == Reconnecting {
+			state = Reconnecting
+			break
+		}
+		if subscriptionState == Connecting {
+			state = Connecting
+		}
+	}
+	c.state = state
+	c.stateLock.Unlock()
+	c.reportState()
+}
+
+// reportState reports the state of the client when it changed since it was
+// reported last. The states changing together are reported in order, the
+// current state last.
+func (c *Client) reportState() {
+	c.reportLock.Lock()
+	defer c.reportLock.Unlock()
+	state := c.State()
+	if state == c.reportedState {
+		return
+	}
+	c.reportedState = state
+	log.Printf("Client state changed, state=%s", state)
+	if c.hooks.OnState != nil {
+		c.hooks.OnState(state)
+	}
+}
@@ -0,0 +1,101 @@
+package protoconfload
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRetryDelay(t *testing.T) {
+	client := &Client{retryInterval: time.Second, maxRetryInterval: time.Minute}
+	for failures, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute} {
+		for i := 0; i < 10; i++ {
+			delay := client.retryDelay(failures)
+			assert.GreaterOrEqual(t, delay, max/2, failures)
+			assert.Less(t, delay, max, failures)
+		}
+	}
+	assert.Less(t, client.retryDelay(1000), time.Minute)
+
+	// The clients never retry without waiting
+	client = NewWatcherClient(nil, 0)
+	assert.GreaterOrEqual(t, client.retryDelay(0), DefaultRetryInterval/2)
+	client.SetMaxRetryInterval(0)
+	assert.GreaterOrEqual(t, client.retryDelay(10), DefaultRetryInterval/2)
+}
+
+func TestReconnect(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("api")))
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("web")))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	serve := func(listener net.Listener) *grpc.Server {
+		rpcServer := grpc.NewServer()
+		protoconfservice.RegisterProtoconfServiceServer(rpcServer, agent.NewServer(watcher, command.DefaultSubscriberQueue))
+		go rpcServer.Serve(listener)
+		return rpcServer
+	}
+	rpcServer := serve(listener)
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client := NewClient(conn, libprotoconf.Client{}, 10*time.Millisecond)
+	client.SetMaxRetryInterval(50 * time.Millisecond)
+	states := make(chan State, 100)
+	client.SetHooks(Hooks{OnState: func(state State) { states <- state }})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	waitState := func(expected State) {
+		for {
+			select {
+			case state := <-states:
+				if state == expected {
+					assert.Equal(t, expected, client.State())
+					return
+				}
+			case <-ctx.Done():
+				t.Fatalf("timed out waiting for state %s", expected)
+			}
+		}
+	}
+
+	assert.Equal(t, Connecting, client.State())
+	api := client.Subscribe(ctx, "services/api", &wrapperspb.StringValue{}, nil)
+	web := client.Subscribe(ctx, "services/web", &wrapperspb.StringValue{}, nil)
+	waitState(Connected)
+	assert.NoError(t, api.Wait(ctx))
+	assert.NoError(t, web.Wait(ctx))
+
+	// The configs are kept stale while the agent is down
+	rpcServer.Stop()
+	waitState(Reconnecting)
+	assert.Eventually(t, func() bool { return api.Stale() && web.Stale() }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "api", api.Get().(*wrapperspb.StringValue).GetValue())
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("api v2")))
+	assert.NoError(t, store.SetConfig("services/web", wrapperspb.String("web v2")))
+
+	// and every config is subscribed to again once it's back
+	listener, err = net.Listen("tcp", address)
+	assert.NoError(t, err)
+	rpcServer = serve(listener)
+	defer rpcServer.Stop()
+	waitState(Connected)
+	assert.Eventually(t, func() bool {
+		return api.Get().(*wrapperspb.StringValue).GetValue() == "api v2" && web.Get().(*wrapperspb.StringValue).GetValue() == "web v2"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return !api.Stale() && !web.Stale() }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,110 @@
+package protoconfload
+
+import (
+	"context"
+	"sync"
+
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// Message is the pointer to a message T, the type of a config watched
+type Message[T any] interface {
+	*T
+	proto.Message
+}
+
+// TypedConfig is a config watched by the type of its message
+type TypedConfig[T any, P Message[T]] struct {
+	config  *Config
+	changes chan *T
+}
+
+var (
+	defaultLock   sync.Mutex
+	defaultClient *Client
+)
+
+// SetDefaultClient sets the client Watch subscribes to the configs with
+func SetDefaultClient(client *Client) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	defaultClient = client
+}
+
+// DefaultClient returns the client Watch subscribes to the configs with, the
+// client of the agent at consts.AgentDefaultAddress unless SetDefaultClient
+// set another
+func DefaultClient() *Client {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	if defaultClient == nil {
+		// The connection is made in the background, dialing fails only with
+		// invalid options
+		conn, err := grpc.Dial(consts.AgentDefaultAddress, grpc.WithInsecure())
+		if err != nil {
+			panic(err)
+		}
+		defaultClient = NewClient(conn, libprotoconf.Client{}, DefaultRetryInterval)
+	}
+	return defaultClient
+}
+
+// Watch subscribes to the config at key with the default client until ctx
+// is done, its values unmarshaled into messages of type T, e.g.
+//
+//	crawler := protoconfload.Watch[pb.CrawlerService](ctx, "crawler/text_crawler")
+func Watch[T any, P Message[T]](ctx context.Context, key string) *TypedConfig[T, P] {
+	return WatchWith[T, P](ctx, DefaultClient(), key)
+}
+
+// WatchWith subscribes to the config at key with client until ctx is done,
+// its values unmarshaled into messages of type T
+func WatchWith[T any, P Message[T]](ctx context.Context, client *Client, key string) *TypedConfig[T, P] {
+	typed := &TypedConfig[T, P]{changes: make(chan *T, 1)}
+	typed.config = client.Subscribe(ctx, key, P(new(T)), typed.changed)
+	return typed
+}
+
+// changed sends a value changed, replacing the value not received yet
+func (c *TypedConfig[T, P]) changed(message proto.Message) {
+	select {
+	case <-c.changes:
+	default:
+	}
+	c.changes <- (*T)(message.(P))
+}
+
+// Get returns the last value of the config, nil until the first value is
+// received. The value returned is shared, it must not be modified.
+func (c *TypedConfig[T, P]) Get() *T {
+	if message, ok := c.config.Get().(P); ok {
+		return (*T)(message)
+	}
+	return nil
+}
+
+// Changes receives the values of the config as they change, the first value
+// included. A value not received yet is replaced by the value following it,
+// so the channel never blocks the config and holds its latest value. It's
+// not closed.
+func (c *TypedConfig[T, P]) Changes() <-chan *T {
+	return c.changes
+}
+
+// Version returns the version of the last value of the config
+func (c *TypedConfig[T, P]) Version() string {
+	return c.config.Version()
+}
+
+// Stale tells whether the last value of the config is stale
+func (c *TypedConfig[T, P]) Stale() bool {
+	return c.config.Stale()
+}
+
+// Wait waits for the first value of the config, or for ctx to be done
+func (c *TypedConfig[T, P]) Wait(ctx context.Context) error {
+	return c.config.Wait(ctx)
+}
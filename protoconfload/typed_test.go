@@ -0,0 +1,56 @@
+package protoconfload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestWatch(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("first")))
+	client := NewWatcherClient(libprotoconf.NewStoreWatcher(store, ""), 10*time.Millisecond)
+	defer client.Close()
+	SetDefaultClient(client)
+	defer SetDefaultClient(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receive := func(changes <-chan *wrapperspb.StringValue) string {
+		select {
+		case value := <-changes:
+			return value.GetValue()
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the change")
+		}
+		return ""
+	}
+
+	config := Watch[wrapperspb.StringValue](ctx, "services/api")
+	assert.Nil(t, config.Get())
+	assert.NoError(t, config.Wait(ctx))
+	assert.Equal(t, "first", config.Get().GetValue())
+	assert.Equal(t, "first", receive(config.Changes()))
+	assert.NotEmpty(t, config.Version())
+
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("second")))
+	assert.Equal(t, "second", receive(config.Changes()))
+	assert.Equal(t, "second", config.Get().GetValue())
+
+	// The values not received are replaced by the latest
+	changes := &TypedConfig[wrapperspb.StringValue, *wrapperspb.StringValue]{changes: make(chan *wrapperspb.StringValue, 1)}
+	changes.changed(wrapperspb.String("third"))
+	changes.changed(wrapperspb.String("fourth"))
+	assert.Equal(t, "fourth", receive(changes.Changes()))
+	assert.Empty(t, changes.Changes())
+
+	// The configs of another type are skipped
+	limit := WatchWith[wrapperspb.Int32Value](ctx, client, "services/api")
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shortCancel()
+	assert.Error(t, limit.Wait(shortCtx))
+	assert.Nil(t, limit.Get())
+}
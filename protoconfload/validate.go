@@ -0,0 +1,57 @@
+package protoconfload
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Validator checks a value of the config at path before it's applied, the
+// values failing are rejected
+type Validator func(path string, message proto.Message) error
+
+// ValidateGenerated runs the constraints of the messages generated along
+// with their Validate method, such as by protoc-gen-validate, as the
+// compiler checked them. The messages without one are valid.
+func ValidateGenerated(path string, message proto.Message) error {
+	if validated, ok := message.(interface{ Validate() error }); ok {
+		return validated.Validate()
+	}
+	return nil
+}
+
+// SetValidator sets the validator of the values of the configs, such as
+// ValidateGenerated, before the client subscribes to the configs
+func (c *Client) SetValidator(validator Validator) {
+	c.validator = validator
+}
+
+// decode unmarshals a value of a config into a new message of its type and
+// validates it, telling the reason it's rejected for when it fails
+func (c *Client) decode(config *Config, value *anypb.Any) (proto.Message, string, error) {
+	expected := config.prototype.ProtoReflect().Descriptor().FullName()
+	if value.MessageName() != expected {
+		return nil, failedType, fmt.Errorf("the value is a %s, expected a %s", value.MessageName(), expected)
+	}
+	message := config.prototype.ProtoReflect().New().Interface()
+	if err := proto.Unmarshal(value.GetValue(), message); err != nil {
+		return nil, failedApply, fmt.Errorf("error decoding config, type=%s err=%s", expected, err)
+	}
+	if c.validator != nil {
+		if err := c.validate(config.path, message); err != nil {
+			return nil, failedInvalid, fmt.Errorf("invalid config, err=%w", err)
+		}
+	}
+	return message, "", nil
+}
+
+// validate runs the validator, failing when it panics
+func (c *Client) validate(path string, message proto.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("the validator panicked, %v", r)
+		}
+	}()
+	return c.validator(path, message)
+}
@@ -0,0 +1,95 @@
+package protoconfload
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// validatedString is a message with a Validate method, as protoc-gen-validate
+// generates them
+type validatedString struct {
+	*wrapperspb.StringValue
+}
+
+func (s validatedString) Validate() error {
+	if s.GetValue() == "" {
+		return errors.New("invalid StringValue.Value: value length must be at least 1 runes")
+	}
+	return nil
+}
+
+func TestValidateGenerated(t *testing.T) {
+	assert.NoError(t, ValidateGenerated("services/api", validatedString{wrapperspb.String("api")}))
+	assert.Error(t, ValidateGenerated("services/api", validatedString{wrapperspb.String("")}))
+	assert.NoError(t, ValidateGenerated("services/api", wrapperspb.String("")))
+}
+
+func TestValidator(t *testing.T) {
+	watcher := &resultsWatcher{results: make(chan libprotoconf.Result)}
+	client := NewWatcherClient(watcher, 10*time.Millisecond)
+	errs := make(chan string, 10)
+	client.SetHooks(Hooks{OnError: func(path string, reason string, err error) {
+		errs <- reason + ": " + err.Error()
+	}})
+	client.SetValidator(func(path string, message proto.Message) error {
+		switch message.(*wrapperspb.StringValue).GetValue() {
+		case "":
+			return errors.New("the value is empty")
+		case "panic":
+			var missing *wrapperspb.StringValue
+			_ = missing.Value
+		}
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	send := func(value *anypb.Any) {
+		select {
+		case watcher.results <- libprotoconf.Result{Value: value}:
+		case <-ctx.Done():
+			t.Fatal("timed out sending the value")
+		}
+	}
+	receive := func() string {
+		select {
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the error")
+		}
+		return ""
+	}
+	value := func(message proto.Message) *anypb.Any {
+		value, err := anypb.New(message)
+		assert.NoError(t, err)
+		return value
+	}
+
+	config := client.Subscribe(ctx, "services/api", &wrapperspb.StringValue{}, nil)
+	send(value(wrapperspb.String("first")))
+	assert.NoError(t, config.Wait(ctx))
+
+	// The values rejected are reported, the last value is kept
+	send(value(wrapperspb.Int32(1)))
+	assert.Equal(t, "type: the value is a google.protobuf.Int32Value, expected a google.protobuf.StringValue", receive())
+	send(&anypb.Any{TypeUrl: "type.googleapis.com/google.protobuf.StringValue", Value: []byte{0xff}})
+	assert.Contains(t, receive(), "apply: error decoding config")
+	send(value(wrapperspb.String("")))
+	assert.Equal(t, "invalid: invalid config, err=the value is empty", receive())
+	send(value(wrapperspb.String("panic")))
+	assert.Contains(t, receive(), "invalid: invalid config, err=the validator panicked")
+	assert.Equal(t, "first", config.Get().(*wrapperspb.StringValue).GetValue())
+
+	send(value(wrapperspb.String("second")))
+	assert.Eventually(t, func() bool {
+		return config.Get().(*wrapperspb.StringValue).GetValue() == "second"
+	}, 5*time.Second, 10*time.Millisecond)
+}
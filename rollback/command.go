@@ -0,0 +1,150 @@
+package rollback
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/webhook"
+)
+
+type cliCommand struct{}
+
+type cliConfig struct {
+	to           int64
+	list         bool
+	auditLog     string
+	webhooksPath string
+	identity     string
+}
+
+func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... config_path")
+		fmt.Fprintln(flags.Output(), "Rolls a config back to a version of its history with -to, lists its versions with -list.")
+		flags.PrintDefaults()
+	}
+
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+
+	config := &cliConfig{}
+	flags.Int64Var(&config.to, "to", 0, "Version of the history of the config to roll back to, as listed by -list")
+	flags.BoolVar(&config.list, "list", false, "List the versions of the config kept in its history")
+	audit.AddFlag(flags, &config.auditLog)
+	webhook.AddFlag(flags, &config.webhooksPath)
+	flags.StringVar(&config.identity, "identity", audit.LocalIdentity(), "Who the rollback is recorded as in the audit log")
+
+	return flags, config, kVConfig
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config, kVConfig := newFlagSet()
+	flags.Parse(args)
+	// The options may follow the path too, protoconf rollback path -to 3
+	if flags.NArg() > 1 {
+		path := flags.Arg(0)
+		flags.Parse(flags.Args()[1:])
+		args = append([]string{path}, flags.Args()...)
+	} else {
+		args = flags.Args()
+	}
+
+	if len(args) != 1 || (config.to > 0) == config.list {
+		flags.Usage()
+		return 1
+	}
+	path := filepath.ToSlash(strings.TrimSpace(args[0]))
+
+	store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	if err != nil {
+		log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	defer store.Close()
+
+	if config.list {
+		versions, err := Versions(kVConfig.WithHistory(store), kVConfig.Prefix, path)
+		if err != nil {
+			log.Printf("Error listing versions of config %s, err=%s", path, err)
+			return 1
+		}
+		printVersions(os.Stdout, versions)
+		return 0
+	}
+
+	var auditLog audit.Log
+	if config.auditLog != "" {
+		auditLog, err = audit.Open(config.auditLog, func() (libprotoconf.Store, error) { return store, nil })
+		if err != nil {
+			log.Printf("Error opening audit log, err=%s", err)
+			return 1
+		}
+	}
+	var webhooks audit.Log
+	if config.webhooksPath != "" {
+		notifier, err := webhook.Read(store, kVConfig.Prefix, config.webhooksPath)
+		if err != nil {
+			log.Printf("Error loading webhooks, err=%s", err)
+			return 1
+		}
+		defer notifier.Wait()
+		webhooks = notifier
+	}
+	auditLog = audit.Tee(auditLog, webhooks)
+	entry, err := Rollback(kVConfig.WithHistory(store), kVConfig.Prefix, path, config.to, "")
+	if err != nil {
+		log.Printf("Error rolling back config %s, err=%s", path, err)
+		return 1
+	}
+	fmt.Printf("Path %s rolled back to version %d\n", path, config.to)
+	if auditLog != nil {
+		entry.Time, entry.Identity = time.Now(), config.identity
+		if err := auditLog.Append(entry); err != nil {
+			log.Printf("Error, config %s was rolled back but not recorded to the audit log, err=%s", path, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// printVersions prints the versions of a config, a line per version
+func printVersions(w io.Writer, versions []*libprotoconf.ConfigVersion) {
+	for _, version := range versions {
+		line := fmt.Sprintf("%d %s", version.Version, version.CreatedAt.UTC().Format(time.RFC3339))
+		if version.Value == nil {
+			line += " deleted"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _, _ := newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return "Rolls a config of the key-value store back to a version of its history"
+}
+
+// Command is a cli.CommandFactory
+func Command() (cli.Command, error) {
+	return &cliCommand{}, nil
+}
@@ -0,0 +1,103 @@
+// Package rollback rolls the configs of a key-value store back to the
+// versions kept in their history, without building them again
+package rollback
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/utils"
+)
+
+var (
+	// ErrNoHistory is returned for the stores keeping no history of the
+	// configs
+	ErrNoHistory = errors.New("the store keeps no history of the configs, keep it with -history")
+	// ErrVersionNotFound is returned when rolling back to a version which
+	// isn't in the history of the config
+	ErrVersionNotFound = errors.New("version not found in the history of the config")
+)
+
+// Versions lists the versions of the config of path kept in the history of
+// store, the oldest first
+func Versions(store libprotoconf.Store, prefix string, path string) ([]*libprotoconf.ConfigVersion, error) {
+	versions, err := store.History(prefix + path)
+	if err == libprotoconf.ErrHistoryNotSupported {
+		return nil, ErrNoHistory
+	}
+	return versions, err
+}
+
+// Rollback writes the value of the config of path at version as a new value
+// of the config, on the condition that the config isn't changed meanwhile in
+// the stores with versions. It returns the change for the audit log, along
+// with the fields changed when protoconfRoot is set.
+func Rollback(store libprotoconf.Store, prefix string, path string, version int64, protoconfRoot string) (*audit.Entry, error) {
+	versions, err := Versions(store, prefix, path)
+	if err != nil {
+		return nil, err
+	}
+	var target *libprotoconf.ConfigVersion
+	for _, v := range versions {
+		if v.Version == version {
+			target = v
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w, path=%s version=%d", ErrVersionNotFound, path, version)
+	}
+	if target.Value == nil {
+		return nil, fmt.Errorf("version %d deleted the config, delete it with protoconf insert -d instead, path=%s", version, path)
+	}
+
+	key := prefix + path
+	entry := &audit.Entry{Action: audit.ActionRollback, Path: path}
+	var current []byte
+	versioned, isVersioned := store.(libprotoconf.VersionedStore)
+	if isVersioned {
+		current, entry.OldVersion, err = versioned.GetVersion(key)
+	} else {
+		current, err = store.Get(key)
+	}
+	if err != nil && err != libprotoconf.ErrConfigNotFound {
+		return nil, err
+	}
+	if bytes.Equal(current, target.Value) {
+		return nil, fmt.Errorf("the config is at the value of version %d already, path=%s", version, path)
+	}
+
+	if isVersioned {
+		// A deleted config is written only if it's still deleted
+		entry.NewVersion, err = versioned.SetIfVersion(key, target.Value, entry.OldVersion)
+	} else {
+		err = store.Set(key, target.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil && protoconfRoot != "" {
+		entry.Changes, err = changes(current, target.Value, protoconfRoot)
+		if err != nil {
+			log.Printf("Error comparing config %s to record its changes, err=%s", path, err)
+		}
+	}
+	return entry, nil
+}
+
+func changes(current []byte, rolledBack []byte, protoconfRoot string) ([]string, error) {
+	old, err := libprotoconf.DecodeConfig(current)
+	if err != nil {
+		return nil, err
+	}
+	new, err := libprotoconf.DecodeConfig(rolledBack)
+	if err != nil {
+		return nil, err
+	}
+	diffs, err := utils.DiffConfigs(old, new, protoconfRoot)
+	return audit.Changes(diffs), err
+}
@@ -0,0 +1,74 @@
+package rollback
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+)
+
+type noHistory struct {
+	*libprotoconf.MemoryStore
+}
+
+func (s noHistory) History(string) ([]*libprotoconf.ConfigVersion, error) {
+	return nil, libprotoconf.ErrHistoryNotSupported
+}
+
+func TestRollback(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.Set("protoconf/services/api", []byte("v1")))
+	assert.NoError(t, store.Set("protoconf/services/api", []byte("v2")))
+
+	versions, err := Versions(store, "protoconf/", "services/api")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+
+	entry, err := Rollback(store, "protoconf/", "services/api", versions[0].Version, "")
+	assert.NoError(t, err)
+	assert.Equal(t, audit.ActionRollback, entry.Action)
+	assert.Equal(t, "services/api", entry.Path)
+	assert.NotEqual(t, entry.OldVersion, entry.NewVersion)
+	value, err := store.Get("protoconf/services/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(value))
+
+	// The rollback is a version of its own
+	versions, err = Versions(store, "protoconf/", "services/api")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+
+	_, err = Rollback(store, "protoconf/", "services/api", versions[0].Version, "")
+	assert.Error(t, err, "the config is at the value of the version already")
+	_, err = Rollback(store, "protoconf/", "services/api", 100, "")
+	assert.True(t, errors.Is(err, ErrVersionNotFound))
+
+	// A deleted config is rolled back to its last value
+	assert.NoError(t, store.Delete("protoconf/services/api"))
+	versions, err = Versions(store, "protoconf/", "services/api")
+	assert.NoError(t, err)
+	_, err = Rollback(store, "protoconf/", "services/api", versions[len(versions)-1].Version, "")
+	assert.Error(t, err, "rolled back to a deletion")
+	_, err = Rollback(store, "protoconf/", "services/api", versions[1].Version, "")
+	assert.NoError(t, err)
+	value, err = store.Get("protoconf/services/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(value))
+
+	_, err = Versions(noHistory{libprotoconf.NewMemoryStore()}, "protoconf/", "services/api")
+	assert.Equal(t, ErrNoHistory, err)
+}
+
+func TestPrintVersions(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var b bytes.Buffer
+	printVersions(&b, []*libprotoconf.ConfigVersion{
+		{Version: 1, Value: []byte("v1"), CreatedAt: created},
+		{Version: 2, CreatedAt: created.Add(time.Hour)},
+	})
+	assert.Equal(t, "1 2020-01-02T03:04:05Z\n2 2020-01-02T04:04:05Z deleted\n", b.String())
+}
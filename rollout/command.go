@@ -0,0 +1,193 @@
+package rollout
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/webhook"
+)
+
+// The actions of the rollout commands
+const (
+	actionStatus  = "status"
+	actionPause   = "pause"
+	actionResume  = "resume"
+	actionAbort   = "abort"
+	actionPromote = "promote"
+)
+
+var synopses = map[string]string{
+	actionStatus:  "Prints the rollouts of the configs",
+	actionPause:   "Pauses the rollout of a config at its current step, the canaries have no steps",
+	actionResume:  "Resumes the paused rollout of a config",
+	actionAbort:   "Aborts the rollout of a config, serving its value to every subscriber again",
+	actionPromote: "Promotes the new value of the rollout or the canary of a config to the value of the config",
+}
+
+type cliCommand struct {
+	action string
+}
+
+type cliConfig struct {
+	auditLog     string
+	webhooksPath string
+	identity     string
+}
+
+func (c *cliCommand) newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		if c.action == actionStatus {
+			fmt.Fprintln(flags.Output(), "Usage: [OPTION]... [config_path]")
+		} else {
+			fmt.Fprintln(flags.Output(), "Usage: [OPTION]... config_path")
+		}
+		flags.PrintDefaults()
+	}
+
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+
+	config := &cliConfig{}
+	if c.action == actionPromote {
+		audit.AddFlag(flags, &config.auditLog)
+		webhook.AddFlag(flags, &config.webhooksPath)
+		flags.StringVar(&config.identity, "identity", audit.LocalIdentity(), "Who the promotion is recorded as in the audit log")
+	}
+
+	return flags, config, kVConfig
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config, kVConfig := c.newFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() > 1 || (c.action != actionStatus && flags.NArg() != 1) {
+		flags.Usage()
+		return 1
+	}
+	path := ""
+	if flags.NArg() == 1 {
+		path = filepath.ToSlash(strings.TrimSpace(flags.Arg(0)))
+	}
+
+	store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	if err != nil {
+		log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	defer store.Close()
+	manager := NewManager(kVConfig.WithHistory(store), kVConfig.Prefix)
+
+	switch c.action {
+	case actionStatus:
+		var rollouts []*Rollout
+		if path == "" {
+			rollouts, err = manager.List()
+		} else {
+			var r *Rollout
+			r, err = manager.Get(path)
+			rollouts = []*Rollout{r}
+		}
+		if err != nil {
+			log.Printf("Error reading rollouts, err=%s", err)
+			return 1
+		}
+		for _, r := range rollouts {
+			printRollout(os.Stdout, r, time.Now())
+		}
+		return 0
+	case actionPause:
+		_, err = manager.Pause(path)
+	case actionResume:
+		_, err = manager.Resume(path, time.Now())
+	case actionAbort:
+		err = manager.Abort(path)
+	case actionPromote:
+		var auditLog, webhooks audit.Log
+		if config.auditLog != "" {
+			auditLog, err = audit.Open(config.auditLog, func() (libprotoconf.Store, error) { return store, nil })
+			if err != nil {
+				log.Printf("Error opening audit log, err=%s", err)
+				return 1
+			}
+		}
+		if config.webhooksPath != "" {
+			notifier, err := webhook.Read(store, kVConfig.Prefix, config.webhooksPath)
+			if err != nil {
+				log.Printf("Error loading webhooks, err=%s", err)
+				return 1
+			}
+			defer notifier.Wait()
+			webhooks = notifier
+		}
+		manager.Audit = audit.Tee(auditLog, webhooks)
+		err = manager.Promote(path, config.identity)
+	}
+	if err != nil {
+		log.Printf("Error running rollout %s, path=%s err=%s", c.action, path, err)
+		return 1
+	}
+	return 0
+}
+
+// printRollout prints a rollout as a line
+func printRollout(w io.Writer, r *Rollout, now time.Time) {
+	if r.Canary != nil {
+		fmt.Fprintf(w, "%s canary to %s, started %s by %s, waiting to be promoted\n", r.Path, r.Canary, r.Started.UTC().Format(time.RFC3339), r.Identity)
+		return
+	}
+	line := fmt.Sprintf("%s %s at %d%% of the subscribers, step %d/%d of %s, started %s by %s", r.Path, r.State, r.Percentage(), r.Step+1, len(r.Policy), r.Policy, r.Started.UTC().Format(time.RFC3339), r.Identity)
+	switch next := r.NextStep(); {
+	case r.State != StateRunning:
+	case next.IsZero():
+		line += ", waiting to be promoted"
+	case !now.Before(next):
+		line += ", waiting for protoconf serve -rollouts to advance it"
+	case r.Step == len(r.Policy)-1:
+		line += fmt.Sprintf(", promoted in %s", next.Sub(now).Round(time.Second))
+	default:
+		line += fmt.Sprintf(", next step in %s", next.Sub(now).Round(time.Second))
+	}
+	fmt.Fprintln(w, line)
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _, _ := c.newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return synopses[c.action]
+}
+
+func factory(action string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &cliCommand{action: action}, nil
+	}
+}
+
+// The cli.CommandFactory of the rollout commands
+var (
+	StatusCommand  = factory(actionStatus)
+	PauseCommand   = factory(actionPause)
+	ResumeCommand  = factory(actionResume)
+	AbortCommand   = factory(actionAbort)
+	PromoteCommand = factory(actionPromote)
+)
@@ -0,0 +1,450 @@
+// Package rollout rolls out new values of configs gradually. A new value is
+// served to an increasing percentage of the subscribers of its config, step by
+// step as the policy of the rollout says, until it's promoted to the value of
+// the config or aborted. Subscribers are picked by a consistent hash of their
+// identity, so that a subscriber keeps the new value as the percentage grows.
+// A canary serves a new value to the subscribers it names, by their identity
+// or their labels, instead of a percentage of them, until it's promoted or
+// aborted.
+package rollout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// Prefix starts the keys of the rollouts in the key-value store, following
+// the prefix of the configs: prefix + Prefix + the path of the config
+const Prefix = ".rollouts/"
+
+// The states of the rollouts
+const (
+	StateRunning = "running"
+	StatePaused  = "paused"
+	StateCanary  = "canary"
+)
+
+var (
+	// ErrNoRollout is returned for the configs which aren't rolled out
+	ErrNoRollout = errors.New("the config isn't rolled out")
+	// ErrRolledOut is returned when starting a rollout of a config which is
+	// rolled out already
+	ErrRolledOut = errors.New("the config is rolled out already, promote or abort its rollout first")
+)
+
+// Step is a step of a rollout, serving the new value to Percentage of the
+// subscribers for Wait
+type Step struct {
+	Percentage int           `json:"percentage"`
+	Wait       time.Duration `json:"wait"`
+}
+
+// Policy is the steps of a rollout
+type Policy []Step
+
+// ParsePolicy parses a policy, its steps as percentage:wait separated by
+// commas, e.g. 1:10m,10:30m,50:1h,100:1h. Percentages are increasing, from 1
+// to 100. The new value is promoted once the wait of the last step is over,
+// or by hand when the last step has no wait.
+func ParsePolicy(s string) (Policy, error) {
+	var policy Policy
+	for i, part := range strings.Split(s, ",") {
+		percentage, wait := strings.TrimSpace(part), ""
+		if n := strings.Index(percentage, ":"); n >= 0 {
+			percentage, wait = percentage[:n], percentage[n+1:]
+		}
+		step := Step{}
+		var err error
+		if step.Percentage, err = strconv.Atoi(strings.TrimSuffix(percentage, "%")); err != nil {
+			return nil, fmt.Errorf("invalid rollout step %s, expected percentage:wait", part)
+		}
+		if step.Percentage < 1 || step.Percentage > 100 || (i > 0 && step.Percentage <= policy[i-1].Percentage) {
+			return nil, fmt.Errorf("invalid rollout step %s, percentages increase from 1 to 100", part)
+		}
+		if wait != "" {
+			if step.Wait, err = time.ParseDuration(wait); err != nil || step.Wait <= 0 {
+				return nil, fmt.Errorf("invalid rollout step %s, the wait is a duration such as 30m", part)
+			}
+		}
+		policy = append(policy, step)
+	}
+	for _, step := range policy[:len(policy)-1] {
+		if step.Wait == 0 {
+			return nil, fmt.Errorf("invalid rollout policy %s, only the last step can be left without a wait", s)
+		}
+	}
+	return policy, nil
+}
+
+func (p Policy) String() string {
+	var steps []string
+	for _, step := range p {
+		if step.Wait == 0 {
+			steps = append(steps, strconv.Itoa(step.Percentage))
+		} else {
+			steps = append(steps, fmt.Sprintf("%d:%s", step.Percentage, step.Wait))
+		}
+	}
+	return strings.Join(steps, ",")
+}
+
+// Canary is the subscribers a canary serves its new value to, the clients
+// of its IDs and the clients matching its labels, the values of the labels
+// being globs as in the targeting rules
+type Canary struct {
+	Clients []string          `json:"clients,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// Selects tells whether the new value is served to client
+func (c *Canary) Selects(client libprotoconf.Client) bool {
+	for _, id := range c.Clients {
+		if id == client.ID {
+			return true
+		}
+	}
+	return len(c.Labels) > 0 && client.Matches(c.Labels)
+}
+
+func (c *Canary) String() string {
+	var parts []string
+	if len(c.Clients) > 0 {
+		parts = append(parts, "the clients "+strings.Join(c.Clients, ","))
+	}
+	if len(c.Labels) > 0 {
+		var labels []string
+		for name, value := range c.Labels {
+			labels = append(labels, name+"="+value)
+		}
+		sort.Strings(labels)
+		parts = append(parts, "the clients matching "+strings.Join(labels, ","))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Rollout is the rollout of a new value of a config
+type Rollout struct {
+	Path string `json:"path"`
+	// Value is the new value, encoded as the configs are in the store
+	Value []byte `json:"value"`
+	// BaseVersion is the version of the config when the rollout started,
+	// the version the new value is promoted from. It's empty when the store
+	// has no versions.
+	BaseVersion string `json:"base_version,omitempty"`
+	Policy      Policy `json:"policy"`
+	// Canary is the subscribers served the new value of a canary, which has
+	// no policy
+	Canary *Canary `json:"canary,omitempty"`
+	// Step is the index of the current step of the policy
+	Step  int    `json:"step"`
+	State string `json:"state"`
+	// Identity is who started the rollout
+	Identity string    `json:"identity"`
+	Started  time.Time `json:"started"`
+	// StepStarted is when the current step started, or when the rollout was
+	// resumed last, the wait of a paused step starts over
+	StepStarted time.Time `json:"step_started"`
+
+	// version is the version of the rollout in the store
+	version string
+}
+
+// Percentage is the percentage of the subscribers served the new value, 0
+// for the canaries
+func (r *Rollout) Percentage() int {
+	if r.Canary != nil {
+		return 0
+	}
+	return r.Policy[r.Step].Percentage
+}
+
+// Selects tells whether the new value is served to the subscriber client
+func (r *Rollout) Selects(client string) bool {
+	return bucket(r.Path, client) < r.Percentage()*100
+}
+
+// Serves tells whether the new value is served to client, by the canary of
+// the rollout or by the percentage of its step
+func (r *Rollout) Serves(client libprotoconf.Client) bool {
+	if r.Canary != nil {
+		return r.Canary.Selects(client)
+	}
+	return r.Selects(client.ID)
+}
+
+// NextStep is when the rollout moves on to its next step or is promoted, zero
+// when it waits to be promoted by hand, as the canaries do
+func (r *Rollout) NextStep() time.Time {
+	if r.Canary != nil || r.Policy[r.Step].Wait == 0 {
+		return time.Time{}
+	}
+	return r.StepStarted.Add(r.Policy[r.Step].Wait)
+}
+
+// bucket places a client in one of 10000 buckets of a config. Clients are
+// placed by config, so that the same clients aren't the first to get the new
+// values of every config.
+func bucket(path string, client string) int {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write([]byte(client))
+	return int(h.Sum32() % 10000)
+}
+
+// Manager manages the rollouts of the configs of a key-value store
+type Manager struct {
+	store  libprotoconf.Store
+	prefix string
+	// Audit records the promotions, nil to record nothing
+	Audit audit.Log
+}
+
+// NewManager manages the rollouts of the configs written to store under
+// prefix
+func NewManager(store libprotoconf.Store, prefix string) *Manager {
+	return &Manager{store: store, prefix: prefix}
+}
+
+func (m *Manager) key(path string) string {
+	return m.prefix + Prefix + path
+}
+
+// Get reads the rollout of a config, ErrNoRollout when it isn't rolled out
+func (m *Manager) Get(path string) (*Rollout, error) {
+	var data []byte
+	var version string
+	var err error
+	if versioned, ok := m.store.(libprotoconf.VersionedStore); ok {
+		data, version, err = versioned.GetVersion(m.key(path))
+	} else {
+		data, err = m.store.Get(m.key(path))
+	}
+	if err == libprotoconf.ErrConfigNotFound {
+		return nil, ErrNoRollout
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &Rollout{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("error reading rollout, path=%s err=%s", path, err)
+	}
+	if r.Canary == nil && (len(r.Policy) == 0 || r.Step >= len(r.Policy)) {
+		return nil, fmt.Errorf("invalid rollout, path=%s step=%d policy=%s", path, r.Step, r.Policy)
+	}
+	r.version = version
+	return r, nil
+}
+
+// List reads the rollouts of the configs, in the order of their paths
+func (m *Manager) List() ([]*Rollout, error) {
+	keys, err := m.store.List(m.prefix + Prefix)
+	if err != nil {
+		return nil, err
+	}
+	var rollouts []*Rollout
+	for _, key := range keys {
+		r, err := m.Get(strings.TrimPrefix(key, m.prefix+Prefix))
+		if err == ErrNoRollout {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rollouts = append(rollouts, r)
+	}
+	return rollouts, nil
+}
+
+// write writes a rollout, on the condition that it wasn't changed since it
+// was read in the stores with versions
+func (m *Manager) write(r *Rollout) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	versioned, ok := m.store.(libprotoconf.VersionedStore)
+	if !ok {
+		return m.store.Set(m.key(r.Path), data)
+	}
+	if _, err := versioned.SetIfVersion(m.key(r.Path), data, r.version); err != nil {
+		if err == libprotoconf.ErrVersionMismatch {
+			return fmt.Errorf("the rollout of %s was changed meanwhile, try again", r.Path)
+		}
+		return err
+	}
+	return nil
+}
+
+// Start starts rolling out value, a config encoded as it's stored, to the
+// subscribers of an existing config
+func (m *Manager) Start(path string, value []byte, policy Policy, identity string, now time.Time) (*Rollout, error) {
+	return m.start(&Rollout{Path: path, Value: value, Policy: policy, State: StateRunning, Identity: identity, Started: now, StepStarted: now})
+}
+
+// StartCanary starts serving value, a config encoded as it's stored, to the
+// subscribers of an existing config which canary selects, until the canary
+// is promoted or aborted
+func (m *Manager) StartCanary(path string, value []byte, canary *Canary, identity string, now time.Time) (*Rollout, error) {
+	if len(canary.Clients) == 0 && len(canary.Labels) == 0 {
+		return nil, errors.New("a canary selects at least one client or label")
+	}
+	return m.start(&Rollout{Path: path, Value: value, Canary: canary, State: StateCanary, Identity: identity, Started: now, StepStarted: now})
+}
+
+// start writes a new rollout of an existing config
+func (m *Manager) start(r *Rollout) (*Rollout, error) {
+	path := r.Path
+	if _, err := m.Get(path); err != ErrNoRollout {
+		if err == nil {
+			err = ErrRolledOut
+		}
+		return nil, err
+	}
+	if _, err := libprotoconf.DecodeConfig(r.Value); err != nil {
+		return nil, fmt.Errorf("error decoding config, path=%s err=%s", path, err)
+	}
+	var err error
+	if versioned, ok := m.store.(libprotoconf.VersionedStore); ok {
+		_, r.BaseVersion, err = versioned.GetVersion(m.prefix + path)
+	} else {
+		_, err = m.store.Get(m.prefix + path)
+	}
+	if err == libprotoconf.ErrConfigNotFound {
+		return nil, fmt.Errorf("config %s doesn't exist, only the new values of existing configs are rolled out", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := m.write(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Pause stops a rollout at its current step until it's resumed
+func (m *Manager) Pause(path string) (*Rollout, error) {
+	r, err := m.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if r.Canary != nil {
+		return nil, fmt.Errorf("the rollout of %s is a canary, it has no steps to pause", path)
+	}
+	r.State = StatePaused
+	return r, m.write(r)
+}
+
+// Resume resumes a paused rollout, the wait of its current step starts over
+func (m *Manager) Resume(path string, now time.Time) (*Rollout, error) {
+	r, err := m.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if r.State != StatePaused {
+		return nil, fmt.Errorf("the rollout of %s isn't paused", path)
+	}
+	r.State, r.StepStarted = StateRunning, now
+	return r, m.write(r)
+}
+
+// Abort stops a rollout, serving the value of the config to every subscriber
+// again
+func (m *Manager) Abort(path string) error {
+	if _, err := m.Get(path); err != nil {
+		return err
+	}
+	return m.store.Delete(m.key(path))
+}
+
+// Promote writes the new value of a rollout as the value of its config and
+// ends the rollout. It fails when the config was changed since the rollout
+// started, in the stores with versions.
+func (m *Manager) Promote(path string, identity string) error {
+	r, err := m.Get(path)
+	if err != nil {
+		return err
+	}
+	entry := &audit.Entry{Identity: identity, Action: audit.ActionPromote, Path: path, OldVersion: r.BaseVersion}
+	if versioned, ok := m.store.(libprotoconf.VersionedStore); ok {
+		entry.NewVersion, err = versioned.SetIfVersion(m.prefix+path, r.Value, r.BaseVersion)
+		if err == libprotoconf.ErrVersionMismatch {
+			return fmt.Errorf("config %s was changed since its rollout started, abort the rollout and start it again, err=%w", path, err)
+		}
+	} else {
+		err = m.store.Set(m.prefix+path, r.Value)
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.store.Delete(m.key(path)); err != nil {
+		return err
+	}
+	if m.Audit != nil {
+		entry.Time = time.Now()
+		if err := m.Audit.Append(entry); err != nil {
+			return fmt.Errorf("config %s was promoted but not recorded to the audit log, err=%s", path, err)
+		}
+	}
+	return nil
+}
+
+// Advance moves the running rollouts whose step is over to their next step,
+// and promotes the rollouts whose last step is over. Rollouts are advanced on
+// the condition that they weren't changed meanwhile in the stores with
+// versions, so that several servers can advance them.
+func (m *Manager) Advance(now time.Time) error {
+	rollouts, err := m.List()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range rollouts {
+		next := r.NextStep()
+		if r.State != StateRunning || next.IsZero() || now.Before(next) {
+			continue
+		}
+		if r.Step == len(r.Policy)-1 {
+			if err := m.Promote(r.Path, r.Identity); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			log.Printf("Rollout of %s promoted", r.Path)
+			continue
+		}
+		r.Step, r.StepStarted = r.Step+1, now
+		if err := m.write(r); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("Rollout of %s advanced to %d%% of the subscribers", r.Path, r.Percentage())
+	}
+	return errors.Join(errs...)
+}
+
+// Run advances the rollouts every interval until stopCh is closed
+func (m *Manager) Run(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := m.Advance(now); err != nil {
+				log.Printf("Error advancing rollouts, err=%s", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package rollout
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/libprotoconf/storetest"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("1:10m, 10%:30m,50:1h,100")
+	assert.NoError(t, err)
+	assert.Equal(t, Policy{{1, 10 * time.Minute}, {10, 30 * time.Minute}, {50, time.Hour}, {100, 0}}, policy)
+	assert.Equal(t, "1:10m0s,10:30m0s,50:1h0m0s,100", policy.String())
+
+	for _, invalid := range []string{"", "x:10m", "0:10m", "101", "10:10m,5:10m", "10:10m,10:10m", "10,50:1h", "10:soon", "10:-1m"} {
+		_, err := ParsePolicy(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSelects(t *testing.T) {
+	r := &Rollout{Path: "services/web", Policy: Policy{{10, time.Minute}, {50, time.Minute}, {100, 0}}}
+	selected := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		client := fmt.Sprintf("client-%d", i)
+		if r.Selects(client) {
+			selected[client] = true
+		}
+	}
+	assert.InDelta(t, 100, len(selected), 40)
+
+	// The clients selected stay selected as the percentage grows
+	r.Step = 1
+	count := 0
+	for i := 0; i < 1000; i++ {
+		client := fmt.Sprintf("client-%d", i)
+		if r.Selects(client) {
+			count++
+		} else {
+			assert.False(t, selected[client], client)
+		}
+	}
+	assert.InDelta(t, 500, count, 60)
+	r.Step = 2
+	assert.True(t, r.Selects("any"))
+
+	// Other configs select other clients
+	other := &Rollout{Path: "services/api", Policy: Policy{{10, time.Minute}}}
+	same := 0
+	for client := range selected {
+		if other.Selects(client) {
+			same++
+		}
+	}
+	assert.Less(t, same, len(selected)/2)
+}
+
+func TestManager(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	manager := NewManager(store, "prod/")
+	policy := Policy{{10, time.Minute}, {50, time.Hour}, {100, time.Hour}}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Only existing configs are rolled out
+	_, err := manager.Start("services/web", storetest.EncodeString(t, "new"), policy, "alice@host", now)
+	assert.Error(t, err)
+	assert.NoError(t, store.Set("prod/services/web", storetest.EncodeString(t, "old")))
+
+	r, err := manager.Start("services/web", storetest.EncodeString(t, "new"), policy, "alice@host", now)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, r.Percentage())
+	assert.NotEmpty(t, r.BaseVersion)
+	_, err = manager.Start("services/web", storetest.EncodeString(t, "newer"), policy, "bob@host", now)
+	assert.Equal(t, ErrRolledOut, err)
+	_, err = manager.Get("services/api")
+	assert.Equal(t, ErrNoRollout, err)
+
+	// Steps advance after their wait
+	assert.NoError(t, manager.Advance(now.Add(30*time.Second)))
+	r, err = manager.Get("services/web")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, r.Step)
+	assert.NoError(t, manager.Advance(now.Add(time.Minute)))
+	r, err = manager.Get("services/web")
+	assert.NoError(t, err)
+	assert.Equal(t, 50, r.Percentage())
+	assert.Equal(t, now.Add(time.Minute), r.StepStarted.UTC())
+
+	// Paused rollouts don't advance, the wait starts over when resumed
+	_, err = manager.Pause("services/web")
+	assert.NoError(t, err)
+	assert.NoError(t, manager.Advance(now.Add(3*time.Hour)))
+	r, err = manager.Get("services/web")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.Step)
+	_, err = manager.Resume("services/web", now.Add(3*time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, manager.Advance(now.Add(4*time.Hour)))
+	assert.NoError(t, manager.Advance(now.Add(5*time.Hour)))
+
+	// The last step over, the new value is promoted
+	_, err = manager.Get("services/web")
+	assert.Equal(t, ErrNoRollout, err)
+	value, err := store.Get("prod/services/web")
+	assert.NoError(t, err)
+	assert.Equal(t, storetest.EncodeString(t, "new"), value)
+
+	// Aborted rollouts leave the config as it is
+	_, err = manager.Start("services/web", storetest.EncodeString(t, "newer"), policy, "bob@host", now)
+	assert.NoError(t, err)
+	assert.NoError(t, manager.Abort("services/web"))
+	assert.Equal(t, ErrNoRollout, manager.Abort("services/web"))
+	value, err = store.Get("prod/services/web")
+	assert.NoError(t, err)
+	assert.Equal(t, storetest.EncodeString(t, "new"), value)
+
+	// The configs changed since their rollouts started aren't promoted
+	_, err = manager.Start("services/web", storetest.EncodeString(t, "newer"), policy, "bob@host", now)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set("prod/services/web", storetest.EncodeString(t, "changed")))
+	assert.ErrorIs(t, manager.Promote("services/web", "bob@host"), libprotoconf.ErrVersionMismatch)
+	rollouts, err := manager.List()
+	assert.NoError(t, err)
+	assert.Len(t, rollouts, 1)
+
+	var b bytes.Buffer
+	printRollout(&b, rollouts[0], now.Add(30*time.Second))
+	assert.Equal(t, "services/web running at 10% of the subscribers, step 1/3 of 10:1m0s,50:1h0m0s,100:1h0m0s, started 2026-01-02T03:04:05Z by bob@host, next step in 30s\n", b.String())
+}
+
+func TestWatcher(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	manager := NewManager(store, "")
+	assert.NoError(t, store.Set("services/web", storetest.EncodeString(t, "old")))
+	watcher := NewWatcher(libprotoconf.NewStoreWatcher(store, ""), manager, 10*time.Millisecond)
+	defer watcher.Close()
+
+	// A client selected at 50% and a client which isn't
+	r := &Rollout{Path: "services/web", Policy: Policy{{50, time.Minute}}}
+	var selected, other string
+	for i := 0; selected == "" || other == ""; i++ {
+		client := fmt.Sprintf("client-%d", i)
+		if r.Selects(client) {
+			selected = client
+		} else {
+			other = client
+		}
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	selectedCh, err := watcher.WatchClient("services/web", libprotoconf.Client{ID: selected}, stopCh)
+	assert.NoError(t, err)
+	otherCh, err := watcher.WatchClient("services/web", libprotoconf.Client{ID: other}, stopCh)
+	assert.NoError(t, err)
+	next := func(ch <-chan libprotoconf.Result) string {
+		select {
+		case result := <-ch:
+			assert.NoError(t, result.Error)
+			value := &wrapperspb.StringValue{}
+			assert.NoError(t, result.Value.UnmarshalTo(value))
+			return value.GetValue()
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+			return ""
+		}
+	}
+	assert.Equal(t, "old", next(selectedCh))
+	assert.Equal(t, "old", next(otherCh))
+
+	_, err = manager.Start("services/web", storetest.EncodeString(t, "new"), Policy{{50, time.Minute}, {100, 0}}, "alice@host", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "new", next(selectedCh))
+	assert.NoError(t, manager.Advance(time.Now().Add(time.Minute)))
+	assert.Equal(t, "new", next(otherCh))
+
+	assert.NoError(t, manager.Abort("services/web"))
+	assert.Equal(t, "old", next(selectedCh))
+	assert.Equal(t, "old", next(otherCh))
+
+	// The rollouts aren't listed as configs
+	paths, err := watcher.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/web"}, paths)
+}
+
+func TestCanary(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	manager := NewManager(store, "")
+	assert.NoError(t, store.Set("services/web", storetest.EncodeString(t, "old")))
+	watcher := NewWatcher(libprotoconf.NewStoreWatcher(store, ""), manager, 10*time.Millisecond)
+	defer watcher.Close()
+
+	_, err := manager.StartCanary("services/web", storetest.EncodeString(t, "new"), &Canary{}, "alice@host", time.Now())
+	assert.Error(t, err)
+	canary := &Canary{Clients: []string{"web-1"}, Labels: map[string]string{"host": "web-canary-*"}}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r, err := manager.StartCanary("services/web", storetest.EncodeString(t, "new"), canary, "alice@host", now)
+	assert.NoError(t, err)
+	assert.Equal(t, StateCanary, r.State)
+	_, err = manager.StartCanary("services/web", storetest.EncodeString(t, "newer"), canary, "alice@host", now)
+	assert.Equal(t, ErrRolledOut, err)
+
+	// The canaries wait to be promoted by hand
+	_, err = manager.Pause("services/web")
+	assert.Error(t, err)
+	assert.NoError(t, manager.Advance(now.Add(24*time.Hour)))
+	rollouts, err := manager.List()
+	assert.NoError(t, err)
+	assert.Len(t, rollouts, 1)
+	var b bytes.Buffer
+	printRollout(&b, rollouts[0], now)
+	assert.Equal(t, "services/web canary to the clients web-1 and the clients matching host=web-canary-*, started 2026-01-02T03:04:05Z by alice@host, waiting to be promoted\n", b.String())
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	next := func(client libprotoconf.Client) string {
+		ch, err := watcher.WatchClient("services/web", client, stopCh)
+		assert.NoError(t, err)
+		select {
+		case result := <-ch:
+			assert.NoError(t, result.Error)
+			value := &wrapperspb.StringValue{}
+			assert.NoError(t, result.Value.UnmarshalTo(value))
+			return value.GetValue()
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+			return ""
+		}
+	}
+	watcher.poll()
+	assert.Equal(t, "new", next(libprotoconf.Client{ID: "web-1"}))
+	assert.Equal(t, "new", next(libprotoconf.Client{ID: "web-7", Labels: map[string]string{"host": "web-canary-2"}}))
+	assert.Equal(t, "old", next(libprotoconf.Client{ID: "web-2", Labels: map[string]string{"host": "web-2"}}))
+
+	// Promoted, the new value is the value of the config
+	assert.NoError(t, manager.Promote("services/web", "alice@host"))
+	value, err := store.Get("services/web")
+	assert.NoError(t, err)
+	assert.Equal(t, storetest.EncodeString(t, "new"), value)
+	_, err = manager.Get("services/web")
+	assert.Equal(t, ErrNoRollout, err)
+}
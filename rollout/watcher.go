@@ -0,0 +1,209 @@
+package rollout
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// PollInterval is how often the watchers read the rollouts
+const PollInterval = 5 * time.Second
+
+// Watcher serves the new values of the configs rolled out to the subscribers
+// their rollouts select, and the values of another watcher otherwise. The
+// rollouts are read from the store every interval, as the store can't notify
+// the rollouts started before their keys exist.
+type Watcher struct {
+	libprotoconf.Watcher
+	manager *Manager
+
+	lock sync.Mutex
+	// rollouts are the rollouts read last by path, along with their JSON to
+	// tell their changes
+	rollouts map[string]*Rollout
+	data     map[string]string
+	// changes are notified of the changes of the rollouts of their path
+	changes map[string]map[chan struct{}]bool
+	stopCh  chan struct{}
+}
+
+// NewWatcher serves the rollouts of manager along with the configs of
+// watcher, reading the rollouts every interval until the watcher is closed
+func NewWatcher(watcher libprotoconf.Watcher, manager *Manager, interval time.Duration) *Watcher {
+	w := &Watcher{
+		Watcher:  watcher,
+		manager:  manager,
+		rollouts: make(map[string]*Rollout),
+		data:     make(map[string]string),
+		changes:  make(map[string]map[chan struct{}]bool),
+		stopCh:   make(chan struct{}),
+	}
+	w.poll()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.poll()
+			case <-w.stopCh:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// poll reads the rollouts and notifies the watches of the rollouts changed,
+// started or ended
+func (w *Watcher) poll() {
+	list, err := w.manager.List()
+	if err != nil {
+		log.Printf("Error reading rollouts, keeping the previous ones, err=%s", err)
+		return
+	}
+	rollouts := make(map[string]*Rollout)
+	data := make(map[string]string)
+	for _, r := range list {
+		encoded, err := json.Marshal(r)
+		if err != nil {
+			continue
+		}
+		rollouts[r.Path], data[r.Path] = r, string(encoded)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for path, changes := range w.changes {
+		if data[path] == w.data[path] {
+			continue
+		}
+		for ch := range changes {
+			select {
+			case ch <- struct{}{}:
+			default:
+				// Notified already
+			}
+		}
+	}
+	w.rollouts, w.data = rollouts, data
+}
+
+func (w *Watcher) rollout(path string) *Rollout {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.rollouts[path]
+}
+
+func (w *Watcher) notify(path string, ch chan struct{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.changes[path] == nil {
+		w.changes[path] = make(map[chan struct{}]bool)
+	}
+	w.changes[path][ch] = true
+}
+
+func (w *Watcher) stopNotifying(path string, ch chan struct{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.changes[path], ch)
+	if len(w.changes[path]) == 0 {
+		delete(w.changes, path)
+	}
+}
+
+// WatchClient watches a config as client sees it, the new value of its
+// rollout when the rollout or its canary selects client and the value of the
+// config otherwise. The value changes as the rollout advances, ends or the config
+// changes.
+func (w *Watcher) WatchClient(path string, client libprotoconf.Client, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	configStopCh := make(chan struct{})
+	configCh, err := w.Watcher.Watch(path, configStopCh)
+	if err != nil {
+		close(configStopCh)
+		return nil, err
+	}
+	changes := make(chan struct{}, 1)
+	w.notify(path, changes)
+
+	watchCh := make(chan libprotoconf.Result)
+	go func() {
+		defer func() {
+			w.stopNotifying(path, changes)
+			close(configStopCh)
+			close(watchCh)
+			// Drain the values sent until the watcher stops watching
+			for range configCh {
+			}
+		}()
+
+		var config libprotoconf.Result
+		var sent *anypb.Any
+		var sentStale bool
+		for {
+			select {
+			case result, ok := <-configCh:
+				if !ok {
+					return
+				}
+				if result.Error != nil {
+					select {
+					case watchCh <- result:
+					case <-stopCh:
+					}
+					return
+				}
+				config = result
+			case <-changes:
+				if config.Value == nil {
+					// The value of the config wasn't read yet
+					continue
+				}
+			case <-stopCh:
+				return
+			}
+
+			result := config
+			if r := w.rollout(path); r != nil && r.Serves(client) {
+				value, err := libprotoconf.DecodeConfig(r.Value)
+				if err != nil {
+					log.Printf("Error decoding the new value of the rollout of %s, serving the config, err=%s", path, err)
+				} else {
+					result = libprotoconf.Result{Value: value.GetValue(), Stale: config.Stale}
+				}
+			}
+			if sent != nil && proto.Equal(sent, result.Value) && result.Stale == sentStale {
+				continue
+			}
+			select {
+			case watchCh <- result:
+				sent, sentStale = result.Value, result.Stale
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return watchCh, nil
+}
+
+// List lists the configs of the watcher, when it's a libprotoconf.Lister
+func (w *Watcher) List(prefix string) ([]string, error) {
+	lister, ok := w.Watcher.(libprotoconf.Lister)
+	if !ok {
+		return nil, errors.New("listing configs isn't supported")
+	}
+	return lister.List(prefix)
+}
+
+// Close stops reading the rollouts and closes the watcher of the configs
+func (w *Watcher) Close() {
+	close(w.stopCh)
+	w.Watcher.Close()
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/rollout"
+	"github.com/protoconf/protoconf/targeting"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// configService serves configs to applications as the agent does, the
+// materialized configs of a protoconf root or the configs inserted to a
+// key-value store
+type configService struct {
+	protoconfservice.ProtoconfServiceServer
+	// protoconfRoot is the root configs are read from, empty when they are
+	// read from a key-value store
+	protoconfRoot string
+	// watcher watches the configs served, and the policy config
+	watcher libprotoconf.Watcher
+}
+
+// checkPath fails on paths which can't be the path of a config, and on the
+// configs missing from the materialized configs
+func (s configService) checkPath(path string) error {
+	if path == "" || path != filepath.ToSlash(filepath.Clean(path)) || strings.HasPrefix(path, "../") {
+		return status.Errorf(codes.InvalidArgument, "invalid config path, path=%s", path)
+	}
+	if s.protoconfRoot == "" {
+		return nil
+	}
+	filename := filepath.Join(s.protoconfRoot, consts.CompiledConfigPath, filepath.FromSlash(path)+consts.CompiledConfigExtension)
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return status.Errorf(codes.NotFound, "config not found, path=%s", path)
+	}
+	return nil
+}
+
+func (s configService) GetConfig(ctx context.Context, in *protoconfservice.GetConfigRequest) (*protoconfservice.ConfigUpdate, error) {
+	if err := s.checkPath(in.GetPath()); err != nil {
+		return nil, logError(err)
+	}
+	return s.ProtoconfServiceServer.GetConfig(ctx, in)
+}
+
+func (s configService) Evaluate(ctx context.Context, in *protoconfservice.EvaluateRequest) (*protoconfservice.EvaluateResponse, error) {
+	if err := s.checkPath(in.GetPath()); err != nil {
+		return nil, logError(err)
+	}
+	return s.ProtoconfServiceServer.Evaluate(ctx, in)
+}
+
+func (s configService) Acknowledge(ctx context.Context, in *protoconfservice.AcknowledgeRequest) (*protoconfservice.AcknowledgeResponse, error) {
+	if err := s.checkPath(in.GetPath()); err != nil {
+		return nil, logError(err)
+	}
+	return s.ProtoconfServiceServer.Acknowledge(ctx, in)
+}
+
+func (s configService) SubscribeForConfig(in *protoconfservice.ConfigSubscriptionRequest, srv protoconfservice.ProtoconfService_SubscribeForConfigServer) error {
+	if err := s.checkPath(in.GetPath()); err != nil {
+		return logError(err)
+	}
+	return s.ProtoconfServiceServer.SubscribeForConfig(in, srv)
+}
+
+func (s configService) SubscribeForConfigs(in *protoconfservice.ConfigsSubscriptionRequest, srv protoconfservice.ProtoconfService_SubscribeForConfigsServer) error {
+	if strings.HasPrefix(in.GetPattern(), "../") || strings.Contains(in.GetPattern(), "/../") {
+		return logError(status.Errorf(codes.InvalidArgument, "invalid pattern, pattern=%s", in.GetPattern()))
+	}
+	return s.ProtoconfServiceServer.SubscribeForConfigs(in, srv)
+}
+
+// newConfigService serves the configs of protoconfRoot, pushing the updates
+// of the configs subscribed to as they are compiled again. The subscribers
+// are disconnected when queueSize updates are waiting to be sent to them.
+func newConfigService(protoconfRoot string, queueSize int) (*configService, func(), error) {
+	watcher, err := libprotoconf.NewFileWatcher(protoconfRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &configService{ProtoconfServiceServer: agent.NewServer(watcher, queueSize), protoconfRoot: protoconfRoot, watcher: watcher}, watcher.Close, nil
+}
+
+// newStoreConfigService serves the configs inserted to a key-value store, such
+// as etcd, pushing the updates of the configs subscribed to as the store
+// notifies them. The new values of the configs rolled out are served to the
+// subscribers their rollouts select when rollouts isn't nil, and the values of
+// the targeting rules to the subscribers matching them when targetings isn't
+// nil. The store is closed along with the service.
+func newStoreConfigService(store libprotoconf.Store, prefix string, rollouts *rollout.Manager, targetings *targeting.Manager, queueSize int) (*configService, func()) {
+	watcher := libprotoconf.NewStoreWatcher(store, prefix)
+	if rollouts != nil {
+		watcher = rollout.NewWatcher(watcher, rollouts, rollout.PollInterval)
+	}
+	if targetings != nil {
+		watcher = targeting.NewWatcher(watcher, targetings, targeting.PollInterval)
+	}
+	return &configService{ProtoconfServiceServer: agent.NewServer(watcher, queueSize), watcher: watcher}, watcher.Close
+}
+
+// newRemoteConfigService serves the configs of the server conn connects to,
+// subscribing to them on behalf of the clients. The connection is closed
+// along with the service.
+func newRemoteConfigService(conn *grpc.ClientConn, queueSize int) (*configService, func()) {
+	watcher := agent.NewRemoteWatcher(conn)
+	return &configService{ProtoconfServiceServer: agent.NewServer(watcher, queueSize), watcher: watcher}, watcher.Close
+}
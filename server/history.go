@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/rollback"
+	protoconfmutation "github.com/protoconf/protoconf/server/api/proto/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// checkHistory fails on the servers which don't serve a key-value store and
+// on the invalid paths
+func (s server) checkHistory(path string) error {
+	if s.store == nil {
+		return status.Error(codes.FailedPrecondition, "the history of the configs is kept by servers serving the configs of a key-value store, with -from-store")
+	}
+	return (configService{}).checkPath(path)
+}
+
+// ListConfigVersions lists the versions of a config kept in its history
+func (s server) ListConfigVersions(ctx context.Context, in *protoconfmutation.ListConfigVersionsRequest) (*protoconfmutation.ListConfigVersionsResponse, error) {
+	if err := s.checkHistory(in.Path); err != nil {
+		return nil, logError(err)
+	}
+	versions, err := rollback.Versions(s.store, s.prefix, in.Path)
+	if err == rollback.ErrNoHistory {
+		return nil, logError(status.Error(codes.FailedPrecondition, err.Error()))
+	}
+	if err != nil {
+		return nil, logError(fmt.Errorf("error reading the history of the config, path=%s err=%s", in.Path, err))
+	}
+	response := &protoconfmutation.ListConfigVersionsResponse{}
+	for _, version := range versions {
+		v := &protoconfmutation.ConfigVersion{Version: version.Version, CreatedAt: timestamppb.New(version.CreatedAt)}
+		if version.Value != nil {
+			if v.Value, err = libprotoconf.DecodeConfig(version.Value); err != nil {
+				return nil, logError(fmt.Errorf("error decoding config, path=%s version=%d err=%s", in.Path, version.Version, err))
+			}
+		}
+		response.Versions = append(response.Versions, v)
+	}
+	return response, nil
+}
+
+// RollbackConfig writes a version of the history of a config as its new
+// version, on the condition that the config didn't change in between
+func (s server) RollbackConfig(ctx context.Context, in *protoconfmutation.ConfigRollbackRequest) (*protoconfmutation.ConfigMutationResponse, error) {
+	log.Printf("Rolling back path=%s version=%d", in.Path, in.Version)
+	if err := s.checkWritable(); err != nil {
+		return nil, logError(err)
+	}
+	if err := s.checkHistory(in.Path); err != nil {
+		return nil, logError(err)
+	}
+	entry, err := rollback.Rollback(s.store, s.prefix, in.Path, in.Version, s.protoconfRoot)
+	switch {
+	case err == rollback.ErrNoHistory:
+		return nil, logError(status.Error(codes.FailedPrecondition, err.Error()))
+	case errors.Is(err, rollback.ErrVersionNotFound):
+		return nil, logError(status.Error(codes.NotFound, err.Error()))
+	case err == libprotoconf.ErrVersionMismatch:
+		return nil, logError(status.Errorf(codes.FailedPrecondition, "the config was changed since it was read, path=%s", in.Path))
+	case err != nil:
+		return nil, logError(err)
+	}
+	log.Printf("Rolled back path=%s version=%s", in.Path, entry.NewVersion)
+	if err := s.record(ctx, entry); err != nil {
+		return nil, logError(err)
+	}
+	return &protoconfmutation.ConfigMutationResponse{Version: entry.NewVersion}, nil
+}
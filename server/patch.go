@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/compiler/lib"
+	"github.com/protoconf/protoconf/consts"
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/expiry"
+	"github.com/protoconf/protoconf/libprotoconf"
+	protoconfmutation "github.com/protoconf/protoconf/server/api/proto/v1"
+	"github.com/protoconf/protoconf/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// patchAttempts is how many times a patch without a version is applied
+// again when the config changes while it's patched
+const patchAttempts = 3
+
+// PatchConfig applies a patch to a config of the key-value store, validates
+// the config patched as the compiler would, and writes it as a new version of
+// the config on the condition that the config didn't change in between
+func (s server) PatchConfig(ctx context.Context, in *protoconfmutation.ConfigPatchRequest) (*protoconfmutation.ConfigMutationResponse, error) {
+	log.Printf("Patching path=%s fields=%v", in.Path, in.GetUpdateMask().GetPaths())
+	if err := s.checkWritable(); err != nil {
+		return nil, logError(err)
+	}
+	if s.store == nil {
+		return nil, logError(status.Error(codes.FailedPrecondition, "patches are accepted by servers serving the configs of a key-value store, with -from-store"))
+	}
+	store, ok := s.store.(libprotoconf.VersionedStore)
+	if !ok {
+		return nil, logError(status.Error(codes.FailedPrecondition, "the key-value store doesn't support writing configs on the condition of their versions"))
+	}
+	if err := (configService{}).checkPath(in.Path); err != nil {
+		return nil, logError(err)
+	}
+	if len(in.GetUpdateMask().GetPaths()) == 0 {
+		return nil, logError(status.Errorf(codes.InvalidArgument, "the update mask of the patch is empty, path=%s", in.Path))
+	}
+	var expires time.Time
+	if in.Expires != nil {
+		if err := in.GetExpires().CheckValid(); err != nil {
+			return nil, logError(status.Errorf(codes.InvalidArgument, "invalid expiry of the patch, path=%s err=%s", in.Path, err))
+		}
+		if expires = in.GetExpires().AsTime(); !expires.After(time.Now()) {
+			return nil, logError(status.Errorf(codes.InvalidArgument, "the patch expires in the past, path=%s expires=%s", in.Path, expires.Format(time.RFC3339)))
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		entry, previous, err := s.patch(store, in)
+		if err == libprotoconf.ErrVersionMismatch && in.Version == nil && attempt < patchAttempts {
+			log.Printf("The config was changed while it was patched, patching it again, path=%s", in.Path)
+			continue
+		}
+		if err == libprotoconf.ErrVersionMismatch {
+			return nil, logError(status.Errorf(codes.FailedPrecondition, "the config was changed since it was read, path=%s", in.Path))
+		}
+		if err != nil {
+			return nil, logError(err)
+		}
+		log.Printf("Patched path=%s version=%s", in.Path, entry.NewVersion)
+		if err := s.record(ctx, entry); err != nil {
+			return nil, logError(err)
+		}
+		if !expires.IsZero() {
+			err := expiry.NewManager(store, s.prefix).Set(&expiry.Expiry{
+				Path:            in.Path,
+				Previous:        previous,
+				PreviousVersion: entry.OldVersion,
+				Version:         entry.NewVersion,
+				Expires:         expires,
+				Identity:        callerIdentity(ctx),
+				Created:         time.Now(),
+			})
+			if err != nil {
+				return nil, logError(fmt.Errorf("the config was patched but its expiry wasn't set, path=%s err=%s", in.Path, err))
+			}
+			log.Printf("Patch of path=%s expires at %s", in.Path, expires.Format(time.RFC3339))
+		}
+		return &protoconfmutation.ConfigMutationResponse{Version: entry.NewVersion}, nil
+	}
+}
+
+// patch applies a patch to the current version of a config and writes it,
+// returning the change for the audit log and the config before the patch, or
+// libprotoconf.ErrVersionMismatch
+func (s server) patch(store libprotoconf.VersionedStore, in *protoconfmutation.ConfigPatchRequest) (*audit.Entry, []byte, error) {
+	key := s.prefix + in.Path
+	data, version, err := store.GetVersion(key)
+	if err == libprotoconf.ErrConfigNotFound {
+		return nil, nil, status.Errorf(codes.NotFound, "config not found, path=%s", in.Path)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading config, path=%s err=%s", in.Path, err)
+	}
+	if in.Version != nil && in.GetVersion() != version {
+		return nil, nil, libprotoconf.ErrVersionMismatch
+	}
+
+	stored, err := libprotoconf.DecodeConfig(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding config, path=%s err=%s", in.Path, err)
+	}
+	// The positions of the secrets in the value would change
+	if len(stored.GetSecrets()) > 0 {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "configs with secrets can't be patched, path=%s", in.Path)
+	}
+	if stored.GetValue().GetTypeUrl() != in.GetValue().GetTypeUrl() {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "the patch must be of the type of the config, path=%s type_url=%s", in.Path, stored.GetValue().GetTypeUrl())
+	}
+
+	importPaths, err := utils.ProtoImportPaths(s.protoconfRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolver, err := utils.LoadAnyResolverFromImportPaths(importPaths, stored.GetProtoFile())
+	if err != nil {
+		return nil, nil, err
+	}
+	options := proto.UnmarshalOptions{Resolver: resolver}
+	config, err := anypb.UnmarshalNew(stored.GetValue(), options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling config, path=%s err=%s", in.Path, err)
+	}
+	patch, err := anypb.UnmarshalNew(in.GetValue(), options)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "error unmarshaling patch, path=%s err=%s", in.Path, err)
+	}
+	previous := proto.Clone(config)
+	if err := applyPatch(config.ProtoReflect(), patch.ProtoReflect(), in.GetUpdateMask().GetPaths()); err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid patch, path=%s err=%s", in.Path, err)
+	}
+
+	value, err := anypb.New(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	patched := &protoconfvalue.ProtoconfValue{ProtoFile: stored.GetProtoFile(), Value: value, Descriptors: stored.GetDescriptors()}
+	if !s.config.noValidate {
+		filename := filepath.Join(s.protoconfRoot, consts.CompiledConfigPath, filepath.FromSlash(in.Path)+consts.CompiledConfigExtension)
+		if err := lib.NewCompiler(s.protoconfRoot, false).ValidateValue(patched, filename); err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "invalid patch, path=%s err=%v", in.Path, err)
+		}
+	}
+
+	encoded, err := libprotoconf.EncodeConfig(patched)
+	if err != nil {
+		return nil, nil, err
+	}
+	newVersion, err := store.SetIfVersion(key, encoded, version)
+	if err == libprotoconf.ErrVersionMismatch {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error writing config, path=%s err=%s", in.Path, err)
+	}
+	return &audit.Entry{
+		Action:     audit.ActionPatch,
+		Path:       in.Path,
+		OldVersion: version,
+		NewVersion: newVersion,
+		Changes:    audit.Changes(utils.DiffMessages(previous.ProtoReflect(), config.ProtoReflect())),
+	}, data, nil
+}
+
+// applyPatch replaces the fields of config in paths, as field masks list
+// them, with the fields of patch. Fields unset in patch are cleared, lists
+// and maps are replaced entirely.
+func applyPatch(config protoreflect.Message, patch protoreflect.Message, paths []string) error {
+	for _, path := range paths {
+		names := strings.Split(path, ".")
+		dst, src := config, patch
+		for i, name := range names {
+			field := dst.Descriptor().Fields().ByName(protoreflect.Name(name))
+			if field == nil {
+				return fmt.Errorf("%s isn't a field of %s, path=%s", name, dst.Descriptor().FullName(), path)
+			}
+			if i == len(names)-1 {
+				if src.Has(field) {
+					dst.Set(field, src.Get(field))
+				} else {
+					dst.Clear(field)
+				}
+				break
+			}
+			if field.Message() == nil || field.IsList() || field.IsMap() {
+				return fmt.Errorf("%s isn't a singular message field of %s, path=%s", name, dst.Descriptor().FullName(), path)
+			}
+			dst = dst.Mutable(field).Message()
+			src = src.Get(field).Message()
+		}
+	}
+	return nil
+}
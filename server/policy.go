@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// methodRoles are the roles the methods of the services of the server
+// require on the path of their request. The methods of these services which
+// aren't listed are denied.
+var methodRoles = map[string]protoconf.Policy_Role{
+	"/v1.ProtoconfService/GetConfig":                  protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfService/SubscribeForConfig":         protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfService/SubscribeForConfigs":        protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfService/ListConfigs":                protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfService/Evaluate":                   protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfService/Acknowledge":                protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfService/ListSubscribers":            protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfMutationService/GetMutableConfig":   protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfMutationService/MutateConfig":       protoconf.Policy_READ_WRITE,
+	"/v1.ProtoconfMutationService/PatchConfig":        protoconf.Policy_READ_WRITE,
+	"/v1.ProtoconfMutationService/ListConfigVersions": protoconf.Policy_READ_ONLY,
+	"/v1.ProtoconfMutationService/RollbackConfig":     protoconf.Policy_READ_WRITE,
+}
+
+// guardedServices are the services the calls of which are authorized
+var guardedServices = []string{"/v1.ProtoconfService/", "/v1.ProtoconfMutationService/"}
+
+// authorizer authorizes the calls of the clients by their SPIFFE ID with the
+// policy config, reloaded every time it changes
+type authorizer struct {
+	// path is the path of the policy config, writing it requires the admin
+	// role
+	path string
+
+	lock   sync.RWMutex
+	policy *protoconf.Policy
+}
+
+// newAuthorizer reads the policy config of path and keeps it up to date
+// until stopCh is closed. It fails when the policy can't be read, a server
+// can't start without its policy.
+func newAuthorizer(watcher libprotoconf.Watcher, path string, stopCh <-chan struct{}) (*authorizer, error) {
+	updates, err := watcher.Watch(path, stopCh)
+	if err != nil {
+		return nil, fmt.Errorf("error watching policy config, path=%s err=%s", path, err)
+	}
+	a := &authorizer{path: path}
+	if err := a.update(<-updates); err != nil {
+		return nil, err
+	}
+	go func() {
+		for update := range updates {
+			if err := a.update(update); err != nil {
+				log.Printf("Error updating policy, keeping the previous one, err=%s", err)
+				continue
+			}
+			log.Printf("Policy updated, path=%s", path)
+		}
+	}()
+	return a, nil
+}
+
+func (a *authorizer) update(update libprotoconf.Result) error {
+	if update.Error != nil {
+		return fmt.Errorf("error reading policy config, path=%s err=%s", a.path, update.Error)
+	}
+	if update.Value == nil {
+		return fmt.Errorf("policy config not found, path=%s", a.path)
+	}
+	policy := &protoconf.Policy{}
+	if err := update.Value.UnmarshalTo(policy); err != nil {
+		return fmt.Errorf("error reading policy config, path=%s err=%s", a.path, err)
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.policy = policy
+	return nil
+}
+
+// role is the role of the client of id on the config of path, the highest
+// role of the rules of id with the longest prefix of path
+func (a *authorizer) role(id string, path string) protoconf.Policy_Role {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return policyRole(a.policy, id, path)
+}
+
+// policyRole is the role a policy grants the client of id on the config of
+// path
+func policyRole(policy *protoconf.Policy, id string, path string) protoconf.Policy_Role {
+	role, longest := protoconf.Policy_NO_ACCESS, -1
+	for _, rule := range policy.GetRules() {
+		matched := false
+		for _, identity := range rule.GetIdentities() {
+			matched = matched || command.MatchSPIFFEID(identity, id)
+		}
+		if !matched {
+			continue
+		}
+		prefixes := rule.GetPrefixes()
+		if len(prefixes) == 0 {
+			prefixes = []string{""}
+		}
+		for _, prefix := range prefixes {
+			switch {
+			case !strings.HasPrefix(path, prefix):
+			case len(prefix) > longest:
+				role, longest = rule.GetRole(), len(prefix)
+			case len(prefix) == longest && rule.GetRole() > role:
+				role = rule.GetRole()
+			}
+		}
+	}
+	return role
+}
+
+// authorize checks the role of the client of a call on the path of the
+// request, returning its SPIFFE ID
+func (a *authorizer) authorize(ctx context.Context, method string, req interface{}) (string, error) {
+	id, err := command.PeerSPIFFEID(ctx)
+	if err != nil {
+		return "", status.Error(codes.Unauthenticated, err.Error())
+	}
+	required, ok := methodRoles[method]
+	if !ok {
+		return "", status.Errorf(codes.PermissionDenied, "%s isn't allowed by the policy, identity=%s", method, id)
+	}
+	request, ok := req.(interface{ GetPath() string })
+	if !ok {
+		// ListConfigs and ListSubscribers list the configs readable by the
+		// client, and SubscribeForConfigs sends them
+		return id, nil
+	}
+	path := request.GetPath()
+	// The roles are granted by the prefixes of the paths, the paths which
+	// don't name their config as is, e.g. dev/../prod/web, are rejected
+	// before they are cleaned into the path of another config
+	if path == "" || path != filepath.ToSlash(filepath.Clean(path)) || path == ".." || strings.HasPrefix(path, "../") {
+		return "", status.Errorf(codes.InvalidArgument, "invalid config path, identity=%s path=%s", id, path)
+	}
+	if path == a.path && required == protoconf.Policy_READ_WRITE {
+		required = protoconf.Policy_ADMIN
+	}
+	if role := a.role(id, path); role < required {
+		return "", status.Errorf(codes.PermissionDenied, "%s requires the %s role on the config, identity=%s role=%s path=%s", method, required, id, role, path)
+	}
+	return id, nil
+}
+
+// guarded tells whether the calls of a method are authorized
+func guarded(method string) bool {
+	for _, service := range guardedServices {
+		if strings.HasPrefix(method, service) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *authorizer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !guarded(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	id, err := a.authorize(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, logError(err)
+	}
+	resp, err := handler(ctx, req)
+	if list, ok := resp.(*protoconfservice.ListConfigsResponse); ok {
+		var paths []string
+		for _, path := range list.GetPaths() {
+			if a.role(id, path) >= protoconf.Policy_READ_ONLY {
+				paths = append(paths, path)
+			}
+		}
+		list.Paths = paths
+	}
+	if list, ok := resp.(*protoconfservice.ListSubscribersResponse); ok {
+		var subscribers []*protoconfservice.Subscriber
+		for _, subscriber := range list.GetSubscribers() {
+			if a.role(id, subscriber.GetPath()) >= protoconf.Policy_READ_ONLY {
+				subscribers = append(subscribers, subscriber)
+			}
+		}
+		list.Subscribers = subscribers
+	}
+	return resp, err
+}
+
+func (a *authorizer) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !guarded(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	return handler(srv, &authorizedStream{ServerStream: stream, authorizer: a, method: info.FullMethod})
+}
+
+// ServerOptions are the gRPC server options authorizing the calls
+func (a *authorizer) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(a.unaryInterceptor),
+		grpc.ChainStreamInterceptor(a.streamInterceptor),
+	}
+}
+
+// authorizedStream authorizes every message received from the client, and
+// sends the client only the configs of a pattern it can read
+type authorizedStream struct {
+	grpc.ServerStream
+	authorizer *authorizer
+	method     string
+	id         string
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	id, err := s.authorizer.authorize(s.Context(), s.method, m)
+	if err != nil {
+		return logError(err)
+	}
+	s.id = id
+	return nil
+}
+
+func (s *authorizedStream) SendMsg(m interface{}) error {
+	if update, ok := m.(*protoconfservice.ConfigsUpdate); ok && s.authorizer.role(s.id, update.GetPath()) < protoconf.Policy_READ_ONLY {
+		return nil
+	}
+	return s.ServerStream.SendMsg(m)
+}
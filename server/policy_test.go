@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"testing"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	protoconfmutation "github.com/protoconf/protoconf/server/api/proto/v1"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// peerContext is the context of a call of a client with the SPIFFE ID id
+func peerContext(t *testing.T, id string) context.Context {
+	uri, err := url.Parse(id)
+	assert.NoError(t, err)
+	cert := &x509.Certificate{URIs: []*url.URL{uri}}
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func setPolicy(t *testing.T, store libprotoconf.Store, policy *protoconf.Policy) {
+	value, err := anypb.New(policy)
+	assert.NoError(t, err)
+	data, err := libprotoconf.EncodeConfig(&protoconfvalue.ProtoconfValue{ProtoFile: "protoconf/policy.proto", Value: value})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set("protoconf/policy", data))
+}
+
+func TestAuthorizer(t *testing.T) {
+	const (
+		release = "spiffe://example.org/ns/ci/sa/release"
+		web     = "spiffe://example.org/ns/web/sa/api"
+		admin   = "spiffe://example.org/ns/ops/sa/admin"
+	)
+	store := libprotoconf.NewMemoryStore()
+	setPolicy(t, store, &protoconf.Policy{Rules: []*protoconf.Policy_Rule{
+		{Identities: []string{"spiffe://example.org/ns/web/*", release}, Role: protoconf.Policy_READ_WRITE},
+		{Identities: []string{"*"}, Prefixes: []string{"prod/"}, Role: protoconf.Policy_READ_ONLY},
+		{Identities: []string{release}, Prefixes: []string{"prod/"}, Role: protoconf.Policy_READ_WRITE},
+		{Identities: []string{admin}, Role: protoconf.Policy_ADMIN},
+	}})
+
+	_, err := newAuthorizer(libprotoconf.NewStoreWatcher(store, ""), "missing", nil)
+	assert.Error(t, err)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	a, err := newAuthorizer(libprotoconf.NewStoreWatcher(store, ""), "protoconf/policy", stopCh)
+	assert.NoError(t, err)
+
+	assert.Equal(t, protoconf.Policy_READ_WRITE, a.role(web, "staging/web"))
+	assert.Equal(t, protoconf.Policy_READ_ONLY, a.role(web, "prod/web"))
+	assert.Equal(t, protoconf.Policy_READ_WRITE, a.role(release, "prod/web"))
+	assert.Equal(t, protoconf.Policy_NO_ACCESS, a.role("spiffe://example.org/ns/other/sa/x", "staging/web"))
+	assert.Equal(t, protoconf.Policy_READ_ONLY, a.role("spiffe://example.org/ns/other/sa/x", "prod/web"))
+
+	mutate := func(id string, path string) error {
+		_, err := a.unaryInterceptor(peerContext(t, id), &protoconfmutation.ConfigMutationRequest{Path: path},
+			&grpc.UnaryServerInfo{FullMethod: "/v1.ProtoconfMutationService/MutateConfig"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &protoconfmutation.ConfigMutationResponse{}, nil
+			})
+		return err
+	}
+	assert.NoError(t, mutate(web, "staging/web"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(mutate(web, "prod/web")))
+	assert.NoError(t, mutate(release, "prod/web"))
+	// Only admins write the policy
+	assert.Equal(t, codes.PermissionDenied, status.Code(mutate(web, "protoconf/policy")))
+	assert.NoError(t, mutate(admin, "protoconf/policy"))
+	// The paths escaping the prefixes of the roles are rejected
+	assert.Equal(t, codes.InvalidArgument, status.Code(mutate(web, "staging/../prod/web")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(mutate(web, "staging/../protoconf/policy")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(mutate(web, "staging//web")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(mutate(admin, "../protoconf/policy")))
+
+	// The clients without a certificate aren't authorized
+	_, err = a.unaryInterceptor(context.Background(), &protoconfservice.GetConfigRequest{Path: "staging/web"},
+		&grpc.UnaryServerInfo{FullMethod: "/v1.ProtoconfService/GetConfig"}, nil)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = a.unaryInterceptor(peerContext(t, admin), &protoconfservice.GetConfigRequest{},
+		&grpc.UnaryServerInfo{FullMethod: "/v1.ProtoconfService/NewMethod"}, nil)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	// The other services aren't authorized
+	_, err = a.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	assert.NoError(t, err)
+
+	list, err := a.unaryInterceptor(peerContext(t, "spiffe://example.org/ns/other/sa/x"), &protoconfservice.ListConfigsRequest{},
+		&grpc.UnaryServerInfo{FullMethod: "/v1.ProtoconfService/ListConfigs"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &protoconfservice.ListConfigsResponse{Paths: []string{"prod/web", "staging/web"}}, nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"prod/web"}, list.(*protoconfservice.ListConfigsResponse).Paths)
+
+	// Only the configs readable by the client of a pattern are sent
+	stream := &recordingStream{ctx: peerContext(t, "spiffe://example.org/ns/other/sa/x")}
+	err = a.streamInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/v1.ProtoconfService/SubscribeForConfigs"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			assert.NoError(t, stream.RecvMsg(&protoconfservice.ConfigsSubscriptionRequest{}))
+			for _, path := range []string{"prod/web", "staging/web"} {
+				assert.NoError(t, stream.SendMsg(&protoconfservice.ConfigsUpdate{Path: path}))
+			}
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Len(t, stream.sent, 1)
+	assert.Equal(t, "prod/web", stream.sent[0].(*protoconfservice.ConfigsUpdate).GetPath())
+
+	// The policy is reloaded as it changes
+	setPolicy(t, store, &protoconf.Policy{Rules: []*protoconf.Policy_Rule{
+		{Identities: []string{web}, Prefixes: []string{"prod/"}, Role: protoconf.Policy_READ_WRITE},
+	}})
+	assert.Eventually(t, func() bool { return mutate(web, "prod/web") == nil }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, codes.PermissionDenied, status.Code(mutate(release, "prod/web")))
+}
+
+// recordingStream is a server stream of a client sending one request and
+// recording the messages sent
+type recordingStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []interface{}
+}
+
+func (s *recordingStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *recordingStream) RecvMsg(m interface{}) error {
+	return nil
+}
+
+func (s *recordingStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
@@ -3,23 +3,42 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/golang/protobuf/jsonpb"
-	"github.com/jhump/protoreflect/desc/protoparse"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/mitchellh/cli"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/compiler/lib"
 	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/expiry"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/rollout"
 	protoconfmutation "github.com/protoconf/protoconf/server/api/proto/v1"
+	"github.com/protoconf/protoconf/targeting"
+	"github.com/protoconf/protoconf/tracing"
+	"github.com/protoconf/protoconf/utils"
+	"github.com/protoconf/protoconf/webhook"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type cliCommand struct{}
@@ -28,25 +47,58 @@ type cliConfig struct {
 	grpcAddress        string
 	preMutationScript  string
 	postMutationScript string
+	noValidate         bool
+	fromStore          bool
+	readOnly           bool
+	replicaOf          string
+	policyPath         string
+	tenantsPath        string
+	auditLog           string
+	webhooksPath       string
+	otlpEndpoint       string
+	rollouts           bool
+	targeting          bool
+	uiAddress          string
+	limits             command.LimitsConfig
+	accessLog          string
 }
 
-func newFlagSet() (*flag.FlagSet, *cliConfig) {
+func newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig, *command.TLSConfig) {
 	flags := flag.NewFlagSet("", flag.ExitOnError)
 	flags.Usage = func() {
 		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... protoconfRoot")
 		flags.PrintDefaults()
 	}
 
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+	tlsConfig := &command.TLSConfig{}
+	command.AddTLSFlags(flags, tlsConfig)
+
 	config := &cliConfig{}
 	flags.StringVar(&config.grpcAddress, "grpc-address", consts.ServerDefaultAddress, "Server gRPC address")
 	flags.StringVar(&config.preMutationScript, "pre", "", "Pre mutation script")
 	flags.StringVar(&config.postMutationScript, "post", "", "Post mutation script")
+	flags.BoolVar(&config.noValidate, "no-validate", false, "Write mutations without validating them, an escape hatch for emergencies")
+	flags.StringVar(&config.policyPath, "policy", "", "Path of the protoconf.Policy config authorizing the clients by the SPIFFE IDs of their certificates, read from the configs served and reloaded when it changes, requires mutual TLS")
+	flags.StringVar(&config.tenantsPath, "tenants", "", "Path of the protoconf.Tenants config splitting the configs into the namespaces of the tenants, each with its own policy and quota, read from the configs served and reloaded when it changes, requires mutual TLS")
+	audit.AddFlag(flags, &config.auditLog)
+	webhook.AddFlag(flags, &config.webhooksPath)
+	tracing.AddFlag(flags, &config.otlpEndpoint)
+	flags.BoolVar(&config.fromStore, "from-store", false, "Serve the configs inserted to the key-value store instead of the materialized configs, and accept patches of the configs of the store")
+	flags.BoolVar(&config.readOnly, "read-only", false, "Serve the configs for reads and subscriptions only, rejecting the mutations, patches and rollbacks, for a replica close to the clients following the key-value store with -from-store")
+	flags.StringVar(&config.replicaOf, "replica-of", "", "Address of the server to follow, serving its configs read-only instead of the configs of the protoconf root, connected to with the TLS flags")
+	flags.BoolVar(&config.rollouts, "rollouts", false, "Serve the new values of the configs rolled out to the subscribers their rollouts select, and advance the rollouts as their policies say, requires -from-store")
+	flags.BoolVar(&config.targeting, "targeting", false, "Serve the values of the targeting rules of the configs, set with protoconf insert -target, to the subscribers matching their labels, requires -from-store")
+	flags.StringVar(&config.uiAddress, "ui-address", "", "HTTP address of the admin web UI browsing the configs, their versions and their changes, and rolling them back with -from-store, served with mutual TLS and authorized by -policy and -tenants as the gRPC API is")
+	command.AddLimitsFlags(flags, &config.limits)
+	command.AddAccessLogFlag(flags, &config.accessLog)
 
-	return flags, config
+	return flags, config, kVConfig, tlsConfig
 }
 
 func (c *cliCommand) Run(args []string) int {
-	flags, config := newFlagSet()
+	flags, config, kVConfig, tlsConfig := newFlagSet()
 	flags.Parse(args)
 
 	if flags.NArg() < 1 {
@@ -59,6 +111,43 @@ func (c *cliCommand) Run(args []string) int {
 
 	log.Printf("Starting Protoconf server at \"%s\", version %s", config.grpcAddress, consts.Version)
 	log.Printf("Config: protoconf_root=\"%s\" pre-mutation-script=\"%s\" post-mutation-script=\"%s\"", protoconfRoot, config.preMutationScript, config.postMutationScript)
+	if config.noValidate {
+		log.Println("Warning: validation is disabled by -no-validate, mutations are written without running validators, PGV rules and protovalidate constraints")
+	}
+	shutdownTracing, err := tracing.Init(config.otlpEndpoint, "protoconf-server")
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer shutdownTracing()
+	serverOptions, err := tlsConfig.ServerOptions()
+	if err != nil {
+		log.Printf("Error setting up mutual TLS, err=%s", err)
+		return 1
+	}
+	serverOptions = append(serverOptions, tracing.ServerOptions()...)
+	if config.accessLog != "" {
+		accessLog, err := command.OpenAccessLog(config.accessLog)
+		if err != nil {
+			log.Printf("Error opening access log, err=%s", err)
+			return 1
+		}
+		defer accessLog.Close()
+		// The calls limited or denied are logged too
+		serverOptions = append(serverOptions, accessLog.ServerOptions()...)
+		log.Printf("Writing the access log to \"%s\"", config.accessLog)
+	}
+	limiter, err := config.limits.Limiter()
+	if err != nil {
+		log.Printf("Error setting up the limits of the clients, err=%s", err)
+		return 1
+	}
+	// The reads and subscriptions are limited, the mutations are left to the
+	// policy
+	serverOptions = append(serverOptions, limiter.ServerOptions("/v1.ProtoconfService/")...)
+	if tlsConfig.Enabled() {
+		log.Printf("Serving with mutual TLS, allowed SPIFFE IDs=%v", tlsConfig.AllowedIDs)
+	}
 
 	listener, err := net.Listen("tcp", config.grpcAddress)
 	if err != nil {
@@ -66,11 +155,179 @@ func (c *cliCommand) Run(args []string) int {
 		return 1
 	}
 
-	rpcServer := grpc.NewServer()
-	protoconfmutation.RegisterProtoconfMutationServiceServer(rpcServer, protoconfServer)
+	if config.rollouts && !config.fromStore {
+		log.Println("Error: -rollouts requires -from-store, the rollouts are kept in the key-value store")
+		return 1
+	}
+	if config.targeting && !config.fromStore {
+		log.Println("Error: -targeting requires -from-store, the targeting rules are kept in the key-value store")
+		return 1
+	}
+	if config.replicaOf != "" && config.fromStore {
+		log.Println("Error: -replica-of and -from-store can't be used together, a replica follows either a server or the key-value store")
+		return 1
+	}
+	if config.replicaOf != "" {
+		config.readOnly = true
+	}
+	if config.readOnly {
+		log.Println("Serving the configs read-only, the mutations, patches and rollbacks are rejected")
+	}
+	var configs *configService
+	var closeConfigs func()
+	var rollouts *rollout.Manager
+	var store libprotoconf.Store
+	if config.fromStore {
+		log.Printf("Serving configs from %s at \"%s\", config path prefix=\"%s\"", kVConfig.Store, kVConfig.Address, kVConfig.Prefix)
+		store, err = libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+		if err != nil {
+			log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+			return 1
+		}
+		// Patches, rollbacks and promotions keep the history of the configs
+		protoconfServer.store = kVConfig.WithHistory(store)
+		protoconfServer.prefix = kVConfig.Prefix
+		if config.rollouts {
+			rollouts = rollout.NewManager(protoconfServer.store, kVConfig.Prefix)
+		}
+		var targetings *targeting.Manager
+		if config.targeting {
+			targetings = targeting.NewManager(store, kVConfig.Prefix)
+			log.Printf("Serving the targeting rules of the configs, read every %s", targeting.PollInterval)
+		}
+		configs, closeConfigs = newStoreConfigService(store, kVConfig.Prefix, rollouts, targetings, limiter.SubscriberQueue())
+	} else if config.replicaOf != "" {
+		transport, err := tlsConfig.DialOption()
+		if err != nil {
+			log.Printf("Error setting up mutual TLS, err=%s", err)
+			return 1
+		}
+		conn, err := grpc.Dial(config.replicaOf, transport)
+		if err != nil {
+			log.Printf("Error connecting to the server followed, address=%s err=%s", config.replicaOf, err)
+			return 1
+		}
+		configs, closeConfigs = newRemoteConfigService(conn, limiter.SubscriberQueue())
+		log.Printf("Following the server at \"%s\"", config.replicaOf)
+	} else {
+		configs, closeConfigs, err = newConfigService(protoconfRoot, limiter.SubscriberQueue())
+		if err != nil {
+			log.Printf("Error watching configs to serve, err=%s", err)
+			return 1
+		}
+	}
+	defer closeConfigs()
+
+	if config.auditLog != "" {
+		var auditStore libprotoconf.Store
+		protoconfServer.audit, err = audit.Open(config.auditLog, func() (libprotoconf.Store, error) {
+			if store != nil {
+				return store, nil
+			}
+			var err error
+			auditStore, err = libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+			return auditStore, err
+		})
+		if auditStore != nil {
+			defer auditStore.Close()
+		}
+		if err != nil {
+			log.Printf("Error opening audit log, err=%s", err)
+			return 1
+		}
+		log.Printf("Recording the changes of the configs to the audit log \"%s\"", config.auditLog)
+	}
+	if config.webhooksPath != "" {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		notifier, err := webhook.Watch(configs.watcher, config.webhooksPath, stopCh)
+		if err != nil {
+			log.Printf("Error loading webhooks, err=%s", err)
+			return 1
+		}
+		defer notifier.Wait()
+		protoconfServer.audit = audit.Tee(protoconfServer.audit, notifier)
+		log.Printf("Posting the changes of the configs to the webhooks config, path=%s", config.webhooksPath)
+	}
+
+	if rollouts != nil && !config.readOnly {
+		rollouts.Audit = protoconfServer.audit
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go rollouts.Run(rollout.PollInterval, stopCh)
+		log.Printf("Serving and advancing the rollouts of the configs every %s", rollout.PollInterval)
+	}
+
+	if config.fromStore && !config.readOnly {
+		expiries := expiry.NewManager(protoconfServer.store, kVConfig.Prefix)
+		expiries.Audit = protoconfServer.audit
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go expiries.Run(expiry.PollInterval, stopCh)
+		log.Printf("Reverting the configs expired every %s", expiry.PollInterval)
+	}
+
+	if config.policyPath != "" && config.tenantsPath != "" {
+		log.Println("Error: -policy and -tenants can't be used together, the namespaces of -tenants have their own policies")
+		return 1
+	}
+	var uiRoles roles
+	if config.tenantsPath != "" {
+		if !tlsConfig.Enabled() {
+			log.Println("Error: -tenants requires mutual TLS, the clients are identified by their certificates")
+			return 1
+		}
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		tenancy, err := newTenancy(configs.watcher, config.tenantsPath, protoconfRoot, stopCh)
+		if err != nil {
+			log.Printf("Error loading tenants, err=%s", err)
+			return 1
+		}
+		log.Printf("Splitting the configs into the namespaces of the tenants config, path=%s", config.tenantsPath)
+		serverOptions = append(serverOptions, tenancy.ServerOptions()...)
+		uiRoles = tenancy
+	}
+	if config.policyPath != "" {
+		if !tlsConfig.Enabled() {
+			log.Println("Error: -policy requires mutual TLS, the clients are identified by their certificates")
+			return 1
+		}
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		authorizer, err := newAuthorizer(configs.watcher, config.policyPath, stopCh)
+		if err != nil {
+			log.Printf("Error loading policy, err=%s", err)
+			return 1
+		}
+		log.Printf("Authorizing the clients with the policy config, path=%s", config.policyPath)
+		serverOptions = append(serverOptions, authorizer.ServerOptions()...)
+		uiRoles = authorizer
+	}
+
+	rpcServer := newRPCServer(protoconfServer, configs, serverOptions...)
+
+	g, _ := errgroup.WithContext(context.TODO())
+	g.Go(func() error { return rpcServer.Serve(listener) })
+	if config.uiAddress != "" {
+		uiServer := &http.Server{Addr: config.uiAddress, Handler: command.NewCompressionHandler(newUI(*protoconfServer, configs, uiRoles))}
+		if tlsConfig.Enabled() {
+			if uiServer.TLSConfig, err = tlsConfig.ServerConfig(); err != nil {
+				log.Printf("Error setting up mutual TLS, err=%s", err)
+				return 1
+			}
+		}
+		log.Printf("Serving the admin UI at \"%s\"", config.uiAddress)
+		g.Go(func() error {
+			if uiServer.TLSConfig != nil {
+				return uiServer.ListenAndServeTLS("", "")
+			}
+			return uiServer.ListenAndServe()
+		})
+	}
 
 	log.Println("Protoconf server running")
-	err = rpcServer.Serve(listener)
+	err = g.Wait()
 	if err != nil {
 		log.Printf("Error serving gRPC, err=%s", err)
 		return 1
@@ -79,11 +336,28 @@ func (c *cliCommand) Run(args []string) int {
 	return 0
 }
 
+// newRPCServer registers the mutation and config services, along with the
+// standard health and reflection services for load balancers and tools such
+// as grpcurl
+func newRPCServer(mutations protoconfmutation.ProtoconfMutationServiceServer, configs protoconfservice.ProtoconfServiceServer, opts ...grpc.ServerOption) *grpc.Server {
+	rpcServer := grpc.NewServer(opts...)
+	protoconfmutation.RegisterProtoconfMutationServiceServer(rpcServer, mutations)
+	protoconfservice.RegisterProtoconfServiceServer(rpcServer, configs)
+
+	healthServer := health.NewServer()
+	for name := range rpcServer.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(rpcServer, healthServer)
+	reflection.Register(rpcServer)
+	return rpcServer
+}
+
 func (c *cliCommand) Help() string {
 	var b bytes.Buffer
 	b.WriteString(c.Synopsis())
 	b.WriteString("\n")
-	flags, _ := newFlagSet()
+	flags, _, _, _ := newFlagSet()
 	flags.SetOutput(&b)
 	flags.Usage()
 	return b.String()
@@ -101,25 +375,79 @@ func Command() (cli.Command, error) {
 type server struct {
 	config        *cliConfig
 	protoconfRoot string
+	// store is the key-value store the configs are patched in, nil unless
+	// the server serves the configs of the store
+	store  libprotoconf.Store
+	prefix string
+	// audit records the mutations and the patches, nil without -audit-log and
+	// -webhooks
+	audit audit.Log
+}
+
+// checkWritable fails on the read-only servers, which leave the writes to
+// the server they follow
+func (s server) checkWritable() error {
+	if s.config.readOnly {
+		return status.Error(codes.Unimplemented, "the server is read-only, write to the server it follows")
+	}
+	return nil
+}
+
+// mutationsLock serializes checking the version of a mutable config and
+// writing it
+var mutationsLock sync.Mutex
+
+// mutableConfigFile is the file of the mutable config of path
+func (s server) mutableConfigFile(path string) string {
+	return filepath.Join(s.protoconfRoot, consts.MutableConfigPath, filepath.Clean(path)+consts.CompiledConfigExtension)
+}
+
+// mutableConfigVersion is the version of a mutable config, the hash of its
+// file
+func mutableConfigVersion(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// GetMutableConfig reads a mutable config and its version, for conditional
+// mutations
+func (s server) GetMutableConfig(ctx context.Context, in *protoconfmutation.GetMutableConfigRequest) (*protoconfmutation.MutableConfig, error) {
+	filename := s.mutableConfigFile(in.Path)
+	jsonData, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, status.Errorf(codes.NotFound, "mutable config not found, path=%s", in.Path)
+	}
+	if err != nil {
+		return nil, logError(fmt.Errorf("error reading file %s, err: %s", filename, err))
+	}
+	value, err := utils.UnmarshalConfig(s.protoconfRoot, jsonData)
+	if err != nil {
+		return nil, logError(fmt.Errorf("error reading mutable config, path=%s err=%s", in.Path, err))
+	}
+	return &protoconfmutation.MutableConfig{Value: value, Version: mutableConfigVersion(jsonData)}, nil
 }
 
 func (s server) MutateConfig(ctx context.Context, in *protoconfmutation.ConfigMutationRequest) (*protoconfmutation.ConfigMutationResponse, error) {
 	log.Printf("Mutating path=%s", in.Path)
-	filename := filepath.Join(s.protoconfRoot, consts.MutableConfigPath, filepath.Clean(in.Path)+consts.CompiledConfigExtension)
+	if err := s.checkWritable(); err != nil {
+		return nil, logError(err)
+	}
+	filename := s.mutableConfigFile(in.Path)
 
-	parser := &protoparse.Parser{ImportPaths: []string{filepath.Join(s.protoconfRoot, consts.SrcPath)}}
-	descriptors, err := parser.ParseFiles(in.Value.ProtoFile)
+	importPaths, err := utils.ProtoImportPaths(s.protoconfRoot)
+	if err != nil {
+		return nil, logError(err)
+	}
+	descriptors, err := utils.ParseProtoFiles(importPaths, nil, in.Value.ProtoFile)
 	if err != nil {
 		return nil, logError(fmt.Errorf("error parsing proto file, file=%s err=%v", in.Value.ProtoFile, err))
 	}
 
-	anyResolver := dynamic.AnyResolver(nil, descriptors[0])
-	m := &jsonpb.Marshaler{AnyResolver: anyResolver, Indent: "  "}
-	jsonData, err := m.MarshalToString(in.Value)
+	anyResolver := utils.NewAnyResolver(descriptors...)
+	jsonData, err := utils.MarshalJSON(in.Value, anyResolver)
 	if err != nil {
 		return nil, logError(fmt.Errorf("error marshaling ProtoconfValue to JSON, value=%s", in.Value))
 	}
-	jsonData += "\n"
+	jsonData = append(jsonData, '\n')
 
 	if s.config.preMutationScript != "" {
 		if err := runScript(s.config.preMutationScript, in.ScriptMetadata); err != nil {
@@ -127,15 +455,35 @@ func (s server) MutateConfig(ctx context.Context, in *protoconfmutation.ConfigMu
 		}
 	}
 
-	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
-		return nil, logError(fmt.Errorf("error creating output directory %s, err: %s", filepath.Dir(filename), err))
+	// Mutations are validated as the configs compiled from the same proto
+	// file, once the pre mutation script prepared the workspace, so that
+	// they can't bypass the validation of the compiler
+	if !s.config.noValidate {
+		if err := lib.NewCompiler(s.protoconfRoot, false).ValidateValue(in.Value, filename); err != nil {
+			return nil, logError(status.Errorf(codes.InvalidArgument, "invalid mutation, path=%s err=%v", in.Path, err))
+		}
 	}
 
-	if err := ioutil.WriteFile(filename, []byte(jsonData), 0644); err != nil {
-		return nil, logError(fmt.Errorf("error writing to file %s, err: %s", filename, err))
+	previous, err := s.writeMutation(filename, jsonData, in)
+	if err != nil {
+		return nil, logError(err)
 	}
 
 	log.Printf("Written to %s", filename)
+	entry := &audit.Entry{Action: audit.ActionMutate, Path: in.Path, NewVersion: mutableConfigVersion(jsonData)}
+	if previous != nil {
+		entry.OldVersion = mutableConfigVersion(previous)
+		if previousValue, err := utils.UnmarshalConfig(s.protoconfRoot, previous); err == nil {
+			diffs, err := utils.DiffConfigs(previousValue, in.Value, s.protoconfRoot)
+			if err != nil {
+				log.Printf("Error comparing the mutable config to record its changes, path=%s err=%s", in.Path, err)
+			}
+			entry.Changes = audit.Changes(diffs)
+		}
+	}
+	if err := s.record(ctx, entry); err != nil {
+		return nil, logError(err)
+	}
 
 	if s.config.postMutationScript != "" {
 		if err := runScript(s.config.postMutationScript, in.ScriptMetadata); err != nil {
@@ -143,7 +491,69 @@ func (s server) MutateConfig(ctx context.Context, in *protoconfmutation.ConfigMu
 		}
 	}
 
-	return &protoconfmutation.ConfigMutationResponse{}, nil
+	return &protoconfmutation.ConfigMutationResponse{Version: mutableConfigVersion(jsonData)}, nil
+}
+
+// writeMutation writes a mutable config, when it's at the version of the
+// mutation for conditional mutations, and returns the mutable config it
+// replaced, nil when there was none
+func (s server) writeMutation(filename string, jsonData []byte, in *protoconfmutation.ConfigMutationRequest) ([]byte, error) {
+	mutationsLock.Lock()
+	defer mutationsLock.Unlock()
+
+	current, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading file %s, err: %s", filename, err)
+	}
+	if in.Version != nil {
+		version := ""
+		if current != nil {
+			version = mutableConfigVersion(current)
+		}
+		if version != in.GetVersion() {
+			return nil, status.Errorf(codes.FailedPrecondition, "the mutable config was changed since it was read, path=%s version=%s", in.Path, version)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory %s, err: %s", filepath.Dir(filename), err)
+	}
+	if err := ioutil.WriteFile(filename, jsonData, 0644); err != nil {
+		return nil, fmt.Errorf("error writing to file %s, err: %s", filename, err)
+	}
+	return current, nil
+}
+
+// record appends a change of a config to the audit log, when the server has
+// one, as the change of the client of the call
+func (s server) record(ctx context.Context, entry *audit.Entry) error {
+	return s.recordAs(callerIdentity(ctx), entry)
+}
+
+// recordAs appends a change of a config to the audit log, when the server
+// has one, as the change of identity
+func (s server) recordAs(identity string, entry *audit.Entry) error {
+	if s.audit == nil {
+		return nil
+	}
+	entry.Time = time.Now()
+	entry.Identity = identity
+	if err := s.audit.Append(entry); err != nil {
+		return fmt.Errorf("error recording the change to the audit log, path=%s err=%s", entry.Path, err)
+	}
+	return nil
+}
+
+// callerIdentity is the SPIFFE ID of the client of a call, or its address
+// when it didn't connect with mutual TLS
+func callerIdentity(ctx context.Context) string {
+	if id, err := command.PeerSPIFFEID(ctx); err == nil {
+		return id
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "unknown"
 }
 
 func logError(err error) error {
@@ -1,7 +1,38 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/consts"
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/expiry"
+	"github.com/protoconf/protoconf/libprotoconf"
+	protoconfmutation "github.com/protoconf/protoconf/server/api/proto/v1"
+	"github.com/protoconf/protoconf/utils"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func Test(t *testing.T) {
@@ -9,3 +40,329 @@ func Test(t *testing.T) {
 		t.Errorf("Abs(-1) = %d; want 1", 0)
 	}
 }
+
+func TestConfigService(t *testing.T) {
+	root, err := ioutil.TempDir("", "config_service")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	materializedDir := filepath.Join(root, consts.CompiledConfigPath)
+	assert.NoError(t, os.MkdirAll(filepath.Join(materializedDir, "services"), 0755))
+	writeConfig := func(path string, value string) {
+		content := fmt.Sprintf(`{"protoFile": "google/protobuf/wrappers.proto", "value": {"@type": "type.googleapis.com/google.protobuf.StringValue", "value": %q}}`, value)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(materializedDir, path+consts.CompiledConfigExtension), []byte(content), 0644))
+	}
+	writeConfig("services/api", "api")
+	writeConfig("services/web", "web")
+	writeConfig("global", "global")
+
+	configs, closeConfigs, err := newConfigService(root, command.DefaultSubscriberQueue)
+	assert.NoError(t, err)
+	defer closeConfigs()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rpcServer := grpc.NewServer()
+	protoconfservice.RegisterProtoconfServiceServer(rpcServer, configs)
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := protoconfservice.NewProtoconfServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	valueOf := func(update *protoconfservice.ConfigUpdate) string {
+		value := &wrapperspb.StringValue{}
+		assert.NoError(t, update.GetValue().UnmarshalTo(value))
+		return value.GetValue()
+	}
+
+	list, err := client.ListConfigs(ctx, &protoconfservice.ListConfigsRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"global", "services/api", "services/web"}, list.GetPaths())
+	list, err = client.ListConfigs(ctx, &protoconfservice.ListConfigsRequest{Prefix: "services/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/api", "services/web"}, list.GetPaths())
+
+	update, err := client.GetConfig(ctx, &protoconfservice.GetConfigRequest{Path: "services/api"})
+	assert.NoError(t, err)
+	assert.Equal(t, "api", valueOf(update))
+	_, err = client.GetConfig(ctx, &protoconfservice.GetConfigRequest{Path: "services/missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetConfig(ctx, &protoconfservice.GetConfigRequest{Path: "../outside"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Subscribers get the current value, then every update
+	stream, err := client.SubscribeForConfig(ctx, &protoconfservice.ConfigSubscriptionRequest{Path: "services/web"})
+	assert.NoError(t, err)
+	update, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "web", valueOf(update))
+	writeConfig("services/web", "web2")
+	update, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "web2", valueOf(update))
+	// Including when the config is replaced by renaming another file over it
+	writeConfig("services/web.new", "web3")
+	assert.NoError(t, os.Rename(
+		filepath.Join(materializedDir, "services", "web.new"+consts.CompiledConfigExtension),
+		filepath.Join(materializedDir, "services", "web"+consts.CompiledConfigExtension),
+	))
+	update, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "web3", valueOf(update))
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rpcServer := newRPCServer(&server{}, configService{})
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	health := healthpb.NewHealthClient(conn)
+	for _, service := range []string{"", "v1.ProtoconfService", "v1.ProtoconfMutationService"} {
+		response, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		assert.NoError(t, err, service)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, response.GetStatus(), service)
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}))
+	response, err := stream.Recv()
+	assert.NoError(t, err)
+	var services []string
+	for _, service := range response.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	assert.Contains(t, services, "v1.ProtoconfService")
+	assert.Contains(t, services, "v1.ProtoconfMutationService")
+	assert.Contains(t, services, "grpc.health.v1.Health")
+}
+
+func TestConditionalMutations(t *testing.T) {
+	root, err := ioutil.TempDir("", "mutations")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, consts.SrcPath), 0755))
+	s := server{config: &cliConfig{}, protoconfRoot: root, audit: audit.NewFileLog(filepath.Join(root, "audit.jsonl"))}
+	ctx := context.Background()
+
+	mutate := func(value string, version *string) (*protoconfmutation.ConfigMutationResponse, error) {
+		any, err := anypb.New(wrapperspb.String(value))
+		assert.NoError(t, err)
+		return s.MutateConfig(ctx, &protoconfmutation.ConfigMutationRequest{
+			Path:    "services/api",
+			Value:   &protoconfvalue.ProtoconfValue{ProtoFile: "google/protobuf/wrappers.proto", Value: any},
+			Version: version,
+		})
+	}
+	version := func(version string) *string { return &version }
+
+	_, err = s.GetMutableConfig(ctx, &protoconfmutation.GetMutableConfigRequest{Path: "services/api"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// An empty version creates the mutable config
+	first, err := mutate("first", version(""))
+	assert.NoError(t, err)
+	_, err = mutate("first", version(""))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	config, err := s.GetMutableConfig(ctx, &protoconfmutation.GetMutableConfigRequest{Path: "services/api"})
+	assert.NoError(t, err)
+	assert.Equal(t, first.GetVersion(), config.GetVersion())
+	value := &wrapperspb.StringValue{}
+	assert.NoError(t, config.GetValue().GetValue().UnmarshalTo(value))
+	assert.Equal(t, "first", value.GetValue())
+
+	second, err := mutate("second", version(first.GetVersion()))
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.GetVersion(), second.GetVersion())
+	_, err = mutate("third", version(first.GetVersion()))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Mutations without a version are written unconditionally
+	third, err := mutate("third", nil)
+	assert.NoError(t, err)
+	config, err = s.GetMutableConfig(ctx, &protoconfmutation.GetMutableConfigRequest{Path: "services/api"})
+	assert.NoError(t, err)
+	assert.Equal(t, third.GetVersion(), config.GetVersion())
+
+	// The mutations written are recorded to the audit log
+	entries, err := s.audit.Entries("services/api")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "", entries[0].OldVersion)
+	assert.Equal(t, first.GetVersion(), entries[0].NewVersion)
+	assert.Equal(t, first.GetVersion(), entries[1].OldVersion)
+	assert.Equal(t, []string{`~ value: "first" -> "second"`}, entries[1].Changes)
+	assert.Equal(t, third.GetVersion(), entries[2].NewVersion)
+}
+
+const flagsProto = `syntax = "proto3";
+message Limits {
+  int32 max_connections = 1;
+  int32 max_requests = 2;
+}
+message Flags {
+  bool enabled = 1;
+  string owner = 2;
+  Limits limits = 3;
+}
+`
+
+func TestPatchConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "patches")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, consts.SrcPath), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, consts.SrcPath, "flags.proto"), []byte(flagsProto), 0644))
+	files, err := utils.ParseProtoFiles([]string{filepath.Join(root, consts.SrcPath)}, nil, "flags.proto")
+	assert.NoError(t, err)
+	flagsDescriptor := files[0].Messages().ByName("Flags")
+	parse := func(text string) *anypb.Any {
+		message := dynamicpb.NewMessage(flagsDescriptor)
+		assert.NoError(t, prototext.Unmarshal([]byte(text), message))
+		any, err := anypb.New(message)
+		assert.NoError(t, err)
+		return any
+	}
+
+	store := libprotoconf.NewMemoryStore()
+	s := server{config: &cliConfig{}, protoconfRoot: root, store: store, prefix: "protoconf/", audit: audit.NewStoreLog(store, "audit/")}
+	ctx := context.Background()
+	value, err := libprotoconf.EncodeConfig(&protoconfvalue.ProtoconfValue{
+		ProtoFile: "flags.proto",
+		Value:     parse(`enabled: true owner: "web" limits { max_connections: 10 max_requests: 20 }`),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set("protoconf/services/web", value))
+	read := func() string {
+		data, err := store.Get("protoconf/services/web")
+		assert.NoError(t, err)
+		stored, err := libprotoconf.DecodeConfig(data)
+		assert.NoError(t, err)
+		message := dynamicpb.NewMessage(flagsDescriptor)
+		assert.NoError(t, stored.GetValue().UnmarshalTo(message))
+		var fields []string
+		for _, diff := range utils.DiffMessages(dynamicpb.NewMessage(flagsDescriptor), message) {
+			fields = append(fields, diff.String())
+		}
+		return strings.Join(fields, "\n")
+	}
+	patch := func(text string, paths []string, version *string) (*protoconfmutation.ConfigMutationResponse, error) {
+		return s.PatchConfig(ctx, &protoconfmutation.ConfigPatchRequest{
+			Path:       "services/web",
+			Value:      parse(text),
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: paths},
+			Version:    version,
+		})
+	}
+
+	// The fields out of the mask are kept, the fields in the mask unset in
+	// the patch are cleared
+	response, err := patch(`enabled: false owner: "ignored" limits { max_connections: 5 }`, []string{"enabled", "limits.max_connections"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "+ owner: \"web\"\n+ limits: {max_connections: 5, max_requests: 20}", read())
+	_, err = patch(``, []string{"owner"}, &response.Version)
+	assert.NoError(t, err)
+	assert.Equal(t, "+ limits: {max_connections: 5, max_requests: 20}", read())
+
+	// Patches of an older version fail
+	_, err = patch(`enabled: true`, []string{"enabled"}, &response.Version)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	entries, err := s.audit.Entries("services/web")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, audit.ActionPatch, entries[0].Action)
+	assert.Equal(t, "unknown", entries[0].Identity)
+	assert.Equal(t, []string{"- enabled: true", "~ limits.max_connections: 10 -> 5"}, entries[0].Changes)
+	assert.Equal(t, response.Version, entries[1].OldVersion)
+	assert.Equal(t, []string{`- owner: "web"`}, entries[1].Changes)
+
+	_, err = patch(`enabled: true`, []string{"missing"}, nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = patch(`enabled: true`, []string{"owner.name"}, nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = patch(`enabled: true`, nil, nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = s.PatchConfig(ctx, &protoconfmutation.ConfigPatchRequest{
+		Path:       "services/web",
+		Value:      parseAny(t, wrapperspb.Bool(true)),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"value"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = s.PatchConfig(ctx, &protoconfmutation.ConfigPatchRequest{
+		Path:       "services/missing",
+		Value:      parse(`enabled: true`),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"enabled"}},
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// The config is rolled back to the version before the patches
+	versions, err := s.ListConfigVersions(ctx, &protoconfmutation.ListConfigVersionsRequest{Path: "services/web"})
+	assert.NoError(t, err)
+	assert.Len(t, versions.Versions, 3)
+	assert.Equal(t, "flags.proto", versions.Versions[0].GetValue().GetProtoFile())
+	assert.NotNil(t, versions.Versions[0].GetCreatedAt())
+	rolledBack, err := s.RollbackConfig(ctx, &protoconfmutation.ConfigRollbackRequest{Path: "services/web", Version: versions.Versions[0].Version})
+	assert.NoError(t, err)
+	assert.Equal(t, "+ enabled: true\n+ owner: \"web\"\n+ limits: {max_connections: 10, max_requests: 20}", read())
+	entries, err = s.audit.Entries("services/web")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, audit.ActionRollback, entries[2].Action)
+	assert.Equal(t, rolledBack.Version, entries[2].NewVersion)
+	assert.Equal(t, []string{"+ enabled: true", `+ owner: "web"`, "~ limits.max_connections: 5 -> 10"}, entries[2].Changes)
+	_, err = s.RollbackConfig(ctx, &protoconfmutation.ConfigRollbackRequest{Path: "services/web", Version: 100})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Temporary patches are reverted once they expire
+	temporary := func(expires time.Time) error {
+		_, err := s.PatchConfig(ctx, &protoconfmutation.ConfigPatchRequest{
+			Path:       "services/web",
+			Value:      parse(`enabled: false`),
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"enabled"}},
+			Expires:    timestamppb.New(expires),
+		})
+		return err
+	}
+	expires := time.Now().Add(time.Hour)
+	assert.NoError(t, temporary(expires))
+	assert.Equal(t, "+ owner: \"web\"\n+ limits: {max_connections: 10, max_requests: 20}", read())
+	assert.NoError(t, expiry.NewManager(store, "protoconf/").Expire(expires))
+	assert.Equal(t, "+ enabled: true\n+ owner: \"web\"\n+ limits: {max_connections: 10, max_requests: 20}", read())
+	assert.Equal(t, codes.InvalidArgument, status.Code(temporary(time.Now().Add(-time.Minute))))
+
+	// Servers not serving a store don't accept patches
+	_, err = server{config: &cliConfig{}, protoconfRoot: root}.PatchConfig(ctx, &protoconfmutation.ConfigPatchRequest{Path: "services/web"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = server{config: &cliConfig{}, protoconfRoot: root}.RollbackConfig(ctx, &protoconfmutation.ConfigRollbackRequest{Path: "services/web", Version: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Read-only servers reject the writes
+	readOnly := server{config: &cliConfig{readOnly: true}, protoconfRoot: root, store: store, prefix: "protoconf/"}
+	_, err = readOnly.PatchConfig(ctx, &protoconfmutation.ConfigPatchRequest{Path: "services/web", Value: parse(`enabled: false`)})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = readOnly.RollbackConfig(ctx, &protoconfmutation.ConfigRollbackRequest{Path: "services/web", Version: 1})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = readOnly.MutateConfig(ctx, &protoconfmutation.ConfigMutationRequest{Path: "services/web"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func parseAny(t *testing.T, message proto.Message) *anypb.Any {
+	any, err := anypb.New(message)
+	assert.NoError(t, err)
+	return any
+}
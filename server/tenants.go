@@ -0,0 +1,410 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	"github.com/protoconf/protoconf/libprotoconf"
+	protoconfmutation "github.com/protoconf/protoconf/server/api/proto/v1"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// namespacedFields are the fields of the requests holding a path, or a
+// prefix or a pattern of paths, qualified with the name of the namespace of
+// the client
+var namespacedFields = []protoreflect.Name{"path", "prefix", "pattern"}
+
+// tenancy splits the configs served into the namespaces of the tenants
+// config, reloaded every time it changes. The clients of a namespace address
+// its configs without the name of the namespace, and are authorized and
+// limited by its policy and quota.
+type tenancy struct {
+	// path is the path of the tenants config, outside of every namespace
+	path string
+	// protoconfRoot is the root of the mutable configs counted by the quotas
+	protoconfRoot string
+
+	lock       sync.RWMutex
+	namespaces map[string]*namespace
+
+	subscriptionsLock sync.Mutex
+	subscriptions     map[string]uint32
+}
+
+// namespace is a namespace of the tenants config along with the limiter of
+// its calls, nil when they aren't limited
+type namespace struct {
+	*protoconf.Tenants_Namespace
+	limiter *rate.Limiter
+}
+
+// newTenancy reads the tenants config of path and keeps it up to date until
+// stopCh is closed. It fails when the tenants can't be read, a server can't
+// start without them.
+func newTenancy(watcher libprotoconf.Watcher, path string, protoconfRoot string, stopCh <-chan struct{}) (*tenancy, error) {
+	updates, err := watcher.Watch(path, stopCh)
+	if err != nil {
+		return nil, fmt.Errorf("error watching tenants config, path=%s err=%s", path, err)
+	}
+	t := &tenancy{path: path, protoconfRoot: protoconfRoot, subscriptions: make(map[string]uint32)}
+	if err := t.update(<-updates); err != nil {
+		return nil, err
+	}
+	go func() {
+		for update := range updates {
+			if err := t.update(update); err != nil {
+				log.Printf("Error updating tenants, keeping the previous ones, err=%s", err)
+				continue
+			}
+			log.Printf("Tenants updated, path=%s", path)
+		}
+	}()
+	return t, nil
+}
+
+func (t *tenancy) update(update libprotoconf.Result) error {
+	if update.Error != nil {
+		return fmt.Errorf("error reading tenants config, path=%s err=%s", t.path, update.Error)
+	}
+	if update.Value == nil {
+		return fmt.Errorf("tenants config not found, path=%s", t.path)
+	}
+	tenants := &protoconf.Tenants{}
+	if err := update.Value.UnmarshalTo(tenants); err != nil {
+		return fmt.Errorf("error reading tenants config, path=%s err=%s", t.path, err)
+	}
+	namespaces := make(map[string]*namespace)
+	for _, config := range tenants.GetNamespaces() {
+		name := config.GetName()
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid namespace %q, path=%s", name, t.path)
+		}
+		if namespaces[name] != nil {
+			return fmt.Errorf("namespace %s is declared more than once, path=%s", name, t.path)
+		}
+		// The clients of the namespace would write the tenants config
+		if strings.HasPrefix(t.path, name+"/") {
+			return fmt.Errorf("namespace %s holds the tenants config, path=%s", name, t.path)
+		}
+		ns := &namespace{Tenants_Namespace: config}
+		if rps := config.GetQuota().GetRequestsPerSecond(); rps > 0 {
+			ns.limiter = rate.NewLimiter(rate.Limit(rps), int(rps))
+		}
+		namespaces[name] = ns
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.namespaces = namespaces
+	return nil
+}
+
+// namespace is the namespace of the client of a call, by its SPIFFE ID and
+// the namespace it asks for in the metadata of the call, its only namespace
+// when it asks for none
+func (t *tenancy) namespace(ctx context.Context) (string, *namespace, error) {
+	id, err := command.PeerSPIFFEID(ctx)
+	if err != nil {
+		return "", nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	var requested string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(command.NamespaceMetadata)) > 0 {
+		requested = md.Get(command.NamespaceMetadata)[0]
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if requested != "" {
+		ns, ok := t.namespaces[requested]
+		if !ok || !matchIdentities(ns.GetIdentities(), id) {
+			return "", nil, status.Errorf(codes.PermissionDenied, "the client isn't in the namespace, identity=%s namespace=%s", id, requested)
+		}
+		return id, ns, nil
+	}
+	var found []*namespace
+	for _, ns := range t.namespaces {
+		if matchIdentities(ns.GetIdentities(), id) {
+			found = append(found, ns)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil, status.Errorf(codes.PermissionDenied, "the client isn't in any namespace, identity=%s", id)
+	case 1:
+		return id, found[0], nil
+	}
+	return "", nil, status.Errorf(codes.InvalidArgument, "the client is in more than one namespace, set the %s metadata to choose one, identity=%s", command.NamespaceMetadata, id)
+}
+
+// lookup is the current namespace of name, nil when it was removed, for the
+// subscriptions outliving the tenants config they started with
+func (t *tenancy) lookup(name string) *namespace {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.namespaces[name]
+}
+
+func matchIdentities(identities []string, id string) bool {
+	for _, identity := range identities {
+		if command.MatchSPIFFEID(identity, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// role is the role of the client of id on the config of path of a
+// namespace, path relative to the namespace
+func (ns *namespace) role(id string, path string) protoconf.Policy_Role {
+	if ns.GetPolicy() == nil {
+		return protoconf.Policy_READ_WRITE
+	}
+	return policyRole(ns.GetPolicy(), id, path)
+}
+
+// role is the role of the client of id on the config of path qualified with
+// the name of its namespace, for the admin UI browsing every namespace of
+// the client
+func (t *tenancy) role(id string, path string) protoconf.Policy_Role {
+	name, path, ok := strings.Cut(path, "/")
+	if !ok {
+		return protoconf.Policy_NO_ACCESS
+	}
+	ns := t.lookup(name)
+	if ns == nil || !matchIdentities(ns.GetIdentities(), id) {
+		return protoconf.Policy_NO_ACCESS
+	}
+	return ns.role(id, path)
+}
+
+// authorize checks the role of the client of a call on the path of the
+// request, and the quota of the namespace, then qualifies the paths of the
+// request with the name of the namespace
+func (t *tenancy) authorize(id string, ns *namespace, method string, req interface{}) error {
+	required, ok := methodRoles[method]
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "%s isn't allowed in the namespaces, identity=%s", method, id)
+	}
+	if request, ok := req.(interface{ GetPath() string }); ok {
+		if role := ns.role(id, request.GetPath()); role < required {
+			return status.Errorf(codes.PermissionDenied, "%s requires the %s role on the config, identity=%s role=%s namespace=%s path=%s", method, required, id, role, ns.GetName(), request.GetPath())
+		}
+	}
+	if err := t.checkQuota(ns, req); err != nil {
+		return err
+	}
+	return qualify(req, ns.GetName())
+}
+
+// checkQuota checks the size of the values written and the mutable configs
+// created against the quota of a namespace
+func (t *tenancy) checkQuota(ns *namespace, req interface{}) error {
+	quota := ns.GetQuota()
+	var value proto.Message
+	switch request := req.(type) {
+	case *protoconfmutation.ConfigMutationRequest:
+		value = request.GetValue()
+		if quota.GetMaxConfigs() > 0 {
+			if err := t.checkMaxConfigs(ns, request.GetPath()); err != nil {
+				return err
+			}
+		}
+	case *protoconfmutation.ConfigPatchRequest:
+		value = request.GetValue()
+	}
+	if max := quota.GetMaxValueBytes(); max > 0 && value != nil && proto.Size(value) > int(max) {
+		return status.Errorf(codes.ResourceExhausted, "the value is larger than the quota of the namespace, namespace=%s size=%d max_value_bytes=%d", ns.GetName(), proto.Size(value), max)
+	}
+	return nil
+}
+
+// checkMaxConfigs fails when a mutation of path would create a mutable
+// config in a namespace which has all the configs of its quota
+func (t *tenancy) checkMaxConfigs(ns *namespace, path string) error {
+	dir := filepath.Join(t.protoconfRoot, consts.MutableConfigPath, ns.GetName())
+	if _, err := os.Stat(filepath.Join(dir, filepath.Clean(path)+consts.CompiledConfigExtension)); err == nil {
+		return nil
+	}
+	var count uint32
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(file, consts.CompiledConfigExtension) {
+			count++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return status.Errorf(codes.Internal, "error counting the configs of the namespace, namespace=%s err=%s", ns.GetName(), err)
+	}
+	if max := ns.GetQuota().GetMaxConfigs(); count >= max {
+		return status.Errorf(codes.ResourceExhausted, "the namespace has all the configs of its quota, namespace=%s max_configs=%d", ns.GetName(), max)
+	}
+	return nil
+}
+
+// qualify prefixes the paths of a request with the name of a namespace,
+// failing on the paths leaving it
+func qualify(req interface{}, name string) error {
+	message, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	m := message.ProtoReflect()
+	for _, fieldName := range namespacedFields {
+		field := m.Descriptor().Fields().ByName(fieldName)
+		if field == nil || field.Kind() != protoreflect.StringKind || field.Cardinality() == protoreflect.Repeated {
+			continue
+		}
+		value := m.Get(field).String()
+		if strings.HasPrefix(value, "/") || value == ".." || strings.HasPrefix(value, "../") || strings.Contains(value, "/../") || strings.HasSuffix(value, "/..") {
+			return status.Errorf(codes.InvalidArgument, "invalid %s, %s=%s", fieldName, fieldName, value)
+		}
+		m.Set(field, protoreflect.ValueOfString(name+"/"+value))
+	}
+	return nil
+}
+
+// allow takes a call from the rate of a namespace
+func (ns *namespace) allow() error {
+	if ns.limiter != nil && !ns.limiter.Allow() {
+		return status.Errorf(codes.ResourceExhausted, "the namespace made more calls than its quota, namespace=%s requests_per_second=%d", ns.GetName(), ns.GetQuota().GetRequestsPerSecond())
+	}
+	return nil
+}
+
+func (t *tenancy) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !guarded(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	id, ns, err := t.namespace(ctx)
+	if err == nil {
+		err = ns.allow()
+	}
+	if err == nil {
+		err = t.authorize(id, ns, info.FullMethod, req)
+	}
+	if err != nil {
+		return nil, logError(err)
+	}
+	resp, err := handler(ctx, req)
+	if list, ok := resp.(*protoconfservice.ListConfigsResponse); ok {
+		var paths []string
+		for _, path := range list.GetPaths() {
+			path = strings.TrimPrefix(path, ns.GetName()+"/")
+			if ns.role(id, path) >= protoconf.Policy_READ_ONLY {
+				paths = append(paths, path)
+			}
+		}
+		list.Paths = paths
+	}
+	if list, ok := resp.(*protoconfservice.ListSubscribersResponse); ok {
+		var subscribers []*protoconfservice.Subscriber
+		for _, subscriber := range list.GetSubscribers() {
+			subscriber.Path = strings.TrimPrefix(subscriber.GetPath(), ns.GetName()+"/")
+			if ns.role(id, subscriber.GetPath()) >= protoconf.Policy_READ_ONLY {
+				subscribers = append(subscribers, subscriber)
+			}
+		}
+		list.Subscribers = subscribers
+	}
+	return resp, err
+}
+
+func (t *tenancy) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !guarded(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	id, ns, err := t.namespace(stream.Context())
+	if err == nil {
+		err = ns.allow()
+	}
+	if err != nil {
+		return logError(err)
+	}
+	release, err := t.subscribe(ns)
+	if err != nil {
+		return logError(err)
+	}
+	defer release()
+	return handler(srv, &tenantStream{ServerStream: stream, tenancy: t, method: info.FullMethod, id: id, namespace: ns})
+}
+
+// subscribe counts a subscription of a namespace against its quota, until
+// the returned func is called
+func (t *tenancy) subscribe(ns *namespace) (func(), error) {
+	t.subscriptionsLock.Lock()
+	defer t.subscriptionsLock.Unlock()
+	if max := ns.GetQuota().GetMaxSubscriptions(); max > 0 && t.subscriptions[ns.GetName()] >= max {
+		return nil, status.Errorf(codes.ResourceExhausted, "the namespace has all the subscriptions of its quota, namespace=%s max_subscriptions=%d", ns.GetName(), max)
+	}
+	t.subscriptions[ns.GetName()]++
+	return func() {
+		t.subscriptionsLock.Lock()
+		defer t.subscriptionsLock.Unlock()
+		t.subscriptions[ns.GetName()]--
+	}, nil
+}
+
+// ServerOptions are the gRPC server options splitting the calls into the
+// namespaces
+func (t *tenancy) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(t.unaryInterceptor),
+		grpc.ChainStreamInterceptor(t.streamInterceptor),
+	}
+}
+
+// tenantStream authorizes and qualifies every message received from the
+// client, and sends the client only the configs of a pattern it can read,
+// with their paths relative to its namespace
+type tenantStream struct {
+	grpc.ServerStream
+	tenancy   *tenancy
+	method    string
+	id        string
+	namespace *namespace
+}
+
+func (s *tenantStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	ns := s.tenancy.lookup(s.namespace.GetName())
+	if ns == nil {
+		return logError(status.Errorf(codes.PermissionDenied, "the namespace was removed, namespace=%s", s.namespace.GetName()))
+	}
+	if err := s.tenancy.authorize(s.id, ns, s.method, m); err != nil {
+		return logError(err)
+	}
+	return nil
+}
+
+func (s *tenantStream) SendMsg(m interface{}) error {
+	if update, ok := m.(*protoconfservice.ConfigsUpdate); ok {
+		path := strings.TrimPrefix(update.GetPath(), s.namespace.GetName()+"/")
+		ns := s.tenancy.lookup(s.namespace.GetName())
+		if ns == nil || ns.role(s.id, path) < protoconf.Policy_READ_ONLY {
+			return nil
+		}
+		update = proto.Clone(update).(*protoconfservice.ConfigsUpdate)
+		update.Path = path
+		m = update
+	}
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	protoconfmutation "github.com/protoconf/protoconf/server/api/proto/v1"
+	"github.com/protoconf/protoconf/testutil"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func setTenants(t *testing.T, store libprotoconf.Store, tenants *protoconf.Tenants) {
+	value, err := anypb.New(tenants)
+	assert.NoError(t, err)
+	data, err := libprotoconf.EncodeConfig(&protoconfvalue.ProtoconfValue{ProtoFile: "protoconf/tenants.proto", Value: value})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set("protoconf/tenants", data))
+}
+
+func TestTenancy(t *testing.T) {
+	const (
+		searchAPI     = "spiffe://example.org/ns/search/sa/api"
+		searchRelease = "spiffe://example.org/ns/search/sa/release"
+		ads           = "spiffe://example.org/ns/ads/sa/api"
+		ops           = "spiffe://example.org/ns/ops/sa/admin"
+	)
+	root, err := ioutil.TempDir("", "tenants")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	store := libprotoconf.NewMemoryStore()
+	setTenants(t, store, &protoconf.Tenants{Namespaces: []*protoconf.Tenants_Namespace{
+		{
+			Name:       "search",
+			Identities: []string{"spiffe://example.org/ns/search/*", ops},
+			Policy: &protoconf.Policy{Rules: []*protoconf.Policy_Rule{
+				{Identities: []string{"*"}, Role: protoconf.Policy_READ_ONLY},
+				{Identities: []string{searchRelease}, Role: protoconf.Policy_READ_WRITE},
+			}},
+			Quota: &protoconf.Tenants_Quota{MaxConfigs: 1, MaxValueBytes: 100, MaxSubscriptions: 1},
+		},
+		{Name: "ads", Identities: []string{ads, ops}, Quota: &protoconf.Tenants_Quota{RequestsPerSecond: 10}},
+	}})
+
+	_, err = newTenancy(libprotoconf.NewStoreWatcher(store, ""), "missing", root, nil)
+	assert.Error(t, err)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	tenancy, err := newTenancy(libprotoconf.NewStoreWatcher(store, ""), "protoconf/tenants", root, stopCh)
+	assert.NoError(t, err)
+
+	call := func(ctx context.Context, method string, req interface{}) (interface{}, error) {
+		return tenancy.unaryInterceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil })
+	}
+	get := func(ctx context.Context, path string) (string, error) {
+		req, err := call(ctx, "/v1.ProtoconfService/GetConfig", &protoconfservice.GetConfigRequest{Path: path})
+		if err != nil {
+			return "", err
+		}
+		return req.(*protoconfservice.GetConfigRequest).GetPath(), nil
+	}
+	inNamespace := func(ctx context.Context, namespace string) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs(command.NamespaceMetadata, namespace))
+	}
+
+	// The paths of the clients are under their namespace
+	path, err := get(peerContext(t, searchAPI), "web/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "search/web/api", path)
+	path, err = get(peerContext(t, ads), "web/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "ads/web/api", path)
+	_, err = get(peerContext(t, ads), "../search/web/api")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = get(inNamespace(peerContext(t, ads), "search"), "web/api")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = get(peerContext(t, "spiffe://example.org/ns/other/sa/x"), "web/api")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = get(context.Background(), "web/api")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	// The clients of several namespaces choose one
+	_, err = get(peerContext(t, ops), "web/api")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	path, err = get(inNamespace(peerContext(t, ops), "ads"), "web/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "ads/web/api", path)
+	// and browse every namespace of theirs in the UI
+	assert.Equal(t, protoconf.Policy_READ_ONLY, tenancy.role(ops, "search/web/api"))
+	assert.Equal(t, protoconf.Policy_READ_WRITE, tenancy.role(ops, "ads/web/api"))
+	assert.Equal(t, protoconf.Policy_NO_ACCESS, tenancy.role(ads, "search/web/api"))
+	assert.Equal(t, protoconf.Policy_NO_ACCESS, tenancy.role(ops, "protoconf/tenants"))
+
+	// The policy of the namespace authorizes its clients
+	value, err := anypb.New(wrapperspb.String("value"))
+	assert.NoError(t, err)
+	mutate := func(id string, path string, value *anypb.Any) error {
+		_, err := call(peerContext(t, id), "/v1.ProtoconfMutationService/MutateConfig",
+			&protoconfmutation.ConfigMutationRequest{Path: path, Value: &protoconfvalue.ProtoconfValue{Value: value}})
+		return err
+	}
+	assert.Equal(t, codes.PermissionDenied, status.Code(mutate(searchAPI, "web/api", value)))
+	assert.NoError(t, mutate(searchRelease, "web/api", value))
+	assert.NoError(t, mutate(ads, "web/api", value))
+
+	// The quota bounds the values and the configs of the namespace
+	large, err := anypb.New(wrapperspb.String(string(make([]byte, 200))))
+	assert.NoError(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(mutate(searchRelease, "web/api", large)))
+	mutable := filepath.Join(root, consts.MutableConfigPath, "search", "web", "api"+consts.CompiledConfigExtension)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(mutable), 0755))
+	assert.NoError(t, ioutil.WriteFile(mutable, []byte("{}"), 0644))
+	assert.NoError(t, mutate(searchRelease, "web/api", value))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(mutate(searchRelease, "web/other", value)))
+
+	// The calls of a namespace are limited by its rate
+	ctx := inNamespace(peerContext(t, ops), "ads")
+	var limited error
+	for i := 0; i < 20 && limited == nil; i++ {
+		_, limited = get(ctx, "web/api")
+	}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(limited))
+
+	// The configs are listed relative to the namespace
+	list, err := tenancy.unaryInterceptor(peerContext(t, searchAPI), &protoconfservice.ListConfigsRequest{Prefix: "web/"},
+		&grpc.UnaryServerInfo{FullMethod: "/v1.ProtoconfService/ListConfigs"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assert.Equal(t, "search/web/", req.(*protoconfservice.ListConfigsRequest).GetPrefix())
+			return &protoconfservice.ListConfigsResponse{Paths: []string{"search/web/api"}}, nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web/api"}, list.(*protoconfservice.ListConfigsResponse).Paths)
+
+	// The subscriptions are relative to the namespace and bounded by its quota
+	subscribe := func(handler grpc.StreamHandler) (*recordingStream, error) {
+		stream := &recordingStream{ctx: peerContext(t, searchAPI)}
+		return stream, tenancy.streamInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/v1.ProtoconfService/SubscribeForConfigs"}, handler)
+	}
+	stream, err := subscribe(func(srv interface{}, stream grpc.ServerStream) error {
+		request := &protoconfservice.ConfigsSubscriptionRequest{Pattern: "web/*"}
+		assert.NoError(t, stream.RecvMsg(request))
+		assert.Equal(t, "search/web/*", request.GetPattern())
+		_, err := subscribe(func(srv interface{}, stream grpc.ServerStream) error { return nil })
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		return stream.SendMsg(&protoconfservice.ConfigsUpdate{Path: "search/web/api"})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "web/api", stream.sent[0].(*protoconfservice.ConfigsUpdate).GetPath())
+	_, err = subscribe(func(srv interface{}, stream grpc.ServerStream) error { return nil })
+	assert.NoError(t, err)
+
+	// The tenants are reloaded as they change
+	setTenants(t, store, &protoconf.Tenants{Namespaces: []*protoconf.Tenants_Namespace{
+		{Name: "search", Identities: []string{ads}},
+	}})
+	assert.Eventually(t, func() bool {
+		path, err := get(peerContext(t, ads), "web/api")
+		return err == nil && path == "search/web/api"
+	}, 5*time.Second, 10*time.Millisecond)
+	// The namespaces can't hold the tenants config
+	assert.Error(t, tenancy.update(libprotoconf.Result{Value: testutil.MustAny(t, &protoconf.Tenants{Namespaces: []*protoconf.Tenants_Namespace{{Name: "protoconf"}}})}))
+}
@@ -0,0 +1,612 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/rollback"
+	"github.com/protoconf/protoconf/targeting"
+	"github.com/protoconf/protoconf/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// The paths of the pages of the admin UI
+const (
+	uiConfigsPath  = "/configs/"
+	uiDiffPath     = "/diff/"
+	uiRollbackPath = "/rollback/"
+)
+
+// roles are the roles of the users of the UI on the configs, by their
+// SPIFFE ID: the policy of -policy or the namespaces of -tenants
+type roles interface {
+	role(id string, path string) protoconf.Policy_Role
+}
+
+// ui is the admin web UI of the server, browsing the configs served, their
+// values and the versions of their history, and rolling them back:
+//
+//	GET  /configs/{prefix}/              the directories and configs under prefix
+//	GET  /configs/{path}?version=...     a config, a version of its history,
+//	                                     and the versions its subscribers applied
+//	GET  /diff/{path}?from=...&to=...    the fields changed between two versions
+//	POST /rollback/{path}                rolls a config back to the version of the form
+//
+// The users are authorized by roles as the clients of the gRPC API are, and
+// every user can read and roll back every config without roles.
+type ui struct {
+	server  server
+	watcher libprotoconf.Watcher
+	service protoconfservice.ProtoconfServiceServer
+	roles   roles
+	marshal protojson.MarshalOptions
+}
+
+// newUI serves the admin UI of the configs served by configs, rolling them
+// back with s
+func newUI(s server, configs *configService, roles roles) http.Handler {
+	u := &ui{
+		server:  s,
+		watcher: configs.watcher,
+		service: configs,
+		roles:   roles,
+		marshal: protojson.MarshalOptions{Multiline: true, Indent: "  ", Resolver: agent.NewRootResolver(s.protoconfRoot)},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			u.error(w, http.StatusNotFound, "page not found")
+			return
+		}
+		http.Redirect(w, r, uiConfigsPath, http.StatusFound)
+	})
+	mux.HandleFunc(uiConfigsPath, u.configs)
+	mux.HandleFunc(uiDiffPath, u.diff)
+	mux.HandleFunc(uiRollbackPath, u.rollback)
+	return mux
+}
+
+// identity is the SPIFFE ID of the user of a request with mutual TLS, or
+// its address
+func identity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if id, err := command.SPIFFEID(r.TLS.VerifiedChains[0][0]); err == nil {
+			return id
+		}
+	}
+	return r.RemoteAddr
+}
+
+// role is the role of the user of a request on the config of path
+func (u *ui) role(r *http.Request, path string) protoconf.Policy_Role {
+	if u.roles == nil {
+		return protoconf.Policy_READ_WRITE
+	}
+	return u.roles.role(identity(r), path)
+}
+
+// rollbackRole is the role rolling back the config of path requires, as
+// RollbackConfig does
+func (u *ui) rollbackRole(path string) protoconf.Policy_Role {
+	if a, ok := u.roles.(*authorizer); ok && path == a.path {
+		return protoconf.Policy_ADMIN
+	}
+	return protoconf.Policy_READ_WRITE
+}
+
+// crumb is a link to a directory of the path of a page
+type crumb struct {
+	Name string
+	Link string
+}
+
+// crumbs are the links to the directories of path, and to its config when
+// it's the path of a config
+func crumbs(path string) []crumb {
+	result := []crumb{{Name: "configs", Link: uiConfigsPath}}
+	dir := ""
+	for _, name := range strings.SplitAfter(path, "/") {
+		if name == "" {
+			continue
+		}
+		dir += name
+		result = append(result, crumb{Name: strings.TrimSuffix(name, "/"), Link: uiConfigsPath + dir})
+	}
+	return result
+}
+
+func (u *ui) configs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		u.error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, uiConfigsPath)
+	if path == "" || strings.HasSuffix(path, "/") {
+		u.list(w, r, path)
+		return
+	}
+	u.config(w, r, path)
+}
+
+// list lists the directories and the configs under prefix the user can
+// read, the first directories being the namespaces with -tenants
+func (u *ui) list(w http.ResponseWriter, r *http.Request, prefix string) {
+	lister, ok := u.watcher.(libprotoconf.Lister)
+	if !ok {
+		u.error(w, http.StatusNotImplemented, "listing configs isn't supported")
+		return
+	}
+	paths, err := lister.List(prefix)
+	if err != nil {
+		log.Printf("Error listing configs, prefix=%s err=%s", prefix, err)
+		u.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	dirs := make(map[string]bool)
+	page := struct {
+		Crumbs  []crumb
+		Dirs    []string
+		Configs []string
+	}{Crumbs: crumbs(prefix)}
+	for _, path := range paths {
+		if u.role(r, path) < protoconf.Policy_READ_ONLY {
+			continue
+		}
+		name := strings.TrimPrefix(path, prefix)
+		if i := strings.Index(name, "/"); i >= 0 {
+			dirs[name[:i+1]] = true
+			continue
+		}
+		page.Configs = append(page.Configs, prefix+name)
+	}
+	for dir := range dirs {
+		page.Dirs = append(page.Dirs, prefix+dir)
+	}
+	sort.Strings(page.Dirs)
+	sort.Strings(page.Configs)
+	u.render(w, http.StatusOK, "list", page)
+}
+
+// uiVersion is a version of the history of a config
+type uiVersion struct {
+	Version   int64
+	CreatedAt string
+	Deleted   bool
+	// Previous is the version before, when HasPrevious
+	Previous    int64
+	HasPrevious bool
+	Current     bool
+}
+
+// uiSubscriber is a subscriber of a config and the versions it was sent and
+// acknowledged
+type uiSubscriber struct {
+	ClientID       string
+	Labels         string
+	Version        string
+	Sent           string
+	Acknowledged   string
+	AcknowledgedAt string
+	// Applied is set when the subscriber acknowledged the version it was
+	// sent last
+	Applied bool
+}
+
+// subscribers lists the subscribers of the config of path connected to the
+// server
+func (u *ui) subscribers(ctx context.Context, path string) ([]uiSubscriber, error) {
+	response, err := u.service.ListSubscribers(ctx, &protoconfservice.ListSubscribersRequest{Prefix: path})
+	if err != nil {
+		return nil, err
+	}
+	var subscribers []uiSubscriber
+	for _, s := range response.GetSubscribers() {
+		if s.GetPath() != path {
+			continue
+		}
+		subscriber := uiSubscriber{
+			ClientID:     s.GetClientId(),
+			Labels:       targeting.Labels(s.GetLabels()).String(),
+			Version:      s.GetVersion(),
+			Acknowledged: s.GetAcknowledgedVersion(),
+			Applied:      s.GetVersion() != "" && s.GetVersion() == s.GetAcknowledgedVersion(),
+		}
+		if s.GetSent() != nil {
+			subscriber.Sent = s.GetSent().AsTime().UTC().Format(time.RFC3339)
+		}
+		if s.GetAcknowledged() != nil {
+			subscriber.AcknowledgedAt = s.GetAcknowledged().AsTime().UTC().Format(time.RFC3339)
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	return subscribers, nil
+}
+
+// config shows the value of a config, or of a version of its history with
+// ?version=, along with the versions of its history, and the subscribers of
+// its current value
+func (u *ui) config(w http.ResponseWriter, r *http.Request, path string) {
+	if !u.authorize(w, r, path, protoconf.Policy_READ_ONLY) {
+		return
+	}
+	page := struct {
+		Crumbs      []crumb
+		Path        string
+		Version     int64
+		Type        string
+		Value       string
+		History     bool
+		Versions    []uiVersion
+		CanRollback bool
+		// ValueVersion identifies the value served, as the subscribers
+		// acknowledge it, and Applied counts the Subscribers which applied
+		// the version they were sent
+		ValueVersion string
+		Subscribers  []uiSubscriber
+		Applied      int
+	}{Crumbs: crumbs(path), Path: path, CanRollback: !u.server.config.readOnly && u.role(r, path) >= u.rollbackRole(path)}
+
+	versions, err := u.versions(path)
+	if err != nil && err != rollback.ErrNoHistory {
+		u.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	page.History = err == nil
+	for i, version := range versions {
+		v := uiVersion{Version: version.Version, CreatedAt: version.CreatedAt.UTC().Format(time.RFC3339), Deleted: version.Value == nil, Current: i == len(versions)-1}
+		if i > 0 {
+			v.Previous, v.HasPrevious = versions[i-1].Version, true
+		}
+		// The newest first
+		page.Versions = append([]uiVersion{v}, page.Versions...)
+	}
+
+	var value *anypb.Any
+	if requested := r.URL.Query().Get("version"); requested != "" {
+		page.Version, err = strconv.ParseInt(requested, 10, 64)
+		if err != nil {
+			u.error(w, http.StatusBadRequest, "invalid version "+strconv.Quote(requested))
+			return
+		}
+		config, err := findVersion(versions, page.Version)
+		if err != nil {
+			u.error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		value = config.GetValue()
+	} else if value, err = readConfig(u.watcher, path); err != nil {
+		u.error(w, http.StatusNotFound, err.Error())
+		return
+	} else {
+		page.ValueVersion = agent.Version(value)
+		if page.Subscribers, err = u.subscribers(r.Context(), path); err != nil {
+			u.error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, subscriber := range page.Subscribers {
+			if subscriber.Applied {
+				page.Applied++
+			}
+		}
+	}
+
+	if value != nil {
+		page.Type = strings.TrimPrefix(value.GetTypeUrl(), "type.googleapis.com/")
+		data, err := u.marshal.Marshal(value)
+		if err != nil {
+			page.Value = "Error rendering the value of the config: " + err.Error()
+		} else {
+			page.Value = string(data)
+		}
+	}
+	u.render(w, http.StatusOK, "config", page)
+}
+
+// diff shows the fields changed between two versions of a config
+func (u *ui) diff(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, uiDiffPath)
+	if !u.authorize(w, r, path, protoconf.Policy_READ_ONLY) {
+		return
+	}
+	versions, err := u.versions(path)
+	if err != nil {
+		u.error(w, http.StatusConflict, err.Error())
+		return
+	}
+	page := struct {
+		Crumbs  []crumb
+		Path    string
+		From    int64
+		To      int64
+		Message string
+		Diffs   []utils.FieldDiff
+	}{Crumbs: crumbs(path), Path: path}
+	var configs [2]*protoconfvalue.ProtoconfValue
+	for i, version := range []*int64{&page.From, &page.To} {
+		name := []string{"from", "to"}[i]
+		*version, err = strconv.ParseInt(r.URL.Query().Get(name), 10, 64)
+		if err != nil {
+			u.error(w, http.StatusBadRequest, "invalid version "+strconv.Quote(r.URL.Query().Get(name)))
+			return
+		}
+		if configs[i], err = findVersion(versions, *version); err != nil {
+			u.error(w, http.StatusNotFound, err.Error())
+			return
+		}
+	}
+	switch {
+	case configs[0] == nil && configs[1] == nil:
+		page.Message = "The config is deleted in both versions."
+	case configs[0] == nil:
+		page.Message = "The config was created."
+		configs[0] = &protoconfvalue.ProtoconfValue{ProtoFile: configs[1].GetProtoFile(), Value: &anypb.Any{TypeUrl: configs[1].GetValue().GetTypeUrl()}}
+	case configs[1] == nil:
+		page.Message = "The config was deleted."
+	}
+	if configs[0] != nil && configs[1] != nil {
+		page.Diffs, err = utils.DiffConfigs(configs[0], configs[1], u.server.protoconfRoot)
+		if err != nil {
+			u.error(w, http.StatusInternalServerError, "error comparing the versions, "+err.Error())
+			return
+		}
+		if len(page.Diffs) == 0 && page.Message == "" {
+			page.Message = "The versions are the same."
+		}
+	}
+	u.render(w, http.StatusOK, "diff", page)
+}
+
+// rollback rolls a config back to the version of the form, as
+// RollbackConfig does, recording the rollback as the change of the user
+func (u *ui) rollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		u.error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !sameOrigin(r) {
+		u.error(w, http.StatusForbidden, "the rollbacks are posted by the pages of the UI only")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, uiRollbackPath)
+	if !u.authorize(w, r, path, u.rollbackRole(path)) {
+		return
+	}
+	if u.server.store == nil {
+		u.error(w, http.StatusConflict, "the history of the configs is kept by servers serving the configs of a key-value store, with -from-store")
+		return
+	}
+	if u.server.config.readOnly {
+		u.error(w, http.StatusConflict, "the server is read-only, roll the config back on the server it follows")
+		return
+	}
+	version, err := strconv.ParseInt(r.PostFormValue("version"), 10, 64)
+	if err != nil {
+		u.error(w, http.StatusBadRequest, "invalid version "+strconv.Quote(r.PostFormValue("version")))
+		return
+	}
+	id := identity(r)
+	log.Printf("Rolling back from the UI, path=%s version=%d identity=%s", path, version, id)
+	entry, err := rollback.Rollback(u.server.store, u.server.prefix, path, version, u.server.protoconfRoot)
+	switch {
+	case errors.Is(err, rollback.ErrVersionNotFound):
+		u.error(w, http.StatusNotFound, err.Error())
+		return
+	case err == rollback.ErrNoHistory:
+		u.error(w, http.StatusConflict, err.Error())
+		return
+	case err == libprotoconf.ErrVersionMismatch:
+		u.error(w, http.StatusConflict, "the config was changed while it was rolled back, path="+path)
+		return
+	case err != nil:
+		log.Printf("Error rolling back config, path=%s err=%s", path, err)
+		u.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("Rolled back path=%s version=%s", path, entry.NewVersion)
+	if err := u.server.recordAs(id, entry); err != nil {
+		log.Printf("Error: %s", err)
+		u.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, uiConfigsPath+path, http.StatusSeeOther)
+}
+
+// authorize checks the path of a page and the role of its user on it,
+// responding with the error when they fail
+func (u *ui) authorize(w http.ResponseWriter, r *http.Request, path string, required protoconf.Policy_Role) bool {
+	err := (configService{}).checkPath(path)
+	if err == nil && u.role(r, path) < required {
+		err = status.Errorf(codes.PermissionDenied, "this page requires the %s role on the config, identity=%s path=%s", required, identity(r), path)
+	}
+	switch status.Code(err) {
+	case codes.OK:
+		return true
+	case codes.PermissionDenied:
+		u.error(w, http.StatusForbidden, status.Convert(err).Message())
+	default:
+		u.error(w, http.StatusBadRequest, status.Convert(err).Message())
+	}
+	return false
+}
+
+// versions are the versions of the history of the config of path, oldest
+// first
+func (u *ui) versions(path string) ([]*libprotoconf.ConfigVersion, error) {
+	if u.server.store == nil {
+		return nil, rollback.ErrNoHistory
+	}
+	return rollback.Versions(u.server.store, u.server.prefix, path)
+}
+
+// findVersion is the value of a version of versions, nil when the config
+// was deleted by the version
+func findVersion(versions []*libprotoconf.ConfigVersion, version int64) (*protoconfvalue.ProtoconfValue, error) {
+	for _, v := range versions {
+		if v.Version != version {
+			continue
+		}
+		if v.Value == nil {
+			return nil, nil
+		}
+		return libprotoconf.DecodeConfig(v.Value)
+	}
+	return nil, rollback.ErrVersionNotFound
+}
+
+// readConfig reads the current value of the config of path
+func readConfig(watcher libprotoconf.Watcher, path string) (*anypb.Any, error) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	updates, err := watcher.Watch(path, stopCh)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case update, ok := <-updates:
+		if !ok {
+			return nil, errors.New("watch channel closed")
+		}
+		return update.Value, update.Error
+	case <-time.After(10 * time.Second):
+		return nil, errors.New("timed out reading the config")
+	}
+}
+
+// sameOrigin tells whether a request was sent by a page of the UI, so the
+// forms of other sites can't roll back the configs with the certificate of
+// the user
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == r.Host
+}
+
+func (u *ui) render(w http.ResponseWriter, code int, name string, page interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+	w.WriteHeader(code)
+	if err := uiTemplates.ExecuteTemplate(w, name, page); err != nil {
+		log.Printf("Error rendering page %s, err=%s", name, err)
+	}
+}
+
+func (u *ui) error(w http.ResponseWriter, code int, message string) {
+	u.render(w, code, "error", struct {
+		Crumbs  []crumb
+		Status  string
+		Message string
+	}{crumbs(""), http.StatusText(code), message})
+}
+
+var uiTemplates = template.Must(template.New("").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>protoconf</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+a { color: #0b5cad; text-decoration: none; }
+a:hover { text-decoration: underline; }
+nav { margin-bottom: 1.5em; }
+nav a + a::before { content: " / "; color: #888; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+table { border-collapse: collapse; }
+td, th { padding: 0.3em 1em 0.3em 0; text-align: left; vertical-align: top; }
+.removed { color: #b31d28; }
+.added { color: #22863a; }
+.note { color: #666; }
+form { display: inline; }
+</style>
+</head>
+<body>
+<nav>{{range .Crumbs}}<a href="{{.Link}}">{{.Name}}</a>{{end}}</nav>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "list"}}{{template "header" .}}
+<ul>
+{{range .Dirs}}<li><a href="/configs/{{.}}">{{.}}</a></li>
+{{end}}{{range .Configs}}<li><a href="/configs/{{.}}">{{.}}</a></li>
+{{end}}</ul>
+{{if not (or .Dirs .Configs)}}<p class="note">No configs.</p>{{end}}
+{{template "footer"}}{{end}}
+
+{{define "config"}}{{template "header" .}}
+<h2>{{.Path}}{{if .Version}} at version {{.Version}}{{end}}</h2>
+{{if .Type}}<p>{{.Type}}{{if .ValueVersion}}, version {{.ValueVersion}}{{end}}</p>
+<pre>{{.Value}}</pre>
+{{else}}<p class="note">The config is deleted.</p>
+{{end}}
+{{if not .Version}}<h3>Subscribers</h3>
+{{if .Subscribers}}<p>{{.Applied}} of {{len .Subscribers}} subscribers applied the version they were sent.</p>
+<table>
+<tr><th>Client</th><th>Labels</th><th>Sent</th><th>Acknowledged</th></tr>
+{{range .Subscribers}}<tr>
+<td>{{.ClientID}}</td>
+<td>{{.Labels}}</td>
+<td>{{.Version}} {{.Sent}}</td>
+<td class="{{if .Applied}}added{{else}}removed{{end}}">{{if .Acknowledged}}{{.Acknowledged}} {{.AcknowledgedAt}}{{else}}not yet{{end}}</td>
+</tr>
+{{end}}</table>
+{{else}}<p class="note">No subscribers connected to the server.</p>
+{{end}}{{end}}
+{{if .History}}<h3>Versions</h3>
+<table>
+<tr><th>Version</th><th>Written at</th><th></th><th></th><th></th></tr>
+{{range .Versions}}{{$version := .}}<tr>
+<td><a href="/configs/{{$.Path}}?version={{.Version}}">{{.Version}}</a>{{if .Current}} (current){{end}}</td>
+<td>{{.CreatedAt}}{{if .Deleted}} deleted{{end}}</td>
+<td>{{if .HasPrevious}}<a href="/diff/{{$.Path}}?from={{.Previous}}&to={{.Version}}">changes</a>{{end}}</td>
+<td>{{if not .Current}}{{with index $.Versions 0}}<a href="/diff/{{$.Path}}?from={{$version.Version}}&to={{.Version}}">diff with current</a>{{end}}{{end}}</td>
+<td>{{if and $.CanRollback (not .Current) (not .Deleted)}}<form method="post" action="/rollback/{{$.Path}}"><input type="hidden" name="version" value="{{.Version}}"><button type="submit">Roll back to this version</button></form>{{end}}</td>
+</tr>
+{{end}}</table>
+{{else}}<p class="note">The history of the configs is kept by servers serving the configs of a key-value store keeping it, with -from-store and -history.</p>
+{{end}}
+{{template "footer"}}{{end}}
+
+{{define "diff"}}{{template "header" .}}
+<h2>{{.Path}} from version <a href="/configs/{{.Path}}?version={{.From}}">{{.From}}</a> to <a href="/configs/{{.Path}}?version={{.To}}">{{.To}}</a></h2>
+{{if .Message}}<p class="note">{{.Message}}</p>{{end}}
+{{if .Diffs}}<table>
+<tr><th>Field</th><th>Before</th><th>After</th></tr>
+{{range .Diffs}}<tr><td>{{.Path}}</td><td class="removed">{{.Old}}</td><td class="added">{{.New}}</td></tr>
+{{end}}</table>
+{{end}}
+{{template "footer"}}{{end}}
+
+{{define "error"}}{{template "header" .}}
+<h2>{{.Status}}</h2>
+<p>{{.Message}}</p>
+{{template "footer"}}{{end}}
+`))
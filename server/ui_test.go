@@ -0,0 +1,148 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/utils"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// prefixRoles grants the role of the longest prefix of the path of a config
+type prefixRoles map[string]protoconf.Policy_Role
+
+func (r prefixRoles) role(id string, path string) protoconf.Policy_Role {
+	role, longest := protoconf.Policy_NO_ACCESS, -1
+	for prefix, granted := range r {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			role, longest = granted, len(prefix)
+		}
+	}
+	return role
+}
+
+func TestUI(t *testing.T) {
+	root, err := ioutil.TempDir("", "ui")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, consts.SrcPath), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, consts.SrcPath, "flags.proto"), []byte(flagsProto), 0644))
+	files, err := utils.ParseProtoFiles([]string{filepath.Join(root, consts.SrcPath)}, nil, "flags.proto")
+	assert.NoError(t, err)
+	flagsDescriptor := files[0].Messages().ByName("Flags")
+
+	store := libprotoconf.NewMemoryStore()
+	set := func(path string, text string) {
+		message := dynamicpb.NewMessage(flagsDescriptor)
+		assert.NoError(t, prototext.Unmarshal([]byte(text), message))
+		any, err := anypb.New(message)
+		assert.NoError(t, err)
+		value, err := libprotoconf.EncodeConfig(&protoconfvalue.ProtoconfValue{ProtoFile: "flags.proto", Value: any})
+		assert.NoError(t, err)
+		assert.NoError(t, store.Set("protoconf/"+path, value))
+	}
+	set("services/web", `owner: "web" limits { max_connections: 10 }`)
+	set("services/web", `owner: "web" limits { max_connections: 20 }`)
+	set("services/api", `owner: "api"`)
+	set("global", `enabled: true`)
+
+	s := server{config: &cliConfig{}, protoconfRoot: root, store: store, prefix: "protoconf/", audit: audit.NewStoreLog(store, "audit/")}
+	configs, closeConfigs := newStoreConfigService(store, "protoconf/", nil, nil, command.DefaultSubscriberQueue)
+	defer closeConfigs()
+	ui := httptest.NewServer(newUI(s, configs, nil))
+	defer ui.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	get := func(path string) (int, string) {
+		response, err := client.Get(ui.URL + path)
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		assert.NoError(t, err)
+		return response.StatusCode, string(body)
+	}
+
+	code, body := get("/configs/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `href="/configs/services/"`)
+	assert.Contains(t, body, `href="/configs/global"`)
+	code, body = get("/configs/services/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `href="/configs/services/web"`)
+
+	// A config, with its versions and their changes
+	code, body = get("/configs/services/web")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Flags")
+	assert.Regexp(t, `maxConnections&#34;:\s+20\b`, body)
+	assert.Contains(t, body, `href="/diff/services/web?from=1&to=2"`)
+	assert.Contains(t, body, "No subscribers connected to the server.")
+	code, body = get("/configs/services/web?version=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Regexp(t, `maxConnections&#34;:\s+10\b`, body)
+	code, body = get("/diff/services/web?from=1&to=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "<td>limits.max_connections</td>")
+	code, _ = get("/configs/services/web?version=7")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get("/configs/services/missing")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// Rolling back from the UI is recorded as the change of the user
+	response, err := client.PostForm(ui.URL+"/rollback/services/web", url.Values{"version": {"1"}})
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, response.StatusCode)
+	assert.Equal(t, "/configs/services/web", response.Header.Get("Location"))
+	code, body = get("/configs/services/web?version=3")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Regexp(t, `maxConnections&#34;:\s+10\b`, body)
+	entries, err := s.audit.Entries("services/web")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, audit.ActionRollback, entries[0].Action)
+	assert.True(t, strings.HasPrefix(entries[0].Identity, "127.0.0.1:"))
+
+	// The forms of other sites can't roll back the configs
+	request, err := http.NewRequest(http.MethodPost, ui.URL+"/rollback/services/web", strings.NewReader("version=2"))
+	assert.NoError(t, err)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Origin", "https://evil.example.org")
+	response, err = client.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	// The users see and roll back the configs their roles allow
+	restricted := httptest.NewServer(newUI(s, configs, prefixRoles{"services/": protoconf.Policy_READ_ONLY}))
+	defer restricted.Close()
+	response, err = client.Get(restricted.URL + "/configs/")
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `href="/configs/services/"`)
+	assert.NotContains(t, string(data), `href="/configs/global"`)
+	response, err = client.Get(restricted.URL + "/configs/global")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	response, err = client.PostForm(restricted.URL+"/rollback/services/web", url.Values{"version": {"2"}})
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+}
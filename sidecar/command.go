@@ -0,0 +1,157 @@
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/consts"
+	"google.golang.org/grpc"
+)
+
+type cliCommand struct{}
+
+type cliConfig struct {
+	agentAddress  string
+	protoRoot     string
+	fileMode      string
+	retryInterval time.Duration
+	reloadSignal  string
+	reloadPidFile string
+	reloadCommand string
+	reloadDelay   time.Duration
+	tls           command.TLSConfig
+	compression   string
+}
+
+func newFlagSet() (*flag.FlagSet, *cliConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... config_path=file...")
+		fmt.Fprintln(flags.Output(), "Writes configs to files, as JSON for the files ending with .json and in the text format for .textproto, .txtpb or .pbtxt.")
+		flags.PrintDefaults()
+	}
+
+	config := &cliConfig{}
+	flags.StringVar(&config.agentAddress, "agent-address", consts.AgentDefaultAddress, "Address of the agent serving the configs")
+	flags.StringVar(&config.protoRoot, "proto-root", "", "Protoconf root the types of the configs are read from")
+	flags.StringVar(&config.fileMode, "file-mode", "0644", "Permissions of the files written, in octal")
+	flags.DurationVar(&config.retryInterval, "retry-interval", DefaultRetryInterval, "How long to wait before writing a config again after failing to")
+	flags.StringVar(&config.reloadSignal, "reload-signal", "HUP", "Signal sent to the process of -reload-pid-file when the files change, by name or number")
+	flags.StringVar(&config.reloadPidFile, "reload-pid-file", "", "Pid file of the process signaled when the files change")
+	flags.StringVar(&config.reloadCommand, "reload-command", "", "Command run when the files change, e.g. \"nginx -s reload\", split on spaces and run without a shell")
+	flags.DurationVar(&config.reloadDelay, "reload-delay", DefaultReloadDelay, "How long to wait after a file changes before reloading, reloading the files changing meanwhile together")
+	command.AddTLSClientFlags(flags, &config.tls)
+	command.AddCompressionFlag(flags, &config.compression)
+
+	return flags, config
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config := newFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 1
+	}
+	var targets []*Target
+	for _, arg := range flags.Args() {
+		target, err := ParseTarget(arg)
+		if err != nil {
+			log.Printf("Error, %s", err)
+			return 1
+		}
+		targets = append(targets, target)
+	}
+	fileMode, err := strconv.ParseUint(config.fileMode, 8, 32)
+	if err != nil {
+		log.Printf("Error, invalid -file-mode %q", config.fileMode)
+		return 1
+	}
+
+	var reloaders []Reloader
+	if config.reloadPidFile != "" {
+		reloadSignal, err := ParseSignal(config.reloadSignal)
+		if err != nil {
+			log.Printf("Error, %s", err)
+			return 1
+		}
+		reloaders = append(reloaders, SignalReloader(config.reloadPidFile, reloadSignal))
+	}
+	if fields := strings.Fields(config.reloadCommand); len(fields) > 0 {
+		reloaders = append(reloaders, CommandReloader(fields))
+	}
+	var reload Reloader
+	if len(reloaders) > 0 {
+		reload = func(ctx context.Context) error {
+			for _, reloader := range reloaders {
+				if err := reloader(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	transport, err := config.tls.DialOption()
+	if err != nil {
+		log.Printf("Error setting up mutual TLS, err=%s", err)
+		return 1
+	}
+	compression, err := command.CompressionDialOptions(config.compression)
+	if err != nil {
+		log.Printf("Error, -compression %s", err)
+		return 1
+	}
+	conn, err := grpc.Dial(config.agentAddress, append(compression, transport)...)
+	if err != nil {
+		log.Printf("Error connecting to the agent at \"%s\", err=%s", config.agentAddress, err)
+		return 1
+	}
+	defer conn.Close()
+
+	var resolver agent.Resolver
+	if config.protoRoot != "" {
+		resolver = agent.NewRootResolver(config.protoRoot)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	writer := NewWriter(protoconfservice.NewProtoconfServiceClient(conn), resolver, os.FileMode(fileMode), config.retryInterval, reload, config.reloadDelay)
+	if err := writer.Run(ctx, targets); err != nil && err != context.Canceled {
+		log.Printf("Error writing configs, err=%s", err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _ := newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return "Writes configs to files and reloads the process reading them"
+}
+
+// Command is a cli.CommandFactory
+func Command() (cli.Command, error) {
+	return &cliCommand{}, nil
+}
@@ -0,0 +1,331 @@
+// Package sidecar writes configs to local files, for the processes which only
+// read their configuration from files, and tells the processes to reload them
+// when they change
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// The formats of the files, chosen by their extension
+const (
+	FormatJSON = "json"
+	FormatText = "textproto"
+)
+
+var formats = map[string]string{
+	".json":      FormatJSON,
+	".textproto": FormatText,
+	".txtpb":     FormatText,
+	".pbtxt":     FormatText,
+}
+
+// DefaultRetryInterval is how long the writer waits by default to subscribe
+// to a config again after failing to write it
+const DefaultRetryInterval = 10 * time.Second
+
+// DefaultReloadDelay is how long the writer waits by default after a file
+// changes before reloading, so the files changing together are reloaded once
+const DefaultReloadDelay = time.Second
+
+// Target is a file a config is written to
+type Target struct {
+	Path   string
+	File   string
+	Format string
+}
+
+// ParseTarget parses a target given as config_path=file. The format of the
+// file is chosen by its extension: .json for JSON, .textproto, .txtpb or
+// .pbtxt for the text format.
+func ParseTarget(value string) (*Target, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid target %q, expected config_path=file", value)
+	}
+	format, ok := formats[strings.ToLower(filepath.Ext(parts[1]))]
+	if !ok {
+		return nil, fmt.Errorf("invalid target %q, the file should end with .json, .textproto, .txtpb or .pbtxt", value)
+	}
+	return &Target{Path: parts[0], File: filepath.Clean(parts[1]), Format: format}, nil
+}
+
+// Reloader tells the process reading the files to reload them
+type Reloader func(ctx context.Context) error
+
+// signals are the signals a SignalReloader takes by name, the others are
+// given by number
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+}
+
+// ParseSignal parses a signal given by name, e.g. HUP or SIGHUP, or by
+// number, e.g. 10 for SIGUSR1 on Linux
+func ParseSignal(value string) (syscall.Signal, error) {
+	if signal, ok := signals[strings.TrimPrefix(strings.ToUpper(value), "SIG")]; ok {
+		return signal, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid signal %q, expected HUP, INT, QUIT, TERM or the number of a signal", value)
+	}
+	return syscall.Signal(number), nil
+}
+
+// SignalReloader sends signal to the process whose pid pidFile holds. The
+// pid file is read again for every reload, as the process restarts.
+func SignalReloader(pidFile string, signal syscall.Signal) Reloader {
+	return func(ctx context.Context) error {
+		data, err := ioutil.ReadFile(pidFile)
+		if err != nil {
+			return err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return fmt.Errorf("invalid pid in %s, err=%s", pidFile, err)
+		}
+		process, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+		return process.Signal(signal)
+	}
+}
+
+// CommandReloader runs a command, e.g. nginx -s reload, failing when it
+// exits with an error
+func CommandReloader(command []string) Reloader {
+	return func(ctx context.Context) error {
+		output, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s failed, err=%s output=%q", strings.Join(command, " "), err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+}
+
+// Writer writes the configs an agent serves to files
+type Writer struct {
+	agent         protoconfservice.ProtoconfServiceClient
+	unmarshal     proto.UnmarshalOptions
+	json          protojson.MarshalOptions
+	text          prototext.MarshalOptions
+	fileMode      os.FileMode
+	retryInterval time.Duration
+	reload        Reloader
+	reloadDelay   time.Duration
+	changed       chan struct{}
+}
+
+// NewWriter returns a writer subscribing to the configs of agentClient and
+// writing them to files of fileMode, the types of the configs resolved with
+// resolver, protoregistry.GlobalTypes when nil. The configs failing to be
+// written are subscribed to again after retryInterval. When reload isn't nil
+// it's called reloadDelay after the files change.
+func NewWriter(agentClient protoconfservice.ProtoconfServiceClient, resolver agent.Resolver, fileMode os.FileMode, retryInterval time.Duration, reload Reloader, reloadDelay time.Duration) *Writer {
+	if resolver == nil {
+		resolver = protoregistry.GlobalTypes
+	}
+	return &Writer{
+		agent:         agentClient,
+		unmarshal:     proto.UnmarshalOptions{Resolver: resolver},
+		json:          protojson.MarshalOptions{Resolver: resolver, Multiline: true},
+		text:          prototext.MarshalOptions{Resolver: resolver, Multiline: true, Indent: "  "},
+		fileMode:      fileMode,
+		retryInterval: retryInterval,
+		reload:        reload,
+		reloadDelay:   reloadDelay,
+		changed:       make(chan struct{}, 1),
+	}
+}
+
+// Run writes every value of the configs of targets until ctx is done
+func (w *Writer) Run(ctx context.Context, targets []*Target) error {
+	files := make(map[string]bool)
+	for _, target := range targets {
+		if files[target.File] {
+			return fmt.Errorf("more than one config is written to %s", target.File)
+		}
+		files[target.File] = true
+	}
+
+	var wg sync.WaitGroup
+	if w.reload != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.reloadOnChange(ctx)
+		}()
+	}
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *Target) {
+			defer wg.Done()
+			w.write(ctx, target)
+		}(target)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// reloadOnChange reloads reloadDelay after the files change, the changes
+// made meanwhile reloaded together
+func (w *Writer) reloadOnChange(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.changed:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.reloadDelay):
+		}
+		// The changes made until now are reloaded
+		select {
+		case <-w.changed:
+		default:
+		}
+		if err := w.reload(ctx); err != nil {
+			log.Printf("Error reloading, err=%s", err)
+			continue
+		}
+		log.Printf("Reloaded")
+	}
+}
+
+// write subscribes to the config of target and writes every value of it,
+// subscribing again after retryInterval when it fails
+func (w *Writer) write(ctx context.Context, target *Target) {
+	for {
+		err := w.subscribe(ctx, target)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Error writing config, retrying in %s, path=%s file=%s err=%s", w.retryInterval, target.Path, target.File, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.retryInterval):
+		}
+	}
+}
+
+func (w *Writer) subscribe(ctx context.Context, target *Target) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := w.agent.SubscribeForConfig(ctx, &protoconfservice.ConfigSubscriptionRequest{Path: target.Path})
+	if err != nil {
+		return err
+	}
+	log.Printf("Writing path=%s file=%s", target.Path, target.File)
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		changed, err := w.Apply(target, update.GetValue())
+		if err != nil {
+			return err
+		}
+		w.acknowledge(ctx, target, update.GetVersion())
+		if changed {
+			select {
+			case w.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// acknowledge reports the version of the config of target written to the
+// agent, which lists it among the versions of its subscribers
+func (w *Writer) acknowledge(ctx context.Context, target *Target, version string) {
+	if version == "" {
+		// Sent by an agent which doesn't track its subscribers
+		return
+	}
+	if _, err := w.agent.Acknowledge(ctx, &protoconfservice.AcknowledgeRequest{Path: target.Path, Version: version}); err != nil && ctx.Err() == nil {
+		log.Printf("Error acknowledging config, path=%s version=%s err=%s", target.Path, version, err)
+	}
+}
+
+// Apply writes a value of the config of target to its file, atomically
+// replacing the file so its readers never see it partly written, and tells
+// whether the file changed
+func (w *Writer) Apply(target *Target, value *anypb.Any) (bool, error) {
+	message, err := anypb.UnmarshalNew(value, w.unmarshal)
+	if err != nil {
+		return false, fmt.Errorf("error decoding config, the type of the config may be unknown, err=%s", err)
+	}
+	var data []byte
+	switch target.Format {
+	case FormatText:
+		data, err = w.text.Marshal(message)
+	default:
+		data, err = w.json.Marshal(message)
+	}
+	if err != nil {
+		return false, fmt.Errorf("error marshaling config to %s, err=%s", target.Format, err)
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	if current, err := ioutil.ReadFile(target.File); err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+
+	dir := filepath.Dir(target.File)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	// The file is renamed from a file of the same dir, on the same file system
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(target.File)+".tmp")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), w.fileMode); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), target.File); err != nil {
+		return false, err
+	}
+	log.Printf("Wrote config, path=%s file=%s", target.Path, target.File)
+	return true, nil
+}
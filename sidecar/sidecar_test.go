@@ -0,0 +1,125 @@
+package sidecar
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/agent"
+	protoconfservice "github.com/protoconf/protoconf/agent/api/proto/v1"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget("crawler/text_crawler=/etc/crawler/config.json")
+	assert.NoError(t, err)
+	assert.Equal(t, &Target{Path: "crawler/text_crawler", File: "/etc/crawler/config.json", Format: FormatJSON}, target)
+	target, err = ParseTarget("crawler/text_crawler=config.pbtxt")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatText, target.Format)
+
+	for _, value := range []string{"crawler", "crawler=", "=config.json", "crawler=config.yaml"} {
+		_, err := ParseTarget(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	signal, err := ParseSignal("SIGHUP")
+	assert.NoError(t, err)
+	assert.Equal(t, syscall.SIGHUP, signal)
+	signal, err = ParseSignal("10")
+	assert.NoError(t, err)
+	assert.Equal(t, syscall.Signal(10), signal)
+	_, err = ParseSignal("RELOAD")
+	assert.Error(t, err)
+}
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sidecar")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("first")))
+	assert.NoError(t, store.SetConfig("services/limit", wrapperspb.Int32(10)))
+	watcher := libprotoconf.NewStoreWatcher(store, "")
+	defer watcher.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	rpcServer := grpc.NewServer()
+	protoconfservice.RegisterProtoconfServiceServer(rpcServer, agent.NewServer(watcher, 10))
+	go rpcServer.Serve(listener)
+	defer rpcServer.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	var reloads int32
+	reload := func(ctx context.Context) error {
+		atomic.AddInt32(&reloads, 1)
+		return nil
+	}
+	writer := NewWriter(protoconfservice.NewProtoconfServiceClient(conn), nil, 0600, 10*time.Millisecond, reload, 200*time.Millisecond)
+	var targets []*Target
+	for _, value := range []string{"services/api=" + filepath.Join(dir, "api.json"), "services/limit=" + filepath.Join(dir, "conf", "limit.textproto")} {
+		target, err := ParseTarget(value)
+		assert.NoError(t, err)
+		targets = append(targets, target)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- writer.Run(ctx, targets) }()
+	defer func() {
+		cancel()
+		assert.Equal(t, context.Canceled, <-done)
+	}()
+
+	waitFor := func(file string, value string) {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+			if data, err := ioutil.ReadFile(file); err == nil && strings.Contains(string(data), value) {
+				return
+			}
+		}
+		data, _ := ioutil.ReadFile(file)
+		t.Fatalf("%s wasn't written, data=%q", file, data)
+	}
+	waitFor(filepath.Join(dir, "api.json"), `"first"`)
+	// The text format varies its spaces
+	waitFor(filepath.Join(dir, "conf", "limit.textproto"), "10\n")
+	info, err := os.Stat(filepath.Join(dir, "api.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The files written together are reloaded once
+	waitForReloads := func(expected int32) {
+		for start := time.Now(); atomic.LoadInt32(&reloads) < expected && time.Since(start) < 5*time.Second; {
+			time.Sleep(5 * time.Millisecond)
+		}
+		time.Sleep(300 * time.Millisecond)
+		assert.Equal(t, expected, atomic.LoadInt32(&reloads))
+	}
+	waitForReloads(1)
+
+	assert.NoError(t, store.SetConfig("services/api", wrapperspb.String("second")))
+	waitFor(filepath.Join(dir, "api.json"), `"second"`)
+	waitForReloads(2)
+
+	// No temporary files are left behind
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// A single config is written to a file
+	assert.Error(t, writer.Run(context.Background(), []*Target{targets[0], targets[0]}))
+}
@@ -0,0 +1,168 @@
+package snapshot
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+type snapshotCommand struct{}
+
+func newSnapshotFlagSet() (*flag.FlagSet, *command.KVStoreConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... archive")
+		fmt.Fprintln(flags.Output(), "Writes the keys of the key-value store under -prefix to a gzipped tar archive, - for the standard output.")
+		flags.PrintDefaults()
+	}
+
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+
+	return flags, kVConfig
+}
+
+func (c *snapshotCommand) Run(args []string) int {
+	flags, kVConfig := newSnapshotFlagSet()
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+	path := flags.Arg(0)
+
+	store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	if err != nil {
+		log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	defer store.Close()
+
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			log.Printf("Error creating archive, err=%s", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	manifest, err := Snapshot(w, store, kVConfig.Store, kVConfig.Prefix)
+	if err != nil {
+		log.Printf("Error writing snapshot, err=%s", err)
+		if path != "-" {
+			os.Remove(path)
+		}
+		return 1
+	}
+	log.Printf("Wrote %d keys and %d versions of their history to %s", manifest.Keys, manifest.Versions, path)
+	return 0
+}
+
+func (c *snapshotCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _ := newSnapshotFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *snapshotCommand) Synopsis() string {
+	return "Writes the keys of the key-value store to an archive"
+}
+
+// Command is a cli.CommandFactory
+func Command() (cli.Command, error) {
+	return &snapshotCommand{}, nil
+}
+
+type restoreCommand struct{}
+
+type restoreConfig struct {
+	skipHistory bool
+	prune       bool
+}
+
+func newRestoreFlagSet() (*flag.FlagSet, *restoreConfig, *command.KVStoreConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... archive")
+		fmt.Fprintln(flags.Output(), "Writes the keys of an archive of protoconf snapshot to the key-value store under -prefix, - to read it from the standard input.")
+		flags.PrintDefaults()
+	}
+
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+
+	config := &restoreConfig{}
+	flags.BoolVar(&config.skipHistory, "skip-history", false, "Restore the current values of the keys only, without the versions of their history")
+	flags.BoolVar(&config.prune, "prune", false, "Delete the keys under -prefix which aren't in the archive")
+
+	return flags, config, kVConfig
+}
+
+func (c *restoreCommand) Run(args []string) int {
+	flags, config, kVConfig := newRestoreFlagSet()
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+	path := flags.Arg(0)
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Error opening archive, err=%s", err)
+			return 1
+		}
+		defer file.Close()
+		r = file
+	}
+
+	store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	if err != nil {
+		log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	defer store.Close()
+
+	manifest, err := Restore(r, kVConfig.WithHistory(store), kVConfig.Prefix, !config.skipHistory, config.prune)
+	if err != nil {
+		log.Printf("Error restoring snapshot, err=%s", err)
+		return 1
+	}
+	log.Printf("Restored %d keys of the snapshot of %s taken at %s", manifest.Keys, manifest.Store, manifest.CreatedAt.Format(time.RFC3339))
+	return 0
+}
+
+func (c *restoreCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _, _ := newRestoreFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *restoreCommand) Synopsis() string {
+	return "Writes the keys of an archive of protoconf snapshot to the key-value store"
+}
+
+// RestoreCommand is a cli.CommandFactory
+func RestoreCommand() (cli.Command, error) {
+	return &restoreCommand{}, nil
+}
@@ -0,0 +1,332 @@
+// Package snapshot dumps the keys of a key-value store to an archive and
+// restores them, for disaster recovery and to seed a store with the configs
+// of another one
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// The layout of the archives, a gzipped tar archive holding the manifest,
+// the value of every key and the versions of the keys kept in the history of
+// their store
+const (
+	// ManifestName is the name of the manifest of the archive, its first file
+	ManifestName = "manifest.json"
+	// KeysDir holds a file per key, named by the key after the prefix
+	KeysDir = "keys/"
+	// HistoryDir holds a file per version of a key, HistoryDir + key + "/" +
+	// version, the oldest first
+	HistoryDir = "history/"
+	// Format is the version of the layout of the archives
+	Format = 1
+)
+
+// The PAX records of the files of the keys and their versions
+const (
+	// versionRecord is the version of the key in its store, when the store
+	// has versions
+	versionRecord = "PROTOCONF.version"
+	// deletedRecord marks the versions of the history deleting their key
+	deletedRecord = "PROTOCONF.deleted"
+)
+
+// ErrInvalidArchive is returned restoring an archive which wasn't written by
+// Snapshot
+var ErrInvalidArchive = errors.New("not a snapshot of protoconf")
+
+// Manifest describes an archive
+type Manifest struct {
+	Format           int       `json:"format"`
+	ProtoconfVersion string    `json:"protoconf_version"`
+	CreatedAt        time.Time `json:"created_at"`
+	// Store is the type of the store the keys were read from, and Prefix the
+	// prefix of the keys, dropped from the keys of the archive
+	Store    string `json:"store"`
+	Prefix   string `json:"prefix"`
+	Keys     int    `json:"keys"`
+	Versions int    `json:"versions"`
+}
+
+// Snapshot writes the keys of store starting with prefix to w, the versions
+// of the keys kept in the history of the store along with them, and returns
+// the manifest of the archive. storeName is recorded to the manifest. The
+// keys are read one by one, so the keys written meanwhile may or may not be
+// in the archive.
+func Snapshot(w io.Writer, store libprotoconf.Store, storeName string, prefix string) (*Manifest, error) {
+	keys, err := store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{
+		Format:           Format,
+		ProtoconfVersion: consts.Version,
+		CreatedAt:        time.Now().UTC(),
+		Store:            storeName,
+		Prefix:           prefix,
+	}
+	// The keys are read before the archive is written, for the manifest to
+	// count them
+	type entry struct {
+		name     string
+		value    []byte
+		version  string
+		versions []*libprotoconf.ConfigVersion
+	}
+	var entries []*entry
+	versioned, isVersioned := store.(libprotoconf.VersionedStore)
+	history := true
+	for _, key := range keys {
+		e := &entry{name: strings.TrimPrefix(key, prefix)}
+		if isVersioned {
+			e.value, e.version, err = versioned.GetVersion(key)
+		} else {
+			e.value, err = store.Get(key)
+		}
+		if err == libprotoconf.ErrConfigNotFound {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s, err=%s", key, err)
+		}
+		if history {
+			e.versions, err = store.History(key)
+			if err == libprotoconf.ErrHistoryNotSupported {
+				history = false
+			} else if err != nil {
+				return nil, fmt.Errorf("error reading the history of %s, err=%s", key, err)
+			}
+		}
+		entries = append(entries, e)
+		manifest.Keys++
+		manifest.Versions += len(e.versions)
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(archive, ManifestName, data, manifest.CreatedAt, nil); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		records := make(map[string]string)
+		if e.version != "" {
+			records[versionRecord] = e.version
+		}
+		modTime := manifest.CreatedAt
+		if len(e.versions) > 0 {
+			modTime = e.versions[len(e.versions)-1].CreatedAt
+		}
+		if err := writeFile(archive, KeysDir+e.name, e.value, modTime, records); err != nil {
+			return nil, err
+		}
+		for _, version := range e.versions {
+			records := make(map[string]string)
+			if version.Value == nil {
+				records[deletedRecord] = "true"
+			}
+			if err := writeFile(archive, HistoryDir+e.name+"/"+strconv.FormatInt(version.Version, 10), version.Value, version.CreatedAt, records); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+func writeFile(archive *tar.Writer, name string, data []byte, modTime time.Time, records map[string]string) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+	}
+	if len(records) > 0 {
+		header.Format, header.PAXRecords = tar.FormatPAX, records
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := archive.Write(data)
+	return err
+}
+
+// contents are the keys of an archive, named by the key after the prefix
+type contents struct {
+	manifest  *Manifest
+	values    map[string][]byte
+	histories map[string][]*libprotoconf.ConfigVersion
+}
+
+// read reads a whole archive, so an invalid archive is found before anything
+// is restored
+func read(r io.Reader) (*contents, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w, err=%s", ErrInvalidArchive, err)
+	}
+	archive := tar.NewReader(gz)
+	c := &contents{values: make(map[string][]byte), histories: make(map[string][]*libprotoconf.ConfigVersion)}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w, err=%s", ErrInvalidArchive, err)
+		}
+		data, err := ioutil.ReadAll(archive)
+		if err != nil {
+			return nil, fmt.Errorf("%w, err=%s", ErrInvalidArchive, err)
+		}
+		switch {
+		case c.manifest == nil:
+			if header.Name != ManifestName {
+				return nil, fmt.Errorf("%w, the archive doesn't start with %s", ErrInvalidArchive, ManifestName)
+			}
+			c.manifest = &Manifest{}
+			if err := json.Unmarshal(data, c.manifest); err != nil {
+				return nil, fmt.Errorf("%w, err=%s", ErrInvalidArchive, err)
+			}
+			if c.manifest.Format != Format {
+				return nil, fmt.Errorf("unsupported format %d of the archive, expected %d, it may be written by a later version of protoconf", c.manifest.Format, Format)
+			}
+		case strings.HasPrefix(header.Name, KeysDir):
+			c.values[strings.TrimPrefix(header.Name, KeysDir)] = data
+		case strings.HasPrefix(header.Name, HistoryDir):
+			name := strings.TrimPrefix(header.Name, HistoryDir)
+			i := strings.LastIndex(name, "/")
+			version, err := strconv.ParseInt(name[i+1:], 10, 64)
+			if i < 0 || err != nil {
+				return nil, fmt.Errorf("%w, invalid version %s", ErrInvalidArchive, header.Name)
+			}
+			if header.PAXRecords[deletedRecord] == "true" {
+				data = nil
+			}
+			c.histories[name[:i]] = append(c.histories[name[:i]], &libprotoconf.ConfigVersion{Version: version, Value: data, CreatedAt: header.ModTime})
+		}
+	}
+	if c.manifest == nil {
+		return nil, fmt.Errorf("%w, the archive is empty", ErrInvalidArchive)
+	}
+	for _, versions := range c.histories {
+		sort.SliceStable(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+	return c, nil
+}
+
+// Restore writes the keys of the archive read from r to store, after prefix,
+// and returns the manifest of the archive. With history, the versions of the
+// keys in the archive are written first, the oldest first, to the stores
+// keeping a history of their own, and the stores number them again. With
+// prune, the keys starting with prefix which aren't in the archive are
+// deleted, so the store holds the keys of the archive only. The current
+// values are written in one transaction to the stores writing several keys
+// at once.
+func Restore(r io.Reader, store libprotoconf.Store, prefix string, history bool, prune bool) (*Manifest, error) {
+	c, err := read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(c.values))
+	for name := range c.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	replayed := make(map[string]bool)
+	if history && len(c.histories) > 0 && len(names) > 0 {
+		if replayed, err = replay(store, prefix, names, c); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make(map[string][]byte, len(c.values))
+	for name, value := range c.values {
+		if !replayed[name] {
+			values[prefix+name] = value
+		}
+	}
+	if prune {
+		keys, err := store.List(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if _, ok := c.values[strings.TrimPrefix(key, prefix)]; !ok {
+				values[key] = nil
+			}
+		}
+	}
+	if batch, ok := store.(libprotoconf.BatchStore); ok {
+		return c.manifest, batch.SetAll(values)
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if values[key] == nil {
+			err = store.Delete(key)
+		} else {
+			err = store.Set(key, values[key])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error restoring %s, err=%s", key, err)
+		}
+	}
+	return c.manifest, nil
+}
+
+// replay writes the versions of the history of the keys of names to store,
+// and returns the names of the keys whose last version is their current
+// value, written already. The stores without a history of their own are left
+// as they are.
+func replay(store libprotoconf.Store, prefix string, names []string, c *contents) (map[string]bool, error) {
+	replayed := make(map[string]bool)
+	if _, err := store.History(prefix + names[0]); err == libprotoconf.ErrHistoryNotSupported {
+		log.Printf("The store keeps no history of the configs, restoring their current values only")
+		return replayed, nil
+	}
+	for _, name := range names {
+		versions := c.histories[name]
+		for _, version := range versions {
+			var err error
+			if version.Value == nil {
+				err = store.Delete(prefix + name)
+			} else {
+				err = store.Set(prefix+name, version.Value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error restoring the history of %s, err=%s", prefix+name, err)
+			}
+		}
+		if len(versions) > 0 && bytes.Equal(versions[len(versions)-1].Value, c.values[name]) {
+			replayed[name] = true
+		}
+	}
+	return replayed, nil
+}
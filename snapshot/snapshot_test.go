@@ -0,0 +1,105 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+)
+
+type noHistory struct {
+	*libprotoconf.MemoryStore
+}
+
+func (s noHistory) History(string) ([]*libprotoconf.ConfigVersion, error) {
+	return nil, libprotoconf.ErrHistoryNotSupported
+}
+
+func TestSnapshot(t *testing.T) {
+	source := libprotoconf.NewMemoryStore()
+	assert.NoError(t, source.Set("protoconf/services/api", []byte("v1")))
+	assert.NoError(t, source.Set("protoconf/services/api", []byte("v2")))
+	assert.NoError(t, source.Set("protoconf/services/web", []byte("w1")))
+	assert.NoError(t, source.Delete("protoconf/services/web"))
+	assert.NoError(t, source.Set("protoconf/services/web", []byte("w2")))
+	assert.NoError(t, source.Set("protoconf/services/empty", []byte{}))
+	assert.NoError(t, source.Set("other/services/api", []byte("other")))
+
+	var archive bytes.Buffer
+	manifest, err := Snapshot(&archive, source, "memory", "protoconf/")
+	assert.NoError(t, err)
+	assert.Equal(t, Format, manifest.Format)
+	assert.Equal(t, "memory", manifest.Store)
+	assert.Equal(t, 3, manifest.Keys)
+	assert.Equal(t, 6, manifest.Versions)
+
+	// The keys are restored after another prefix along with their history
+	target := libprotoconf.NewMemoryStore()
+	assert.NoError(t, target.Set("staging/services/old", []byte("old")))
+	restored, err := Restore(bytes.NewReader(archive.Bytes()), target, "staging/", true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.CreatedAt.Unix(), restored.CreatedAt.Unix())
+	for key, value := range map[string]string{"services/api": "v2", "services/web": "w2", "services/empty": "", "services/old": "old"} {
+		got, err := target.Get("staging/" + key)
+		assert.NoError(t, err, key)
+		assert.Equal(t, value, string(got), key)
+	}
+	versions, err := target.History("staging/services/web")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.Nil(t, versions[1].Value, "the deletion is restored")
+	versions, err = target.History("staging/services/api")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2, "the current value is written once")
+
+	// Pruning deletes the keys which aren't in the archive
+	_, err = Restore(bytes.NewReader(archive.Bytes()), target, "staging/", false, true)
+	assert.NoError(t, err)
+	_, err = target.Get("staging/services/old")
+	assert.Equal(t, libprotoconf.ErrConfigNotFound, err)
+	value, err := target.Get("staging/services/api")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(value))
+
+	// The stores without history get the current values
+	withoutHistory := noHistory{libprotoconf.NewMemoryStore()}
+	_, err = Restore(bytes.NewReader(archive.Bytes()), withoutHistory, "", true, false)
+	assert.NoError(t, err)
+	value, err = withoutHistory.Get("services/web")
+	assert.NoError(t, err)
+	assert.Equal(t, "w2", string(value))
+	keys, err := withoutHistory.List("")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+
+	// Nor are the versions of their history written to the archive
+	archive.Reset()
+	manifest, err = Snapshot(&archive, withoutHistory, "memory", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, manifest.Keys)
+	assert.Equal(t, 0, manifest.Versions)
+}
+
+func TestRestoreInvalidArchive(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	_, err := Restore(bytes.NewReader([]byte("not an archive")), store, "", true, false)
+	assert.True(t, errors.Is(err, ErrInvalidArchive))
+
+	// An archive without a manifest writes nothing
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	w := tar.NewWriter(gz)
+	assert.NoError(t, writeFile(w, KeysDir+"services/api", []byte("v1"), time.Now(), nil))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, gz.Close())
+	_, err = Restore(&archive, store, "", true, false)
+	assert.True(t, errors.Is(err, ErrInvalidArchive))
+	keys, err := store.List("")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,148 @@
+package stubs
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/consts"
+	"github.com/protoconf/protoconf/utils"
+)
+
+type cliCommand struct{}
+
+type stringsArray []string
+
+func (i *stringsArray) String() string {
+	return fmt.Sprintf("%v", []string(*i))
+}
+
+func (i *stringsArray) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
+
+type cliConfig struct {
+	outputDir  string
+	format     string
+	protoPaths stringsArray
+}
+
+func newFlagSet() (*flag.FlagSet, *cliConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: [OPTION]... protoconf_root [proto]...")
+		flags.PrintDefaults()
+	}
+
+	config := &cliConfig{}
+	flags.StringVar(&config.outputDir, "out", "", "Directory to write the stubs to (default protoconf_root/"+consts.StubsPath+")")
+	flags.StringVar(&config.format, "format", "pyi", "Stubs format, `pyi' (Python type stubs) or `json'")
+	flags.Var(&config.protoPaths, "proto-path", "An additional directory to import protos from (can repeat)")
+
+	return flags, config
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config := newFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || (config.format != "pyi" && config.format != "json") {
+		flags.Usage()
+		return 1
+	}
+
+	protoconfRoot := strings.TrimSpace(flags.Args()[0])
+	outputDir := config.outputDir
+	if outputDir == "" {
+		outputDir = filepath.Join(protoconfRoot, consts.StubsPath)
+	}
+
+	importPaths, err := utils.ProtoImportPaths(protoconfRoot)
+	if err != nil {
+		log.Printf("Error resolving proto import paths, err=%s", err)
+	}
+	importPaths = append(importPaths, config.protoPaths...)
+
+	protoFiles := flags.Args()[1:]
+	if len(protoFiles) == 0 {
+		protoFiles, err = getAllProtos(filepath.Join(protoconfRoot, consts.SrcPath))
+		if err != nil {
+			log.Printf("Error getting all protos from %s, err=%s", protoconfRoot, err)
+			return 1
+		}
+	}
+
+	parser := &utils.ProtoParser{ImportPaths: importPaths, SourceInfo: true}
+	descriptors, err := parser.Parse(protoFiles...)
+	if err != nil {
+		log.Printf("Error parsing protos, err=%s", err)
+		return 1
+	}
+
+	for _, descriptor := range descriptors {
+		file := NewFile(descriptor)
+		data := file.Pyi()
+		if config.format == "json" {
+			if data, err = file.JSON(); err != nil {
+				log.Printf("Error generating stubs for %s, err=%s", file.Path, err)
+				return 1
+			}
+		}
+
+		outputFile := filepath.Join(outputDir, filepath.FromSlash(file.Path)+"."+config.format)
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			log.Printf("Error creating output directory %s, err=%s", filepath.Dir(outputFile), err)
+			return 1
+		}
+		if err := ioutil.WriteFile(outputFile, data, 0644); err != nil {
+			log.Printf("Error writing to file %s, err=%s", outputFile, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _ := newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return "Generate Starlark type stubs from protos"
+}
+
+// Command is a cli.CommandFactory
+func Command() (cli.Command, error) {
+	return &cliCommand{}, nil
+}
+
+func getAllProtos(srcDir string) ([]string, error) {
+	var protos []string
+	err := filepath.Walk(srcDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(path) == consts.ProtoExtension {
+			relPath, err := filepath.Rel(srcDir, path)
+			if err != nil {
+				return err
+			}
+			protos = append(protos, filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+	return protos, err
+}
@@ -0,0 +1,320 @@
+package stubs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// File describes the constructors, fields and enums a proto file exports to
+// Starlark
+type File struct {
+	Path       string     `json:"path"`
+	Package    string     `json:"package,omitempty"`
+	Messages   []*Message `json:"messages,omitempty"`
+	Enums      []*Enum    `json:"enums,omitempty"`
+	Extensions []*Field   `json:"extensions,omitempty"`
+}
+
+// Message describes a message type, called with its fields as keyword
+// arguments to construct a message
+type Message struct {
+	Name       string     `json:"name"`
+	FullName   string     `json:"fullName"`
+	Doc        string     `json:"doc,omitempty"`
+	Fields     []*Field   `json:"fields,omitempty"`
+	Messages   []*Message `json:"messages,omitempty"`
+	Enums      []*Enum    `json:"enums,omitempty"`
+	Extensions []*Field   `json:"extensions,omitempty"`
+}
+
+// Field describes a message field or an extension
+type Field struct {
+	Name     string `json:"name"`
+	FullName string `json:"fullName"`
+	Doc      string `json:"doc,omitempty"`
+	Number   int32  `json:"number"`
+	// ProtoType is the type as written in the proto file, e.g. `map<string, int32>'
+	ProtoType string `json:"protoType"`
+	// StarlarkType is the type of the Starlark values of the field, e.g. `dict[str, int]'
+	StarlarkType string `json:"starlarkType"`
+	Oneof        string `json:"oneof,omitempty"`
+	Extendee     string `json:"extendee,omitempty"`
+	Deprecated   bool   `json:"deprecated,omitempty"`
+}
+
+// Enum describes an enum type, its values are attributes of the type
+type Enum struct {
+	Name     string       `json:"name"`
+	FullName string       `json:"fullName"`
+	Doc      string       `json:"doc,omitempty"`
+	Values   []*EnumValue `json:"values"`
+}
+
+// EnumValue describes a value of an enum
+type EnumValue struct {
+	Name   string `json:"name"`
+	Number int32  `json:"number"`
+	Doc    string `json:"doc,omitempty"`
+}
+
+// NewFile describes a proto file. Docs are taken from the comments of the
+// file, if it was parsed with its source info.
+func NewFile(file protoreflect.FileDescriptor) *File {
+	s := &describer{file: file}
+	return &File{
+		Path:       file.Path(),
+		Package:    string(file.Package()),
+		Messages:   s.messages(file.Messages()),
+		Enums:      s.enums(file.Enums()),
+		Extensions: s.fields(file.Extensions()),
+	}
+}
+
+type describer struct {
+	file protoreflect.FileDescriptor
+}
+
+func (s *describer) doc(desc protoreflect.Descriptor) string {
+	return strings.TrimSpace(s.file.SourceLocations().ByDescriptor(desc).LeadingComments)
+}
+
+func (s *describer) messages(messages protoreflect.MessageDescriptors) []*Message {
+	var out []*Message
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		if message.IsMapEntry() {
+			continue
+		}
+		out = append(out, &Message{
+			Name:       string(message.Name()),
+			FullName:   string(message.FullName()),
+			Doc:        s.doc(message),
+			Fields:     s.fields(message.Fields()),
+			Messages:   s.messages(message.Messages()),
+			Enums:      s.enums(message.Enums()),
+			Extensions: s.fields(message.Extensions()),
+		})
+	}
+	return out
+}
+
+func (s *describer) enums(enums protoreflect.EnumDescriptors) []*Enum {
+	var out []*Enum
+	for i := 0; i < enums.Len(); i++ {
+		enum := enums.Get(i)
+		var values []*EnumValue
+		for j := 0; j < enum.Values().Len(); j++ {
+			value := enum.Values().Get(j)
+			values = append(values, &EnumValue{
+				Name:   string(value.Name()),
+				Number: int32(value.Number()),
+				Doc:    s.doc(value),
+			})
+		}
+		out = append(out, &Enum{
+			Name:     string(enum.Name()),
+			FullName: string(enum.FullName()),
+			Doc:      s.doc(enum),
+			Values:   values,
+		})
+	}
+	return out
+}
+
+// fieldList is implemented by both protoreflect.FieldDescriptors and
+// protoreflect.ExtensionDescriptors
+type fieldList interface {
+	Len() int
+	Get(i int) protoreflect.FieldDescriptor
+}
+
+func (s *describer) fields(fields fieldList) []*Field {
+	var out []*Field
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		f := &Field{
+			Name:         string(field.Name()),
+			FullName:     string(field.FullName()),
+			Doc:          s.doc(field),
+			Number:       int32(field.Number()),
+			ProtoType:    protoType(field),
+			StarlarkType: s.starlarkType(field),
+		}
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			f.Oneof = string(oneof.Name())
+		}
+		if field.IsExtension() {
+			f.Extendee = string(field.ContainingMessage().FullName())
+		}
+		if options, ok := field.Options().(interface{ GetDeprecated() bool }); ok {
+			f.Deprecated = options.GetDeprecated()
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func protoType(field protoreflect.FieldDescriptor) string {
+	if field.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", protoType(field.MapKey()), protoType(field.MapValue()))
+	}
+	typ := field.Kind().String()
+	if field.Message() != nil {
+		typ = string(field.Message().FullName())
+	} else if field.Enum() != nil {
+		typ = string(field.Enum().FullName())
+	}
+	if field.IsList() {
+		return "repeated " + typ
+	}
+	return typ
+}
+
+func (s *describer) starlarkType(field protoreflect.FieldDescriptor) string {
+	if field.IsMap() {
+		return fmt.Sprintf("dict[%s, %s]", s.starlarkType(field.MapKey()), s.starlarkType(field.MapValue()))
+	}
+	var typ string
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		typ = "bool"
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		typ = "str"
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		typ = "float"
+	case protoreflect.EnumKind:
+		typ = s.typeRef(field.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		typ = s.typeRef(field.Message())
+	default:
+		typ = "int"
+	}
+	if field.IsList() {
+		return "list[" + typ + "]"
+	}
+	return typ
+}
+
+// typeRef names a message or enum type relative to the file's classes, types
+// from other files are referred to by their full name
+func (s *describer) typeRef(desc protoreflect.Descriptor) string {
+	name := string(desc.FullName())
+	if desc.ParentFile().Path() != s.file.Path() {
+		return name
+	}
+	if pkg := string(s.file.Package()); pkg != "" {
+		name = strings.TrimPrefix(name, pkg+".")
+	}
+	return name
+}
+
+// JSON renders the description of the file as JSON
+func (f *File) JSON() ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(f); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Pyi renders the description of the file as a Python type stub, which Python
+// language servers use to complete the fields of messages in Starlark files
+func (f *File) Pyi() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Code generated by protoconf stubs from %s. DO NOT EDIT.\n\n", f.Path)
+	b.WriteString("from __future__ import annotations\n")
+	if len(f.Extensions) > 0 || hasExtensions(f.Messages) {
+		b.WriteString("\nclass Extension: ...\n")
+	}
+	w := &pyiWriter{b: &b}
+	for _, enum := range f.Enums {
+		w.enum(enum, "")
+	}
+	for _, message := range f.Messages {
+		w.message(message, "")
+	}
+	for _, ext := range f.Extensions {
+		w.extension(ext, "")
+	}
+	return b.Bytes()
+}
+
+func hasExtensions(messages []*Message) bool {
+	for _, message := range messages {
+		if len(message.Extensions) > 0 || hasExtensions(message.Messages) {
+			return true
+		}
+	}
+	return false
+}
+
+type pyiWriter struct {
+	b *bytes.Buffer
+}
+
+func (w *pyiWriter) doc(doc string, indent string) {
+	if doc == "" {
+		return
+	}
+	doc = strings.ReplaceAll(doc, `"""`, `\"\"\"`)
+	doc = strings.ReplaceAll(doc, "\n", "\n"+indent)
+	fmt.Fprintf(w.b, "%s\"\"\"%s\"\"\"\n", indent, doc)
+}
+
+func (w *pyiWriter) enum(enum *Enum, indent string) {
+	fmt.Fprintf(w.b, "\n%sclass %s:\n", indent, enum.Name)
+	w.doc(enum.Doc, indent+"    ")
+	for _, value := range enum.Values {
+		fmt.Fprintf(w.b, "%s    %s: %s\n", indent, value.Name, enum.Name)
+		w.doc(value.Doc, indent+"    ")
+	}
+}
+
+func (w *pyiWriter) message(message *Message, indent string) {
+	inner := indent + "    "
+	fmt.Fprintf(w.b, "\n%sclass %s:\n", indent, message.Name)
+	w.doc(message.Doc, inner)
+	for _, enum := range message.Enums {
+		w.enum(enum, inner)
+	}
+	for _, nested := range message.Messages {
+		w.message(nested, inner)
+	}
+	for _, ext := range message.Extensions {
+		w.extension(ext, inner)
+	}
+	if len(message.Fields) > 0 && (len(message.Enums) > 0 || len(message.Messages) > 0 || len(message.Extensions) > 0) {
+		w.b.WriteString("\n")
+	}
+	var params []string
+	for _, field := range message.Fields {
+		fmt.Fprintf(w.b, "%s%s: %s\n", inner, field.Name, field.StarlarkType)
+		doc := field.Doc
+		if field.Deprecated {
+			doc = strings.TrimSpace("Deprecated. " + doc)
+		}
+		w.doc(doc, inner)
+		params = append(params, fmt.Sprintf("%s: %s = ...", field.Name, field.StarlarkType))
+	}
+	if len(params) == 0 {
+		fmt.Fprintf(w.b, "\n%sdef __init__(self) -> None: ...\n", inner)
+		return
+	}
+	fmt.Fprintf(w.b, "\n%sdef __init__(self, *, %s) -> None: ...\n", inner, strings.Join(params, ", "))
+}
+
+func (w *pyiWriter) extension(ext *Field, indent string) {
+	fmt.Fprintf(w.b, "\n%s%s: Extension\n", indent, ext.Name)
+	doc := fmt.Sprintf("Extends %s with `%s %s = %d`.", ext.Extendee, ext.ProtoType, ext.Name, ext.Number)
+	if ext.Doc != "" {
+		doc = ext.Doc + "\n\n" + doc
+	}
+	w.doc(doc, indent)
+}
@@ -0,0 +1,90 @@
+package stubs
+
+import (
+	"testing"
+
+	"github.com/protoconf/protoconf/testutil"
+	"github.com/protoconf/protoconf/utils"
+	assert "github.com/stretchr/testify/require"
+)
+
+var protos = map[string]string{
+	"fleet/service.proto": `syntax = "proto2";
+
+package fleet;
+
+import "google/protobuf/duration.proto";
+
+// A service in the fleet
+message Service {
+    enum Tier {
+        // Best effort
+        BRONZE = 0;
+        GOLD = 1;
+    }
+
+    // The name of the service
+    optional string name = 1;
+    optional int32 port = 2 [deprecated = true];
+    repeated Tier tiers = 3;
+    map<string, Endpoint> endpoints = 4;
+    optional google.protobuf.Duration timeout = 5;
+
+    message Endpoint {
+        optional string host = 1;
+    }
+
+    extensions 100 to 199;
+}
+
+extend Service {
+    optional int32 priority = 100;
+}
+`,
+}
+
+func TestStubs(t *testing.T) {
+	parser := &utils.ProtoParser{Accessor: testutil.ProtoAccessor(protos), SourceInfo: true}
+	descriptors, err := parser.Parse("fleet/service.proto")
+	assert.NoError(t, err)
+
+	file := NewFile(descriptors[0])
+	assert.Equal(t, `# Code generated by protoconf stubs from fleet/service.proto. DO NOT EDIT.
+
+from __future__ import annotations
+
+class Extension: ...
+
+class Service:
+    """A service in the fleet"""
+
+    class Tier:
+        BRONZE: Tier
+        """Best effort"""
+        GOLD: Tier
+
+    class Endpoint:
+        host: str
+
+        def __init__(self, *, host: str = ...) -> None: ...
+
+    name: str
+    """The name of the service"""
+    port: int
+    """Deprecated."""
+    tiers: list[Service.Tier]
+    endpoints: dict[str, Service.Endpoint]
+    timeout: google.protobuf.Duration
+
+    def __init__(self, *, name: str = ..., port: int = ..., tiers: list[Service.Tier] = ..., endpoints: dict[str, Service.Endpoint] = ..., timeout: google.protobuf.Duration = ...) -> None: ...
+
+priority: Extension
+"""Extends fleet.Service with `+"`int32 priority = 100`"+`."""
+`, string(file.Pyi()))
+
+	data, err := file.JSON()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"protoType": "map<string, fleet.Service.Endpoint>"`)
+	assert.Contains(t, string(data), `"extendee": "fleet.Service"`)
+	assert.Contains(t, string(data), `"deprecated": true`)
+}
@@ -0,0 +1,144 @@
+package targeting
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/protoconf/protoconf/command"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// The actions of the targeting commands
+const (
+	actionRemove = "remove"
+	actionList   = "list"
+)
+
+var synopses = map[string]string{
+	actionRemove: "Removes the targeting rule of a config matching labels, serving the config to those clients again",
+	actionList:   "Prints the targeting rules of the configs, set with protoconf insert -target",
+}
+
+type cliCommand struct {
+	action string
+}
+
+type cliConfig struct {
+	labels string
+}
+
+func (c *cliCommand) newFlagSet() (*flag.FlagSet, *cliConfig, *command.KVStoreConfig) {
+	flags := flag.NewFlagSet("", flag.ExitOnError)
+	flags.Usage = func() {
+		if c.action == actionList {
+			fmt.Fprintln(flags.Output(), "Usage: [OPTION]... [config_path]")
+		} else {
+			fmt.Fprintln(flags.Output(), "Usage: [OPTION]... config_path")
+		}
+		flags.PrintDefaults()
+	}
+
+	kVConfig := &command.KVStoreConfig{}
+	command.AddKVStoreFlags(flags, kVConfig)
+
+	config := &cliConfig{}
+	if c.action == actionRemove {
+		flags.StringVar(&config.labels, "labels", "", "The labels of the rule removed, as they were set with protoconf insert -target")
+	}
+
+	return flags, config, kVConfig
+}
+
+func (c *cliCommand) Run(args []string) int {
+	flags, config, kVConfig := c.newFlagSet()
+	flags.Parse(args)
+
+	if flags.NArg() > 1 || (c.action == actionRemove && flags.NArg() != 1) {
+		flags.Usage()
+		return 1
+	}
+	path := ""
+	if flags.NArg() == 1 {
+		path = filepath.ToSlash(strings.TrimSpace(flags.Arg(0)))
+	}
+
+	store, err := libprotoconf.OpenStore(kVConfig.Store, kVConfig.Address)
+	if err != nil {
+		log.Printf("Error connecting to %s, err=%s", kVConfig.Store, err)
+		return 1
+	}
+	defer store.Close()
+	manager := NewManager(store, kVConfig.Prefix)
+
+	if c.action == actionRemove {
+		labels, err := ParseLabels(config.labels)
+		if err != nil {
+			log.Printf("Error, -labels %s", err)
+			return 1
+		}
+		if err := manager.Remove(path, labels); err != nil {
+			log.Printf("Error removing the targeting rule of %s, err=%s", path, err)
+			return 1
+		}
+		return 0
+	}
+
+	var targetings []*Targeting
+	if path == "" {
+		targetings, err = manager.List()
+	} else {
+		var t *Targeting
+		t, err = manager.Get(path)
+		targetings = []*Targeting{t}
+	}
+	if err != nil {
+		log.Printf("Error reading targeting rules, err=%s", err)
+		return 1
+	}
+	for _, t := range targetings {
+		printTargeting(os.Stdout, t)
+	}
+	return 0
+}
+
+// printTargeting prints the rules of a config, a line per rule in the order
+// they are evaluated
+func printTargeting(w io.Writer, t *Targeting) {
+	for _, rule := range t.Rules {
+		fmt.Fprintf(w, "%s %s set by %s at %s\n", t.Path, rule.Labels, rule.Identity, rule.Created.UTC().Format(time.RFC3339))
+	}
+}
+
+func (c *cliCommand) Help() string {
+	var b bytes.Buffer
+	b.WriteString(c.Synopsis())
+	b.WriteString("\n")
+	flags, _, _ := c.newFlagSet()
+	flags.SetOutput(&b)
+	flags.Usage()
+	return b.String()
+}
+
+func (c *cliCommand) Synopsis() string {
+	return synopses[c.action]
+}
+
+func factory(action string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &cliCommand{action: action}, nil
+	}
+}
+
+// The cli.CommandFactory of the targeting commands
+var (
+	RemoveCommand = factory(actionRemove)
+	ListCommand   = factory(actionList)
+)
@@ -0,0 +1,241 @@
+// Package targeting serves other values of configs to the clients matching
+// targeting rules, such as canary hosts or the clients of a region, by the
+// labels the clients describe themselves with. The rules are attached to the
+// configs and evaluated by the agents and the servers serving them, so the
+// clients keep subscribing to one path per config.
+package targeting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// Prefix starts the keys of the targeting rules in the key-value store,
+// following the prefix of the configs: prefix + Prefix + the path of the
+// config
+const Prefix = ".targeting/"
+
+// PollInterval is how often the watchers read the targeting rules
+const PollInterval = 5 * time.Second
+
+// ErrNoTargeting is returned for the configs without targeting rules
+var ErrNoTargeting = errors.New("the config has no targeting rules")
+
+// Labels are the labels a rule matches, by name. The values are patterns of
+// the values of the labels of the clients, as path.Match matches them, e.g.
+// 2.* for every version 2.
+type Labels map[string]string
+
+// ParseLabels parses labels as name=value separated by commas, e.g.
+// cluster=eu-west,version=2.*
+func ParseLabels(s string) (Labels, error) {
+	labels := make(Labels)
+	for _, part := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid label %s, expected name=value", part)
+		}
+		if _, ok := labels[parts[0]]; ok {
+			return nil, fmt.Errorf("label %s is set twice", parts[0])
+		}
+		if _, err := path.Match(parts[1], ""); err != nil {
+			return nil, fmt.Errorf("invalid label %s, err=%s", part, err)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
+
+func (l Labels) String() string {
+	var parts []string
+	for name, value := range l {
+		parts = append(parts, name+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// Match tells whether the labels of a client match, every label of l is set
+// on the client to a value it matches
+func (l Labels) Match(labels map[string]string) bool {
+	return libprotoconf.Client{Labels: labels}.Matches(l)
+}
+
+// Rule serves a value of a config to the clients matching its labels
+type Rule struct {
+	Labels Labels `json:"labels"`
+	// Value is the value served, encoded as the configs are in the store
+	Value []byte `json:"value"`
+	// Identity is who set the rule
+	Identity string    `json:"identity"`
+	Created  time.Time `json:"created"`
+}
+
+// Targeting is the targeting rules of a config
+type Targeting struct {
+	Path string `json:"path"`
+	// Rules are evaluated in order, the rules matching more labels first and
+	// the rules matching as many labels in the order they were set
+	Rules []*Rule `json:"rules"`
+
+	// version is the version of the targeting in the store
+	version string
+}
+
+// Target is the rule serving a client its value, the first rule matching its
+// labels, nil when no rule matches and the client is served the config
+func (t *Targeting) Target(labels map[string]string) *Rule {
+	for _, rule := range t.Rules {
+		if rule.Labels.Match(labels) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Manager manages the targeting rules of the configs of a key-value store
+type Manager struct {
+	store  libprotoconf.Store
+	prefix string
+}
+
+// NewManager manages the targeting rules of the configs written to store
+// under prefix
+func NewManager(store libprotoconf.Store, prefix string) *Manager {
+	return &Manager{store: store, prefix: prefix}
+}
+
+func (m *Manager) key(path string) string {
+	return m.prefix + Prefix + path
+}
+
+// Get reads the targeting rules of a config, ErrNoTargeting when it has none
+func (m *Manager) Get(path string) (*Targeting, error) {
+	var data []byte
+	var version string
+	var err error
+	if versioned, ok := m.store.(libprotoconf.VersionedStore); ok {
+		data, version, err = versioned.GetVersion(m.key(path))
+	} else {
+		data, err = m.store.Get(m.key(path))
+	}
+	if err == libprotoconf.ErrConfigNotFound {
+		return nil, ErrNoTargeting
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &Targeting{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("error reading targeting rules, path=%s err=%s", path, err)
+	}
+	t.version = version
+	return t, nil
+}
+
+// List reads the targeting rules of the configs, in the order of their paths
+func (m *Manager) List() ([]*Targeting, error) {
+	keys, err := m.store.List(m.prefix + Prefix)
+	if err != nil {
+		return nil, err
+	}
+	var targetings []*Targeting
+	for _, key := range keys {
+		t, err := m.Get(strings.TrimPrefix(key, m.prefix+Prefix))
+		if err == ErrNoTargeting {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		targetings = append(targetings, t)
+	}
+	return targetings, nil
+}
+
+// Set serves value to the clients of a config matching labels, replacing the
+// value of the rule with the same labels. Only existing configs are
+// targeted.
+func (m *Manager) Set(path string, labels Labels, value []byte, identity string, now time.Time) (*Targeting, error) {
+	if len(labels) == 0 {
+		return nil, errors.New("a targeting rule matches at least one label")
+	}
+	if _, err := libprotoconf.DecodeConfig(value); err != nil {
+		return nil, fmt.Errorf("error decoding the value targeted, path=%s err=%s", path, err)
+	}
+	if _, err := m.store.Get(m.prefix + path); err != nil {
+		return nil, fmt.Errorf("error reading config, path=%s err=%s", path, err)
+	}
+	t, err := m.Get(path)
+	if err == ErrNoTargeting {
+		t, err = &Targeting{Path: path}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &Rule{Labels: labels, Value: value, Identity: identity, Created: now}
+	replaced := false
+	for i, existing := range t.Rules {
+		if existing.Labels.String() == labels.String() {
+			t.Rules[i], replaced = rule, true
+		}
+	}
+	if !replaced {
+		t.Rules = append(t.Rules, rule)
+	}
+	sort.SliceStable(t.Rules, func(i, j int) bool { return len(t.Rules[i].Labels) > len(t.Rules[j].Labels) })
+	return t, m.write(t)
+}
+
+// Remove removes the rule of a config matching labels, and the targeting of
+// the config along with its last rule
+func (m *Manager) Remove(path string, labels Labels) error {
+	t, err := m.Get(path)
+	if err != nil {
+		return err
+	}
+	var rules []*Rule
+	for _, rule := range t.Rules {
+		if rule.Labels.String() != labels.String() {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == len(t.Rules) {
+		return fmt.Errorf("config %s has no targeting rule matching %s", path, labels)
+	}
+	if len(rules) == 0 {
+		return m.store.Delete(m.key(path))
+	}
+	t.Rules = rules
+	return m.write(t)
+}
+
+// write writes the targeting of a config, on the condition that it wasn't
+// changed since it was read in the stores with versions
+func (m *Manager) write(t *Targeting) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	versioned, ok := m.store.(libprotoconf.VersionedStore)
+	if !ok {
+		return m.store.Set(m.key(t.Path), data)
+	}
+	version, err := versioned.SetIfVersion(m.key(t.Path), data, t.version)
+	if err == libprotoconf.ErrVersionMismatch {
+		return fmt.Errorf("the targeting rules of %s were changed meanwhile, try again", t.Path)
+	}
+	if err != nil {
+		return err
+	}
+	t.version = version
+	return nil
+}
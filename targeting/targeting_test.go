@@ -0,0 +1,121 @@
+package targeting
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	"github.com/protoconf/protoconf/libprotoconf/storetest"
+	"github.com/protoconf/protoconf/rollout"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestLabels(t *testing.T) {
+	labels, err := ParseLabels("version=2.*, cluster=eu-west")
+	assert.NoError(t, err)
+	assert.Equal(t, Labels{"cluster": "eu-west", "version": "2.*"}, labels)
+	assert.Equal(t, "cluster=eu-west,version=2.*", labels.String())
+
+	assert.True(t, labels.Match(map[string]string{"cluster": "eu-west", "version": "2.1", "host": "web-1"}))
+	assert.False(t, labels.Match(map[string]string{"cluster": "eu-west", "version": "3.0"}))
+	assert.False(t, labels.Match(map[string]string{"version": "2.1"}))
+
+	for _, invalid := range []string{"", "cluster", "=eu-west", "cluster=a,cluster=b", "version=[2"} {
+		_, err := ParseLabels(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestManager(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	manager := NewManager(store, "prod/")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	eu := Labels{"cluster": "eu-*"}
+	canary := Labels{"cluster": "eu-west", "host": "web-1"}
+
+	// Only existing configs are targeted
+	_, err := manager.Set("services/web", eu, storetest.EncodeString(t, "eu"), "alice@host", now)
+	assert.Error(t, err)
+	assert.NoError(t, store.Set("prod/services/web", storetest.EncodeString(t, "default")))
+	_, err = manager.Set("services/web", Labels{}, storetest.EncodeString(t, "eu"), "alice@host", now)
+	assert.Error(t, err)
+	_, err = manager.Set("services/web", eu, []byte("invalid"), "alice@host", now)
+	assert.Error(t, err)
+
+	// The rules matching more labels are evaluated first
+	_, err = manager.Set("services/web", eu, storetest.EncodeString(t, "eu"), "alice@host", now)
+	assert.NoError(t, err)
+	targeting, err := manager.Set("services/web", canary, storetest.EncodeString(t, "canary"), "alice@host", now)
+	assert.NoError(t, err)
+	assert.Len(t, targeting.Rules, 2)
+	assert.Equal(t, canary, targeting.Target(map[string]string{"cluster": "eu-west", "host": "web-1"}).Labels)
+	assert.Equal(t, eu, targeting.Target(map[string]string{"cluster": "eu-west", "host": "web-2"}).Labels)
+	assert.Nil(t, targeting.Target(map[string]string{"cluster": "us-east", "host": "web-1"}))
+
+	// A rule set again replaces the rule with the same labels
+	_, err = manager.Set("services/web", Labels{"cluster": "eu-*"}, storetest.EncodeString(t, "eu again"), "bob@host", now)
+	assert.NoError(t, err)
+	targeting, err = manager.Get("services/web")
+	assert.NoError(t, err)
+	assert.Len(t, targeting.Rules, 2)
+	assert.True(t, bytes.Equal(storetest.EncodeString(t, "eu again"), targeting.Rules[1].Value))
+
+	var b bytes.Buffer
+	printTargeting(&b, targeting)
+	assert.Equal(t, "services/web cluster=eu-west,host=web-1 set by alice@host at 2026-01-02T03:04:05Z\nservices/web cluster=eu-* set by bob@host at 2026-01-02T03:04:05Z\n", b.String())
+
+	assert.Error(t, manager.Remove("services/web", Labels{"cluster": "us-*"}))
+	assert.NoError(t, manager.Remove("services/web", canary))
+	assert.NoError(t, manager.Remove("services/web", eu))
+	_, err = manager.Get("services/web")
+	assert.Equal(t, ErrNoTargeting, err)
+}
+
+func TestWatcher(t *testing.T) {
+	store := libprotoconf.NewMemoryStore()
+	manager := NewManager(store, "")
+	assert.NoError(t, store.Set("services/web", storetest.EncodeString(t, "default")))
+	rollouts := rollout.NewWatcher(libprotoconf.NewStoreWatcher(store, ""), rollout.NewManager(store, ""), 10*time.Millisecond)
+	watcher := NewWatcher(rollouts, manager, 10*time.Millisecond)
+	defer watcher.Close()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	canaryCh, err := watcher.WatchClient("services/web", libprotoconf.Client{ID: "web-1", Labels: map[string]string{"host": "web-1"}}, stopCh)
+	assert.NoError(t, err)
+	otherCh, err := watcher.WatchClient("services/web", libprotoconf.Client{ID: "web-2", Labels: map[string]string{"host": "web-2"}}, stopCh)
+	assert.NoError(t, err)
+	next := func(ch <-chan libprotoconf.Result) string {
+		select {
+		case result := <-ch:
+			assert.NoError(t, result.Error)
+			value := &wrapperspb.StringValue{}
+			assert.NoError(t, result.Value.UnmarshalTo(value))
+			return value.GetValue()
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+			return ""
+		}
+	}
+	assert.Equal(t, "default", next(canaryCh))
+	assert.Equal(t, "default", next(otherCh))
+
+	_, err = manager.Set("services/web", Labels{"host": "web-1"}, storetest.EncodeString(t, "canary"), "alice@host", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "canary", next(canaryCh))
+
+	// The other clients get the values of the watcher of the rollouts
+	_, err = rollout.NewManager(store, "").Start("services/web", storetest.EncodeString(t, "rolled out"), rollout.Policy{{Percentage: 100}}, "alice@host", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "rolled out", next(otherCh))
+
+	assert.NoError(t, manager.Remove("services/web", Labels{"host": "web-1"}))
+	assert.Equal(t, "rolled out", next(canaryCh))
+
+	// The targeting rules aren't listed as configs
+	paths, err := watcher.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services/web"}, paths)
+}
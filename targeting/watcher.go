@@ -0,0 +1,216 @@
+package targeting
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/protoconf/protoconf/libprotoconf"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Watcher serves the values targeted to the clients matching the targeting
+// rules of the configs, and the values of another watcher otherwise. The
+// rules are read from the store every interval, as the store can't notify the
+// rules set before their keys exist.
+type Watcher struct {
+	libprotoconf.Watcher
+	manager *Manager
+
+	lock sync.Mutex
+	// targetings are the targeting rules read last by path, along with their
+	// JSON to tell their changes
+	targetings map[string]*Targeting
+	data       map[string]string
+	// changes are notified of the changes of the rules of their path
+	changes map[string]map[chan struct{}]bool
+	stopCh  chan struct{}
+}
+
+// NewWatcher serves the targeting rules of manager along with the configs of
+// watcher, reading the rules every interval until the watcher is closed. The
+// clients are watched by watcher too when it's a libprotoconf.ClientWatcher,
+// such as the watcher of the rollouts.
+func NewWatcher(watcher libprotoconf.Watcher, manager *Manager, interval time.Duration) *Watcher {
+	w := &Watcher{
+		Watcher:    watcher,
+		manager:    manager,
+		targetings: make(map[string]*Targeting),
+		data:       make(map[string]string),
+		changes:    make(map[string]map[chan struct{}]bool),
+		stopCh:     make(chan struct{}),
+	}
+	w.poll()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.poll()
+			case <-w.stopCh:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// poll reads the targeting rules and notifies the watches of the rules
+// changed, set or removed
+func (w *Watcher) poll() {
+	list, err := w.manager.List()
+	if err != nil {
+		log.Printf("Error reading targeting rules, keeping the previous ones, err=%s", err)
+		return
+	}
+	targetings := make(map[string]*Targeting)
+	data := make(map[string]string)
+	for _, t := range list {
+		encoded, err := json.Marshal(t)
+		if err != nil {
+			continue
+		}
+		targetings[t.Path], data[t.Path] = t, string(encoded)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for path, changes := range w.changes {
+		if data[path] == w.data[path] {
+			continue
+		}
+		for ch := range changes {
+			select {
+			case ch <- struct{}{}:
+			default:
+				// Notified already
+			}
+		}
+	}
+	w.targetings, w.data = targetings, data
+}
+
+func (w *Watcher) targeting(path string) *Targeting {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.targetings[path]
+}
+
+func (w *Watcher) notify(path string, ch chan struct{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.changes[path] == nil {
+		w.changes[path] = make(map[chan struct{}]bool)
+	}
+	w.changes[path][ch] = true
+}
+
+func (w *Watcher) stopNotifying(path string, ch chan struct{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.changes[path], ch)
+	if len(w.changes[path]) == 0 {
+		delete(w.changes, path)
+	}
+}
+
+// WatchClient watches a config as client sees it, the value of the first
+// targeting rule matching its labels and the value of the config otherwise.
+// The value changes as the rules or the config change.
+func (w *Watcher) WatchClient(path string, client libprotoconf.Client, stopCh <-chan struct{}) (<-chan libprotoconf.Result, error) {
+	configStopCh := make(chan struct{})
+	var configCh <-chan libprotoconf.Result
+	var err error
+	if watcher, ok := w.Watcher.(libprotoconf.ClientWatcher); ok {
+		configCh, err = watcher.WatchClient(path, client, configStopCh)
+	} else {
+		configCh, err = w.Watcher.Watch(path, configStopCh)
+	}
+	if err != nil {
+		close(configStopCh)
+		return nil, err
+	}
+	changes := make(chan struct{}, 1)
+	w.notify(path, changes)
+
+	watchCh := make(chan libprotoconf.Result)
+	go func() {
+		defer func() {
+			w.stopNotifying(path, changes)
+			close(configStopCh)
+			close(watchCh)
+			// Drain the values sent until the watcher stops watching
+			for range configCh {
+			}
+		}()
+
+		var config libprotoconf.Result
+		var sent *anypb.Any
+		var sentStale bool
+		for {
+			select {
+			case result, ok := <-configCh:
+				if !ok {
+					return
+				}
+				if result.Error != nil {
+					select {
+					case watchCh <- result:
+					case <-stopCh:
+					}
+					return
+				}
+				config = result
+			case <-changes:
+				if config.Value == nil {
+					// The value of the config wasn't read yet
+					continue
+				}
+			case <-stopCh:
+				return
+			}
+
+			result := config
+			if t := w.targeting(path); t != nil {
+				if rule := t.Target(client.Labels); rule != nil {
+					value, err := libprotoconf.DecodeConfig(rule.Value)
+					if err != nil {
+						log.Printf("Error decoding the value targeted to %s of %s, serving the config, err=%s", rule.Labels, path, err)
+					} else {
+						result = libprotoconf.Result{Value: value.GetValue(), Stale: config.Stale}
+					}
+				}
+			}
+			if sent != nil && proto.Equal(sent, result.Value) && result.Stale == sentStale {
+				continue
+			}
+			select {
+			case watchCh <- result:
+				sent, sentStale = result.Value, result.Stale
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return watchCh, nil
+}
+
+// List lists the configs of the watcher, when it's a libprotoconf.Lister
+func (w *Watcher) List(prefix string) ([]string, error) {
+	lister, ok := w.Watcher.(libprotoconf.Lister)
+	if !ok {
+		return nil, errors.New("listing configs isn't supported")
+	}
+	return lister.List(prefix)
+}
+
+// Close stops reading the targeting rules and closes the watcher of the
+// configs
+func (w *Watcher) Close() {
+	close(w.stopCh)
+	w.Watcher.Close()
+}
@@ -0,0 +1,33 @@
+// Package testutil holds the fixtures shared by the tests of the protoconf
+// packages
+package testutil
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ProtoAccessor returns a proto accessor reading the protos from memory,
+// protos maps the path of every proto to its source
+func ProtoAccessor(protos map[string]string) func(path string) (io.ReadCloser, error) {
+	return func(path string) (io.ReadCloser, error) {
+		if source, ok := protos[path]; ok {
+			return ioutil.NopCloser(strings.NewReader(source)), nil
+		}
+		return nil, os.ErrNotExist
+	}
+}
+
+// MustAny packs message in an Any, failing the test if it can't
+func MustAny(t testing.TB, message proto.Message) *anypb.Any {
+	value, err := anypb.New(message)
+	assert.NoError(t, err)
+	return value
+}
@@ -0,0 +1,105 @@
+// Package tracing traces protoconf with OpenTelemetry, exporting the spans of
+// compiling and serving configs to an OTLP collector
+package tracing
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/protoconf/protoconf/consts"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+const instrumentationName = "github.com/protoconf/protoconf"
+
+// The attributes of the spans
+const (
+	ConfigKey     = attribute.Key("protoconf.config")
+	PathKey       = attribute.Key("protoconf.path")
+	ProtoFilesKey = attribute.Key("protoconf.proto_files")
+)
+
+// AddFlag adds the -otlp-endpoint flag to an existing flagset
+func AddFlag(fs *flag.FlagSet, endpoint *string) {
+	fs.StringVar(endpoint, "otlp-endpoint", "", "OTLP gRPC endpoint of the collector the traces are exported to, http://host:port without TLS or https://host:port, e.g. http://localhost:4317 (default: no tracing)")
+}
+
+// Init exports the spans of service to the OTLP collector at endpoint, until
+// the function returned is called to flush the spans left. Spans are dropped
+// when endpoint is empty.
+func Init(endpoint string, service string) (func(), error) {
+	if endpoint == "" {
+		return func() {}, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid OTLP endpoint %s, expected http://host:port or https://host:port", endpoint)
+	}
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP exporter, endpoint=%s err=%s", endpoint, err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(service),
+		semconv.ServiceVersion(consts.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	log.Printf("Exporting traces to %s", endpoint)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Printf("Error exporting traces, endpoint=%s err=%s", endpoint, err)
+		}
+	}, nil
+}
+
+// Start starts a span under the span of ctx, a new trace when ctx has none
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// StartLinked starts a span under the span of ctx as Start does, linked to
+// the span of another trace which caused it, e.g. reading a config sent
+func StartLinked(ctx context.Context, name string, link trace.SpanContext, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...), trace.WithLinks(trace.Link{SpanContext: link}))
+}
+
+// End ends a span, marking it failed when err isn't nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ServerOptions are the gRPC server options tracing the calls, as part of the
+// traces of the clients propagating them
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{grpc.StatsHandler(otelgrpc.NewServerHandler())}
+}
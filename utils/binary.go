@@ -6,15 +6,13 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/golang/protobuf/proto"
-	"github.com/golang/protobuf/protoc-gen-go/descriptor"
-
-	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type decoder struct {
-	msgDesc *desc.MessageDescriptor
-	visitor func(pos int, len int, msgDesc *desc.MessageDescriptor)
+	msgDesc protoreflect.MessageDescriptor
+	visitor func(pos int, len int, msgDesc protoreflect.MessageDescriptor)
 }
 
 func (d *decoder) Unmarshal(b []byte) error {
@@ -27,14 +25,14 @@ func (d *decoder) unmarshal(buf *codedBuffer, isGroup bool) error {
 		if err != nil {
 			return err
 		}
-		if wireType == proto.WireEndGroup {
+		if wireType == protowire.EndGroupType {
 			if isGroup {
 				// finished parsing group
 				return nil
 			}
-			return proto.ErrInternalBadWireType
+			return errBadWireType
 		}
-		fd := d.msgDesc.FindFieldByNumber(tagNumber)
+		fd := d.msgDesc.Fields().ByNumber(protowire.Number(tagNumber))
 		if fd == nil {
 			err := unmarshalUnknownField(wireType, buf)
 			if err != nil {
@@ -53,17 +51,17 @@ func (d *decoder) unmarshal(buf *codedBuffer, isGroup bool) error {
 	return nil
 }
 
-func (d *decoder) unmarshalKnownField(fd *desc.FieldDescriptor, encoding int8, b *codedBuffer) error {
+func (d *decoder) unmarshalKnownField(fd protoreflect.FieldDescriptor, encoding protowire.Type, b *codedBuffer) error {
 	var err error
 	switch encoding {
-	case proto.WireFixed32:
+	case protowire.Fixed32Type:
 		_, err = b.decodeFixed32()
-	case proto.WireFixed64:
+	case protowire.Fixed64Type:
 		_, err = b.decodeFixed64()
-	case proto.WireVarint:
+	case protowire.VarintType:
 		_, err = b.decodeVarint()
 
-	case proto.WireBytes:
+	case protowire.BytesType:
 		start := b.index
 		_, err = b.decodeVarint()
 		if err == nil {
@@ -71,34 +69,34 @@ func (d *decoder) unmarshalKnownField(fd *desc.FieldDescriptor, encoding int8, b
 			b.index = start
 			var raw []byte
 			raw, err = b.decodeRawBytes(false)
-			if err == nil && (fd.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE || fd.GetType() == descriptor.FieldDescriptorProto_TYPE_GROUP) {
-				if fd.GetMessageType() == nil {
-					return fmt.Errorf("cannot parse field %s from byte-encoded wire type", fd.GetFullyQualifiedName())
+			if err == nil && (fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind) {
+				if fd.Message() == nil {
+					return fmt.Errorf("cannot parse field %s from byte-encoded wire type", fd.FullName())
 				}
 
-				visitor := func(pos int, len int, msgDesc *desc.MessageDescriptor) {
+				visitor := func(pos int, len int, msgDesc protoreflect.MessageDescriptor) {
 					d.visitor(startData+pos, len, msgDesc)
 				}
-				newDecoder := &decoder{msgDesc: fd.GetMessageType(), visitor: visitor}
+				newDecoder := &decoder{msgDesc: fd.Message(), visitor: visitor}
 				err = newDecoder.Unmarshal(raw)
 				if err == nil {
-					d.visitor(startData, len(raw), fd.GetMessageType())
+					d.visitor(startData, len(raw), fd.Message())
 				}
 			}
 		}
 
-	case proto.WireStartGroup:
-		if fd.GetMessageType() == nil {
-			return fmt.Errorf("cannot parse field %s from group-encoded wire type", fd.GetFullyQualifiedName())
+	case protowire.StartGroupType:
+		if fd.Message() == nil {
+			return fmt.Errorf("cannot parse field %s from group-encoded wire type", fd.FullName())
 		}
-		newDecoder := &decoder{msgDesc: fd.GetMessageType(), visitor: d.visitor}
+		newDecoder := &decoder{msgDesc: fd.Message(), visitor: d.visitor}
 		before := b.index
 		err = newDecoder.unmarshal(b, true)
 		if err == nil {
-			d.visitor(before, b.index-before, fd.GetMessageType())
+			d.visitor(before, b.index-before, fd.Message())
 		}
 	default:
-		return proto.ErrInternalBadWireType
+		return errBadWireType
 	}
 	if err != nil {
 		return err
@@ -107,25 +105,25 @@ func (d *decoder) unmarshalKnownField(fd *desc.FieldDescriptor, encoding int8, b
 	return nil
 }
 
-func unmarshalUnknownField(encoding int8, b *codedBuffer) error {
+func unmarshalUnknownField(encoding protowire.Type, b *codedBuffer) error {
 	var err error
 	switch encoding {
-	case proto.WireFixed32:
+	case protowire.Fixed32Type:
 		_, err = b.decodeFixed32()
-	case proto.WireFixed64:
+	case protowire.Fixed64Type:
 		_, err = b.decodeFixed64()
-	case proto.WireVarint:
+	case protowire.VarintType:
 		_, err = b.decodeVarint()
-	case proto.WireBytes:
+	case protowire.BytesType:
 		_, err = b.decodeRawBytes(false)
-	case proto.WireStartGroup:
+	case protowire.StartGroupType:
 		var groupEnd int
 		groupEnd, _, err = skipGroup(b)
 		if err == nil {
 			b.index = groupEnd
 		}
 	default:
-		err = proto.ErrInternalBadWireType
+		err = errBadWireType
 	}
 	if err != nil {
 		return err
@@ -148,15 +146,15 @@ func skipGroup(b *codedBuffer) (int, int, error) {
 		}
 		// skip past the field's data
 		switch wireType {
-		case proto.WireFixed32:
+		case protowire.Fixed32Type:
 			if !b.skip(4) {
 				return 0, 0, io.ErrUnexpectedEOF
 			}
-		case proto.WireFixed64:
+		case protowire.Fixed64Type:
 			if !b.skip(8) {
 				return 0, 0, io.ErrUnexpectedEOF
 			}
-		case proto.WireVarint:
+		case protowire.VarintType:
 			// skip varint by finding last byte (has high bit unset)
 			i := b.index
 			for {
@@ -169,7 +167,7 @@ func skipGroup(b *codedBuffer) (int, int, error) {
 				i++
 			}
 			b.index++
-		case proto.WireBytes:
+		case protowire.BytesType:
 			l, err := b.decodeVarint()
 			if err != nil {
 				return 0, 0, err
@@ -181,16 +179,16 @@ func skipGroup(b *codedBuffer) (int, int, error) {
 			if !b.skip(int(l)) {
 				return 0, 0, io.ErrUnexpectedEOF
 			}
-		case proto.WireStartGroup:
+		case protowire.StartGroupType:
 			endIndex, _, err := skipGroup(b)
 			if err != nil {
 				return 0, 0, err
 			}
 			b.index = endIndex
-		case proto.WireEndGroup:
+		case protowire.EndGroupType:
 			return b.index, fieldStart, nil
 		default:
-			return 0, 0, proto.ErrInternalBadWireType
+			return 0, 0, errBadWireType
 		}
 	}
 }
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"github.com/bufbuild/protocompile"
+	protoconf "github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	"google.golang.org/genproto/googleapis/api"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/genproto/googleapis/type/calendarperiod"
+	"google.golang.org/genproto/googleapis/type/color"
+	"google.golang.org/genproto/googleapis/type/date"
+	"google.golang.org/genproto/googleapis/type/datetime"
+	"google.golang.org/genproto/googleapis/type/dayofweek"
+	"google.golang.org/genproto/googleapis/type/decimal"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/genproto/googleapis/type/fraction"
+	"google.golang.org/genproto/googleapis/type/interval"
+	"google.golang.org/genproto/googleapis/type/latlng"
+	"google.golang.org/genproto/googleapis/type/localized_text"
+	"google.golang.org/genproto/googleapis/type/money"
+	"google.golang.org/genproto/googleapis/type/month"
+	"google.golang.org/genproto/googleapis/type/phone_number"
+	"google.golang.org/genproto/googleapis/type/postaladdress"
+	"google.golang.org/genproto/googleapis/type/quaternion"
+	"google.golang.org/genproto/googleapis/type/timeofday"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// bundledProtos are the common `google/type` and `google/api` protos, the
+// `protoconf/validate.proto` options, the `protoconf/policy.proto` policy
+// and `protoconf/tenants.proto` tenants of the server, the
+// `protoconf/webhooks.proto` webhooks and the `protoconf/flags.proto` feature
+// flags, which can be imported without being copied to an import path
+var bundledProtos = map[string]protoreflect.FileDescriptor{}
+
+func init() {
+	for _, file := range []protoreflect.FileDescriptor{
+		annotations.File_google_api_annotations_proto,
+		annotations.File_google_api_client_proto,
+		annotations.File_google_api_field_behavior_proto,
+		annotations.File_google_api_field_info_proto,
+		annotations.File_google_api_http_proto,
+		annotations.File_google_api_resource_proto,
+		annotations.File_google_api_routing_proto,
+		api.File_google_api_launch_stage_proto,
+		httpbody.File_google_api_httpbody_proto,
+		calendarperiod.File_google_type_calendar_period_proto,
+		color.File_google_type_color_proto,
+		date.File_google_type_date_proto,
+		datetime.File_google_type_datetime_proto,
+		dayofweek.File_google_type_dayofweek_proto,
+		decimal.File_google_type_decimal_proto,
+		expr.File_google_type_expr_proto,
+		fraction.File_google_type_fraction_proto,
+		interval.File_google_type_interval_proto,
+		latlng.File_google_type_latlng_proto,
+		localized_text.File_google_type_localized_text_proto,
+		money.File_google_type_money_proto,
+		month.File_google_type_month_proto,
+		phone_number.File_google_type_phone_number_proto,
+		postaladdress.File_google_type_postal_address_proto,
+		quaternion.File_google_type_quaternion_proto,
+		timeofday.File_google_type_timeofday_proto,
+		protoconf.File_protoconf_flags_proto,
+		protoconf.File_protoconf_policy_proto,
+		protoconf.File_protoconf_tenants_proto,
+		protoconf.File_protoconf_validate_proto,
+		protoconf.File_protoconf_webhooks_proto,
+	} {
+		bundledProtos[file.Path()] = file
+	}
+}
+
+// withBundledImports resolves the bundled protos which aren't found by
+// resolver, so files in the import paths take precedence over them
+func withBundledImports(resolver protocompile.Resolver) protocompile.Resolver {
+	return protocompile.ResolverFunc(func(path string) (protocompile.SearchResult, error) {
+		result, err := resolver.FindFileByPath(path)
+		if err != nil {
+			if file, ok := bundledProtos[path]; ok {
+				return protocompile.SearchResult{Desc: file}, nil
+			}
+		}
+		return result, err
+	})
+}
@@ -8,12 +8,15 @@ import (
 	"io"
 	"math"
 
-	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 // ErrOverflow is returned when an integer is too large to be represented.
 var ErrOverflow = errors.New("proto: integer overflow")
 
+var errBadWireType = errors.New("proto: bad wiretype")
+
 type codedBuffer struct {
 	buf   []byte
 	index int
@@ -165,14 +168,14 @@ done:
 	return x, nil
 }
 
-func (cb *codedBuffer) decodeTagAndWireType() (tag int32, wireType int8, err error) {
+func (cb *codedBuffer) decodeTagAndWireType() (tag int32, wireType protowire.Type, err error) {
 	var v uint64
 	v, err = cb.decodeVarint()
 	if err != nil {
 		return
 	}
 	// low 7 bits is wire type
-	wireType = int8(v & 7)
+	wireType = protowire.Type(v & 7)
 	// rest is int32 tag number
 	v = v >> 3
 	if v > math.MaxInt32 {
@@ -279,7 +282,7 @@ func (cb *codedBuffer) encodeVarint(x uint64) error {
 	return nil
 }
 
-func (cb *codedBuffer) encodeTagAndWireType(tag int32, wireType int8) error {
+func (cb *codedBuffer) encodeTagAndWireType(tag int32, wireType protowire.Type) error {
 	v := uint64((int64(tag) << 3) | int64(wireType))
 	return cb.encodeVarint(v)
 }
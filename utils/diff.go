@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// FieldDiff is a field changed between two values of a message
+type FieldDiff struct {
+	// Path is the path of the field, e.g. crawlers[0].timeout or
+	// labels["env"]
+	Path string
+	// Old and New are the values of the field formatted, empty when the field
+	// isn't set
+	Old string
+	New string
+}
+
+func (d FieldDiff) String() string {
+	switch {
+	case d.Old == "":
+		return fmt.Sprintf("+ %s: %s", d.Path, d.New)
+	case d.New == "":
+		return fmt.Sprintf("- %s: %s", d.Path, d.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", d.Path, d.Old, d.New)
+	}
+}
+
+// DiffConfigs lists the fields changed from old to new, two values of a
+// config, resolving their types from the protos of the root. A change of the
+// type of the config is the only change listed.
+func DiffConfigs(old *protoconfvalue.ProtoconfValue, new *protoconfvalue.ProtoconfValue, protoconfRoot string) ([]FieldDiff, error) {
+	if old.GetValue().GetTypeUrl() != new.GetValue().GetTypeUrl() {
+		return []FieldDiff{{Path: "@type", Old: old.GetValue().GetTypeUrl(), New: new.GetValue().GetTypeUrl()}}, nil
+	}
+
+	importPaths, err := ProtoImportPaths(protoconfRoot)
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := LoadAnyResolverFromImportPaths(importPaths, new.GetProtoFile())
+	if err != nil {
+		return nil, err
+	}
+	options := proto.UnmarshalOptions{Resolver: resolver}
+	oldMessage, err := anypb.UnmarshalNew(old.GetValue(), options)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling the old config, err=%s", err)
+	}
+	newMessage, err := anypb.UnmarshalNew(new.GetValue(), options)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling the new config, err=%s", err)
+	}
+	return DiffMessages(oldMessage.ProtoReflect(), newMessage.ProtoReflect()), nil
+}
+
+// DiffMessages lists the fields changed from old to new, two values of the
+// same message, in the order of the fields. The elements of lists are
+// compared by index and the entries of maps by key.
+func DiffMessages(old protoreflect.Message, new protoreflect.Message) []FieldDiff {
+	var diffs []FieldDiff
+	diffMessage("", old, new, &diffs)
+	return diffs
+}
+
+func diffMessage(prefix string, old protoreflect.Message, new protoreflect.Message, diffs *[]FieldDiff) {
+	fields := old.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		path := prefix + string(field.Name())
+		hasOld, hasNew := old.Has(field), new.Has(field)
+		switch {
+		case !hasOld && !hasNew:
+		case !hasOld:
+			*diffs = append(*diffs, FieldDiff{Path: path, New: formatField(field, new.Get(field))})
+		case !hasNew:
+			*diffs = append(*diffs, FieldDiff{Path: path, Old: formatField(field, old.Get(field))})
+		case field.IsList():
+			diffList(path, field, old.Get(field).List(), new.Get(field).List(), diffs)
+		case field.IsMap():
+			diffMap(path, field, old.Get(field).Map(), new.Get(field).Map(), diffs)
+		default:
+			diffValue(path, field, old.Get(field), new.Get(field), diffs)
+		}
+	}
+}
+
+func diffList(path string, field protoreflect.FieldDescriptor, old protoreflect.List, new protoreflect.List, diffs *[]FieldDiff) {
+	for i := 0; i < old.Len() || i < new.Len(); i++ {
+		elementPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= old.Len():
+			*diffs = append(*diffs, FieldDiff{Path: elementPath, New: formatValue(field, new.Get(i))})
+		case i >= new.Len():
+			*diffs = append(*diffs, FieldDiff{Path: elementPath, Old: formatValue(field, old.Get(i))})
+		default:
+			diffValue(elementPath, field, old.Get(i), new.Get(i), diffs)
+		}
+	}
+}
+
+func diffMap(path string, field protoreflect.FieldDescriptor, old protoreflect.Map, new protoreflect.Map, diffs *[]FieldDiff) {
+	keys := make(map[string]protoreflect.MapKey)
+	collect := func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys[formatValue(field.MapKey(), key.Value())] = key
+		return true
+	}
+	old.Range(collect)
+	new.Range(collect)
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	value := field.MapValue()
+	for _, name := range names {
+		key := keys[name]
+		entryPath := fmt.Sprintf("%s[%s]", path, name)
+		switch {
+		case !old.Has(key):
+			*diffs = append(*diffs, FieldDiff{Path: entryPath, New: formatValue(value, new.Get(key))})
+		case !new.Has(key):
+			*diffs = append(*diffs, FieldDiff{Path: entryPath, Old: formatValue(value, old.Get(key))})
+		default:
+			diffValue(entryPath, value, old.Get(key), new.Get(key), diffs)
+		}
+	}
+}
+
+// diffValue compares a single value of field, nested messages field by field
+func diffValue(path string, field protoreflect.FieldDescriptor, old protoreflect.Value, new protoreflect.Value, diffs *[]FieldDiff) {
+	if field.Message() != nil {
+		diffMessage(path+".", old.Message(), new.Message(), diffs)
+		return
+	}
+	if !old.Equal(new) {
+		*diffs = append(*diffs, FieldDiff{Path: path, Old: formatValue(field, old), New: formatValue(field, new)})
+	}
+}
+
+// formatField formats the value of a field, every element of lists and maps
+func formatField(field protoreflect.FieldDescriptor, value protoreflect.Value) string {
+	switch {
+	case field.IsList():
+		list := value.List()
+		elements := make([]string, list.Len())
+		for i := range elements {
+			elements[i] = formatValue(field, list.Get(i))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case field.IsMap():
+		var entries []string
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			entries = append(entries, formatValue(field.MapKey(), key.Value())+": "+formatValue(field.MapValue(), value))
+			return true
+		})
+		sort.Strings(entries)
+		return "{" + strings.Join(entries, ", ") + "}"
+	default:
+		return formatValue(field, value)
+	}
+}
+
+// formatMessage formats the fields set of a message, in the order of the
+// fields. The text format isn't used as its spacing is unstable.
+func formatMessage(message protoreflect.Message) string {
+	var fields []string
+	descriptors := message.Descriptor().Fields()
+	for i := 0; i < descriptors.Len(); i++ {
+		field := descriptors.Get(i)
+		if message.Has(field) {
+			fields = append(fields, string(field.Name())+": "+formatField(field, message.Get(field)))
+		}
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// formatValue formats a single value of field
+func formatValue(field protoreflect.FieldDescriptor, value protoreflect.Value) string {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return formatMessage(value.Message())
+	case protoreflect.StringKind:
+		return strconv.Quote(value.String())
+	case protoreflect.BytesKind:
+		return strconv.Quote(string(value.Bytes()))
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			return string(enumValue.Name())
+		}
+		return strconv.Itoa(int(value.Enum()))
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
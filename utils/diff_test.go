@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/protoconf/protoconf/testutil"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const crawlerProto = `syntax = "proto3";
+enum Level {
+  DEBUG = 0;
+  INFO = 1;
+}
+message Crawler {
+  string url = 1;
+  int32 timeout = 2;
+  Level level = 3;
+}
+message Config {
+  string name = 1;
+  repeated Crawler crawlers = 2;
+  map<string, string> labels = 3;
+  repeated string tags = 4;
+  Crawler fallback = 5;
+}
+`
+
+func TestDiffMessages(t *testing.T) {
+	files, err := ParseProtoFiles(nil, testutil.ProtoAccessor(map[string]string{"crawler.proto": crawlerProto}), "crawler.proto")
+	assert.NoError(t, err)
+	desc := files[0].Messages().ByName("Config")
+	parse := func(text string) *dynamicpb.Message {
+		message := dynamicpb.NewMessage(desc)
+		assert.NoError(t, prototext.Unmarshal([]byte(text), message))
+		return message
+	}
+
+	old := parse(`name: "crawlers" crawlers { url: "a" timeout: 10 } crawlers { url: "b" }
+		labels { key: "env" value: "prod" } labels { key: "team" value: "web" } tags: "x"`)
+	assert.Empty(t, DiffMessages(old, old))
+
+	new := parse(`name: "crawlers" crawlers { url: "a" timeout: 20 level: INFO }
+		labels { key: "env" value: "staging" } labels { key: "owner" value: "me" }
+		fallback { url: "c" }`)
+	var diffs []string
+	for _, diff := range DiffMessages(old, new) {
+		diffs = append(diffs, diff.String())
+	}
+	assert.Equal(t, []string{
+		`~ crawlers[0].timeout: 10 -> 20`,
+		`+ crawlers[0].level: INFO`,
+		`- crawlers[1]: {url: "b"}`,
+		`~ labels["env"]: "prod" -> "staging"`,
+		`+ labels["owner"]: "me"`,
+		`- labels["team"]: "web"`,
+		`- tags: ["x"]`,
+		`+ fallback: {url: "c"}`,
+	}, diffs)
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/protoconf/protoconf/consts"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// ProtoImportPaths returns the directories protos are resolved from: the
+// protoconf src dir, the proto paths of the workspace config and the Go
+// modules declared in the workspace go.mod
+func ProtoImportPaths(protoconfRoot string) ([]string, error) {
+	importPaths := []string{filepath.Join(protoconfRoot, consts.SrcPath)}
+
+	workspace, err := LoadWorkspace(protoconfRoot)
+	if err != nil {
+		return importPaths, err
+	}
+	importPaths = append(importPaths, workspace.AbsProtoPaths(protoconfRoot)...)
+
+	moduleDirs, err := GoModuleProtoPaths(protoconfRoot)
+	if err != nil {
+		return importPaths, err
+	}
+	return append(importPaths, moduleDirs...), nil
+}
+
+// GoModuleProtoPaths returns the module cache directories of the Go modules
+// required directly by the go.mod file at the protoconf root, so their protos
+// can be imported as if they were under src/
+func GoModuleProtoPaths(protoconfRoot string) ([]string, error) {
+	goModFile := filepath.Join(protoconfRoot, consts.GoModFile)
+	data, err := ioutil.ReadFile(goModFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading %s, err=%s", goModFile, err)
+	}
+
+	modFile, err := modfile.Parse(goModFile, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s, err=%s", goModFile, err)
+	}
+
+	replacements := make(map[string]module.Version)
+	for _, replace := range modFile.Replace {
+		replacements[replace.Old.Path] = replace.New
+	}
+
+	var dirs []string
+	for _, require := range modFile.Require {
+		if require.Indirect {
+			continue
+		}
+		mod := require.Mod
+		if replacement, ok := replacements[mod.Path]; ok {
+			if replacement.Version == "" {
+				dir := replacement.Path
+				if !filepath.IsAbs(dir) {
+					dir = filepath.Join(protoconfRoot, dir)
+				}
+				dirs = append(dirs, dir)
+				continue
+			}
+			mod = replacement
+		}
+
+		dir, err := goModuleCacheDir(mod)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("module %s not found in the module cache (run `go mod download` in %s), err=%s", mod, protoconfRoot, err)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	return dirs, nil
+}
+
+func goModuleCacheDir(mod module.Version) (string, error) {
+	cache := os.Getenv("GOMODCACHE")
+	if cache == "" {
+		gopath := filepath.SplitList(os.Getenv("GOPATH"))
+		if len(gopath) > 0 && gopath[0] != "" {
+			cache = filepath.Join(gopath[0], "pkg", "mod")
+		} else {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("error locating the module cache, err=%s", err)
+			}
+			cache = filepath.Join(home, "go", "pkg", "mod")
+		}
+	}
+
+	escapedPath, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return "", err
+	}
+	escapedVersion, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, escapedPath+"@"+escapedVersion), nil
+}
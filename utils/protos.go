@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/parser"
+	"github.com/bufbuild/protocompile/reporter"
+	"github.com/ghodss/yaml"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// descriptorCacheVersion is part of the cache key, bump it when the cached
+// descriptors may change for the same proto file
+const descriptorCacheVersion = "v1"
+
+// ProtoAccessor opens a proto file given its path joined to one of the import paths
+type ProtoAccessor func(path string) (io.ReadCloser, error)
+
+// ParseProtoFiles compiles proto files, given relative to the import paths,
+// into descriptors. Imports are resolved from the import paths, then from the
+// well known protos bundled with protobuf and from the common google.type and
+// google.api protos bundled with protoconf. Files are read from disk unless an
+// accessor is given.
+func ParseProtoFiles(importPaths []string, accessor ProtoAccessor, files ...string) ([]protoreflect.FileDescriptor, error) {
+	return (&ProtoParser{ImportPaths: importPaths, Accessor: accessor}).Parse(files...)
+}
+
+// ProtoParser compiles proto files into descriptors, see ParseProtoFiles
+type ProtoParser struct {
+	ImportPaths []string
+	Accessor    ProtoAccessor
+	// CacheDir, if set, is where parsed files are kept between runs, keyed by
+	// the hash of their path and content, so unchanged files are only linked
+	CacheDir string
+	// SourceInfo keeps the comments and positions of the parsed files, the
+	// cache dir is not used when set since cached files have neither
+	SourceInfo bool
+}
+
+// Parse compiles the given proto files, see ParseProtoFiles
+func (p *ProtoParser) Parse(files ...string) ([]protoreflect.FileDescriptor, error) {
+	cache := &descriptorCache{
+		dir:    p.CacheDir,
+		source: &protocompile.SourceResolver{ImportPaths: p.ImportPaths, Accessor: p.Accessor},
+	}
+	var resolver protocompile.Resolver = cache.source
+	if cache.dir != "" && !p.SourceInfo {
+		resolver = protocompile.ResolverFunc(cache.findFileByPath)
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(withBundledImports(resolver)),
+	}
+	if p.SourceInfo {
+		compiler.SourceInfoMode = protocompile.SourceInfoStandard
+	}
+	results, err := compiler.Compile(context.Background(), files...)
+	if err != nil {
+		return nil, err
+	}
+	// Files are only cached once they compiled successfully, so errors found
+	// when linking them keep pointing to their source
+	cache.flush()
+	descriptors := make([]protoreflect.FileDescriptor, len(results))
+	for i, result := range results {
+		descriptors[i] = result
+	}
+	return descriptors, nil
+}
+
+type descriptorCache struct {
+	dir     string
+	source  protocompile.Resolver
+	mu      sync.Mutex
+	pending map[string]*descriptorpb.FileDescriptorProto
+}
+
+func (c *descriptorCache) findFileByPath(path string) (protocompile.SearchResult, error) {
+	result, err := c.source.FindFileByPath(path)
+	if err != nil {
+		return result, err
+	}
+	data, err := ioutil.ReadAll(result.Source)
+	if closer, ok := result.Source.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return protocompile.SearchResult{}, err
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{descriptorCacheVersion, path, string(data)} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	if cached, err := ioutil.ReadFile(filepath.Join(c.dir, key)); err == nil {
+		fileProto := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(cached, fileProto); err == nil && fileProto.GetName() == path {
+			return protocompile.SearchResult{Proto: fileProto}, nil
+		}
+	}
+
+	// Parse errors are left for the compiler to report
+	handler := reporter.NewHandler(nil)
+	ast, err := parser.Parse(path, bytes.NewReader(data), handler)
+	if err != nil {
+		return protocompile.SearchResult{Source: bytes.NewReader(data)}, nil
+	}
+	parsed, err := parser.ResultFromAST(ast, true, handler)
+	if err != nil {
+		return protocompile.SearchResult{Source: bytes.NewReader(data)}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[string]*descriptorpb.FileDescriptorProto)
+	}
+	c.pending[key] = proto.Clone(parsed.FileDescriptorProto()).(*descriptorpb.FileDescriptorProto)
+	return protocompile.SearchResult{ParseResult: parsed}, nil
+}
+
+// flush writes the files parsed since the last flush to the cache dir. The
+// cache is best effort, failing to write it isn't an error.
+func (c *descriptorCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return
+	}
+	for key, fileProto := range c.pending {
+		data, err := proto.Marshal(fileProto)
+		if err != nil {
+			continue
+		}
+		// Write and rename so concurrent compilations never read a partial file
+		tmp, err := ioutil.TempFile(c.dir, key+".tmp")
+		if err != nil {
+			continue
+		}
+		_, err = tmp.Write(data)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil || os.Rename(tmp.Name(), filepath.Join(c.dir, key)) != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	c.pending = nil
+}
+
+// NewAnyResolver returns a type registry holding the messages, enums and
+// extensions of the given files and their dependencies, used to resolve `Any`
+// messages and extensions when marshaling
+func NewAnyResolver(files ...protoreflect.FileDescriptor) *protoregistry.Types {
+	types := &protoregistry.Types{}
+	seen := make(map[string]bool)
+	var register func(file protoreflect.FileDescriptor)
+	register = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			register(imports.Get(i).FileDescriptor)
+		}
+		registerTypes(types, file.Messages(), file.Enums(), file.Extensions())
+	}
+	for _, file := range files {
+		register(file)
+	}
+	return types
+}
+
+func registerTypes(types *protoregistry.Types, messages protoreflect.MessageDescriptors, enums protoreflect.EnumDescriptors, extensions protoreflect.ExtensionDescriptors) {
+	for i := 0; i < enums.Len(); i++ {
+		if _, err := types.FindEnumByName(enums.Get(i).FullName()); err == protoregistry.NotFound {
+			types.RegisterEnum(dynamicpb.NewEnumType(enums.Get(i)))
+		}
+	}
+	for i := 0; i < extensions.Len(); i++ {
+		if _, err := types.FindExtensionByName(extensions.Get(i).FullName()); err == protoregistry.NotFound {
+			types.RegisterExtension(dynamicpb.NewExtensionType(extensions.Get(i)))
+		}
+	}
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		if _, err := types.FindMessageByName(message.FullName()); err == protoregistry.NotFound {
+			types.RegisterMessage(dynamicpb.NewMessageType(message))
+		}
+		registerTypes(types, message.Messages(), message.Enums(), message.Extensions())
+	}
+}
+
+// MarshalJSON marshals a message to indented JSON, resolving `Any` messages
+// with the given resolver. The output is stable, unlike protojson's.
+func MarshalJSON(message proto.Message, resolver *protoregistry.Types) ([]byte, error) {
+	data, err := protojson.MarshalOptions{Resolver: resolver}.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// MarshalYAML marshals a message to YAML by way of its JSON form, so 64-bit
+// integers are quoted strings, as in JSON, and keep their exact value when read
+// by YAML parsers which decode numbers to floats
+func MarshalYAML(message proto.Message, resolver *protoregistry.Types) ([]byte, error) {
+	data, err := protojson.MarshalOptions{Resolver: resolver}.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(data)
+}
+
+// MarshalText marshals a message to the multiline text format
+func MarshalText(message proto.Message, resolver *protoregistry.Types) ([]byte, error) {
+	return prototext.MarshalOptions{Multiline: true, Indent: "  ", Resolver: resolver}.Marshal(message)
+}
+
+// FileDescriptorSet returns the descriptors of files and of the files they
+// import, transitively, with each file following its imports
+func FileDescriptorSet(files ...protoreflect.FileDescriptor) *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(file protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(file))
+	}
+	for _, file := range files {
+		add(file)
+	}
+	return set
+}
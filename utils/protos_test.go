@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/protoconf/protoconf/testutil"
+	assert "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const integersProto = `syntax = "proto3";
+message Integers {
+  int64 int64_value = 1;
+  sint64 sint64_value = 2;
+  sfixed64 sfixed64_value = 3;
+  uint64 uint64_value = 4;
+  fixed64 fixed64_value = 5;
+  int32 int32_value = 6;
+  uint32 uint32_value = 7;
+  repeated int64 int64_values = 8;
+  map<int64, uint64> by_int64 = 9;
+}
+`
+
+func TestInt64RoundTrip(t *testing.T) {
+	files, err := ParseProtoFiles(nil, testutil.ProtoAccessor(map[string]string{"integers.proto": integersProto}), "integers.proto")
+	assert.NoError(t, err)
+	desc := files[0].Messages().ByName("Integers")
+	fields := desc.Fields()
+
+	boundaries := []struct {
+		signed   int64
+		unsigned uint64
+	}{
+		{math.MaxInt64, math.MaxUint64},
+		{math.MinInt64, 0},
+		{1<<53 + 1, 1<<53 + 1},
+		{-(1<<53 + 1), 1 << 63},
+	}
+	for _, boundary := range boundaries {
+		message := dynamicpb.NewMessage(desc)
+		for _, name := range []protoreflect.Name{"int64_value", "sint64_value", "sfixed64_value"} {
+			message.Set(fields.ByName(name), protoreflect.ValueOfInt64(boundary.signed))
+		}
+		for _, name := range []protoreflect.Name{"uint64_value", "fixed64_value"} {
+			message.Set(fields.ByName(name), protoreflect.ValueOfUint64(boundary.unsigned))
+		}
+		message.Set(fields.ByName("int32_value"), protoreflect.ValueOfInt32(math.MinInt32))
+		message.Set(fields.ByName("uint32_value"), protoreflect.ValueOfUint32(math.MaxUint32))
+		list := message.Mutable(fields.ByName("int64_values")).List()
+		list.Append(protoreflect.ValueOfInt64(boundary.signed))
+		byInt64 := message.Mutable(fields.ByName("by_int64")).Map()
+		byInt64.Set(protoreflect.ValueOfInt64(boundary.signed).MapKey(), protoreflect.ValueOfUint64(boundary.unsigned))
+
+		jsonData, err := MarshalJSON(message, nil)
+		assert.NoError(t, err)
+		fromJSON := dynamicpb.NewMessage(desc)
+		assert.NoError(t, protojson.Unmarshal(jsonData, fromJSON))
+		assert.True(t, proto.Equal(message, fromJSON), "JSON round trip of %s", jsonData)
+
+		yamlData, err := MarshalYAML(message, nil)
+		assert.NoError(t, err)
+		// YAML consumers must not see 64-bit integers as numbers
+		var decoded map[string]interface{}
+		assert.NoError(t, yaml.Unmarshal(yamlData, &decoded))
+		assert.IsType(t, "", decoded["int64Value"])
+		if boundary.unsigned != 0 {
+			assert.IsType(t, "", decoded["uint64Value"])
+		}
+		yamlJSON, err := yaml.YAMLToJSON(yamlData)
+		assert.NoError(t, err)
+		fromYAML := dynamicpb.NewMessage(desc)
+		assert.NoError(t, protojson.Unmarshal(yamlJSON, fromYAML))
+		assert.True(t, proto.Equal(message, fromYAML), "YAML round trip of %s", yamlData)
+
+		textData, err := MarshalText(message, nil)
+		assert.NoError(t, err)
+		fromText := dynamicpb.NewMessage(desc)
+		assert.NoError(t, prototext.Unmarshal(textData, fromText))
+		assert.True(t, proto.Equal(message, fromText), "text round trip of %s", textData)
+	}
+}
+
+const floatsProto = `syntax = "proto3";
+message Floats {
+  double double_value = 1;
+  float float_value = 2;
+  repeated double double_values = 3;
+}
+`
+
+func TestNonFiniteFloats(t *testing.T) {
+	files, err := ParseProtoFiles(nil, testutil.ProtoAccessor(map[string]string{"floats.proto": floatsProto}), "floats.proto")
+	assert.NoError(t, err)
+	desc := files[0].Messages().ByName("Floats")
+	fields := desc.Fields()
+
+	message := dynamicpb.NewMessage(desc)
+	message.Set(fields.ByName("double_value"), protoreflect.ValueOfFloat64(math.NaN()))
+	message.Set(fields.ByName("float_value"), protoreflect.ValueOfFloat32(float32(math.Inf(1))))
+	list := message.Mutable(fields.ByName("double_values")).List()
+	list.Append(protoreflect.ValueOfFloat64(math.Inf(-1)))
+
+	check := func(decoded protoreflect.Message, format string) {
+		assert.True(t, math.IsNaN(decoded.Get(fields.ByName("double_value")).Float()), format)
+		assert.True(t, math.IsInf(decoded.Get(fields.ByName("float_value")).Float(), 1), format)
+		assert.True(t, math.IsInf(decoded.Get(fields.ByName("double_values")).List().Get(0).Float(), -1), format)
+	}
+
+	jsonData, err := MarshalJSON(message, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(jsonData), `"doubleValue": "NaN"`)
+	assert.Contains(t, string(jsonData), `"floatValue": "Infinity"`)
+	assert.Contains(t, string(jsonData), `"-Infinity"`)
+	fromJSON := dynamicpb.NewMessage(desc)
+	assert.NoError(t, protojson.Unmarshal(jsonData, fromJSON))
+	check(fromJSON, "JSON")
+
+	yamlData, err := MarshalYAML(message, nil)
+	assert.NoError(t, err)
+	// Strings, as in JSON, rather than YAML's own .nan and .inf
+	assert.Contains(t, string(yamlData), `doubleValue: NaN`)
+	yamlJSON, err := yaml.YAMLToJSON(yamlData)
+	assert.NoError(t, err)
+	fromYAML := dynamicpb.NewMessage(desc)
+	assert.NoError(t, protojson.Unmarshal(yamlJSON, fromYAML))
+	check(fromYAML, "YAML")
+
+	textData, err := MarshalText(message, nil)
+	assert.NoError(t, err)
+	// prototext randomizes its whitespace
+	text := strings.Join(strings.Fields(string(textData)), " ")
+	assert.Contains(t, text, "double_value: nan")
+	assert.Contains(t, text, "float_value: inf")
+	assert.Contains(t, text, "double_values: -inf")
+	fromText := dynamicpb.NewMessage(desc)
+	assert.NoError(t, prototext.Unmarshal(textData, fromText))
+	check(fromText, "text")
+}
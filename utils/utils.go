@@ -3,47 +3,51 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"io/ioutil"
 	"path/filepath"
 
-	"github.com/golang/protobuf/jsonpb"
-	"github.com/golang/protobuf/proto"
-	"github.com/jhump/protoreflect/desc/protoparse"
-	"github.com/jhump/protoreflect/dynamic"
 	"github.com/protoconf/protoconf/consts"
 	protoconfvalue "github.com/protoconf/protoconf/datatypes/proto/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 // ReadConfig reads a materialized config
 func ReadConfig(protoconfRoot string, configName string) (*protoconfvalue.ProtoconfValue, error) {
 	filename := filepath.Join(protoconfRoot, consts.CompiledConfigPath, configName+consts.CompiledConfigExtension)
 
-	configReader, err := os.Open(filename)
+	jsonData, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error opening config file, file=%s", filename)
 	}
-	defer configReader.Close()
+	return UnmarshalConfig(protoconfRoot, jsonData)
+}
 
+// UnmarshalConfig unmarshals a config as it's materialized, resolving its type
+// from the protos of protoconfRoot
+func UnmarshalConfig(protoconfRoot string, jsonData []byte) (*protoconfvalue.ProtoconfValue, error) {
 	type configJSONType struct {
 		ProtoFile string
 	}
 	var configJSON configJSONType
-	if err = json.NewDecoder(configReader).Decode(&configJSON); err != nil {
+	if err := json.Unmarshal(jsonData, &configJSON); err != nil {
 		return nil, err
 	}
 
-	anyResolver, err := LoadAnyResolver(filepath.Join(protoconfRoot, consts.SrcPath), configJSON.ProtoFile)
+	importPaths, err := ProtoImportPaths(protoconfRoot)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err = configReader.Seek(0, 0); err != nil {
+	anyResolver, err := LoadAnyResolverFromImportPaths(importPaths, configJSON.ProtoFile)
+	if err != nil {
 		return nil, err
 	}
 
 	protoconfValue := &protoconfvalue.ProtoconfValue{}
-	um := jsonpb.Unmarshaler{AnyResolver: anyResolver}
-	if err = um.Unmarshal(configReader, protoconfValue); err != nil {
+	um := protojson.UnmarshalOptions{Resolver: anyResolver}
+	if err = um.Unmarshal(jsonData, protoconfValue); err != nil {
 		return nil, fmt.Errorf("error marshaling, err=%s", err)
 	}
 
@@ -51,13 +55,17 @@ func ReadConfig(protoconfRoot string, configName string) (*protoconfvalue.Protoc
 }
 
 // LoadAnyResolver is a util that helps resolve `Any` messages
-func LoadAnyResolver(rootPath string, parseFiles ...string) (jsonpb.AnyResolver, error) {
-	parser := &protoparse.Parser{ImportPaths: []string{rootPath}}
-	descriptors, err := parser.ParseFiles(parseFiles...)
+func LoadAnyResolver(rootPath string, parseFiles ...string) (*protoregistry.Types, error) {
+	return LoadAnyResolverFromImportPaths([]string{rootPath}, parseFiles...)
+}
+
+// LoadAnyResolverFromImportPaths is like LoadAnyResolver but resolves protos from several import paths
+func LoadAnyResolverFromImportPaths(importPaths []string, parseFiles ...string) (*protoregistry.Types, error) {
+	descriptors, err := ParseProtoFiles(importPaths, nil, parseFiles...)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing proto file, file=%s err=%v", parseFiles, err)
 	}
-	return dynamic.AnyResolver(nil, descriptors...), nil
+	return NewAnyResolver(descriptors...), nil
 }
 
 // ReplaceProtoBytes replaces the information inside a proto serialized byte array
@@ -78,7 +86,7 @@ func ReplaceProtoBytes(protoBytes []byte, pos int, length int, replacement []byt
 		}
 		end := cb.index
 
-		if (wireType != proto.WireBytes && wireType != proto.WireStartGroup) || end < pos {
+		if (wireType != protowire.BytesType && wireType != protowire.StartGroupType) || end < pos {
 			ret.buf = append(ret.buf, cb.buf[start:end]...)
 			ret.index = len(ret.buf)
 			continue
@@ -92,7 +100,7 @@ func ReplaceProtoBytes(protoBytes []byte, pos int, length int, replacement []byt
 
 		var newBytes []byte
 		if cb.index == pos {
-			if wireType != proto.WireBytes {
+			if wireType != protowire.BytesType {
 				return nil, fmt.Errorf("expecting wire type bytes got=%d", wireType)
 			}
 			if int(oldLength) != length {
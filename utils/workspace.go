@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"github.com/protoconf/protoconf/consts"
+)
+
+// Workspace is the workspace level configuration, read from the protoconf.yaml file at the protoconf root
+type Workspace struct {
+	// ProtoPaths are additional directories protos are imported from, relative to the protoconf root
+	ProtoPaths []string `json:"proto_paths,omitempty"`
+	// AnyTypeURLPrefix is the prefix of the type URLs of messages assigned to `google.protobuf.Any` fields,
+	// e.g. `types.example.com/`, defaults to `type.googleapis.com/`
+	AnyTypeURLPrefix string `json:"any_type_url_prefix,omitempty"`
+	// PostCompileHooks are the Starlark scripts, relative to the src dir, registering hooks run on the outputs of
+	// all the configs compiled together
+	PostCompileHooks []string `json:"post_compile_hooks,omitempty"`
+	// DefaultsAllowlist are the fields, given by full name or pattern (e.g. `acme.Service.*`), which
+	// `protoconf compile -audit-defaults` doesn't warn about when left at their default value
+	DefaultsAllowlist []string `json:"defaults_allowlist,omitempty"`
+	// PolicyBundle is the bundle of Rego policies, a directory or a bundle archive relative to the protoconf root,
+	// every output is evaluated against by the `opa` CLI
+	PolicyBundle string `json:"policy_bundle,omitempty"`
+	// PolicyQuery is the query outputs are evaluated with, defaults to `data.protoconf.deny`
+	PolicyQuery string `json:"policy_query,omitempty"`
+}
+
+// LoadWorkspace reads the workspace configuration of a protoconf root, a missing file yields an empty workspace
+func LoadWorkspace(protoconfRoot string) (*Workspace, error) {
+	filename := filepath.Join(protoconfRoot, consts.WorkspaceConfigFile)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Workspace{}, nil
+		}
+		return nil, fmt.Errorf("error reading workspace config, file=%s err=%s", filename, err)
+	}
+
+	workspace := &Workspace{}
+	if err := yaml.Unmarshal(data, workspace); err != nil {
+		return nil, fmt.Errorf("error parsing workspace config, file=%s err=%s", filename, err)
+	}
+	return workspace, nil
+}
+
+// AbsProtoPaths returns the workspace proto paths joined with the protoconf root
+func (w *Workspace) AbsProtoPaths(protoconfRoot string) []string {
+	var paths []string
+	for _, path := range w.ProtoPaths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(protoconfRoot, path)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
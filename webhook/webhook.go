@@ -0,0 +1,273 @@
+// Package webhook posts the changes of the configs to the webhooks of a
+// protoconf.Webhooks config, for chat alerts and the automation reacting to
+// the deploys of the configs without polling them
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	"github.com/protoconf/protoconf/libprotoconf"
+)
+
+// SignatureHeader is the header of the posts to the webhooks with a secret,
+// sha256= and the hex HMAC-SHA256 of the body with the secret
+const SignatureHeader = "X-Protoconf-Signature"
+
+// The posts failing with an error of the network or of the webhook are
+// posted again, as many as Attempts times, RetryDelay after the first
+// attempt and twice as long after every attempt
+const (
+	Attempts   = 3
+	RetryDelay = time.Second
+	// Timeout bounds every attempt
+	Timeout = 10 * time.Second
+)
+
+// AddFlag adds the -webhooks flag to an existing flagset
+func AddFlag(fs *flag.FlagSet, path *string) {
+	fs.StringVar(path, "webhooks", "", "Path of the protoconf.Webhooks config, the webhooks of which are posted the changes of the configs as they are recorded to the audit log")
+}
+
+// Notifier posts the changes of the configs to the webhooks of a Webhooks
+// config. It's an audit.Log keeping no entries, which posts the entries in
+// the background as they are appended.
+type Notifier struct {
+	client     *http.Client
+	retryDelay time.Duration
+	posts      sync.WaitGroup
+
+	lock     sync.RWMutex
+	webhooks []*protoconf.Webhooks_Webhook
+}
+
+// NewNotifier returns a Notifier posting the changes to the webhooks of
+// webhooks
+func NewNotifier(webhooks *protoconf.Webhooks) (*Notifier, error) {
+	n := &Notifier{client: &http.Client{Timeout: Timeout}, retryDelay: RetryDelay}
+	if err := n.update(webhooks); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Read reads the Webhooks config of path from the configs written to store
+// under prefix
+func Read(store libprotoconf.Store, prefix string, path string) (*Notifier, error) {
+	data, err := store.Get(prefix + path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhooks config, path=%s err=%s", path, err)
+	}
+	value, err := libprotoconf.DecodeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding webhooks config, path=%s err=%s", path, err)
+	}
+	webhooks := &protoconf.Webhooks{}
+	if err := value.GetValue().UnmarshalTo(webhooks); err != nil {
+		return nil, fmt.Errorf("error reading webhooks config, path=%s err=%s", path, err)
+	}
+	return NewNotifier(webhooks)
+}
+
+// Watch reads the Webhooks config of path from the configs of watcher and
+// keeps the notifier up to date until stopCh is closed. It fails when the
+// config can't be read.
+func Watch(watcher libprotoconf.Watcher, path string, stopCh <-chan struct{}) (*Notifier, error) {
+	updates, err := watcher.Watch(path, stopCh)
+	if err != nil {
+		return nil, fmt.Errorf("error watching webhooks config, path=%s err=%s", path, err)
+	}
+	n := &Notifier{client: &http.Client{Timeout: Timeout}, retryDelay: RetryDelay}
+	read := func(update libprotoconf.Result) error {
+		if update.Error != nil {
+			return fmt.Errorf("error reading webhooks config, path=%s err=%s", path, update.Error)
+		}
+		webhooks := &protoconf.Webhooks{}
+		if err := update.Value.UnmarshalTo(webhooks); err != nil {
+			return fmt.Errorf("error reading webhooks config, path=%s err=%s", path, err)
+		}
+		return n.update(webhooks)
+	}
+	if err := read(<-updates); err != nil {
+		return nil, err
+	}
+	go func() {
+		for update := range updates {
+			if err := read(update); err != nil {
+				log.Printf("Error updating webhooks, keeping the previous ones, err=%s", err)
+				continue
+			}
+			log.Printf("Webhooks updated, path=%s", path)
+		}
+	}()
+	return n, nil
+}
+
+func (n *Notifier) update(webhooks *protoconf.Webhooks) error {
+	for _, webhook := range webhooks.GetWebhooks() {
+		u, err := url.Parse(webhook.GetUrl())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook url %q", webhook.GetUrl())
+		}
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.webhooks = webhooks.GetWebhooks()
+	return nil
+}
+
+// Append posts entry to the webhooks of its path and action, in the
+// background
+func (n *Notifier) Append(entry *audit.Entry) error {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	for _, webhook := range n.webhooks {
+		if !matches(webhook, entry) {
+			continue
+		}
+		body, err := payload(webhook.GetFormat(), entry)
+		if err != nil {
+			return err
+		}
+		n.posts.Add(1)
+		go func(webhook *protoconf.Webhooks_Webhook) {
+			defer n.posts.Done()
+			if err := n.post(webhook, body); err != nil {
+				log.Printf("Error posting the change of config to webhook, path=%s url=%s err=%s", entry.Path, redact(webhook.GetUrl()), err)
+			}
+		}(webhook)
+	}
+	return nil
+}
+
+// Entries fails, the webhooks keep no entries
+func (n *Notifier) Entries(path string) ([]*audit.Entry, error) {
+	return nil, errors.New("the webhooks keep no changes of the configs")
+}
+
+// Wait waits for the posts in the background, before the commands posting
+// the changes exit
+func (n *Notifier) Wait() {
+	n.posts.Wait()
+}
+
+// matches tells whether webhook is posted entry, by its path and action
+func matches(webhook *protoconf.Webhooks_Webhook, entry *audit.Entry) bool {
+	matched := len(webhook.GetPrefixes()) == 0
+	for _, prefix := range webhook.GetPrefixes() {
+		matched = matched || strings.HasPrefix(entry.Path, prefix)
+	}
+	if !matched || len(webhook.GetActions()) == 0 {
+		return matched
+	}
+	for _, action := range webhook.GetActions() {
+		if action == entry.Action {
+			return true
+		}
+	}
+	return false
+}
+
+// actions are the verbs of the actions in the messages posted to the chats
+var actions = map[string]string{
+	audit.ActionInsert:   "inserted",
+	audit.ActionDelete:   "deleted",
+	audit.ActionMutate:   "mutated",
+	audit.ActionPatch:    "patched",
+	audit.ActionPromote:  "promoted the rollout of",
+	audit.ActionRollback: "rolled back",
+	audit.ActionExpire:   "reverted the expired value of",
+}
+
+// payload is the body posted to a webhook of format: the entry as it's
+// recorded to the audit log for JSON, a message for SLACK
+func payload(format protoconf.Webhooks_Format, entry *audit.Entry) ([]byte, error) {
+	if format != protoconf.Webhooks_SLACK {
+		return json.Marshal(entry)
+	}
+	action, ok := actions[entry.Action]
+	if !ok {
+		action = entry.Action
+	}
+	text := fmt.Sprintf("%s %s `%s`", entry.Identity, action, entry.Path)
+	switch {
+	case entry.OldVersion != "" && entry.NewVersion != "":
+		text += fmt.Sprintf(", version %s → %s", entry.OldVersion, entry.NewVersion)
+	case entry.NewVersion != "":
+		text += fmt.Sprintf(", version %s", entry.NewVersion)
+	}
+	if len(entry.Changes) > 0 {
+		text += "\n```\n" + strings.Join(entry.Changes, "\n") + "\n```"
+	}
+	return json.Marshal(struct {
+		Text string `json:"text"`
+	}{text})
+}
+
+// post posts body to webhook, again after the errors of the network and
+// the errors of the webhook which may not last
+func (n *Notifier) post(webhook *protoconf.Webhooks_Webhook, body []byte) error {
+	delay := n.retryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := n.attempt(webhook, body)
+		if err == nil || !retry || attempt == Attempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (n *Notifier) attempt(webhook *protoconf.Webhooks_Webhook, body []byte) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, webhook.GetUrl(), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "protoconf")
+	if secret := webhook.GetSecret(); secret != "" {
+		request.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+	response, err := n.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("the webhook responded %s", response.Status)
+}
+
+// Sign is the signature of body with secret, as the webhooks get it in
+// the SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// redact drops the path and the query of a url from the logs, as the urls
+// of the chat webhooks are secrets
+func redact(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "?"
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/protoconf/protoconf/audit"
+	"github.com/protoconf/protoconf/datatypes/proto/protoconf"
+	"github.com/protoconf/protoconf/libprotoconf"
+	assert "github.com/stretchr/testify/require"
+)
+
+type post struct {
+	path      string
+	body      []byte
+	signature string
+}
+
+// receiver records the posts to its webhooks, by the path of their url,
+// failing the first failures posts
+type receiver struct {
+	lock     sync.Mutex
+	posts    []post
+	failures int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	r.posts = append(r.posts, post{req.URL.Path, body, req.Header.Get(SignatureHeader)})
+}
+
+func TestNotifier(t *testing.T) {
+	r := &receiver{failures: 1}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	store := libprotoconf.NewMemoryStore()
+	assert.NoError(t, store.SetConfig("protoconf/webhooks", &protoconf.Webhooks{
+		Webhooks: []*protoconf.Webhooks_Webhook{
+			{Url: server.URL + "/all", Secret: "secret"},
+			{Url: server.URL + "/services", Prefixes: []string{"services/"}, Actions: []string{audit.ActionInsert}, Format: protoconf.Webhooks_SLACK},
+		},
+	}))
+	notifier, err := Read(store, "protoconf/", "webhooks")
+	assert.NoError(t, err)
+	notifier.retryDelay = time.Millisecond
+
+	entry := &audit.Entry{Identity: "alice", Action: audit.ActionInsert, Path: "services/api", OldVersion: "1", NewVersion: "2", Changes: []string{"~ timeout: 10 -> 20"}}
+	assert.NoError(t, notifier.Append(entry))
+	assert.NoError(t, notifier.Append(&audit.Entry{Identity: "bob", Action: audit.ActionDelete, Path: "services/web"}))
+	assert.NoError(t, notifier.Append(&audit.Entry{Identity: "bob", Action: audit.ActionInsert, Path: "jobs/backup"}))
+	notifier.Wait()
+
+	byPath := map[string][]post{}
+	for _, p := range r.posts {
+		byPath[p.path] = append(byPath[p.path], p)
+	}
+	assert.Len(t, byPath["/all"], 3, "the failed post is posted again")
+	assert.Len(t, byPath["/services"], 1, "the posts are selected by prefix and action")
+	for _, p := range byPath["/all"] {
+		assert.Equal(t, Sign("secret", p.body), p.signature)
+		got := &audit.Entry{}
+		assert.NoError(t, json.Unmarshal(p.body, got))
+		if got.Path == entry.Path {
+			assert.Equal(t, entry, got)
+		}
+	}
+
+	message := byPath["/services"][0]
+	assert.Empty(t, message.signature)
+	text := struct{ Text string }{}
+	assert.NoError(t, json.Unmarshal(message.body, &text))
+	assert.Equal(t, "alice inserted `services/api`, version 1 → 2\n```\n~ timeout: 10 -> 20\n```", text.Text)
+}
+
+func TestInvalidWebhooks(t *testing.T) {
+	for _, url := range []string{"", "ftp://example.com/hook", "https://"} {
+		_, err := NewNotifier(&protoconf.Webhooks{Webhooks: []*protoconf.Webhooks_Webhook{{Url: url}}})
+		assert.Error(t, err, url)
+	}
+
+	store := libprotoconf.NewMemoryStore()
+	_, err := Read(store, "", "webhooks")
+	assert.Error(t, err)
+}